@@ -0,0 +1,341 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severities of configuration issues. Critical issues stop the backend from starting in strict mode.
+const (
+	SeverityCritical = "critical"
+	SeverityError    = "error"
+	SeverityWarning  = "warning"
+)
+
+// ConfigIssue is a problem found with one setting
+type ConfigIssue struct {
+	Setting  string `json:"setting"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// ValidationReport lists the configuration issues found, with counts per severity
+type ValidationReport struct {
+	CheckedAt time.Time     `json:"checked_at"`
+	Strict    bool          `json:"strict"`
+	Valid     bool          `json:"valid"` // no critical issue nor error
+	Critical  int           `json:"critical"`
+	Errors    int           `json:"errors"`
+	Warnings  int           `json:"warnings"`
+	Issues    []ConfigIssue `json:"issues"`
+}
+
+func (r *ValidationReport) add(setting, severity, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, ConfigIssue{Setting: setting, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	switch severity {
+	case SeverityCritical:
+		r.Critical++
+	case SeverityError:
+		r.Errors++
+	default:
+		r.Warnings++
+	}
+	r.Valid = r.Critical == 0 && r.Errors == 0
+}
+
+// HasCritical reports whether an issue would stop the backend from starting in strict mode
+func (r *ValidationReport) HasCritical() bool {
+	return r.Critical > 0
+}
+
+// StrictMode reports whether the backend refuses to start on critical misconfiguration, set with
+// CONFIG_STRICT=true
+func StrictMode() bool {
+	return os.Getenv("CONFIG_STRICT") == "true"
+}
+
+// isProduction mirrors the environment detection of the backend
+func isProduction() bool {
+	env := strings.ToLower(os.Getenv("ENVIRONMENT"))
+	return env == "prod" || env == "production"
+}
+
+// ValidateEnvironment checks the environment variables the backend reads, without connecting to
+// anything
+func ValidateEnvironment() *ValidationReport {
+	report := &ValidationReport{CheckedAt: time.Now(), Strict: StrictMode(), Valid: true, Issues: []ConfigIssue{}}
+	production := isProduction()
+
+	switch env := strings.ToLower(os.Getenv("ENVIRONMENT")); env {
+	case "", "dev", "development", "prod", "production", "staging", "test":
+	default:
+		report.add("ENVIRONMENT", SeverityWarning, "unknown environment %q is treated as development", env)
+	}
+
+	// Database
+	if os.Getenv("SKIP_DB_PING") != "true" {
+		for _, key := range []string{"DB_HOST", "DB_USER", "DB_PASSWORD", "DB_NAME"} {
+			if os.Getenv(key) == "" {
+				report.add(key, SeverityCritical, "%s is required to connect to the database", key)
+			}
+		}
+	}
+	checkPort(report, "DB_PORT")
+	sslModes := []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+	if mode := os.Getenv("DB_SSL_MODE"); mode != "" && !slices.Contains(sslModes, mode) {
+		report.add("DB_SSL_MODE", SeverityError, "%q is not one of %s", mode, strings.Join(sslModes, ", "))
+	} else if mode == "disable" && production {
+		report.add("DB_SSL_MODE", SeverityWarning, "database traffic is unencrypted in production")
+	}
+	checkPositiveInt(report, "DB_SLOW_QUERY_MS")
+	for _, entry := range strings.Split(os.Getenv("DB_REPLICA_HOSTS"), ",") {
+		if _, port, err := net.SplitHostPort(strings.TrimSpace(entry)); err == nil {
+			if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+				report.add("DB_REPLICA_HOSTS", SeverityError, "%q doesn't have a valid port", entry)
+			}
+		}
+	}
+	if value := os.Getenv("DB_REPLICA_MAX_LAG"); value != "" {
+		if lag, err := time.ParseDuration(value); err != nil || lag <= 0 {
+			report.add("DB_REPLICA_MAX_LAG", SeverityWarning, "%q is not a positive duration like 30s, the default is used", value)
+		}
+	}
+
+	// Redis
+	checkPort(report, "REDIS_PORT")
+	if db := os.Getenv("REDIS_DB"); db != "" {
+		if n, err := strconv.Atoi(db); err != nil || n < 0 || n > 15 {
+			report.add("REDIS_DB", SeverityError, "%q is not a Redis database number between 0 and 15", db)
+		}
+	}
+
+	// SSH to the dokku host
+	for _, key := range []string{"SSH_HOST", "SSH_USER"} {
+		if os.Getenv(key) == "" {
+			report.add(key, SeverityCritical, "%s is required to run dokku commands", key)
+		}
+	}
+	checkPort(report, "SSH_PORT")
+	checkSSHKey(report)
+	checkPositiveInt(report, "SSH_MAX_OUTPUT_BYTES")
+	checkPositiveInt(report, "APP_BUNDLE_MAX_BYTES")
+
+	// Secrets
+	switch key := os.Getenv("ENCRYPTION_KEY"); {
+	case key == "":
+		report.add("ENCRYPTION_KEY", SeverityCritical, "ENCRYPTION_KEY is required to encrypt stored tokens")
+	case len(key) < 16:
+		report.add("ENCRYPTION_KEY", SeverityCritical, "ENCRYPTION_KEY must be at least 16 characters")
+	case len(key) < 32:
+		report.add("ENCRYPTION_KEY", SeverityWarning, "use at least 32 characters for ENCRYPTION_KEY")
+	}
+	if secret := os.Getenv("SSO_SESSION_SECRET"); secret != "" && len(secret) < 32 {
+		report.add("SSO_SESSION_SECRET", SeverityWarning, "use at least 32 characters for SSO_SESSION_SECRET")
+	}
+
+	// Hosts, HTTPS and cookies
+	checkHosts(report, production)
+	checkBool(report, "SSO_DEVICE_BINDING")
+	checkBool(report, "CONFIG_STRICT")
+	checkWebAuthn(report)
+	checkTrustedProxies(report)
+
+	// Logging
+	if level := strings.ToLower(os.Getenv("LOG_LEVEL")); level != "" && !slices.Contains([]string{"debug", "info", "warn", "warning", "error"}, level) {
+		report.add("LOG_LEVEL", SeverityWarning, "unknown log level %q", level)
+	}
+	if format := strings.ToLower(os.Getenv("LOG_FORMAT")); format != "" && format != "json" && format != "text" {
+		report.add("LOG_FORMAT", SeverityWarning, "unknown log format %q, use json or text", format)
+	}
+
+	// Integrations configured in pairs
+	checkPair(report, "GITHUB_CLIENT_ID", "GITHUB_CLIENT_SECRET")
+	checkPair(report, "ADMIN_USERNAME", "ADMIN_PASSWORD")
+	if value := os.Getenv("REPORT_CACHE_TTL"); value != "" {
+		if ttl, err := time.ParseDuration(value); err != nil || ttl < 0 {
+			report.add("REPORT_CACHE_TTL", SeverityWarning, "%q is not a duration like 1m, the default is used", value)
+		}
+	}
+	checkPort(report, "SMTP_PORT")
+	checkPair(report, "SMTP_HOST", "SMTP_FROM")
+	checkPair(report, "SMTP_USERNAME", "SMTP_PASSWORD")
+	if repo := os.Getenv("SAMPLE_APP_REPO"); repo != "" {
+		if parsed, err := url.Parse(repo); err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+			report.add("SAMPLE_APP_REPO", SeverityWarning, "%q is not an http(s) repository URL, the onboarding sample app can't be deployed", repo)
+		}
+	}
+	if value := os.Getenv("DEPLOY_MAX_BUILD_DURATION"); value != "" {
+		if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+			report.add("DEPLOY_MAX_BUILD_DURATION", SeverityError, "%q is not a positive duration like 45m", value)
+		}
+	}
+	return report
+}
+
+// checkHosts checks LOGIN_HOST, MAIN_DOMAIN and FORCE_HTTPS against each other
+func checkHosts(report *ValidationReport, production bool) {
+	loginHost := os.Getenv("LOGIN_HOST")
+	switch {
+	case loginHost == "" && production:
+		report.add("LOGIN_HOST", SeverityCritical, "LOGIN_HOST is required in production, sessions would be set for localhost")
+	case loginHost == "":
+		report.add("LOGIN_HOST", SeverityWarning, "LOGIN_HOST is not set, localhost is used")
+	case strings.Contains(loginHost, "://") || strings.ContainsAny(loginHost, "/?# "):
+		report.add("LOGIN_HOST", SeverityCritical, "LOGIN_HOST must be a host name, not a URL: %q", loginHost)
+	}
+
+	mainDomain := os.Getenv("MAIN_DOMAIN")
+	if mainDomain == "" {
+		if production {
+			report.add("MAIN_DOMAIN", SeverityWarning, "MAIN_DOMAIN is not set, app domains and CORS origins can't be derived")
+		}
+	} else if host := hostOnly(loginHost); host != "" && host != mainDomain && !strings.HasSuffix(host, "."+mainDomain) {
+		report.add("MAIN_DOMAIN", SeverityWarning, "LOGIN_HOST %s is not under MAIN_DOMAIN %s, sessions won't be shared with app subdomains", host, mainDomain)
+	}
+
+	forceHTTPS := os.Getenv("FORCE_HTTPS")
+	switch forceHTTPS {
+	case "", "true", "false":
+	default:
+		report.add("FORCE_HTTPS", SeverityError, "FORCE_HTTPS must be true or false, %q is treated as false", forceHTTPS)
+	}
+	httpsRequired := forceHTTPS == "" || forceHTTPS == "true"
+	host := hostOnly(loginHost)
+	local := host == "" || host == "localhost" || net.ParseIP(host) != nil
+	switch {
+	case httpsRequired && local:
+		report.add("FORCE_HTTPS", SeverityWarning, "HTTPS is required but %s can't get a public certificate, secure cookies won't be sent over plain http", orLocalhost(host))
+	case !httpsRequired && production:
+		report.add("FORCE_HTTPS", SeverityWarning, "HTTPS is off in production, session cookies are sent without the Secure flag")
+	}
+}
+
+// checkWebAuthn checks passkeys can be used on the login host
+func checkWebAuthn(report *ValidationReport) {
+	rpID := hostOnly(os.Getenv("WEBAUTHN_RP_ID"))
+	if host := hostOnly(os.Getenv("LOGIN_HOST")); rpID != "" && host != "" && host != rpID && !strings.HasSuffix(host, "."+rpID) {
+		report.add("WEBAUTHN_RP_ID", SeverityError, "passkeys for %s can't be used on LOGIN_HOST %s", rpID, host)
+	}
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			report.add("WEBAUTHN_ORIGINS", SeverityError, "%q is not an origin like https://citizen.example.com", origin)
+		}
+	}
+}
+
+// checkSSHKey checks a key is readable when SSH doesn't authenticate with a password
+func checkTrustedProxies(report *ValidationReport) {
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			report.add("TRUSTED_PROXIES", SeverityError, "%q is not an address or CIDR, it is ignored", entry)
+		}
+	}
+}
+
+func checkSSHKey(report *ValidationReport) {
+	if os.Getenv("SSH_PASSWORD") != "" {
+		return
+	}
+	keyPath := getEnvWithDefault("SSH_KEY_PATH", "~/.ssh/id_rsa")
+	if strings.HasPrefix(keyPath, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			keyPath = filepath.Join(home, keyPath[1:])
+		}
+	}
+	if _, err := os.Stat(keyPath); err != nil {
+		report.add("SSH_KEY_PATH", SeverityCritical, "no SSH_PASSWORD is set and the SSH key %s can't be read: %v", keyPath, errors.Unwrap(err))
+	}
+}
+
+func checkPort(report *ValidationReport, key string) {
+	if value := os.Getenv(key); value != "" {
+		if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+			report.add(key, SeverityCritical, "%q is not a port between 1 and 65535", value)
+		}
+	}
+}
+
+func checkPositiveInt(report *ValidationReport, key string) {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+			report.add(key, SeverityWarning, "%q is not a positive number, the default is used", value)
+		}
+	}
+}
+
+func checkBool(report *ValidationReport, key string) {
+	if value := os.Getenv(key); value != "" && value != "true" && value != "false" {
+		report.add(key, SeverityWarning, "%s must be true or false, %q is treated as false", key, value)
+	}
+}
+
+// checkPair reports settings that only work together when one of them is missing
+func checkPair(report *ValidationReport, first, second string) {
+	hasFirst, hasSecond := os.Getenv(first) != "", os.Getenv(second) != ""
+	switch {
+	case hasFirst && !hasSecond:
+		report.add(second, SeverityWarning, "%s is set without %s, it is ignored", first, second)
+	case hasSecond && !hasFirst:
+		report.add(first, SeverityWarning, "%s is set without %s, it is ignored", second, first)
+	}
+}
+
+// hostOnly strips the port of a host
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+func orLocalhost(host string) string {
+	if host == "" {
+		return "localhost"
+	}
+	return host
+}
+
+// CheckLoginHostCertificate connects to LOGIN_HOST over TLS and reports a certificate that
+// browsers wouldn't accept while HTTPS is required. It is run on demand, not at startup.
+func CheckLoginHostCertificate(ctx context.Context, report *ValidationReport) {
+	forceHTTPS := os.Getenv("FORCE_HTTPS")
+	host := hostOnly(os.Getenv("LOGIN_HOST"))
+	if (forceHTTPS != "" && forceHTTPS != "true") || host == "" || host == "localhost" || net.ParseIP(host) != nil {
+		return
+	}
+
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: 5 * time.Second}, Config: &tls.Config{ServerName: host}}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, "443"))
+	if err != nil {
+		report.add("FORCE_HTTPS", SeverityError, "HTTPS is required but %s:443 has no valid certificate: %v", host, err)
+		return
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) > 0 {
+		if remaining := time.Until(certs[0].NotAfter); remaining < 14*24*time.Hour {
+			report.add("FORCE_HTTPS", SeverityWarning, "the certificate of %s expires on %s", host, certs[0].NotAfter.Format("2006-01-02"))
+		}
+	}
+}
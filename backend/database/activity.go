@@ -2,8 +2,10 @@ package database
 
 import (
 	"context"
-	
+	"sync"
+
 	"backend/database/api"
+	"backend/utils"
 )
 
 // Re-export types from API package for compatibility
@@ -20,51 +22,70 @@ const (
 	ActivityConfig  = api.ActivityConfig
 	ActivityEnv     = api.ActivityEnv
 	ActivityBuild   = api.ActivityBuild
+	ActivityAlert   = api.ActivityAlert
 	
 	StatusSuccess = api.StatusSuccess
 	StatusError   = api.StatusError
 	StatusWarning = api.StatusWarning
 	StatusInfo    = api.StatusInfo
 	StatusPending = api.StatusPending
+	StatusCancelled = api.StatusCancelled
+	StatusQueued    = api.StatusQueued
+	StatusRunning   = api.StatusRunning
+	StatusSkipped   = api.StatusSkipped
+	StatusPendingApproval = api.StatusPendingApproval
+	StatusRejected        = api.StatusRejected
 	
 	TriggerManual    = api.TriggerManual
 	TriggerWebhook   = api.TriggerWebhook
 	TriggerAutomatic = api.TriggerAutomatic
+	TriggerScheduled = api.TriggerScheduled
 )
 
 // LogActivity logs a new activity to the database
 func LogActivity(appName string, activityType ActivityType, status ActivityStatus, message string, details map[string]interface{}, userID *int, triggerType TriggerType) (*Activity, error) {
-	return api.Activities.LogActivity(context.Background(), appName, activityType, status, message, details, userID, triggerType)
+	return traceActivity(api.Activities.LogActivity(context.Background(), appName, activityType, status, message, details, userID, triggerType))
 }
 
 // UpdateActivity updates an existing activity with completion status
 func UpdateActivity(activityID int, status ActivityStatus, errorMessage *string) error {
+	finishActivityTrace(activityID)
 	return api.Activities.UpdateActivity(context.Background(), activityID, status, errorMessage)
 }
 
+// SetActivityStatus changes the status of an activity still in progress
+func SetActivityStatus(activityID int, status ActivityStatus) error {
+	return api.Activities.SetActivityStatus(context.Background(), activityID, status)
+}
+
 // LogDeployActivity logs a deployment activity
 func LogDeployActivity(appName, gitURL, branch, commitHash, commitMessage string, userID *int, triggerType TriggerType) (*Activity, error) {
-	return api.Activities.LogDeployActivity(context.Background(), appName, gitURL, branch, commitHash, commitMessage, userID, triggerType)
+	return traceActivity(api.Activities.LogDeployActivity(context.Background(), appName, gitURL, branch, commitHash, commitMessage, userID, triggerType))
 }
 
 // LogRestartActivity logs a restart activity
 func LogRestartActivity(appName string, userID *int) (*Activity, error) {
-	return api.Activities.LogRestartActivity(context.Background(), appName, userID)
+	return traceActivity(api.Activities.LogRestartActivity(context.Background(), appName, userID))
 }
 
 // LogDomainActivity logs a domain-related activity
 func LogDomainActivity(appName, domain, action string, userID *int) (*Activity, error) {
-	return api.Activities.LogDomainActivity(context.Background(), appName, domain, action, userID)
+	return traceActivity(api.Activities.LogDomainActivity(context.Background(), appName, domain, action, userID))
 }
 
 // LogEnvActivity logs an environment variable activity
 func LogEnvActivity(appName, envKey, action string, userID *int) (*Activity, error) {
-	return api.Activities.LogEnvActivity(context.Background(), appName, envKey, action, userID)
+	return traceActivity(api.Activities.LogEnvActivity(context.Background(), appName, envKey, action, userID))
 }
 
 // LogConfigActivity logs a configuration activity
 func LogConfigActivity(appName, configType, message string, userID *int) (*Activity, error) {
-	return api.Activities.LogConfigActivity(context.Background(), appName, configType, message, userID)
+	return traceActivity(api.Activities.LogConfigActivity(context.Background(), appName, configType, message, userID))
+}
+
+// GetActivityByID fetches a single activity
+func GetActivityByID(activityID int) (*Activity, error) {
+	return api.Activities.GetActivityByID(context.Background(), activityID)
 }
 
 // GetAppActivities fetches activities for a specific app
@@ -74,7 +95,12 @@ func GetAppActivities(appName string, limit int) ([]Activity, error) {
 
 // LogWebhookDeployment logs a webhook-triggered deployment
 func LogWebhookDeployment(appName, gitURL, branch, commitHash, commitMessage, authorName string) (*Activity, error) {
-	return api.Activities.LogWebhookDeployment(context.Background(), appName, gitURL, branch, commitHash, commitMessage, authorName)
+	return traceActivity(api.Activities.LogWebhookDeployment(context.Background(), appName, gitURL, branch, commitHash, commitMessage, authorName))
+}
+
+// LogSkippedWebhookDeployment records a push that didn't auto-deploy an app
+func LogSkippedWebhookDeployment(appName, branch, commitHash, commitMessage, pusher, author, reason string) (*Activity, error) {
+	return api.Activities.LogSkippedWebhookDeployment(context.Background(), appName, branch, commitHash, commitMessage, pusher, author, reason)
 }
 
 // LogGitHubDeployment saves GitHub deployment to both tables
@@ -85,4 +111,58 @@ func LogGitHubDeployment(appName, commitHash, commitMessage, branch, authorName,
 // UpdateGitHubDeploymentStatus updates GitHub deployment status
 func UpdateGitHubDeploymentStatus(appName, commitHash, status string, output, errorOutput *string) error {
 	return api.Activities.UpdateGitHubDeploymentStatus(context.Background(), appName, commitHash, status, output, errorOutput)
-} 
\ No newline at end of file
+}
+
+// activityTraces holds the dokku command trace of each activity still in progress
+var (
+	activityTraces   = make(map[int]*utils.CommandTrace)
+	activityTracesMu sync.Mutex
+)
+
+// traceActivity starts recording dokku commands for a newly logged activity
+func traceActivity(activity *Activity, err error) (*Activity, error) {
+	if err != nil || activity == nil {
+		return activity, err
+	}
+
+	activityTracesMu.Lock()
+	activityTraces[activity.ID] = utils.StartCommandTrace(activity.AppName)
+	activityTracesMu.Unlock()
+
+	return activity, nil
+}
+
+// finishActivityTrace stores the recorded dokku commands in the activity details
+func finishActivityTrace(activityID int) {
+	activityTracesMu.Lock()
+	trace, ok := activityTraces[activityID]
+	delete(activityTraces, activityID)
+	activityTracesMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	commands := trace.Stop()
+	if len(commands) == 0 {
+		return
+	}
+
+	var totalMs int64
+	for _, command := range commands {
+		totalMs += command.DurationMs
+	}
+
+	details := map[string]interface{}{
+		"commands":        commands,
+		"command_count":   len(commands),
+		"command_time_ms": totalMs,
+	}
+	if dropped := trace.Dropped(); dropped > 0 {
+		details["commands_dropped"] = dropped
+	}
+
+	if err := api.Activities.MergeActivityDetails(context.Background(), activityID, details); err != nil {
+		utils.WarnLog("Failed to store command trace for activity %d: %v", activityID, err)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 // ActivityType represents different types of activities
@@ -17,6 +19,7 @@ const (
 	ActivityConfig  ActivityType = "config"
 	ActivityEnv     ActivityType = "env"
 	ActivityBuild   ActivityType = "build"
+	ActivityAlert   ActivityType = "alert"
 )
 
 // ActivityStatus represents the status of an activity
@@ -28,6 +31,12 @@ const (
 	StatusWarning ActivityStatus = "warning"
 	StatusInfo    ActivityStatus = "info"
 	StatusPending ActivityStatus = "pending"
+	StatusCancelled ActivityStatus = "cancelled"
+	StatusQueued    ActivityStatus = "queued"  // waiting for the deploys of the app before it
+	StatusRunning   ActivityStatus = "running" // started after waiting in the deploy queue
+	StatusSkipped   ActivityStatus = "skipped" // a push the auto-deploy rules of the app blocked
+	StatusPendingApproval ActivityStatus = "pending_approval" // a deploy of a production app waiting for an admin
+	StatusRejected        ActivityStatus = "rejected"         // a deploy an admin didn't approve
 )
 
 // TriggerType represents how the activity was triggered
@@ -37,6 +46,7 @@ const (
 	TriggerManual    TriggerType = "manual"
 	TriggerWebhook   TriggerType = "webhook"
 	TriggerAutomatic TriggerType = "automatic"
+	TriggerScheduled TriggerType = "scheduled"
 )
 
 // Activity represents an app activity
@@ -135,13 +145,26 @@ func (a *API) UpdateActivity(ctx context.Context, activityID int, status Activit
 	return nil
 }
 
+// SetActivityStatus changes the status of an activity still in progress, without completing it
+func (a *API) SetActivityStatus(ctx context.Context, activityID int, status ActivityStatus) error {
+	_, err := Exec(ctx,
+		`UPDATE app_activities SET activity_status = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND completed_at IS NULL`,
+		string(status), activityID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set activity status: %w", err)
+	}
+	return nil
+}
+
 // GetAppActivities fetches activities for a specific app
 func (a *API) GetAppActivities(ctx context.Context, appName string, limit int) ([]Activity, error) {
 	if limit <= 0 {
 		limit = 10
 	}
 
-	rows, err := Query(ctx,
+	rows, err := ReadQuery(ctx,
 		`SELECT id, app_name, activity_type, activity_status, message, details, user_id, trigger_type, 
 		 started_at, completed_at, duration, error_message, created_at, updated_at
 		 FROM app_activities 
@@ -155,6 +178,79 @@ func (a *API) GetAppActivities(ctx context.Context, appName string, limit int) (
 	}
 	defer rows.Close()
 
+	return scanActivities(rows), nil
+}
+
+// ActivityFilter narrows the activities listed for an app. Empty fields don't filter.
+type ActivityFilter struct {
+	Types    []string
+	Statuses []string
+	Triggers []string
+	Since    *time.Time
+	Until    *time.Time
+}
+
+// ListAppActivities fetches a page of the activities of an app matching a filter, newest first,
+// along with the number of activities matching it
+func (a *API) ListAppActivities(ctx context.Context, appName string, filter ActivityFilter, limit, offset int) ([]Activity, int, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, 0, fmt.Errorf("validation failed: %w", err)
+	}
+
+	where := `
+		WHERE app_name = $1
+		  AND ($2::text[] IS NULL OR activity_type = ANY($2))
+		  AND ($3::text[] IS NULL OR activity_status = ANY($3))
+		  AND ($4::text[] IS NULL OR trigger_type = ANY($4))
+		  AND ($5::timestamptz IS NULL OR started_at >= $5)
+		  AND ($6::timestamptz IS NULL OR started_at < $6)`
+	args := []interface{}{appName, filter.Types, filter.Statuses, filter.Triggers, filter.Since, filter.Until}
+
+	var total int
+	if err := ReadQueryRow(ctx, `SELECT COUNT(*) FROM app_activities`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count activities: %w", err)
+	}
+
+	rows, err := ReadQuery(ctx,
+		`SELECT id, app_name, activity_type, activity_status, message, details, user_id, trigger_type,
+		 started_at, completed_at, duration, error_message, created_at, updated_at
+		 FROM app_activities`+where+`
+		 ORDER BY started_at DESC, id DESC
+		 LIMIT $7 OFFSET $8`,
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch activities: %w", err)
+	}
+	defer rows.Close()
+
+	return scanActivities(rows), total, nil
+}
+
+// GetRecentActivities fetches the latest activities across all apps
+func (a *API) GetRecentActivities(ctx context.Context, limit int) ([]Activity, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+
+	rows, err := ReadQuery(ctx,
+		`SELECT id, app_name, activity_type, activity_status, message, details, user_id, trigger_type, 
+		 started_at, completed_at, duration, error_message, created_at, updated_at
+		 FROM app_activities 
+		 ORDER BY started_at DESC 
+		 LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch activities: %w", err)
+	}
+	defer rows.Close()
+
+	return scanActivities(rows), nil
+}
+
+// scanActivities reads activity rows, skipping rows that fail to scan
+func scanActivities(rows pgx.Rows) []Activity {
 	var activities []Activity
 	for rows.Next() {
 		var activity Activity
@@ -188,7 +284,66 @@ func (a *API) GetAppActivities(ctx context.Context, appName string, limit int) (
 		activities = append(activities, activity)
 	}
 
-	return activities, nil
+	return activities
+}
+
+// GetActivityByID fetches a single activity
+func (a *API) GetActivityByID(ctx context.Context, activityID int) (*Activity, error) {
+	var activity Activity
+	var detailsJSON []byte
+
+	err := QueryRow(ctx,
+		`SELECT id, app_name, activity_type, activity_status, message, details, user_id, trigger_type, 
+		 started_at, completed_at, duration, error_message, created_at, updated_at
+		 FROM app_activities 
+		 WHERE id = $1`,
+		activityID,
+	).Scan(
+		&activity.ID,
+		&activity.AppName,
+		&activity.Type,
+		&activity.Status,
+		&activity.Message,
+		&detailsJSON,
+		&activity.UserID,
+		&activity.TriggerType,
+		&activity.StartedAt,
+		&activity.CompletedAt,
+		&activity.Duration,
+		&activity.ErrorMessage,
+		&activity.CreatedAt,
+		&activity.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch activity: %w", err)
+	}
+
+	// Parse details JSON
+	if len(detailsJSON) > 0 {
+		json.Unmarshal(detailsJSON, &activity.Details)
+	}
+
+	return &activity, nil
+}
+
+// MergeActivityDetails merges additional keys into an activity's details JSON
+func (a *API) MergeActivityDetails(ctx context.Context, activityID int, details map[string]interface{}) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal details: %w", err)
+	}
+
+	_, err = Exec(ctx,
+		`UPDATE app_activities 
+		SET details = COALESCE(details, '{}'::jsonb) || $1::jsonb, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`,
+		detailsJSON, activityID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update activity details: %w", err)
+	}
+
+	return nil
 }
 
 // LogDeployActivity logs a deployment activity
@@ -270,6 +425,22 @@ func (a *API) LogWebhookDeployment(ctx context.Context, appName, gitURL, branch,
 	return a.LogActivity(ctx, appName, ActivityDeploy, StatusPending, message, details, nil, TriggerWebhook)
 }
 
+// LogSkippedWebhookDeployment records a push that didn't auto-deploy an app and why
+func (a *API) LogSkippedWebhookDeployment(ctx context.Context, appName, branch, commitHash, commitMessage, pusher, author, reason string) (*Activity, error) {
+	details := map[string]interface{}{
+		"branch":         branch,
+		"commit_hash":    commitHash,
+		"commit_message": commitMessage,
+		"pusher":         pusher,
+		"author":         author,
+		"reason":         reason,
+		"source":         "webhook",
+	}
+
+	message := fmt.Sprintf("Webhook deploy skipped: %s", reason)
+	return a.LogActivity(ctx, appName, ActivityDeploy, StatusSkipped, message, details, nil, TriggerWebhook)
+}
+
 // LogGitHubDeployment saves GitHub deployment to both tables
 func (a *API) LogGitHubDeployment(ctx context.Context, appName, commitHash, commitMessage, branch, authorName, authorEmail, triggerType string, repositoryID int) error {
 	// Log to github_deployment_logs
@@ -321,7 +492,7 @@ func (a *API) UpdateGitHubDeploymentStatus(ctx context.Context, appName, commitH
 	_, err = Exec(ctx,
 		`UPDATE app_activities 
 		SET activity_status = $1, completed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
-		WHERE app_name = $2 AND activity_type = 'deploy' AND activity_status = 'pending' 
+		WHERE app_name = $2 AND activity_type = 'deploy' AND activity_status IN ('pending', 'queued', 'running') 
 		AND details->>'commit_hash' = $3`,
 		string(activityStatus), appName, commitHash,
 	)
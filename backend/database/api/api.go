@@ -71,7 +71,8 @@ func QueryRow(ctx context.Context, query string, args ...interface{}) pgx.Row {
 		log.Printf("QueryRow argument validation warning: %v", err)
 	}
 	
-	return DB.QueryRow(ctx, query, args...)
+	start := time.Now()
+	return &timedRow{row: DB.QueryRow(ctx, query, args...), name: queryName(1), query: query, start: start}
 }
 
 // QueryRowSafe executes a query that returns a single row with full error handling
@@ -92,7 +93,8 @@ func QueryRowSafe(ctx context.Context, query string, args ...interface{}) (row p
 		return nil, fmt.Errorf("argument validation failed: %w", err)
 	}
 	
-	row = DB.QueryRow(ctx, query, args...)
+	start := time.Now()
+	row = &timedRow{row: DB.QueryRow(ctx, query, args...), name: queryName(1), query: query, start: start}
 	return row, nil
 }
 
@@ -117,8 +119,14 @@ func Query(ctx context.Context, query string, args ...interface{}) (rows pgx.Row
 		return nil, fmt.Errorf("argument validation failed: %w", err)
 	}
 	
+	start := time.Now()
 	rows, err = DB.Query(ctx, query, args...)
-	return rows, err
+	if err != nil {
+		recordQuery(queryName(1), query, time.Since(start), err)
+		notePrimaryError(err)
+		return rows, err
+	}
+	return &timedRows{Rows: rows, name: queryName(1), query: query, start: start}, nil
 }
 
 // Exec executes a query that doesn't return rows with panic recovery
@@ -139,7 +147,10 @@ func Exec(ctx context.Context, query string, args ...interface{}) (result pgconn
 		return pgconn.CommandTag{}, fmt.Errorf("argument validation failed: %w", err)
 	}
 	
+	start := time.Now()
 	result, err = DB.Exec(ctx, query, args...)
+	recordQuery(queryName(1), query, time.Since(start), err)
+	notePrimaryError(err)
 	return result, err
 }
 
@@ -161,6 +172,7 @@ func Transaction(ctx context.Context, fn func(pgx.Tx) error) (err error) {
 	
 	tx, err := DB.Begin(ctx)
 	if err != nil {
+		notePrimaryError(err)
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	
@@ -288,6 +300,13 @@ type DeploymentAPI struct{}
 type GitHubAPI struct{}
 type ActivityAPI struct{}
 type SettingsAPI struct{}
+type PortDetectionAPI struct{}
+type AuditAPI struct{}
+type SlackAPI struct{}
+type TrafficAPI struct{}
+type LogAlertAPI struct{}
+type OperationAPI struct{}
+type WebhookAPI struct{}
 
 // Main API struct that implements all operations
 type API struct{}
@@ -310,4 +329,25 @@ var GitHub = &GitHubAPI{}
 var Activities = &API{}
 
 // Settings provides settings-related database operations
-var Settings = &SettingsAPI{} 
\ No newline at end of file
+var Settings = &SettingsAPI{}
+
+// PortDetection provides port detection cache operations
+var PortDetection = &PortDetectionAPI{}
+
+// Audit provides system audit log operations
+var Audit = &AuditAPI{}
+
+// Slack provides Slack integration database operations
+var Slack = &SlackAPI{} 
+
+// Traffic provides per-app traffic rollup operations
+var Traffic = &TrafficAPI{}
+
+// LogAlerts provides log alert rule operations
+var LogAlerts = &LogAlertAPI{}
+
+// Operations provides the records of multi-step dokku and database operations
+var Operations = &OperationAPI{}
+
+// Webhooks provides outbound app webhook and delivery operations
+var Webhooks = &WebhookAPI{}
\ No newline at end of file
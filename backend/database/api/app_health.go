@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DeploymentResult is the outcome of the last deployment of an app
+type DeploymentResult struct {
+	ID           int        `json:"id"`
+	Status       string     `json:"status"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	ErrorMessage *string    `json:"error_message,omitempty"`
+}
+
+// ListLastDeploymentResults returns the last deployment of every app that has one, by app
+func (d *DeploymentAPI) ListLastDeploymentResults(ctx context.Context) (map[string]DeploymentResult, error) {
+	rows, err := ReadQuery(ctx, `
+		SELECT DISTINCT ON (app_name) app_name, id, status, started_at, finished_at, error_message
+		FROM deployment_history
+		ORDER BY app_name, started_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list last deployments: %w", err)
+	}
+	defer rows.Close()
+
+	results := make(map[string]DeploymentResult)
+	for rows.Next() {
+		var appName string
+		var result DeploymentResult
+		if err := rows.Scan(&appName, &result.ID, &result.Status, &result.StartedAt, &result.FinishedAt, &result.ErrorMessage); err != nil {
+			return nil, fmt.Errorf("failed to scan last deployment: %w", err)
+		}
+		results[appName] = result
+	}
+	return results, rows.Err()
+}
+
+// UptimeCount is how many uptime samples of an app were taken and how many found it up
+type UptimeCount struct {
+	Samples   int
+	UpSamples int
+}
+
+// ListUptimeSince counts the uptime samples of every sampled app since a time, by app
+func (a *AppAPI) ListUptimeSince(ctx context.Context, since time.Time) (map[string]UptimeCount, error) {
+	rows, err := ReadQuery(ctx, `
+		SELECT app_name, SUM(samples), SUM(up_samples)
+		FROM app_uptime_hourly
+		WHERE hour_start >= $1
+		GROUP BY app_name`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uptime: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]UptimeCount)
+	for rows.Next() {
+		var appName string
+		var count UptimeCount
+		if err := rows.Scan(&appName, &count.Samples, &count.UpSamples); err != nil {
+			return nil, fmt.Errorf("failed to scan uptime: %w", err)
+		}
+		counts[appName] = count
+	}
+	return counts, rows.Err()
+}
+
+// ListTriggeredLogAlerts returns the names of the enabled log alert rules triggered since a time,
+// by app
+func (l *LogAlertAPI) ListTriggeredLogAlerts(ctx context.Context, since time.Time) (map[string][]string, error) {
+	rows, err := ReadQuery(ctx, `
+		SELECT app_name, name
+		FROM log_alert_rules
+		WHERE enabled AND last_triggered_at >= $1
+		ORDER BY app_name, name`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list triggered log alerts: %w", err)
+	}
+	defer rows.Close()
+
+	triggered := make(map[string][]string)
+	for rows.Next() {
+		var appName, name string
+		if err := rows.Scan(&appName, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan triggered log alert: %w", err)
+		}
+		triggered[appName] = append(triggered[appName], name)
+	}
+	return triggered, rows.Err()
+}
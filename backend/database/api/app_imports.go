@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// ListManagedAppNames lists the apps Citizen keeps deployment information for
+func (d *DeploymentAPI) ListManagedAppNames(ctx context.Context) ([]string, error) {
+	rows, err := Query(ctx, `SELECT app_name FROM app_deployments WHERE deleted_at IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list managed apps: %w", err)
+	}
+	defer rows.Close()
+
+	apps := []string{}
+	for rows.Next() {
+		var appName string
+		if err := rows.Scan(&appName); err != nil {
+			return nil, err
+		}
+		apps = append(apps, appName)
+	}
+	return apps, rows.Err()
+}
+
+// RecordAppImport marks the deployment of an app as imported from dokku with its env var names
+func (d *DeploymentAPI) RecordAppImport(ctx context.Context, appName string, envKeys []string) error {
+	if err := ValidateArgs(appName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `
+		UPDATE app_deployments
+		SET imported_at = CURRENT_TIMESTAMP, imported_env_keys = $2
+		WHERE app_name = $1`, appName, envKeys)
+	if err != nil {
+		return fmt.Errorf("failed to record app import: %w", err)
+	}
+	return nil
+}
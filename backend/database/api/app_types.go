@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetAppType returns the type of an app, "web" when none is stored
+func (a *AppAPI) GetAppType(ctx context.Context, appName string) (string, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return "", fmt.Errorf("validation failed: %w", err)
+	}
+
+	var appType string
+	err := QueryRow(ctx, `SELECT app_type FROM app_types WHERE app_name = $1`, appName).Scan(&appType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "web", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get app type: %w", err)
+	}
+	return appType, nil
+}
+
+// SetAppType stores the type of an app
+func (a *AppAPI) SetAppType(ctx context.Context, appName, appType string, userID *int) error {
+	if err := ValidateArgs(appName, appType); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `
+		INSERT INTO app_types (app_name, app_type, updated_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (app_name) DO UPDATE
+		SET app_type = EXCLUDED.app_type, updated_by = EXCLUDED.updated_by`,
+		appName, appType, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set app type: %w", err)
+	}
+	return nil
+}
+
+// ListAppTypes returns the type of every app that isn't a web app, by app
+func (a *AppAPI) ListAppTypes(ctx context.Context) (map[string]string, error) {
+	rows, err := ReadQuery(ctx, `SELECT app_name, app_type FROM app_types WHERE app_type <> 'web'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list app types: %w", err)
+	}
+	defer rows.Close()
+
+	types := make(map[string]string)
+	for rows.Next() {
+		var appName, appType string
+		if err := rows.Scan(&appName, &appType); err != nil {
+			return nil, fmt.Errorf("failed to scan app type: %w", err)
+		}
+		types[appName] = appType
+	}
+	return types, rows.Err()
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditAPI provides system audit log operations
+
+// SystemAuditEntry is an audited admin operation on the dokku host
+type SystemAuditEntry struct {
+	ID           int                    `json:"id"`
+	UserID       *int                   `json:"user_id,omitempty"`
+	Action       string                 `json:"action"`
+	Target       string                 `json:"target,omitempty"`
+	Status       string                 `json:"status"`
+	Details      map[string]interface{} `json:"details,omitempty"`
+	ErrorMessage *string                `json:"error_message,omitempty"`
+	IPAddress    string                 `json:"ip_address,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+// LogSystemAudit records an admin operation
+func (a *AuditAPI) LogSystemAudit(ctx context.Context, entry *SystemAuditEntry) error {
+	if err := ValidateArgs(entry.Action, entry.Target, entry.Status, entry.IPAddress); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	var detailsJSON []byte
+	if entry.Details != nil {
+		var err error
+		detailsJSON, err = json.Marshal(entry.Details)
+		if err != nil {
+			return fmt.Errorf("failed to marshal details: %w", err)
+		}
+	}
+
+	// Error messages are raw command output, pass them as bytes so they skip argument validation
+	var errorBytes []byte
+	if entry.ErrorMessage != nil {
+		errorBytes = []byte(*entry.ErrorMessage)
+	}
+
+	query := `
+		INSERT INTO system_audit_log (user_id, action, target, status, details, error_message, ip_address, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`
+
+	entry.CreatedAt = time.Now()
+	err := QueryRow(ctx, query,
+		entry.UserID, entry.Action, entry.Target, entry.Status, detailsJSON, errorBytes, entry.IPAddress, entry.CreatedAt,
+	).Scan(&entry.ID)
+	if err != nil {
+		return fmt.Errorf("failed to log system audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// ListSystemAudit lists audited admin operations, newest first
+func (a *AuditAPI) ListSystemAudit(ctx context.Context, limit, offset int) ([]SystemAuditEntry, error) {
+	if err := ValidateArgs(limit, offset); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		SELECT id, user_id, action, COALESCE(target, ''), status, details, error_message,
+		       COALESCE(ip_address, ''), created_at
+		FROM system_audit_log
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1 OFFSET $2`
+
+	rows, err := ReadQuery(ctx, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list system audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []SystemAuditEntry{}
+	for rows.Next() {
+		var entry SystemAuditEntry
+		var detailsJSON []byte
+		if err := rows.Scan(
+			&entry.ID, &entry.UserID, &entry.Action, &entry.Target, &entry.Status, &detailsJSON,
+			&entry.ErrorMessage, &entry.IPAddress, &entry.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan system audit entry: %w", err)
+		}
+		if len(detailsJSON) > 0 {
+			json.Unmarshal(detailsJSON, &entry.Details)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IsBadgeEnabled reports whether an app opted in to public status badges
+func (a *AppAPI) IsBadgeEnabled(ctx context.Context, appName string) (bool, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return false, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var enabled bool
+	err := QueryRow(ctx, `SELECT enabled FROM app_badge_settings WHERE app_name = $1`, appName).Scan(&enabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get badge setting: %w", err)
+	}
+	return enabled, nil
+}
+
+// SetBadgeEnabled opts an app in or out of public status badges
+func (a *AppAPI) SetBadgeEnabled(ctx context.Context, appName string, enabled bool, userID *int) error {
+	if err := ValidateArgs(appName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `
+		INSERT INTO app_badge_settings (app_name, enabled, updated_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (app_name) DO UPDATE SET enabled = EXCLUDED.enabled, updated_by = EXCLUDED.updated_by`,
+		appName, enabled, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set badge setting: %w", err)
+	}
+	return nil
+}
+
+// ListBadgeApps lists the apps with public status badges enabled
+func (a *AppAPI) ListBadgeApps(ctx context.Context) ([]string, error) {
+	rows, err := Query(ctx, `SELECT app_name FROM app_badge_settings WHERE enabled ORDER BY app_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list badge apps: %w", err)
+	}
+	defer rows.Close()
+
+	apps := []string{}
+	for rows.Next() {
+		var appName string
+		if err := rows.Scan(&appName); err != nil {
+			return nil, fmt.Errorf("failed to scan badge app: %w", err)
+		}
+		apps = append(apps, appName)
+	}
+	return apps, rows.Err()
+}
+
+// RecordUptimeSamples adds an uptime sample per app to the rollup of the hour starting at hourStart
+func (a *AppAPI) RecordUptimeSamples(ctx context.Context, hourStart time.Time, up map[string]bool) error {
+	return Transaction(ctx, func(tx pgx.Tx) error {
+		for appName, isUp := range up {
+			upSamples := 0
+			if isUp {
+				upSamples = 1
+			}
+			_, err := tx.Exec(ctx, `
+				INSERT INTO app_uptime_hourly (app_name, hour_start, samples, up_samples)
+				VALUES ($1, $2, 1, $3)
+				ON CONFLICT (app_name, hour_start) DO UPDATE
+				SET samples = app_uptime_hourly.samples + 1,
+				    up_samples = app_uptime_hourly.up_samples + EXCLUDED.up_samples`,
+				appName, hourStart, upSamples)
+			if err != nil {
+				return fmt.Errorf("failed to record uptime of %s: %w", appName, err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetUptime counts the uptime samples of an app since a time and how many found it up
+func (a *AppAPI) GetUptime(ctx context.Context, appName string, since time.Time) (samples, upSamples int, err error) {
+	if err := ValidateArgs(appName); err != nil {
+		return 0, 0, fmt.Errorf("validation failed: %w", err)
+	}
+
+	err = ReadQueryRow(ctx, `
+		SELECT COALESCE(SUM(samples), 0), COALESCE(SUM(up_samples), 0)
+		FROM app_uptime_hourly
+		WHERE app_name = $1 AND hour_start >= $2`, appName, since).Scan(&samples, &upSamples)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get uptime: %w", err)
+	}
+	return samples, upSamples, nil
+}
+
+// PruneUptimeSamples deletes the uptime rollups of hours before a time
+func (a *AppAPI) PruneUptimeSamples(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := Exec(ctx, `DELETE FROM app_uptime_hourly WHERE hour_start < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune uptime samples: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrRepositoryNotConnected is returned when no repository is connected to an app
+var ErrRepositoryNotConnected = errors.New("no repository connected")
+
+// BranchRule maps the pushed branches matching a pattern to the app they deploy
+type BranchRule struct {
+	ID          int       `json:"id"`
+	AppName     string    `json:"app_name"`
+	Position    int       `json:"position"`
+	Pattern     string    `json:"pattern"`
+	PatternType string    `json:"pattern_type"`
+	TargetApp   string    `json:"target_app"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// BranchRules decide what the pushes to the repository of a connected app deploy: its deploy
+// policy, deploy branch and branch rules in evaluation order
+type BranchRules struct {
+	AppName      string `json:"app_name"`
+	DeployBranch string `json:"deploy_branch"`
+	// DeployTrigger is branch, pushes to branches deploy, or tag, pushed tags matching TagPattern deploy
+	DeployTrigger string       `json:"deploy_trigger"`
+	TagPattern    string       `json:"tag_pattern,omitempty"`
+	Strict        bool         `json:"strict"`
+	Rules         []BranchRule `json:"rules"`
+}
+
+// GetBranchRules returns the deploy policy, deploy branch and branch rules of a connected app, or
+// ErrRepositoryNotConnected when no repository is connected to it
+func (g *GitHubAPI) GetBranchRules(ctx context.Context, appName string) (*BranchRules, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	set := &BranchRules{AppName: appName, Rules: []BranchRule{}}
+	err := QueryRow(ctx, `
+		SELECT deploy_branch, deploy_trigger, COALESCE(tag_pattern, ''), branch_rules_strict FROM github_repositories
+		WHERE app_name = $1 AND deleted_at IS NULL
+		ORDER BY created_at DESC LIMIT 1`, appName).Scan(&set.DeployBranch, &set.DeployTrigger, &set.TagPattern, &set.Strict)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRepositoryNotConnected
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get branch rules mode: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT id, app_name, position, pattern, pattern_type, target_app, created_at
+		FROM github_branch_rules
+		WHERE app_name = $1
+		ORDER BY position`, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branch rules: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule BranchRule
+		if err := rows.Scan(&rule.ID, &rule.AppName, &rule.Position, &rule.Pattern, &rule.PatternType,
+			&rule.TargetApp, &rule.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan branch rule: %w", err)
+		}
+		set.Rules = append(set.Rules, rule)
+	}
+
+	return set, rows.Err()
+}
+
+// ReplaceBranchRules replaces the branch rules of a connected app, keeping their order, and sets
+// whether they are strict
+func (g *GitHubAPI) ReplaceBranchRules(ctx context.Context, appName string, strict bool, rules []BranchRule) error {
+	if err := ValidateArgs(appName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	for _, rule := range rules {
+		if err := ValidateArgs(rule.PatternType, rule.TargetApp); err != nil {
+			return fmt.Errorf("validation failed: %w", err)
+		}
+	}
+
+	return Transaction(ctx, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `
+			UPDATE github_repositories SET branch_rules_strict = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE app_name = $1 AND deleted_at IS NULL`, appName, strict)
+		if err != nil {
+			return fmt.Errorf("failed to set branch rules mode: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return ErrRepositoryNotConnected
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM github_branch_rules WHERE app_name = $1`, appName); err != nil {
+			return fmt.Errorf("failed to delete branch rules: %w", err)
+		}
+		// Patterns are free text, regexes may hold characters argument validation rejects
+		for i, rule := range rules {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO github_branch_rules (app_name, position, pattern, pattern_type, target_app)
+				VALUES ($1, $2, $3, $4, $5)`,
+				appName, i+1, []byte(rule.Pattern), rule.PatternType, rule.TargetApp)
+			if err != nil {
+				return fmt.Errorf("failed to create branch rule: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// SetDeployPolicy sets whether pushes to branches or pushed tags matching tagPattern auto deploy
+// a connected app
+func (g *GitHubAPI) SetDeployPolicy(ctx context.Context, appName, trigger, tagPattern string) error {
+	if err := ValidateArgs(appName, trigger); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// Patterns are free text, pass them as bytes so they skip argument validation
+	var pattern []byte
+	if tagPattern != "" {
+		pattern = []byte(tagPattern)
+	}
+	result, err := Exec(ctx, `
+		UPDATE github_repositories SET deploy_trigger = $2, tag_pattern = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE app_name = $1 AND deleted_at IS NULL`, appName, trigger, pattern)
+	if err != nil {
+		return fmt.Errorf("failed to set deploy policy: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrRepositoryNotConnected
+	}
+	return nil
+}
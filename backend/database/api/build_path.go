@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetBuildPath returns the subdirectory of its repository a connected app builds from, "" for the
+// repository root, or ErrRepositoryNotConnected when no repository is connected to it
+func (g *GitHubAPI) GetBuildPath(ctx context.Context, appName string) (string, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return "", fmt.Errorf("validation failed: %w", err)
+	}
+
+	var buildPath string
+	err := QueryRow(ctx, `
+		SELECT COALESCE(build_path, '') FROM github_repositories
+		WHERE app_name = $1 AND deleted_at IS NULL
+		ORDER BY created_at DESC LIMIT 1`, appName).Scan(&buildPath)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrRepositoryNotConnected
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get build path: %w", err)
+	}
+	return buildPath, nil
+}
+
+// SetBuildPath sets the subdirectory of its repository a connected app builds from, the
+// repository root when empty
+func (g *GitHubAPI) SetBuildPath(ctx context.Context, appName, buildPath string) error {
+	if err := ValidateArgs(appName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// Paths are checked by the caller, names like apps/import-worker would fail argument validation
+	result, err := Exec(ctx, `
+		UPDATE github_repositories SET build_path = NULLIF($2, ''), updated_at = CURRENT_TIMESTAMP
+		WHERE app_name = $1 AND deleted_at IS NULL`, appName, []byte(buildPath))
+	if err != nil {
+		return fmt.Errorf("failed to set build path: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrRepositoryNotConnected
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Scopes build usage is accounted and capped by
+const (
+	BuildScopeUser = "user" // subject is the user ID
+	BuildScopeTeam = "team" // subject is the team name of users
+	BuildScopeApp  = "app"  // subject is the app name
+)
+
+var (
+	// ErrBuildQuotaNotFound is returned when no quota is set for a scope and subject
+	ErrBuildQuotaNotFound = errors.New("build quota not found")
+	// ErrUserNotFound is returned when a user to update doesn't exist
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// buildUsageSubjects are the columns deployments are grouped by for each scope
+var buildUsageSubjects = map[string]string{
+	BuildScopeUser: "d.user_id::text",
+	BuildScopeTeam: "u.team",
+	BuildScopeApp:  "d.app_name",
+}
+
+// ValidBuildScope reports whether usage can be accounted by scope
+func ValidBuildScope(scope string) bool {
+	_, ok := buildUsageSubjects[scope]
+	return ok
+}
+
+// BuildQuota caps the build minutes of a month and the deployments running at once of a user,
+// team or app. A nil limit is not enforced.
+type BuildQuota struct {
+	Scope          string    `json:"scope"`
+	Subject        string    `json:"subject"`
+	MonthlyMinutes *int      `json:"monthly_minutes"`
+	MaxConcurrent  *int      `json:"max_concurrent"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// BuildUsage is the build time spent by a user, team or app over a period
+type BuildUsage struct {
+	Scope        string  `json:"scope"`
+	Subject      string  `json:"subject"`
+	Label        string  `json:"label,omitempty"`
+	Deployments  int     `json:"deployments"`
+	Failed       int     `json:"failed"`
+	BuildMinutes float64 `json:"build_minutes"`
+	// PeakConcurrency is the most deployments that ran at once during the period
+	PeakConcurrency int `json:"peak_concurrency"`
+	// Running are the deployments still in progress
+	Running int `json:"running"`
+}
+
+// ListBuildUsage sums the build time of the deployments started in [since, until) by scope,
+// heaviest first. Deployments still running count up to now, and deployments left pending by a
+// restart count up to maxBuild, the longest a build can run. subject limits the report to one
+// user, team or app when not empty.
+func (d *DeploymentAPI) ListBuildUsage(ctx context.Context, scope, subject string, since, until time.Time, maxBuild time.Duration) ([]BuildUsage, error) {
+	subjectColumn, ok := buildUsageSubjects[scope]
+	if !ok {
+		return nil, fmt.Errorf("unknown build scope %q", scope)
+	}
+	if err := ValidateArgs(subject); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := ReadQuery(ctx, `
+		WITH deployments AS (
+			SELECT `+subjectColumn+` AS subject, u.username, d.status, d.started_at,
+			       LEAST(COALESCE(d.finished_at, CURRENT_TIMESTAMP), d.started_at + $3 * INTERVAL '1 second') AS ended_at
+			FROM deployment_history d
+			LEFT JOIN users u ON u.id = d.user_id
+			WHERE d.started_at >= $1 AND d.started_at < $2
+		), scoped AS (
+			SELECT * FROM deployments WHERE subject IS NOT NULL AND ($4 = '' OR subject = $4)
+		), concurrency AS (
+			SELECT subject, MAX(running) AS peak
+			FROM (
+				SELECT subject, SUM(delta) OVER (PARTITION BY subject ORDER BY at, delta ROWS UNBOUNDED PRECEDING) AS running
+				FROM (
+					SELECT subject, started_at AS at, 1 AS delta FROM scoped
+					UNION ALL
+					SELECT subject, ended_at AS at, -1 AS delta FROM scoped
+				) events
+			) timeline
+			GROUP BY subject
+		)
+		SELECT s.subject, COALESCE(MAX(s.username), ''), COUNT(*),
+		       COUNT(*) FILTER (WHERE s.status IN ('error', 'cancelled')),
+		       COALESCE(SUM(EXTRACT(EPOCH FROM (s.ended_at - s.started_at))), 0) / 60,
+		       c.peak,
+		       COUNT(*) FILTER (WHERE s.status = 'pending' AND s.ended_at >= CURRENT_TIMESTAMP)
+		FROM scoped s
+		JOIN concurrency c ON c.subject = s.subject
+		GROUP BY s.subject, c.peak
+		ORDER BY 5 DESC, s.subject`,
+		since, until, int(maxBuild.Seconds()), subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list build usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []BuildUsage{}
+	for rows.Next() {
+		entry := BuildUsage{Scope: scope}
+		var username string
+		if err := rows.Scan(&entry.Subject, &username, &entry.Deployments, &entry.Failed, &entry.BuildMinutes,
+			&entry.PeakConcurrency, &entry.Running); err != nil {
+			return nil, fmt.Errorf("failed to scan build usage: %w", err)
+		}
+		if scope == BuildScopeUser {
+			entry.Label = username
+		}
+		usage = append(usage, entry)
+	}
+	return usage, rows.Err()
+}
+
+// CountRunningBuilds counts the deployments of a user, team or app in progress, whenever they
+// started. Deployments pending for longer than maxBuild were left behind by a restart.
+func (d *DeploymentAPI) CountRunningBuilds(ctx context.Context, scope, subject string, maxBuild time.Duration) (int, error) {
+	subjectColumn, ok := buildUsageSubjects[scope]
+	if !ok {
+		return 0, fmt.Errorf("unknown build scope %q", scope)
+	}
+	if err := ValidateArgs(subject); err != nil {
+		return 0, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var count int
+	err := QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM deployment_history d
+		LEFT JOIN users u ON u.id = d.user_id
+		WHERE d.status = 'pending' AND d.started_at > CURRENT_TIMESTAMP - $2 * INTERVAL '1 second'
+		  AND `+subjectColumn+` = $1`,
+		subject, int(maxBuild.Seconds())).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count running builds: %w", err)
+	}
+	return count, nil
+}
+
+// ListBuildQuotas lists the quotas of a scope, or of all scopes when scope is empty
+func (d *DeploymentAPI) ListBuildQuotas(ctx context.Context, scope string) ([]BuildQuota, error) {
+	if err := ValidateArgs(scope); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT scope, subject, monthly_minutes, max_concurrent, updated_at
+		FROM build_quotas
+		WHERE $1 = '' OR scope = $1
+		ORDER BY scope, subject`, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list build quotas: %w", err)
+	}
+	defer rows.Close()
+
+	quotas := []BuildQuota{}
+	for rows.Next() {
+		var quota BuildQuota
+		if err := rows.Scan(&quota.Scope, &quota.Subject, &quota.MonthlyMinutes, &quota.MaxConcurrent, &quota.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan build quota: %w", err)
+		}
+		quotas = append(quotas, quota)
+	}
+	return quotas, rows.Err()
+}
+
+// GetBuildQuota returns the quota of a user, team or app
+func (d *DeploymentAPI) GetBuildQuota(ctx context.Context, scope, subject string) (*BuildQuota, error) {
+	if err := ValidateArgs(scope, subject); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	quota := &BuildQuota{}
+	err := QueryRow(ctx, `
+		SELECT scope, subject, monthly_minutes, max_concurrent, updated_at
+		FROM build_quotas
+		WHERE scope = $1 AND subject = $2`, scope, subject).
+		Scan(&quota.Scope, &quota.Subject, &quota.MonthlyMinutes, &quota.MaxConcurrent, &quota.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrBuildQuotaNotFound
+		}
+		return nil, fmt.Errorf("failed to get build quota: %w", err)
+	}
+	return quota, nil
+}
+
+// SetBuildQuota creates or replaces the quota of a user, team or app
+func (d *DeploymentAPI) SetBuildQuota(ctx context.Context, quota *BuildQuota, userID *int) error {
+	if err := ValidateArgs(quota.Scope, quota.Subject); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	err := QueryRow(ctx, `
+		INSERT INTO build_quotas (scope, subject, monthly_minutes, max_concurrent, updated_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (scope, subject) DO UPDATE
+		SET monthly_minutes = EXCLUDED.monthly_minutes, max_concurrent = EXCLUDED.max_concurrent,
+		    updated_by = EXCLUDED.updated_by
+		RETURNING updated_at`,
+		quota.Scope, quota.Subject, quota.MonthlyMinutes, quota.MaxConcurrent, userID).Scan(&quota.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set build quota: %w", err)
+	}
+	return nil
+}
+
+// DeleteBuildQuota removes the quota of a user, team or app
+func (d *DeploymentAPI) DeleteBuildQuota(ctx context.Context, scope, subject string) error {
+	if err := ValidateArgs(scope, subject); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	tag, err := Exec(ctx, `DELETE FROM build_quotas WHERE scope = $1 AND subject = $2`, scope, subject)
+	if err != nil {
+		return fmt.Errorf("failed to delete build quota: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBuildQuotaNotFound
+	}
+	return nil
+}
+
+// GetUserTeam returns the team of a user, "" when they have none
+func (u *UserAPI) GetUserTeam(ctx context.Context, userID int) (string, error) {
+	var team string
+	err := QueryRow(ctx, `SELECT COALESCE(team, '') FROM users WHERE id = $1`, userID).Scan(&team)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get user team: %w", err)
+	}
+	return team, nil
+}
+
+// SetUserTeam moves a user to a team, or out of any team when team is empty
+func (u *UserAPI) SetUserTeam(ctx context.Context, userID int, team string) error {
+	if err := ValidateArgs(team); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	tag, err := Exec(ctx, `UPDATE users SET team = NULLIF($2, '') WHERE id = $1`, userID, team)
+	if err != nil {
+		return fmt.Errorf("failed to set user team: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrBuildVarNotFound is returned for unknown build variables
+var ErrBuildVarNotFound = errors.New("build variable not found")
+
+// BuildVar is a variable an app only gets while it is built. The value is stored encrypted and
+// never returned by the API.
+type BuildVar struct {
+	Key            string    `json:"key"`
+	ValueEncrypted string    `json:"-"`
+	UpdatedBy      *int      `json:"updated_by,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ListBuildVars lists the build variables of an app by key
+func (a *AppAPI) ListBuildVars(ctx context.Context, appName string) ([]BuildVar, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT key, value_encrypted, updated_by, updated_at
+		FROM app_build_vars
+		WHERE app_name = $1
+		ORDER BY key`, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list build variables: %w", err)
+	}
+	defer rows.Close()
+
+	vars := []BuildVar{}
+	for rows.Next() {
+		var v BuildVar
+		if err := rows.Scan(&v.Key, &v.ValueEncrypted, &v.UpdatedBy, &v.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan build variable: %w", err)
+		}
+		vars = append(vars, v)
+	}
+	return vars, rows.Err()
+}
+
+// SetBuildVar creates or replaces a build variable of an app
+func (a *AppAPI) SetBuildVar(ctx context.Context, appName, key, valueEncrypted string, userID *int) error {
+	if err := ValidateArgs(appName, key); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `
+		INSERT INTO app_build_vars (app_name, key, value_encrypted, updated_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (app_name, key) DO UPDATE
+		SET value_encrypted = EXCLUDED.value_encrypted, updated_by = EXCLUDED.updated_by`,
+		appName, key, []byte(valueEncrypted), userID)
+	if err != nil {
+		return fmt.Errorf("failed to set build variable: %w", err)
+	}
+	return nil
+}
+
+// DeleteBuildVar removes a build variable of an app
+func (a *AppAPI) DeleteBuildVar(ctx context.Context, appName, key string) error {
+	if err := ValidateArgs(appName, key); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	tag, err := Exec(ctx, `DELETE FROM app_build_vars WHERE app_name = $1 AND key = $2`, appName, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete build variable: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBuildVarNotFound
+	}
+	return nil
+}
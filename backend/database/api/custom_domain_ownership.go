@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrCustomDomainTaken is returned when a custom domain is already active on another app
+var ErrCustomDomainTaken = errors.New("custom domain is already used by another app")
+
+// ErrCustomDomainNotFound is returned when no app has a custom domain active
+var ErrCustomDomainNotFound = errors.New("custom domain not found")
+
+// activeDomainIndex is the unique index allowing an active custom domain on one app only
+const activeDomainIndex = "idx_app_custom_domains_active_domain"
+
+// isActiveDomainConflict reports whether err violates the one active app per domain index
+func isActiveDomainConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == activeDomainIndex
+}
+
+// GetCustomDomainOwner returns the app a custom domain is active on, case insensitive, or an
+// empty name when no app uses it
+func (s *SettingsAPI) GetCustomDomainOwner(ctx context.Context, domain string) (string, error) {
+	if err := ValidateArgs(domain); err != nil {
+		return "", fmt.Errorf("validation failed: %w", err)
+	}
+
+	var appName string
+	err := QueryRow(ctx, `
+		SELECT app_name FROM app_custom_domains
+		WHERE LOWER(domain) = LOWER($1) AND is_active = true`, domain,
+	).Scan(&appName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get custom domain owner: %w", err)
+	}
+	return appName, nil
+}
+
+// MoveCustomDomain deactivates a custom domain on the app that has it and activates it on
+// another app in one transaction, returning the previous app
+func (s *SettingsAPI) MoveCustomDomain(ctx context.Context, domain, toApp string) (string, error) {
+	if err := ValidateArgs(domain, toApp); err != nil {
+		return "", fmt.Errorf("validation failed: %w", err)
+	}
+
+	var fromApp, storedDomain string
+	err := Transaction(ctx, func(tx pgx.Tx) error {
+		now := GetCurrentTimestamp()
+		err := tx.QueryRow(ctx, `
+			UPDATE app_custom_domains SET is_active = false, updated_at = $2
+			WHERE LOWER(domain) = LOWER($1) AND is_active = true
+			RETURNING app_name, domain`, domain, now,
+		).Scan(&fromApp, &storedDomain)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrCustomDomainNotFound
+			}
+			return fmt.Errorf("failed to release custom domain: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO app_custom_domains (app_name, domain, is_active, created_at, updated_at)
+			VALUES ($1, $2, true, $3, $3)
+			ON CONFLICT (app_name, domain) DO UPDATE
+			SET is_active = true, updated_at = EXCLUDED.updated_at`, toApp, storedDomain, now)
+		if err != nil {
+			return fmt.Errorf("failed to assign custom domain: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fromApp, nil
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrDeploymentNotAwaitingApproval is returned when reviewing a deployment that isn't waiting for approval
+var ErrDeploymentNotAwaitingApproval = errors.New("deployment is not waiting for approval")
+
+// IsProductionApp reports whether an app is flagged as production, its webhook deployments
+// waiting for the approval of an admin
+func (a *AppAPI) IsProductionApp(ctx context.Context, appName string) (bool, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return false, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var production bool
+	err := QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM app_production_flags WHERE app_name = $1)`, appName).Scan(&production)
+	if err != nil {
+		return false, fmt.Errorf("failed to get production flag: %w", err)
+	}
+	return production, nil
+}
+
+// SetProductionApp flags an app as production or clears the flag
+func (a *AppAPI) SetProductionApp(ctx context.Context, appName string, production bool, userID *int) error {
+	if err := ValidateArgs(appName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `DELETE FROM app_production_flags WHERE app_name = $1`
+	args := []interface{}{appName}
+	if production {
+		query = `INSERT INTO app_production_flags (app_name, flagged_by) VALUES ($1, $2) ON CONFLICT (app_name) DO NOTHING`
+		args = append(args, userID)
+	}
+	if _, err := Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to set production flag: %w", err)
+	}
+	return nil
+}
+
+// FindDeploymentRecord retrieves a deployment by ID whatever its app, including its logs
+func (d *DeploymentAPI) FindDeploymentRecord(ctx context.Context, id int) (*DeploymentRecord, error) {
+	var appName string
+	err := ReadQueryRow(ctx, `SELECT app_name FROM deployment_history WHERE id = $1`, id).Scan(&appName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeploymentRecordNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find deployment record: %w", err)
+	}
+	return d.GetDeploymentRecord(ctx, appName, id)
+}
+
+// ReviewDeployment records the approval or rejection of a deployment waiting for approval. An
+// approved deployment goes back to pending and starts now, a rejected one is finished.
+func (d *DeploymentAPI) ReviewDeployment(ctx context.Context, id int, approved bool, reviewerID int) error {
+	status := string(StatusRejected)
+	if approved {
+		status = string(StatusPending)
+	}
+
+	result, err := Exec(ctx, `
+		UPDATE deployment_history
+		SET status = $2, reviewed_by = $3, reviewed_at = CURRENT_TIMESTAMP,
+		    started_at = CASE WHEN $4 THEN CURRENT_TIMESTAMP ELSE started_at END,
+		    finished_at = CASE WHEN $4 THEN NULL ELSE CURRENT_TIMESTAMP END
+		WHERE id = $1 AND status = $5`,
+		id, status, reviewerID, approved, string(StatusPendingApproval))
+	if err != nil {
+		return fmt.Errorf("failed to review deployment: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrDeploymentNotAwaitingApproval
+	}
+	return nil
+}
+
+// ListPendingApprovals lists the deployments of every app waiting for approval, oldest first
+func (d *DeploymentAPI) ListPendingApprovals(ctx context.Context) ([]DeploymentRecord, error) {
+	rows, err := ReadQuery(ctx, `
+		SELECT app_name, id FROM deployment_history
+		WHERE status = $1
+		ORDER BY started_at, id`, string(StatusPendingApproval))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending approvals: %w", err)
+	}
+	type pending struct {
+		appName string
+		id      int
+	}
+	var ids []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.appName, &p.id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan pending approval: %w", err)
+		}
+		ids = append(ids, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list pending approvals: %w", err)
+	}
+
+	records := []DeploymentRecord{}
+	for _, p := range ids {
+		record, err := d.GetDeploymentRecord(ctx, p.appName, p.id)
+		if errors.Is(err, ErrDeploymentRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	return records, nil
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DeployHook is a command run in a one-off container of an app before or after its deployments
+type DeployHook struct {
+	ID             int       `json:"id"`
+	AppName        string    `json:"app_name"`
+	Stage          string    `json:"stage"`
+	Position       int       `json:"position"`
+	Command        string    `json:"command"`
+	TimeoutSeconds int       `json:"timeout_seconds"`
+	CreatedBy      *int      `json:"created_by,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ListDeployHooks lists the deploy hooks of an app by stage, in the order they run
+func (a *AppAPI) ListDeployHooks(ctx context.Context, appName string) ([]DeployHook, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT id, app_name, stage, position, command, timeout_seconds, created_by, created_at
+		FROM app_deploy_hooks
+		WHERE app_name = $1
+		ORDER BY stage, position`, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deploy hooks: %w", err)
+	}
+	defer rows.Close()
+
+	hooks := []DeployHook{}
+	for rows.Next() {
+		var hook DeployHook
+		if err := rows.Scan(&hook.ID, &hook.AppName, &hook.Stage, &hook.Position, &hook.Command,
+			&hook.TimeoutSeconds, &hook.CreatedBy, &hook.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan deploy hook: %w", err)
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// ReplaceDeployHooks replaces the deploy hooks of an app, each stage keeping the order of hooks
+func (a *AppAPI) ReplaceDeployHooks(ctx context.Context, appName string, hooks []DeployHook, userID *int) error {
+	if err := ValidateArgs(appName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	for _, hook := range hooks {
+		if err := ValidateArgs(hook.Stage); err != nil {
+			return fmt.Errorf("validation failed: %w", err)
+		}
+	}
+
+	return Transaction(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM app_deploy_hooks WHERE app_name = $1`, appName); err != nil {
+			return fmt.Errorf("failed to delete deploy hooks: %w", err)
+		}
+		// Commands are free text, pass them as bytes so they skip argument validation
+		positions := make(map[string]int)
+		for _, hook := range hooks {
+			positions[hook.Stage]++
+			_, err := tx.Exec(ctx, `
+				INSERT INTO app_deploy_hooks (app_name, stage, position, command, timeout_seconds, created_by)
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+				appName, hook.Stage, positions[hook.Stage], []byte(hook.Command), hook.TimeoutSeconds, userID)
+			if err != nil {
+				return fmt.Errorf("failed to create deploy hook: %w", err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,493 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrDeploymentRecordNotFound is returned when a deployment record does not exist for an app
+var ErrDeploymentRecordNotFound = errors.New("deployment not found")
+
+// DeploymentRecord is a single deploy attempt of an app with its build logs
+type DeploymentRecord struct {
+	ID         int    `json:"id"`
+	AppName    string `json:"app_name"`
+	ActivityID *int   `json:"activity_id,omitempty"`
+	GitURL     string `json:"git_url"`
+	GitBranch  string `json:"git_branch"`
+	GitCommit  string `json:"git_commit,omitempty"`
+	// GitTag is the pushed tag a tag deployment was triggered by
+	GitTag  string `json:"git_tag,omitempty"`
+	ImageID string `json:"image_id,omitempty"`
+	// ImageSize is the size in bytes of the image, 0 when it wasn't recorded
+	ImageSize int64 `json:"image_size,omitempty"`
+	// BuilderImage is the CNB builder image of pack deployments
+	BuilderImage string `json:"builder_image,omitempty"`
+	// DockerfilePath is the Dockerfile of Dockerfile deployments not built from the root one
+	DockerfilePath string `json:"dockerfile_path,omitempty"`
+	// SourceApp and SourceDeploymentID link a deployment promoted from another app's image
+	SourceApp          string `json:"source_app,omitempty"`
+	SourceDeploymentID *int   `json:"source_deployment_id,omitempty"`
+	// SourceImage is the registry image a deployment was made from instead of a git source
+	SourceImage string `json:"source_image,omitempty"`
+	// SourceArchive is the sha256 digest of the uploaded archive a deployment was made from
+	SourceArchive string `json:"source_archive,omitempty"`
+	// RetryOfID links a deployment re-running a failed one
+	RetryOfID *int `json:"retry_of_id,omitempty"`
+	// ReleaseNumber counts the deployments of the app, ReleaseName optionally names the release
+	ReleaseNumber int        `json:"release_number"`
+	ReleaseName   string     `json:"release_name,omitempty"`
+	Status        string     `json:"status"`
+	TriggerType   string     `json:"trigger_type"`
+	UserID        *int       `json:"user_id,omitempty"`
+	Logs          string     `json:"logs,omitempty"`
+	ErrorMessage  *string    `json:"error_message,omitempty"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	DurationMs    *int64     `json:"duration_ms,omitempty"`
+}
+
+// CreateDeploymentRecord starts a pending deployment record and sets its ID
+func (d *DeploymentAPI) CreateDeploymentRecord(ctx context.Context, record *DeploymentRecord) error {
+	if err := ValidateArgs(record.AppName, record.GitURL, record.GitBranch, record.GitCommit, record.GitTag, record.SourceApp, record.SourceImage, record.SourceArchive); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	if record.Status == "" {
+		record.Status = "pending"
+	}
+	if record.TriggerType == "" {
+		record.TriggerType = "manual"
+	}
+	record.StartedAt = time.Now()
+
+	// The release number comes from the counter of the app, so numbers are never reused
+	query := `
+		WITH counter AS (
+			INSERT INTO app_release_counters (app_name, last_release) VALUES ($1, 1)
+			ON CONFLICT (app_name) DO UPDATE SET last_release = app_release_counters.last_release + 1
+			RETURNING last_release
+		)
+		INSERT INTO deployment_history (app_name, activity_id, git_url, git_branch, git_commit,
+		                                status, trigger_type, user_id, started_at, source_app, source_deployment_id,
+		                                retry_of_id, release_number, git_tag, source_image, source_archive)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12, (SELECT last_release FROM counter),
+		        NULLIF($13, ''), NULLIF($14, ''), NULLIF($15, ''))
+		RETURNING id, release_number`
+
+	err := QueryRow(ctx, query,
+		record.AppName, record.ActivityID, record.GitURL, record.GitBranch, record.GitCommit,
+		record.Status, record.TriggerType, record.UserID, record.StartedAt, record.SourceApp, record.SourceDeploymentID,
+		record.RetryOfID, record.GitTag, record.SourceImage, record.SourceArchive,
+	).Scan(&record.ID, &record.ReleaseNumber)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment record: %w", err)
+	}
+
+	return nil
+}
+
+// FinishDeploymentRecord stores the outcome, build logs and diagnostics (JSON, may be nil) of a deployment
+func (d *DeploymentAPI) FinishDeploymentRecord(ctx context.Context, id int, status, logs, errorMessage string, diagnostics []byte) error {
+	if err := ValidateArgs(id, status); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// Logs and errors are raw build output, pass them as bytes so they skip argument validation
+	var errorBytes []byte
+	if errorMessage != "" {
+		errorBytes = []byte(errorMessage)
+	}
+
+	query := `
+		UPDATE deployment_history
+		SET status = $2, logs = $3, error_message = $4, finished_at = $5::timestamptz,
+		    duration_ms = (EXTRACT(EPOCH FROM ($5::timestamptz - started_at)) * 1000)::BIGINT,
+		    diagnostics = $6::jsonb
+		WHERE id = $1`
+
+	_, err := Exec(ctx, query, id, status, []byte(logs), errorBytes, time.Now(), diagnostics)
+	if err != nil {
+		return fmt.Errorf("failed to finish deployment record: %w", err)
+	}
+
+	return nil
+}
+
+// ListDeploymentRecords lists the deployments of an app, newest first, without their logs
+func (d *DeploymentAPI) ListDeploymentRecords(ctx context.Context, appName string, limit, offset int) ([]DeploymentRecord, error) {
+	if err := ValidateArgs(appName, limit, offset); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		SELECT id, app_name, activity_id, COALESCE(git_url, ''), COALESCE(git_branch, ''), COALESCE(git_commit, ''), COALESCE(git_tag, ''),
+		       COALESCE(image_id, ''), COALESCE(image_size, 0), COALESCE(builder_image, ''), COALESCE(dockerfile_path, ''),
+		       COALESCE(source_app, ''), COALESCE(source_image, ''), COALESCE(source_archive, ''), source_deployment_id, retry_of_id, COALESCE(release_number, 0), COALESCE(release_name, ''),
+		       status, COALESCE(trigger_type, 'manual'), user_id, error_message, started_at, finished_at, duration_ms
+		FROM deployment_history
+		WHERE app_name = $1
+		ORDER BY started_at DESC, id DESC
+		LIMIT $2 OFFSET $3`
+
+	rows, err := ReadQuery(ctx, query, appName, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployment records: %w", err)
+	}
+	defer rows.Close()
+
+	records := []DeploymentRecord{}
+	for rows.Next() {
+		var record DeploymentRecord
+		if err := rows.Scan(
+			&record.ID, &record.AppName, &record.ActivityID, &record.GitURL, &record.GitBranch, &record.GitCommit, &record.GitTag, &record.ImageID, &record.ImageSize,
+			&record.BuilderImage, &record.DockerfilePath,
+			&record.SourceApp, &record.SourceImage, &record.SourceArchive, &record.SourceDeploymentID, &record.RetryOfID, &record.ReleaseNumber, &record.ReleaseName,
+			&record.Status, &record.TriggerType, &record.UserID, &record.ErrorMessage,
+			&record.StartedAt, &record.FinishedAt, &record.DurationMs,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment record: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// CountDeploymentRecords counts the deployments of an app
+func (d *DeploymentAPI) CountDeploymentRecords(ctx context.Context, appName string) (int, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return 0, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var count int
+	err := ReadQueryRow(ctx, `SELECT COUNT(*) FROM deployment_history WHERE app_name = $1`, appName).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deployment records: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetDeploymentRecord retrieves a deployment of an app including its logs
+func (d *DeploymentAPI) GetDeploymentRecord(ctx context.Context, appName string, id int) (*DeploymentRecord, error) {
+	if err := ValidateArgs(appName, id); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		SELECT id, app_name, activity_id, COALESCE(git_url, ''), COALESCE(git_branch, ''), COALESCE(git_commit, ''), COALESCE(git_tag, ''),
+		       COALESCE(image_id, ''), COALESCE(image_size, 0), COALESCE(builder_image, ''), COALESCE(dockerfile_path, ''),
+		       COALESCE(source_app, ''), COALESCE(source_image, ''), COALESCE(source_archive, ''), source_deployment_id, retry_of_id, COALESCE(release_number, 0), COALESCE(release_name, ''),
+		       status, COALESCE(trigger_type, 'manual'), user_id, COALESCE(logs, ''), error_message,
+		       started_at, finished_at, duration_ms
+		FROM deployment_history
+		WHERE app_name = $1 AND id = $2`
+
+	record := &DeploymentRecord{}
+	err := ReadQueryRow(ctx, query, appName, id).Scan(
+		&record.ID, &record.AppName, &record.ActivityID, &record.GitURL, &record.GitBranch, &record.GitCommit, &record.GitTag, &record.ImageID, &record.ImageSize,
+		&record.BuilderImage, &record.DockerfilePath,
+		&record.SourceApp, &record.SourceImage, &record.SourceArchive, &record.SourceDeploymentID, &record.RetryOfID, &record.ReleaseNumber, &record.ReleaseName,
+		&record.Status, &record.TriggerType, &record.UserID, &record.Logs, &record.ErrorMessage,
+		&record.StartedAt, &record.FinishedAt, &record.DurationMs,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrDeploymentRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to get deployment record: %w", err)
+	}
+
+	return record, nil
+}
+
+// GetDeploymentDiagnostics retrieves the diagnostics JSON of a deployment, nil when none were recorded
+func (d *DeploymentAPI) GetDeploymentDiagnostics(ctx context.Context, appName string, id int) ([]byte, error) {
+	if err := ValidateArgs(appName, id); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var diagnostics *string
+	err := QueryRow(ctx, `SELECT diagnostics::text FROM deployment_history WHERE app_name = $1 AND id = $2`,
+		appName, id).Scan(&diagnostics)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrDeploymentRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to get deployment diagnostics: %w", err)
+	}
+	if diagnostics == nil {
+		return nil, nil
+	}
+
+	return []byte(*diagnostics), nil
+}
+
+// ListRollbackCandidates lists successful deployments of an app that recorded a commit, newest first
+func (d *DeploymentAPI) ListRollbackCandidates(ctx context.Context, appName string, limit int) ([]DeploymentRecord, error) {
+	if err := ValidateArgs(appName, limit); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		SELECT id, app_name, activity_id, COALESCE(git_url, ''), COALESCE(git_branch, ''), COALESCE(git_commit, ''), COALESCE(git_tag, ''),
+		       COALESCE(image_id, ''), COALESCE(image_size, 0), COALESCE(builder_image, ''), COALESCE(dockerfile_path, ''),
+		       COALESCE(source_app, ''), COALESCE(source_image, ''), COALESCE(source_archive, ''), source_deployment_id, retry_of_id, COALESCE(release_number, 0), COALESCE(release_name, ''),
+		       status, COALESCE(trigger_type, 'manual'), user_id, error_message, started_at, finished_at, duration_ms
+		FROM deployment_history
+		WHERE app_name = $1 AND status = 'success' AND COALESCE(git_commit, '') != ''
+		ORDER BY started_at DESC, id DESC
+		LIMIT $2`
+
+	rows, err := Query(ctx, query, appName, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rollback candidates: %w", err)
+	}
+	defer rows.Close()
+
+	records := []DeploymentRecord{}
+	for rows.Next() {
+		var record DeploymentRecord
+		if err := rows.Scan(
+			&record.ID, &record.AppName, &record.ActivityID, &record.GitURL, &record.GitBranch, &record.GitCommit, &record.GitTag, &record.ImageID, &record.ImageSize,
+			&record.BuilderImage, &record.DockerfilePath,
+			&record.SourceApp, &record.SourceImage, &record.SourceArchive, &record.SourceDeploymentID, &record.RetryOfID, &record.ReleaseNumber, &record.ReleaseName,
+			&record.Status, &record.TriggerType, &record.UserID, &record.ErrorMessage,
+			&record.StartedAt, &record.FinishedAt, &record.DurationMs,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment record: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// SetDeploymentImage records the Docker image built by a deployment
+func (d *DeploymentAPI) SetDeploymentImage(ctx context.Context, id int, imageID string) error {
+	if err := ValidateArgs(id, imageID); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `UPDATE deployment_history SET image_id = $2 WHERE id = $1`, id, imageID)
+	if err != nil {
+		return fmt.Errorf("failed to set deployment image: %w", err)
+	}
+
+	return nil
+}
+
+// SetDeploymentImageReport records the size in bytes and the docker history layers of the image
+// of a deployment
+func (d *DeploymentAPI) SetDeploymentImageReport(ctx context.Context, id int, size int64, layers []byte) error {
+	_, err := Exec(ctx, `UPDATE deployment_history SET image_size = $2, image_layers = $3 WHERE id = $1`, id, size, layers)
+	if err != nil {
+		return fmt.Errorf("failed to set deployment image report: %w", err)
+	}
+	return nil
+}
+
+// GetDeploymentImageLayers retrieves the layers recorded for the image of a deployment, nil when
+// none were recorded
+func (d *DeploymentAPI) GetDeploymentImageLayers(ctx context.Context, appName string, id int) ([]byte, error) {
+	if err := ValidateArgs(appName, id); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var layers *string
+	err := QueryRow(ctx, `SELECT image_layers::text FROM deployment_history WHERE app_name = $1 AND id = $2`,
+		appName, id).Scan(&layers)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrDeploymentRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to get deployment image layers: %w", err)
+	}
+	if layers == nil {
+		return nil, nil
+	}
+	return []byte(*layers), nil
+}
+
+// GetPreviousImageSize returns the image size of the last successful deployment of an app before
+// a deployment, 0 when none recorded one
+func (d *DeploymentAPI) GetPreviousImageSize(ctx context.Context, appName string, id int) (int64, error) {
+	if err := ValidateArgs(appName, id); err != nil {
+		return 0, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var size int64
+	err := ReadQueryRow(ctx, `
+		SELECT image_size FROM deployment_history
+		WHERE app_name = $1 AND id < $2 AND status = 'success' AND image_size IS NOT NULL
+		ORDER BY id DESC
+		LIMIT 1`, appName, id).Scan(&size)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get previous image size: %w", err)
+	}
+	return size, nil
+}
+
+// ListReleaseImageIDs returns the images of the last successful deployments of an app that
+// recorded one, newest first
+func (d *DeploymentAPI) ListReleaseImageIDs(ctx context.Context, appName string, limit int) ([]string, error) {
+	if err := ValidateArgs(appName, limit); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := ReadQuery(ctx, `
+		SELECT image_id FROM deployment_history
+		WHERE app_name = $1 AND status = 'success' AND COALESCE(image_id, '') != ''
+		ORDER BY started_at DESC, id DESC
+		LIMIT $2`, appName, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list release images: %w", err)
+	}
+	defer rows.Close()
+
+	imageIDs := []string{}
+	for rows.Next() {
+		var imageID string
+		if err := rows.Scan(&imageID); err != nil {
+			return nil, fmt.Errorf("failed to scan release image: %w", err)
+		}
+		imageIDs = append(imageIDs, imageID)
+	}
+	return imageIDs, rows.Err()
+}
+
+// SetDeploymentBuilderImage records the CNB builder image a pack deployment was built with
+func (d *DeploymentAPI) SetDeploymentBuilderImage(ctx context.Context, id int, builderImage string) error {
+	if err := ValidateArgs(id, builderImage); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `UPDATE deployment_history SET builder_image = $2 WHERE id = $1`, id, builderImage)
+	if err != nil {
+		return fmt.Errorf("failed to set deployment builder image: %w", err)
+	}
+	return nil
+}
+
+// SetDeploymentDockerfilePath records the Dockerfile a deployment was built from
+func (d *DeploymentAPI) SetDeploymentDockerfilePath(ctx context.Context, id int, dockerfilePath string) error {
+	if err := ValidateArgs(id, dockerfilePath); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `UPDATE deployment_history SET dockerfile_path = $2 WHERE id = $1`, id, dockerfilePath)
+	if err != nil {
+		return fmt.Errorf("failed to set deployment dockerfile path: %w", err)
+	}
+	return nil
+}
+
+// GetLatestSuccessfulDeployment retrieves the newest successful deployment of an app, without its logs
+func (d *DeploymentAPI) GetLatestSuccessfulDeployment(ctx context.Context, appName string) (*DeploymentRecord, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		SELECT id, app_name, activity_id, COALESCE(git_url, ''), COALESCE(git_branch, ''), COALESCE(git_commit, ''), COALESCE(git_tag, ''),
+		       COALESCE(image_id, ''), COALESCE(image_size, 0), COALESCE(builder_image, ''), COALESCE(dockerfile_path, ''),
+		       COALESCE(source_app, ''), COALESCE(source_image, ''), COALESCE(source_archive, ''), source_deployment_id, retry_of_id, COALESCE(release_number, 0), COALESCE(release_name, ''),
+		       status, COALESCE(trigger_type, 'manual'), user_id, error_message, started_at, finished_at, duration_ms
+		FROM deployment_history
+		WHERE app_name = $1 AND status = 'success'
+		ORDER BY started_at DESC, id DESC
+		LIMIT 1`
+
+	record := &DeploymentRecord{}
+	err := QueryRow(ctx, query, appName).Scan(
+		&record.ID, &record.AppName, &record.ActivityID, &record.GitURL, &record.GitBranch, &record.GitCommit, &record.GitTag, &record.ImageID, &record.ImageSize,
+		&record.BuilderImage, &record.DockerfilePath,
+		&record.SourceApp, &record.SourceImage, &record.SourceArchive, &record.SourceDeploymentID, &record.RetryOfID, &record.ReleaseNumber, &record.ReleaseName,
+		&record.Status, &record.TriggerType, &record.UserID, &record.ErrorMessage,
+		&record.StartedAt, &record.FinishedAt, &record.DurationMs,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrDeploymentRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to get latest successful deployment: %w", err)
+	}
+
+	return record, nil
+}
+
+// DeploymentStats counts deployments across all apps
+type DeploymentStats struct {
+	Today          int `json:"today"`
+	ThisWeek       int `json:"this_week"`
+	FailedToday    int `json:"failed_today"`
+	FailedThisWeek int `json:"failed_this_week"`
+	InProgress     int `json:"in_progress"`
+}
+
+// GetDeploymentStats counts the deployments started since dayStart and weekStart, and those still running
+func (d *DeploymentAPI) GetDeploymentStats(ctx context.Context, dayStart, weekStart time.Time) (*DeploymentStats, error) {
+	query := `
+		SELECT COUNT(*) FILTER (WHERE started_at >= $1),
+		       COUNT(*) FILTER (WHERE started_at >= $2),
+		       COUNT(*) FILTER (WHERE started_at >= $1 AND status = 'error'),
+		       COUNT(*) FILTER (WHERE started_at >= $2 AND status = 'error'),
+		       COUNT(*) FILTER (WHERE status = 'pending')
+		FROM deployment_history
+		WHERE started_at >= LEAST($1, $2) OR status = 'pending'`
+
+	stats := &DeploymentStats{}
+	err := ReadQueryRow(ctx, query, dayStart, weekStart).Scan(
+		&stats.Today, &stats.ThisWeek, &stats.FailedToday, &stats.FailedThisWeek, &stats.InProgress,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count deployments: %w", err)
+	}
+
+	return stats, nil
+}
+
+// ListRecentFailedDeployments lists the failed deployments of all apps since a time, newest
+// first, without their logs
+func (d *DeploymentAPI) ListRecentFailedDeployments(ctx context.Context, since time.Time, limit int) ([]DeploymentRecord, error) {
+	query := `
+		SELECT id, app_name, activity_id, COALESCE(git_url, ''), COALESCE(git_branch, ''), COALESCE(git_commit, ''), COALESCE(git_tag, ''),
+		       COALESCE(image_id, ''), COALESCE(image_size, 0), COALESCE(builder_image, ''), COALESCE(dockerfile_path, ''),
+		       COALESCE(source_app, ''), COALESCE(source_image, ''), COALESCE(source_archive, ''), source_deployment_id, retry_of_id, COALESCE(release_number, 0), COALESCE(release_name, ''),
+		       status, COALESCE(trigger_type, 'manual'), user_id, error_message, started_at, finished_at, duration_ms
+		FROM deployment_history
+		WHERE status = 'error' AND started_at >= $1
+		ORDER BY started_at DESC, id DESC
+		LIMIT $2`
+
+	rows, err := ReadQuery(ctx, query, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed deployments: %w", err)
+	}
+	defer rows.Close()
+
+	records := []DeploymentRecord{}
+	for rows.Next() {
+		var record DeploymentRecord
+		if err := rows.Scan(
+			&record.ID, &record.AppName, &record.ActivityID, &record.GitURL, &record.GitBranch, &record.GitCommit, &record.GitTag, &record.ImageID, &record.ImageSize,
+			&record.BuilderImage, &record.DockerfilePath,
+			&record.SourceApp, &record.SourceImage, &record.SourceArchive, &record.SourceDeploymentID, &record.RetryOfID, &record.ReleaseNumber, &record.ReleaseName,
+			&record.Status, &record.TriggerType, &record.UserID, &record.ErrorMessage,
+			&record.StartedAt, &record.FinishedAt, &record.DurationMs,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment record: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
@@ -389,7 +389,13 @@ func (d *DeploymentAPI) DeleteAllAppData(ctx context.Context, appName string) er
 			return fmt.Errorf("failed to delete github_deployment_logs: %w", err)
 		}
 
-		// 10. Delete github_webhook_events related to this app (if any)
+		// 10. Delete deployment_history
+		_, err = tx.Exec(ctx, `DELETE FROM deployment_history WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete deployment_history: %w", err)
+		}
+
+		// 11. Delete github_webhook_events related to this app (if any)
 		// This is a bit more complex as we need to find the repository_id first
 		_, err = tx.Exec(ctx, `
 			DELETE FROM github_webhook_events 
@@ -401,6 +407,158 @@ func (d *DeploymentAPI) DeleteAllAppData(ctx context.Context, appName string) er
 			return fmt.Errorf("failed to delete github_webhook_events: %w", err)
 		}
 
+		// 12. Delete user_app_interactions
+		_, err = tx.Exec(ctx, `DELETE FROM user_app_interactions WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete user_app_interactions: %w", err)
+		}
+
+		// 13. Delete app_pending_restarts
+		_, err = tx.Exec(ctx, `DELETE FROM app_pending_restarts WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_pending_restarts: %w", err)
+		}
+
+		// 14. Delete domain_checks
+		_, err = tx.Exec(ctx, `DELETE FROM domain_checks WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete domain_checks: %w", err)
+		}
+
+		// 15. Delete app_badge_settings and app_uptime_hourly
+		_, err = tx.Exec(ctx, `DELETE FROM app_badge_settings WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_badge_settings: %w", err)
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM app_uptime_hourly WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_uptime_hourly: %w", err)
+		}
+
+		// 16. Delete domain_propagation
+		_, err = tx.Exec(ctx, `DELETE FROM domain_propagation WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete domain_propagation: %w", err)
+		}
+
+		// 17. Delete app_analytics_settings and app_visitors_daily
+		_, err = tx.Exec(ctx, `DELETE FROM app_analytics_settings WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_analytics_settings: %w", err)
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM app_visitors_daily WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_visitors_daily: %w", err)
+		}
+
+		// 18. Delete the build quota of the app
+		_, err = tx.Exec(ctx, `DELETE FROM build_quotas WHERE scope = 'app' AND subject = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete build_quotas: %w", err)
+		}
+
+		// 19. Delete app_pack_settings
+		_, err = tx.Exec(ctx, `DELETE FROM app_pack_settings WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_pack_settings: %w", err)
+		}
+
+		// 20. Delete the support access grants of the app
+		_, err = tx.Exec(ctx, `DELETE FROM support_access_grants WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete support_access_grants: %w", err)
+		}
+
+		// 21. Delete the build variables of the app
+		_, err = tx.Exec(ctx, `DELETE FROM app_build_vars WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_build_vars: %w", err)
+		}
+
+		// 22. Delete the pipeline of the app, the stages of its deployments went with deployment_history
+		_, err = tx.Exec(ctx, `DELETE FROM app_pipelines WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_pipelines: %w", err)
+		}
+
+		// 23. Delete the protected env keys of the app
+		_, err = tx.Exec(ctx, `DELETE FROM app_protected_env_keys WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_protected_env_keys: %w", err)
+		}
+
+		// 24. Delete the always masked env keys of the app
+		_, err = tx.Exec(ctx, `DELETE FROM app_masked_env_keys WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_masked_env_keys: %w", err)
+		}
+
+		// 25. Delete the log sinks of the app, a new app with its name must not inherit them
+		_, err = tx.Exec(ctx, `DELETE FROM app_log_sinks WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_log_sinks: %w", err)
+		}
+
+		// 26. Delete the branch rules of the app and those deploying to it
+		_, err = tx.Exec(ctx, `DELETE FROM github_branch_rules WHERE app_name = $1 OR target_app = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete github_branch_rules: %w", err)
+		}
+
+		// 27. Delete the push filter of the app
+		_, err = tx.Exec(ctx, `DELETE FROM github_push_filters WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete github_push_filters: %w", err)
+		}
+
+		// 28. Delete the release counter of the app, a new app with its name starts at v1
+		_, err = tx.Exec(ctx, `DELETE FROM app_release_counters WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_release_counters: %w", err)
+		}
+
+		// 29. Delete the type of the app
+		_, err = tx.Exec(ctx, `DELETE FROM app_types WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_types: %w", err)
+		}
+
+		// 30. Delete the deploy hooks of the app
+		_, err = tx.Exec(ctx, `DELETE FROM app_deploy_hooks WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_deploy_hooks: %w", err)
+		}
+
+		// 31. Delete the production flag of the app
+		_, err = tx.Exec(ctx, `DELETE FROM app_production_flags WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_production_flags: %w", err)
+		}
+
+		// 32. Delete the scheduled deployments of the app
+		_, err = tx.Exec(ctx, `DELETE FROM scheduled_deployments WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete scheduled_deployments: %w", err)
+		}
+
+		// 33. Delete the identity header setting of the app
+		_, err = tx.Exec(ctx, `DELETE FROM app_identity_settings WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_identity_settings: %w", err)
+		}
+
+		// 34. Delete the promotion links from and to the app
+		_, err = tx.Exec(ctx, `DELETE FROM app_promotion_links WHERE app_name = $1 OR target_app = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_promotion_links: %w", err)
+		}
+
+		// 35. Delete the service tokens of the app
+		_, err = tx.Exec(ctx, `DELETE FROM app_service_tokens WHERE app_name = $1`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to delete app_service_tokens: %w", err)
+		}
+
 		return nil
 	})
 }
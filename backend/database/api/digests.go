@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrDigestSubscriptionNotFound is returned when a user isn't subscribed to digests
+var ErrDigestSubscriptionNotFound = errors.New("digest subscription not found")
+
+// DigestSubscription is how and when a user receives the digest of their apps
+type DigestSubscription struct {
+	UserID    int    `json:"user_id"`
+	Frequency string `json:"frequency"`
+	Timezone  string `json:"timezone"`
+	// SendHour is the local hour the digest is sent at, SendWeekday the day of weekly digests
+	SendHour      int     `json:"send_hour"`
+	SendWeekday   int     `json:"send_weekday"`
+	EmailEnabled  bool    `json:"email_enabled"`
+	WebhookURL    *string `json:"webhook_url,omitempty"`
+	WebhookSecret *string `json:"-"` // encrypted
+	// Apps are the apps summarized, empty for the apps the user recently worked on
+	Apps          []string   `json:"apps"`
+	Enabled       bool       `json:"enabled"`
+	LastPeriodEnd *time.Time `json:"last_period_end,omitempty"`
+	LastSentAt    *time.Time `json:"last_sent_at,omitempty"`
+	LastError     *string    `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+const digestSubscriptionColumns = `user_id, frequency, timezone, send_hour, send_weekday, email_enabled, webhook_url,
+	webhook_secret, apps, enabled, last_period_end, last_sent_at, last_error, created_at, updated_at`
+
+func scanDigestSubscription(row pgx.Row) (*DigestSubscription, error) {
+	sub := &DigestSubscription{}
+	err := row.Scan(&sub.UserID, &sub.Frequency, &sub.Timezone, &sub.SendHour, &sub.SendWeekday, &sub.EmailEnabled,
+		&sub.WebhookURL, &sub.WebhookSecret, &sub.Apps, &sub.Enabled, &sub.LastPeriodEnd, &sub.LastSentAt,
+		&sub.LastError, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// GetDigestSubscription returns the digest subscription of a user
+func (u *UserAPI) GetDigestSubscription(ctx context.Context, userID int) (*DigestSubscription, error) {
+	sub, err := scanDigestSubscription(QueryRow(ctx,
+		`SELECT `+digestSubscriptionColumns+` FROM user_digest_subscriptions WHERE user_id = $1`, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDigestSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get digest subscription: %w", err)
+	}
+	return sub, nil
+}
+
+// SetDigestSubscription creates or replaces the digest subscription of a user
+func (u *UserAPI) SetDigestSubscription(ctx context.Context, sub *DigestSubscription) error {
+	if err := ValidateArgs(sub.Frequency, sub.Timezone); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	for _, app := range sub.Apps {
+		if err := ValidateArgs(app); err != nil {
+			return fmt.Errorf("validation failed: %w", err)
+		}
+	}
+	if sub.Apps == nil {
+		sub.Apps = []string{}
+	}
+
+	query := `
+		INSERT INTO user_digest_subscriptions (user_id, frequency, timezone, send_hour, send_weekday, email_enabled,
+		                                       webhook_url, webhook_secret, apps, enabled, last_period_end, last_error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULL)
+		ON CONFLICT (user_id) DO UPDATE
+		SET frequency = EXCLUDED.frequency, timezone = EXCLUDED.timezone, send_hour = EXCLUDED.send_hour,
+		    send_weekday = EXCLUDED.send_weekday, email_enabled = EXCLUDED.email_enabled,
+		    webhook_url = EXCLUDED.webhook_url, webhook_secret = EXCLUDED.webhook_secret, apps = EXCLUDED.apps,
+		    enabled = EXCLUDED.enabled, last_period_end = EXCLUDED.last_period_end, last_error = NULL
+		RETURNING created_at, updated_at`
+
+	err := QueryRow(ctx, query, sub.UserID, sub.Frequency, sub.Timezone, sub.SendHour, sub.SendWeekday,
+		sub.EmailEnabled, sub.WebhookURL, sub.WebhookSecret, sub.Apps, sub.Enabled, sub.LastPeriodEnd,
+	).Scan(&sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save digest subscription: %w", err)
+	}
+	sub.LastError = nil
+	return nil
+}
+
+// DeleteDigestSubscription unsubscribes a user from digests
+func (u *UserAPI) DeleteDigestSubscription(ctx context.Context, userID int) error {
+	tag, err := Exec(ctx, `DELETE FROM user_digest_subscriptions WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete digest subscription: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDigestSubscriptionNotFound
+	}
+	return nil
+}
+
+// ListEnabledDigestSubscriptions lists the digest subscriptions that are enabled
+func (u *UserAPI) ListEnabledDigestSubscriptions(ctx context.Context) ([]DigestSubscription, error) {
+	rows, err := Query(ctx, `
+		SELECT `+digestSubscriptionColumns+`
+		FROM user_digest_subscriptions
+		WHERE enabled
+		ORDER BY user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list digest subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []DigestSubscription{}
+	for rows.Next() {
+		sub, err := scanDigestSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan digest subscription: %w", err)
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, rows.Err()
+}
+
+// RecordDigestSent records the end of the last period a digest was sent for. sent is false when
+// the period was given up after failed attempts, errMessage holds the last failure.
+func (u *UserAPI) RecordDigestSent(ctx context.Context, userID int, periodEnd time.Time, sent bool, errMessage *string) error {
+	_, err := Exec(ctx, `
+		UPDATE user_digest_subscriptions
+		SET last_period_end = $2,
+		    last_sent_at = CASE WHEN $3 THEN CURRENT_TIMESTAMP ELSE last_sent_at END,
+		    last_error = $4
+		WHERE user_id = $1`, userID, periodEnd, sent, errMessage)
+	if err != nil {
+		return fmt.Errorf("failed to record digest: %w", err)
+	}
+	return nil
+}
+
+// RecordDigestError records a failed attempt to send a digest that will be retried
+func (u *UserAPI) RecordDigestError(ctx context.Context, userID int, errMessage string) error {
+	if _, err := Exec(ctx, `UPDATE user_digest_subscriptions SET last_error = $2 WHERE user_id = $1`,
+		userID, errMessage); err != nil {
+		return fmt.Errorf("failed to record digest error: %w", err)
+	}
+	return nil
+}
+
+// AppDeploymentSummary counts the deployments of an app over a period
+type AppDeploymentSummary struct {
+	AppName   string `json:"app_name"`
+	Total     int    `json:"total"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	// LastError is the error of the last failed deployment of the period
+	LastError *string `json:"last_error,omitempty"`
+}
+
+// SummarizeDeployments counts the deployments of apps started in [since, until), by app. Apps
+// without deployments in the period are left out.
+func (d *DeploymentAPI) SummarizeDeployments(ctx context.Context, apps []string, since, until time.Time) (map[string]AppDeploymentSummary, error) {
+	summaries := make(map[string]AppDeploymentSummary)
+	if len(apps) == 0 {
+		return summaries, nil
+	}
+
+	rows, err := ReadQuery(ctx, `
+		SELECT app_name, COUNT(*),
+		       COUNT(*) FILTER (WHERE status = 'success'),
+		       COUNT(*) FILTER (WHERE status = 'error'),
+		       (ARRAY_AGG(error_message ORDER BY started_at DESC) FILTER (WHERE status = 'error'))[1]
+		FROM deployment_history
+		WHERE app_name = ANY($1) AND started_at >= $2 AND started_at < $3
+		GROUP BY app_name`, apps, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize deployments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var summary AppDeploymentSummary
+		if err := rows.Scan(&summary.AppName, &summary.Total, &summary.Succeeded, &summary.Failed, &summary.LastError); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment summary: %w", err)
+		}
+		summaries[summary.AppName] = summary
+	}
+	return summaries, rows.Err()
+}
@@ -191,6 +191,53 @@ func (g *GitHubAPI) GetGitHubRepositoryByID(ctx context.Context, githubID int64)
 	}, nil
 }
 
+// ListGitHubRepositoriesByID retrieves every app connected to a GitHub repository
+func (g *GitHubAPI) ListGitHubRepositoriesByID(ctx context.Context, githubID int64) ([]GitHubRepository, error) {
+	if err := ValidateArgs(githubID); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		SELECT app_name, auto_deploy_enabled, deploy_branch 
+		FROM github_repositories 
+		WHERE github_id = $1 AND deleted_at IS NULL
+		ORDER BY app_name`
+
+	rows, err := Query(ctx, query, githubID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %w", err)
+	}
+	defer rows.Close()
+
+	var repositories []GitHubRepository
+	for rows.Next() {
+		var repository GitHubRepository
+		if err := rows.Scan(&repository.AppName, &repository.AutoDeployEnabled, &repository.DeployBranch); err != nil {
+			return nil, fmt.Errorf("failed to scan repository: %w", err)
+		}
+		repositories = append(repositories, repository)
+	}
+
+	return repositories, rows.Err()
+}
+
+// GetUserIDByGitHubID finds the Citizen user linked to a GitHub account
+func (g *GitHubAPI) GetUserIDByGitHubID(ctx context.Context, githubID int64) (int, error) {
+	if err := ValidateArgs(githubID); err != nil {
+		return 0, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `SELECT id FROM users WHERE github_id = $1 AND github_connected = true`
+
+	var userID int
+	err := QueryRow(ctx, query, githubID).Scan(&userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find user for GitHub account: %w", err)
+	}
+
+	return userID, nil
+}
+
 // GetGitHubRepositoryConnections retrieves all repository connections for a user
 func (g *GitHubAPI) GetGitHubRepositoryConnections(ctx context.Context, userID int) ([]map[string]interface{}, error) {
 	if err := ValidateArgs(userID); err != nil {
@@ -200,7 +247,7 @@ func (g *GitHubAPI) GetGitHubRepositoryConnections(ctx context.Context, userID i
 	query := `
 		SELECT app_name, github_id, full_name, name, owner, clone_url, html_url, private, 
 		       default_branch, auto_deploy_enabled, deploy_branch, webhook_id, 
-		       connected_at, last_deploy, created_at 
+		       connected_at, last_deploy, created_at, COALESCE(build_path, '')
 		FROM github_repositories 
 		WHERE user_id = $1 AND deleted_at IS NULL`
 
@@ -212,14 +259,14 @@ func (g *GitHubAPI) GetGitHubRepositoryConnections(ctx context.Context, userID i
 
 	var connections []map[string]interface{}
 	for rows.Next() {
-		var appName, fullName, name, owner, cloneURL, htmlURL, defaultBranch, deployBranch string
+		var appName, fullName, name, owner, cloneURL, htmlURL, defaultBranch, deployBranch, buildPath string
 		var githubID *int64
 		var private, autoDeploy bool
 		var webhookID *int64
 		var connectedAt, lastDeploy, createdAt interface{}
 
 		err := rows.Scan(&appName, &githubID, &fullName, &name, &owner, &cloneURL, &htmlURL, &private, 
-			&defaultBranch, &autoDeploy, &deployBranch, &webhookID, &connectedAt, &lastDeploy, &createdAt)
+			&defaultBranch, &autoDeploy, &deployBranch, &webhookID, &connectedAt, &lastDeploy, &createdAt, &buildPath)
 		if err != nil {
 			continue
 		}
@@ -240,6 +287,7 @@ func (g *GitHubAPI) GetGitHubRepositoryConnections(ctx context.Context, userID i
 			"connected_at":    connectedAt,
 			"last_deploy":     lastDeploy,
 			"created_at":      createdAt,
+			"build_path":      buildPath,
 		})
 	}
 
@@ -252,45 +300,49 @@ type GitHubConfig struct {
 	ClientSecret  string
 	WebhookSecret string
 	RedirectURI   string
+	RedirectURIs  []string // every allowed redirect URI, including RedirectURI
 	CreatedAt     time.Time
 }
 
 // GetGitHubConfig retrieves GitHub config (without secrets)
 func (g *GitHubAPI) GetGitHubConfig(ctx context.Context) (*GitHubConfig, error) {
 	query := `
-		SELECT client_id, redirect_uri, created_at
+		SELECT client_id, redirect_uri, redirect_uris, created_at
 		FROM github_config
 		WHERE is_active = true
 		ORDER BY updated_at DESC
 		LIMIT 1`
 
 	var clientID, redirectURI string
+	var redirectURIs []string
 	var createdAt time.Time
 
-	err := QueryRow(ctx, query).Scan(&clientID, &redirectURI, &createdAt)
+	err := QueryRow(ctx, query).Scan(&clientID, &redirectURI, &redirectURIs, &createdAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get GitHub config: %w", err)
 	}
 
 	return &GitHubConfig{
-		ClientID:    clientID,
-		RedirectURI: redirectURI,
-		CreatedAt:   createdAt,
+		ClientID:     clientID,
+		RedirectURI:  redirectURI,
+		RedirectURIs: redirectURIs,
+		CreatedAt:    createdAt,
 	}, nil
 }
 
 // GetGitHubConfigFull retrieves full GitHub config (with secrets)
 func (g *GitHubAPI) GetGitHubConfigFull(ctx context.Context) (*GitHubConfig, error) {
 	query := `
-		SELECT client_id, client_secret, webhook_secret, redirect_uri
+		SELECT client_id, client_secret, webhook_secret, redirect_uri, redirect_uris
 		FROM github_config
 		WHERE is_active = true
 		ORDER BY updated_at DESC
 		LIMIT 1`
 
 	var clientID, clientSecret, webhookSecret, redirectURI string
+	var redirectURIs []string
 
-	err := QueryRow(ctx, query).Scan(&clientID, &clientSecret, &webhookSecret, &redirectURI)
+	err := QueryRow(ctx, query).Scan(&clientID, &clientSecret, &webhookSecret, &redirectURI, &redirectURIs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get GitHub config: %w", err)
 	}
@@ -300,23 +352,33 @@ func (g *GitHubAPI) GetGitHubConfigFull(ctx context.Context) (*GitHubConfig, err
 		ClientSecret:  clientSecret,
 		WebhookSecret: webhookSecret,
 		RedirectURI:   redirectURI,
+		RedirectURIs:  redirectURIs,
 	}, nil
 }
 
-// SaveGitHubConfig saves GitHub configuration to database
-func (g *GitHubAPI) SaveGitHubConfig(ctx context.Context, clientID, clientSecret, webhookSecret, redirectURI string) error {
+// SaveGitHubConfig saves GitHub configuration to database. redirectURI is the default
+// redirect URI and redirectURIs every allowed one.
+func (g *GitHubAPI) SaveGitHubConfig(ctx context.Context, clientID, clientSecret, webhookSecret, redirectURI string, redirectURIs []string) error {
 	if err := ValidateArgs(clientID, clientSecret, webhookSecret, redirectURI); err != nil {
 		return fmt.Errorf("validation failed: %w", err)
 	}
+	for _, uri := range redirectURIs {
+		if err := ValidateArgs(uri); err != nil {
+			return fmt.Errorf("validation failed: %w", err)
+		}
+	}
+	if len(redirectURIs) == 0 {
+		redirectURIs = []string{redirectURI}
+	}
 
 	query := `
 		WITH deactivated AS (
 			UPDATE github_config SET is_active = false WHERE is_active = true
 		)
-		INSERT INTO github_config (client_id, client_secret, webhook_secret, redirect_uri, is_active)
-		VALUES ($1, $2, $3, $4, true)`
+		INSERT INTO github_config (client_id, client_secret, webhook_secret, redirect_uri, redirect_uris, is_active)
+		VALUES ($1, $2, $3, $4, $5, true)`
 
-	_, err := Exec(ctx, query, clientID, clientSecret, webhookSecret, redirectURI)
+	_, err := Exec(ctx, query, clientID, clientSecret, webhookSecret, redirectURI, redirectURIs)
 	if err != nil {
 		return fmt.Errorf("failed to save GitHub config: %w", err)
 	}
@@ -357,4 +419,14 @@ func (g *GitHubAPI) GetGitHubRepositoryDeployBranch(ctx context.Context, appName
 	}
 
 	return deployBranch, nil
-} 
\ No newline at end of file
+} 
+// PruneWebhookEvents deletes webhook events received before the given time
+func (g *GitHubAPI) PruneWebhookEvents(ctx context.Context, olderThan time.Time) (int64, error) {
+	query := `DELETE FROM github_webhook_events WHERE created_at < $1`
+	result, err := Exec(ctx, query, olderThan)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune webhook events: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// GitHubWebhookConnection is a repository connection of a user holding a webhook
+type GitHubWebhookConnection struct {
+	AppName   string `json:"app_name"`
+	FullName  string `json:"full_name"`
+	WebhookID int64  `json:"webhook_id"`
+	// Shared is set when a connection of another user points to the same webhook
+	Shared bool `json:"shared"`
+}
+
+// ListUserWebhookConnections lists the active repository connections of a user that have a webhook
+func (g *GitHubAPI) ListUserWebhookConnections(ctx context.Context, userID int) ([]GitHubWebhookConnection, error) {
+	query := `
+		SELECT gr.app_name, gr.full_name, gr.webhook_id,
+		       EXISTS (
+		           SELECT 1 FROM github_repositories o
+		           WHERE o.github_id = gr.github_id AND o.webhook_id = gr.webhook_id
+		             AND o.user_id <> gr.user_id AND o.deleted_at IS NULL
+		       )
+		FROM github_repositories gr
+		WHERE gr.user_id = $1 AND gr.webhook_id IS NOT NULL AND gr.deleted_at IS NULL
+		ORDER BY gr.app_name`
+
+	rows, err := Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook connections: %w", err)
+	}
+	defer rows.Close()
+
+	connections := []GitHubWebhookConnection{}
+	for rows.Next() {
+		var connection GitHubWebhookConnection
+		if err := rows.Scan(&connection.AppName, &connection.FullName, &connection.WebhookID, &connection.Shared); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook connection: %w", err)
+		}
+		connections = append(connections, connection)
+	}
+	return connections, rows.Err()
+}
+
+// ClearRepositoryWebhook forgets the webhook of a repository connection and turns off its auto
+// deploy, which can't be triggered anymore
+func (g *GitHubAPI) ClearRepositoryWebhook(ctx context.Context, appName string) error {
+	if err := ValidateArgs(appName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		UPDATE github_repositories
+		SET webhook_id = NULL, webhook_active = false, auto_deploy_enabled = false, updated_at = CURRENT_TIMESTAMP
+		WHERE app_name = $1 AND deleted_at IS NULL`
+
+	if _, err := Exec(ctx, query, appName); err != nil {
+		return fmt.Errorf("failed to clear repository webhook: %w", err)
+	}
+	return nil
+}
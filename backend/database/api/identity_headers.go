@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AppIdentitySetting is how ForwardAuth tells an app who its signed-in visitor is: identity
+// headers unless the app opted out, and a signed identity token when it opted in.
+// TokenSecret is the encrypted secret the token is signed with.
+type AppIdentitySetting struct {
+	AppName        string `json:"app_name"`
+	HeadersEnabled bool   `json:"headers_enabled"`
+	TokenEnabled   bool   `json:"token_enabled"`
+	TokenSecret    string `json:"-"`
+}
+
+// GetAppIdentitySetting returns the identity setting of an app, headers without a token when none
+// is stored
+func (s *SettingsAPI) GetAppIdentitySetting(ctx context.Context, appName string) (*AppIdentitySetting, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	setting := &AppIdentitySetting{AppName: appName, HeadersEnabled: true}
+	err := QueryRow(ctx, `
+		SELECT headers_enabled, token_enabled, COALESCE(token_secret, '')
+		FROM app_identity_settings WHERE app_name = $1`, appName).
+		Scan(&setting.HeadersEnabled, &setting.TokenEnabled, &setting.TokenSecret)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get identity setting: %w", err)
+	}
+	return setting, nil
+}
+
+// SetAppIdentitySetting stores the identity setting of an app
+func (s *SettingsAPI) SetAppIdentitySetting(ctx context.Context, setting *AppIdentitySetting, userID *int) error {
+	if err := ValidateArgs(setting.AppName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `
+		INSERT INTO app_identity_settings (app_name, headers_enabled, token_enabled, token_secret, updated_by)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		ON CONFLICT (app_name) DO UPDATE
+		SET headers_enabled = EXCLUDED.headers_enabled, token_enabled = EXCLUDED.token_enabled,
+		    token_secret = EXCLUDED.token_secret, updated_by = EXCLUDED.updated_by`,
+		setting.AppName, setting.HeadersEnabled, setting.TokenEnabled, []byte(setting.TokenSecret), userID)
+	if err != nil {
+		return fmt.Errorf("failed to set identity setting: %w", err)
+	}
+	return nil
+}
+
+// ListAppIdentitySettings lists the identity settings stored for apps
+func (s *SettingsAPI) ListAppIdentitySettings(ctx context.Context) ([]AppIdentitySetting, error) {
+	rows, err := Query(ctx, `
+		SELECT app_name, headers_enabled, token_enabled, COALESCE(token_secret, '')
+		FROM app_identity_settings
+		ORDER BY app_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identity settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := []AppIdentitySetting{}
+	for rows.Next() {
+		var setting AppIdentitySetting
+		if err := rows.Scan(&setting.AppName, &setting.HeadersEnabled, &setting.TokenEnabled, &setting.TokenSecret); err != nil {
+			return nil, fmt.Errorf("failed to scan identity setting: %w", err)
+		}
+		settings = append(settings, setting)
+	}
+	return settings, rows.Err()
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrLogAlertRuleNotFound is returned when a log alert rule does not exist for an app
+var ErrLogAlertRuleNotFound = errors.New("log alert rule not found")
+
+// LogAlertRule is a pattern matched against the logs of an app
+type LogAlertRule struct {
+	ID                int        `json:"id"`
+	AppName           string     `json:"app_name"`
+	Name              string     `json:"name"`
+	Pattern           string     `json:"pattern"`
+	IsRegex           bool       `json:"is_regex"`
+	ProcessType       string     `json:"process_type,omitempty"`
+	ChannelType       string     `json:"channel_type,omitempty"`
+	ChannelURL        string     `json:"-"` // encrypted
+	CooldownSeconds   int        `json:"cooldown_seconds"`
+	Enabled           bool       `json:"enabled"`
+	LastTriggeredAt   *time.Time `json:"last_triggered_at,omitempty"`
+	SuppressedMatches int        `json:"suppressed_matches"`
+	CreatedBy         *int       `json:"created_by,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+const logAlertRuleColumns = `id, app_name, name, pattern, is_regex, COALESCE(process_type, ''), COALESCE(channel_type, ''),
+	COALESCE(channel_url, ''), cooldown_seconds, enabled, last_triggered_at, suppressed_matches, created_by,
+	created_at, updated_at`
+
+func scanLogAlertRule(row pgx.Row) (*LogAlertRule, error) {
+	rule := &LogAlertRule{}
+	err := row.Scan(&rule.ID, &rule.AppName, &rule.Name, &rule.Pattern, &rule.IsRegex, &rule.ProcessType,
+		&rule.ChannelType, &rule.ChannelURL, &rule.CooldownSeconds, &rule.Enabled, &rule.LastTriggeredAt,
+		&rule.SuppressedMatches, &rule.CreatedBy, &rule.CreatedAt, &rule.UpdatedAt)
+	return rule, err
+}
+
+// CreateLogAlertRule stores a new rule and sets its ID and timestamps
+func (l *LogAlertAPI) CreateLogAlertRule(ctx context.Context, rule *LogAlertRule) error {
+	if err := ValidateArgs(rule.AppName, rule.Name, rule.ProcessType, rule.ChannelType); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// Patterns are regular expressions, pass them as bytes so they skip argument validation
+	query := `
+		INSERT INTO log_alert_rules (app_name, name, pattern, is_regex, process_type, channel_type, channel_url,
+		                             cooldown_seconds, enabled, created_by)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, $9, $10)
+		RETURNING id, created_at, updated_at`
+
+	err := QueryRow(ctx, query, rule.AppName, rule.Name, []byte(rule.Pattern), rule.IsRegex, rule.ProcessType,
+		rule.ChannelType, []byte(rule.ChannelURL), rule.CooldownSeconds, rule.Enabled, rule.CreatedBy,
+	).Scan(&rule.ID, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create log alert rule: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateLogAlertRule stores the editable fields of a rule
+func (l *LogAlertAPI) UpdateLogAlertRule(ctx context.Context, rule *LogAlertRule) error {
+	if err := ValidateArgs(rule.AppName, rule.Name, rule.ProcessType, rule.ChannelType); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		UPDATE log_alert_rules
+		SET name = $3, pattern = $4, is_regex = $5, process_type = NULLIF($6, ''), channel_type = NULLIF($7, ''),
+		    channel_url = NULLIF($8, ''), cooldown_seconds = $9, enabled = $10
+		WHERE app_name = $1 AND id = $2`
+
+	result, err := Exec(ctx, query, rule.AppName, rule.ID, rule.Name, []byte(rule.Pattern), rule.IsRegex,
+		rule.ProcessType, rule.ChannelType, []byte(rule.ChannelURL), rule.CooldownSeconds, rule.Enabled)
+	if err != nil {
+		return fmt.Errorf("failed to update log alert rule: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrLogAlertRuleNotFound
+	}
+
+	return nil
+}
+
+// GetLogAlertRule retrieves a rule of an app
+func (l *LogAlertAPI) GetLogAlertRule(ctx context.Context, appName string, id int) (*LogAlertRule, error) {
+	if err := ValidateArgs(appName, id); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rule, err := scanLogAlertRule(QueryRow(ctx,
+		`SELECT `+logAlertRuleColumns+` FROM log_alert_rules WHERE app_name = $1 AND id = $2`, appName, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrLogAlertRuleNotFound
+		}
+		return nil, fmt.Errorf("failed to get log alert rule: %w", err)
+	}
+
+	return rule, nil
+}
+
+// ListLogAlertRules lists the rules of an app, or the enabled rules of every app when appName is empty
+func (l *LogAlertAPI) ListLogAlertRules(ctx context.Context, appName string) ([]LogAlertRule, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `SELECT ` + logAlertRuleColumns + ` FROM log_alert_rules WHERE app_name = $1 ORDER BY id`
+	args := []interface{}{appName}
+	if appName == "" {
+		query = `SELECT ` + logAlertRuleColumns + ` FROM log_alert_rules WHERE enabled ORDER BY app_name, id`
+		args = nil
+	}
+
+	rows, err := Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []LogAlertRule{}
+	for rows.Next() {
+		rule, err := scanLogAlertRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan log alert rule: %w", err)
+		}
+		rules = append(rules, *rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// DeleteLogAlertRule deletes a rule of an app
+func (l *LogAlertAPI) DeleteLogAlertRule(ctx context.Context, appName string, id int) error {
+	if err := ValidateArgs(appName, id); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	result, err := Exec(ctx, `DELETE FROM log_alert_rules WHERE app_name = $1 AND id = $2`, appName, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete log alert rule: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrLogAlertRuleNotFound
+	}
+
+	return nil
+}
+
+// RecordLogAlertTriggered marks a rule as alerted at the given time and resets its suppressed matches
+func (l *LogAlertAPI) RecordLogAlertTriggered(ctx context.Context, id int, at time.Time) error {
+	_, err := Exec(ctx, `UPDATE log_alert_rules SET last_triggered_at = $2, suppressed_matches = 0 WHERE id = $1`, id, at)
+	if err != nil {
+		return fmt.Errorf("failed to record log alert: %w", err)
+	}
+	return nil
+}
+
+// AddSuppressedLogAlertMatches counts matches of a rule that were not alerted because of its cooldown
+func (l *LogAlertAPI) AddSuppressedLogAlertMatches(ctx context.Context, id, matches int) error {
+	_, err := Exec(ctx, `UPDATE log_alert_rules SET suppressed_matches = suppressed_matches + $2 WHERE id = $1`, id, matches)
+	if err != nil {
+		return fmt.Errorf("failed to count suppressed log alert matches: %w", err)
+	}
+	return nil
+}
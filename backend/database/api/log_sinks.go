@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrLogSinkNotFound is returned when a log sink does not exist for an app
+var ErrLogSinkNotFound = errors.New("log sink not found")
+
+// LogSink is an external endpoint the logs of an app are forwarded to
+type LogSink struct {
+	ID              int        `json:"id"`
+	AppName         string     `json:"app_name"`
+	Name            string     `json:"name"`
+	SinkType        string     `json:"sink_type"`
+	URL             string     `json:"-"` // encrypted
+	AuthHeader      string     `json:"-"` // encrypted
+	ProcessType     string     `json:"process_type,omitempty"`
+	Enabled         bool       `json:"enabled"`
+	LastDeliveredAt *time.Time `json:"last_delivered_at,omitempty"`
+	ForwardedLines  int64      `json:"forwarded_lines"`
+	DroppedLines    int64      `json:"dropped_lines"`
+	LastError       *string    `json:"last_error,omitempty"`
+	CreatedBy       *int       `json:"created_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+const logSinkColumns = `id, app_name, name, sink_type, url, COALESCE(auth_header, ''), COALESCE(process_type, ''), enabled,
+	last_delivered_at, forwarded_lines, dropped_lines, last_error, created_by, created_at, updated_at`
+
+func scanLogSink(row pgx.Row) (*LogSink, error) {
+	sink := &LogSink{}
+	err := row.Scan(&sink.ID, &sink.AppName, &sink.Name, &sink.SinkType, &sink.URL, &sink.AuthHeader, &sink.ProcessType,
+		&sink.Enabled, &sink.LastDeliveredAt, &sink.ForwardedLines, &sink.DroppedLines, &sink.LastError,
+		&sink.CreatedBy, &sink.CreatedAt, &sink.UpdatedAt)
+	return sink, err
+}
+
+// CreateLogSink stores a new log sink and sets its ID and timestamps
+func (l *LogAlertAPI) CreateLogSink(ctx context.Context, sink *LogSink) error {
+	if err := ValidateArgs(sink.AppName, sink.Name, sink.SinkType, sink.ProcessType); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// URLs and headers are encrypted, pass them as bytes so they skip argument validation
+	query := `
+		INSERT INTO app_log_sinks (app_name, name, sink_type, url, auth_header, process_type, enabled, created_by)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8)
+		RETURNING id, created_at, updated_at`
+
+	err := QueryRow(ctx, query, sink.AppName, sink.Name, sink.SinkType, []byte(sink.URL), []byte(sink.AuthHeader),
+		sink.ProcessType, sink.Enabled, sink.CreatedBy,
+	).Scan(&sink.ID, &sink.CreatedAt, &sink.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create log sink: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateLogSink stores the editable fields of a log sink
+func (l *LogAlertAPI) UpdateLogSink(ctx context.Context, sink *LogSink) error {
+	if err := ValidateArgs(sink.AppName, sink.Name, sink.SinkType, sink.ProcessType); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		UPDATE app_log_sinks
+		SET name = $3, sink_type = $4, url = $5, auth_header = NULLIF($6, ''), process_type = NULLIF($7, ''), enabled = $8
+		WHERE app_name = $1 AND id = $2`
+
+	result, err := Exec(ctx, query, sink.AppName, sink.ID, sink.Name, sink.SinkType, []byte(sink.URL),
+		[]byte(sink.AuthHeader), sink.ProcessType, sink.Enabled)
+	if err != nil {
+		return fmt.Errorf("failed to update log sink: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrLogSinkNotFound
+	}
+
+	return nil
+}
+
+// GetLogSink retrieves a log sink of an app
+func (l *LogAlertAPI) GetLogSink(ctx context.Context, appName string, id int) (*LogSink, error) {
+	if err := ValidateArgs(appName, id); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	sink, err := scanLogSink(QueryRow(ctx,
+		`SELECT `+logSinkColumns+` FROM app_log_sinks WHERE app_name = $1 AND id = $2`, appName, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrLogSinkNotFound
+		}
+		return nil, fmt.Errorf("failed to get log sink: %w", err)
+	}
+
+	return sink, nil
+}
+
+// ListLogSinks lists the log sinks of an app, or the enabled sinks of every app when appName is empty
+func (l *LogAlertAPI) ListLogSinks(ctx context.Context, appName string) ([]LogSink, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `SELECT ` + logSinkColumns + ` FROM app_log_sinks WHERE app_name = $1 ORDER BY id`
+	args := []interface{}{appName}
+	if appName == "" {
+		query = `SELECT ` + logSinkColumns + ` FROM app_log_sinks WHERE enabled ORDER BY app_name, id`
+		args = nil
+	}
+
+	rows, err := Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log sinks: %w", err)
+	}
+	defer rows.Close()
+
+	sinks := []LogSink{}
+	for rows.Next() {
+		sink, err := scanLogSink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan log sink: %w", err)
+		}
+		sinks = append(sinks, *sink)
+	}
+
+	return sinks, rows.Err()
+}
+
+// DeleteLogSink removes a log sink of an app
+func (l *LogAlertAPI) DeleteLogSink(ctx context.Context, appName string, id int) error {
+	if err := ValidateArgs(appName, id); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	result, err := Exec(ctx, `DELETE FROM app_log_sinks WHERE app_name = $1 AND id = $2`, appName, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete log sink: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrLogSinkNotFound
+	}
+
+	return nil
+}
+
+// RecordLogSinkFlush adds the lines a flush forwarded and dropped to the counters of a sink and
+// records its error, nil when the flush succeeded
+func (l *LogAlertAPI) RecordLogSinkFlush(ctx context.Context, id int, forwarded, dropped int, flushErr *string) error {
+	query := `
+		UPDATE app_log_sinks
+		SET forwarded_lines = forwarded_lines + $2, dropped_lines = dropped_lines + $3, last_error = $4,
+		    last_delivered_at = CASE WHEN $2 > 0 THEN CURRENT_TIMESTAMP ELSE last_delivered_at END
+		WHERE id = $1`
+
+	var errText []byte
+	if flushErr != nil {
+		errText = []byte(*flushErr)
+	}
+	if _, err := Exec(ctx, query, id, forwarded, dropped, errText); err != nil {
+		return fmt.Errorf("failed to record log sink flush: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrMaskedEnvKeyNotFound is returned when unmarking an env key that isn't always masked
+var ErrMaskedEnvKeyNotFound = errors.New("env key is not always masked")
+
+// MaskedEnvKey is an env key of an app whose value is always masked, it can't be revealed
+type MaskedEnvKey struct {
+	Key       string    `json:"key"`
+	MarkedBy  *int      `json:"marked_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListMaskedEnvKeys lists the always masked env keys of an app by key
+func (a *AppAPI) ListMaskedEnvKeys(ctx context.Context, appName string) ([]MaskedEnvKey, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT key, marked_by, created_at
+		FROM app_masked_env_keys
+		WHERE app_name = $1
+		ORDER BY key`, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list masked env keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []MaskedEnvKey{}
+	for rows.Next() {
+		var k MaskedEnvKey
+		if err := rows.Scan(&k.Key, &k.MarkedBy, &k.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan masked env key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// IsEnvKeyMasked reports whether the value of an env key of an app is always masked
+func (a *AppAPI) IsEnvKeyMasked(ctx context.Context, appName, key string) (bool, error) {
+	if err := ValidateArgs(appName, key); err != nil {
+		return false, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var masked bool
+	err := QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM app_masked_env_keys WHERE app_name = $1 AND key = $2)`,
+		appName, key).Scan(&masked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check masked env key: %w", err)
+	}
+	return masked, nil
+}
+
+// MarkEnvKeyMasked keeps the value of an env key of an app masked, marking it again keeps its
+// first record
+func (a *AppAPI) MarkEnvKeyMasked(ctx context.Context, appName, key string, userID *int) error {
+	if err := ValidateArgs(appName, key); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `
+		INSERT INTO app_masked_env_keys (app_name, key, marked_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (app_name, key) DO NOTHING`,
+		appName, key, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark masked env key: %w", err)
+	}
+	return nil
+}
+
+// UnmarkEnvKeyMasked lets the value of an env key of an app be revealed again
+func (a *AppAPI) UnmarkEnvKeyMasked(ctx context.Context, appName, key string) error {
+	if err := ValidateArgs(appName, key); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	tag, err := Exec(ctx, `DELETE FROM app_masked_env_keys WHERE app_name = $1 AND key = $2`, appName, key)
+	if err != nil {
+		return fmt.Errorf("failed to unmark masked env key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMaskedEnvKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// OperationStatus is the state of a multi-step operation
+type OperationStatus string
+
+const (
+	OperationRunning      OperationStatus = "running"
+	OperationCompleted    OperationStatus = "completed"
+	OperationCompensating OperationStatus = "compensating" // undoing the steps done before a failure
+	OperationCompensated  OperationStatus = "compensated"  // failed, and every step done was undone
+	OperationRetrying     OperationStatus = "retrying"     // failed after a step that can't be undone, retried forward
+	OperationFailed       OperationStatus = "failed"       // stuck, needs an admin
+	OperationResolved     OperationStatus = "resolved"     // marked fixed by an admin
+)
+
+// Step statuses of an operation
+const (
+	StepPending     = "pending"
+	StepDone        = "done"
+	StepFailed      = "failed"
+	StepSkipped     = "skipped"     // a best effort step that failed
+	StepInterrupted = "interrupted" // started when the API stopped, it may have run
+	StepCompensated = "compensated"
+)
+
+// ErrOperationNotFound is returned for unknown operation IDs
+var ErrOperationNotFound = errors.New("operation not found")
+
+// OperationStepState is the recorded state of one step of an operation
+type OperationStepState struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Operation is a recorded multi-step operation across dokku and the database
+type Operation struct {
+	ID          int                  `json:"id"`
+	Kind        string               `json:"kind"`
+	AppName     string               `json:"app_name"`
+	Target      string               `json:"target,omitempty"`
+	Status      OperationStatus      `json:"status"`
+	Steps       []OperationStepState `json:"steps"`
+	Error       *string              `json:"error,omitempty"`
+	Attempts    int                  `json:"attempts"`
+	RequestID   *string              `json:"request_id,omitempty"`
+	UserID      *int                 `json:"user_id,omitempty"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+	CompletedAt *time.Time           `json:"completed_at,omitempty"`
+}
+
+const operationColumns = `id, kind, app_name, target, status, steps, error, attempts, request_id, user_id,
+	created_at, updated_at, completed_at`
+
+// CreateOperation records an operation before its first step runs
+func (o *OperationAPI) CreateOperation(ctx context.Context, op *Operation) error {
+	if err := ValidateArgs(op.Kind, op.AppName, op.Target); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	steps, err := json.Marshal(op.Steps)
+	if err != nil {
+		return err
+	}
+
+	err = QueryRow(ctx, `
+		INSERT INTO operations (kind, app_name, target, status, steps, request_id, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at`,
+		op.Kind, op.AppName, op.Target, string(op.Status), steps, op.RequestID, op.UserID,
+	).Scan(&op.ID, &op.CreatedAt, &op.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create operation: %w", err)
+	}
+	return nil
+}
+
+// SaveOperation stores the status and steps of an operation
+func (o *OperationAPI) SaveOperation(ctx context.Context, op *Operation) error {
+	steps, err := json.Marshal(op.Steps)
+	if err != nil {
+		return err
+	}
+
+	err = QueryRow(ctx, `
+		UPDATE operations
+		SET status = $2, steps = $3, error = $4, attempts = $5, completed_at = $6
+		WHERE id = $1
+		RETURNING updated_at`,
+		op.ID, string(op.Status), steps, op.Error, op.Attempts, op.CompletedAt,
+	).Scan(&op.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save operation: %w", err)
+	}
+	return nil
+}
+
+// GetOperation returns an operation by ID
+func (o *OperationAPI) GetOperation(ctx context.Context, id int) (*Operation, error) {
+	rows, err := Query(ctx, `SELECT `+operationColumns+` FROM operations WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operation: %w", err)
+	}
+	defer rows.Close()
+
+	operations, err := scanOperations(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(operations) == 0 {
+		return nil, ErrOperationNotFound
+	}
+	return &operations[0], nil
+}
+
+// ListOperations lists the most recent operations with one of the statuses, or all of them
+func (o *OperationAPI) ListOperations(ctx context.Context, statuses []string, limit int) ([]Operation, error) {
+	rows, err := Query(ctx, `
+		SELECT `+operationColumns+`
+		FROM operations
+		WHERE $1::text[] IS NULL OR status = ANY($1)
+		ORDER BY updated_at DESC
+		LIMIT $2`, statuses, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations: %w", err)
+	}
+	defer rows.Close()
+	return scanOperations(rows)
+}
+
+// ListStuckOperations lists the operations that need attention: failed ones, and unfinished ones
+// not updated since staleBefore, which the API stopped running or is retrying
+func (o *OperationAPI) ListStuckOperations(ctx context.Context, staleBefore time.Time) ([]Operation, error) {
+	rows, err := Query(ctx, `
+		SELECT `+operationColumns+`
+		FROM operations
+		WHERE status = $1
+		   OR (status IN ($2, $3, $4) AND updated_at < $5)
+		ORDER BY updated_at`,
+		string(OperationFailed), string(OperationRunning), string(OperationCompensating), string(OperationRetrying),
+		staleBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stuck operations: %w", err)
+	}
+	defer rows.Close()
+	return scanOperations(rows)
+}
+
+// ClaimOperation takes an operation for reconciliation, unless it was updated since it was read,
+// by another instance or by the request still running it
+func (o *OperationAPI) ClaimOperation(ctx context.Context, op *Operation) (bool, error) {
+	err := QueryRow(ctx, `
+		UPDATE operations SET attempts = attempts
+		WHERE id = $1 AND updated_at = $2
+		RETURNING updated_at`, op.ID, op.UpdatedAt,
+	).Scan(&op.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim operation: %w", err)
+	}
+	return true, nil
+}
+
+func scanOperations(rows pgx.Rows) ([]Operation, error) {
+	operations := []Operation{}
+	for rows.Next() {
+		var op Operation
+		var status string
+		var steps []byte
+		if err := rows.Scan(&op.ID, &op.Kind, &op.AppName, &op.Target, &status, &steps, &op.Error, &op.Attempts,
+			&op.RequestID, &op.UserID, &op.CreatedAt, &op.UpdatedAt, &op.CompletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan operation: %w", err)
+		}
+		op.Status = OperationStatus(status)
+		if err := json.Unmarshal(steps, &op.Steps); err != nil {
+			return nil, fmt.Errorf("failed to decode steps of operation %d: %w", op.ID, err)
+		}
+		operations = append(operations, op)
+	}
+	return operations, rows.Err()
+}
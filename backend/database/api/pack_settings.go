@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PackSettings are the settings of the pack builds of an app. Empty images use the defaults of
+// dokku. BuildEnvKeys name the app config values meant for the build.
+type PackSettings struct {
+	AppName      string   `json:"app_name"`
+	BuilderImage string   `json:"builder_image"`
+	RunImage     string   `json:"run_image"`
+	BuildEnvKeys []string `json:"build_env_keys"`
+}
+
+// GetPackSettings returns the pack settings of an app, empty when none are stored
+func (a *AppAPI) GetPackSettings(ctx context.Context, appName string) (*PackSettings, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	settings := &PackSettings{AppName: appName, BuildEnvKeys: []string{}}
+	var keys []byte
+	err := QueryRow(ctx, `
+		SELECT COALESCE(builder_image, ''), COALESCE(run_image, ''), build_env_keys
+		FROM app_pack_settings
+		WHERE app_name = $1`, appName).Scan(&settings.BuilderImage, &settings.RunImage, &keys)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pack settings: %w", err)
+	}
+	if err := json.Unmarshal(keys, &settings.BuildEnvKeys); err != nil {
+		return nil, fmt.Errorf("failed to decode build env keys: %w", err)
+	}
+	return settings, nil
+}
+
+// SetPackSettings stores the pack settings of an app
+func (a *AppAPI) SetPackSettings(ctx context.Context, settings *PackSettings, userID *int) error {
+	if err := ValidateArgs(settings.AppName, settings.BuilderImage, settings.RunImage); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	keys, err := json.Marshal(settings.BuildEnvKeys)
+	if err != nil {
+		return err
+	}
+	_, err = Exec(ctx, `
+		INSERT INTO app_pack_settings (app_name, builder_image, run_image, build_env_keys, updated_by)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5)
+		ON CONFLICT (app_name) DO UPDATE
+		SET builder_image = EXCLUDED.builder_image, run_image = EXCLUDED.run_image,
+		    build_env_keys = EXCLUDED.build_env_keys, updated_by = EXCLUDED.updated_by`,
+		settings.AppName, settings.BuilderImage, settings.RunImage, keys, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set pack settings: %w", err)
+	}
+	return nil
+}
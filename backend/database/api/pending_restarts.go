@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PendingRestart lists the environment changes of an app saved without a restart
+type PendingRestart struct {
+	AppName      string    `json:"app_name"`
+	ChangedKeys  []string  `json:"changed_keys"`
+	RequestedBy  *int      `json:"requested_by,omitempty"`
+	PendingSince time.Time `json:"pending_since"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// MarkRestartPending records that keys of an app changed without a restart, adding them to the
+// keys already waiting
+func (a *AppAPI) MarkRestartPending(ctx context.Context, appName string, keys []string, userID *int) error {
+	if err := ValidateArgs(appName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO app_pending_restarts (app_name, changed_keys, requested_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (app_name) DO UPDATE
+		SET changed_keys = ARRAY(
+		        SELECT DISTINCT unnest(app_pending_restarts.changed_keys || EXCLUDED.changed_keys) ORDER BY 1),
+		    requested_by = EXCLUDED.requested_by`
+
+	if _, err := Exec(ctx, query, appName, keys, userID); err != nil {
+		return fmt.Errorf("failed to mark restart pending: %w", err)
+	}
+	return nil
+}
+
+// GetPendingRestart returns the pending restart of an app, or nil when none is pending
+func (a *AppAPI) GetPendingRestart(ctx context.Context, appName string) (*PendingRestart, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	pending := &PendingRestart{}
+	err := QueryRow(ctx, `
+		SELECT app_name, changed_keys, requested_by, pending_since, updated_at
+		FROM app_pending_restarts
+		WHERE app_name = $1`, appName,
+	).Scan(&pending.AppName, &pending.ChangedKeys, &pending.RequestedBy, &pending.PendingSince, &pending.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get pending restart: %w", err)
+	}
+
+	return pending, nil
+}
+
+// ClearPendingRestart forgets the pending restart of an app once it restarted
+func (a *AppAPI) ClearPendingRestart(ctx context.Context, appName string) error {
+	if err := ValidateArgs(appName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	if _, err := Exec(ctx, `DELETE FROM app_pending_restarts WHERE app_name = $1`, appName); err != nil {
+		return fmt.Errorf("failed to clear pending restart: %w", err)
+	}
+	return nil
+}
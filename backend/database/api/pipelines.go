@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrPipelineNotFound is returned for apps without a pipeline
+var ErrPipelineNotFound = errors.New("pipeline not found")
+
+// Pipeline is the deployment pipeline of an app: its builds are tested with TestCommand in a
+// one-off container before they get traffic
+type Pipeline struct {
+	AppName            string    `json:"app_name"`
+	TestCommand        string    `json:"test_command"`
+	TestTimeoutSeconds int       `json:"test_timeout_seconds"`
+	UpdatedBy          *int      `json:"updated_by,omitempty"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// DeploymentStage is a stage of a pipeline deployment with its own logs
+type DeploymentStage struct {
+	ID           int        `json:"id"`
+	DeploymentID int        `json:"deployment_id"`
+	Name         string     `json:"name"`
+	Position     int        `json:"position"`
+	Status       string     `json:"status"`
+	Logs         string     `json:"logs,omitempty"`
+	ErrorMessage *string    `json:"error_message,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// GetPipeline returns the pipeline of an app, ErrPipelineNotFound when it has none
+func (a *AppAPI) GetPipeline(ctx context.Context, appName string) (*Pipeline, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	pipeline := &Pipeline{AppName: appName}
+	err := QueryRow(ctx, `
+		SELECT test_command, test_timeout_seconds, updated_by, updated_at
+		FROM app_pipelines
+		WHERE app_name = $1`, appName).Scan(&pipeline.TestCommand, &pipeline.TestTimeoutSeconds, &pipeline.UpdatedBy, &pipeline.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPipelineNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pipeline: %w", err)
+	}
+	return pipeline, nil
+}
+
+// SetPipeline creates or replaces the pipeline of an app
+func (a *AppAPI) SetPipeline(ctx context.Context, pipeline *Pipeline, userID *int) error {
+	if err := ValidateArgs(pipeline.AppName, pipeline.TestTimeoutSeconds); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// The test command is free text checked by the caller, it is stored as is
+	_, err := Exec(ctx, `
+		INSERT INTO app_pipelines (app_name, test_command, test_timeout_seconds, updated_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (app_name) DO UPDATE
+		SET test_command = EXCLUDED.test_command, test_timeout_seconds = EXCLUDED.test_timeout_seconds,
+		    updated_by = EXCLUDED.updated_by`,
+		pipeline.AppName, []byte(pipeline.TestCommand), pipeline.TestTimeoutSeconds, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set pipeline: %w", err)
+	}
+	return nil
+}
+
+// DeletePipeline removes the pipeline of an app, its next deployments go straight to traffic
+func (a *AppAPI) DeletePipeline(ctx context.Context, appName string) error {
+	if err := ValidateArgs(appName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	tag, err := Exec(ctx, `DELETE FROM app_pipelines WHERE app_name = $1`, appName)
+	if err != nil {
+		return fmt.Errorf("failed to delete pipeline: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPipelineNotFound
+	}
+	return nil
+}
+
+// StartDeploymentStage records a stage of a deployment as running
+func (d *DeploymentAPI) StartDeploymentStage(ctx context.Context, deploymentID int, name string, position int) error {
+	if err := ValidateArgs(deploymentID, name, position); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `
+		INSERT INTO deployment_stages (deployment_id, name, position, status)
+		VALUES ($1, $2, $3, 'running')
+		ON CONFLICT (deployment_id, name) DO UPDATE
+		SET status = 'running', logs = '', error_message = NULL, started_at = CURRENT_TIMESTAMP, finished_at = NULL`,
+		deploymentID, name, position)
+	if err != nil {
+		return fmt.Errorf("failed to start deployment stage: %w", err)
+	}
+	return nil
+}
+
+// FinishDeploymentStage stores the outcome and logs of a stage of a deployment. Stages that never
+// ran are recorded as finished with their status, like skipped.
+func (d *DeploymentAPI) FinishDeploymentStage(ctx context.Context, deploymentID int, name string, position int, status, logs, errorMessage string) error {
+	if err := ValidateArgs(deploymentID, name, position, status); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// Logs and error messages are command output, they are stored as is
+	_, err := Exec(ctx, `
+		INSERT INTO deployment_stages (deployment_id, name, position, status, logs, error_message, finished_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), CURRENT_TIMESTAMP)
+		ON CONFLICT (deployment_id, name) DO UPDATE
+		SET status = EXCLUDED.status, logs = EXCLUDED.logs, error_message = EXCLUDED.error_message,
+		    finished_at = EXCLUDED.finished_at`,
+		deploymentID, name, position, status, []byte(logs), []byte(errorMessage))
+	if err != nil {
+		return fmt.Errorf("failed to finish deployment stage: %w", err)
+	}
+	return nil
+}
+
+// ListDeploymentStages lists the stages of a deployment of an app in pipeline order, with their
+// logs when withLogs is set. Deployments made without a pipeline have none.
+func (d *DeploymentAPI) ListDeploymentStages(ctx context.Context, appName string, deploymentID int, withLogs bool) ([]DeploymentStage, error) {
+	if err := ValidateArgs(appName, deploymentID); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT s.id, s.deployment_id, s.name, s.position, s.status,
+		       CASE WHEN $3 THEN s.logs ELSE '' END, s.error_message, s.started_at, s.finished_at
+		FROM deployment_stages s
+		JOIN deployment_history h ON h.id = s.deployment_id
+		WHERE h.app_name = $1 AND s.deployment_id = $2
+		ORDER BY s.position`, appName, deploymentID, withLogs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployment stages: %w", err)
+	}
+	defer rows.Close()
+
+	stages := []DeploymentStage{}
+	for rows.Next() {
+		var s DeploymentStage
+		if err := rows.Scan(&s.ID, &s.DeploymentID, &s.Name, &s.Position, &s.Status, &s.Logs, &s.ErrorMessage, &s.StartedAt, &s.FinishedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment stage: %w", err)
+		}
+		stages = append(stages, s)
+	}
+	return stages, rows.Err()
+}
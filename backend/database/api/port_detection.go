@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PortDetectionAPI provides port detection cache operations
+
+// CachedPortDetection is a stored port detection result for a repository commit
+type CachedPortDetection struct {
+	Repository string
+	CommitSHA  string
+	Port       *int
+	Source     *string
+	CreatedAt  time.Time
+}
+
+// GetCachedPort retrieves the cached detection result for a commit, returning nil when not cached
+func (p *PortDetectionAPI) GetCachedPort(ctx context.Context, repository, commitSHA string) (*CachedPortDetection, error) {
+	if err := ValidateArgs(repository, commitSHA); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		SELECT repository, commit_sha, port, source, created_at
+		FROM port_detection_cache
+		WHERE repository = $1 AND commit_sha = $2`
+
+	cached := &CachedPortDetection{}
+	err := QueryRow(ctx, query, repository, commitSHA).Scan(
+		&cached.Repository, &cached.CommitSHA, &cached.Port, &cached.Source, &cached.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get cached port: %w", err)
+	}
+
+	return cached, nil
+}
+
+// SaveCachedPort stores the detection result for a commit (port nil means no port was found)
+func (p *PortDetectionAPI) SaveCachedPort(ctx context.Context, repository, commitSHA string, port *int, source *string) error {
+	if err := ValidateArgs(repository, commitSHA); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO port_detection_cache (repository, commit_sha, port, source, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (repository, commit_sha) DO UPDATE SET
+			port = EXCLUDED.port,
+			source = EXCLUDED.source,
+			created_at = EXCLUDED.created_at`
+
+	_, err := Exec(ctx, query, repository, commitSHA, port, source, GetCurrentTimestamp())
+	if err != nil {
+		return fmt.Errorf("failed to save cached port: %w", err)
+	}
+
+	return nil
+}
+
+// PruneCachedPorts deletes cache entries created before the given time
+func (p *PortDetectionAPI) PruneCachedPorts(ctx context.Context, olderThan time.Time) (int64, error) {
+	query := `DELETE FROM port_detection_cache WHERE created_at < $1`
+	result, err := Exec(ctx, query, olderThan)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune port detection cache: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// ClearCachedPorts deletes every cached detection result
+func (p *PortDetectionAPI) ClearCachedPorts(ctx context.Context) (int64, error) {
+	result, err := Exec(ctx, `DELETE FROM port_detection_cache`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear port detection cache: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrPromotionLinkNotFound is returned for apps not linked to an app to promote to
+var ErrPromotionLinkNotFound = errors.New("promotion link not found")
+
+// PromotionLink links an app (e.g. staging) to the app its image is promoted to (e.g. production)
+type PromotionLink struct {
+	AppName   string    `json:"app_name"`
+	TargetApp string    `json:"target_app"`
+	UpdatedBy *int      `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetPromotionLink returns the app an app is promoted to, ErrPromotionLinkNotFound when it has none
+func (a *AppAPI) GetPromotionLink(ctx context.Context, appName string) (*PromotionLink, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	link := &PromotionLink{AppName: appName}
+	err := QueryRow(ctx, `
+		SELECT target_app, updated_by, updated_at
+		FROM app_promotion_links
+		WHERE app_name = $1`, appName).Scan(&link.TargetApp, &link.UpdatedBy, &link.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPromotionLinkNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get promotion link: %w", err)
+	}
+	return link, nil
+}
+
+// ListPromotionSources lists the apps promoted to an app
+func (a *AppAPI) ListPromotionSources(ctx context.Context, targetApp string) ([]string, error) {
+	if err := ValidateArgs(targetApp); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT app_name FROM app_promotion_links
+		WHERE target_app = $1
+		ORDER BY app_name`, targetApp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list promotion sources: %w", err)
+	}
+	defer rows.Close()
+
+	sources := []string{}
+	for rows.Next() {
+		var source string
+		if err := rows.Scan(&source); err != nil {
+			return nil, fmt.Errorf("failed to scan promotion source: %w", err)
+		}
+		sources = append(sources, source)
+	}
+	return sources, rows.Err()
+}
+
+// SetPromotionLink links an app to the app it is promoted to, replacing its previous link
+func (a *AppAPI) SetPromotionLink(ctx context.Context, link *PromotionLink, userID *int) error {
+	if err := ValidateArgs(link.AppName, link.TargetApp); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `
+		INSERT INTO app_promotion_links (app_name, target_app, updated_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (app_name) DO UPDATE
+		SET target_app = EXCLUDED.target_app, updated_by = EXCLUDED.updated_by`,
+		link.AppName, link.TargetApp, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set promotion link: %w", err)
+	}
+	return nil
+}
+
+// DeletePromotionLink unlinks an app from the app it is promoted to
+func (a *AppAPI) DeletePromotionLink(ctx context.Context, appName string) error {
+	if err := ValidateArgs(appName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	tag, err := Exec(ctx, `DELETE FROM app_promotion_links WHERE app_name = $1`, appName)
+	if err != nil {
+		return fmt.Errorf("failed to delete promotion link: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPromotionLinkNotFound
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrProtectedEnvKeyNotFound is returned when unprotecting an env key that isn't protected
+var ErrProtectedEnvKeyNotFound = errors.New("env key is not protected")
+
+// ProtectedEnvKey is an env key of an app only admins can change or remove
+type ProtectedEnvKey struct {
+	Key         string    `json:"key"`
+	ProtectedBy *int      `json:"protected_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ListProtectedEnvKeys lists the protected env keys of an app by key
+func (a *AppAPI) ListProtectedEnvKeys(ctx context.Context, appName string) ([]ProtectedEnvKey, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT key, protected_by, created_at
+		FROM app_protected_env_keys
+		WHERE app_name = $1
+		ORDER BY key`, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list protected env keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []ProtectedEnvKey{}
+	for rows.Next() {
+		var k ProtectedEnvKey
+		if err := rows.Scan(&k.Key, &k.ProtectedBy, &k.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan protected env key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// ProtectEnvKey protects an env key of an app, protecting it again keeps its first record
+func (a *AppAPI) ProtectEnvKey(ctx context.Context, appName, key string, userID *int) error {
+	if err := ValidateArgs(appName, key); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `
+		INSERT INTO app_protected_env_keys (app_name, key, protected_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (app_name, key) DO NOTHING`,
+		appName, key, userID)
+	if err != nil {
+		return fmt.Errorf("failed to protect env key: %w", err)
+	}
+	return nil
+}
+
+// UnprotectEnvKey lets any user change or remove an env key of an app again
+func (a *AppAPI) UnprotectEnvKey(ctx context.Context, appName, key string) error {
+	if err := ValidateArgs(appName, key); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	tag, err := Exec(ctx, `DELETE FROM app_protected_env_keys WHERE app_name = $1 AND key = $2`, appName, key)
+	if err != nil {
+		return fmt.Errorf("failed to unprotect env key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProtectedEnvKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PushFilter limits the GitHub users whose pushes auto-deploy a connected app. Teams are
+// org/team-slug names.
+type PushFilter struct {
+	AppName      string     `json:"app_name"`
+	AllowedUsers []string   `json:"allowed_users"`
+	AllowedTeams []string   `json:"allowed_teams"`
+	DeniedUsers  []string   `json:"denied_users"`
+	DeniedTeams  []string   `json:"denied_teams"`
+	UpdatedBy    *int       `json:"updated_by,omitempty"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+// IsEmpty reports whether the filter lets every push through
+func (f *PushFilter) IsEmpty() bool {
+	return len(f.AllowedUsers) == 0 && len(f.AllowedTeams) == 0 && len(f.DeniedUsers) == 0 && len(f.DeniedTeams) == 0
+}
+
+// GetPushFilter returns the push filter of a connected app, an empty filter when it has none
+func (g *GitHubAPI) GetPushFilter(ctx context.Context, appName string) (*PushFilter, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	filter := &PushFilter{AppName: appName}
+	err := QueryRow(ctx, `
+		SELECT allowed_users, allowed_teams, denied_users, denied_teams, updated_by, updated_at
+		FROM github_push_filters
+		WHERE app_name = $1`, appName,
+	).Scan(&filter.AllowedUsers, &filter.AllowedTeams, &filter.DeniedUsers, &filter.DeniedTeams,
+		&filter.UpdatedBy, &filter.UpdatedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get push filter: %w", err)
+	}
+
+	for _, list := range []*[]string{&filter.AllowedUsers, &filter.AllowedTeams, &filter.DeniedUsers, &filter.DeniedTeams} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+	return filter, nil
+}
+
+// SavePushFilter stores the push filter of a connected app, an empty filter removes it
+func (g *GitHubAPI) SavePushFilter(ctx context.Context, filter *PushFilter) error {
+	if err := ValidateArgs(filter.AppName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	if filter.IsEmpty() {
+		if _, err := Exec(ctx, `DELETE FROM github_push_filters WHERE app_name = $1`, filter.AppName); err != nil {
+			return fmt.Errorf("failed to delete push filter: %w", err)
+		}
+		return nil
+	}
+
+	query := `
+		INSERT INTO github_push_filters (app_name, allowed_users, allowed_teams, denied_users, denied_teams, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (app_name) DO UPDATE SET
+			allowed_users = EXCLUDED.allowed_users, allowed_teams = EXCLUDED.allowed_teams,
+			denied_users = EXCLUDED.denied_users, denied_teams = EXCLUDED.denied_teams,
+			updated_by = EXCLUDED.updated_by
+		RETURNING updated_at`
+
+	err := QueryRow(ctx, query, filter.AppName, filter.AllowedUsers, filter.AllowedTeams, filter.DeniedUsers,
+		filter.DeniedTeams, filter.UpdatedBy).Scan(&filter.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save push filter: %w", err)
+	}
+	return nil
+}
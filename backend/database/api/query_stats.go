@@ -0,0 +1,203 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// defaultSlowQueryThreshold is used when DB_SLOW_QUERY_MS is not set
+	defaultSlowQueryThreshold = 200 * time.Millisecond
+	// maxSlowQueries is how many of the slowest executions are kept
+	maxSlowQueries = 50
+	// maxLoggedQuery bounds the SQL kept and logged with a slow query
+	maxLoggedQuery = 500
+)
+
+// SlowQueryThreshold is the duration above which queries are logged and kept as slow queries,
+// from DB_SLOW_QUERY_MS
+var SlowQueryThreshold = slowQueryThresholdFromEnv()
+
+func slowQueryThresholdFromEnv() time.Duration {
+	if ms, err := strconv.Atoi(os.Getenv("DB_SLOW_QUERY_MS")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return defaultSlowQueryThreshold
+}
+
+// QueryStat sums up the executions of a query, named after the function running it
+type QueryStat struct {
+	Name          string        `json:"name"`
+	Count         int64         `json:"count"`
+	Errors        int64         `json:"errors"`
+	Slow          int64         `json:"slow"`
+	TotalDuration time.Duration `json:"total_duration_ns"`
+	MaxDuration   time.Duration `json:"max_duration_ns"`
+}
+
+// SlowQuery is an execution that took longer than SlowQueryThreshold
+type SlowQuery struct {
+	Name     string        `json:"name"`
+	Query    string        `json:"query"`
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+	At       time.Time     `json:"at"`
+}
+
+var queryStats = struct {
+	mu      sync.Mutex
+	byName  map[string]*QueryStat
+	slowest []SlowQuery // sorted by duration, slowest first
+}{byName: make(map[string]*QueryStat)}
+
+// QueryStats returns the stats of every query run since startup, by total duration
+func QueryStats() []QueryStat {
+	queryStats.mu.Lock()
+	defer queryStats.mu.Unlock()
+
+	stats := make([]QueryStat, 0, len(queryStats.byName))
+	for _, stat := range queryStats.byName {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].TotalDuration > stats[j].TotalDuration })
+	return stats
+}
+
+// SlowQueries returns the slowest executions since startup, slowest first
+func SlowQueries() []SlowQuery {
+	queryStats.mu.Lock()
+	defer queryStats.mu.Unlock()
+	return append([]SlowQuery(nil), queryStats.slowest...)
+}
+
+// queryName names a query after the database/api function running it, e.g.
+// "SettingsAPI.UpsertDomainCheck". skip counts the frames between the caller and queryName.
+func queryName(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "unknown"
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimPrefix(name, "api.")
+	return strings.NewReplacer("(*", "", ")", "").Replace(name)
+}
+
+// recordQuery adds an execution to the stats of its query, logging it when slow. No rows is an
+// answer, not an error.
+func recordQuery(name, query string, duration time.Duration, err error) {
+	failed := err != nil && !errors.Is(err, pgx.ErrNoRows)
+	slow := duration >= SlowQueryThreshold
+
+	queryStats.mu.Lock()
+	stat := queryStats.byName[name]
+	if stat == nil {
+		stat = &QueryStat{Name: name}
+		queryStats.byName[name] = stat
+	}
+	stat.Count++
+	stat.TotalDuration += duration
+	stat.MaxDuration = max(stat.MaxDuration, duration)
+	if failed {
+		stat.Errors++
+	}
+	if slow {
+		stat.Slow++
+	}
+	var compact string
+	if slow {
+		compact = compactQuery(query)
+		slowest := queryStats.slowest
+		if len(slowest) < maxSlowQueries || duration > slowest[len(slowest)-1].Duration {
+			entry := SlowQuery{Name: name, Query: compact, Duration: duration, At: time.Now()}
+			if failed {
+				entry.Error = err.Error()
+			}
+			i := sort.Search(len(slowest), func(i int) bool { return slowest[i].Duration < duration })
+			slowest = append(slowest[:i], append([]SlowQuery{entry}, slowest[i:]...)...)
+			if len(slowest) > maxSlowQueries {
+				slowest = slowest[:maxSlowQueries]
+			}
+			queryStats.slowest = slowest
+		}
+	}
+	queryStats.mu.Unlock()
+
+	if slow {
+		log.Printf("[DB] Slow query %s took %s: %s", name, duration.Round(time.Millisecond), compact)
+	}
+}
+
+// compactQuery collapses the whitespace of a query and bounds its length
+func compactQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > maxLoggedQuery {
+		query = query[:maxLoggedQuery] + "..."
+	}
+	return query
+}
+
+// timedRow records a QueryRow once it is scanned, when the row has actually been read
+type timedRow struct {
+	row   pgx.Row
+	name  string
+	query string
+	start time.Time
+	// replica is the read replica the row comes from, nil for the primary
+	replica *replica
+}
+
+func (r *timedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	recordQuery(r.name, r.query, time.Since(r.start), err)
+	noteQueryError(r.replica, err)
+	return err
+}
+
+// timedRows records a Query once its rows are closed, after the caller read them
+type timedRows struct {
+	pgx.Rows
+	name     string
+	query    string
+	start    time.Time
+	replica  *replica
+	recorded bool
+}
+
+func (r *timedRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	// Rows close themselves once read, callers may not close them again
+	r.record()
+	return false
+}
+
+func (r *timedRows) Close() {
+	r.Rows.Close()
+	r.record()
+}
+
+func (r *timedRows) record() {
+	if r.recorded {
+		return
+	}
+	r.recorded = true
+	recordQuery(r.name, r.query, time.Since(r.start), r.Rows.Err())
+	noteQueryError(r.replica, r.Rows.Err())
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrReleaseNameTaken is returned when another release of the app already has a name
+var ErrReleaseNameTaken = errors.New("release name already used by another release of the app")
+
+// ReleaseFilter narrows the releases of an app, empty fields don't filter
+type ReleaseFilter struct {
+	Status string
+	Branch string
+	// Tag keeps the deployments of a tag, * those of any tag
+	Tag string
+}
+
+// ListReleases lists the deployments of an app matching a filter, newest first, with the number
+// of matching deployments. Logs are only read when withLogs is set.
+func (d *DeploymentAPI) ListReleases(ctx context.Context, appName string, filter ReleaseFilter, limit, offset int, withLogs bool) ([]DeploymentRecord, int, error) {
+	if err := ValidateArgs(appName, filter.Status, filter.Branch, filter.Tag, limit, offset); err != nil {
+		return nil, 0, fmt.Errorf("validation failed: %w", err)
+	}
+
+	where := `app_name = $1 AND ($2 = '' OR status = $2) AND ($3 = '' OR git_branch = $3)
+		AND ($4 = '' OR git_tag = $4 OR ($4 = '*' AND git_tag IS NOT NULL))`
+
+	var total int
+	if err := ReadQueryRow(ctx, `SELECT COUNT(*) FROM deployment_history WHERE `+where,
+		appName, filter.Status, filter.Branch, filter.Tag).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count releases: %w", err)
+	}
+
+	logs := `''`
+	if withLogs {
+		logs = `COALESCE(logs, '')`
+	}
+	query := `
+		SELECT id, app_name, activity_id, COALESCE(git_url, ''), COALESCE(git_branch, ''), COALESCE(git_commit, ''), COALESCE(git_tag, ''),
+		       COALESCE(image_id, ''), COALESCE(image_size, 0), COALESCE(builder_image, ''), COALESCE(dockerfile_path, ''),
+		       COALESCE(source_app, ''), COALESCE(source_image, ''), COALESCE(source_archive, ''), source_deployment_id, retry_of_id, COALESCE(release_number, 0), COALESCE(release_name, ''),
+		       status, COALESCE(trigger_type, 'manual'), user_id, ` + logs + `, error_message, started_at, finished_at, duration_ms
+		FROM deployment_history
+		WHERE ` + where + `
+		ORDER BY started_at DESC, id DESC
+		LIMIT $5 OFFSET $6`
+
+	rows, err := ReadQuery(ctx, query, appName, filter.Status, filter.Branch, filter.Tag, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list releases: %w", err)
+	}
+	defer rows.Close()
+
+	records := []DeploymentRecord{}
+	for rows.Next() {
+		var record DeploymentRecord
+		if err := rows.Scan(
+			&record.ID, &record.AppName, &record.ActivityID, &record.GitURL, &record.GitBranch, &record.GitCommit, &record.GitTag, &record.ImageID, &record.ImageSize,
+			&record.BuilderImage, &record.DockerfilePath,
+			&record.SourceApp, &record.SourceImage, &record.SourceArchive, &record.SourceDeploymentID, &record.RetryOfID, &record.ReleaseNumber, &record.ReleaseName,
+			&record.Status, &record.TriggerType, &record.UserID, &record.Logs, &record.ErrorMessage,
+			&record.StartedAt, &record.FinishedAt, &record.DurationMs,
+		); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan release: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, total, rows.Err()
+}
+
+// ReleaseLabel is how a deployment is referenced as a release, "v42" or "v42 (spring-launch)"
+func (r *DeploymentRecord) ReleaseLabel() string {
+	if r.ReleaseNumber == 0 {
+		return fmt.Sprintf("deployment %d", r.ID)
+	}
+	if r.ReleaseName != "" {
+		return fmt.Sprintf("v%d (%s)", r.ReleaseNumber, r.ReleaseName)
+	}
+	return fmt.Sprintf("v%d", r.ReleaseNumber)
+}
+
+// FindRelease returns the deployment of an app by release, a number ("42" or "v42"), a release
+// name or a git tag (the last deployment of the tag), without its logs
+func (d *DeploymentAPI) FindRelease(ctx context.Context, appName, release string) (*DeploymentRecord, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	// A release that reads as a number matches that number first, then a release name, then a tag
+	number, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(release), "v"))
+	if err != nil || number < 1 {
+		number = 0
+	}
+
+	var id int
+	err = ReadQueryRow(ctx, `
+		SELECT id FROM deployment_history
+		WHERE app_name = $1 AND (release_number = $2 OR release_name = $3 OR git_tag = $3)
+		ORDER BY (release_number = $2) DESC, (release_name = $3) DESC, started_at DESC, id DESC
+		LIMIT 1`, appName, number, []byte(release)).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeploymentRecordNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find release: %w", err)
+	}
+
+	record, err := d.GetDeploymentRecord(ctx, appName, id)
+	if err != nil {
+		return nil, err
+	}
+	record.Logs = ""
+	return record, nil
+}
+
+// SetReleaseName names the release of a deployment, an empty name removes it
+func (d *DeploymentAPI) SetReleaseName(ctx context.Context, appName string, id int, name string) error {
+	if err := ValidateArgs(appName, id); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// Names are free text, pass them as bytes so they skip argument validation
+	var nameBytes []byte
+	if name != "" {
+		nameBytes = []byte(name)
+	}
+	result, err := Exec(ctx, `UPDATE deployment_history SET release_name = $3 WHERE app_name = $1 AND id = $2`,
+		appName, id, nameBytes)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrReleaseNameTaken
+		}
+		return fmt.Errorf("failed to set release name: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrDeploymentRecordNotFound
+	}
+	return nil
+}
+
+// ListTaggedReleases lists the successful deployments of tags of an app, newest first, without
+// their logs
+func (d *DeploymentAPI) ListTaggedReleases(ctx context.Context, appName string, limit int) ([]DeploymentRecord, error) {
+	records, _, err := d.ListReleases(ctx, appName, ReleaseFilter{Status: "success", Tag: "*"}, limit, 0, false)
+	return records, err
+}
@@ -0,0 +1,349 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// replicaDownTime is how long a replica gets no reads after a connection error, until the
+	// next check finds it healthy again
+	replicaDownTime = 30 * time.Second
+	// defaultReplicaMaxLag is the replication lag past which reads go to the primary, when
+	// DB_REPLICA_MAX_LAG is unset
+	defaultReplicaMaxLag = 30 * time.Second
+	// maxPrimaryResetBackoff bounds the wait between two resets of the primary pool
+	maxPrimaryResetBackoff = 30 * time.Second
+)
+
+// ReplicaStatus describes a read replica for the health and stats endpoints
+type ReplicaStatus struct {
+	Name          string     `json:"name"`
+	Healthy       bool       `json:"healthy"`
+	LagSeconds    float64    `json:"lag_seconds"`
+	Error         string     `json:"error,omitempty"`
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+	Reads         int64      `json:"reads"`
+	Fallbacks     int64      `json:"fallbacks"`
+	TotalConns    int32      `json:"total_conns"`
+	IdleConns     int32      `json:"idle_conns"`
+}
+
+// replica is a read replica pool with the health its reads go by
+type replica struct {
+	name string
+	pool *pgxpool.Pool
+
+	mu          sync.Mutex
+	downUntil   time.Time
+	lag         time.Duration
+	lastErr     string
+	lastChecked time.Time
+
+	reads     atomic.Int64
+	fallbacks atomic.Int64
+}
+
+func (r *replica) healthy() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Now().After(r.downUntil)
+}
+
+// markDown stops reads from the replica for replicaDownTime
+func (r *replica) markDown(err error) {
+	r.mu.Lock()
+	wasUp := time.Now().After(r.downUntil)
+	r.downUntil = time.Now().Add(replicaDownTime)
+	r.lastErr = err.Error()
+	r.mu.Unlock()
+	if wasUp {
+		log.Printf("[DB] Read replica %s marked down, reads go to the primary: %v", r.name, err)
+	}
+}
+
+var (
+	replicas    []*replica
+	nextReplica atomic.Uint64
+)
+
+// InitReplicas sets the read replica pools heavy reads are spread over, by name
+func InitReplicas(pools map[string]*pgxpool.Pool) {
+	replicas = nil
+	for name, pool := range pools {
+		replicas = append(replicas, &replica{name: name, pool: pool})
+	}
+}
+
+// ReplicaMaxLag returns the replication lag past which a replica gets no reads, from
+// DB_REPLICA_MAX_LAG
+func ReplicaMaxLag() time.Duration {
+	if lag, err := time.ParseDuration(os.Getenv("DB_REPLICA_MAX_LAG")); err == nil && lag > 0 {
+		return lag
+	}
+	return defaultReplicaMaxLag
+}
+
+// pickReplica returns the next healthy replica in turn, nil when reads should go to the primary
+func pickReplica() *replica {
+	for range replicas {
+		r := replicas[nextReplica.Add(1)%uint64(len(replicas))]
+		if r.healthy() {
+			return r
+		}
+	}
+	return nil
+}
+
+// ReadQuery runs a heavy read on a healthy read replica, on the primary when there is none or the
+// replica fails to answer. Rows read from a replica may lag the primary by up to
+// DB_REPLICA_MAX_LAG: writes followed by reads of what was written keep using Query.
+func ReadQuery(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error) {
+	if err := ValidateArgs(args...); err != nil {
+		return nil, fmt.Errorf("argument validation failed: %w", err)
+	}
+
+	name := queryName(1)
+	if r := pickReplica(); r != nil {
+		start := time.Now()
+		rows, err := r.pool.Query(ctx, query, args...)
+		if err == nil {
+			r.reads.Add(1)
+			return &timedRows{Rows: rows, name: name, query: query, start: start, replica: r}, nil
+		}
+		recordQuery(name, query, time.Since(start), err)
+		if !isConnectionError(err) {
+			return nil, err
+		}
+		r.markDown(err)
+		r.fallbacks.Add(1)
+	}
+
+	if DB == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+	start := time.Now()
+	rows, err := DB.Query(ctx, query, args...)
+	if err != nil {
+		recordQuery(name, query, time.Since(start), err)
+		notePrimaryError(err)
+		return nil, err
+	}
+	return &timedRows{Rows: rows, name: name, query: query, start: start}, nil
+}
+
+// ReadQueryRow is ReadQuery for a single row. A replica failing to answer is only known once the
+// row is scanned, the scan then runs the query on the primary.
+func ReadQueryRow(ctx context.Context, query string, args ...interface{}) pgx.Row {
+	if err := ValidateArgs(args...); err != nil {
+		log.Printf("ReadQueryRow argument validation warning: %v", err)
+	}
+
+	name := queryName(1)
+	if r := pickReplica(); r != nil {
+		r.reads.Add(1)
+		return &replicaRow{
+			timedRow: timedRow{row: r.pool.QueryRow(ctx, query, args...), name: name, query: query, start: time.Now(), replica: r},
+			ctx:      ctx,
+			args:     args,
+		}
+	}
+	if DB == nil {
+		return &errorRow{err: errors.New("database connection not initialized")}
+	}
+	return &timedRow{row: DB.QueryRow(ctx, query, args...), name: name, query: query, start: time.Now()}
+}
+
+// replicaRow is a row read from a replica, read again from the primary when the replica fails
+type replicaRow struct {
+	timedRow
+	ctx  context.Context
+	args []interface{}
+}
+
+func (r *replicaRow) Scan(dest ...interface{}) error {
+	err := r.timedRow.Scan(dest...)
+	if !isConnectionError(err) || DB == nil {
+		return err
+	}
+	r.replica.fallbacks.Add(1)
+	start := time.Now()
+	row := &timedRow{row: DB.QueryRow(r.ctx, r.query, r.args...), name: r.name, query: r.query, start: start}
+	return row.Scan(dest...)
+}
+
+// noteQueryError sends the connection errors of a query to the health of the pool it ran on
+func noteQueryError(r *replica, err error) {
+	if r != nil {
+		if isConnectionError(err) {
+			r.markDown(err)
+		}
+		return
+	}
+	notePrimaryError(err)
+}
+
+// CheckReplicas pings every replica and measures its replication lag, reads go back to replicas
+// that answer within the lag limit. The primary pool's reset backoff is cleared when it answers.
+func CheckReplicas(ctx context.Context) error {
+	if DB != nil {
+		if err := DB.Ping(ctx); err == nil {
+			primaryReset.mu.Lock()
+			primaryReset.backoff = 0
+			primaryReset.mu.Unlock()
+		}
+	}
+
+	maxLag := ReplicaMaxLag()
+	var failures []string
+	for _, r := range replicas {
+		lag, err := replicaLag(ctx, r.pool)
+		if err == nil && lag > maxLag {
+			err = fmt.Errorf("replication lag %s is over %s", lag.Round(time.Second), maxLag)
+		}
+
+		r.mu.Lock()
+		r.lastChecked = time.Now()
+		r.lag = lag
+		if err != nil {
+			r.lastErr = err.Error()
+		} else {
+			if time.Now().Before(r.downUntil) {
+				log.Printf("[DB] Read replica %s is healthy again", r.name)
+			}
+			r.downUntil = time.Time{}
+			r.lastErr = ""
+		}
+		r.mu.Unlock()
+
+		if err != nil {
+			r.markDown(err)
+			failures = append(failures, r.name+": "+err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("read replicas unavailable: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// replicaLag returns how far behind the primary a replica is. A replica that replayed all it
+// received is caught up, however old its last replayed transaction.
+func replicaLag(ctx context.Context, pool *pgxpool.Pool) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var seconds float64
+	err := pool.QueryRow(ctx, `
+		SELECT CASE
+			WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END::float8`).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// ReplicaStatuses returns the health and usage of every read replica
+func ReplicaStatuses() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, 0, len(replicas))
+	for _, r := range replicas {
+		r.mu.Lock()
+		status := ReplicaStatus{
+			Name:       r.name,
+			Healthy:    time.Now().After(r.downUntil),
+			LagSeconds: r.lag.Seconds(),
+			Error:      r.lastErr,
+		}
+		if !r.lastChecked.IsZero() {
+			checked := r.lastChecked
+			status.LastCheckedAt = &checked
+		}
+		r.mu.Unlock()
+
+		status.Reads = r.reads.Load()
+		status.Fallbacks = r.fallbacks.Load()
+		stat := r.pool.Stat()
+		status.TotalConns = stat.TotalConns()
+		status.IdleConns = stat.IdleConns()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// CloseReplicas closes the read replica pools
+func CloseReplicas() {
+	for _, r := range replicas {
+		r.pool.Close()
+	}
+	replicas = nil
+}
+
+// primaryReset spaces out the resets of the primary pool while its host fails over
+var primaryReset struct {
+	mu      sync.Mutex
+	last    time.Time
+	backoff time.Duration
+}
+
+// notePrimaryError resets the primary pool when a query shows its connections point to a server
+// that went away or no longer accepts writes, so new connections reach the promoted primary.
+// Resets back off from one second up to maxPrimaryResetBackoff while the errors go on.
+func notePrimaryError(err error) {
+	if DB == nil || !isFailoverError(err) {
+		return
+	}
+
+	primaryReset.mu.Lock()
+	if time.Since(primaryReset.last) < primaryReset.backoff {
+		primaryReset.mu.Unlock()
+		return
+	}
+	primaryReset.last = time.Now()
+	primaryReset.backoff = min(max(2*primaryReset.backoff, time.Second), maxPrimaryResetBackoff)
+	backoff := primaryReset.backoff
+	primaryReset.mu.Unlock()
+
+	log.Printf("[DB] Primary connection lost or read-only (%v), reconnecting, next reset in at least %s", err, backoff)
+	DB.Reset()
+}
+
+// isFailoverError reports errors showing the primary failed over: lost connections, and writes
+// refused by a server that became a replica
+func isFailoverError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "25006" { // read_only_sql_transaction
+		return true
+	}
+	return isConnectionError(err)
+}
+
+// isConnectionError reports errors of the connection to the server rather than of the query
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, pgx.ErrNoRows) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// connection_exception class, and the server shutting down or still starting
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || pgconn.SafeToRetry(err)
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Statuses of a scheduled deployment
+const (
+	ScheduledDeploymentScheduled = "scheduled"
+	ScheduledDeploymentRunning   = "running"
+	ScheduledDeploymentSuccess   = "success"
+	ScheduledDeploymentError     = "error"
+	ScheduledDeploymentCancelled = "cancelled"
+)
+
+var (
+	// ErrScheduledDeploymentNotFound is returned when a scheduled deployment does not exist for an app
+	ErrScheduledDeploymentNotFound = errors.New("scheduled deployment not found")
+	// ErrScheduledDeploymentStarted is returned when cancelling a scheduled deployment that already started
+	ErrScheduledDeploymentStarted = errors.New("scheduled deployment already started or cancelled")
+)
+
+// ScheduledDeployment is a deployment of a git source planned for a later time
+type ScheduledDeployment struct {
+	ID           int        `json:"id"`
+	AppName      string     `json:"app_name"`
+	GitURL       string     `json:"git_url"`
+	GitBranch    string     `json:"git_branch"`
+	GitCommit    string     `json:"git_commit,omitempty"`
+	ScheduledAt  time.Time  `json:"scheduled_at"`
+	Status       string     `json:"status"`
+	DeploymentID *int       `json:"deployment_id,omitempty"`
+	ErrorMessage *string    `json:"error_message,omitempty"`
+	CreatedBy    *int       `json:"created_by,omitempty"`
+	CancelledBy  *int       `json:"cancelled_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+const scheduledDeploymentColumns = `id, app_name, git_url, git_branch, COALESCE(git_commit, ''), scheduled_at, status,
+	deployment_id, error_message, created_by, cancelled_by, created_at, started_at, finished_at`
+
+// scanScheduledDeployment reads a row of scheduledDeploymentColumns
+func scanScheduledDeployment(row pgx.Row) (*ScheduledDeployment, error) {
+	var s ScheduledDeployment
+	err := row.Scan(&s.ID, &s.AppName, &s.GitURL, &s.GitBranch, &s.GitCommit, &s.ScheduledAt, &s.Status,
+		&s.DeploymentID, &s.ErrorMessage, &s.CreatedBy, &s.CancelledBy, &s.CreatedAt, &s.StartedAt, &s.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// CreateScheduledDeployment schedules a deployment and sets its ID and creation time
+func (d *DeploymentAPI) CreateScheduledDeployment(ctx context.Context, s *ScheduledDeployment) error {
+	if err := ValidateArgs(s.AppName, s.GitURL, s.GitBranch, s.GitCommit); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	s.Status = ScheduledDeploymentScheduled
+	err := QueryRow(ctx, `
+		INSERT INTO scheduled_deployments (app_name, git_url, git_branch, git_commit, scheduled_at, created_by)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+		RETURNING id, created_at`,
+		s.AppName, s.GitURL, s.GitBranch, s.GitCommit, s.ScheduledAt, s.CreatedBy,
+	).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create scheduled deployment: %w", err)
+	}
+	return nil
+}
+
+// ListScheduledDeployments lists the scheduled deployments of an app, next first. Only those still
+// waiting are listed unless all is set.
+func (d *DeploymentAPI) ListScheduledDeployments(ctx context.Context, appName string, all bool) ([]ScheduledDeployment, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := ReadQuery(ctx, `
+		SELECT `+scheduledDeploymentColumns+`
+		FROM scheduled_deployments
+		WHERE app_name = $1 AND ($2 OR status = 'scheduled')
+		ORDER BY scheduled_at DESC, id DESC
+		LIMIT 100`, appName, all)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled deployments: %w", err)
+	}
+	defer rows.Close()
+
+	scheduled := []ScheduledDeployment{}
+	for rows.Next() {
+		s, err := scanScheduledDeployment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled deployment: %w", err)
+		}
+		scheduled = append(scheduled, *s)
+	}
+	return scheduled, rows.Err()
+}
+
+// GetScheduledDeployment retrieves a scheduled deployment of an app
+func (d *DeploymentAPI) GetScheduledDeployment(ctx context.Context, appName string, id int) (*ScheduledDeployment, error) {
+	if err := ValidateArgs(appName, id); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	s, err := scanScheduledDeployment(ReadQueryRow(ctx, `
+		SELECT `+scheduledDeploymentColumns+`
+		FROM scheduled_deployments
+		WHERE app_name = $1 AND id = $2`, appName, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrScheduledDeploymentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled deployment: %w", err)
+	}
+	return s, nil
+}
+
+// CancelScheduledDeployment cancels a scheduled deployment of an app that hasn't started yet
+func (d *DeploymentAPI) CancelScheduledDeployment(ctx context.Context, appName string, id int, userID *int) error {
+	if err := ValidateArgs(appName, id); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	tag, err := Exec(ctx, `
+		UPDATE scheduled_deployments
+		SET status = 'cancelled', cancelled_by = $3, finished_at = NOW()
+		WHERE app_name = $1 AND id = $2 AND status = 'scheduled'`, appName, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel scheduled deployment: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := d.GetScheduledDeployment(ctx, appName, id); err != nil {
+			return err
+		}
+		return ErrScheduledDeploymentStarted
+	}
+	return nil
+}
+
+// ClaimDueScheduledDeployments marks the scheduled deployments whose time has come as running and
+// returns them, so each one is started once even with several instances polling
+func (d *DeploymentAPI) ClaimDueScheduledDeployments(ctx context.Context, now time.Time) ([]ScheduledDeployment, error) {
+	rows, err := Query(ctx, `
+		UPDATE scheduled_deployments
+		SET status = 'running', started_at = NOW()
+		WHERE id IN (
+			SELECT id FROM scheduled_deployments
+			WHERE status = 'scheduled' AND scheduled_at <= $1
+			ORDER BY scheduled_at
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+scheduledDeploymentColumns, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim scheduled deployments: %w", err)
+	}
+	defer rows.Close()
+
+	due := []ScheduledDeployment{}
+	for rows.Next() {
+		s, err := scanScheduledDeployment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled deployment: %w", err)
+		}
+		due = append(due, *s)
+	}
+	return due, rows.Err()
+}
+
+// FinishScheduledDeployment records the outcome of a scheduled deployment and the deployment it
+// started, nil when none was recorded
+func (d *DeploymentAPI) FinishScheduledDeployment(ctx context.Context, id int, status string, deploymentID *int, errorMessage string) error {
+	_, err := Exec(ctx, `
+		UPDATE scheduled_deployments
+		SET status = $2, deployment_id = $3, error_message = NULLIF($4, ''), finished_at = NOW()
+		WHERE id = $1`, id, status, deploymentID, []byte(errorMessage))
+	if err != nil {
+		return fmt.Errorf("failed to finish scheduled deployment: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,502 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrSCIMConflict is returned when a provisioned user or group clashes with an existing one
+	ErrSCIMConflict = errors.New("a user or group with the same name already exists")
+	// ErrSCIMGroupNotFound is returned for unknown or removed SCIM groups
+	ErrSCIMGroupNotFound = errors.New("group not found")
+)
+
+// SCIMUser is a user as the identity provider sees it over SCIM
+type SCIMUser struct {
+	ID         int
+	Username   string
+	Email      string
+	Active     bool
+	Managed    bool
+	ExternalID string
+	Groups     []SCIMGroupRef
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// SCIMGroupRef is a group a user belongs to
+type SCIMGroupRef struct {
+	ID          int
+	DisplayName string
+}
+
+// SCIMGroup is a group pushed by the identity provider, with its members
+type SCIMGroup struct {
+	ID          int
+	DisplayName string
+	ExternalID  string
+	Members     []SCIMMember
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// SCIMMember is a user in a SCIM group
+type SCIMMember struct {
+	UserID   int
+	Username string
+}
+
+// SCIMFilter narrows SCIM listings to one attribute value, empty fields match everything
+type SCIMFilter struct {
+	Username    string
+	Email       string
+	DisplayName string
+	ExternalID  string
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+const scimUserColumns = `id, username, COALESCE(email, ''), active, scim_managed, COALESCE(scim_external_id, ''),
+	created_at, updated_at`
+
+// ListSCIMUsers lists the users not deleted over SCIM matching a filter, by ID, with the total count
+func (u *UserAPI) ListSCIMUsers(ctx context.Context, filter SCIMFilter, offset, limit int) ([]SCIMUser, int, error) {
+	// Filter values come from the identity provider, they are compared as is
+	where := `scim_deleted_at IS NULL
+		AND ($1 = '' OR LOWER(username) = LOWER($1))
+		AND ($2 = '' OR LOWER(email) = LOWER($2))
+		AND ($3 = '' OR scim_external_id = $3)`
+	args := []interface{}{[]byte(filter.Username), []byte(filter.Email), []byte(filter.ExternalID)}
+
+	var total int
+	if err := QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT `+scimUserColumns+`
+		FROM users WHERE `+where+`
+		ORDER BY id
+		OFFSET $4 LIMIT $5`, append(args, offset, limit)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []SCIMUser{}
+	for rows.Next() {
+		var user SCIMUser
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Active, &user.Managed, &user.ExternalID,
+			&user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	for i := range users {
+		if users[i].Groups, err = u.ListSCIMUserGroups(ctx, users[i].ID); err != nil {
+			return nil, 0, err
+		}
+	}
+	return users, total, nil
+}
+
+// GetSCIMUser returns a user not deleted over SCIM, ErrUserNotFound otherwise
+func (u *UserAPI) GetSCIMUser(ctx context.Context, id int) (*SCIMUser, error) {
+	var user SCIMUser
+	err := QueryRow(ctx, `
+		SELECT `+scimUserColumns+`
+		FROM users WHERE id = $1 AND scim_deleted_at IS NULL`, id).
+		Scan(&user.ID, &user.Username, &user.Email, &user.Active, &user.Managed, &user.ExternalID,
+			&user.CreatedAt, &user.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.Groups, err = u.ListSCIMUserGroups(ctx, id); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListSCIMUserGroups lists the SCIM groups of a user by name
+func (u *UserAPI) ListSCIMUserGroups(ctx context.Context, userID int) ([]SCIMGroupRef, error) {
+	rows, err := Query(ctx, `
+		SELECT g.id, g.display_name
+		FROM scim_group_members m
+		JOIN scim_groups g ON g.id = m.group_id
+		WHERE m.user_id = $1
+		ORDER BY g.display_name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []SCIMGroupRef{}
+	for rows.Next() {
+		var group SCIMGroupRef
+		if err := rows.Scan(&group.ID, &group.DisplayName); err != nil {
+			return nil, fmt.Errorf("failed to scan user group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// CreateSCIMUser creates a user provisioned over SCIM and sets its ID and timestamps
+func (u *UserAPI) CreateSCIMUser(ctx context.Context, user *SCIMUser, passwordHash string) error {
+	if err := ValidateArgs(user.Username); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	user.Managed = true
+	user.Groups = []SCIMGroupRef{}
+
+	// A user deleted over SCIM and provisioned again gets its account back
+	err := QueryRow(ctx, `
+		UPDATE users
+		SET password = $2, email = NULLIF($3, ''), active = $4, scim_external_id = NULLIF($5, ''),
+		    scim_deleted_at = NULL
+		WHERE username = $1 AND scim_deleted_at IS NOT NULL
+		RETURNING id, created_at, updated_at`,
+		user.Username, passwordHash, []byte(user.Email), user.Active, []byte(user.ExternalID),
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		if isUniqueViolation(err) {
+			return ErrSCIMConflict
+		}
+		return fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	err = QueryRow(ctx, `
+		INSERT INTO users (username, password, email, active, scim_managed, scim_external_id)
+		VALUES ($1, $2, NULLIF($3, ''), $4, true, NULLIF($5, ''))
+		RETURNING id, created_at, updated_at`,
+		user.Username, passwordHash, []byte(user.Email), user.Active, []byte(user.ExternalID),
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrSCIMConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	return nil
+}
+
+// UpdateSCIMUser stores the name, email, status and external ID of a user, which SCIM manages
+// from then on
+func (u *UserAPI) UpdateSCIMUser(ctx context.Context, user *SCIMUser) error {
+	if err := ValidateArgs(user.Username); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	tag, err := Exec(ctx, `
+		UPDATE users
+		SET username = $2, email = NULLIF($3, ''), active = $4, scim_managed = true,
+		    scim_external_id = NULLIF($5, '')
+		WHERE id = $1 AND scim_deleted_at IS NULL`,
+		user.ID, user.Username, []byte(user.Email), user.Active, []byte(user.ExternalID))
+	if isUniqueViolation(err) {
+		return ErrSCIMConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	user.Managed = true
+	return nil
+}
+
+// DeleteSCIMUser deactivates a user deleted over SCIM, hides it from SCIM and removes it from
+// its groups
+func (u *UserAPI) DeleteSCIMUser(ctx context.Context, id int) error {
+	return Transaction(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE users SET active = false, scim_managed = true, scim_deleted_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND scim_deleted_at IS NULL`, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrUserNotFound
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM scim_group_members WHERE user_id = $1`, id); err != nil {
+			return fmt.Errorf("failed to delete user group memberships: %w", err)
+		}
+		return nil
+	})
+}
+
+// IsUserActive reports whether a user can sign in
+func (u *UserAPI) IsUserActive(ctx context.Context, userID int) (bool, error) {
+	var active bool
+	err := QueryRow(ctx, `SELECT active FROM users WHERE id = $1`, userID).Scan(&active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrUserNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check user status: %w", err)
+	}
+	return active, nil
+}
+
+// ListInactiveUserIDs lists the users that can't sign in
+func (u *UserAPI) ListInactiveUserIDs(ctx context.Context) ([]int, error) {
+	rows, err := Query(ctx, `SELECT id FROM users WHERE NOT active`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inactive users: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan inactive user: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ListSCIMManagedUserIDs lists the users SCIM manages
+func (u *UserAPI) ListSCIMManagedUserIDs(ctx context.Context) ([]int, error) {
+	rows, err := Query(ctx, `SELECT id FROM users WHERE scim_managed AND scim_deleted_at IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list managed users: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan managed user: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SetSCIMRoles sets the admin flag and team a SCIM managed user gets from its groups, nil leaves
+// them as they are. Users SCIM doesn't manage are left alone.
+func (u *UserAPI) SetSCIMRoles(ctx context.Context, userID int, isAdmin *bool, team *string) error {
+	if team != nil {
+		if err := ValidateArgs(*team); err != nil {
+			return fmt.Errorf("validation failed: %w", err)
+		}
+	}
+
+	_, err := Exec(ctx, `
+		UPDATE users
+		SET is_admin = COALESCE($2, is_admin),
+		    team = CASE WHEN $3::text IS NULL THEN team ELSE NULLIF($3, '') END
+		WHERE id = $1 AND scim_managed`, userID, isAdmin, team)
+	if err != nil {
+		return fmt.Errorf("failed to set user roles: %w", err)
+	}
+	return nil
+}
+
+const scimGroupColumns = `id, display_name, COALESCE(external_id, ''), created_at, updated_at`
+
+// ListSCIMGroups lists the SCIM groups matching a filter by ID, with their members unless
+// withMembers is false, and the total count
+func (u *UserAPI) ListSCIMGroups(ctx context.Context, filter SCIMFilter, offset, limit int, withMembers bool) ([]SCIMGroup, int, error) {
+	// Filter values come from the identity provider, they are compared as is
+	where := `($1 = '' OR LOWER(display_name) = LOWER($1)) AND ($2 = '' OR external_id = $2)`
+	args := []interface{}{[]byte(filter.DisplayName), []byte(filter.ExternalID)}
+
+	var total int
+	if err := QueryRow(ctx, `SELECT COUNT(*) FROM scim_groups WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count groups: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT `+scimGroupColumns+`
+		FROM scim_groups WHERE `+where+`
+		ORDER BY id
+		OFFSET $3 LIMIT $4`, append(args, offset, limit)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []SCIMGroup{}
+	for rows.Next() {
+		var group SCIMGroup
+		if err := rows.Scan(&group.ID, &group.DisplayName, &group.ExternalID, &group.CreatedAt, &group.UpdatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if withMembers {
+		for i := range groups {
+			if groups[i].Members, err = u.listSCIMGroupMembers(ctx, groups[i].ID); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return groups, total, nil
+}
+
+// GetSCIMGroup returns a SCIM group with its members, ErrSCIMGroupNotFound when it doesn't exist
+func (u *UserAPI) GetSCIMGroup(ctx context.Context, id int) (*SCIMGroup, error) {
+	var group SCIMGroup
+	err := QueryRow(ctx, `SELECT `+scimGroupColumns+` FROM scim_groups WHERE id = $1`, id).
+		Scan(&group.ID, &group.DisplayName, &group.ExternalID, &group.CreatedAt, &group.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSCIMGroupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
+	if group.Members, err = u.listSCIMGroupMembers(ctx, id); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (u *UserAPI) listSCIMGroupMembers(ctx context.Context, groupID int) ([]SCIMMember, error) {
+	rows, err := Query(ctx, `
+		SELECT u.id, u.username
+		FROM scim_group_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = $1
+		ORDER BY u.id`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []SCIMMember{}
+	for rows.Next() {
+		var member SCIMMember
+		if err := rows.Scan(&member.UserID, &member.Username); err != nil {
+			return nil, fmt.Errorf("failed to scan group member: %w", err)
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// SaveSCIMGroup creates a SCIM group, or updates it when its ID is set, with exactly the given
+// members. It returns the users whose membership changed.
+func (u *UserAPI) SaveSCIMGroup(ctx context.Context, group *SCIMGroup, memberIDs []int) ([]int, error) {
+	if memberIDs == nil {
+		memberIDs = []int{}
+	}
+
+	var changed []int
+	err := Transaction(ctx, func(tx pgx.Tx) error {
+		if group.ID == 0 {
+			err := tx.QueryRow(ctx, `
+				INSERT INTO scim_groups (display_name, external_id)
+				VALUES ($1, NULLIF($2, ''))
+				RETURNING id`, []byte(group.DisplayName), []byte(group.ExternalID)).Scan(&group.ID)
+			if err != nil {
+				return err
+			}
+		} else {
+			tag, err := tx.Exec(ctx, `
+				UPDATE scim_groups SET display_name = $2, external_id = NULLIF($3, '')
+				WHERE id = $1`, group.ID, []byte(group.DisplayName), []byte(group.ExternalID))
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				return ErrSCIMGroupNotFound
+			}
+		}
+
+		// Members are replaced, the users removed and added are those whose roles may change
+		rows, err := tx.Query(ctx, `
+			DELETE FROM scim_group_members WHERE group_id = $1 AND NOT (user_id = ANY($2))
+			RETURNING user_id`, group.ID, memberIDs)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			changed = append(changed, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		rows, err = tx.Query(ctx, `
+			INSERT INTO scim_group_members (group_id, user_id)
+			SELECT $1, id FROM users WHERE id = ANY($2) AND scim_deleted_at IS NULL
+			ON CONFLICT DO NOTHING
+			RETURNING user_id`, group.ID, memberIDs)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			changed = append(changed, id)
+		}
+		return rows.Err()
+	})
+	if isUniqueViolation(err) {
+		return nil, ErrSCIMConflict
+	}
+	if err != nil && !errors.Is(err, ErrSCIMGroupNotFound) {
+		return nil, fmt.Errorf("failed to save group: %w", err)
+	}
+	return changed, err
+}
+
+// DeleteSCIMGroup removes a SCIM group and returns its members
+func (u *UserAPI) DeleteSCIMGroup(ctx context.Context, id int) ([]int, error) {
+	group, err := u.GetSCIMGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := Exec(ctx, `DELETE FROM scim_groups WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete group: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrSCIMGroupNotFound
+	}
+
+	members := make([]int, 0, len(group.Members))
+	for _, member := range group.Members {
+		members = append(members, member.UserID)
+	}
+	return members, nil
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrServiceTokenNotFound is returned for unknown service tokens
+var ErrServiceTokenNotFound = errors.New("service token not found")
+
+// ServiceToken lets a script or probe through the SSO of an app without a browser session, until
+// it expires or is revoked. PathPrefixes and ReadOnly narrow the requests it allows.
+type ServiceToken struct {
+	ID           int        `json:"id"`
+	AppName      string     `json:"app_name"`
+	Name         string     `json:"name"`
+	PathPrefixes []string   `json:"path_prefixes"`
+	ReadOnly     bool       `json:"read_only"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy    *int       `json:"revoked_by,omitempty"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP   *string    `json:"last_used_ip,omitempty"`
+	CreatedBy    *int       `json:"created_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Active reports whether a service token still grants access
+func (t *ServiceToken) Active() bool {
+	return t.RevokedAt == nil && time.Now().Before(t.ExpiresAt)
+}
+
+const serviceTokenColumns = `id, app_name, name, path_prefixes, read_only, expires_at, revoked_at, revoked_by,
+	last_used_at, last_used_ip, created_by, created_at`
+
+// CreateServiceToken stores a service token of an app with the hash of its token
+func (a *AppAPI) CreateServiceToken(ctx context.Context, token *ServiceToken, tokenHash string) error {
+	if err := ValidateArgs(token.AppName, tokenHash); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// Names and path prefixes are checked by the caller, they are stored as is
+	err := QueryRow(ctx, `
+		INSERT INTO app_service_tokens (app_name, name, token_hash, path_prefixes, read_only, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		token.AppName, []byte(token.Name), tokenHash, token.PathPrefixes, token.ReadOnly, token.ExpiresAt, token.CreatedBy,
+	).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create service token: %w", err)
+	}
+	return nil
+}
+
+// ListServiceTokens lists the service tokens of an app, newest first
+func (a *AppAPI) ListServiceTokens(ctx context.Context, appName string) ([]ServiceToken, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT `+serviceTokenColumns+`
+		FROM app_service_tokens
+		WHERE app_name = $1
+		ORDER BY created_at DESC`, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []ServiceToken{}
+	for rows.Next() {
+		token, err := scanServiceToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+// GetServiceTokenByHash returns the service token of a token hash
+func (a *AppAPI) GetServiceTokenByHash(ctx context.Context, tokenHash string) (*ServiceToken, error) {
+	if err := ValidateArgs(tokenHash); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	token, err := scanServiceToken(QueryRow(ctx, `SELECT `+serviceTokenColumns+` FROM app_service_tokens WHERE token_hash = $1`, tokenHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrServiceTokenNotFound
+	}
+	return token, err
+}
+
+// RecordServiceTokenUse stores when and from where a service token was last used
+func (a *AppAPI) RecordServiceTokenUse(ctx context.Context, id int, ip string) error {
+	_, err := Exec(ctx, `
+		UPDATE app_service_tokens
+		SET last_used_at = CURRENT_TIMESTAMP, last_used_ip = $2
+		WHERE id = $1`, id, ip)
+	if err != nil {
+		return fmt.Errorf("failed to record service token use: %w", err)
+	}
+	return nil
+}
+
+// RevokeServiceToken ends the access a service token of an app grants
+func (a *AppAPI) RevokeServiceToken(ctx context.Context, appName string, id int, userID *int) error {
+	tag, err := Exec(ctx, `
+		UPDATE app_service_tokens SET revoked_at = CURRENT_TIMESTAMP, revoked_by = $3
+		WHERE id = $1 AND app_name = $2 AND revoked_at IS NULL`, id, appName, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke service token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrServiceTokenNotFound
+	}
+	return nil
+}
+
+func scanServiceToken(row pgx.Row) (*ServiceToken, error) {
+	token := &ServiceToken{}
+	err := row.Scan(&token.ID, &token.AppName, &token.Name, &token.PathPrefixes, &token.ReadOnly, &token.ExpiresAt,
+		&token.RevokedAt, &token.RevokedBy, &token.LastUsedAt, &token.LastUsedIP, &token.CreatedBy, &token.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan service token: %w", err)
+	}
+	return token, nil
+}
@@ -164,13 +164,19 @@ func (s *SettingsAPI) CreateCustomDomain(ctx context.Context, appName, domain st
 		return fmt.Errorf("validation failed: %w", err)
 	}
 
+	// A domain removed from the app earlier is reactivated
 	query := `
 		INSERT INTO app_custom_domains (app_name, domain, is_active, created_at, updated_at)
-		VALUES ($1, $2, true, $3, $4)`
+		VALUES ($1, $2, true, $3, $4)
+		ON CONFLICT (app_name, domain) DO UPDATE
+		SET is_active = true, updated_at = EXCLUDED.updated_at`
 
 	now := GetCurrentTimestamp()
 	_, err := Exec(ctx, query, appName, domain, now, now)
 	if err != nil {
+		if isActiveDomainConflict(err) {
+			return fmt.Errorf("failed to create custom domain: %w", ErrCustomDomainTaken)
+		}
 		return fmt.Errorf("failed to create custom domain: %w", err)
 	}
 
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrShareLinkNotFound is returned for unknown share links
+var ErrShareLinkNotFound = errors.New("share link not found")
+
+// ShareLink gives visitors without an account access to a private app until it expires or is revoked
+type ShareLink struct {
+	ID         int        `json:"id"`
+	AppName    string     `json:"app_name"`
+	Label      string     `json:"label"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	UseCount   int        `json:"use_count"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP *string    `json:"last_used_ip,omitempty"`
+	CreatedBy  *int       `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active reports whether a share link still grants access
+func (l *ShareLink) Active() bool {
+	return l.RevokedAt == nil && time.Now().Before(l.ExpiresAt)
+}
+
+const shareLinkColumns = `id, app_name, label, expires_at, revoked_at, use_count, last_used_at, last_used_ip,
+	created_by, created_at`
+
+// CreateShareLink stores a share link of an app with the hash of its token
+func (a *AppAPI) CreateShareLink(ctx context.Context, link *ShareLink, tokenHash string) error {
+	if err := ValidateArgs(link.AppName, tokenHash); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	err := QueryRow(ctx, `
+		INSERT INTO app_share_links (app_name, token_hash, label, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		link.AppName, tokenHash, []byte(link.Label), link.ExpiresAt, link.CreatedBy,
+	).Scan(&link.ID, &link.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create share link: %w", err)
+	}
+	return nil
+}
+
+// ListShareLinks lists the share links of an app, newest first
+func (a *AppAPI) ListShareLinks(ctx context.Context, appName string) ([]ShareLink, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT `+shareLinkColumns+`
+		FROM app_share_links
+		WHERE app_name = $1
+		ORDER BY created_at DESC`, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list share links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *link)
+	}
+	return links, rows.Err()
+}
+
+// GetShareLink returns a share link by ID
+func (a *AppAPI) GetShareLink(ctx context.Context, id int) (*ShareLink, error) {
+	link, err := scanShareLink(QueryRow(ctx, `SELECT `+shareLinkColumns+` FROM app_share_links WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrShareLinkNotFound
+	}
+	return link, err
+}
+
+// GetShareLinkByToken returns the share link of a token hash
+func (a *AppAPI) GetShareLinkByToken(ctx context.Context, tokenHash string) (*ShareLink, error) {
+	if err := ValidateArgs(tokenHash); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	link, err := scanShareLink(QueryRow(ctx, `SELECT `+shareLinkColumns+` FROM app_share_links WHERE token_hash = $1`, tokenHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrShareLinkNotFound
+	}
+	return link, err
+}
+
+// RecordShareLinkUse counts a visit opened with a share link
+func (a *AppAPI) RecordShareLinkUse(ctx context.Context, id int, ip string) error {
+	_, err := Exec(ctx, `
+		UPDATE app_share_links
+		SET use_count = use_count + 1, last_used_at = CURRENT_TIMESTAMP, last_used_ip = $2
+		WHERE id = $1`, id, ip)
+	if err != nil {
+		return fmt.Errorf("failed to record share link use: %w", err)
+	}
+	return nil
+}
+
+// RevokeShareLink ends the access a share link of an app grants
+func (a *AppAPI) RevokeShareLink(ctx context.Context, appName string, id int) error {
+	tag, err := Exec(ctx, `
+		UPDATE app_share_links SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND app_name = $2 AND revoked_at IS NULL`, id, appName)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrShareLinkNotFound
+	}
+	return nil
+}
+
+func scanShareLink(row pgx.Row) (*ShareLink, error) {
+	link := &ShareLink{}
+	err := row.Scan(&link.ID, &link.AppName, &link.Label, &link.ExpiresAt, &link.RevokedAt, &link.UseCount,
+		&link.LastUsedAt, &link.LastUsedIP, &link.CreatedBy, &link.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan share link: %w", err)
+	}
+	return link, nil
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrSlackUserNotLinked is returned when a Slack user has no Citizen account linked
+var ErrSlackUserNotLinked = errors.New("slack user is not linked to a Citizen user")
+
+// SlackConfig represents the Slack app configuration (secrets encrypted)
+type SlackConfig struct {
+	ClientID      string
+	ClientSecret  string
+	SigningSecret string
+	RedirectURI   string
+	CreatedAt     time.Time
+}
+
+// SlackWorkspace is a Slack workspace the app is installed in
+type SlackWorkspace struct {
+	TeamID      string    `json:"team_id"`
+	TeamName    string    `json:"team_name"`
+	BotUserID   string    `json:"bot_user_id,omitempty"`
+	BotToken    string    `json:"-"`
+	InstalledBy *int      `json:"installed_by,omitempty"`
+	LinkedUsers int       `json:"linked_users"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GetSlackConfig retrieves the active Slack config with its encrypted secrets
+func (s *SlackAPI) GetSlackConfig(ctx context.Context) (*SlackConfig, error) {
+	query := `
+		SELECT client_id, client_secret, signing_secret, redirect_uri, created_at
+		FROM slack_config
+		WHERE is_active = true
+		ORDER BY updated_at DESC
+		LIMIT 1`
+
+	config := &SlackConfig{}
+	err := QueryRow(ctx, query).Scan(&config.ClientID, &config.ClientSecret, &config.SigningSecret,
+		&config.RedirectURI, &config.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Slack config: %w", err)
+	}
+
+	return config, nil
+}
+
+// SaveSlackConfig replaces the active Slack config. Secrets must already be encrypted.
+func (s *SlackAPI) SaveSlackConfig(ctx context.Context, clientID, clientSecret, signingSecret, redirectURI string) error {
+	if err := ValidateArgs(redirectURI); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		WITH deactivated AS (
+			UPDATE slack_config SET is_active = false, updated_at = CURRENT_TIMESTAMP WHERE is_active = true
+		)
+		INSERT INTO slack_config (client_id, client_secret, signing_secret, redirect_uri, is_active)
+		VALUES ($1, $2, $3, $4, true)`
+
+	// Ciphertexts are random base64, pass them as bytes so they skip argument validation
+	_, err := Exec(ctx, query, []byte(clientID), []byte(clientSecret), []byte(signingSecret), redirectURI)
+	if err != nil {
+		return fmt.Errorf("failed to save Slack config: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSlackConfig deactivates the Slack config
+func (s *SlackAPI) DeleteSlackConfig(ctx context.Context) error {
+	query := `
+		UPDATE slack_config
+		SET is_active = false, updated_at = CURRENT_TIMESTAMP
+		WHERE is_active = true`
+
+	_, err := Exec(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to delete Slack config: %w", err)
+	}
+
+	return nil
+}
+
+// SaveSlackWorkspace stores or refreshes an installed workspace. The bot token must already be encrypted.
+func (s *SlackAPI) SaveSlackWorkspace(ctx context.Context, workspace *SlackWorkspace) error {
+	if err := ValidateArgs(workspace.TeamID, workspace.TeamName, workspace.BotUserID); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO slack_workspaces (team_id, team_name, bot_user_id, bot_token, installed_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (team_id) DO UPDATE
+		SET team_name = EXCLUDED.team_name, bot_user_id = EXCLUDED.bot_user_id,
+		    bot_token = EXCLUDED.bot_token, installed_by = EXCLUDED.installed_by`
+
+	_, err := Exec(ctx, query, workspace.TeamID, workspace.TeamName, workspace.BotUserID,
+		[]byte(workspace.BotToken), workspace.InstalledBy)
+	if err != nil {
+		return fmt.Errorf("failed to save Slack workspace: %w", err)
+	}
+
+	return nil
+}
+
+// ListSlackWorkspaces lists installed workspaces without their tokens
+func (s *SlackAPI) ListSlackWorkspaces(ctx context.Context) ([]SlackWorkspace, error) {
+	query := `
+		SELECT w.team_id, COALESCE(w.team_name, ''), COALESCE(w.bot_user_id, ''), w.installed_by,
+		       (SELECT COUNT(*) FROM slack_user_links l WHERE l.team_id = w.team_id),
+		       w.created_at, w.updated_at
+		FROM slack_workspaces w
+		ORDER BY w.team_name`
+
+	rows, err := Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Slack workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	workspaces := []SlackWorkspace{}
+	for rows.Next() {
+		var workspace SlackWorkspace
+		if err := rows.Scan(&workspace.TeamID, &workspace.TeamName, &workspace.BotUserID, &workspace.InstalledBy,
+			&workspace.LinkedUsers, &workspace.CreatedAt, &workspace.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan Slack workspace: %w", err)
+		}
+		workspaces = append(workspaces, workspace)
+	}
+
+	return workspaces, rows.Err()
+}
+
+// DeleteSlackWorkspace removes a workspace and its user links
+func (s *SlackAPI) DeleteSlackWorkspace(ctx context.Context, teamID string) (bool, error) {
+	if err := ValidateArgs(teamID); err != nil {
+		return false, fmt.Errorf("validation failed: %w", err)
+	}
+
+	result, err := Exec(ctx, `DELETE FROM slack_workspaces WHERE team_id = $1`, teamID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete Slack workspace: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// LinkSlackUser makes a Slack user act as a Citizen user
+func (s *SlackAPI) LinkSlackUser(ctx context.Context, teamID, slackUserID string, userID int) error {
+	if err := ValidateArgs(teamID, slackUserID, userID); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO slack_user_links (team_id, slack_user_id, user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (team_id, slack_user_id) DO UPDATE SET user_id = EXCLUDED.user_id`
+
+	_, err := Exec(ctx, query, teamID, slackUserID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to link Slack user: %w", err)
+	}
+
+	return nil
+}
+
+// GetLinkedUserID returns the Citizen user a Slack user acts as
+func (s *SlackAPI) GetLinkedUserID(ctx context.Context, teamID, slackUserID string) (int, error) {
+	if err := ValidateArgs(teamID, slackUserID); err != nil {
+		return 0, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var userID int
+	err := QueryRow(ctx, `SELECT user_id FROM slack_user_links WHERE team_id = $1 AND slack_user_id = $2`,
+		teamID, slackUserID).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrSlackUserNotLinked
+		}
+		return 0, fmt.Errorf("failed to get linked Slack user: %w", err)
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNothingToRestore is returned when an app has no soft-deleted rows
+var ErrNothingToRestore = errors.New("no soft-deleted data for this app")
+
+// SoftDeletedDeployment is an app deployment removed with its app
+type SoftDeletedDeployment struct {
+	ID        int       `json:"id"`
+	AppName   string    `json:"app_name"`
+	Domain    *string   `json:"domain,omitempty"`
+	GitURL    *string   `json:"git_url,omitempty"`
+	GitBranch *string   `json:"git_branch,omitempty"`
+	Status    *string   `json:"status,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// SoftDeletedRepository is a GitHub repository connection removed with its app or disconnected
+type SoftDeletedRepository struct {
+	ID        int       `json:"id"`
+	AppName   string    `json:"app_name"`
+	UserID    int       `json:"user_id"`
+	FullName  string    `json:"full_name"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// SoftDeletedCounts counts the rows a restore or a purge touched
+type SoftDeletedCounts struct {
+	Deployments  int64 `json:"deployments"`
+	Repositories int64 `json:"repositories"`
+}
+
+// ListSoftDeletedDeployments lists the soft-deleted app deployments, most recently deleted first
+func (d *DeploymentAPI) ListSoftDeletedDeployments(ctx context.Context) ([]SoftDeletedDeployment, error) {
+	rows, err := Query(ctx, `
+		SELECT id, app_name, domain, git_url, git_branch, status, deleted_at
+		FROM app_deployments
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list soft-deleted deployments: %w", err)
+	}
+	defer rows.Close()
+
+	deployments := []SoftDeletedDeployment{}
+	for rows.Next() {
+		var deployment SoftDeletedDeployment
+		if err := rows.Scan(&deployment.ID, &deployment.AppName, &deployment.Domain, &deployment.GitURL,
+			&deployment.GitBranch, &deployment.Status, &deployment.DeletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan soft-deleted deployment: %w", err)
+		}
+		deployments = append(deployments, deployment)
+	}
+	return deployments, rows.Err()
+}
+
+// ListSoftDeletedRepositories lists the soft-deleted repository connections, most recently deleted first
+func (d *DeploymentAPI) ListSoftDeletedRepositories(ctx context.Context) ([]SoftDeletedRepository, error) {
+	rows, err := Query(ctx, `
+		SELECT id, app_name, user_id, full_name, deleted_at
+		FROM github_repositories
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list soft-deleted repositories: %w", err)
+	}
+	defer rows.Close()
+
+	repositories := []SoftDeletedRepository{}
+	for rows.Next() {
+		var repository SoftDeletedRepository
+		if err := rows.Scan(&repository.ID, &repository.AppName, &repository.UserID, &repository.FullName,
+			&repository.DeletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan soft-deleted repository: %w", err)
+		}
+		repositories = append(repositories, repository)
+	}
+	return repositories, rows.Err()
+}
+
+// RestoreSoftDeletedApp brings back the soft-deleted deployment and repository connection of an
+// app. The webhook of the connection may be gone, so auto deploy stays off until re-enabled.
+func (d *DeploymentAPI) RestoreSoftDeletedApp(ctx context.Context, appName string) (*SoftDeletedCounts, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	restored := &SoftDeletedCounts{}
+	err := Transaction(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE app_deployments SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE app_name = $1 AND deleted_at IS NOT NULL`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to restore deployment: %w", err)
+		}
+		restored.Deployments = tag.RowsAffected()
+
+		tag, err = tx.Exec(ctx, `
+			UPDATE github_repositories
+			SET deleted_at = NULL, webhook_active = false, auto_deploy_enabled = false, updated_at = CURRENT_TIMESTAMP
+			WHERE app_name = $1 AND deleted_at IS NOT NULL`, appName)
+		if err != nil {
+			return fmt.Errorf("failed to restore repository connection: %w", err)
+		}
+		restored.Repositories = tag.RowsAffected()
+
+		if restored.Deployments == 0 && restored.Repositories == 0 {
+			return ErrNothingToRestore
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// PurgeSoftDeleted permanently deletes the rows soft-deleted before a cutoff
+func (d *DeploymentAPI) PurgeSoftDeleted(ctx context.Context, deletedBefore time.Time) (*SoftDeletedCounts, error) {
+	purged := &SoftDeletedCounts{}
+	err := Transaction(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `DELETE FROM app_deployments WHERE deleted_at IS NOT NULL AND deleted_at < $1`, deletedBefore)
+		if err != nil {
+			return fmt.Errorf("failed to purge deployments: %w", err)
+		}
+		purged.Deployments = tag.RowsAffected()
+
+		tag, err = tx.Exec(ctx, `DELETE FROM github_repositories WHERE deleted_at IS NOT NULL AND deleted_at < $1`, deletedBefore)
+		if err != nil {
+			return fmt.Errorf("failed to purge repositories: %w", err)
+		}
+		purged.Repositories = tag.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
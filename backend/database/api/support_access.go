@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrSupportGrantNotFound is returned for unknown support access grants
+var ErrSupportGrantNotFound = errors.New("support access grant not found")
+
+// SupportGrant gives whoever holds its token read-only access to one app until it expires or the
+// user who granted it revokes it
+type SupportGrant struct {
+	ID         int        `json:"id"`
+	AppName    string     `json:"app_name"`
+	Reason     string     `json:"reason"`
+	GrantedBy  int        `json:"granted_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	UseCount   int        `json:"use_count"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP *string    `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active reports whether a grant still gives access
+func (g *SupportGrant) Active() bool {
+	return g.RevokedAt == nil && time.Now().Before(g.ExpiresAt)
+}
+
+const supportGrantColumns = `id, app_name, reason, granted_by, expires_at, revoked_at, use_count, last_used_at,
+	last_used_ip, created_at`
+
+// CreateSupportGrant stores a support access grant with the hash of its token
+func (u *UserAPI) CreateSupportGrant(ctx context.Context, grant *SupportGrant, tokenHash string) error {
+	if err := ValidateArgs(grant.AppName, tokenHash); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	err := QueryRow(ctx, `
+		INSERT INTO support_access_grants (app_name, token_hash, reason, granted_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		grant.AppName, tokenHash, []byte(grant.Reason), grant.GrantedBy, grant.ExpiresAt,
+	).Scan(&grant.ID, &grant.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create support access grant: %w", err)
+	}
+	return nil
+}
+
+// ListSupportGrants lists the support access grants a user gave, newest first
+func (u *UserAPI) ListSupportGrants(ctx context.Context, userID int) ([]SupportGrant, error) {
+	rows, err := Query(ctx, `
+		SELECT `+supportGrantColumns+`
+		FROM support_access_grants
+		WHERE granted_by = $1
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list support access grants: %w", err)
+	}
+	defer rows.Close()
+
+	grants := []SupportGrant{}
+	for rows.Next() {
+		grant, err := scanSupportGrant(rows)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, *grant)
+	}
+	return grants, rows.Err()
+}
+
+// GetSupportGrantByToken returns the support access grant of a token hash
+func (u *UserAPI) GetSupportGrantByToken(ctx context.Context, tokenHash string) (*SupportGrant, error) {
+	if err := ValidateArgs(tokenHash); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	grant, err := scanSupportGrant(QueryRow(ctx, `SELECT `+supportGrantColumns+` FROM support_access_grants WHERE token_hash = $1`, tokenHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSupportGrantNotFound
+	}
+	return grant, err
+}
+
+// RecordSupportGrantUse counts a request made with a support access grant
+func (u *UserAPI) RecordSupportGrantUse(ctx context.Context, id int, ip string) error {
+	_, err := Exec(ctx, `
+		UPDATE support_access_grants
+		SET use_count = use_count + 1, last_used_at = CURRENT_TIMESTAMP, last_used_ip = $2
+		WHERE id = $1`, id, ip)
+	if err != nil {
+		return fmt.Errorf("failed to record support access grant use: %w", err)
+	}
+	return nil
+}
+
+// RevokeSupportGrant ends the access a grant a user gave
+func (u *UserAPI) RevokeSupportGrant(ctx context.Context, userID, id int) error {
+	tag, err := Exec(ctx, `
+		UPDATE support_access_grants SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND granted_by = $2 AND revoked_at IS NULL`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke support access grant: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSupportGrantNotFound
+	}
+	return nil
+}
+
+func scanSupportGrant(row pgx.Row) (*SupportGrant, error) {
+	grant := &SupportGrant{}
+	err := row.Scan(&grant.ID, &grant.AppName, &grant.Reason, &grant.GrantedBy, &grant.ExpiresAt, &grant.RevokedAt,
+		&grant.UseCount, &grant.LastUsedAt, &grant.LastUsedIP, &grant.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan support access grant: %w", err)
+	}
+	return grant, nil
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrSettingNotFound is returned when a system setting has not been stored yet
+var ErrSettingNotFound = errors.New("setting not found")
+
+// GetSystemSetting retrieves a system setting value by key
+func (s *SettingsAPI) GetSystemSetting(ctx context.Context, key string) (string, error) {
+	if err := ValidateArgs(key); err != nil {
+		return "", fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `SELECT value FROM system_settings WHERE key = $1`
+
+	var value string
+	err := QueryRow(ctx, query, key).Scan(&value)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrSettingNotFound
+		}
+		return "", fmt.Errorf("failed to get system setting: %w", err)
+	}
+
+	return value, nil
+}
+
+// SetSystemSetting creates or updates a system setting
+func (s *SettingsAPI) SetSystemSetting(ctx context.Context, key, value string) error {
+	if err := ValidateArgs(key, value); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO system_settings (key, value, created_at, updated_at)
+		VALUES ($1, $2, $3, $3)
+		ON CONFLICT (key) DO UPDATE SET
+			value = EXCLUDED.value,
+			updated_at = EXCLUDED.updated_at`
+
+	_, err := Exec(ctx, query, key, value, GetCurrentTimestamp())
+	if err != nil {
+		return fmt.Errorf("failed to set system setting: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSystemSetting removes a system setting
+func (s *SettingsAPI) DeleteSystemSetting(ctx context.Context, key string) error {
+	if err := ValidateArgs(key); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `DELETE FROM system_settings WHERE key = $1`
+	_, err := Exec(ctx, query, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete system setting: %w", err)
+	}
+
+	return nil
+}
+
+// ListSystemSettings retrieves all system settings whose key starts with prefix
+func (s *SettingsAPI) ListSystemSettings(ctx context.Context, prefix string) (map[string]string, error) {
+	if err := ValidateArgs(prefix); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `SELECT key, value FROM system_settings WHERE key LIKE $1 || '%' ORDER BY key`
+	rows, err := Query(ctx, query, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list system settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan system setting: %w", err)
+		}
+		settings[key] = value
+	}
+
+	return settings, nil
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TrafficRollup is the traffic of an app during one hour
+type TrafficRollup struct {
+	AppName        string    `json:"app_name"`
+	HourStart      time.Time `json:"hour_start"`
+	Requests       int64     `json:"requests"`
+	Status2xx      int64     `json:"status_2xx"`
+	Status3xx      int64     `json:"status_3xx"`
+	Status4xx      int64     `json:"status_4xx"`
+	Status5xx      int64     `json:"status_5xx"`
+	LatencySumMs   int64     `json:"latency_sum_ms"`
+	LatencyBuckets []int64   `json:"latency_buckets"`
+}
+
+// AddTrafficRollup adds the counts of a rollup to the stored hour of its app
+func (t *TrafficAPI) AddTrafficRollup(ctx context.Context, rollup *TrafficRollup) error {
+	if err := ValidateArgs(rollup.AppName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO app_traffic_hourly (app_name, hour_start, requests, status_2xx, status_3xx, status_4xx, status_5xx,
+		                                latency_sum_ms, latency_buckets)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (app_name, hour_start) DO UPDATE
+		SET requests = app_traffic_hourly.requests + EXCLUDED.requests,
+		    status_2xx = app_traffic_hourly.status_2xx + EXCLUDED.status_2xx,
+		    status_3xx = app_traffic_hourly.status_3xx + EXCLUDED.status_3xx,
+		    status_4xx = app_traffic_hourly.status_4xx + EXCLUDED.status_4xx,
+		    status_5xx = app_traffic_hourly.status_5xx + EXCLUDED.status_5xx,
+		    latency_sum_ms = app_traffic_hourly.latency_sum_ms + EXCLUDED.latency_sum_ms,
+		    latency_buckets = ARRAY(
+		        SELECT COALESCE(a, 0) + COALESCE(b, 0)
+		        FROM unnest(app_traffic_hourly.latency_buckets, EXCLUDED.latency_buckets) WITH ORDINALITY AS l(a, b, i)
+		        ORDER BY i)`
+
+	_, err := Exec(ctx, query, rollup.AppName, rollup.HourStart, rollup.Requests, rollup.Status2xx, rollup.Status3xx,
+		rollup.Status4xx, rollup.Status5xx, rollup.LatencySumMs, rollup.LatencyBuckets)
+	if err != nil {
+		return fmt.Errorf("failed to add traffic rollup: %w", err)
+	}
+
+	return nil
+}
+
+// ListTrafficRollups lists the hourly rollups of an app in [since, until), oldest first
+func (t *TrafficAPI) ListTrafficRollups(ctx context.Context, appName string, since, until time.Time) ([]TrafficRollup, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		SELECT app_name, hour_start, requests, status_2xx, status_3xx, status_4xx, status_5xx,
+		       latency_sum_ms, latency_buckets
+		FROM app_traffic_hourly
+		WHERE app_name = $1 AND hour_start >= $2 AND hour_start < $3
+		ORDER BY hour_start`
+
+	rows, err := ReadQuery(ctx, query, appName, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list traffic rollups: %w", err)
+	}
+	defer rows.Close()
+
+	rollups := []TrafficRollup{}
+	for rows.Next() {
+		var rollup TrafficRollup
+		if err := rows.Scan(&rollup.AppName, &rollup.HourStart, &rollup.Requests, &rollup.Status2xx, &rollup.Status3xx,
+			&rollup.Status4xx, &rollup.Status5xx, &rollup.LatencySumMs, &rollup.LatencyBuckets); err != nil {
+			return nil, fmt.Errorf("failed to scan traffic rollup: %w", err)
+		}
+		rollups = append(rollups, rollup)
+	}
+
+	return rollups, rows.Err()
+}
+
+// PruneTrafficRollups deletes rollups of hours before olderThan
+func (t *TrafficAPI) PruneTrafficRollups(ctx context.Context, olderThan time.Time) (int64, error) {
+	result, err := Exec(ctx, `DELETE FROM app_traffic_hourly WHERE hour_start < $1`, olderThan)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune traffic rollups: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// InteractionType is the kind of action a user took on an app
+type InteractionType string
+
+const (
+	InteractionDeploy InteractionType = "deploy"
+	InteractionLogs   InteractionType = "logs"
+	InteractionEnv    InteractionType = "env"
+)
+
+// RecentApp is an app a user recently interacted with
+type RecentApp struct {
+	AppName          string          `json:"app_name"`
+	LastInteraction  InteractionType `json:"last_interaction"`
+	InteractionCount int             `json:"interaction_count"`
+	LastInteractedAt time.Time       `json:"last_interacted_at"`
+}
+
+// RecordAppInteraction records that a user interacted with an app
+func (u *UserAPI) RecordAppInteraction(ctx context.Context, userID int, appName string, interaction InteractionType) error {
+	if err := ValidateArgs(userID, appName, string(interaction)); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO user_app_interactions (user_id, app_name, last_interaction)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, app_name) DO UPDATE
+		SET last_interaction = EXCLUDED.last_interaction,
+		    interaction_count = user_app_interactions.interaction_count + 1,
+		    last_interacted_at = CURRENT_TIMESTAMP`
+
+	if _, err := Exec(ctx, query, userID, appName, string(interaction)); err != nil {
+		return fmt.Errorf("failed to record app interaction: %w", err)
+	}
+	return nil
+}
+
+// ListRecentApps lists the apps a user interacted with, most recent first
+func (u *UserAPI) ListRecentApps(ctx context.Context, userID, limit int) ([]RecentApp, error) {
+	if err := ValidateArgs(userID, limit); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT app_name, last_interaction, interaction_count, last_interacted_at
+		FROM user_app_interactions
+		WHERE user_id = $1
+		ORDER BY last_interacted_at DESC
+		LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recent apps: %w", err)
+	}
+	defer rows.Close()
+
+	apps := []RecentApp{}
+	for rows.Next() {
+		var app RecentApp
+		if err := rows.Scan(&app.AppName, &app.LastInteraction, &app.InteractionCount, &app.LastInteractedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan recent app: %w", err)
+		}
+		apps = append(apps, app)
+	}
+
+	return apps, rows.Err()
+}
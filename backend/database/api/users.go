@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"backend/models"
 )
@@ -254,4 +255,61 @@ func (u *UserAPI) UserExists(ctx context.Context, username, email string) (bool,
 	}
 
 	return count > 0, nil
-} 
\ No newline at end of file
+} 
+
+// IsUserAdmin checks if a user has the admin flag set
+func (u *UserAPI) IsUserAdmin(ctx context.Context, userID int) (bool, error) {
+	if err := ValidateArgs(userID); err != nil {
+		return false, fmt.Errorf("validation failed: %w", err)
+	}
+
+	query := `SELECT COALESCE(is_admin, false) FROM users WHERE id = $1`
+	var isAdmin bool
+	err := QueryRow(ctx, query, userID).Scan(&isAdmin)
+	if err != nil {
+		return false, fmt.Errorf("failed to check admin flag: %w", err)
+	}
+
+	return isAdmin, nil
+}
+
+// CountUsers counts all users
+func (u *UserAPI) CountUsers(ctx context.Context) (int, error) {
+	var count int
+	if err := QueryRow(ctx, `SELECT COUNT(*) FROM users`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+// CountActiveUsers counts the users who triggered an activity since the given time
+func (u *UserAPI) CountActiveUsers(ctx context.Context, since time.Time) (int, error) {
+	var count int
+	err := QueryRow(ctx,
+		`SELECT COUNT(DISTINCT user_id) FROM app_activities WHERE user_id IS NOT NULL AND started_at >= $1`,
+		since,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count active users: %w", err)
+	}
+	return count, nil
+}
+
+// ListAdminEmails lists the email addresses of the admins
+func (u *UserAPI) ListAdminEmails(ctx context.Context) ([]string, error) {
+	rows, err := Query(ctx, `SELECT email FROM users WHERE is_admin AND email IS NOT NULL AND email <> '' ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list admin emails: %w", err)
+	}
+	defer rows.Close()
+
+	emails := []string{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, fmt.Errorf("failed to scan admin email: %w", err)
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
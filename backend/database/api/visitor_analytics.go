@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// VisitorAnalyticsSetting is the opt-in of an app to visitor analytics. SamplePercent of the
+// requests are recorded, counts are scaled back up.
+type VisitorAnalyticsSetting struct {
+	AppName       string `json:"app_name"`
+	Enabled       bool   `json:"enabled"`
+	SamplePercent int    `json:"sample_percent"`
+}
+
+// VisitorCount is a path or host with its estimated request count
+type VisitorCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// VisitorStats are the estimated requests and unique visitors of an app during one UTC day
+type VisitorStats struct {
+	AppName  string         `json:"app_name"`
+	Day      time.Time      `json:"day"`
+	Requests int64          `json:"requests"`
+	Visitors int64          `json:"visitors"`
+	TopPaths []VisitorCount `json:"top_paths"`
+	TopHosts []VisitorCount `json:"top_hosts"`
+}
+
+// GetVisitorAnalyticsSetting returns the visitor analytics setting of an app, disabled when none
+// is stored
+func (t *TrafficAPI) GetVisitorAnalyticsSetting(ctx context.Context, appName string) (*VisitorAnalyticsSetting, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	setting := &VisitorAnalyticsSetting{AppName: appName, SamplePercent: 100}
+	err := QueryRow(ctx, `SELECT enabled, sample_percent FROM app_analytics_settings WHERE app_name = $1`, appName).
+		Scan(&setting.Enabled, &setting.SamplePercent)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get visitor analytics setting: %w", err)
+	}
+	return setting, nil
+}
+
+// SetVisitorAnalyticsSetting stores the visitor analytics setting of an app
+func (t *TrafficAPI) SetVisitorAnalyticsSetting(ctx context.Context, setting *VisitorAnalyticsSetting, userID *int) error {
+	if err := ValidateArgs(setting.AppName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	_, err := Exec(ctx, `
+		INSERT INTO app_analytics_settings (app_name, enabled, sample_percent, updated_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (app_name) DO UPDATE
+		SET enabled = EXCLUDED.enabled, sample_percent = EXCLUDED.sample_percent, updated_by = EXCLUDED.updated_by`,
+		setting.AppName, setting.Enabled, setting.SamplePercent, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set visitor analytics setting: %w", err)
+	}
+	return nil
+}
+
+// ListVisitorAnalyticsSettings lists the apps with visitor analytics enabled
+func (t *TrafficAPI) ListVisitorAnalyticsSettings(ctx context.Context) ([]VisitorAnalyticsSetting, error) {
+	rows, err := Query(ctx, `
+		SELECT app_name, enabled, sample_percent
+		FROM app_analytics_settings
+		WHERE enabled
+		ORDER BY app_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list visitor analytics settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := []VisitorAnalyticsSetting{}
+	for rows.Next() {
+		var setting VisitorAnalyticsSetting
+		if err := rows.Scan(&setting.AppName, &setting.Enabled, &setting.SamplePercent); err != nil {
+			return nil, fmt.Errorf("failed to scan visitor analytics setting: %w", err)
+		}
+		settings = append(settings, setting)
+	}
+	return settings, rows.Err()
+}
+
+// UpsertVisitorStats stores the stats of an app for a day, replacing the previous flush of the day
+func (t *TrafficAPI) UpsertVisitorStats(ctx context.Context, stats *VisitorStats) error {
+	if err := ValidateArgs(stats.AppName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// Paths and hosts come from visitors, they are stored as JSON without the SQL pattern check
+	topPaths, err := json.Marshal(stats.TopPaths)
+	if err != nil {
+		return err
+	}
+	topHosts, err := json.Marshal(stats.TopHosts)
+	if err != nil {
+		return err
+	}
+	_, err = Exec(ctx, `
+		INSERT INTO app_visitors_daily (app_name, day, requests, visitors, top_paths, top_hosts)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (app_name, day) DO UPDATE
+		SET requests = EXCLUDED.requests, visitors = EXCLUDED.visitors,
+		    top_paths = EXCLUDED.top_paths, top_hosts = EXCLUDED.top_hosts`,
+		stats.AppName, stats.Day, stats.Requests, stats.Visitors, topPaths, topHosts)
+	if err != nil {
+		return fmt.Errorf("failed to save visitor stats: %w", err)
+	}
+	return nil
+}
+
+// ListVisitorStats lists the daily stats of an app since a day, oldest first
+func (t *TrafficAPI) ListVisitorStats(ctx context.Context, appName string, since time.Time) ([]VisitorStats, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := ReadQuery(ctx, `
+		SELECT app_name, day, requests, visitors, top_paths, top_hosts
+		FROM app_visitors_daily
+		WHERE app_name = $1 AND day >= $2
+		ORDER BY day`, appName, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list visitor stats: %w", err)
+	}
+	defer rows.Close()
+
+	days := []VisitorStats{}
+	for rows.Next() {
+		var stats VisitorStats
+		var topPaths, topHosts []byte
+		if err := rows.Scan(&stats.AppName, &stats.Day, &stats.Requests, &stats.Visitors, &topPaths, &topHosts); err != nil {
+			return nil, fmt.Errorf("failed to scan visitor stats: %w", err)
+		}
+		if err := json.Unmarshal(topPaths, &stats.TopPaths); err != nil {
+			return nil, fmt.Errorf("failed to decode top paths: %w", err)
+		}
+		if err := json.Unmarshal(topHosts, &stats.TopHosts); err != nil {
+			return nil, fmt.Errorf("failed to decode top hosts: %w", err)
+		}
+		days = append(days, stats)
+	}
+	return days, rows.Err()
+}
+
+// PruneVisitorStats deletes the daily stats of days before a time
+func (t *TrafficAPI) PruneVisitorStats(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := Exec(ctx, `DELETE FROM app_visitors_daily WHERE day < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune visitor stats: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
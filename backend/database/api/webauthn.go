@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrPasskeyNotFound is returned for unknown passkeys
+var ErrPasskeyNotFound = errors.New("passkey not found")
+
+// Passkey is a WebAuthn credential a user logs in with
+type Passkey struct {
+	ID             int        `json:"id"`
+	UserID         int        `json:"user_id"`
+	CredentialID   []byte     `json:"credential_id"`
+	PublicKey      []byte     `json:"-"`
+	Algorithm      int        `json:"algorithm"`
+	SignCount      uint32     `json:"-"`
+	AAGUID         []byte     `json:"aaguid,omitempty"`
+	Transports     []string   `json:"transports"`
+	BackupEligible bool       `json:"backup_eligible"`
+	Name           string     `json:"name"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+const passkeyColumns = `id, user_id, credential_id, public_key, algorithm, sign_count, aaguid, transports,
+	backup_eligible, name, last_used_at, created_at`
+
+// CreatePasskey stores a passkey registered by a user
+func (u *UserAPI) CreatePasskey(ctx context.Context, passkey *Passkey) error {
+	transports, err := json.Marshal(passkey.Transports)
+	if err != nil {
+		return err
+	}
+	err = QueryRow(ctx, `
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, algorithm, sign_count, aaguid,
+			transports, backup_eligible, name)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at`,
+		passkey.UserID, passkey.CredentialID, passkey.PublicKey, passkey.Algorithm, int64(passkey.SignCount),
+		passkey.AAGUID, transports, passkey.BackupEligible, []byte(passkey.Name),
+	).Scan(&passkey.ID, &passkey.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create passkey: %w", err)
+	}
+	return nil
+}
+
+// ListPasskeys lists the passkeys of a user, newest first
+func (u *UserAPI) ListPasskeys(ctx context.Context, userID int) ([]Passkey, error) {
+	rows, err := Query(ctx, `
+		SELECT `+passkeyColumns+`
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	passkeys := []Passkey{}
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, *passkey)
+	}
+	return passkeys, rows.Err()
+}
+
+// GetPasskeyByCredentialID returns the passkey of a credential ID
+func (u *UserAPI) GetPasskeyByCredentialID(ctx context.Context, credentialID []byte) (*Passkey, error) {
+	passkey, err := scanPasskey(QueryRow(ctx, `SELECT `+passkeyColumns+` FROM webauthn_credentials WHERE credential_id = $1`, credentialID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPasskeyNotFound
+	}
+	return passkey, err
+}
+
+// RecordPasskeyUse stores the signature counter of a login with a passkey
+func (u *UserAPI) RecordPasskeyUse(ctx context.Context, id int, signCount uint32) error {
+	_, err := Exec(ctx, `
+		UPDATE webauthn_credentials SET sign_count = $2, last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, id, int64(signCount))
+	if err != nil {
+		return fmt.Errorf("failed to record passkey use: %w", err)
+	}
+	return nil
+}
+
+// RenamePasskey renames a passkey of a user
+func (u *UserAPI) RenamePasskey(ctx context.Context, userID, id int, name string) error {
+	tag, err := Exec(ctx, `UPDATE webauthn_credentials SET name = $3 WHERE id = $1 AND user_id = $2`, id, userID, []byte(name))
+	if err != nil {
+		return fmt.Errorf("failed to rename passkey: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// DeletePasskey removes a passkey of a user
+func (u *UserAPI) DeletePasskey(ctx context.Context, userID, id int) error {
+	tag, err := Exec(ctx, `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+func scanPasskey(row pgx.Row) (*Passkey, error) {
+	passkey := &Passkey{}
+	var signCount int64
+	var transports []byte
+	err := row.Scan(&passkey.ID, &passkey.UserID, &passkey.CredentialID, &passkey.PublicKey, &passkey.Algorithm,
+		&signCount, &passkey.AAGUID, &transports, &passkey.BackupEligible, &passkey.Name, &passkey.LastUsedAt,
+		&passkey.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan passkey: %w", err)
+	}
+	passkey.SignCount = uint32(signCount)
+	if err := json.Unmarshal(transports, &passkey.Transports); err != nil {
+		return nil, fmt.Errorf("failed to decode passkey transports: %w", err)
+	}
+	return passkey, nil
+}
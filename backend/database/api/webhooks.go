@@ -0,0 +1,354 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrWebhookNotFound is returned when a webhook does not exist for an app
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrWebhookDeliveryNotFound is returned when a delivery does not exist for a webhook
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook posts the events of an app it subscribes to, signed with its secret
+type Webhook struct {
+	ID          int       `json:"id"`
+	AppName     string    `json:"app_name"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"-"` // encrypted
+	Events      []string  `json:"events"`
+	Description string    `json:"description"`
+	Enabled     bool      `json:"enabled"`
+	CreatedBy   *int      `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is an event sent, or to be sent, to a webhook with the outcome of its last attempt
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	WebhookID     int             `json:"webhook_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	ResponseCode  *int            `json:"response_code,omitempty"`
+	ResponseBody  *string         `json:"response_body,omitempty"`
+	Error         *string         `json:"error,omitempty"`
+	DurationMs    *int            `json:"duration_ms,omitempty"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+const webhookColumns = `id, app_name, url, secret, events, description, enabled, created_by, created_at, updated_at`
+
+const webhookDeliveryColumns = `id, webhook_id, event, payload, status, attempts, response_code, response_body, error,
+	duration_ms, next_attempt_at, delivered_at, created_at`
+
+func scanWebhook(row pgx.Row) (*Webhook, error) {
+	webhook := &Webhook{}
+	err := row.Scan(&webhook.ID, &webhook.AppName, &webhook.URL, &webhook.Secret, &webhook.Events,
+		&webhook.Description, &webhook.Enabled, &webhook.CreatedBy, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+func scanWebhookDelivery(row pgx.Row) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{}
+	var payload []byte
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status,
+		&delivery.Attempts, &delivery.ResponseCode, &delivery.ResponseBody, &delivery.Error, &delivery.DurationMs,
+		&delivery.NextAttemptAt, &delivery.DeliveredAt, &delivery.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+	}
+	delivery.Payload = payload
+	return delivery, nil
+}
+
+func collectWebhooks(rows pgx.Rows) ([]Webhook, error) {
+	defer rows.Close()
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func collectWebhookDeliveries(rows pgx.Rows) ([]WebhookDelivery, error) {
+	defer rows.Close()
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// CreateWebhook stores a new webhook of an app and sets its ID and timestamps
+func (w *WebhookAPI) CreateWebhook(ctx context.Context, webhook *Webhook) error {
+	if err := ValidateArgs(webhook.AppName); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// URLs and descriptions are free text, pass them as bytes so they skip argument validation
+	err := QueryRow(ctx, `
+		INSERT INTO app_webhooks (app_name, url, secret, events, description, enabled, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at`,
+		webhook.AppName, []byte(webhook.URL), []byte(webhook.Secret), webhook.Events, []byte(webhook.Description),
+		webhook.Enabled, webhook.CreatedBy,
+	).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+// UpdateWebhook stores the editable fields of a webhook, including its secret
+func (w *WebhookAPI) UpdateWebhook(ctx context.Context, webhook *Webhook) error {
+	if err := ValidateArgs(webhook.AppName, webhook.ID); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	err := QueryRow(ctx, `
+		UPDATE app_webhooks
+		SET url = $3, secret = $4, events = $5, description = $6, enabled = $7
+		WHERE app_name = $1 AND id = $2
+		RETURNING updated_at`,
+		webhook.AppName, webhook.ID, []byte(webhook.URL), []byte(webhook.Secret), webhook.Events,
+		[]byte(webhook.Description), webhook.Enabled,
+	).Scan(&webhook.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebhook removes a webhook of an app with its deliveries
+func (w *WebhookAPI) DeleteWebhook(ctx context.Context, appName string, id int) error {
+	if err := ValidateArgs(appName, id); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	tag, err := Exec(ctx, `DELETE FROM app_webhooks WHERE app_name = $1 AND id = $2`, appName, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// GetWebhook returns a webhook of an app
+func (w *WebhookAPI) GetWebhook(ctx context.Context, appName string, id int) (*Webhook, error) {
+	if err := ValidateArgs(appName, id); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	webhook, err := scanWebhook(QueryRow(ctx, `SELECT `+webhookColumns+` FROM app_webhooks WHERE app_name = $1 AND id = $2`, appName, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	return webhook, err
+}
+
+// GetWebhookByID returns a webhook by ID, whatever its app
+func (w *WebhookAPI) GetWebhookByID(ctx context.Context, id int) (*Webhook, error) {
+	webhook, err := scanWebhook(QueryRow(ctx, `SELECT `+webhookColumns+` FROM app_webhooks WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	return webhook, err
+}
+
+// ListWebhooks lists the webhooks of an app, oldest first
+func (w *WebhookAPI) ListWebhooks(ctx context.Context, appName string) ([]Webhook, error) {
+	if err := ValidateArgs(appName); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `SELECT `+webhookColumns+` FROM app_webhooks WHERE app_name = $1 ORDER BY id`, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	return collectWebhooks(rows)
+}
+
+// ListSubscribedWebhooks lists the enabled webhooks of an app subscribed to an event
+func (w *WebhookAPI) ListSubscribedWebhooks(ctx context.Context, appName, event string) ([]Webhook, error) {
+	if err := ValidateArgs(appName, event); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `
+		SELECT `+webhookColumns+`
+		FROM app_webhooks
+		WHERE app_name = $1 AND enabled AND $2 = ANY(events)
+		ORDER BY id`, appName, event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscribed webhooks: %w", err)
+	}
+	return collectWebhooks(rows)
+}
+
+// ListAppsSubscribedTo lists the apps with an enabled webhook subscribed to an event
+func (w *WebhookAPI) ListAppsSubscribedTo(ctx context.Context, event string) ([]string, error) {
+	if err := ValidateArgs(event); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	rows, err := Query(ctx, `SELECT DISTINCT app_name FROM app_webhooks WHERE enabled AND $1 = ANY(events)`, event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscribed apps: %w", err)
+	}
+	defer rows.Close()
+
+	apps := []string{}
+	for rows.Next() {
+		var appName string
+		if err := rows.Scan(&appName); err != nil {
+			return nil, err
+		}
+		apps = append(apps, appName)
+	}
+	return apps, rows.Err()
+}
+
+// CreateWebhookDelivery stores a delivery to attempt at delivery.NextAttemptAt and sets its ID
+func (w *WebhookAPI) CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	if err := ValidateArgs(delivery.Event, delivery.Status); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	err := QueryRow(ctx, `
+		INSERT INTO app_webhook_deliveries (webhook_id, event, payload, status, next_attempt_at)
+		VALUES ($1, $2, $3::jsonb, $4, $5)
+		RETURNING id, created_at`,
+		delivery.WebhookID, delivery.Event, []byte(delivery.Payload), delivery.Status, delivery.NextAttemptAt,
+	).Scan(&delivery.ID, &delivery.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// RecordWebhookAttempt stores the outcome of an attempt to send a delivery
+func (w *WebhookAPI) RecordWebhookAttempt(ctx context.Context, delivery *WebhookDelivery) error {
+	if err := ValidateArgs(delivery.Status); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// Response bodies and errors come from the receiver, pass them as bytes so they skip argument validation
+	var responseBody, errorMessage []byte
+	if delivery.ResponseBody != nil {
+		responseBody = []byte(*delivery.ResponseBody)
+	}
+	if delivery.Error != nil {
+		errorMessage = []byte(*delivery.Error)
+	}
+
+	_, err := Exec(ctx, `
+		UPDATE app_webhook_deliveries
+		SET status = $2, attempts = $3, response_code = $4, response_body = $5, error = $6, duration_ms = $7,
+		    next_attempt_at = $8, delivered_at = $9
+		WHERE id = $1`,
+		delivery.ID, delivery.Status, delivery.Attempts, delivery.ResponseCode, responseBody, errorMessage,
+		delivery.DurationMs, delivery.NextAttemptAt, delivery.DeliveredAt)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook attempt: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueWebhookDeliveries returns the pending deliveries due for an attempt, pushing their next
+// attempt back by lease so that another instance doesn't send them at the same time
+func (w *WebhookAPI) ClaimDueWebhookDeliveries(ctx context.Context, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	rows, err := Query(ctx, `
+		UPDATE app_webhook_deliveries
+		SET next_attempt_at = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM app_webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+webhookDeliveryColumns, int(lease.Seconds()), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	return collectWebhookDeliveries(rows)
+}
+
+// ListWebhookDeliveries lists the deliveries of a webhook, newest first
+func (w *WebhookAPI) ListWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]WebhookDelivery, error) {
+	rows, err := ReadQuery(ctx, `
+		SELECT `+webhookDeliveryColumns+`
+		FROM app_webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return collectWebhookDeliveries(rows)
+}
+
+// RetryWebhookDelivery makes a delivery of a webhook pending again, due now
+func (w *WebhookAPI) RetryWebhookDelivery(ctx context.Context, webhookID int, id int64) (*WebhookDelivery, error) {
+	delivery, err := scanWebhookDelivery(QueryRow(ctx, `
+		UPDATE app_webhook_deliveries
+		SET status = 'pending', next_attempt_at = CURRENT_TIMESTAMP
+		WHERE webhook_id = $1 AND id = $2
+		RETURNING `+webhookDeliveryColumns, webhookID, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	return delivery, err
+}
+
+// PruneWebhookDeliveries deletes the finished deliveries created before a time
+func (w *WebhookAPI) PruneWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := Exec(ctx, `
+		DELETE FROM app_webhook_deliveries
+		WHERE status <> 'pending' AND created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune webhook deliveries: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -2,11 +2,13 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 
 	"backend/database/api"
 	"backend/models"
+	"backend/utils"
 )
 
 // SaveAppDeployment saves or updates app deployment information using the new API
@@ -69,4 +71,216 @@ func UpdateAppDeploymentStatus(appName, status string) error {
 	
 	log.Printf("[DB] ✅ App deployment status updated: %s -> %s", appName, status)
 	return nil
-} 
\ No newline at end of file
+} 
+// StartDeploymentRecord records the start of a deploy attempt, tag is set for deploys of a pushed tag
+func StartDeploymentRecord(appName, gitURL, branch, commit, tag string, activity *Activity, userID *int, triggerType TriggerType) (*api.DeploymentRecord, error) {
+	record := &api.DeploymentRecord{
+		AppName:     appName,
+		GitURL:      gitURL,
+		GitBranch:   branch,
+		GitCommit:   commit,
+		GitTag:      tag,
+		TriggerType: string(triggerType),
+		UserID:      userID,
+	}
+	if activity != nil {
+		record.ActivityID = &activity.ID
+	}
+
+	return createDeploymentRecord(record)
+}
+
+// RecordPendingApproval records a deploy attempt of a production app that waits for the approval
+// of an admin before it is built, and marks its activity as waiting too
+func RecordPendingApproval(appName, gitURL, branch, commit, tag string, activity *Activity, userID *int, triggerType TriggerType) (*api.DeploymentRecord, error) {
+	record := &api.DeploymentRecord{
+		AppName:     appName,
+		GitURL:      gitURL,
+		GitBranch:   branch,
+		GitCommit:   commit,
+		GitTag:      tag,
+		Status:      string(StatusPendingApproval),
+		TriggerType: string(triggerType),
+		UserID:      userID,
+	}
+	if activity != nil {
+		record.ActivityID = &activity.ID
+		if err := SetActivityStatus(activity.ID, StatusPendingApproval); err != nil {
+			log.Printf("[DEPLOY] ⚠️ Failed to mark activity %d as waiting for approval: %v", activity.ID, err)
+		}
+	}
+
+	return createDeploymentRecord(record)
+}
+
+// StartPromotionRecord records the start of a deploy of the image built by another app's deployment,
+// linking it to the source deployment
+func StartPromotionRecord(appName string, source *api.DeploymentRecord, activity *Activity, userID *int) (*api.DeploymentRecord, error) {
+	record := &api.DeploymentRecord{
+		AppName:            appName,
+		GitURL:             source.GitURL,
+		GitBranch:          source.GitBranch,
+		GitCommit:          source.GitCommit,
+		GitTag:             source.GitTag,
+		SourceApp:          source.AppName,
+		SourceDeploymentID: &source.ID,
+		TriggerType:        string(TriggerManual),
+		UserID:             userID,
+	}
+	if activity != nil {
+		record.ActivityID = &activity.ID
+	}
+
+	return createDeploymentRecord(record)
+}
+
+// StartImageDeploymentRecord records the start of a deploy of a prebuilt registry image
+func StartImageDeploymentRecord(appName, image string, activity *Activity, userID *int) (*api.DeploymentRecord, error) {
+	record := &api.DeploymentRecord{
+		AppName:     appName,
+		SourceImage: image,
+		TriggerType: string(TriggerManual),
+		UserID:      userID,
+	}
+	if activity != nil {
+		record.ActivityID = &activity.ID
+	}
+
+	return createDeploymentRecord(record)
+}
+
+// StartArchiveDeploymentRecord records the start of a deploy of an uploaded archive, identified by
+// its sha256 digest
+func StartArchiveDeploymentRecord(appName, digest string, activity *Activity, userID *int) (*api.DeploymentRecord, error) {
+	record := &api.DeploymentRecord{
+		AppName:       appName,
+		SourceArchive: digest,
+		TriggerType:   string(TriggerManual),
+		UserID:        userID,
+	}
+	if activity != nil {
+		record.ActivityID = &activity.ID
+	}
+
+	return createDeploymentRecord(record)
+}
+
+// StartRetryRecord records the start of a re-run of a failed deployment with the same git source,
+// linking it to the failed deployment
+func StartRetryRecord(failed *api.DeploymentRecord, activity *Activity, userID *int) (*api.DeploymentRecord, error) {
+	record := &api.DeploymentRecord{
+		AppName:     failed.AppName,
+		GitURL:      failed.GitURL,
+		GitBranch:   failed.GitBranch,
+		GitCommit:   failed.GitCommit,
+		GitTag:      failed.GitTag,
+		RetryOfID:   &failed.ID,
+		TriggerType: string(TriggerManual),
+		UserID:      userID,
+	}
+	if activity != nil {
+		record.ActivityID = &activity.ID
+	}
+
+	return createDeploymentRecord(record)
+}
+
+// createDeploymentRecord stores a new deploy attempt, which numbers its release, and adds the
+// release to the details of its activity
+func createDeploymentRecord(record *api.DeploymentRecord) (*api.DeploymentRecord, error) {
+	if err := api.Deployments.CreateDeploymentRecord(context.Background(), record); err != nil {
+		return nil, err
+	}
+	log.Printf("[DEPLOY] Release %s of %s started (deployment %d)", record.ReleaseLabel(), record.AppName, record.ID)
+
+	if record.ActivityID != nil {
+		details := map[string]interface{}{"deployment_id": record.ID, "release_number": record.ReleaseNumber}
+		if record.GitTag != "" {
+			details["git_tag"] = record.GitTag
+		}
+		if err := api.Activities.MergeActivityDetails(context.Background(), *record.ActivityID, details); err != nil {
+			log.Printf("[DEPLOY] ⚠️ Failed to add release %s to activity %d: %v", record.ReleaseLabel(), *record.ActivityID, err)
+		}
+	}
+	return record, nil
+}
+
+// NameRelease names the release of a deployment, an empty name removes it, and records the name
+// on its activity
+func NameRelease(record *api.DeploymentRecord, name string) error {
+	if err := api.Deployments.SetReleaseName(context.Background(), record.AppName, record.ID, name); err != nil {
+		return err
+	}
+	record.ReleaseName = name
+
+	if record.ActivityID != nil {
+		details := map[string]interface{}{"release_name": name}
+		if err := api.Activities.MergeActivityDetails(context.Background(), *record.ActivityID, details); err != nil {
+			log.Printf("[DEPLOY] ⚠️ Failed to add release name to activity %d: %v", *record.ActivityID, err)
+		}
+	}
+	return nil
+}
+
+// FinishDeploymentRecord stores the outcome, build logs and diagnostics of a deploy attempt
+func FinishDeploymentRecord(id int, status ActivityStatus, logs string, deployErr error, diagnostics *utils.DeployDiagnostics) error {
+	errorMessage := ""
+	if deployErr != nil {
+		errorMessage = deployErr.Error()
+	}
+
+	var diagnosticsJSON []byte
+	if diagnostics != nil {
+		data, err := json.Marshal(diagnostics)
+		if err != nil {
+			utils.WarnLog("Failed to encode diagnostics of deployment %d: %v", id, err)
+		} else {
+			diagnosticsJSON = data
+		}
+	}
+	return api.Deployments.FinishDeploymentRecord(context.Background(), id, string(status), logs, errorMessage, diagnosticsJSON)
+}
+
+// GetDeploymentDiagnostics retrieves the diagnostics recorded for a deploy attempt
+func GetDeploymentDiagnostics(appName string, id int) (json.RawMessage, error) {
+	return api.Deployments.GetDeploymentDiagnostics(context.Background(), appName, id)
+}
+
+// RecordDeploymentImage stores the Docker image a deploy attempt built
+func RecordDeploymentImage(id int, imageID string) error {
+	return api.Deployments.SetDeploymentImage(context.Background(), id, imageID)
+}
+
+// RecordDeploymentImageReport stores the size and docker history layers of the image of a deploy
+// attempt
+func RecordDeploymentImageReport(id int, size int64, layers []utils.ImageLayer) error {
+	data, err := json.Marshal(layers)
+	if err != nil {
+		return fmt.Errorf("failed to encode image layers: %w", err)
+	}
+	return api.Deployments.SetDeploymentImageReport(context.Background(), id, size, data)
+}
+
+// GetLatestSuccessfulDeployment retrieves the newest successful deploy attempt of an app
+func GetLatestSuccessfulDeployment(appName string) (*api.DeploymentRecord, error) {
+	return api.Deployments.GetLatestSuccessfulDeployment(context.Background(), appName)
+}
+
+// ListDeploymentRecords lists the deploy attempts of an app, newest first
+func ListDeploymentRecords(appName string, limit, offset int) ([]api.DeploymentRecord, int, error) {
+	ctx := context.Background()
+	records, err := api.Deployments.ListDeploymentRecords(ctx, appName, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := api.Deployments.CountDeploymentRecords(ctx, appName)
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// GetDeploymentRecord retrieves a deploy attempt of an app including its logs
+func GetDeploymentRecord(appName string, id int) (*api.DeploymentRecord, error) {
+	return api.Deployments.GetDeploymentRecord(context.Background(), appName, id)
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+)
+
+// ErrBuildQuotaExceeded is wrapped by the errors of deployments refused by a build quota
+var ErrBuildQuotaExceeded = errors.New("build quota exceeded")
+
+// Limits of a build quota
+const (
+	BuildLimitMonthlyMinutes = "monthly_minutes"
+	BuildLimitMaxConcurrent  = "max_concurrent"
+)
+
+// BuildQuotaError tells which quota refused a deployment
+type BuildQuotaError struct {
+	Scope   string  `json:"scope"`
+	Subject string  `json:"subject"`
+	Limit   string  `json:"limit"`
+	Used    float64 `json:"used"`
+	Max     int     `json:"max"`
+	// ResetsAt is when the monthly minutes are available again
+	ResetsAt *time.Time `json:"resets_at,omitempty"`
+}
+
+func (e *BuildQuotaError) Error() string {
+	if e.Limit == BuildLimitMaxConcurrent {
+		return fmt.Sprintf("%s %s already runs %d of its %d concurrent deployments", e.Scope, e.Subject, int(e.Used), e.Max)
+	}
+	return fmt.Sprintf("%s %s used %.0f of its %d build minutes this month", e.Scope, e.Subject, e.Used, e.Max)
+}
+
+func (e *BuildQuotaError) Unwrap() error {
+	return ErrBuildQuotaExceeded
+}
+
+// BuildUsagePeriod returns the UTC calendar month t falls in, the period monthly minutes are
+// counted over
+func BuildUsagePeriod(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// CheckBuildQuota checks the quotas of an app, the user submitting a deployment and their team
+// before the deployment starts. Quotas that can't be read don't block deployments.
+func CheckBuildQuota(ctx context.Context, appName string, userID *int) error {
+	if DB == nil {
+		return nil
+	}
+
+	subjects := map[string]string{api.BuildScopeApp: appName}
+	if userID != nil {
+		subjects[api.BuildScopeUser] = strconv.Itoa(*userID)
+		team, err := api.Users.GetUserTeam(ctx, *userID)
+		if err != nil {
+			utils.WarnLog("Failed to read the team of user %d: %v", *userID, err)
+		} else if team != "" {
+			subjects[api.BuildScopeTeam] = team
+		}
+	}
+
+	maxBuild := utils.GetMaxBuildDuration()
+	start, end := BuildUsagePeriod(time.Now())
+	for _, scope := range []string{api.BuildScopeApp, api.BuildScopeUser, api.BuildScopeTeam} {
+		subject, ok := subjects[scope]
+		if !ok {
+			continue
+		}
+		quota, err := api.Deployments.GetBuildQuota(ctx, scope, subject)
+		if errors.Is(err, api.ErrBuildQuotaNotFound) {
+			continue
+		}
+		if err != nil {
+			utils.WarnLog("Failed to read the build quota of %s %s: %v", scope, subject, err)
+			continue
+		}
+
+		if quota.MaxConcurrent != nil {
+			running, err := api.Deployments.CountRunningBuilds(ctx, scope, subject, maxBuild)
+			if err != nil {
+				utils.WarnLog("Failed to count running builds of %s %s: %v", scope, subject, err)
+			} else if running >= *quota.MaxConcurrent {
+				return &BuildQuotaError{Scope: scope, Subject: subject, Limit: BuildLimitMaxConcurrent,
+					Used: float64(running), Max: *quota.MaxConcurrent}
+			}
+		}
+		if quota.MonthlyMinutes != nil {
+			usage, err := api.Deployments.ListBuildUsage(ctx, scope, subject, start, end, maxBuild)
+			if err != nil {
+				utils.WarnLog("Failed to read build usage of %s %s: %v", scope, subject, err)
+			} else if len(usage) > 0 && usage[0].BuildMinutes >= float64(*quota.MonthlyMinutes) {
+				return &BuildQuotaError{Scope: scope, Subject: subject, Limit: BuildLimitMonthlyMinutes,
+					Used: usage[0].BuildMinutes, Max: *quota.MonthlyMinutes, ResetsAt: &end}
+			}
+		}
+	}
+	return nil
+}
@@ -27,7 +27,7 @@ func ConnectDB() {
 
 	// Build connection string
 	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBSSLMode)
+		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBSSLMode) + primaryConnAttrs(cfg.DBHost)
 
 	// Enhanced connection pool configuration
 	poolConfig, err := pgxpool.ParseConfig(connStr)
@@ -36,25 +36,10 @@ func ConnectDB() {
 		log.Fatalf("Failed to parse database config: %v", err)
 	}
 
-	// Optimize connection pool settings based on environment
-	if utils.IsProductionEnvironment() {
-		// Production settings - more conservative
-		poolConfig.MaxConns = 25
-		poolConfig.MinConns = 5
-		poolConfig.MaxConnLifetime = time.Hour
-		poolConfig.MaxConnIdleTime = time.Minute * 30
-		poolConfig.HealthCheckPeriod = time.Minute * 1
-	} else {
-		// Development settings - lighter load
-		poolConfig.MaxConns = 10
-		poolConfig.MinConns = 2
-		poolConfig.MaxConnLifetime = time.Minute * 30
-		poolConfig.MaxConnIdleTime = time.Minute * 10
-		poolConfig.HealthCheckPeriod = time.Minute * 2
-	}
-	
-	// Connection timeout settings
-	poolConfig.ConnConfig.ConnectTimeout = time.Second * 10
+	// Pool settings default by environment, the stored ones are applied once migrations ran
+	poolBaseConfig = poolConfig.Copy()
+	poolBuiltSettings = DefaultPoolSettings()
+	configurePool(poolConfig, poolBuiltSettings)
 
 	utils.DatabaseDebugLog("Pool config - MaxConns: %d, MinConns: %d, MaxLifetime: %v", 
 		poolConfig.MaxConns, poolConfig.MinConns, poolConfig.MaxConnLifetime)
@@ -113,6 +98,8 @@ func ConnectDB() {
 	// Initialize the database API with the connection pool
 	api.InitDB(DB)
 	utils.StartupLog("Database API initialized")
+
+	connectReplicas(cfg)
 }
 
 // CloseDB gracefully closes the database connection
@@ -125,6 +112,7 @@ func CloseDB() {
 		utils.DatabaseDebugLog("Final pool stats - Total: %d, Idle: %d, Used: %d", 
 			stats.TotalConns(), stats.IdleConns(), stats.AcquiredConns())
 		
+		api.CloseReplicas()
 		DB.Close()
 		utils.StartupLog("Database connection closed")
 	}
@@ -140,14 +128,21 @@ func GetDBStats() map[string]interface{} {
 	
 	stats := DB.Stat()
 	return map[string]interface{}{
-		"status":          "connected",
-		"max_conns":       stats.MaxConns(),
-		"total_conns":     stats.TotalConns(),
-		"idle_conns":      stats.IdleConns(),
-		"acquired_conns":  stats.AcquiredConns(),
-		"new_conns_count": stats.NewConnsCount(),
-		"acquire_count":   stats.AcquireCount(),
-		"cancel_count":    stats.CanceledAcquireCount(),
+		"status":               "connected",
+		"max_conns":            stats.MaxConns(),
+		"total_conns":          stats.TotalConns(),
+		"idle_conns":           stats.IdleConns(),
+		"acquired_conns":       stats.AcquiredConns(),
+		"new_conns_count":      stats.NewConnsCount(),
+		"acquire_count":        stats.AcquireCount(),
+		"cancel_count":         stats.CanceledAcquireCount(),
+		"constructing_conns":   stats.ConstructingConns(),
+		"empty_acquire_count":  stats.EmptyAcquireCount(),
+		"acquire_duration_ms":  stats.AcquireDuration().Milliseconds(),
+		"max_lifetime_destroy": stats.MaxLifetimeDestroyCount(),
+		"max_idle_destroy":     stats.MaxIdleDestroyCount(),
+		"pool_settings":        EffectivePoolSettings(),
+		"replicas":             api.ReplicaStatuses(),
 	}
 }
 
@@ -201,11 +196,12 @@ func CreateAdminUserFromEnv() error {
 
 	// Create admin user with upsert
 	createAdminUser := `
-	INSERT INTO users (username, password, email)
-	VALUES ($1, $2, $3)
+	INSERT INTO users (username, password, email, is_admin)
+	VALUES ($1, $2, $3, true)
 	ON CONFLICT (username) DO UPDATE SET
 		password = EXCLUDED.password,
 		email = EXCLUDED.email,
+		is_admin = true,
 		updated_at = CURRENT_TIMESTAMP;`
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
@@ -0,0 +1,538 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrDeployQueueTimeout is returned when a deployment waited too long for its turn
+	ErrDeployQueueTimeout = errors.New("deployment waited too long in the deploy queue")
+	// ErrQueuedDeploymentNotFound is returned when no deployment waits in the queue of an app
+	ErrQueuedDeploymentNotFound = errors.New("deployment not found in the deploy queue")
+	// ErrDeployLockLost is the cause a running deployment stops with when its lock couldn't be kept
+	ErrDeployLockLost = errors.New("deployment lost the deploy lock of its app")
+	// errDeployLockNotHeld is returned by a refresh when the lock expired or another ticket holds it
+	errDeployLockNotHeld = errors.New("the deploy lock expired or is held by another deployment")
+)
+
+const (
+	// deployQueueMaxWait bounds how long a deployment waits for the deployments ahead of it
+	deployQueueMaxWait = 2 * time.Hour
+	// deployQueuePoll is how often a waiting deployment checks whether it is its turn
+	deployQueuePoll = time.Second
+	// deployQueueTTL is how long a deployment stays queued or holds the lock without a heartbeat,
+	// so the deployments of a stopped instance don't block an app
+	deployQueueTTL = 30 * time.Second
+)
+
+// Deploy queue states
+const (
+	DeployQueueQueued  = "queued"
+	DeployQueueRunning = "running"
+)
+
+// QueuedDeployment is a deployment holding or waiting for the deploy lock of an app
+type QueuedDeployment struct {
+	// DeploymentID is 0 for deployments that couldn't be recorded
+	DeploymentID int       `json:"deployment_id"`
+	State        string    `json:"state"`
+	Position     int       `json:"position"` // 0 for the running deployment
+	QueuedAt     time.Time `json:"queued_at"`
+}
+
+// queueEntry is a ticket in the queue of an app
+type queueEntry struct {
+	ticket   string
+	queuedAt time.Time
+}
+
+// deployQueueStore keeps the deploy queues and locks. Redis shares them between instances, the
+// in-memory store is used without Redis.
+type deployQueueStore interface {
+	// join appends a ticket to the queue of an app
+	join(ctx context.Context, appName, ticket string, at time.Time) error
+	// turn records that a ticket still waits and takes the deploy lock when the ticket is first in
+	// line. It returns how many tickets are ahead.
+	turn(ctx context.Context, appName, ticket string) (int, bool, error)
+	// refresh keeps the lock of a running ticket, failing when the ticket no longer holds it
+	refresh(ctx context.Context, appName, ticket string) error
+	// leave removes a ticket from the queue and releases the lock it holds
+	leave(ctx context.Context, appName, ticket string) error
+	// list returns the queue of an app in order and the ticket holding its lock
+	list(ctx context.Context, appName string) ([]queueEntry, string, error)
+}
+
+// deployQueue returns the store of the deploy queues
+func deployQueue() deployQueueStore {
+	if IsRedisAvailable() {
+		return redisQueue
+	}
+	return memoryQueue
+}
+
+// DeployQueueBackend names the store of the deploy queues
+func DeployQueueBackend() string {
+	if IsRedisAvailable() {
+		return "redis"
+	}
+	return "memory"
+}
+
+// queuedCancels cancels the deployments of this instance waiting in a queue, by deployment ID
+var queuedCancels = struct {
+	sync.Mutex
+	byID map[int]queuedCancel
+}{byID: make(map[int]queuedCancel)}
+
+type queuedCancel struct {
+	appName string
+	cancel  context.CancelCauseFunc
+}
+
+// DeployTurn is held by a deployment while it runs
+type DeployTurn struct {
+	store        deployQueueStore
+	appName      string
+	deploymentID int
+	ticket       string
+	stop         chan struct{}
+	once         sync.Once
+	ctx          context.Context
+	lose         context.CancelCauseFunc
+}
+
+// Context is cancelled with ErrDeployLockLost when the turn loses the lock, so another deployment
+// of the app may start. The deployment must run under it.
+func (t *DeployTurn) Context() context.Context {
+	return t.ctx
+}
+
+// Release ends the turn so the next deployment of the app can start
+func (t *DeployTurn) Release() {
+	t.once.Do(func() {
+		close(t.stop)
+		t.lose(nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := t.store.leave(ctx, t.appName, t.ticket); err != nil {
+			utils.WarnLog("Failed to release the deploy lock of %s: %v", t.appName, err)
+		}
+	})
+}
+
+// keepAlive refreshes the lock of the turn until it is released, and cancels the deployment when
+// another instance asked for it. Failed refreshes are retried, the turn is only lost, stopping the
+// deployment, once the lock is no longer held or went a whole deployQueueTTL without a refresh,
+// when another deployment of the app may have taken it.
+func (t *DeployTurn) keepAlive() {
+	ticker := time.NewTicker(deployQueueTTL / 3)
+	defer ticker.Stop()
+	refreshed := time.Now()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err := t.store.refresh(ctx, t.appName, t.ticket)
+			switch {
+			case err == nil:
+				refreshed = time.Now()
+			case errors.Is(err, errDeployLockNotHeld) || time.Since(refreshed) >= deployQueueTTL:
+				utils.WarnLog("Lost the deploy lock of %s, stopping the deployment: %v", t.appName, err)
+				t.lose(ErrDeployLockLost)
+				cancel()
+				return
+			default:
+				utils.WarnLog("Failed to refresh the deploy lock of %s, retrying: %v", t.appName, err)
+			}
+			if t.store == redisQueue && cancelRequested(ctx, t.deploymentID) {
+				if err := utils.CancelDeployment(t.appName, t.deploymentID); err == nil {
+					utils.InfoLog("Deployment %d of %s cancelled from another instance", t.deploymentID, t.appName)
+				}
+			}
+			cancel()
+		}
+	}
+}
+
+// WaitDeployTurn queues a deployment of an app and blocks until the deployments queued before it
+// finished, so deploys of an app never run concurrently. onQueued is called once when the
+// deployment has to wait. The returned turn must be released when the deployment ends.
+func WaitDeployTurn(ctx context.Context, appName string, deploymentID int, onQueued func(ahead int)) (*DeployTurn, error) {
+	ticket := "t" + randomTicket()
+	if deploymentID > 0 {
+		ticket = "d" + strconv.Itoa(deploymentID)
+	}
+
+	store := deployQueue()
+	if err := store.join(ctx, appName, ticket, time.Now()); err != nil && store != memoryQueue {
+		utils.WarnLog("Deploy queue unavailable, queueing %s in this instance only: %v", appName, err)
+		store = memoryQueue
+		if err := store.join(ctx, appName, ticket, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	turn := &DeployTurn{store: store, appName: appName, deploymentID: deploymentID, ticket: ticket, stop: make(chan struct{})}
+	turn.ctx, turn.lose = context.WithCancelCause(context.Background())
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	ctx, cancelTimeout := context.WithTimeoutCause(ctx, deployQueueMaxWait, ErrDeployQueueTimeout)
+	defer cancelTimeout()
+	if deploymentID > 0 {
+		queuedCancels.Lock()
+		queuedCancels.byID[deploymentID] = queuedCancel{appName: appName, cancel: cancel}
+		queuedCancels.Unlock()
+		defer func() {
+			queuedCancels.Lock()
+			delete(queuedCancels.byID, deploymentID)
+			queuedCancels.Unlock()
+		}()
+	}
+
+	queued := false
+	for {
+		ahead, acquired, err := store.turn(ctx, appName, ticket)
+		if err != nil && ctx.Err() == nil {
+			utils.WarnLog("Failed to check the deploy queue of %s: %v", appName, err)
+		}
+		if acquired {
+			go turn.keepAlive()
+			return turn, nil
+		}
+		if store == redisQueue && cancelRequested(ctx, deploymentID) {
+			cancel(utils.ErrDeploymentCancelled)
+		}
+		if !queued && err == nil {
+			queued = true
+			utils.InfoLog("Deployment of %s queued, %d ahead of it", appName, ahead)
+			if onQueued != nil {
+				onQueued(ahead)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			turn.Release()
+			return nil, context.Cause(ctx)
+		case <-time.After(deployQueuePoll):
+		}
+	}
+}
+
+// CancelQueuedDeployment removes a deployment waiting in the queue of an app of this instance
+func CancelQueuedDeployment(appName string, deploymentID int) error {
+	queuedCancels.Lock()
+	queued, ok := queuedCancels.byID[deploymentID]
+	queuedCancels.Unlock()
+	if !ok || queued.appName != appName {
+		return ErrQueuedDeploymentNotFound
+	}
+	queued.cancel(utils.ErrDeploymentCancelled)
+	return nil
+}
+
+// RequestDeployCancel asks the instance running or queueing a deployment of an app to cancel it,
+// for deployments started by another instance sharing the Redis queue. It returns
+// ErrQueuedDeploymentNotFound when the deployment isn't in the shared queue.
+func RequestDeployCancel(ctx context.Context, appName string, deploymentID int) error {
+	if !IsRedisAvailable() {
+		return ErrQueuedDeploymentNotFound
+	}
+	entries, _, err := redisQueue.list(ctx, appName)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.ticket == "d"+strconv.Itoa(deploymentID) {
+			return RedisClient.Set(ctx, deployCancelKey(deploymentID), appName, 2*deployQueueTTL).Err()
+		}
+	}
+	return ErrQueuedDeploymentNotFound
+}
+
+// cancelRequested reports whether the cancellation of a deployment was requested through Redis
+func cancelRequested(ctx context.Context, deploymentID int) bool {
+	if deploymentID <= 0 {
+		return false
+	}
+	exists, err := RedisClient.Exists(ctx, deployCancelKey(deploymentID)).Result()
+	return err == nil && exists > 0
+}
+
+// ListDeployQueue returns the running and queued deployments of an app in order
+func ListDeployQueue(ctx context.Context, appName string) ([]QueuedDeployment, error) {
+	entries, holder, err := deployQueue().list(ctx, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	deployments := make([]QueuedDeployment, 0, len(entries))
+	position := 1
+	for _, entry := range entries {
+		deployment := QueuedDeployment{State: DeployQueueQueued, QueuedAt: entry.queuedAt}
+		if id, err := strconv.Atoi(strings.TrimPrefix(entry.ticket, "d")); err == nil && strings.HasPrefix(entry.ticket, "d") {
+			deployment.DeploymentID = id
+		}
+		if entry.ticket == holder {
+			deployment.State = DeployQueueRunning
+		} else {
+			deployment.Position = position
+			position++
+		}
+		deployments = append(deployments, deployment)
+	}
+	return deployments, nil
+}
+
+func randomTicket() string {
+	random := make([]byte, 8)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
+
+// redisDeployQueue keeps each queue in a sorted set scored by queue time, with a heartbeat key
+// per ticket and a lock key holding the ticket of the running deployment
+type redisDeployQueue struct{}
+
+var redisQueue = &redisDeployQueue{}
+
+func deployQueueKey(appName string) string {
+	return "deploy_queue:" + appName
+}
+
+func deployLockKey(appName string) string {
+	return "deploy_lock:" + appName
+}
+
+func deployCancelKey(deploymentID int) string {
+	return "deploy_cancel:" + strconv.Itoa(deploymentID)
+}
+
+func deployTicketKey(appName, ticket string) string {
+	return "deploy_queue:" + appName + ":" + ticket
+}
+
+// refreshLockScript extends the lock when the ticket still holds it
+var refreshLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseLockScript deletes the lock when the ticket still holds it
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+func (q *redisDeployQueue) join(ctx context.Context, appName, ticket string, at time.Time) error {
+	pipe := RedisClient.TxPipeline()
+	pipe.Set(ctx, deployTicketKey(appName, ticket), "1", deployQueueTTL)
+	pipe.ZAddNX(ctx, deployQueueKey(appName), redis.Z{Score: float64(at.UnixMilli()), Member: ticket})
+	pipe.Expire(ctx, deployQueueKey(appName), deployQueueMaxWait+utils.GetMaxBuildDuration())
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (q *redisDeployQueue) turn(ctx context.Context, appName, ticket string) (int, bool, error) {
+	if err := RedisClient.Set(ctx, deployTicketKey(appName, ticket), "1", deployQueueTTL).Err(); err != nil {
+		return 0, false, err
+	}
+	entries, err := q.purge(ctx, appName)
+	if err != nil {
+		return 0, false, err
+	}
+
+	ahead := -1
+	for i, entry := range entries {
+		if entry.ticket == ticket {
+			ahead = i
+			break
+		}
+	}
+	if ahead < 0 {
+		// Dropped as stale after missed heartbeats, the ticket queues again at the end
+		utils.WarnLog("Deployment dropped from the deploy queue of %s, queueing it again", appName)
+		return len(entries), false, q.join(ctx, appName, ticket, time.Now())
+	}
+	if ahead > 0 {
+		return ahead, false, nil
+	}
+
+	acquired, err := RedisClient.SetNX(ctx, deployLockKey(appName), ticket, deployQueueTTL).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	if !acquired {
+		// Held by a deployment outside the queue, e.g. one started before an upgrade
+		holder, err := RedisClient.Get(ctx, deployLockKey(appName)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return 0, false, err
+		}
+		if holder == ticket {
+			return 0, true, nil
+		}
+		return 1, false, nil
+	}
+	return 0, true, nil
+}
+
+// purge drops the tickets whose heartbeat expired and returns the rest in order
+func (q *redisDeployQueue) purge(ctx context.Context, appName string) ([]queueEntry, error) {
+	members, err := RedisClient.ZRangeWithScores(ctx, deployQueueKey(appName), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	pipe := RedisClient.Pipeline()
+	exists := make([]*redis.IntCmd, len(members))
+	for i, member := range members {
+		exists[i] = pipe.Exists(ctx, deployTicketKey(appName, member.Member.(string)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	entries := make([]queueEntry, 0, len(members))
+	var stale []interface{}
+	for i, member := range members {
+		ticket := member.Member.(string)
+		if exists[i].Val() == 0 {
+			stale = append(stale, ticket)
+			continue
+		}
+		entries = append(entries, queueEntry{ticket: ticket, queuedAt: time.UnixMilli(int64(member.Score))})
+	}
+	if len(stale) > 0 {
+		utils.WarnLog("Dropping %d stale deployments from the deploy queue of %s", len(stale), appName)
+		if err := RedisClient.ZRem(ctx, deployQueueKey(appName), stale...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func (q *redisDeployQueue) refresh(ctx context.Context, appName, ticket string) error {
+	pipe := RedisClient.Pipeline()
+	pipe.Set(ctx, deployTicketKey(appName, ticket), "1", deployQueueTTL)
+	// Eval rather than Run, a pipelined EvalSha can't fall back when Redis lost the script
+	held := refreshLockScript.Eval(ctx, pipe, []string{deployLockKey(appName)}, ticket, deployQueueTTL.Milliseconds())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	n, err := held.Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errDeployLockNotHeld
+	}
+	return nil
+}
+
+func (q *redisDeployQueue) leave(ctx context.Context, appName, ticket string) error {
+	pipe := RedisClient.Pipeline()
+	pipe.ZRem(ctx, deployQueueKey(appName), ticket)
+	pipe.Del(ctx, deployTicketKey(appName, ticket))
+	releaseLockScript.Run(ctx, pipe, []string{deployLockKey(appName)}, ticket)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (q *redisDeployQueue) list(ctx context.Context, appName string) ([]queueEntry, string, error) {
+	entries, err := q.purge(ctx, appName)
+	if err != nil {
+		return nil, "", err
+	}
+	holder, err := RedisClient.Get(ctx, deployLockKey(appName)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, "", err
+	}
+	return entries, holder, nil
+}
+
+// memoryDeployQueue keeps the queues of this instance
+type memoryDeployQueue struct {
+	mu      sync.Mutex
+	queues  map[string][]queueEntry
+	holders map[string]string
+}
+
+var memoryQueue = &memoryDeployQueue{queues: make(map[string][]queueEntry), holders: make(map[string]string)}
+
+func (q *memoryDeployQueue) join(ctx context.Context, appName, ticket string, at time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queues[appName] = append(q.queues[appName], queueEntry{ticket: ticket, queuedAt: at})
+	sort.SliceStable(q.queues[appName], func(i, j int) bool {
+		return q.queues[appName][i].queuedAt.Before(q.queues[appName][j].queuedAt)
+	})
+	return nil
+}
+
+func (q *memoryDeployQueue) turn(ctx context.Context, appName, ticket string) (int, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, entry := range q.queues[appName] {
+		if entry.ticket != ticket {
+			continue
+		}
+		if i > 0 {
+			return i, false, nil
+		}
+		if holder := q.holders[appName]; holder != "" && holder != ticket {
+			return 1, false, nil
+		}
+		q.holders[appName] = ticket
+		return 0, true, nil
+	}
+	return 0, false, fmt.Errorf("deployment not in the queue of %s", appName)
+}
+
+func (q *memoryDeployQueue) refresh(ctx context.Context, appName, ticket string) error {
+	return nil
+}
+
+func (q *memoryDeployQueue) leave(ctx context.Context, appName, ticket string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entries := q.queues[appName]
+	for i, entry := range entries {
+		if entry.ticket == ticket {
+			q.queues[appName] = append(entries[:i:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(q.queues[appName]) == 0 {
+		delete(q.queues, appName)
+	}
+	if q.holders[appName] == ticket {
+		delete(q.holders, appName)
+	}
+	return nil
+}
+
+func (q *memoryDeployQueue) list(ctx context.Context, appName string) ([]queueEntry, string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]queueEntry(nil), q.queues[appName]...), q.holders[appName], nil
+}
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PoolSettingKey is the system setting holding the connection pool settings as JSON
+const PoolSettingKey = "database.pool"
+
+// poolExecModes are the query exec modes pool connections can use, see pgx.QueryExecMode
+var poolExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// PoolSettings configures the connection pool of the primary database. Durations are Go
+// durations like "30m".
+type PoolSettings struct {
+	MaxConns          int32  `json:"max_conns"`
+	MinConns          int32  `json:"min_conns"`
+	MaxConnLifetime   string `json:"max_conn_lifetime"`
+	MaxConnIdleTime   string `json:"max_conn_idle_time"`
+	HealthCheckPeriod string `json:"health_check_period"`
+	// The settings below apply to each new connection, so they take effect without a restart
+	ConnectTimeout         string `json:"connect_timeout"`
+	StatementCacheCapacity int    `json:"statement_cache_capacity"`
+	QueryExecMode          string `json:"query_exec_mode"`
+}
+
+var (
+	// poolBaseConfig is the pool config parsed from the connection settings, before tuning
+	poolBaseConfig *pgxpool.Config
+	// poolBuiltSettings are the settings the current pool was created with
+	poolBuiltSettings *PoolSettings
+	// poolConnSettings are the settings new connections are made with
+	poolConnSettings atomic.Pointer[PoolSettings]
+)
+
+// DefaultPoolSettings returns the pool settings used when none are stored, lighter outside
+// production
+func DefaultPoolSettings() *PoolSettings {
+	if utils.IsProductionEnvironment() {
+		return &PoolSettings{
+			MaxConns:               25,
+			MinConns:               5,
+			MaxConnLifetime:        "1h",
+			MaxConnIdleTime:        "30m",
+			HealthCheckPeriod:      "1m",
+			ConnectTimeout:         "10s",
+			StatementCacheCapacity: 512,
+			QueryExecMode:          "cache_statement",
+		}
+	}
+	return &PoolSettings{
+		MaxConns:               10,
+		MinConns:               2,
+		MaxConnLifetime:        "30m",
+		MaxConnIdleTime:        "10m",
+		HealthCheckPeriod:      "2m",
+		ConnectTimeout:         "10s",
+		StatementCacheCapacity: 512,
+		QueryExecMode:          "cache_statement",
+	}
+}
+
+// Validate checks the pool sizes, durations and exec mode are usable
+func (s *PoolSettings) Validate() error {
+	if s.MaxConns < 1 || s.MaxConns > 1000 {
+		return fmt.Errorf("max_conns must be between 1 and 1000")
+	}
+	if s.MinConns < 0 || s.MinConns > s.MaxConns {
+		return fmt.Errorf("min_conns must be between 0 and max_conns")
+	}
+	durations := []struct {
+		name     string
+		value    string
+		min, max time.Duration
+	}{
+		{"max_conn_lifetime", s.MaxConnLifetime, time.Minute, 24 * time.Hour},
+		{"max_conn_idle_time", s.MaxConnIdleTime, time.Minute, 24 * time.Hour},
+		{"health_check_period", s.HealthCheckPeriod, time.Second, time.Hour},
+		{"connect_timeout", s.ConnectTimeout, time.Second, 5 * time.Minute},
+	}
+	for _, d := range durations {
+		value, err := time.ParseDuration(d.value)
+		if err != nil || value < d.min || value > d.max {
+			return fmt.Errorf("%s must be a duration between %s and %s", d.name, d.min, d.max)
+		}
+	}
+	if s.StatementCacheCapacity < 0 || s.StatementCacheCapacity > 10000 {
+		return fmt.Errorf("statement_cache_capacity must be between 0 and 10000")
+	}
+	if _, ok := poolExecModes[s.QueryExecMode]; !ok {
+		return fmt.Errorf("unknown query_exec_mode %q", s.QueryExecMode)
+	}
+	return nil
+}
+
+// duration parses a duration of validated settings
+func (s *PoolSettings) duration(value string) time.Duration {
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// RestartRequired lists the settings differing from the ones the pool was created with. They only
+// take effect once Citizen restarts.
+func (s *PoolSettings) RestartRequired(built *PoolSettings) []string {
+	if built == nil {
+		return nil
+	}
+	changed := []string{}
+	if s.MaxConns != built.MaxConns {
+		changed = append(changed, "max_conns")
+	}
+	if s.MinConns != built.MinConns {
+		changed = append(changed, "min_conns")
+	}
+	if s.duration(s.MaxConnLifetime) != built.duration(built.MaxConnLifetime) {
+		changed = append(changed, "max_conn_lifetime")
+	}
+	if s.duration(s.MaxConnIdleTime) != built.duration(built.MaxConnIdleTime) {
+		changed = append(changed, "max_conn_idle_time")
+	}
+	if s.duration(s.HealthCheckPeriod) != built.duration(built.HealthCheckPeriod) {
+		changed = append(changed, "health_check_period")
+	}
+	return changed
+}
+
+// configurePool applies settings to a pool config. Connection settings are read again for every
+// new connection, so later changes reach the pool as it reconnects.
+func configurePool(poolConfig *pgxpool.Config, settings *PoolSettings) {
+	poolConfig.MaxConns = settings.MaxConns
+	poolConfig.MinConns = settings.MinConns
+	poolConfig.MaxConnLifetime = settings.duration(settings.MaxConnLifetime)
+	poolConfig.MaxConnIdleTime = settings.duration(settings.MaxConnIdleTime)
+	poolConfig.HealthCheckPeriod = settings.duration(settings.HealthCheckPeriod)
+
+	poolConnSettings.Store(settings)
+	poolConfig.BeforeConnect = func(ctx context.Context, connConfig *pgx.ConnConfig) error {
+		current := poolConnSettings.Load()
+		connConfig.ConnectTimeout = current.duration(current.ConnectTimeout)
+		connConfig.StatementCacheCapacity = current.StatementCacheCapacity
+		connConfig.DefaultQueryExecMode = poolExecModes[current.QueryExecMode]
+		return nil
+	}
+}
+
+// GetPoolSettings returns the stored pool settings, or the defaults when none are stored
+func GetPoolSettings(ctx context.Context) *PoolSettings {
+	value, err := api.Settings.GetSystemSetting(ctx, PoolSettingKey)
+	if err != nil {
+		if !errors.Is(err, api.ErrSettingNotFound) {
+			utils.WarnLog("Failed to load database pool settings, using defaults: %v", err)
+		}
+		return DefaultPoolSettings()
+	}
+
+	var stored PoolSettings
+	if err := json.Unmarshal([]byte(value), &stored); err != nil || stored.Validate() != nil {
+		utils.WarnLog("Invalid database pool settings stored, using defaults: %v", err)
+		return DefaultPoolSettings()
+	}
+	return &stored
+}
+
+// EffectivePoolSettings returns the settings the running pool uses: the pool settings it was
+// created with and the connection settings applied last. It is nil without a pool.
+func EffectivePoolSettings() *PoolSettings {
+	if poolBuiltSettings == nil {
+		return nil
+	}
+	effective := *poolBuiltSettings
+	if current := poolConnSettings.Load(); current != nil {
+		effective.ConnectTimeout = current.ConnectTimeout
+		effective.StatementCacheCapacity = current.StatementCacheCapacity
+		effective.QueryExecMode = current.QueryExecMode
+	}
+	return &effective
+}
+
+// SavePoolSettings validates and stores the pool settings. Connection settings apply right away:
+// idle connections are closed and busy ones once released, so the pool reconnects with them. It
+// returns the settings that need a restart.
+func SavePoolSettings(ctx context.Context, settings *PoolSettings) ([]string, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.Settings.SetSystemSetting(ctx, PoolSettingKey, string(value)); err != nil {
+		return nil, err
+	}
+
+	if DB != nil {
+		current := poolConnSettings.Load()
+		poolConnSettings.Store(settings)
+		if current == nil || current.ConnectTimeout != settings.ConnectTimeout ||
+			current.StatementCacheCapacity != settings.StatementCacheCapacity || current.QueryExecMode != settings.QueryExecMode {
+			DB.Reset()
+			utils.InfoLog("Database connection settings changed, pool connections are being renewed")
+		}
+	}
+	return settings.RestartRequired(poolBuiltSettings), nil
+}
+
+// ApplyStoredPoolSettings recreates the pool with the stored settings when they differ from the
+// ones it was created with. It runs at startup, after migrations and before the pool is shared.
+func ApplyStoredPoolSettings(ctx context.Context) error {
+	if DB == nil || poolBaseConfig == nil {
+		return nil
+	}
+
+	settings := GetPoolSettings(ctx)
+	if len(settings.RestartRequired(poolBuiltSettings)) == 0 {
+		if *settings != *poolConnSettings.Load() {
+			poolConnSettings.Store(settings)
+			DB.Reset()
+		}
+		return nil
+	}
+
+	poolConfig := poolBaseConfig.Copy()
+	configurePool(poolConfig, settings)
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		poolConnSettings.Store(poolBuiltSettings)
+		return fmt.Errorf("failed to create the pool with the stored settings: %w", err)
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := pool.Ping(pingCtx); err != nil {
+		pool.Close()
+		poolConnSettings.Store(poolBuiltSettings)
+		return fmt.Errorf("failed to connect with the stored pool settings: %w", err)
+	}
+
+	previous := DB
+	DB = pool
+	poolBuiltSettings = settings
+	api.InitDB(DB)
+	previous.Close()
+	utils.StartupLog("Database pool recreated with the stored settings (max %d connections)", settings.MaxConns)
+	return nil
+}
@@ -359,6 +359,33 @@ func GetJSON(key string, dest interface{}) error {
 	return nil
 }
 
+// TakeJSON retrieves, unmarshals and removes a JSON object in one GETDEL, so a single caller
+// gets it. It reports false when the key doesn't exist: never set, expired or already taken.
+func TakeJSON(key string, dest interface{}) (bool, error) {
+	if RedisClient == nil {
+		return false, fmt.Errorf("redis client not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+
+	jsonStr, err := RedisClient.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		utils.RedisDebugLog("Key not found: %s", key)
+		return false, nil
+	}
+	if err != nil {
+		utils.RedisDebugLog("GetDel failed for key %s: %v", key, err)
+		return false, fmt.Errorf("failed to take key %s: %w", key, err)
+	}
+
+	if err := json.Unmarshal([]byte(jsonStr), dest); err != nil {
+		utils.RedisDebugLog("JSON unmarshal failed for key %s: %v", key, err)
+		return false, fmt.Errorf("failed to unmarshal JSON for key %s: %w", key, err)
+	}
+	return true, nil
+}
+
 // CleanupExpiredKeys removes expired keys matching a pattern (use with caution)
 func CleanupExpiredKeys(pattern string) (int, error) {
 	if RedisClient == nil {
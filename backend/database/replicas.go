@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// primaryFailoverAttrs is added to the primary connection string when DB_HOST lists several
+// hosts, so connections only go to the one that currently accepts writes
+const primaryFailoverAttrs = " target_session_attrs=read-write"
+
+// primaryConnAttrs returns the connection string settings DB_HOST needs for failover
+func primaryConnAttrs(host string) string {
+	if strings.Contains(host, ",") {
+		return primaryFailoverAttrs
+	}
+	return ""
+}
+
+// replicaConnStrings returns the connection strings of the read replicas by name, from
+// DB_REPLICA_HOSTS (comma separated host[:port], with the primary's credentials) and
+// DB_REPLICA_DSNS (space separated connection URLs)
+func replicaConnStrings(cfg *config.Config) map[string]string {
+	connStrs := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("DB_REPLICA_HOSTS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, port := entry, cfg.DBPort
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if n, err := strconv.Atoi(p); err == nil {
+				host, port = h, n
+			}
+		}
+		connStrs[fmt.Sprintf("%s:%d", host, port)] = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+			host, port, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBSSLMode)
+	}
+	for _, dsn := range strings.Fields(os.Getenv("DB_REPLICA_DSNS")) {
+		name := dsn
+		if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+			name = u.Host
+		}
+		connStrs[name] = dsn
+	}
+	return connStrs
+}
+
+// connectReplicas opens a pool for each configured read replica. Replicas are optional: one that
+// can't be reached gets no reads until a check finds it healthy.
+func connectReplicas(cfg *config.Config) {
+	connStrs := replicaConnStrings(cfg)
+	if len(connStrs) == 0 {
+		return
+	}
+
+	pools := make(map[string]*pgxpool.Pool)
+	for name, connStr := range connStrs {
+		poolConfig, err := pgxpool.ParseConfig(connStr)
+		if err != nil {
+			utils.ErrorLog("Invalid read replica %s configuration, it is ignored: %v", name, err)
+			continue
+		}
+		poolConfig.MaxConns = 10
+		poolConfig.MinConns = 1
+		poolConfig.MaxConnIdleTime = time.Minute * 10
+		poolConfig.HealthCheckPeriod = time.Minute
+		poolConfig.ConnConfig.ConnectTimeout = time.Second * 5
+
+		pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+		if err != nil {
+			utils.ErrorLog("Failed to open read replica %s, it is ignored: %v", name, err)
+			continue
+		}
+		pools[name] = pool
+	}
+	api.InitReplicas(pools)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	if err := api.CheckReplicas(ctx); err != nil {
+		utils.WarnLog("%v", err)
+	}
+	utils.StartupLog("Read replicas configured: %d", len(pools))
+}
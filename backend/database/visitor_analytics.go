@@ -0,0 +1,243 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// visitorKeyTTL keeps the Redis counters of a day until the flushes after it are done
+	visitorKeyTTL = 3 * 24 * time.Hour
+	// visitorSettingsTTL is how long the sampled apps are cached, ForwardAuth runs on every request
+	visitorSettingsTTL = time.Minute
+	// maxVisitorPathLength truncates the recorded paths
+	maxVisitorPathLength = 200
+	// maxVisitorPaths bounds the distinct paths kept per app and day, the least requested are dropped
+	maxVisitorPaths = 500
+	// visitorTopCount is how many paths and hosts the daily stats keep
+	visitorTopCount = 10
+	// VisitorStatsRetention is how long daily visitor stats are kept
+	VisitorStatsRetention = 395 * 24 * time.Hour
+)
+
+// visitorSampling caches the sample percent of the apps with visitor analytics enabled
+var visitorSampling = struct {
+	sync.Mutex
+	percent   map[string]int
+	fetchedAt time.Time
+}{}
+
+// visitorSalts caches the salt of the visitor hashes of each day, kept in Redis so every instance
+// counts a visitor once. Salts change daily, so visitors can't be followed across days.
+var visitorSalts = struct {
+	sync.Mutex
+	salts map[string]string
+}{salts: make(map[string]string)}
+
+// RecordVisit samples a request of an app seen by ForwardAuth. Visitors are counted by a hash of
+// their address and user agent, neither is stored. Recording happens in the background, a
+// request is never slowed down or failed by analytics.
+func RecordVisit(appName, host, uri, clientIP, userAgent string) {
+	if RedisClient == nil {
+		return
+	}
+	percent := visitorSamplePercent(appName)
+	if percent == 0 || (percent < 100 && mathrand.Intn(100) >= percent) {
+		return
+	}
+
+	// Fiber reuses the memory of request values once the handler returns
+	appName, host, clientIP, userAgent = strings.Clone(appName), strings.Clone(host), strings.Clone(clientIP), strings.Clone(userAgent)
+	path, _, _ := strings.Cut(uri, "?")
+	if path == "" {
+		path = "/"
+	}
+	if len(path) > maxVisitorPathLength {
+		path = path[:maxVisitorPathLength]
+	}
+	path = strings.Clone(path)
+	weight := int64(100 / percent)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		day := time.Now().UTC().Format(time.DateOnly)
+		salt, err := visitorSalt(ctx, day)
+		if err != nil {
+			utils.RedisDebugLog("Visitor salt unavailable: %v", err)
+			return
+		}
+		sum := sha256.Sum256([]byte(salt + "|" + clientIP + "|" + userAgent))
+		visitor := hex.EncodeToString(sum[:12])
+
+		prefix := visitorKeyPrefix(appName, day)
+		pipe := RedisClient.Pipeline()
+		pipe.IncrBy(ctx, prefix+"requests", weight)
+		pipe.PFAdd(ctx, prefix+"visitors", visitor)
+		pipe.ZIncrBy(ctx, prefix+"paths", float64(weight), path)
+		pipe.ZIncrBy(ctx, prefix+"hosts", float64(weight), host)
+		for _, key := range []string{"requests", "visitors", "paths", "hosts"} {
+			pipe.Expire(ctx, prefix+key, visitorKeyTTL)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			utils.RedisDebugLog("Failed to record visit of %s: %v", appName, err)
+		}
+	}()
+}
+
+// visitorSamplePercent returns the sample percent of an app, 0 when analytics are disabled. The
+// settings are reloaded in the background once stale, requests use the cached ones meanwhile.
+func visitorSamplePercent(appName string) int {
+	visitorSampling.Lock()
+	defer visitorSampling.Unlock()
+	if time.Since(visitorSampling.fetchedAt) >= visitorSettingsTTL {
+		// Retried after visitorSettingsTTL when the database is unavailable
+		visitorSampling.fetchedAt = time.Now()
+		go ReloadVisitorSampling()
+	}
+	return visitorSampling.percent[appName]
+}
+
+// ReloadVisitorSampling reads the sample percents of the apps with visitor analytics enabled
+func ReloadVisitorSampling() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	settings, err := api.Traffic.ListVisitorAnalyticsSettings(ctx)
+	if err != nil {
+		utils.WarnLog("Failed to load visitor analytics settings: %v", err)
+		return
+	}
+
+	percent := make(map[string]int, len(settings))
+	for _, setting := range settings {
+		percent[setting.AppName] = setting.SamplePercent
+	}
+	visitorSampling.Lock()
+	visitorSampling.percent = percent
+	visitorSampling.Unlock()
+}
+
+// visitorSalt returns the salt of a day, created by the first instance to need it
+func visitorSalt(ctx context.Context, day string) (string, error) {
+	visitorSalts.Lock()
+	salt, ok := visitorSalts.salts[day]
+	visitorSalts.Unlock()
+	if ok {
+		return salt, nil
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	key := "analytics:salt:" + day
+	if err := RedisClient.SetNX(ctx, key, hex.EncodeToString(random), visitorKeyTTL).Err(); err != nil {
+		return "", err
+	}
+	salt, err := RedisClient.Get(ctx, key).Result()
+	if err != nil {
+		return "", err
+	}
+
+	visitorSalts.Lock()
+	for cachedDay := range visitorSalts.salts {
+		if cachedDay < day {
+			delete(visitorSalts.salts, cachedDay)
+		}
+	}
+	visitorSalts.salts[day] = salt
+	visitorSalts.Unlock()
+	return salt, nil
+}
+
+func visitorKeyPrefix(appName, day string) string {
+	return "analytics:" + appName + ":" + day + ":"
+}
+
+// FlushVisitorStats copies the Redis counters of today and yesterday to the daily stats of the
+// apps with visitor analytics enabled. Counters are cumulative, a flush replaces the previous one.
+func FlushVisitorStats(ctx context.Context) error {
+	if RedisClient == nil {
+		return nil
+	}
+	settings, err := api.Traffic.ListVisitorAnalyticsSettings(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var errs []error
+	for _, setting := range settings {
+		for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+			stats, err := readVisitorStats(ctx, setting.AppName, day.Truncate(24*time.Hour))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", setting.AppName, err))
+				continue
+			}
+			if stats == nil {
+				continue
+			}
+			if err := api.Traffic.UpsertVisitorStats(ctx, stats); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", setting.AppName, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readVisitorStats reads the counters of an app for a day, nil when there are none
+func readVisitorStats(ctx context.Context, appName string, day time.Time) (*api.VisitorStats, error) {
+	prefix := visitorKeyPrefix(appName, day.Format(time.DateOnly))
+	requests, err := RedisClient.Get(ctx, prefix+"requests").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &api.VisitorStats{AppName: appName, Day: day}
+	stats.Requests, _ = strconv.ParseInt(requests, 10, 64)
+	if stats.Visitors, err = RedisClient.PFCount(ctx, prefix+"visitors").Result(); err != nil {
+		return nil, err
+	}
+	// Keep the set of paths bounded for the rest of the day
+	if err := RedisClient.ZRemRangeByRank(ctx, prefix+"paths", 0, -maxVisitorPaths-1).Err(); err != nil {
+		return nil, err
+	}
+	if stats.TopPaths, err = topVisitorCounts(ctx, prefix+"paths"); err != nil {
+		return nil, err
+	}
+	if stats.TopHosts, err = topVisitorCounts(ctx, prefix+"hosts"); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func topVisitorCounts(ctx context.Context, key string) ([]api.VisitorCount, error) {
+	members, err := RedisClient.ZRevRangeWithScores(ctx, key, 0, visitorTopCount-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]api.VisitorCount, 0, len(members))
+	for _, member := range members {
+		value, _ := member.Member.(string)
+		counts = append(counts, api.VisitorCount{Value: value, Count: int64(member.Score)})
+	}
+	return counts, nil
+}
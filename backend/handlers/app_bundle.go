@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/models"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// appBundleTimeout bounds the export or import of an app bundle, dumps included
+	appBundleTimeout = 30 * time.Minute
+	// minBundlePassphrase is the shortest passphrase an env is sealed with
+	minBundlePassphrase = 12
+)
+
+// ExportAppBundle exports an app to move it to another Citizen instance: its configuration, git
+// source, linked service dumps and, with include_env, its env sealed with the passphrase. The env
+// is only exported after re-authenticating like RevealEnv, without the always masked and protected
+// keys. Every export is audited. The bundle is a gzipped tar to import with ImportAppBundle on the
+// target.
+func ExportAppBundle(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		IncludeEnv      bool   `json:"include_env"`
+		Passphrase      string `json:"passphrase"`
+		IncludeServices *bool  `json:"include_services"`
+		// Re-authentication, required with include_env
+		Password   string                    `json:"password"`
+		CeremonyID string                    `json:"ceremony_id"`
+		Credential *utils.WebAuthnCredential `json:"credential"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Invalid request content",
+				nil,
+			))
+		}
+	}
+	if req.IncludeEnv && len(req.Passphrase) < minBundlePassphrase {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("A passphrase of at least %d characters is required to export the env", minBundlePassphrase),
+			nil,
+		))
+	}
+
+	options := utils.AppBundleOptions{
+		IncludeEnv:      req.IncludeEnv,
+		Passphrase:      req.Passphrase,
+		IncludeServices: req.IncludeServices == nil || *req.IncludeServices,
+	}
+	if gitURL, branch, err := appGitSource(appName); err == nil {
+		options.GitURL, options.GitBranch = gitURL, branch
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+
+	details := map[string]interface{}{"include_env": options.IncludeEnv, "include_services": options.IncludeServices}
+	if options.IncludeEnv {
+		if userID == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+				false,
+				"User not authenticated",
+				nil,
+			))
+		}
+		method, err := verifyReauthentication(c, *userID, req.Password, req.CeremonyID, req.Credential)
+		details["method"] = method
+		if err != nil {
+			auditSystemAction(c, "app_export", appName, details, err)
+			utils.SecurityLog("Export of the env of %s denied for user %d: %v", appName, *userID, err)
+			status := fiber.StatusUnauthorized
+			if !errors.Is(err, errReauthFailed) {
+				status = fiber.StatusBadRequest
+			}
+			return c.Status(status).JSON(utils.NewCitizenResponse(
+				false,
+				err.Error(),
+				nil,
+			))
+		}
+
+		if options.OmitEnvKeys, err = unexportableEnvKeys(c, appName); err != nil {
+			auditSystemAction(c, "app_export", appName, details, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+				false,
+				"Failed to check masked and protected environment variables: "+err.Error(),
+				nil,
+			))
+		}
+		details["omitted_env_keys"] = options.OmitEnvKeys
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), appBundleTimeout)
+	defer cancel()
+	bundle, stream, size, err := utils.BuildAppBundle(ctx, appName, options)
+	auditSystemAction(c, "app_export", appName, details, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to export app: "+err.Error(),
+			nil,
+		))
+	}
+
+	message := fmt.Sprintf("Exported to a bundle with %d services", len(bundle.Services))
+	if options.IncludeEnv {
+		message += " and the sealed env"
+	}
+	if _, err := database.LogConfigActivity(appName, "export", message, userID); err != nil {
+		utils.WarnLog("Failed to log export activity of %s: %v", appName, err)
+	}
+	utils.SecurityLog("App %s exported to a bundle (env: %t, services: %d) by user %v", appName, options.IncludeEnv, len(bundle.Services), userID)
+
+	// The temporary bundle is removed once fasthttp closes the stream
+	c.Set(fiber.HeaderContentType, "application/gzip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-bundle.tar.gz"`, appName))
+	c.Set("X-Citizen-Bundle-Version", strconv.Itoa(bundle.Version))
+	return c.SendStream(stream, int(size))
+}
+
+// unexportableEnvKeys lists the env keys of an app whose values never leave it in a bundle: the
+// always masked keys, which can't be revealed, and the protected keys
+func unexportableEnvKeys(c *fiber.Ctx, appName string) ([]string, error) {
+	masked, err := api.Apps.ListMaskedEnvKeys(c.Context(), appName)
+	if err != nil {
+		return nil, err
+	}
+	protected, err := api.Apps.ListProtectedEnvKeys(c.Context(), appName)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(masked)+len(protected))
+	for _, k := range masked {
+		keys = append(keys, k.Key)
+	}
+	for _, k := range protected {
+		keys = append(keys, k.Key)
+	}
+	return keys, nil
+}
+
+// ImportAppBundle recreates an app exported by another Citizen instance: it creates the app under
+// its name or app_name, sets its env, recreates its services from their dumps and links them,
+// applies its configuration and deploys it from its git source unless deploy is false. The
+// bundle is uploaded as the "bundle" form file, or fetched from bundle_url when it is larger than
+// uploads allow. Steps stop at the first failure, what was created is kept for inspection.
+func ImportAppBundle(c *fiber.Ctx) error {
+	var req struct {
+		BundleURL  string `json:"bundle_url" form:"bundle_url"`
+		AppName    string `json:"app_name" form:"app_name"`
+		Passphrase string `json:"passphrase" form:"passphrase"`
+		Deploy     *bool  `json:"deploy" form:"deploy"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), appBundleTimeout)
+	defer cancel()
+
+	source, err := openAppBundle(ctx, c, req.BundleURL)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	defer source.Close()
+
+	dir, err := os.MkdirTemp("", "citizen-import-*")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to prepare the import: "+err.Error(),
+			nil,
+		))
+	}
+	defer os.RemoveAll(dir)
+
+	bundle, err := utils.ReadAppBundle(source, dir)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid bundle: "+err.Error(),
+			nil,
+		))
+	}
+
+	if req.AppName == "" {
+		req.AppName = bundle.App
+	}
+	check, err := checkAppName(req.AppName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while listing apps: "+err.Error(),
+			nil,
+		))
+	}
+	if !check.Valid {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid app name: "+check.Reason,
+			check,
+		))
+	}
+	if !check.Available {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is already taken, import the bundle under another app_name",
+			check,
+		))
+	}
+	appName := check.Name
+
+	var env map[string]string
+	if bundle.SealedEnv != nil {
+		if req.Passphrase == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"The bundle has a sealed env, the passphrase it was exported with is required",
+				nil,
+			))
+		}
+		if env, err = bundle.SealedEnv.Open(req.Passphrase); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				err.Error(),
+				nil,
+			))
+		}
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+
+	changes, err := utils.PlanAppBundleImport(ctx, bundle, dir, env, utils.AppBundleImport{AppName: appName, UserID: userID})
+	if errors.Is(err, utils.ErrAppBundleConflict) {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(utils.NewCitizenResponse(
+			false,
+			"Bundle can't be imported: "+err.Error(),
+			nil,
+		))
+	}
+
+	ok := utils.ApplyManifestChanges(ctx, changes)
+	var importErr error
+	if !ok {
+		importErr = errors.New("import stopped at a failed step")
+	}
+	auditSystemAction(c, "app_bundle_import", appName, map[string]interface{}{
+		"source_app":  bundle.App,
+		"source_host": bundle.SourceHost,
+		"services":    len(bundle.Services),
+		"env":         len(env),
+	}, importErr)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to import app, the steps before the failed one were applied",
+			fiber.Map{"app_name": appName, "changes": changes},
+		))
+	}
+
+	deployment := &models.AppDeployment{
+		AppName:    appName,
+		Port:       bundle.Manifest.Port,
+		PortSource: "bundle",
+		Builder:    bundle.Manifest.Builder,
+		GitURL:     bundle.GitURL,
+		GitBranch:  bundle.GitBranch,
+		Status:     "pending",
+		LastDeploy: time.Now(),
+	}
+	if err := api.Deployments.UpsertDeployment(ctx, deployment); err != nil {
+		utils.WarnLog("Failed to record the deployment of imported app %s: %v", appName, err)
+	} else if err := api.Deployments.RecordAppImport(ctx, appName, bundle.EnvKeys); err != nil {
+		utils.WarnLog("Failed to record the import of %s: %v", appName, err)
+	}
+	message := fmt.Sprintf("App imported from %s of %s with %d services and %d env vars", bundle.App, bundle.SourceHost, len(bundle.Services), len(env))
+	if _, err := database.LogConfigActivity(appName, "import", message, userID); err != nil {
+		utils.WarnLog("Failed to log import activity of %s: %v", appName, err)
+	}
+
+	deploying := (req.Deploy == nil || *req.Deploy) && bundle.GitURL != ""
+	if deploying {
+		go deployNewApp(deployment, userID, "First deployment after import")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(utils.NewCitizenResponse(
+		true,
+		"App imported",
+		fiber.Map{
+			"app_name":  appName,
+			"changes":   changes,
+			"services":  bundle.Services,
+			"deploying": deploying,
+			"warnings":  bundle.Warnings,
+		},
+	))
+}
+
+// openAppBundle returns the uploaded bundle, or fetches it from bundleURL
+func openAppBundle(ctx context.Context, c *fiber.Ctx, bundleURL string) (io.ReadCloser, error) {
+	if bundleURL == "" {
+		header, err := c.FormFile("bundle")
+		if err != nil {
+			return nil, errors.New("Upload the bundle as the bundle form file or give its bundle_url")
+		}
+		return header.Open()
+	}
+
+	parsed, err := url.Parse(bundleURL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && !(parsed.Scheme == "http" && utils.IsDevelopmentEnvironment())) {
+		return nil, errors.New("bundle_url must be an https URL")
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, bundleURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the bundle: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("failed to fetch the bundle: %s", response.Status)
+	}
+	return response.Body, nil
+}
+
+// deployNewApp runs the first deployment of an app Citizen just set up from its git source, in
+// the background, and records the deployed revision
+func deployNewApp(deployment *models.AppDeployment, userID *int, message string) {
+	appName, gitURL, branch := deployment.AppName, deployment.GitURL, deployment.GitBranch
+	activity, activityErr := database.LogDeployActivity(appName, gitURL, branch, "", message, userID, database.TriggerManual)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log deploy activity: %v\n", activityErr)
+	}
+
+	record, output, err := runTrackedDeployment(nil, appName, gitURL, branch, "", "", activity, userID, database.TriggerManual)
+	if err != nil {
+		utils.WarnLog("First deployment of %s failed: %v", appName, err)
+		return
+	}
+
+	deployment.Status = "deployed"
+	deployment.LastDeploy = time.Now()
+	deployment.DeploymentLogs = output
+	if sha, err := utils.DeployedRevision(appName); err == nil {
+		deployment.GitCommit = sha
+	}
+	if dbErr := database.SaveAppDeployment(deployment); dbErr != nil {
+		fmt.Printf("[DB] ⚠️ Failed to save deployment info: %v\n", dbErr)
+	}
+	if record != nil {
+		utils.InfoLog("App %s deployed for the first time (deployment %d)", appName, record.ID)
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// appBusyRetryAfter is the Retry-After of "app busy" responses, most locks are released by then
+const appBusyRetryAfter = 15
+
+// commandErrorResponse answers a failed dokku command. Commands refused because another
+// operation holds the lock of the app get a 409 "app busy" naming that operation, so clients can
+// retry later; other failures are a 500 with the message and the error.
+func commandErrorResponse(c *fiber.Ctx, message string, err error, data fiber.Map) error {
+	var locked *utils.AppLockedError
+	if !errors.As(err, &locked) {
+		var response interface{}
+		if data != nil {
+			response = data
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			message+": "+err.Error(),
+			response,
+		))
+	}
+
+	if data == nil {
+		data = fiber.Map{}
+	}
+	data["error"] = "app_busy"
+	data["app_name"] = locked.AppName
+	data["command"] = locked.Command
+	data["attempts"] = locked.Attempts
+	data["conflict"] = locked.Conflict
+	data["retry_after"] = appBusyRetryAfter
+
+	busy := "App " + locked.AppName + " is busy"
+	if locked.Conflict != nil && locked.Conflict.Detail != "" {
+		busy += ": " + locked.Conflict.Detail
+	}
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(appBusyRetryAfter))
+	return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+		false,
+		busy+", try again later",
+		data,
+	))
+}
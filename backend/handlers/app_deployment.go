@@ -1,7 +1,15 @@
 package handlers
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
 	"backend/database"
+	"backend/database/api"
 	"backend/models"
 	"backend/utils"
 
@@ -169,4 +177,362 @@ func UpdateAppDeploymentStatus(c *fiber.Ctx) error {
 			"status":   statusData.Status,
 		},
 	))
-} 
\ No newline at end of file
+}
+
+// deploymentLogsURL is the endpoint serving the logs of a single deployment
+func deploymentLogsURL(appName string, deploymentID int) string {
+	return fmt.Sprintf("/api/v1/citizen/apps/%s/deployments/%d/logs", appName, deploymentID)
+}
+
+// deploymentDiagnosticsURL is the endpoint serving the diagnostics of a deployment
+func deploymentDiagnosticsURL(appName string, deploymentID int) string {
+	return fmt.Sprintf("/api/v1/citizen/apps/%s/deployments/%d/diagnostics", appName, deploymentID)
+}
+
+// ListDeploymentHistory lists past deployments of an app with links to their logs
+func ListDeploymentHistory(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	records, total, err := database.ListDeploymentRecords(appName, limit, offset)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve deployment history: "+err.Error(),
+			nil,
+		))
+	}
+
+	deployments := make([]fiber.Map, 0, len(records))
+	for _, record := range records {
+		deployments = append(deployments, fiber.Map{
+			"deployment": record,
+			"logs_url":   deploymentLogsURL(appName, record.ID),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Deployment history retrieved successfully",
+		fiber.Map{
+			"deployments": deployments,
+			"total":       total,
+			"limit":       limit,
+			"offset":      offset,
+		},
+	))
+}
+
+// GetDeploymentHistory retrieves a single past deployment of an app
+func GetDeploymentHistory(c *fiber.Ctx) error {
+	record, err := deploymentRecordFromParams(c)
+	if record == nil {
+		return err
+	}
+
+	// Logs are served by their own endpoint
+	record.Logs = ""
+
+	data := fiber.Map{
+		"deployment":      record,
+		"logs_url":        deploymentLogsURL(record.AppName, record.ID),
+		"diagnostics_url": deploymentDiagnosticsURL(record.AppName, record.ID),
+	}
+	// Pipeline deployments show the status of each stage, stage logs are served by their own endpoint
+	if stages, err := api.Deployments.ListDeploymentStages(c.Context(), record.AppName, record.ID, false); err != nil {
+		utils.WarnLog("Failed to list the stages of deployment %d of %s: %v", record.ID, record.AppName, err)
+	} else if len(stages) > 0 {
+		data["stages"] = stages
+		data["stages_url"] = fmt.Sprintf("/api/v1/citizen/apps/%s/deployments/%d/stages", record.AppName, record.ID)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Deployment retrieved successfully",
+		data,
+	))
+}
+
+// GetDeploymentHistoryLogs returns the build logs of a single past deployment
+func GetDeploymentHistoryLogs(c *fiber.Ctx) error {
+	record, err := deploymentRecordFromParams(c)
+	if record == nil {
+		return err
+	}
+
+	if c.Query("format") == "text" {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.SendString(record.Logs)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Deployment logs retrieved successfully",
+		fiber.Map{
+			"deployment_id": record.ID,
+			"app_name":      record.AppName,
+			"status":        record.Status,
+			"logs":          record.Logs,
+		},
+	))
+}
+
+// GetDeploymentDiagnostics returns the port detection trace and orchestration steps recorded for a deployment
+func GetDeploymentDiagnostics(c *fiber.Ctx) error {
+	record, err := deploymentRecordFromParams(c)
+	if record == nil {
+		return err
+	}
+
+	diagnostics, err := database.GetDeploymentDiagnostics(record.AppName, record.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve deployment diagnostics: "+err.Error(),
+			nil,
+		))
+	}
+
+	// Deployments that ran before diagnostics were recorded, or are still running, have none
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Deployment diagnostics retrieved successfully",
+		fiber.Map{
+			"deployment_id": record.ID,
+			"app_name":      record.AppName,
+			"status":        record.Status,
+			"error_message": record.ErrorMessage,
+			"diagnostics":   diagnostics,
+		},
+	))
+}
+
+// deploymentStreamKeepAlive is how often a comment is sent on an idle deployment stream, so
+// proxies don't close it during long build steps
+const deploymentStreamKeepAlive = 15 * time.Second
+
+// deploymentStreamURL is the endpoint streaming the output of a running deployment
+func deploymentStreamURL(appName string, deploymentID int) string {
+	return fmt.Sprintf("/api/v1/citizen/apps/%s/deployments/%d/stream", appName, deploymentID)
+}
+
+// StreamDeploymentOutput streams the build output of a running deployment as server-sent events
+// while the deploy runs. The output produced before the client connected is sent first, then each
+// line as an "output" event, and an "end" event once the deployment finished.
+func StreamDeploymentOutput(c *fiber.Ctx) error {
+	record, err := deploymentRecordFromParams(c)
+	if record == nil {
+		return err
+	}
+
+	subscription, err := utils.SubscribeDeploymentOutput(record.AppName, record.ID)
+	if err != nil {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			"Deployment is not running, its output is in its logs",
+			fiber.Map{
+				"deployment_id": record.ID,
+				"status":        record.Status,
+				"logs_url":      deploymentLogsURL(record.AppName, record.ID),
+			},
+		))
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	appName, deploymentID := record.AppName, record.ID
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer subscription.Close()
+
+		writeEvent := func(event string, data interface{}) {
+			payload, _ := json.Marshal(data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+		}
+
+		if subscription.Skipped > 0 {
+			writeEvent("skipped", fiber.Map{"lines": subscription.Skipped})
+		}
+		for _, line := range subscription.Replay {
+			writeEvent("output", fiber.Map{"line": line})
+		}
+		if w.Flush() != nil {
+			return
+		}
+
+		keepAlive := time.NewTicker(deploymentStreamKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case line, ok := <-subscription.Lines:
+				if !ok {
+					if subscription.Finished() {
+						writeEvent("end", fiber.Map{
+							"deployment_id":   deploymentID,
+							"logs_url":        deploymentLogsURL(appName, deploymentID),
+							"diagnostics_url": deploymentDiagnosticsURL(appName, deploymentID),
+						})
+					} else {
+						writeEvent("lagged", fiber.Map{"logs_url": deploymentLogsURL(appName, deploymentID)})
+					}
+					w.Flush()
+					return
+				}
+				writeEvent("output", fiber.Map{"line": line})
+				// Lines arriving together are sent together
+				if len(subscription.Lines) > 0 {
+					continue
+				}
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			// A failed flush means the client went away
+			if w.Flush() != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// deploymentRecordFromParams loads the deployment addressed by :app_name and :id. When it returns
+// nil it has already written the error response and the error is the result of that write.
+func deploymentRecordFromParams(c *fiber.Ctx) (*api.DeploymentRecord, error) {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	deploymentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil || deploymentID <= 0 {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid deployment ID",
+			nil,
+		))
+	}
+
+	record, err := database.GetDeploymentRecord(appName, deploymentID)
+	if errors.Is(err, api.ErrDeploymentRecordNotFound) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Deployment not found",
+			nil,
+		))
+	}
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve deployment: "+err.Error(),
+			nil,
+		))
+	}
+
+	return record, nil
+}
+
+// CheckDeploymentIntegrity compares the commit recorded for an app with the revision dokku
+// reports as deployed, flagging deploys done outside of Citizen
+func CheckDeploymentIntegrity(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	integrity, _, err := utils.CheckDeploymentIntegrity(c.UserContext(), appName)
+	if err != nil {
+		return commandErrorResponse(c, "Failed to check deployment integrity", err, nil)
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Deployment integrity checked successfully",
+		integrity,
+	))
+}
+
+// ResyncDeployment records the revision dokku deployed as the deployment of an app, after a
+// deploy done outside of Citizen
+func ResyncDeployment(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	integrity, record, err := utils.CheckDeploymentIntegrity(c.UserContext(), appName)
+	if err != nil {
+		return commandErrorResponse(c, "Failed to check deployment integrity", err, nil)
+	}
+	if !integrity.Resyncable {
+		return c.JSON(utils.NewCitizenResponse(
+			true,
+			"Nothing to resync: "+integrity.Detail,
+			fiber.Map{"integrity": integrity, "resynced": false},
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	previous := integrity.RecordedCommit
+	if previous == "" {
+		previous = "none"
+	}
+	activity, activityErr := database.LogConfigActivity(appName, "deployment_resync",
+		fmt.Sprintf("Resynced deployment record from %s to deployed commit %s", previous, integrity.DeployedCommit), userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log resync activity: %v\n", activityErr)
+	}
+
+	deployment, err := utils.ResyncDeploymentRecord(c.UserContext(), integrity, record)
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to resync deployment record: "+err.Error(),
+			nil,
+		))
+	}
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Deployment record resynced with the deployed revision",
+		fiber.Map{"integrity": integrity, "deployment": deployment, "resynced": true},
+	))
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"strings"
+
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetAppsHealth returns a green, yellow or red status per app with the reasons it isn't green,
+// worst first. The overview is refreshed by the scheduler, refresh=true recomputes it and
+// status=red,yellow keeps the apps with those statuses.
+func GetAppsHealth(c *fiber.Ctx) error {
+	overview, err := utils.AppsHealthOverview(c.UserContext(), utils.AppsHealthMaxAge, c.QueryBool("refresh"))
+	if err != nil {
+		return commandErrorResponse(c, "Failed to compute apps health", err, nil)
+	}
+
+	apps := overview.Apps
+	if filter := c.Query("status"); filter != "" {
+		wanted := make(map[string]bool)
+		for _, status := range strings.Split(filter, ",") {
+			wanted[strings.TrimSpace(status)] = true
+		}
+		apps = make([]utils.AppHealth, 0, len(overview.Apps))
+		for _, app := range overview.Apps {
+			if wanted[app.Status] {
+				apps = append(apps, app)
+			}
+		}
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Apps health retrieved successfully",
+		fiber.Map{
+			"apps":         apps,
+			"summary":      overview.Summary,
+			"refreshed_at": overview.RefreshedAt,
+		},
+	))
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// imagePushTimeout bounds pushing an image to a registry
+const imagePushTimeout = 30 * time.Minute
+
+// recordDeploymentImage records the image Dokku tagged for the release a deployment just made,
+// with its size and layers. The diagnostics warn when the image grew beyond IMAGE_SIZE_WARN_PERCENT
+// over the image of the previous release, so it must run before the deployment is finished.
+func recordDeploymentImage(diagnostics *utils.DeployDiagnostics, appName string, recordID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	info, err := utils.InspectImage(ctx, utils.AppImageRef(appName))
+	if err != nil {
+		utils.WarnLog("Failed to inspect the image of deployment %d of %s: %v", recordID, appName, err)
+		return
+	}
+	if err := database.RecordDeploymentImage(recordID, info.ID); err != nil {
+		utils.WarnLog("Failed to record the image of deployment %d of %s: %v", recordID, appName, err)
+	}
+
+	layers, err := utils.ImageHistory(ctx, info.ID)
+	if err != nil {
+		utils.WarnLog("Failed to read the layers of the image of deployment %d of %s: %v", recordID, appName, err)
+	}
+	if err := database.RecordDeploymentImageReport(recordID, info.Size, layers); err != nil {
+		utils.WarnLog("Failed to record the image size of deployment %d of %s: %v", recordID, appName, err)
+	}
+	diagnostics.Info("image", "image size %s in %d layers", utils.FormatImageSize(info.Size), len(layers))
+
+	previous, err := api.Deployments.GetPreviousImageSize(ctx, appName, recordID)
+	if err != nil {
+		utils.WarnLog("Failed to read the previous image size of %s: %v", appName, err)
+		return
+	}
+	if growth, exceeded := utils.ImageSizeGrowth(previous, info.Size); exceeded {
+		diagnostics.Warn("image", "image grew %.1f%% since the previous release, from %s to %s (warning above %d%%)",
+			growth, utils.FormatImageSize(previous), utils.FormatImageSize(info.Size), utils.ImageSizeWarnPercent())
+	}
+}
+
+// latestDeploymentImage returns the latest successful deployment of an app and its image. Deployments
+// recorded before images were tracked fall back to the image of the current release.
+func latestDeploymentImage(ctx context.Context, appName string) (*api.DeploymentRecord, *utils.ImageInfo, error) {
+	record, err := database.GetLatestSuccessfulDeployment(appName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ref := record.ImageID
+	if ref == "" {
+		ref = utils.AppImageRef(appName)
+	}
+	info, err := utils.InspectImage(ctx, ref)
+	if err != nil {
+		return record, nil, err
+	}
+	return record, info, nil
+}
+
+// deploymentImageError responds to a failure to find the image of the latest successful deployment
+func deploymentImageError(c *fiber.Ctx, appName string, record *api.DeploymentRecord, err error) error {
+	switch {
+	case errors.Is(err, api.ErrDeploymentRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("%s has no successful deployment", appName),
+			nil,
+		))
+	case errors.Is(err, utils.ErrImageNotFound):
+		return c.Status(fiber.StatusGone).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("The image of deployment %d is no longer available, redeploy the app to rebuild it", record.ID),
+			fiber.Map{"deployment_id": record.ID, "image_id": record.ImageID},
+		))
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to get the deployment image: "+err.Error(),
+			nil,
+		))
+	}
+}
+
+// ExportAppImage streams the image built by the latest successful deployment of an app as a
+// `docker save` tarball, which can be loaded elsewhere with `docker load`
+func ExportAppImage(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	record, info, err := latestDeploymentImage(context.Background(), appName)
+	if err != nil {
+		return deploymentImageError(c, appName, record, err)
+	}
+
+	// The stream outlives the handler, fasthttp closes it once the body is sent
+	stream, err := utils.SaveImage(context.Background(), info.ID)
+	if err != nil {
+		return deploymentImageError(c, appName, record, err)
+	}
+
+	utils.DebugLog("Exporting image %s of deployment %d of %s", info.ID, record.ID, appName)
+	c.Set(fiber.HeaderContentType, "application/x-tar")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-deployment-%d.tar"`, appName, record.ID))
+	c.Set("X-Citizen-Deployment-ID", strconv.Itoa(record.ID))
+	c.Set("X-Citizen-Image-ID", info.ID)
+	return c.SendStream(stream)
+}
+
+// PushAppImage pushes the image built by the latest successful deployment of an app to a registry.
+// The repository defaults to <IMAGE_EXPORT_REGISTRY>/<app> and the tag to the deployed commit;
+// credentials come from the Docker connection (docker login) of the registry.
+func PushAppImage(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var data struct {
+		Repository string `json:"repository"`
+		Tag        string `json:"tag"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&data); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Invalid request content",
+				nil,
+			))
+		}
+	}
+
+	if data.Repository == "" {
+		registryPrefix := strings.TrimSuffix(os.Getenv("IMAGE_EXPORT_REGISTRY"), "/")
+		if registryPrefix == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Repository is required when IMAGE_EXPORT_REGISTRY is not configured",
+				nil,
+			))
+		}
+		data.Repository = registryPrefix + "/" + appName
+	}
+
+	record, info, err := latestDeploymentImage(context.Background(), appName)
+	if err != nil {
+		return deploymentImageError(c, appName, record, err)
+	}
+
+	if data.Tag == "" {
+		data.Tag = fmt.Sprintf("deployment-%d", record.ID)
+		if len(record.GitCommit) >= 7 {
+			data.Tag = record.GitCommit[:7]
+		}
+	}
+	target := data.Repository + ":" + data.Tag
+	if err := utils.ValidateImageReference(target); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+	}
+
+	registryAuth, err := dockerRegistryAuth(imageRegistryHost(data.Repository))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to read registry credentials: "+err.Error(),
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	activity, activityErr := database.LogConfigActivity(appName, "image",
+		fmt.Sprintf("Pushing the image of deployment %d to %s", record.ID, target), userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log image push activity: %v\n", activityErr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), imagePushTimeout)
+	defer cancel()
+
+	digest, err := utils.PushImage(ctx, info.ID, target, registryAuth)
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to push the image: "+err.Error(),
+			nil,
+		))
+	}
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Image pushed successfully",
+		fiber.Map{
+			"app_name":      appName,
+			"deployment_id": record.ID,
+			"git_commit":    record.GitCommit,
+			"image_id":      info.ID,
+			"target":        target,
+			"digest":        digest,
+		},
+	))
+}
+
+// GetDeploymentImageReport returns the size and layers of the image of a deployment, with how its
+// size changed since the previous release
+func GetDeploymentImageReport(c *fiber.Ctx) error {
+	record, err := deploymentRecordFromParams(c)
+	if record == nil {
+		return err
+	}
+
+	layers, err := api.Deployments.GetDeploymentImageLayers(c.Context(), record.AppName, record.ID)
+	var previous int64
+	if err == nil {
+		previous, err = api.Deployments.GetPreviousImageSize(c.Context(), record.AppName, record.ID)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve deployment image report: "+err.Error(),
+			nil,
+		))
+	}
+
+	// Deployments that ran before image sizes were recorded, or didn't succeed, have no report
+	report := fiber.Map{
+		"deployment_id": record.ID,
+		"app_name":      record.AppName,
+		"image_id":      record.ImageID,
+		"image_size":    record.ImageSize,
+		"layers":        nil,
+	}
+	if layers != nil {
+		report["layers"] = json.RawMessage(layers)
+	}
+	if record.ImageSize > 0 && previous > 0 {
+		growth, exceeded := utils.ImageSizeGrowth(previous, record.ImageSize)
+		report["previous_image_size"] = previous
+		report["size_delta"] = record.ImageSize - previous
+		report["size_delta_percent"] = growth
+		report["size_warning"] = exceeded
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Deployment image report retrieved successfully",
+		report,
+	))
+}
+
+// imageRegistryHost returns the registry a repository is pushed to, Docker Hub when it has no host
+func imageRegistryHost(repository string) string {
+	first, _, found := strings.Cut(repository, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first
+	}
+	return "docker.io"
+}
+
+// recordDeploymentBuilder records the CNB builder image of a pack deployment, nothing for other
+// builders
+func recordDeploymentBuilder(appName string, recordID int) {
+	builderImage, err := utils.PackBuilderImage(appName)
+	if err != nil {
+		utils.WarnLog("Failed to read the builder image of deployment %d of %s: %v", recordID, appName, err)
+		return
+	}
+	if builderImage == "" {
+		return
+	}
+	if err := api.Deployments.SetDeploymentBuilderImage(context.Background(), recordID, builderImage); err != nil {
+		utils.WarnLog("Failed to record the builder image of deployment %d of %s: %v", recordID, appName, err)
+	}
+}
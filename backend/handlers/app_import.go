@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/models"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// appImportTimeout bounds an import, which reads several dokku reports per app
+const appImportTimeout = 5 * time.Minute
+
+// ImportAppRequest selects an unmanaged dokku app to import and optionally links it to its source
+type ImportAppRequest struct {
+	AppName   string `json:"app_name"`
+	GitURL    string `json:"git_url"`
+	GitBranch string `json:"git_branch"`
+	// GitHubRepository (owner/repo) connects the app to a repository of the user's GitHub account,
+	// without auto deploy
+	GitHubRepository string `json:"github_repository"`
+}
+
+// ImportedApp is the outcome of the import of an app
+type ImportedApp struct {
+	Inventory *utils.AppInventory `json:"inventory,omitempty"`
+	Imported  bool                `json:"imported"`
+	Linked    string              `json:"linked_repository,omitempty"`
+	Warnings  []string            `json:"warnings,omitempty"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// ImportApps takes over the management of dokku apps Citizen knows nothing about, like the apps
+// of a host Citizen was installed on afterwards. Their domains, port, builder, git state and env
+// var names are recorded and domains outside MAIN_DOMAIN registered as custom domains; env values
+// stay in dokku. Without apps in the request every unmanaged app is imported, with dry_run they
+// are only inspected.
+func ImportApps(c *fiber.Ctx) error {
+	var req struct {
+		Apps   []ImportAppRequest `json:"apps"`
+		DryRun bool               `json:"dry_run"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Invalid request content",
+				nil,
+			))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), appImportTimeout)
+	defer cancel()
+
+	unmanaged, err := utils.ListUnmanagedApps(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list unmanaged apps: "+err.Error(),
+			nil,
+		))
+	}
+
+	if len(req.Apps) == 0 {
+		for _, appName := range unmanaged {
+			req.Apps = append(req.Apps, ImportAppRequest{AppName: appName})
+		}
+	}
+	isUnmanaged := make(map[string]bool, len(unmanaged))
+	for _, appName := range unmanaged {
+		isUnmanaged[appName] = true
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+
+	results := make(map[string]*ImportedApp, len(req.Apps))
+	imported := 0
+	for _, app := range req.Apps {
+		result := &ImportedApp{}
+		results[app.AppName] = result
+		if !isUnmanaged[app.AppName] {
+			result.Error = "app not found in dokku or already managed by Citizen"
+			continue
+		}
+
+		inventory, err := utils.InspectDokkuApp(app.AppName)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		result.Inventory = inventory
+		if req.DryRun {
+			continue
+		}
+
+		if err := importApp(ctx, app, inventory, userID, result); err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		result.Imported = true
+		imported++
+	}
+
+	if !req.DryRun {
+		auditSystemAction(c, "apps_import", "apps", map[string]interface{}{
+			"requested": len(req.Apps),
+			"imported":  imported,
+		}, nil)
+	}
+
+	message := fmt.Sprintf("Imported %d of %d apps", imported, len(req.Apps))
+	if req.DryRun {
+		message = fmt.Sprintf("Found %d unmanaged apps, nothing imported", len(unmanaged))
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		message,
+		fiber.Map{
+			"dry_run":   req.DryRun,
+			"unmanaged": unmanaged,
+			"apps":      results,
+		},
+	))
+}
+
+// importApp records the deployment, custom domains and repository link of an inspected app
+func importApp(ctx context.Context, app ImportAppRequest, inventory *utils.AppInventory, userID *int, result *ImportedApp) error {
+	deployment := &models.AppDeployment{
+		AppName:    app.AppName,
+		Port:       inventory.Port,
+		PortSource: "dokku",
+		Builder:    inventory.Builder,
+		GitURL:     app.GitURL,
+		GitBranch:  app.GitBranch,
+		GitCommit:  inventory.GitCommit,
+		Status:     "pending",
+		LastDeploy: time.Now(),
+	}
+	if deployment.GitBranch == "" {
+		deployment.GitBranch = inventory.GitBranch
+	}
+	if inventory.Deployed {
+		deployment.Status = "deployed"
+	}
+	// The primary domain is the first one Citizen gave, or else the first custom domain
+	if len(inventory.Domains) > len(inventory.CustomDomains) {
+		for _, domain := range inventory.Domains {
+			if !slices.Contains(inventory.CustomDomains, domain) {
+				deployment.Domain = domain
+				break
+			}
+		}
+	} else if len(inventory.Domains) > 0 {
+		deployment.Domain = inventory.Domains[0]
+	}
+
+	if app.GitHubRepository != "" {
+		repository, err := linkImportedRepository(ctx, app, deployment, userID)
+		if err != nil {
+			result.Warnings = append(result.Warnings, "repository not linked: "+err.Error())
+		} else {
+			result.Linked = repository
+		}
+	}
+
+	if err := api.Deployments.UpsertDeployment(ctx, deployment); err != nil {
+		return err
+	}
+	if err := api.Deployments.RecordAppImport(ctx, app.AppName, inventory.EnvKeys); err != nil {
+		return err
+	}
+
+	for _, domain := range inventory.CustomDomains {
+		err := api.Settings.CreateCustomDomain(ctx, app.AppName, domain)
+		if errors.Is(err, api.ErrCustomDomainTaken) {
+			owner, _ := api.Settings.GetCustomDomainOwner(ctx, domain)
+			result.Warnings = append(result.Warnings, fmt.Sprintf("custom domain %s is already used by app %s", domain, owner))
+		} else if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("custom domain %s: %v", domain, err))
+		}
+	}
+
+	message := fmt.Sprintf("App imported from dokku with %d domains and %d env vars", len(inventory.Domains), len(inventory.EnvKeys))
+	if _, err := database.LogConfigActivity(app.AppName, "import", message, userID); err != nil {
+		utils.WarnLog("Failed to log import activity of %s: %v", app.AppName, err)
+	}
+	utils.InfoLog("App %s imported from dokku", app.AppName)
+	return nil
+}
+
+// linkImportedRepository connects an imported app to a repository of the user's GitHub account
+// and uses it as the git source of the deployment when none was given
+func linkImportedRepository(ctx context.Context, app ImportAppRequest, deployment *models.AppDeployment, userID *int) (string, error) {
+	if userID == nil {
+		return "", fmt.Errorf("user not authenticated")
+	}
+	owner, repoName, ok := strings.Cut(app.GitHubRepository, "/")
+	if !ok || owner == "" || repoName == "" || strings.Contains(repoName, "/") {
+		return "", fmt.Errorf("invalid repository %q, expected owner/repo", app.GitHubRepository)
+	}
+
+	accessToken, err := api.GitHub.GetUserGitHubAccessToken(ctx, *userID)
+	if err != nil || accessToken == "" {
+		return "", fmt.Errorf("GitHub not connected")
+	}
+	repository, err := utils.GetRepositoryInfo(accessToken, owner, repoName)
+	if err != nil {
+		return "", err
+	}
+
+	branch := deployment.GitBranch
+	if branch == "" {
+		branch = repository.DefaultBranch
+		deployment.GitBranch = branch
+	}
+	err = api.GitHub.ConnectGitHubRepository(ctx, *userID, app.AppName, repository.ID, repository.FullName,
+		repository.Name, repository.Owner.Login, repository.CloneURL, repository.HTMLURL, repository.Private,
+		repository.DefaultBranch, false, branch, nil)
+	if err != nil {
+		return "", err
+	}
+	if deployment.GitURL == "" {
+		deployment.GitURL = repository.CloneURL
+	}
+	return repository.FullName, nil
+}
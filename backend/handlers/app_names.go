@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// appNameSuggestions is how many alternative names are offered for an unusable name
+const appNameSuggestions = 3
+
+// appNameCheck is the verdict on a name for a new app
+type appNameCheck struct {
+	Name        string   `json:"name"`
+	Valid       bool     `json:"valid"`
+	Available   bool     `json:"available"`
+	Reason      string   `json:"reason,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// checkAppName normalizes a name and checks it against the naming rules and the existing apps,
+// suggesting alternatives when it can't be used
+func checkAppName(name string) (*appNameCheck, error) {
+	check := &appNameCheck{Name: utils.NormalizeAppName(name)}
+
+	apps, err := utils.ListApps()
+	if err != nil {
+		return nil, err
+	}
+	taken := make(map[string]bool, len(apps))
+	for _, app := range apps {
+		taken[app] = true
+	}
+
+	if err := utils.ValidateAppName(check.Name); err != nil {
+		check.Reason = err.Error()
+	} else {
+		check.Valid = true
+		check.Available = !taken[check.Name]
+		if !check.Available {
+			check.Reason = "an app named " + check.Name + " already exists"
+		}
+	}
+	if !check.Available && check.Name != "" {
+		check.Suggestions = utils.SuggestAppNames(check.Name, taken, appNameSuggestions)
+	}
+	return check, nil
+}
+
+// ValidateAppName tells whether a name can be used for a new app and suggests alternatives when
+// it is invalid, reserved or taken
+func ValidateAppName(c *fiber.Ctx) error {
+	name := c.Query("name")
+	if name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	check, err := checkAppName(name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while listing apps: "+err.Error(),
+			nil,
+		))
+	}
+
+	message := "App name is available"
+	if !check.Available {
+		message = "App name can't be used: " + check.Reason
+	}
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		message,
+		check,
+	))
+}
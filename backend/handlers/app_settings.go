@@ -5,7 +5,7 @@ import (
 	"backend/models"
 	"backend/utils"
 	"context"
-	"fmt"
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -14,21 +14,15 @@ import (
 
 // Database helper functions for app settings
 
-// setCustomDomainToDB saves custom domain to database
-func setCustomDomainToDB(appName, domain string) (*models.AppCustomDomain, error) {
-	err := api.Settings.CreateCustomDomain(context.Background(), appName, domain)
-	if err != nil {
-		return nil, err
-	}
-	
-	// Return the created domain
+// customDomainModel describes a custom domain just registered for an app
+func customDomainModel(appName, domain string) *models.AppCustomDomain {
 	return &models.AppCustomDomain{
 		AppName:   appName,
 		Domain:    domain,
 		IsActive:  true,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
-	}, nil
+	}
 }
 
 // getCustomDomainsByAppFromDB retrieves custom domains by app name
@@ -123,6 +117,14 @@ func SetCustomDomain(c *fiber.Ctx) error {
 		))
 	}
 
+	// A custom domain can only be active on one app
+	if taken, err := customDomainTaken(c, appName, body.Domain); taken {
+		return err
+	}
+	if refused, err := workerAppRefused(c, appName, "adding a custom domain"); refused {
+		return err
+	}
+
 	// First check if the domain already exists in the database
 	existingDbDomains, err := api.Settings.GetCustomDomains(context.Background(), appName)
 	if err == nil {
@@ -151,42 +153,32 @@ func SetCustomDomain(c *fiber.Ctx) error {
 		}
 	}
 
-	// STEP 1: Save custom domain to database
-	domain, err := setCustomDomainToDB(appName, body.Domain)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"Error occurred while saving domain to database: "+err.Error(),
-			nil,
-		))
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
 	}
 
-	// STEP 1.1: Also update the domain field in app_deployments table (for traefik watcher)
-	updateErr := api.Deployments.UpdateDeploymentDomain(context.Background(), appName, body.Domain)
-	if updateErr != nil {
-		fmt.Printf("[WARN] app_deployments domain update failed for %s - %s: %v\n", appName, body.Domain, updateErr)
-		// This error is not critical, just log and continue
+	// Database registration, dokku domain and Traefik reload, undone if a step fails
+	op, err := utils.RunOperation(c.UserContext(), utils.OperationCustomDomainAdd, appName, body.Domain, userID)
+	if errors.Is(err, api.ErrCustomDomainTaken) {
+		// Another app claimed the domain since the check above
+		owner, _ := api.Settings.GetCustomDomainOwner(context.Background(), body.Domain)
+		return customDomainConflict(c, body.Domain, owner)
 	}
-
-	// STEP 2: Add domain to Citizen
-	output, err := utils.AddDomain(appName, body.Domain)
 	if err != nil {
-		// If error in Citizen, rollback the database record
-		if removeErr := api.Settings.DeleteCustomDomain(context.Background(), appName, body.Domain); removeErr != nil {
-			// If rollback also fails, log as critical
-			fmt.Printf("[CRITICAL] Domain rollback failed for %s - %s: %v\n", appName, body.Domain, removeErr)
+		message := "Error occurred while adding domain to Citizen: "
+		if utils.FailedOperationStep(op) == "db_register" {
+			message = "Error occurred while saving domain to database: "
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
 			false,
-			"Error occurred while adding domain to Citizen: "+err.Error(),
-			nil,
+			message+err.Error(),
+			fiber.Map{"operation": op},
 		))
 	}
-
-	// STEP 3: Send Traefik signal (optional, continues even if error)
-	if reloadErr := utils.ReloadTraefik(); reloadErr != nil {
-		fmt.Printf("[WARN] Traefik reload failed for domain %s: %v\n", body.Domain, reloadErr)
-	}
+	domain := customDomainModel(appName, body.Domain)
+	output := utils.OperationStepOutput(op, "dokku_add")
+	utils.EmitAppEvent(appName, utils.EventDomainAdded, fiber.Map{"domain": body.Domain, "custom": true})
 
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
@@ -285,42 +277,26 @@ func RemoveCustomDomain(c *fiber.Ctx) error {
 		))
 	}
 
-	// STEP 1: Remove domain from Citizen
-	output, err := utils.RemoveDomain(appName, data.Domain)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"Error occurred while removing domain from Citizen: "+err.Error(),
-			nil,
-		))
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
 	}
 
-	// STEP 2: Remove domain from database
-	err = api.Settings.DeleteCustomDomain(context.Background(), appName, data.Domain)
+	// Dokku domain, database registration and Traefik reload, undone if a step fails
+	op, err := utils.RunOperation(c.UserContext(), utils.OperationCustomDomainRemove, appName, data.Domain, userID)
 	if err != nil {
-		// If deletion from database fails, add back to Citizen (rollback)
-		if _, addBackErr := utils.AddDomain(appName, data.Domain); addBackErr != nil {
-			// If rollback also fails, log as critical
-			fmt.Printf("[CRITICAL] Domain rollback failed for %s - %s: Citizen remove succeeded but DB delete failed, and Citizen add-back failed: %v\n", appName, data.Domain, addBackErr)
+		message := "Error occurred while removing domain from Citizen: "
+		if utils.FailedOperationStep(op) == "db_unregister" {
+			message = "Error occurred while removing domain from database: "
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
 			false,
-			"Error occurred while removing domain from database: "+err.Error(),
-			nil,
+			message+err.Error(),
+			fiber.Map{"operation": op},
 		))
 	}
-
-	// STEP 2.1: Also clear the domain field in app_deployments table (for traefik watcher)
-	updateErr := api.Deployments.UpdateDeploymentDomain(context.Background(), appName, "")
-	if updateErr != nil {
-		fmt.Printf("[WARN] app_deployments domain clear failed for %s: %v\n", appName, updateErr)
-		// This error is not critical, just log and continue
-	}
-
-	// STEP 3: Send Traefik signal (optional, continues even if error)
-	if reloadErr := utils.ReloadTraefik(); reloadErr != nil {
-		fmt.Printf("[WARN] Traefik reload failed for domain removal %s: %v\n", data.Domain, reloadErr)
-	}
+	output := utils.OperationStepOutput(op, "dokku_remove")
+	utils.EmitAppEvent(appName, utils.EventDomainRemoved, fiber.Map{"domain": data.Domain, "custom": true})
 
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
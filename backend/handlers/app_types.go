@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetAppType returns whether an app is a web app or a worker-only app
+func GetAppType(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	appType, err := api.Apps.GetAppType(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve app type: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"App type retrieved successfully",
+		fiber.Map{"app_name": appName, "app_type": appType},
+	))
+}
+
+// SetAppType sets an app to web or worker-only. Worker-only apps get their proxy disabled and
+// port mappings cleared, deploys skip port detection and domains can't be added to them. Back to
+// web, the proxy is enabled and the next deploy maps the port.
+func SetAppType(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		AppType string `json:"app_type"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if err := utils.ValidateAppType(req.AppType); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	activity, activityErr := database.LogConfigActivity(appName, "app_type", fmt.Sprintf("Set the app type to %s", req.AppType), userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log app type activity: %v\n", activityErr)
+	}
+
+	output, err := utils.ApplyAppType(c.UserContext(), appName, req.AppType)
+	if err == nil {
+		err = api.Apps.SetAppType(c.Context(), appName, req.AppType, userID)
+	}
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+		return commandErrorResponse(c, "Failed to set the app type", err, fiber.Map{"output": output})
+	}
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"App type updated successfully",
+		fiber.Map{"app_name": appName, "app_type": req.AppType, "output": output},
+	))
+}
+
+// workerAppRefused answers with a conflict when an app is worker-only, as nothing routes HTTP to
+// it. When it returns true the response was already sent.
+func workerAppRefused(c *fiber.Ctx, appName, action string) (bool, error) {
+	if !utils.IsWorkerApp(c.UserContext(), appName) {
+		return false, nil
+	}
+	return true, c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+		false,
+		fmt.Sprintf("%s is a worker-only app, %s needs a web app", appName, action),
+		fiber.Map{"app_type": utils.AppTypeWorker},
+	))
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultWebhookDeliveries = 50
+	maxWebhookDeliveries     = 200
+)
+
+// AppWebhookRequest creates a webhook or, with only some fields set, updates one
+type AppWebhookRequest struct {
+	URL          *string   `json:"url"`
+	Events       *[]string `json:"events"`
+	Description  *string   `json:"description"`
+	Enabled      *bool     `json:"enabled"`
+	RotateSecret bool      `json:"rotate_secret"`
+}
+
+// apply sets the fields present in the request on a webhook and validates the result
+func (r *AppWebhookRequest) apply(webhook *api.Webhook) error {
+	if r.URL != nil {
+		webhook.URL = strings.TrimSpace(*r.URL)
+	}
+	if r.Events != nil {
+		webhook.Events = []string{}
+		seen := make(map[string]bool)
+		for _, event := range *r.Events {
+			if !utils.IsWebhookEvent(event) {
+				return fmt.Errorf("unknown event %q, use one of: %s", event, strings.Join(utils.WebhookEvents, ", "))
+			}
+			if !seen[event] {
+				seen[event] = true
+				webhook.Events = append(webhook.Events, event)
+			}
+		}
+	}
+	if r.Description != nil {
+		webhook.Description = strings.TrimSpace(*r.Description)
+	}
+	if r.Enabled != nil {
+		webhook.Enabled = *r.Enabled
+	}
+
+	if err := utils.ValidateWebhookURL(webhook.URL); err != nil {
+		return err
+	}
+	if len(webhook.Events) == 0 {
+		return fmt.Errorf("at least one event is required")
+	}
+	if len(webhook.Description) > 200 {
+		return fmt.Errorf("description must be at most 200 characters")
+	}
+	return nil
+}
+
+// newWebhookSecret generates a webhook secret and returns it with its encrypted form
+func newWebhookSecret() (string, string, error) {
+	secret, err := utils.GenerateWebhookSecret()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	encrypted, err := utils.EncryptString(secret)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt webhook secret: %w", err)
+	}
+	return secret, encrypted, nil
+}
+
+// appWebhookFromParams reads the app name and webhook ID of the route and loads the webhook,
+// answering the request itself when it can't
+func appWebhookFromParams(c *fiber.Ctx) (*api.Webhook, error) {
+	appName := c.Params("app_name")
+	id, err := strconv.Atoi(c.Params("id"))
+	if appName == "" || err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name and webhook ID are required",
+			nil,
+		))
+	}
+
+	webhook, err := api.Webhooks.GetWebhook(c.Context(), appName, id)
+	if errors.Is(err, api.ErrWebhookNotFound) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Webhook not found",
+			nil,
+		))
+	}
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve webhook: "+err.Error(),
+			nil,
+		))
+	}
+	return webhook, nil
+}
+
+// ListAppWebhooks lists the outbound webhooks of an app with the events they can subscribe to
+func ListAppWebhooks(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	webhooks, err := api.Webhooks.ListWebhooks(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve webhooks: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Webhooks retrieved successfully",
+		fiber.Map{
+			"webhooks": webhooks,
+			"events":   utils.WebhookEvents,
+		},
+	))
+}
+
+// CreateAppWebhook adds an outbound webhook to an app. The signing secret is only returned here
+// and when it is rotated.
+func CreateAppWebhook(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req AppWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	webhook := &api.Webhook{AppName: appName, Enabled: true}
+	if err := req.apply(webhook); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	secret, encrypted, err := newWebhookSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	webhook.Secret = encrypted
+	if uid, ok := c.Locals("user_id").(int); ok {
+		webhook.CreatedBy = &uid
+	}
+
+	if err := api.Webhooks.CreateWebhook(c.Context(), webhook); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to create webhook: "+err.Error(),
+			nil,
+		))
+	}
+
+	utils.SecurityLog("Webhook %d created for app %s (%s)", webhook.ID, appName, strings.Join(webhook.Events, ", "))
+	return c.Status(fiber.StatusCreated).JSON(utils.NewCitizenResponse(
+		true,
+		"Webhook created, its secret is only shown once",
+		fiber.Map{
+			"webhook": webhook,
+			"secret":  secret,
+		},
+	))
+}
+
+// UpdateAppWebhook changes the URL, events, description or state of a webhook, and rotates its
+// secret when asked to
+func UpdateAppWebhook(c *fiber.Ctx) error {
+	webhook, err := appWebhookFromParams(c)
+	if webhook == nil {
+		return err
+	}
+
+	var req AppWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if err := req.apply(webhook); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	response := fiber.Map{}
+	if req.RotateSecret {
+		secret, encrypted, err := newWebhookSecret()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+				false,
+				err.Error(),
+				nil,
+			))
+		}
+		webhook.Secret = encrypted
+		response["secret"] = secret
+	}
+
+	if err := api.Webhooks.UpdateWebhook(c.Context(), webhook); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to update webhook: "+err.Error(),
+			nil,
+		))
+	}
+
+	if req.RotateSecret {
+		utils.SecurityLog("Secret of webhook %d of app %s rotated", webhook.ID, webhook.AppName)
+	}
+	response["webhook"] = webhook
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Webhook updated",
+		response,
+	))
+}
+
+// DeleteAppWebhook removes a webhook of an app with its delivery log
+func DeleteAppWebhook(c *fiber.Ctx) error {
+	webhook, err := appWebhookFromParams(c)
+	if webhook == nil {
+		return err
+	}
+
+	if err := api.Webhooks.DeleteWebhook(c.Context(), webhook.AppName, webhook.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to delete webhook: "+err.Error(),
+			nil,
+		))
+	}
+
+	utils.SecurityLog("Webhook %d of app %s deleted", webhook.ID, webhook.AppName)
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Webhook deleted",
+		fiber.Map{"id": webhook.ID},
+	))
+}
+
+// ListAppWebhookDeliveries returns the delivery log of a webhook, newest first
+func ListAppWebhookDeliveries(c *fiber.Ctx) error {
+	webhook, err := appWebhookFromParams(c)
+	if webhook == nil {
+		return err
+	}
+
+	limit := c.QueryInt("limit", defaultWebhookDeliveries)
+	if limit < 1 || limit > maxWebhookDeliveries {
+		limit = defaultWebhookDeliveries
+	}
+
+	deliveries, err := api.Webhooks.ListWebhookDeliveries(c.Context(), webhook.ID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve webhook deliveries: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Webhook deliveries retrieved successfully",
+		deliveries,
+	))
+}
+
+// TestAppWebhook sends a ping event to a webhook and returns the delivery with the response
+func TestAppWebhook(c *fiber.Ctx) error {
+	webhook, err := appWebhookFromParams(c)
+	if webhook == nil {
+		return err
+	}
+
+	delivery, err := utils.SendTestWebhook(c.Context(), webhook)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to send test delivery: "+err.Error(),
+			nil,
+		))
+	}
+
+	if delivery.Status != api.WebhookDeliverySucceeded {
+		return c.Status(fiber.StatusBadGateway).JSON(utils.NewCitizenResponse(
+			false,
+			"Test delivery failed",
+			delivery,
+		))
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Test delivery succeeded",
+		delivery,
+	))
+}
+
+// RetryAppWebhookDelivery queues a delivery of a webhook to be sent again right away
+func RetryAppWebhookDelivery(c *fiber.Ctx) error {
+	webhook, err := appWebhookFromParams(c)
+	if webhook == nil {
+		return err
+	}
+
+	deliveryID, err := strconv.ParseInt(c.Params("delivery_id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid delivery ID",
+			nil,
+		))
+	}
+
+	delivery, err := api.Webhooks.RetryWebhookDelivery(c.Context(), webhook.ID, deliveryID)
+	if errors.Is(err, api.ErrWebhookDeliveryNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Webhook delivery not found",
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retry webhook delivery: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Webhook delivery queued for a retry",
+		delivery,
+	))
+}
+
+// emitDeploymentEvent sends deployment.succeeded or deployment.failed for a finished deployment,
+// cancelled deployments are not reported
+func emitDeploymentEvent(record *api.DeploymentRecord, deployErr error) {
+	if errors.Is(deployErr, utils.ErrDeploymentCancelled) {
+		return
+	}
+
+	data := fiber.Map{
+		"deployment_id": record.ID,
+		"git_url":       record.GitURL,
+		"git_branch":    record.GitBranch,
+		"git_commit":    record.GitCommit,
+		"trigger_type":  record.TriggerType,
+		"duration_ms":   time.Since(record.StartedAt).Milliseconds(),
+	}
+	if record.SourceApp != "" {
+		data["source_app"] = record.SourceApp
+	}
+	if record.SourceImage != "" {
+		data["source_image"] = record.SourceImage
+	}
+	if record.SourceArchive != "" {
+		data["source_archive"] = record.SourceArchive
+	}
+
+	event := utils.EventDeploymentSucceeded
+	if deployErr != nil {
+		event = utils.EventDeploymentFailed
+		data["error"] = deployErr.Error()
+	}
+	utils.EmitAppEvent(record.AppName, event, data)
+}
@@ -27,12 +27,15 @@ var (
 	ssoMutex    = &sync.RWMutex{}
 )
 
+// ssoRotationGrace is how long a rotated session ID keeps working, for requests already in flight
+const ssoRotationGrace = 30 * time.Second
+
 // SSOSession structure
 type SSOSession struct {
 	SessionID    string
 	UserID       int
 	MainDomain   string
-	DeviceID     string
+	DeviceID     string // fingerprint hash of the browser the session was created on
 	CreatedAt    time.Time
 	LastActivity time.Time
 	ExpiresAt    time.Time
@@ -49,9 +52,10 @@ const (
 
 // Cookie configuration
 type CookieConfig struct {
-	Domain   string
-	SameSite string
-	Secure   bool
+	Domain   string   `json:"domain"`
+	SameSite string   `json:"same_site"`
+	Secure   bool     `json:"secure"`
+	Reasons  []string `json:"reasons"` // why each attribute was chosen, for diagnostics
 }
 
 // Base public paths that are always allowed
@@ -65,6 +69,7 @@ var basePublicPaths = []string{
 	"/favicon.ico",
 	"/robots.txt",
 	"/api/v1/auth/login",
+	"/api/v1/auth/passkeys/login/",
 	"/api/v1/auth/register",
 	"/api/v1/auth/validate",
 	"/.well-known/acme-challenge/",
@@ -116,42 +121,57 @@ func getCookieConfig(host string, forwardedProto string) CookieConfig {
 	switch domainType {
 	case DomainTypeCustom:
 		config.Domain = "" // No domain for custom domains
+		config.Reasons = append(config.Reasons, "custom domain: host-only cookie")
 	case DomainTypeLogin, DomainTypeSubdomain:
 		if strings.Contains(host, "localhost") {
 			config.Domain = "" // No domain for localhost
+			config.Reasons = append(config.Reasons, "localhost: host-only cookie")
 		} else {
 			config.Domain = "." + loginHost
+			config.Reasons = append(config.Reasons, "LOGIN_HOST or its subdomain: cookie shared across "+loginHost)
 		}
 	}
 	
+	// Configured cookie domains win, for dashboards served outside LOGIN_HOST
+	if domain, ok := utils.GetDashboardAccessConfig().CookieDomainFor(host); ok {
+		config.Domain = "." + domain
+		config.Reasons = append(config.Reasons, "configured cookie domain: cookie shared across "+domain)
+	}
+	
 	// Determine SameSite and Secure
 	isHTTPS := isHttpsRequired()
 	
 	if strings.Contains(host, "localhost") {
 		config.SameSite = "Lax"
 		config.Secure = false
+		config.Reasons = append(config.Reasons, "localhost: SameSite=Lax, not secure")
 	} else if domainType == DomainTypeCustom {
 		if isHTTPS {
 			config.SameSite = "None"
 			config.Secure = true
+			config.Reasons = append(config.Reasons, "custom domain with FORCE_HTTPS: SameSite=None, secure")
 		} else {
 			config.SameSite = "Lax"
 			config.Secure = false
+			config.Reasons = append(config.Reasons, "custom domain without FORCE_HTTPS: SameSite=Lax, not secure")
 		}
 	} else {
 		// Login host or subdomain
 		if isHTTPS {
 			config.SameSite = "None"
 			config.Secure = true
+			config.Reasons = append(config.Reasons, "FORCE_HTTPS: SameSite=None, secure")
 		} else {
 			config.SameSite = "Lax"
 			config.Secure = false
+			config.Reasons = append(config.Reasons, "FORCE_HTTPS=false: SameSite=Lax, not secure")
 		}
 	}
 	
 	// Override secure if protocol indicates HTTPS
-	if strings.HasPrefix(forwardedProto, "https") {
+	if strings.HasPrefix(forwardedProto, "https") && !config.Secure {
 		config.Secure = true
+		config.Reasons = append(config.Reasons, "X-Forwarded-Proto is https: secure")
 	}
 	
 	utils.AuthDebugLog("getCookieConfig('%s') = domain:'%s', sameSite:'%s', secure:%v", 
@@ -170,10 +190,12 @@ func getCookieConfigForLoginHost(forwardedProto string) CookieConfig {
 		config.Domain = ""
 		config.SameSite = "Lax"
 		config.Secure = false
+		config.Reasons = append(config.Reasons, "localhost LOGIN_HOST: host-only cookie, SameSite=Lax")
 	} else {
 		config.Domain = "." + loginHost
 		config.SameSite = "None" // Always None for login host for cross-domain SSO
 		config.Secure = isHttpsRequired()
+		config.Reasons = append(config.Reasons, "LOGIN_HOST: cookie shared across "+loginHost+", SameSite=None for cross-domain SSO")
 	}
 	
 	// Override secure if protocol indicates HTTPS
@@ -193,7 +215,7 @@ func setSSOCookie(c *fiber.Ctx, sessionID string, host string) {
 	
 	c.Cookie(&fiber.Cookie{
 		Name:     "sso_session",
-		Value:    sessionID,
+		Value:    ssoCookieValue(sessionID),
 		Domain:   config.Domain,
 		Path:     "/",
 		Expires:  time.Now().Add(24 * time.Hour),
@@ -223,6 +245,16 @@ func clearSSOCookie(c *fiber.Ctx, host string) {
 	utils.AuthDebugLog("Cleared SSO cookie for host %s", host)
 }
 
+// ssoCookieValue returns the signed cookie value of a session
+func ssoCookieValue(sessionID string) string {
+	value, err := utils.SignSessionID(sessionID)
+	if err != nil {
+		utils.ErrorLog("Failed to sign SSO session cookie: %v", err)
+		return ""
+	}
+	return value
+}
+
 // extractSSOSessionFromURI removed - using cookie-only approach for security
 
 // buildSSOInitURL builds the SSO initialization URL
@@ -260,11 +292,10 @@ func validateAndGetSSOSession(c *fiber.Ctx, forwardedUri string) (*SSOSession, s
 	utils.AuthDebugLog("All cookies received: '%s'", allCookies)
 	
 	// Use cookie only for security - no URL parameters that can leak
-	if sessionID := c.Cookies("sso_session"); sessionID != "" {
-		utils.AuthDebugLog("SSO session cookie found: '%s'", sessionID)
-		if session, err := GetSSOSession(sessionID); err == nil && session != nil {
+	if c.Cookies("sso_session") != "" {
+		if session, err := AuthenticateSSOCookie(c); err == nil {
 			utils.AuthDebugLog("SSO session valid for user: %d", session.UserID)
-			return session, sessionID
+			return session, session.SessionID
 		} else {
 			utils.AuthDebugLog("SSO session invalid/expired: %v", err)
 		}
@@ -275,6 +306,60 @@ func validateAndGetSSOSession(c *fiber.Ctx, forwardedUri string) (*SSOSession, s
 	return nil, ""
 }
 
+// AuthenticateSSOCookie returns the session of the sso_session cookie of a request. The cookie
+// must be signed by this server and, with device binding on, come from the browser the session
+// was created on.
+func AuthenticateSSOCookie(c *fiber.Ctx) (*SSOSession, error) {
+	sessionID, err := utils.VerifySessionCookie(c.Cookies("sso_session"))
+	if err != nil {
+		utils.SecurityLog("Rejected SSO session cookie from %s: %v", utils.ClientIP(c), err)
+		return nil, err
+	}
+
+	session, err := GetSSOSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if isUserInactive(session.UserID) {
+		utils.SecurityLog("SSO session of deactivated user %d refused, IP: %s", session.UserID, utils.ClientIP(c))
+		return nil, fmt.Errorf("user deactivated")
+	}
+
+	if utils.SessionDeviceBinding() && session.DeviceID != "" &&
+		session.DeviceID != utils.DeviceFingerprint(c.Get("User-Agent"), c.Get("Accept-Language")) {
+		utils.SecurityLog("SSO session of user %d used from another device, IP: %s", session.UserID, utils.ClientIP(c))
+		return nil, fmt.Errorf("session bound to another device")
+	}
+	return session, nil
+}
+
+// RotateSSOSession replaces the session of a request with a new ID and sets its cookie, so a
+// session ID seen before a privilege-sensitive action can't be replayed after it. The old ID
+// keeps working for a short grace period.
+func RotateSSOSession(c *fiber.Ctx, session *SSOSession) {
+	newSessionID := createOrUpdateSSOSession(session.UserID, session.MainDomain, session.DeviceID)
+	expireSSOSession(session.SessionID, ssoRotationGrace)
+
+	currentHost := c.Hostname()
+	setSSOCookie(c, newSessionID, currentHost)
+	if loginHost := getLoginHost(); currentHost != loginHost && getDomainType(currentHost) != DomainTypeCustom {
+		config := getCookieConfigForLoginHost(c.Get("X-Forwarded-Proto"))
+		c.Cookie(&fiber.Cookie{
+			Name:     "sso_session",
+			Value:    ssoCookieValue(newSessionID),
+			Domain:   config.Domain,
+			Path:     "/",
+			Expires:  time.Now().Add(24 * time.Hour),
+			HTTPOnly: true,
+			SameSite: config.SameSite,
+			Secure:   config.Secure,
+		})
+	}
+
+	utils.SecurityLog("User %d SSO session rotated after %s %s", session.UserID, c.Method(), c.Path())
+}
+
 // getPublicPaths returns environment-appropriate public paths
 func getPublicPaths() []string {
 	paths := make([]string, len(basePublicPaths))
@@ -387,6 +472,27 @@ func GetSSOSession(sessionID string) (*SSOSession, error) {
 	return session, nil
 }
 
+// expireSSOSession shortens the lifetime of a session
+func expireSSOSession(sessionID string, after time.Duration) {
+	expiresAt := time.Now().Add(after)
+
+	ssoMutex.Lock()
+	if session, exists := ssoSessions[sessionID]; exists && session.ExpiresAt.After(expiresAt) {
+		session.ExpiresAt = expiresAt
+	}
+	ssoMutex.Unlock()
+
+	if data, err := database.Get("sso_session:" + sessionID); err == nil && data != "" {
+		var session SSOSession
+		if err := json.Unmarshal([]byte(data), &session); err == nil && session.ExpiresAt.After(expiresAt) {
+			session.ExpiresAt = expiresAt
+			if updated, err := json.Marshal(session); err == nil {
+				database.SetWithTTL("sso_session:"+sessionID, string(updated), after)
+			}
+		}
+	}
+}
+
 // Clear all SSO sessions for a user (global logout)
 func clearUserSSOSessions(userID int) {
 	ssoMutex.Lock()
@@ -468,7 +574,7 @@ func SSOCheck(c *fiber.Ctx) error {
 				
 				c.Cookie(&fiber.Cookie{
 					Name:     "sso_session",
-					Value:    sessionID,
+					Value:    ssoCookieValue(sessionID),
 					Domain:   config.Domain,
 					Path:     "/",
 					Expires:  time.Now().Add(24 * time.Hour),
@@ -480,7 +586,7 @@ func SSOCheck(c *fiber.Ctx) error {
 		}
 	}
 	
-	return c.Type("html").SendString(getSSOCheckHTML(true, sessionID, allowedOrigin))
+	return c.Type("html").SendString(getSSOCheckHTML(true, ssoCookieValue(sessionID), allowedOrigin))
 }
 
 // Login function with SSO session creation
@@ -548,10 +654,35 @@ func Login(c *fiber.Ctx) error {
 		))
 	}
 
+	return completeLogin(c, user, redirectURL)
+}
+
+// completeLogin opens an SSO session for an authenticated user, by password or passkey, sets its
+// cookies and answers the login request
+func completeLogin(c *fiber.Ctx, user *models.User, redirectURL string) error {
+	// Users deactivated by the identity provider can't sign in
+	active, err := api.Users.IsUserActive(c.Context(), int(user.ID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to check account status",
+			nil,
+		))
+	}
+	if !active {
+		utils.SecurityLog("Sign-in of deactivated user %d refused, IP: %s", user.ID, utils.ClientIP(c))
+		return c.Status(fiber.StatusForbidden).JSON(utils.NewCitizenResponse(
+			false,
+			"This account is deactivated",
+			nil,
+		))
+	}
+
 	// Create SSO session directly (no JWT needed)
 	userID := int(user.ID)
-	deviceID := c.Get("User-Agent")
+	deviceID := utils.DeviceFingerprint(c.Get("User-Agent"), c.Get("Accept-Language"))
 	ssoSessionID := createOrUpdateSSOSession(userID, c.Hostname(), deviceID)
+	ssoCookie := ssoCookieValue(ssoSessionID)
 
 	currentHost := c.Hostname()
 	loginHost := getLoginHost()
@@ -564,7 +695,7 @@ func Login(c *fiber.Ctx) error {
 	
 	c.Cookie(&fiber.Cookie{
 		Name:     "sso_session",
-		Value:    ssoSessionID,
+		Value:    ssoCookie,
 		Domain:   cookieDomain,
 		Path:     "/",
 		Expires:  time.Now().Add(24 * time.Hour),
@@ -581,7 +712,7 @@ func Login(c *fiber.Ctx) error {
 		loginSameSitePolicy := getSameSitePolicy(loginHost)
 		c.Cookie(&fiber.Cookie{
 			Name:     "sso_session",
-			Value:    ssoSessionID,
+			Value:    ssoCookie,
 			Domain:   loginCookieDomain,
 			Path:     "/",
 			Expires:  time.Now().Add(24 * time.Hour),
@@ -615,7 +746,7 @@ func Login(c *fiber.Ctx) error {
 				// Set cookie for the custom domain as well
 				c.Cookie(&fiber.Cookie{
 					Name:     "sso_session",
-					Value:    ssoSessionID,
+					Value:    ssoCookie,
 					Domain:   customCookieDomain,
 					Path:     "/",
 					Expires:  time.Now().Add(24 * time.Hour),
@@ -627,11 +758,11 @@ func Login(c *fiber.Ctx) error {
 		}
 	}
 	
-	utils.SecurityLog("User %s LOGIN - SSO Session: %s, Host: %s", userID, ssoSessionID, currentHost)
+	utils.SecurityLog("User %d LOGIN - SSO Session: %s, Host: %s", userID, ssoSessionID, currentHost)
 
 	// Response
 	responseData := fiber.Map{
-		"sso_session": ssoSessionID,
+		"sso_session": ssoCookie,
 		"user": fiber.Map{
 			"user_id":  user.ID,
 			"username": user.Username,
@@ -659,7 +790,7 @@ func ValidateForTraefik(c *fiber.Ctx) error {
 	// Get forwarded headers
 	forwardedHost := c.Get("X-Forwarded-Host")
 	forwardedUri := c.Get("X-Forwarded-Uri")
-	utils.RequestDebugLog("VALIDATE", forwardedUri, "Host: %s, IP: %s", forwardedHost, c.IP())
+	utils.RequestDebugLog("VALIDATE", forwardedUri, "Host: %s, IP: %s", forwardedHost, utils.ClientIP(c))
 
 	// Check public paths
 	if isPublicPath(forwardedUri) ||
@@ -670,13 +801,36 @@ func ValidateForTraefik(c *fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusOK)
 	}
 
+	// Subdomains of apps that don't exist get the "app not found" page instead of a login
+	if resolution := resolveHost(forwardedHost); !resolution.Known && getDomainType(resolution.Host) == DomainTypeSubdomain {
+		utils.AuthDebugLog("Unknown app host: %s", forwardedHost)
+		return renderHostNotFound(c, forwardedHost)
+	}
+
 	// Check public apps
 	appName := extractAppNameFromHost(forwardedHost)
+	if appName != "" {
+		database.RecordVisit(appName, forwardedHost, forwardedUri, utils.ClientIP(c), c.Get("User-Agent"))
+	}
 	if appName != "" && isAppPublic(appName) {
 		utils.AuthDebugLog("Public app accessed, allowing. App: %s", appName)
 		return c.SendStatus(fiber.StatusOK)
 	}
 
+	// Scripts and probes presenting a service token of the app get in without a session
+	if appName != "" {
+		if handled, err := authorizeServiceToken(c, appName, forwardedUri); handled {
+			return err
+		}
+	}
+
+	// Visitors holding a share link of the app get in without an account
+	if appName != "" {
+		if handled, err := authorizeShareLink(c, appName, forwardedHost, forwardedUri); handled {
+			return err
+		}
+	}
+
 	// Validate SSO session
 	session, _ := validateAndGetSSOSession(c, forwardedUri)
 	
@@ -700,6 +854,9 @@ func ValidateForTraefik(c *fiber.Ctx) error {
 	// Session validated from secure cookie only
 
 	utils.AuthDebugLog("SSO session validation successful for host: %s, User: %d", forwardedHost, session.UserID)
+	if appName != "" {
+		setIdentityHeaders(c, appName, session.UserID)
+	}
 	return c.SendStatus(fiber.StatusOK)
 }
 
@@ -774,7 +931,7 @@ func Logout(c *fiber.Ctx) error {
 
 // ValidateSessionEndpoint - API endpoint for SSO session validation (keeping token-validate path for compatibility)
 func ValidateSessionEndpoint(c *fiber.Ctx) error {
-	log.Printf("[AUTH] ValidateSessionEndpoint called from IP: %s", c.IP())
+	log.Printf("[AUTH] ValidateSessionEndpoint called from IP: %s", utils.ClientIP(c))
 	
 	session, _ := validateAndGetSSOSession(c, "")
 	if session == nil {
@@ -923,6 +1080,11 @@ func getCookieDomainForHost(host string) string {
 		return ".localhost"
 	}
 	
+	if domain, ok := utils.GetDashboardAccessConfig().CookieDomainFor(host); ok {
+		utils.AuthDebugLog("getCookieDomainForHost('%s') = '.%s' (configured cookie domain)", host, domain)
+		return "." + domain
+	}
+	
 	if host == loginDomain || strings.HasSuffix(host, "."+loginDomain) {
 		utils.AuthDebugLog("getCookieDomainForHost('%s') = '.%s' (login domain/subdomain)", host, loginDomain)
 		return "." + loginDomain
@@ -1043,6 +1205,11 @@ func isAllowedOrigin(origin string) bool {
 		return true
 	}
 	
+	// Allow configured dashboard origins
+	if utils.GetDashboardAccessConfig().AllowsOrigin(origin) {
+		return true
+	}
+	
 	// Check custom domains
 	domains, err := getActiveCustomDomainsFromDB()
 	if err == nil {
@@ -1138,15 +1305,3 @@ func CleanExpiredSSOTokens() {
 		}
 	}
 }
-
-func init() {
-	// Start periodic cleanup
-	go func() {
-		ticker := time.NewTicker(5 * time.Minute)
-		defer ticker.Stop()
-		
-		for range ticker.C {
-			CleanExpiredSSOTokens()
-		}
-	}()
-}
\ No newline at end of file
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// badgeCacheTTL is how long a badge is served without reading the database, and how long
+	// clients and proxies may cache it
+	badgeCacheTTL = 5 * time.Minute
+	// maxCachedBadges bounds the cache against requests for made-up app names
+	maxCachedBadges = 1000
+)
+
+// badgeKinds are the badges an app can show, served as <kind>.svg or <kind>.json
+var badgeKinds = []string{"deploy", "uptime"}
+
+// appBadge is what a badge shows, found is false for apps without badges enabled
+type appBadge struct {
+	label     string
+	message   string
+	color     string
+	found     bool
+	fetchedAt time.Time
+}
+
+var (
+	badgeCache   = make(map[string]appBadge)
+	badgeCacheMu sync.Mutex
+)
+
+// GetAppBadges returns whether an app shows public status badges and their URLs
+func GetAppBadges(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	enabled, err := api.Apps.IsBadgeEnabled(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve badge setting: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Badge setting retrieved successfully",
+		appBadgesInfo(c, appName, enabled),
+	))
+}
+
+// SetAppBadges opts an app in or out of public status badges. Enabled badges show the deploy
+// status and uptime of the app to anyone knowing its name.
+func SetAppBadges(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if err := api.Apps.SetBadgeEnabled(c.Context(), appName, req.Enabled, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to update badge setting: "+err.Error(),
+			nil,
+		))
+	}
+
+	badgeCacheMu.Lock()
+	for _, kind := range badgeKinds {
+		delete(badgeCache, appName+"/"+kind)
+	}
+	badgeCacheMu.Unlock()
+
+	utils.SecurityLog("Public status badges of app %s set to %t", appName, req.Enabled)
+	message := "Status badges disabled"
+	if req.Enabled {
+		message = "Status badges enabled, uptime is sampled from now on"
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		message,
+		appBadgesInfo(c, appName, req.Enabled),
+	))
+}
+
+// appBadgesInfo lists the badge URLs of an app with the Markdown to embed them in a README
+func appBadgesInfo(c *fiber.Ctx, appName string, enabled bool) fiber.Map {
+	urls := fiber.Map{}
+	var markdown []string
+	for _, kind := range badgeKinds {
+		url := fmt.Sprintf("%s/api/v1/badges/%s/%s.svg", c.BaseURL(), appName, kind)
+		urls[kind] = url
+		markdown = append(markdown, fmt.Sprintf("![%s](%s)", kind, url))
+	}
+	return fiber.Map{
+		"app_name": appName,
+		"enabled":  enabled,
+		"urls":     urls,
+		"markdown": strings.Join(markdown, " "),
+	}
+}
+
+// AppBadge serves a status badge of an app without authentication, as SVG or as JSON in the
+// shields.io endpoint format. Apps without badges enabled answer like unknown apps.
+func AppBadge(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	kind, format, _ := strings.Cut(c.Params("badge"), ".")
+	if format == "" {
+		format = "svg"
+	}
+	if utils.ValidateAppName(appName) != nil || !slices.Contains(badgeKinds, kind) || (format != "svg" && format != "json") {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Badge not found",
+			nil,
+		))
+	}
+
+	badge, err := cachedAppBadge(c.Context(), appName, kind)
+	if err != nil {
+		utils.WarnLog("Failed to build %s badge of %s: %v", kind, appName, err)
+		badge = appBadge{label: kind, message: "unavailable", color: utils.BadgeColorGrey, found: true}
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	} else {
+		c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(badgeCacheTTL.Seconds())))
+	}
+	if !badge.found {
+		c.Status(fiber.StatusNotFound)
+		badge = appBadge{label: kind, message: "not found", color: utils.BadgeColorGrey}
+	}
+
+	if format == "json" {
+		return c.JSON(fiber.Map{
+			"schemaVersion": 1,
+			"label":         badge.label,
+			"message":       badge.message,
+			"color":         strings.TrimPrefix(badge.color, "#"),
+		})
+	}
+	c.Set(fiber.HeaderContentType, "image/svg+xml; charset=utf-8")
+	return c.SendString(utils.RenderBadgeSVG(badge.label, badge.message, badge.color))
+}
+
+// cachedAppBadge returns a badge, built at most every badgeCacheTTL as badges are embedded in
+// pages anyone can load
+func cachedAppBadge(ctx context.Context, appName, kind string) (appBadge, error) {
+	key := appName + "/" + kind
+	badgeCacheMu.Lock()
+	cached, ok := badgeCache[key]
+	badgeCacheMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < badgeCacheTTL {
+		return cached, nil
+	}
+
+	badge, err := buildAppBadge(ctx, appName, kind)
+	if err != nil {
+		return badge, err
+	}
+	badge.fetchedAt = time.Now()
+
+	badgeCacheMu.Lock()
+	if len(badgeCache) >= maxCachedBadges {
+		for cachedKey, entry := range badgeCache {
+			if time.Since(entry.fetchedAt) >= badgeCacheTTL {
+				delete(badgeCache, cachedKey)
+			}
+		}
+	}
+	if len(badgeCache) < maxCachedBadges {
+		badgeCache[key] = badge
+	}
+	badgeCacheMu.Unlock()
+	return badge, nil
+}
+
+// buildAppBadge reads what a badge of an app shows
+func buildAppBadge(ctx context.Context, appName, kind string) (appBadge, error) {
+	enabled, err := api.Apps.IsBadgeEnabled(ctx, appName)
+	if err != nil || !enabled {
+		return appBadge{}, err
+	}
+
+	switch kind {
+	case "deploy":
+		records, err := api.Deployments.ListDeploymentRecords(ctx, appName, 10, 0)
+		if err != nil {
+			return appBadge{}, err
+		}
+		badge := appBadge{label: "deploy", message: "never deployed", color: utils.BadgeColorGrey, found: true}
+		for _, record := range records {
+			// A cancelled deployment leaves the app as the previous one did
+			if record.Status == "cancelled" {
+				continue
+			}
+			switch record.Status {
+			case "success":
+				badge.message, badge.color = "deployed", utils.BadgeColorGreen
+			case "pending":
+				badge.message, badge.color = "deploying", utils.BadgeColorBlue
+			default:
+				badge.message, badge.color = "failed", utils.BadgeColorRed
+			}
+			break
+		}
+		return badge, nil
+
+	default:
+		samples, upSamples, err := api.Apps.GetUptime(ctx, appName, time.Now().Add(-utils.UptimeWindow))
+		if err != nil {
+			return appBadge{}, err
+		}
+		if samples == 0 {
+			return appBadge{label: "uptime", message: "no data", color: utils.BadgeColorGrey, found: true}, nil
+		}
+		percent := float64(upSamples) * 100 / float64(samples)
+		message := strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", percent), "0"), ".") + "%"
+		return appBadge{label: "uptime", message: message, color: utils.UptimeBadgeColor(percent), found: true}, nil
+	}
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// teamNamePattern restricts team names to what reads well in reports and URLs
+var teamNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,99}$`)
+
+// buildQuotaRetryAfter is the Retry-After of deployments refused for running too many builds
+const buildQuotaRetryAfter = 60
+
+// buildQuotaResponse answers a deployment refused by a build quota with a 429 telling which quota
+// and when to retry; other errors checking quotas are a 500
+func buildQuotaResponse(c *fiber.Ctx, err error) error {
+	var exceeded *database.BuildQuotaError
+	if !errors.As(err, &exceeded) {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to check build quotas: "+err.Error(),
+			nil,
+		))
+	}
+
+	retryAfter := buildQuotaRetryAfter
+	if exceeded.ResetsAt != nil {
+		retryAfter = int(time.Until(*exceeded.ResetsAt).Seconds()) + 1
+	}
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return c.Status(fiber.StatusTooManyRequests).JSON(utils.NewCitizenResponse(
+		false,
+		"Deployment refused: "+exceeded.Error(),
+		fiber.Map{"error": "build_quota_exceeded", "quota": exceeded},
+	))
+}
+
+// GetBuildUsage reports the build minutes, deployments and peak deploy concurrency of a month
+// (?month=2026-01, the current one by default) grouped by ?group=app, user or team, with the
+// quota of each
+func GetBuildUsage(c *fiber.Ctx) error {
+	group := c.Query("group", api.BuildScopeApp)
+	if !api.ValidBuildScope(group) {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"group must be app, user or team",
+			nil,
+		))
+	}
+	month := time.Now()
+	if value := c.Query("month"); value != "" {
+		parsed, err := time.Parse("2006-01", value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"month must look like 2026-01",
+				nil,
+			))
+		}
+		month = parsed
+	}
+	start, end := database.BuildUsagePeriod(month)
+
+	usage, err := api.Deployments.ListBuildUsage(c.Context(), group, "", start, end, utils.GetMaxBuildDuration())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve build usage: "+err.Error(),
+			nil,
+		))
+	}
+	quotas, err := api.Deployments.ListBuildQuotas(c.Context(), group)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve build quotas: "+err.Error(),
+			nil,
+		))
+	}
+	quotaBySubject := make(map[string]api.BuildQuota, len(quotas))
+	for _, quota := range quotas {
+		quotaBySubject[quota.Subject] = quota
+	}
+
+	type usageEntry struct {
+		api.BuildUsage
+		Quota *api.BuildQuota `json:"quota,omitempty"`
+	}
+	entries := make([]usageEntry, 0, len(usage))
+	var totalMinutes float64
+	var totalDeployments int
+	for _, u := range usage {
+		entry := usageEntry{BuildUsage: u}
+		if quota, ok := quotaBySubject[u.Subject]; ok {
+			entry.Quota = &quota
+		}
+		entries = append(entries, entry)
+		totalMinutes += u.BuildMinutes
+		totalDeployments += u.Deployments
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Build usage retrieved successfully",
+		fiber.Map{
+			"group":  group,
+			"period": fiber.Map{"start": start, "end": end},
+			"usage":  entries,
+			"totals": fiber.Map{"build_minutes": totalMinutes, "deployments": totalDeployments},
+		},
+	))
+}
+
+// ListBuildQuotas lists the build quotas, of ?scope only when given
+func ListBuildQuotas(c *fiber.Ctx) error {
+	scope := c.Query("scope")
+	if scope != "" && !api.ValidBuildScope(scope) {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"scope must be app, user or team",
+			nil,
+		))
+	}
+
+	quotas, err := api.Deployments.ListBuildQuotas(c.Context(), scope)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve build quotas: "+err.Error(),
+			nil,
+		))
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Build quotas retrieved successfully",
+		fiber.Map{"quotas": quotas},
+	))
+}
+
+// SetBuildQuota sets the monthly build minutes and concurrent deployments of a user, team or
+// app. A limit left out or null is not enforced.
+func SetBuildQuota(c *fiber.Ctx) error {
+	quota, response := buildQuotaFromParams(c)
+	if quota == nil {
+		return response
+	}
+	if err := c.BodyParser(quota); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	quota.Scope, quota.Subject = c.Params("scope"), c.Params("subject")
+	if (quota.MonthlyMinutes != nil && *quota.MonthlyMinutes < 1) || (quota.MaxConcurrent != nil && *quota.MaxConcurrent < 1) {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"monthly_minutes and max_concurrent must be at least 1, or null for no limit",
+			nil,
+		))
+	}
+	if quota.MonthlyMinutes == nil && quota.MaxConcurrent == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Set monthly_minutes or max_concurrent, or delete the quota",
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if err := api.Deployments.SetBuildQuota(c.Context(), quota, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to set build quota: "+err.Error(),
+			nil,
+		))
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Build quota set successfully",
+		quota,
+	))
+}
+
+// DeleteBuildQuota removes the build quota of a user, team or app
+func DeleteBuildQuota(c *fiber.Ctx) error {
+	quota, response := buildQuotaFromParams(c)
+	if quota == nil {
+		return response
+	}
+
+	err := api.Deployments.DeleteBuildQuota(c.Context(), quota.Scope, quota.Subject)
+	if errors.Is(err, api.ErrBuildQuotaNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"No build quota is set for this "+quota.Scope,
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to delete build quota: "+err.Error(),
+			nil,
+		))
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Build quota deleted successfully",
+		nil,
+	))
+}
+
+// buildQuotaFromParams validates the scope and subject of the path. It returns a nil quota
+// along with the response already sent when they are invalid.
+func buildQuotaFromParams(c *fiber.Ctx) (*api.BuildQuota, error) {
+	scope, subject := c.Params("scope"), c.Params("subject")
+	var valid bool
+	switch scope {
+	case api.BuildScopeUser:
+		id, err := strconv.Atoi(subject)
+		valid = err == nil && id > 0
+	case api.BuildScopeTeam:
+		valid = teamNamePattern.MatchString(subject)
+	case api.BuildScopeApp:
+		valid = utils.ValidateAppName(subject) == nil
+	default:
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"scope must be app, user or team",
+			nil,
+		))
+	}
+	if !valid {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid "+scope+": "+subject,
+			nil,
+		))
+	}
+	return &api.BuildQuota{Scope: scope, Subject: subject}, nil
+}
+
+// SetUserTeam moves a user to the team their build time is accounted to, or out of any team
+// when team is empty
+func SetUserTeam(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("user_id"))
+	if err != nil || userID < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid user ID",
+			nil,
+		))
+	}
+	var req struct {
+		Team string `json:"team"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if req.Team != "" && !teamNamePattern.MatchString(req.Team) {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Team names use lowercase letters, digits, - and _, up to 100 characters",
+			nil,
+		))
+	}
+
+	err = api.Users.SetUserTeam(c.Context(), userID, req.Team)
+	if errors.Is(err, api.ErrUserNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"User not found",
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to set user team: "+err.Error(),
+			nil,
+		))
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"User team updated successfully",
+		fiber.Map{"user_id": userID, "team": req.Team},
+	))
+}
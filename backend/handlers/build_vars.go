@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListBuildVars lists the build variables of an app. They are only given to builds, never to the
+// running containers, so they are kept apart from the env; values are never returned.
+func ListBuildVars(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	vars, err := api.Apps.ListBuildVars(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve build variables: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Build variables retrieved successfully",
+		fiber.Map{
+			"scope":      "build",
+			"build_vars": vars,
+		},
+	))
+}
+
+// SetBuildVars creates or replaces build variables of an app. They apply to the next build, the
+// running app is not restarted.
+func SetBuildVars(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		Vars map[string]string `json:"vars"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if len(req.Vars) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"At least one build variable is required",
+			nil,
+		))
+	}
+
+	keys := make([]string, 0, len(req.Vars))
+	encrypted := make(map[string]string, len(req.Vars))
+	for key, value := range req.Vars {
+		if err := utils.ValidateBuildVar(key, value); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				err.Error(),
+				nil,
+			))
+		}
+		sealed, err := utils.EncryptString(value)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+				false,
+				"Failed to encrypt build variable: "+err.Error(),
+				nil,
+			))
+		}
+		keys = append(keys, key)
+		encrypted[key] = sealed
+	}
+	sort.Strings(keys)
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	for _, key := range keys {
+		if err := api.Apps.SetBuildVar(c.Context(), appName, key, encrypted[key], userID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+				false,
+				"Failed to save build variables: "+err.Error(),
+				nil,
+			))
+		}
+	}
+
+	return applyBuildVars(c, appName, fmt.Sprintf("Set build variables %s", strings.Join(keys, ", ")), userID)
+}
+
+// DeleteBuildVar removes a build variable of an app from its next builds
+func DeleteBuildVar(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	key := c.Params("key")
+	if appName == "" || key == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name and key are required",
+			nil,
+		))
+	}
+
+	err := api.Apps.DeleteBuildVar(c.Context(), appName, key)
+	if errors.Is(err, api.ErrBuildVarNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Build variable "+key+" not found",
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to delete build variable: "+err.Error(),
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	return applyBuildVars(c, appName, "Removed build variable "+key, userID, key)
+}
+
+// applyBuildVars syncs the build options of an app with its stored build variables and logs the
+// change. Variables stay stored when dokku can't be updated, the next deploy applies them.
+func applyBuildVars(c *fiber.Ctx, appName, message string, userID *int, removed ...string) error {
+	activity, activityErr := database.LogConfigActivity(appName, "build_vars", message, userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log build variables activity: %v\n", activityErr)
+	}
+
+	err := utils.SyncBuildVars(context.Background(), appName, removed...)
+	if activity != nil {
+		if err != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		} else {
+			database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+		}
+	}
+	if err != nil {
+		return commandErrorResponse(c, "Build variables saved but not applied, the next deploy applies them", err, nil)
+	}
+
+	vars, err := api.Apps.ListBuildVars(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve build variables: "+err.Error(),
+			nil,
+		))
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		message+", they apply to the next build",
+		fiber.Map{
+			"scope":      "build",
+			"build_vars": vars,
+		},
+	))
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"backend/config"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ValidateSystemConfig checks the configuration of the backend like at startup, reporting errors
+// and warnings per setting. With ?live=true the certificate of the login host is checked too.
+func ValidateSystemConfig(c *fiber.Ctx) error {
+	report := config.ValidateEnvironment()
+	if c.QueryBool("live") {
+		config.CheckLoginHostCertificate(c.UserContext(), report)
+	}
+
+	message := "Configuration is valid"
+	if !report.Valid {
+		message = "Configuration has errors"
+	} else if report.Warnings > 0 {
+		message = "Configuration is valid with warnings"
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		message,
+		report,
+	))
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ConfigureSection is the outcome of a section of a configure request
+type ConfigureSection struct {
+	// Status is applied, unchanged, failed or skipped (not attempted after a failure)
+	Status  string                  `json:"status"`
+	Changes []*utils.ManifestChange `json:"changes,omitempty"`
+	Env     *utils.EnvUpdateResult  `json:"env,omitempty"`
+	Error   string                  `json:"error,omitempty"`
+}
+
+// configureSections is the order sections are applied in: the build settings first, then the
+// env vars, whose restart picks up the port, and the domains once the app answers on its port
+var configureSections = []string{"builder", "buildpacks", "port", "env", "domains"}
+
+// ConfigureApp sets the builder, buildpacks, port, env vars and domains of an app in one call,
+// in the order of configureSections. Sections left out are not changed and domains are only
+// added. A failed section stops the ones after it; the response then holds the result of every
+// section and how to roll back the applied ones.
+func ConfigureApp(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		Builder    string            `json:"builder"`
+		Buildpack  string            `json:"buildpack"`
+		Buildpacks []string          `json:"buildpacks"`
+		Port       int               `json:"port"`
+		Env        map[string]string `json:"env"`
+		Domains    []string          `json:"domains"`
+		NoRestart  bool              `json:"no_restart"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if req.Buildpack != "" {
+		req.Buildpacks = append([]string{req.Buildpack}, req.Buildpacks...)
+	}
+
+	desired := &utils.AppManifest{
+		Builder:    req.Builder,
+		Buildpacks: req.Buildpacks,
+		Port:       req.Port,
+		Domains:    req.Domains,
+	}
+	if err := desired.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	if _, exists := req.Env["PORT"]; exists {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"PORT environment variable cannot be modified manually, set port instead",
+			nil,
+		))
+	}
+	envKeys := make([]string, 0, len(req.Env))
+	for key := range req.Env {
+		envKeys = append(envKeys, key)
+	}
+	if blocked, err := protectedEnvChange(c, appName, envKeys); blocked {
+		return err
+	}
+
+	current, err := utils.ReadAppManifest(c.UserContext(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to read app configuration: "+err.Error(),
+			nil,
+		))
+	}
+
+	if current.Type == utils.AppTypeWorker && (req.Port != 0 || len(req.Domains) > 0) {
+		if refused, err := workerAppRefused(c, appName, "setting a port or domains"); refused {
+			return err
+		}
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	recordAppInteraction(c, appName, api.InteractionEnv)
+
+	// Domains are only added: the current ones stay in the desired list
+	if desired.Domains != nil {
+		desired.Domains = append(slices.Clone(current.Domains), desired.Domains...)
+	}
+	changes := utils.PlanAppManifest(appName, current, desired, false, userID)
+
+	activity, activityErr := database.LogConfigActivity(appName, "configure", "Configure app", userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log configure activity: %v\n", activityErr)
+	}
+	sections := make(map[string]*ConfigureSection)
+	failed := ""
+	for _, section := range configureSections {
+		result := &ConfigureSection{Status: "unchanged"}
+		sections[section] = result
+		if failed != "" {
+			result.Status = "skipped"
+			continue
+		}
+
+		if section == "env" {
+			if len(req.Env) == 0 {
+				continue
+			}
+			envResult, err := utils.SetEnvVerified(appName, req.Env, !req.NoRestart)
+			if envResult != nil {
+				trackEnvRestart(appName, envResult, userID)
+				result.Env = envResult
+			}
+			switch {
+			case err != nil:
+				result.Error = err.Error()
+			case envResult.Failed > 0:
+				result.Error = fmt.Sprintf("%d of %d environment variables were not applied", envResult.Failed, len(envResult.Keys))
+			}
+			result.Status = "applied"
+			if result.Error != "" {
+				result.Status = "failed"
+				failed = section
+			}
+			continue
+		}
+
+		for _, change := range changes {
+			if change.Section == section {
+				result.Changes = append(result.Changes, change)
+			}
+		}
+		if len(result.Changes) == 0 {
+			continue
+		}
+		result.Status = "applied"
+		if !utils.ApplyManifestChanges(c.UserContext(), result.Changes) {
+			result.Status = "failed"
+			for _, change := range result.Changes {
+				if change.Error != "" {
+					result.Error = change.Error
+				}
+			}
+			failed = section
+		}
+	}
+
+	if activity != nil {
+		if failed == "" {
+			database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+		} else {
+			errorMsg := "configure failed at " + failed
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+	}
+
+	if failed == "" {
+		return c.JSON(utils.NewCitizenResponse(
+			true,
+			"App configured",
+			fiber.Map{"sections": sections},
+		))
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+		false,
+		fmt.Sprintf("Failed to configure %s, the sections before it were applied", failed),
+		fiber.Map{
+			"failed_section": failed,
+			"sections":       sections,
+			"rollback":       configureRollback(appName, current, req.Env, sections),
+		},
+	))
+}
+
+// configureRollback tells how to undo the sections of a configure request that were applied:
+// a citizen.yml with their previous values, to apply with prune, and the env vars to remove or
+// restore by hand
+func configureRollback(appName string, previous *utils.AppManifest, env map[string]string, sections map[string]*ConfigureSection) fiber.Map {
+	manifest := &utils.AppManifest{App: appName}
+	applied := func(section string) bool {
+		return sections[section].Status == "applied" || sections[section].Status == "failed"
+	}
+	if applied("builder") {
+		manifest.Builder = previous.Builder
+	}
+	if applied("buildpacks") {
+		manifest.Buildpacks = previous.Buildpacks
+	}
+	if applied("port") {
+		manifest.Port = previous.Port
+	}
+	if applied("domains") {
+		manifest.Domains = previous.Domains
+	}
+
+	rollback := fiber.Map{}
+	if manifest.Builder != "" || manifest.Buildpacks != nil || manifest.Port != 0 || manifest.Domains != nil {
+		rollback["apply"] = fiber.Map{
+			"endpoint": fmt.Sprintf("POST /api/v1/apps/%s/apply?prune=true", appName),
+			"manifest": utils.RenderAppManifest(manifest),
+		}
+	}
+
+	if applied("env") {
+		var added, overwritten []string
+		for key := range env {
+			if slices.Contains(previous.Env, key) {
+				overwritten = append(overwritten, key)
+			} else {
+				added = append(added, key)
+			}
+		}
+		sort.Strings(added)
+		sort.Strings(overwritten)
+		rollback["env"] = fiber.Map{
+			// Added keys are removed with DELETE /api/v1/apps/<app>/env
+			"remove": added,
+			// Previous values of overwritten keys are not kept, they have to be set again
+			"restore": overwritten,
+		}
+	}
+	return rollback
+}
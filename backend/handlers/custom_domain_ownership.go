@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// isAdminRequest reports whether the user of a request is an admin, outside admin-only routes too
+func isAdminRequest(c *fiber.Ctx) bool {
+	if isAdmin, ok := c.Locals("is_admin").(bool); ok {
+		return isAdmin
+	}
+	userID, ok := c.Locals("user_id").(int)
+	if !ok {
+		return false
+	}
+	isAdmin, err := api.Users.IsUserAdmin(context.Background(), userID)
+	return err == nil && isAdmin
+}
+
+// customDomainTaken writes a conflict response when a custom domain is active on another app than
+// appName. Only admins are told which app owns it, along with how to move it.
+func customDomainTaken(c *fiber.Ctx, appName, domain string) (bool, error) {
+	owner, err := api.Settings.GetCustomDomainOwner(context.Background(), domain)
+	if err != nil {
+		utils.WarnLog("Failed to check the owner of custom domain %s: %v", domain, err)
+		return false, nil
+	}
+	if owner == "" || owner == appName {
+		return false, nil
+	}
+	return true, customDomainConflict(c, domain, owner)
+}
+
+// customDomainConflict responds that a custom domain belongs to another app
+func customDomainConflict(c *fiber.Ctx, domain, owner string) error {
+	if owner == "" || !isAdminRequest(c) {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("Domain %s is already used by another app", domain),
+			fiber.Map{"domain": domain},
+		))
+	}
+	return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+		false,
+		fmt.Sprintf("Domain %s is already used by app %s, move it with POST /api/v1/admin/custom-domains/%s/move", domain, owner, domain),
+		fiber.Map{"domain": domain, "owner_app": owner},
+	))
+}
+
+// ForceMoveCustomDomain moves a custom domain from the app that has it to another app, for admins
+// resolving a domain claimed by the wrong app
+func ForceMoveCustomDomain(c *fiber.Ctx) error {
+	domain := strings.TrimSpace(c.Params("domain"))
+	if domain == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Domain name is required",
+			nil,
+		))
+	}
+
+	var body struct {
+		AppName string `json:"app_name"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if body.AppName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	fromApp, err := api.Settings.GetCustomDomainOwner(context.Background(), domain)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to look up the custom domain: "+err.Error(),
+			nil,
+		))
+	}
+	if fromApp == "" {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("Domain %s is not used by any app", domain),
+			nil,
+		))
+	}
+	if fromApp == body.AppName {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("Domain %s already belongs to %s", domain, body.AppName),
+			nil,
+		))
+	}
+
+	apps, err := utils.ListApps()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list apps: "+err.Error(),
+			nil,
+		))
+	}
+	found := false
+	for _, app := range apps {
+		if app == body.AppName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"App not found: "+body.AppName,
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	details := map[string]interface{}{"from_app": fromApp, "to_app": body.AppName}
+
+	// The previous app may have lost the domain outside Citizen already, that doesn't block the move
+	if _, err := utils.RemoveDomain(fromApp, domain); err != nil {
+		utils.WarnLog("Failed to remove domain %s from %s while moving it: %v", domain, fromApp, err)
+	}
+
+	output, err := utils.AddDomain(body.AppName, domain)
+	if err != nil {
+		if _, restoreErr := utils.AddDomain(fromApp, domain); restoreErr != nil {
+			fmt.Printf("[CRITICAL] Domain %s could not be restored on %s after a failed move: %v\n", domain, fromApp, restoreErr)
+		}
+		auditSystemAction(c, "custom_domain_move", domain, details, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Error occurred while adding domain to Citizen: "+err.Error(),
+			nil,
+		))
+	}
+
+	if _, err := api.Settings.MoveCustomDomain(context.Background(), domain, body.AppName); err != nil {
+		if _, rollbackErr := utils.RemoveDomain(body.AppName, domain); rollbackErr != nil {
+			fmt.Printf("[CRITICAL] Domain %s could not be removed from %s after a failed move: %v\n", domain, body.AppName, rollbackErr)
+		}
+		if _, restoreErr := utils.AddDomain(fromApp, domain); restoreErr != nil {
+			fmt.Printf("[CRITICAL] Domain %s could not be restored on %s after a failed move: %v\n", domain, fromApp, restoreErr)
+		}
+		auditSystemAction(c, "custom_domain_move", domain, details, err)
+
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, api.ErrCustomDomainNotFound) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(utils.NewCitizenResponse(
+			false,
+			"Error occurred while moving domain in database: "+err.Error(),
+			nil,
+		))
+	}
+	auditSystemAction(c, "custom_domain_move", domain, details, nil)
+
+	// The traefik watcher reads the domain of each app from app_deployments
+	if err := api.Deployments.UpdateDeploymentDomain(context.Background(), fromApp, ""); err != nil {
+		fmt.Printf("[WARN] app_deployments domain clear failed for %s: %v\n", fromApp, err)
+	}
+	if err := api.Deployments.UpdateDeploymentDomain(context.Background(), body.AppName, domain); err != nil {
+		fmt.Printf("[WARN] app_deployments domain update failed for %s - %s: %v\n", body.AppName, domain, err)
+	}
+	if reloadErr := utils.ReloadTraefikContext(c.UserContext()); reloadErr != nil {
+		fmt.Printf("[WARN] Traefik reload failed for domain %s: %v\n", domain, reloadErr)
+	}
+
+	for app, action := range map[string]string{fromApp: "moved away", body.AppName: "moved in"} {
+		activity, activityErr := database.LogDomainActivity(app, domain, action, userID)
+		if activityErr != nil {
+			fmt.Printf("[ACTIVITY] ⚠️ Failed to log domain activity: %v\n", activityErr)
+			continue
+		}
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Custom domain moved successfully",
+		fiber.Map{
+			"domain":         domain,
+			"from_app":       fromApp,
+			"to_app":         body.AppName,
+			"citizen_output": output,
+		},
+	))
+}
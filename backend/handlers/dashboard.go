@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// dashboardActivityLimit is how many recent activities the dashboard summary includes
+	dashboardActivityLimit = 10
+	// dashboardActiveUserWindow is how far back a user counts as active
+	dashboardActiveUserWindow = 7 * 24 * time.Hour
+	// dashboardTimeout bounds the queries of a summary
+	dashboardTimeout = 30 * time.Second
+)
+
+// DashboardApps counts the apps on the platform
+type DashboardApps struct {
+	Total       int `json:"total"`
+	Running     int `json:"running"`
+	Stopped     int `json:"stopped"`
+	NotDeployed int `json:"not_deployed"`
+}
+
+// DashboardUsers counts the users of the platform
+type DashboardUsers struct {
+	Total  int `json:"total"`
+	Active int `json:"active"`
+}
+
+// DashboardSummary gathers the stats of the dashboard home page
+type DashboardSummary struct {
+	Apps             *DashboardApps       `json:"apps"`
+	Deployments      *api.DeploymentStats `json:"deployments"`
+	Users            *DashboardUsers      `json:"users"`
+	Host             *utils.HostResources `json:"host"`
+	RecentActivities []api.Activity       `json:"recent_activities"`
+	Errors           map[string]string    `json:"errors,omitempty"`
+	GeneratedAt      time.Time            `json:"generated_at"`
+}
+
+// GetDashboardSummary returns the aggregate stats of the platform in one response. The sections
+// are gathered concurrently; a section that fails is left empty and its error reported in "errors".
+func GetDashboardSummary(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dashboardTimeout)
+	defer cancel()
+
+	now := time.Now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	weekStart := dayStart.AddDate(0, 0, -((int(dayStart.Weekday()) + 6) % 7)) // weeks start on Monday
+
+	summary := &DashboardSummary{RecentActivities: []api.Activity{}, GeneratedAt: now.UTC()}
+	errs := make(map[string]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	section := func(name string, load func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := load(); err != nil {
+				mu.Lock()
+				errs[name] = err.Error()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	section("apps", func() error {
+		apps, err := dashboardApps()
+		summary.Apps = apps
+		return err
+	})
+	section("deployments", func() error {
+		stats, err := api.Deployments.GetDeploymentStats(ctx, dayStart, weekStart)
+		summary.Deployments = stats
+		return err
+	})
+	section("users", func() error {
+		total, err := api.Users.CountUsers(ctx)
+		if err != nil {
+			return err
+		}
+		active, err := api.Users.CountActiveUsers(ctx, now.Add(-dashboardActiveUserWindow))
+		if err != nil {
+			return err
+		}
+		summary.Users = &DashboardUsers{Total: total, Active: active}
+		return nil
+	})
+	section("host", func() error {
+		host, err := utils.GetHostResources(ctx)
+		summary.Host = host
+		return err
+	})
+	section("recent_activities", func() error {
+		activities, err := api.Activities.GetRecentActivities(ctx, dashboardActivityLimit)
+		if err != nil {
+			return err
+		}
+		if activities != nil {
+			summary.RecentActivities = activities
+		}
+		return nil
+	})
+
+	wg.Wait()
+	if len(errs) > 0 {
+		summary.Errors = errs
+		utils.WarnLog("Dashboard summary incomplete: %v", errs)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Dashboard summary retrieved successfully",
+		summary,
+	))
+}
+
+// dashboardApps counts the apps by state
+func dashboardApps() (*DashboardApps, error) {
+	infos, err := utils.GetAllAppsInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	apps := &DashboardApps{Total: len(infos)}
+	for _, info := range infos {
+		deployed, _ := info["deployed"].(bool)
+		running, _ := info["running"].(bool)
+		switch {
+		case !deployed:
+			apps.NotDeployed++
+		case running:
+			apps.Running++
+		default:
+			apps.Stopped++
+		}
+	}
+	return apps, nil
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"strings"
+
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetDashboardAccessConfig returns the extra dashboard origins and cookie domains
+func GetDashboardAccessConfig(c *fiber.Ctx) error {
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Dashboard access config retrieved successfully",
+		fiber.Map{
+			"config":     utils.GetDashboardAccessConfig(),
+			"login_host": getLoginHost(),
+		},
+	))
+}
+
+// SetDashboardAccessConfig changes the extra dashboard origins and cookie domains
+func SetDashboardAccessConfig(c *fiber.Ctx) error {
+	var config utils.DashboardAccessConfig
+	if err := c.BodyParser(&config); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	if err := config.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	err := utils.SaveDashboardAccessConfig(c.Context(), &config)
+	auditSystemAction(c, "dashboard_access_set", utils.DashboardAccessSettingKey, map[string]interface{}{
+		"origins":        config.Origins,
+		"cookie_domains": config.CookieDomains,
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save dashboard access config: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Dashboard access config updated",
+		config,
+	))
+}
+
+// ExplainCookiePolicy explains the cookies and CORS policy applied to a host, and optionally to
+// an origin calling the API, with the reason for each choice
+func ExplainCookiePolicy(c *fiber.Ctx) error {
+	host := strings.ToLower(strings.TrimSpace(c.Query("host")))
+	if host == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"host is required",
+			nil,
+		))
+	}
+	proto := c.Query("proto", "https")
+
+	domainTypes := map[DomainType]string{
+		DomainTypeLogin:     "login",
+		DomainTypeSubdomain: "subdomain",
+		DomainTypeCustom:    "custom",
+	}
+	explanation := fiber.Map{
+		"host":        host,
+		"domain_type": domainTypes[getDomainType(host)],
+		"login_host":  getLoginHost(),
+		"force_https": isHttpsRequired(),
+		// Cookie set when the session is checked or rotated on this host
+		"session_cookie": getCookieConfig(host, proto),
+		// Cookies set when logging in from this host
+		"login_cookie": fiber.Map{
+			"domain":    getCookieDomainForHost(host),
+			"same_site": getSameSitePolicy(host),
+			"secure":    isHttpsRequired(),
+		},
+		"login_host_cookie": getCookieConfigForLoginHost(proto),
+	}
+
+	if origin := c.Query("origin"); origin != "" {
+		explanation["origin"] = fiber.Map{
+			"origin":            origin,
+			"cors_allowed":      utils.DashboardOriginAllowed(origin),
+			"sso_check_allowed": isAllowedOrigin(origin),
+		}
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Cookie policy explained",
+		explanation,
+	))
+}
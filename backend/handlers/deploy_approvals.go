@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetProductionApp returns whether an app is flagged as production
+func GetProductionApp(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	production, err := api.Apps.IsProductionApp(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve production flag: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Production flag retrieved successfully",
+		fiber.Map{"app_name": appName, "production": production},
+	))
+}
+
+// SetProductionApp flags an app as production or clears the flag. Webhook deployments of
+// production apps wait for an admin to approve them before they are built.
+func SetProductionApp(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		Production bool `json:"production"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	message := "Flagged the app as production, webhook deployments need approval"
+	if !req.Production {
+		message = "Cleared the production flag of the app"
+	}
+	activity, activityErr := database.LogConfigActivity(appName, "production", message, userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log production flag activity: %v\n", activityErr)
+	}
+
+	err := api.Apps.SetProductionApp(c.Context(), appName, req.Production, userID)
+	if activity != nil {
+		var errorMsg *string
+		status := database.StatusSuccess
+		if err != nil {
+			text := err.Error()
+			errorMsg = &text
+			status = database.StatusError
+		}
+		database.UpdateActivity(activity.ID, status, errorMsg)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to set production flag: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Production flag updated successfully",
+		fiber.Map{"app_name": appName, "production": req.Production},
+	))
+}
+
+// ListPendingApprovals lists the deployments of every app waiting for an admin, oldest first
+func ListPendingApprovals(c *fiber.Ctx) error {
+	records, err := api.Deployments.ListPendingApprovals(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list pending approvals: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Pending approvals retrieved successfully",
+		fiber.Map{"deployments": records, "total": len(records)},
+	))
+}
+
+// requestDeploymentApproval records a deployment of a production app that waits for approval and
+// notifies the approvers instead of deploying
+func requestDeploymentApproval(appName, gitURL, branch, commit, tag string, activity *database.Activity, userID *int, triggerType database.TriggerType) (*api.DeploymentRecord, error) {
+	record, err := database.RecordPendingApproval(appName, gitURL, branch, commit, tag, activity, userID, triggerType)
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+		return nil, err
+	}
+	log.Printf("[DEPLOY] ✋ Deployment %d of %s waits for approval", record.ID, appName)
+
+	utils.NotifyDeploymentApprovers(context.Background(), record)
+	return record, nil
+}
+
+// pendingApprovalFromParams reads the deployment of the :id route parameter and checks it waits
+// for approval. When it returns nil the response was already sent.
+func pendingApprovalFromParams(c *fiber.Ctx) (*api.DeploymentRecord, error) {
+	deploymentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil || deploymentID <= 0 {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid deployment ID",
+			nil,
+		))
+	}
+
+	record, err := api.Deployments.FindDeploymentRecord(c.Context(), deploymentID)
+	if errors.Is(err, api.ErrDeploymentRecordNotFound) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Deployment not found",
+			nil,
+		))
+	}
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve deployment: "+err.Error(),
+			nil,
+		))
+	}
+	if record.Status != string(database.StatusPendingApproval) {
+		return nil, deploymentNotAwaitingApproval(c, record.ID, record.Status)
+	}
+	return record, nil
+}
+
+// deploymentNotAwaitingApproval answers the review of a deployment that was already reviewed
+func deploymentNotAwaitingApproval(c *fiber.Ctx, id int, status string) error {
+	return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+		false,
+		fmt.Sprintf("Deployment %d is %s, only deployments waiting for approval can be reviewed", id, status),
+		nil,
+	))
+}
+
+// ApproveDeployment approves a deployment waiting for approval and starts it in the background.
+// The commit that was pushed is deployed, not whatever the branch points to now, and git is
+// authenticated as the user of the repository connection, like the push would have been.
+func ApproveDeployment(c *fiber.Ctx) error {
+	record, err := pendingApprovalFromParams(c)
+	if record == nil {
+		return err
+	}
+	reviewerID, _ := c.Locals("user_id").(int)
+
+	if err := database.CheckBuildQuota(c.UserContext(), record.AppName, record.UserID); err != nil {
+		return buildQuotaResponse(c, err)
+	}
+
+	err = api.Deployments.ReviewDeployment(c.Context(), record.ID, true, reviewerID)
+	auditSystemAction(c, "deployment.approve", record.AppName, map[string]interface{}{"deployment_id": record.ID}, err)
+	if errors.Is(err, api.ErrDeploymentNotAwaitingApproval) {
+		return deploymentNotAwaitingApproval(c, record.ID, "already reviewed")
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to approve deployment: "+err.Error(),
+			nil,
+		))
+	}
+	record.Status = string(database.StatusPending)
+	record.StartedAt = time.Now()
+
+	var activity *database.Activity
+	if record.ActivityID != nil {
+		if activity, err = database.GetActivityByID(*record.ActivityID); err != nil {
+			log.Printf("[DEPLOY] ⚠️ Failed to load activity of deployment %d: %v", record.ID, err)
+			activity = nil
+		} else {
+			database.SetActivityStatus(activity.ID, database.StatusPending)
+			if err := api.Activities.MergeActivityDetails(context.Background(), activity.ID,
+				map[string]interface{}{"approved_by": reviewerID}); err != nil {
+				log.Printf("[DEPLOY] ⚠️ Failed to record the approval on activity %d: %v", activity.ID, err)
+			}
+		}
+	}
+
+	ref := record.GitBranch
+	if utils.IsCommitSHA(record.GitCommit) {
+		ref = record.GitCommit
+	}
+	log.Printf("[DEPLOY] ✅ Deployment %d of %s approved by user %d", record.ID, record.AppName, reviewerID)
+
+	go func() {
+		diagnostics := utils.NewDeployDiagnostics()
+		diagnostics.Info("approval", "approved by user %d", reviewerID)
+		detectAndApplyPort(diagnostics, record.AppName, record.GitURL, record.GitBranch, record.UserID,
+			&utils.PortDetectionHint{CommitSHA: record.GitCommit}, "")
+
+		output, err := runRecordedDeployment(diagnostics, record, record.AppName, record.GitURL, ref, activity, record.UserID)
+		if err != nil {
+			log.Printf("[DEPLOY] ❌ Approved deployment %d of %s failed: %v", record.ID, record.AppName, err)
+		}
+
+		// Webhook deployments also track their outcome per commit for GitHub
+		if record.TriggerType == string(database.TriggerWebhook) && record.GitCommit != "" {
+			if err != nil {
+				errorOutput := err.Error()
+				database.UpdateGitHubDeploymentStatus(record.AppName, record.GitCommit, "failed", &output, &errorOutput)
+			} else {
+				database.UpdateGitHubDeploymentStatus(record.AppName, record.GitCommit, "success", &output, nil)
+			}
+		}
+	}()
+
+	return c.Status(fiber.StatusAccepted).JSON(utils.NewCitizenResponse(
+		true,
+		fmt.Sprintf("Deployment %d approved and started", record.ID),
+		fiber.Map{
+			"app_name":        record.AppName,
+			"deployment_id":   record.ID,
+			"git_branch":      record.GitBranch,
+			"git_commit":      record.GitCommit,
+			"diagnostics_url": deploymentDiagnosticsURL(record.AppName, record.ID),
+		},
+	))
+}
+
+// RejectDeployment rejects a deployment waiting for approval, with an optional reason, so it is
+// never built
+func RejectDeployment(c *fiber.Ctx) error {
+	record, err := pendingApprovalFromParams(c)
+	if record == nil {
+		return err
+	}
+	reviewerID, _ := c.Locals("user_id").(int)
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Invalid request content",
+				nil,
+			))
+		}
+	}
+
+	err = api.Deployments.ReviewDeployment(c.Context(), record.ID, false, reviewerID)
+	auditSystemAction(c, "deployment.reject", record.AppName,
+		map[string]interface{}{"deployment_id": record.ID, "reason": req.Reason}, err)
+	if errors.Is(err, api.ErrDeploymentNotAwaitingApproval) {
+		return deploymentNotAwaitingApproval(c, record.ID, "already reviewed")
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to reject deployment: "+err.Error(),
+			nil,
+		))
+	}
+
+	if record.ActivityID != nil {
+		message := fmt.Sprintf("Rejected by user %d", reviewerID)
+		if req.Reason != "" {
+			message += ": " + req.Reason
+		}
+		database.UpdateActivity(*record.ActivityID, database.StatusRejected, &message)
+	}
+	log.Printf("[DEPLOY] 🚫 Deployment %d of %s rejected by user %d", record.ID, record.AppName, reviewerID)
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		fmt.Sprintf("Deployment %d rejected", record.ID),
+		fiber.Map{"app_name": record.AppName, "deployment_id": record.ID, "reason": req.Reason},
+	))
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errDeployArchiveTooLarge is returned for archives over DEPLOY_ARCHIVE_MAX_BYTES
+var errDeployArchiveTooLarge = errors.New("archive too large")
+
+// DeployArchive deploys an app from a .tar, .tar.gz or .zip archive of its source uploaded as the
+// archive form file, for apps without a git remote. The archive is streamed to the dokku host over
+// SSH and built with git:from-archive like a git push would be.
+func DeployArchive(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	archive, archiveName, archiveSize, err := receiveDeployArchive(c)
+	if errors.Is(err, errDeployArchiveTooLarge) {
+		c.Context().SetConnectionClose()
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(utils.NewCitizenResponse(
+			false,
+			"Archives are limited to "+utils.FormatImageSize(utils.DeployArchiveMaxBytes()),
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	archiveType, digest, err := inspectDeployArchive(archive)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+	}
+
+	if missing, err := capabilityMissing(c, utils.FeatureGitArchive); missing {
+		return err
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if err := database.CheckBuildQuota(c.UserContext(), appName, userID); err != nil {
+		return buildQuotaResponse(c, err)
+	}
+
+	apps, err := utils.ListApps()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list apps: "+err.Error(),
+			nil,
+		))
+	}
+	if !slices.Contains(apps, appName) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("App %s does not exist", appName),
+			nil,
+		))
+	}
+
+	recordAppInteraction(c, appName, api.InteractionDeploy)
+
+	activity, activityErr := database.LogActivity(appName, database.ActivityDeploy, database.StatusPending,
+		fmt.Sprintf("Deployment started from an uploaded %s archive", archiveType),
+		map[string]interface{}{"archive_name": archiveName, "archive_type": archiveType,
+			"archive_digest": digest, "archive_size": archiveSize},
+		userID, database.TriggerManual)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log archive deployment activity: %v\n", activityErr)
+	}
+
+	record, recordErr := database.StartArchiveDeploymentRecord(appName, digest, activity, userID)
+	if recordErr != nil {
+		fmt.Printf("[DEPLOY] ⚠️ Failed to record archive deployment: %v\n", recordErr)
+	}
+
+	diagnostics := utils.NewDeployDiagnostics()
+	diagnostics.Info("archive", "deploying %s archive %s (%s, %s)", archiveType, archiveName,
+		utils.FormatImageSize(archiveSize), digest)
+
+	deployCtx, finishDeploy, err := deploymentContext(record, appName)
+	var output string
+	if err == nil {
+		output, err = utils.DeployFromArchiveContext(utils.WithDiagnostics(deployCtx, diagnostics), appName, archiveType, archive)
+		finishDeploy()
+	}
+
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, deploymentFailureStatus(err), &errorMsg)
+		}
+		if record != nil {
+			database.FinishDeploymentRecord(record.ID, deploymentFailureStatus(err), output, err, diagnostics)
+			emitDeploymentEvent(record, err)
+		}
+
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, utils.ErrDeploymentCancelled) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(utils.NewCitizenResponse(
+			false,
+			"Archive deployment failed: "+err.Error(),
+			fiber.Map{"output": output},
+		))
+	}
+
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+	clearPendingRestart(appName)
+	responseData := fiber.Map{
+		"app_name":       appName,
+		"archive_type":   archiveType,
+		"source_archive": digest,
+		"output":         output,
+	}
+	if record != nil {
+		recordDeploymentImage(diagnostics, appName, record.ID)
+		database.FinishDeploymentRecord(record.ID, database.StatusSuccess, output, nil, diagnostics)
+		emitDeploymentEvent(record, nil)
+		responseData["deployment_id"] = record.ID
+		responseData["diagnostics_url"] = deploymentDiagnosticsURL(appName, record.ID)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		fmt.Sprintf("%s deployed from the uploaded archive successfully", appName),
+		responseData,
+	))
+}
+
+// receiveDeployArchive reads the archive form file from the streamed multipart body into a
+// temporary file, refusing archives over DEPLOY_ARCHIVE_MAX_BYTES. It returns the file, rewound,
+// with the name and size of the archive. The caller removes the file.
+func receiveDeployArchive(c *fiber.Ctx) (*os.File, string, int64, error) {
+	noArchive := errors.New("upload the archive as the archive form file")
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return nil, "", 0, noArchive
+	}
+
+	// The other form fields are small, the body may exceed the archive by 1MB
+	limit := utils.DeployArchiveMaxBytes()
+	if int64(c.Request().Header.ContentLength()) > limit+1<<20 {
+		return nil, "", 0, errDeployArchiveTooLarge
+	}
+	body := io.Reader(bytes.NewReader(c.Body()))
+	if c.Request().IsBodyStream() {
+		body = c.Request().BodyStream()
+	}
+
+	form := multipart.NewReader(io.LimitReader(body, limit+1<<20), boundary)
+	for {
+		part, err := form.NextPart()
+		if err != nil {
+			return nil, "", 0, noArchive
+		}
+		if part.FormName() != "archive" {
+			continue
+		}
+
+		file, err := os.CreateTemp("", "citizen-archive-*")
+		if err != nil {
+			return nil, "", 0, fmt.Errorf("failed to store the archive: %w", err)
+		}
+		size, err := io.Copy(file, io.LimitReader(part, limit+1))
+		if err == nil && size > limit {
+			err = errDeployArchiveTooLarge
+		} else if err != nil {
+			err = fmt.Errorf("failed to read the archive: %w", err)
+		} else {
+			_, err = file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return nil, "", 0, err
+		}
+		return file, filepath.Base(part.FileName()), size, nil
+	}
+}
+
+// inspectDeployArchive tells the type of an uploaded archive from its content and returns its
+// sha256 digest, which identifies it in the deployment history. The archive is rewound after.
+func inspectDeployArchive(file io.ReadSeeker) (string, string, error) {
+	start := make([]byte, 512)
+	n, err := io.ReadFull(file, start)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", "", errors.New("the archive is empty")
+	}
+	archiveType, err := utils.DetectArchiveType(start[:n])
+	if err != nil {
+		return "", "", err
+	}
+
+	hash := sha256.New()
+	hash.Write(start[:n])
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", "", fmt.Errorf("failed to read the archive: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", "", fmt.Errorf("failed to read the archive: %w", err)
+	}
+	return archiveType, "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
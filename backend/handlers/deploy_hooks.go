@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetDeployHooks returns the commands run before and after the deployments of an app
+func GetDeployHooks(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	hooks, err := api.Apps.ListDeployHooks(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve deploy hooks: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Deploy hooks retrieved successfully",
+		fiber.Map{
+			"app_name": appName,
+			"hooks":    hooks,
+			"stages":   []string{utils.HookStagePreDeploy, utils.HookStagePostDeploy},
+		},
+	))
+}
+
+// SetDeployHooks replaces the deploy hooks of an app, an empty list removes them. From the next
+// git deployment, pre_deploy hooks run with dokku run in the release deployed so far and a
+// failing one stops the deployment; post_deploy hooks run in the new release once it is deployed.
+func SetDeployHooks(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		Hooks []api.DeployHook `json:"hooks"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if err := utils.ValidateDeployHooks(req.Hooks); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if err := api.Apps.ReplaceDeployHooks(c.Context(), appName, req.Hooks, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save deploy hooks: "+err.Error(),
+			nil,
+		))
+	}
+
+	message := fmt.Sprintf("Set %d deploy hooks", len(req.Hooks))
+	if activity, err := database.LogConfigActivity(appName, "deploy_hooks", message, userID); err != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log deploy hooks activity: %v\n", err)
+	} else {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	saved, err := api.Apps.ListDeployHooks(c.Context(), appName)
+	if err != nil {
+		saved = req.Hooks
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Deploy hooks saved, they apply to the next deployment",
+		fiber.Map{
+			"app_name": appName,
+			"hooks":    saved,
+		},
+	))
+}
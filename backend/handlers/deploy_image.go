@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DeployImage deploys a prebuilt image from a registry (e.g. ghcr.io/org/app:v1.2) instead of
+// building the app from source. The image is pulled with the credentials of the Docker connection
+// (docker login) of its registry, tagged under a unique name so git:from-image always deploys it,
+// even when the tag was deployed before, and deployed without a build.
+func DeployImage(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var data struct {
+		Image string `json:"image"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	data.Image = strings.TrimSpace(data.Image)
+	if data.Image == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Image is required",
+			nil,
+		))
+	}
+	if err := utils.ValidateDeployImage(data.Image); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+	}
+
+	if missing, err := capabilityMissing(c, utils.FeatureGitImage); missing {
+		return err
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if err := database.CheckBuildQuota(c.UserContext(), appName, userID); err != nil {
+		return buildQuotaResponse(c, err)
+	}
+
+	apps, err := utils.ListApps()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list apps: "+err.Error(),
+			nil,
+		))
+	}
+	if !slices.Contains(apps, appName) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("App %s does not exist", appName),
+			nil,
+		))
+	}
+
+	registryAuth, err := dockerRegistryAuth(imageRegistryHost(data.Image))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to read registry credentials: "+err.Error(),
+			nil,
+		))
+	}
+
+	recordAppInteraction(c, appName, api.InteractionDeploy)
+
+	activity, activityErr := database.LogActivity(appName, database.ActivityDeploy, database.StatusPending,
+		fmt.Sprintf("Deployment started from image %s", data.Image), map[string]interface{}{"image": data.Image},
+		userID, database.TriggerManual)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log image deployment activity: %v\n", activityErr)
+	}
+
+	record, recordErr := database.StartImageDeploymentRecord(appName, data.Image, activity, userID)
+	if recordErr != nil {
+		fmt.Printf("[DEPLOY] ⚠️ Failed to record image deployment: %v\n", recordErr)
+	}
+
+	diagnostics := utils.NewDeployDiagnostics()
+	diagnostics.Info("image", "deploying image %s", data.Image)
+
+	// git:from-image only deploys when the image name changes, so every deployment gets its own tag
+	image := fmt.Sprintf("citizen/%s:image-%d", appName, time.Now().Unix())
+	deployCtx, finishDeploy, err := deploymentContext(record, appName)
+	var output, imageID string
+	if err == nil {
+		ctx := utils.WithDiagnostics(deployCtx, diagnostics)
+		imageID, err = utils.PullImage(ctx, data.Image, registryAuth)
+		if err == nil {
+			diagnostics.Info("image", "pulled %s as %s", data.Image, imageID)
+			err = utils.TagImage(ctx, imageID, image)
+		}
+		if err == nil {
+			output, err = utils.DeployFromImageContext(ctx, appName, image)
+		}
+		finishDeploy()
+	}
+
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, deploymentFailureStatus(err), &errorMsg)
+		}
+		if record != nil {
+			database.FinishDeploymentRecord(record.ID, deploymentFailureStatus(err), output, err, diagnostics)
+			emitDeploymentEvent(record, err)
+		}
+
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, utils.ErrDeploymentCancelled) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(utils.NewCitizenResponse(
+			false,
+			"Image deployment failed: "+err.Error(),
+			fiber.Map{"output": output},
+		))
+	}
+
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+	clearPendingRestart(appName)
+	responseData := fiber.Map{
+		"app_name":        appName,
+		"source_image":    data.Image,
+		"source_image_id": imageID,
+		"image":           image,
+		"output":          output,
+	}
+	if record != nil {
+		recordDeploymentImage(diagnostics, appName, record.ID)
+		database.FinishDeploymentRecord(record.ID, database.StatusSuccess, output, nil, diagnostics)
+		emitDeploymentEvent(record, nil)
+		responseData["deployment_id"] = record.ID
+		responseData["diagnostics_url"] = deploymentDiagnosticsURL(appName, record.ID)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		fmt.Sprintf("%s deployed from %s successfully", appName, data.Image),
+		responseData,
+	))
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"backend/database"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListDeployQueue returns the running deployment of an app and the deployments queued behind it,
+// with their position in the queue
+func ListDeployQueue(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	queue, err := database.ListDeployQueue(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve the deploy queue: "+err.Error(),
+			nil,
+		))
+	}
+
+	type queuedDeployment struct {
+		database.QueuedDeployment
+		StreamURL string `json:"stream_url,omitempty"`
+	}
+	deployments := make([]queuedDeployment, 0, len(queue))
+	queued := 0
+	for _, deployment := range queue {
+		entry := queuedDeployment{QueuedDeployment: deployment}
+		if deployment.State == database.DeployQueueRunning && deployment.DeploymentID > 0 {
+			entry.StreamURL = deploymentStreamURL(appName, deployment.DeploymentID)
+		}
+		if deployment.State == database.DeployQueueQueued {
+			queued++
+		}
+		deployments = append(deployments, entry)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Deploy queue retrieved successfully",
+		fiber.Map{
+			"app_name":    appName,
+			"deployments": deployments,
+			"queued":      queued,
+			"backend":     database.DeployQueueBackend(),
+		},
+	))
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RetryDeployment re-runs a failed or cancelled deployment with the same repository, branch and
+// commit, authenticating git as the user of the original deployment. The retry gets its own
+// activity and deployment record linked to the failed one, which is left unchanged. Webhook
+// deployments reuse the commit message and author of the push and update its GitHub status.
+func RetryDeployment(c *fiber.Ctx) error {
+	failed, err := deploymentRecordFromParams(c)
+	if failed == nil {
+		return err
+	}
+
+	if failed.Status != string(database.StatusError) && failed.Status != string(database.StatusCancelled) {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("Only failed or cancelled deployments can be retried, deployment %d is %s", failed.ID, failed.Status),
+			nil,
+		))
+	}
+	if failed.SourceApp != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("Deployment %d was promoted from %s, promote it again instead", failed.ID, failed.SourceApp),
+			nil,
+		))
+	}
+	if failed.SourceImage != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("Deployment %d was made from image %s, deploy the image again instead", failed.ID, failed.SourceImage),
+			nil,
+		))
+	}
+	if failed.SourceArchive != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("Deployment %d was made from an uploaded archive, upload it again instead", failed.ID),
+			nil,
+		))
+	}
+	if failed.GitURL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("Deployment %d has no git repository to deploy from", failed.ID),
+			nil,
+		))
+	}
+
+	if missing, err := capabilityMissing(c, utils.FeatureGitSync); missing {
+		return err
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if err := database.CheckBuildQuota(c.UserContext(), failed.AppName, userID); err != nil {
+		return buildQuotaResponse(c, err)
+	}
+	// Private repositories are read with the token of whoever deployed originally
+	gitUserID := failed.UserID
+	if gitUserID == nil {
+		gitUserID = userID
+	}
+
+	// Deploy the exact commit that failed, not whatever the branch points to now
+	ref := failed.GitCommit
+	if ref == "" {
+		ref = failed.GitBranch
+	}
+
+	details := map[string]interface{}{
+		"git_url":                failed.GitURL,
+		"branch":                 failed.GitBranch,
+		"retry_of_deployment_id": failed.ID,
+		"original_trigger":       failed.TriggerType,
+	}
+	if failed.GitCommit != "" {
+		details["commit_hash"] = failed.GitCommit
+	}
+	if failed.ActivityID != nil {
+		details["retry_of_activity_id"] = *failed.ActivityID
+		if original, err := database.GetActivityByID(*failed.ActivityID); err == nil {
+			for _, key := range []string{"commit_message", "author", "source"} {
+				if value, ok := original.Details[key]; ok {
+					details[key] = value
+				}
+			}
+		}
+	}
+
+	message := fmt.Sprintf("Retry of deployment %d from %s", failed.ID, failed.GitBranch)
+	if commitMessage, ok := details["commit_message"].(string); ok && commitMessage != "" {
+		message = fmt.Sprintf("Retry of deployment %d: %s", failed.ID, commitMessage)
+	}
+
+	recordAppInteraction(c, failed.AppName, api.InteractionDeploy)
+
+	activity, activityErr := database.LogActivity(failed.AppName, database.ActivityDeploy, database.StatusPending, message,
+		details, userID, database.TriggerManual)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log retry activity: %v\n", activityErr)
+	}
+
+	record, recordErr := database.StartRetryRecord(failed, activity, userID)
+	if recordErr != nil {
+		fmt.Printf("[DEPLOY] ⚠️ Failed to record retry: %v\n", recordErr)
+	}
+
+	diagnostics := utils.NewDeployDiagnostics()
+	diagnostics.Info("retry", "re-running %s deployment %d at %s", failed.TriggerType, failed.ID, ref)
+	detectAndApplyPort(diagnostics, failed.AppName, failed.GitURL, failed.GitBranch, gitUserID,
+		&utils.PortDetectionHint{CommitSHA: failed.GitCommit}, "")
+
+	output, err := runRecordedDeployment(diagnostics, record, failed.AppName, failed.GitURL, ref, activity, gitUserID)
+
+	// Webhook deployments also track their outcome per commit for GitHub
+	if failed.TriggerType == string(database.TriggerWebhook) && failed.GitCommit != "" {
+		if err != nil {
+			errorOutput := err.Error()
+			database.UpdateGitHubDeploymentStatus(failed.AppName, failed.GitCommit, "failed", &output, &errorOutput)
+		} else {
+			database.UpdateGitHubDeploymentStatus(failed.AppName, failed.GitCommit, "success", &output, nil)
+		}
+	}
+
+	responseData := fiber.Map{
+		"app_name":               failed.AppName,
+		"retry_of_deployment_id": failed.ID,
+		"git_branch":             failed.GitBranch,
+		"git_commit":             failed.GitCommit,
+		"output":                 output,
+	}
+	if record != nil {
+		responseData["deployment_id"] = record.ID
+		responseData["diagnostics_url"] = deploymentDiagnosticsURL(failed.AppName, record.ID)
+	}
+
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, utils.ErrDeploymentCancelled) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(utils.NewCitizenResponse(
+			false,
+			"Retry failed: "+err.Error(),
+			responseData,
+		))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		fmt.Sprintf("Deployment %d retried successfully", failed.ID),
+		responseData,
+	))
+}
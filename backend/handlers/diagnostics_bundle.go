@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/database/api"
+	"backend/scheduler"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// diagnosticsTimeout bounds the database queries run for a bundle
+	diagnosticsTimeout = 60 * time.Second
+	// diagnosticsFailedDeploysWindow is how far back failed deployments are collected
+	diagnosticsFailedDeploysWindow = 7 * 24 * time.Hour
+	maxDiagnosticsFailedDeploys    = 50
+)
+
+// sensitiveEnvPattern matches environment variable names whose values are left out of bundles
+var sensitiveEnvPattern = regexp.MustCompile(`(?i)(PASSWORD|SECRET|TOKEN|KEY|CREDENTIAL|PRIVATE|DSN|DATABASE_URL)`)
+
+// secretPatterns match secrets that can show up in log lines
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)((?:bearer|basic)\s+)[A-Za-z0-9._~+/=-]{8,}`),
+	regexp.MustCompile(`(?i)((?:password|passwd|secret|token|api[_-]?key|sso_session|authorization)["']?\s*[:=]\s*["']?)[^\s"',;&]+`),
+	regexp.MustCompile(`(://[^:/@\s]+:)[^@\s]+(@)`),
+	regexp.MustCompile(`(gh[pousr]_)[A-Za-z0-9]{20,}`),
+}
+
+// redactSecrets replaces the secrets found in text
+func redactSecrets(text string) string {
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			groups := pattern.FindStringSubmatch(match)
+			if len(groups) > 2 {
+				return groups[1] + "[redacted]" + groups[2]
+			}
+			return groups[1] + "[redacted]"
+		})
+	}
+	return text
+}
+
+// redactedEnvironment returns the process environment with sensitive values left out
+func redactedEnvironment() map[string]string {
+	env := make(map[string]string)
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if sensitiveEnvPattern.MatchString(name) {
+			if value != "" {
+				value = "[redacted]"
+			}
+		} else {
+			value = redactSecrets(value)
+		}
+		env[name] = value
+	}
+	return env
+}
+
+// CreateDiagnosticsBundle assembles a zip to attach to bug reports: recent backend logs, health
+// of the components and background tasks, redacted configuration, the dokku version and plugins,
+// reports of failing apps and recent failed deployments. Parts that can't be collected are listed
+// in errors.txt instead of failing the bundle.
+func CreateDiagnosticsBundle(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), diagnosticsTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	var collectErrors []string
+	files := make(map[string]interface{})
+
+	files["health.json"] = fiber.Map{
+		"generated_at": now,
+		"uptime":       time.Since(startTime).String(),
+		"components": map[string]ComponentHealth{
+			"database": checkDatabaseHealth(),
+			"redis":    checkRedisHealth(),
+			"ssh":      checkSSHHealth(),
+		},
+		"metrics":      getSystemMetrics(),
+		"tasks":        scheduler.Default.StatusAll(),
+		"slow_queries": api.SlowQueries(),
+	}
+
+	files["config.json"] = fiber.Map{
+		"go_version":       runtime.Version(),
+		"environment":      redactedEnvironment(),
+		"dashboard_access": utils.GetDashboardAccessConfig(),
+		"git_sources":      utils.GetGitSourceConfig(ctx),
+		"deploy_detection": utils.GetDetectionConfig(ctx),
+	}
+
+	dokku := fiber.Map{}
+	if version, err := utils.GetDokkuVersion(); err != nil {
+		collectErrors = append(collectErrors, "dokku version: "+err.Error())
+	} else {
+		dokku["version"] = version
+	}
+	if plugins, err := utils.ListPlugins(); err != nil {
+		collectErrors = append(collectErrors, "dokku plugins: "+err.Error())
+	} else {
+		dokku["plugins"] = plugins
+	}
+	if capabilities, err := utils.GetCapabilities(false); err != nil {
+		collectErrors = append(collectErrors, "dokku capabilities: "+err.Error())
+	} else {
+		dokku["capabilities"] = capabilities
+	}
+	files["dokku.json"] = dokku
+
+	if apps, err := utils.GetAllAppsInfo(); err != nil {
+		collectErrors = append(collectErrors, "app reports: "+err.Error())
+	} else {
+		failing := make(map[string]map[string]interface{})
+		for appName, info := range apps {
+			deployed, _ := info["deployed"].(bool)
+			running, _ := info["running"].(bool)
+			if _, hasErrors := info["errors"]; hasErrors || (deployed && !running) {
+				failing[appName] = info
+			}
+		}
+		files["failing_apps.json"] = failing
+	}
+
+	if deployments, err := api.Deployments.ListRecentFailedDeployments(ctx, now.Add(-diagnosticsFailedDeploysWindow), maxDiagnosticsFailedDeploys); err != nil {
+		collectErrors = append(collectErrors, "failed deployments: "+err.Error())
+	} else {
+		files["failed_deployments.json"] = deployments
+	}
+
+	if operations, err := api.Operations.ListStuckOperations(ctx, now.Add(-utils.OperationRetryDelay)); err != nil {
+		collectErrors = append(collectErrors, "stuck operations: "+err.Error())
+	} else {
+		files["stuck_operations.json"] = operations
+	}
+
+	bundle, err := writeDiagnosticsBundle(files, utils.RecentLogs.Lines(), collectErrors)
+	auditSystemAction(c, "diagnostics_bundle", "system", map[string]interface{}{
+		"collect_errors": len(collectErrors),
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to create diagnostics bundle: "+err.Error(),
+			nil,
+		))
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="citizen-diagnostics-%s.zip"`, now.Format("20060102-150405")))
+	return c.Send(bundle)
+}
+
+// writeDiagnosticsBundle zips the JSON files, the redacted logs and the collection errors
+func writeDiagnosticsBundle(files map[string]interface{}, logs, collectErrors []string) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := json.MarshalIndent(files[name], "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		if err := writeBundleFile(archive, name, []byte(redactSecrets(string(data)))); err != nil {
+			return nil, err
+		}
+	}
+
+	var logText strings.Builder
+	for _, line := range logs {
+		logText.WriteString(redactSecrets(line))
+		logText.WriteByte('\n')
+	}
+	if err := writeBundleFile(archive, "logs.txt", []byte(logText.String())); err != nil {
+		return nil, err
+	}
+
+	if len(collectErrors) > 0 {
+		if err := writeBundleFile(archive, "errors.txt", []byte(strings.Join(collectErrors, "\n")+"\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeBundleFile(archive *zip.Writer, name string, data []byte) error {
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// digestUserID returns the ID of the signed in user, answering the request itself when there is none
+func digestUserID(c *fiber.Ctx) (int, bool, error) {
+	userID, ok := c.Locals("user_id").(int)
+	if !ok {
+		return 0, false, c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"User not authenticated",
+			nil,
+		))
+	}
+	return userID, true, nil
+}
+
+// GetDigestSubscription returns the digest subscription of the signed in user, null when they
+// aren't subscribed
+func GetDigestSubscription(c *fiber.Ctx) error {
+	userID, ok, err := digestUserID(c)
+	if !ok {
+		return err
+	}
+
+	sub, err := api.Users.GetDigestSubscription(c.Context(), userID)
+	if err != nil && !errors.Is(err, api.ErrDigestSubscriptionNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve digest subscription: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Digest subscription retrieved successfully",
+		fiber.Map{
+			"subscription":    sub,
+			"email_available": utils.SMTPConfigured(),
+		},
+	))
+}
+
+// SetDigestSubscription subscribes the signed in user to a daily or weekly digest of their apps,
+// sent by email and/or to a webhook at a local hour of their time zone. The webhook secret is
+// returned once, when the webhook is set or rotate_secret is true.
+func SetDigestSubscription(c *fiber.Ctx) error {
+	userID, ok, err := digestUserID(c)
+	if !ok {
+		return err
+	}
+
+	req := struct {
+		Frequency    string   `json:"frequency"`
+		Timezone     string   `json:"timezone"`
+		SendHour     *int     `json:"send_hour"`
+		SendWeekday  *int     `json:"send_weekday"`
+		Email        *bool    `json:"email"`
+		WebhookURL   string   `json:"webhook_url"`
+		Apps         []string `json:"apps"`
+		Enabled      *bool    `json:"enabled"`
+		RotateSecret bool     `json:"rotate_secret"`
+	}{Frequency: utils.DigestDaily, Timezone: "UTC"}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	sub := &api.DigestSubscription{
+		UserID:       userID,
+		Frequency:    req.Frequency,
+		Timezone:     req.Timezone,
+		SendHour:     8,
+		SendWeekday:  int(time.Monday),
+		EmailEnabled: req.Email == nil || *req.Email,
+		Apps:         req.Apps,
+		Enabled:      req.Enabled == nil || *req.Enabled,
+	}
+	if req.SendHour != nil {
+		sub.SendHour = *req.SendHour
+	}
+	if req.SendWeekday != nil {
+		sub.SendWeekday = *req.SendWeekday
+	}
+	if req.WebhookURL != "" {
+		sub.WebhookURL = &req.WebhookURL
+	}
+	if err := utils.ValidateDigestSubscription(sub); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	previous, err := api.Users.GetDigestSubscription(c.Context(), userID)
+	if err != nil && !errors.Is(err, api.ErrDigestSubscriptionNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve digest subscription: "+err.Error(),
+			nil,
+		))
+	}
+
+	// Keep the secret while the webhook stays the same, receivers verify deliveries with it
+	var secret string
+	if sub.WebhookURL != nil {
+		if previous != nil && previous.WebhookURL != nil && *previous.WebhookURL == *sub.WebhookURL && !req.RotateSecret {
+			sub.WebhookSecret = previous.WebhookSecret
+		} else {
+			plain, encrypted, err := newWebhookSecret()
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+					false,
+					err.Error(),
+					nil,
+				))
+			}
+			secret, sub.WebhookSecret = plain, &encrypted
+		}
+	}
+
+	// The first digest covers the first full period after the change
+	if _, end, err := utils.DigestPeriod(sub, time.Now()); err == nil {
+		sub.LastPeriodEnd = &end
+	}
+	if err := api.Users.SetDigestSubscription(c.Context(), sub); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save digest subscription: "+err.Error(),
+			nil,
+		))
+	}
+
+	data := fiber.Map{"subscription": sub}
+	if secret != "" {
+		data["webhook_secret"] = secret
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Digest subscription saved",
+		data,
+	))
+}
+
+// DeleteDigestSubscription unsubscribes the signed in user from digests
+func DeleteDigestSubscription(c *fiber.Ctx) error {
+	userID, ok, err := digestUserID(c)
+	if !ok {
+		return err
+	}
+
+	err = api.Users.DeleteDigestSubscription(c.Context(), userID)
+	if errors.Is(err, api.ErrDigestSubscriptionNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"You are not subscribed to digests",
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to delete digest subscription: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Unsubscribed from digests",
+		nil,
+	))
+}
+
+// PreviewDigest builds the digest of the signed in user for the period ending now, without
+// sending it. ?format=text returns it as the email text.
+func PreviewDigest(c *fiber.Ctx) error {
+	userID, ok, err := digestUserID(c)
+	if !ok {
+		return err
+	}
+
+	sub, err := api.Users.GetDigestSubscription(c.Context(), userID)
+	if errors.Is(err, api.ErrDigestSubscriptionNotFound) {
+		sub = &api.DigestSubscription{UserID: userID, Frequency: utils.DigestDaily, Timezone: "UTC"}
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve digest subscription: "+err.Error(),
+			nil,
+		))
+	}
+	if frequency := c.Query("frequency"); frequency == utils.DigestDaily || frequency == utils.DigestWeekly {
+		sub.Frequency = frequency
+	}
+
+	end := time.Now()
+	start := end.AddDate(0, 0, -1)
+	if sub.Frequency == utils.DigestWeekly {
+		start = end.AddDate(0, 0, -7)
+	}
+	digest, err := utils.BuildDigest(c.Context(), sub, start, end)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to build digest: "+err.Error(),
+			nil,
+		))
+	}
+
+	if c.Query("format") == "text" {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.SendString(utils.RenderDigestText(digest))
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Digest preview built successfully",
+		digest,
+	))
+}
@@ -252,6 +252,53 @@ func getDockerUsername() (string, error) {
 	return "", fmt.Errorf("docker not authenticated")
 }
 
+// dockerRegistryAuth returns the encoded credentials stored by a docker login for a registry
+// host, empty when there are none. Docker Hub credentials are stored under several endpoints.
+func dockerRegistryAuth(host string) (string, error) {
+	dockerConfigMutex.Lock()
+	defer dockerConfigMutex.Unlock()
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot get home directory: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(homeDir, ".docker", "config.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("docker config read error: %w", err)
+	}
+
+	var config DockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("docker config invalid: %w", err)
+	}
+
+	endpoints := []string{host, "https://" + host, "https://" + host + "/v1/"}
+	if host == "docker.io" {
+		endpoints = []string{"https://index.docker.io/v1/", "index.docker.io", "docker.io", "registry-1.docker.io"}
+	}
+	for _, endpoint := range endpoints {
+		auth, exists := config.Auths[endpoint]
+		if !exists {
+			continue
+		}
+		authConfig := registry.AuthConfig{Username: auth.Username, Password: auth.Password, ServerAddress: endpoint}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err == nil {
+				if parts := strings.SplitN(string(decoded), ":", 2); len(parts) == 2 {
+					authConfig.Username, authConfig.Password = parts[0], parts[1]
+				}
+			}
+		}
+		return registry.EncodeAuthConfig(authConfig)
+	}
+	return "", nil
+}
+
 // decodeDockerAuth remains the same.
 func decodeDockerAuth(authStr string) (string, error) {
 	decoded, err := base64.StdEncoding.DecodeString(authStr)
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetDockerfilePath returns the Dockerfile path Dockerfile builds of an app use, "" for the
+// Dockerfile at the repository root
+func GetDockerfilePath(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	dockerfilePath, err := utils.GetDockerfilePath(appName)
+	if err != nil {
+		return commandErrorResponse(c, "Failed to read the dockerfile path", err, nil)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Dockerfile path retrieved successfully",
+		fiber.Map{"app_name": appName, "dockerfile_path": dockerfilePath},
+	))
+}
+
+// SetDockerfilePath sets the Dockerfile path of an app, back to the root Dockerfile when empty.
+// The path is checked against the git source of the app, a missing file is reported but kept as
+// the branch deployed next may add it; deploys are refused while it is missing.
+func SetDockerfilePath(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		DockerfilePath string `json:"dockerfile_path"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if err := utils.ValidateDockerfilePath(req.DockerfilePath); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	message := "Reset the dockerfile path to the repository root"
+	if req.DockerfilePath != "" {
+		message = fmt.Sprintf("Set the dockerfile path to %s", req.DockerfilePath)
+	}
+	activity, activityErr := database.LogConfigActivity(appName, "dockerfile_path", message, userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log dockerfile path activity: %v\n", activityErr)
+	}
+
+	if _, err := utils.SetDockerfilePath(appName, req.DockerfilePath); err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+		return commandErrorResponse(c, "Failed to set the dockerfile path", err, nil)
+	}
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	data := fiber.Map{"app_name": appName, "dockerfile_path": req.DockerfilePath}
+	if req.DockerfilePath != "" {
+		if gitURL, branch, err := appGitSource(appName); err == nil {
+			_, err := utils.CheckDockerfilePath(c.UserContext(), appName, gitURL, branch, userID)
+			if errors.Is(err, utils.ErrDockerfileNotFound) {
+				data["warning"] = err.Error()
+			}
+		}
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Dockerfile path updated, it applies from the next build",
+		data,
+	))
+}
+
+// recordDeploymentDockerfile records the Dockerfile path a deployment builds from, nothing when
+// the app builds the root Dockerfile or has no record
+func recordDeploymentDockerfile(record *api.DeploymentRecord, dockerfilePath string) {
+	if record == nil || dockerfilePath == "" {
+		return
+	}
+	if err := api.Deployments.SetDeploymentDockerfilePath(context.Background(), record.ID, dockerfilePath); err != nil {
+		utils.WarnLog("Failed to record the dockerfile path of deployment %d of %s: %v", record.ID, record.AppName, err)
+	}
+}
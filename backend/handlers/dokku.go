@@ -8,7 +8,10 @@ import (
 	"backend/database/api"
 	"backend/models"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -85,21 +88,41 @@ func CreateApp(c *fiber.Ctx) error {
 		))
 	}
 
-	// Create app
-	output, err := utils.CreateApp(strings.ToLower(data.AppName))
+	// Enforce the naming rules and reserved names before dokku sees the name
+	check, err := checkAppName(data.AppName)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
 			false,
-			"An error occurred while creating the app: "+err.Error(),
+			"An error occurred while listing apps: "+err.Error(),
 			nil,
 		))
 	}
+	if !check.Valid {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid app name: "+check.Reason,
+			check,
+		))
+	}
+	if !check.Available {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is already taken",
+			check,
+		))
+	}
+
+	// Create app
+	output, err := utils.CreateApp(check.Name)
+	if err != nil {
+		return commandErrorResponse(c, "An error occurred while creating the app", err, nil)
+	}
 
 	return c.Status(fiber.StatusCreated).JSON(utils.NewCitizenResponse(
 		true,
 		"Application successfully created",
 		fiber.Map{
-			"app_name": strings.ToLower(data.AppName),
+			"app_name": check.Name,
 			"output":   output,
 		},
 	))
@@ -117,20 +140,21 @@ func DestroyApp(c *fiber.Ctx) error {
 		))
 	}
 
-	// Delete app
-	output, err := utils.DestroyApp(appName)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"An error occurred while deleting the app: "+err.Error(),
-			nil,
-		))
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
 	}
 
-	// 💾 Remove ALL app data from database
-	if dbErr := database.DeleteAllAppData(appName); dbErr != nil {
-		fmt.Printf("[DB] ⚠️ Failed to remove all app data: %v\n", dbErr)
+	// Delete app, then ALL its data from database. The deletion can't be undone, so a failed
+	// database cleanup is retried by the operations reconciler.
+	op, err := utils.RunOperation(c.UserContext(), utils.OperationAppDestroy, appName, "", userID)
+	output := utils.OperationStepOutput(op, "dokku_destroy")
+	if err != nil && utils.FailedOperationStep(op) == "dokku_destroy" {
+		return commandErrorResponse(c, "An error occurred while deleting the app", err, nil)
+	}
+	if err != nil {
 		// Don't fail the entire deletion because of DB issues
+		fmt.Printf("[DB] ⚠️ Failed to remove all app data, operation %d will retry: %v\n", op.ID, err)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
@@ -179,11 +203,7 @@ func SetPort(c *fiber.Ctx) error {
 	// Set port
 	output, err := utils.SetPort(appName, data.Port)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"An error occurred while setting the port: "+err.Error(),
-			nil,
-		))
+		return commandErrorResponse(c, "An error occurred while setting the port", err, nil)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
@@ -230,6 +250,14 @@ func AddDomain(c *fiber.Ctx) error {
 		))
 	}
 
+	// Custom domains of other apps can't be added here either
+	if taken, err := customDomainTaken(c, appName, data.Domain); taken {
+		return err
+	}
+	if refused, err := workerAppRefused(c, appName, "adding a domain"); refused {
+		return err
+	}
+
 	// 📝 Log domain add activity start
 	var userID *int
 	if userIDValue := c.Locals("user_id"); userIDValue != nil {
@@ -244,7 +272,8 @@ func AddDomain(c *fiber.Ctx) error {
 	}
 
 	// Add domain
-	output, err := utils.AddDomain(appName, data.Domain)
+	op, err := utils.RunOperation(c.UserContext(), utils.OperationDomainAdd, appName, data.Domain, userID)
+	output := utils.OperationStepOutput(op, "dokku_add")
 	if err != nil {
 		// 📝 Update domain activity as failed
 		if domainActivity != nil {
@@ -252,17 +281,14 @@ func AddDomain(c *fiber.Ctx) error {
 			database.UpdateActivity(domainActivity.ID, database.StatusError, &errorMsg)
 		}
 		
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"An error occurred while adding the domain: "+err.Error(),
-			nil,
-		))
+		return commandErrorResponse(c, "An error occurred while adding the domain", err, nil)
 	}
 
 	// 📝 Update domain activity as successful
 	if domainActivity != nil {
 		database.UpdateActivity(domainActivity.ID, database.StatusSuccess, nil)
 	}
+	utils.EmitAppEvent(appName, utils.EventDomainAdded, fiber.Map{"domain": data.Domain, "custom": false})
 
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
@@ -330,17 +356,14 @@ func RemoveDomain(c *fiber.Ctx) error {
 			database.UpdateActivity(domainActivity.ID, database.StatusError, &errorMsg)
 		}
 		
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"An error occurred while removing the domain: "+err.Error(),
-			nil,
-		))
+		return commandErrorResponse(c, "An error occurred while removing the domain", err, nil)
 	}
 
 	// 📝 Update domain activity as successful
 	if domainActivity != nil {
 		database.UpdateActivity(domainActivity.ID, database.StatusSuccess, nil)
 	}
+	utils.EmitAppEvent(appName, utils.EventDomainRemoved, fiber.Map{"domain": data.Domain, "custom": false})
 
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
@@ -353,6 +376,112 @@ func RemoveDomain(c *fiber.Ctx) error {
 	))
 }
 
+// validBuilders are the builders an app can be switched to
+var validBuilders = []string{"herokuish", "pack", "dockerfile", "nixpacks"}
+
+// detectAndApplyPort detects the app port and builder from the repository config files and, when
+// the port differs from the deployed port, sets both the PORT env var and the port mapping.
+// A builder given in the request overrides the detected one. Each step is recorded in diagnostics.
+func detectAndApplyPort(diagnostics *utils.DeployDiagnostics, appName, gitURL, branch string, userID *int, hint *utils.PortDetectionHint, requestedBuilder string) (*utils.DetectionTrace, string) {
+	var portSetMessage string
+
+	// Get current port from database
+	var currentPort int
+	deployment, err := api.Deployments.GetDeploymentByAppName(context.Background(), appName)
+	if err == nil && deployment.Status == "deployed" {
+		currentPort = deployment.Port
+		diagnostics.Info("port", "current port %d (source: %s)", currentPort, deployment.PortSource)
+	} else {
+		diagnostics.Info("port", "no deployed port recorded, will set it if detected")
+	}
+
+	// Try to detect port from config files in the configured order (WITH GITHUB TOKEN)
+	trace := utils.DetectDeployConfig(gitURL, branch, userID, hint)
+	diagnostics.SetDetection(trace)
+	applyDetectedBuilder(appName, requestedBuilder, trace)
+
+	// Worker-only apps serve no HTTP, a detected port is neither mapped nor recorded
+	if utils.IsWorkerApp(context.Background(), appName) {
+		if trace.Port != nil {
+			trace.Notes = append(trace.Notes, fmt.Sprintf("port %d from %s ignored, the app is worker-only", trace.Port.Port, trace.Port.Source))
+			trace.Port = nil
+		}
+		diagnostics.Info("port", "worker-only app, skipping port configuration")
+		return trace, "ℹ️ Worker-only app, port configuration skipped"
+	}
+
+	if configPort, err := trace.Port, trace.Err(); err == nil {
+		diagnostics.Info("port", "detected port %d from %s", configPort.Port, configPort.Source)
+
+		// Check if port changed
+		if currentPort != 0 && currentPort == configPort.Port {
+			portSetMessage = fmt.Sprintf("✅ Port %d unchanged from %s (skipping re-config)", configPort.Port, configPort.Source)
+			diagnostics.Info("port", "port %d unchanged, skipping re-configuration", configPort.Port)
+		} else {
+			diagnostics.Info("port", "port changed from %d to %d, updating configuration", currentPort, configPort.Port)
+
+			// 1. Set PORT environment variable so app runs on detected port
+			portEnv := map[string]string{
+				"PORT": fmt.Sprintf("%d", configPort.Port),
+			}
+			if _, envErr := utils.SetEnv(appName, portEnv); envErr != nil {
+				diagnostics.Warn("port", "failed to set PORT environment variable: %v", envErr)
+			} else {
+				diagnostics.Info("port", "PORT environment variable set to %d", configPort.Port)
+			}
+
+			// 2. Set port mapping so nginx routes to correct port
+			if _, portErr := utils.SetPort(appName, fmt.Sprintf("%d", configPort.Port)); portErr == nil {
+				portSetMessage = fmt.Sprintf("✅ Port %d auto-configured from %s (both env & mapping)", configPort.Port, configPort.Source)
+				diagnostics.Info("port", "port mapping set to %d", configPort.Port)
+			} else {
+				portSetMessage = fmt.Sprintf("⚠️ Port %d detected from %s, env set but mapping failed: %v", configPort.Port, configPort.Source, portErr)
+				diagnostics.Warn("port", "failed to set port mapping to %d: %v", configPort.Port, portErr)
+			}
+		}
+	} else {
+		portSetMessage = "ℹ️ No port configuration found in config files, using existing/default port mapping"
+		diagnostics.Info("port", "no port detected, keeping the existing mapping: %v", err)
+	}
+
+	return trace, portSetMessage
+}
+
+// applyDetectedBuilder selects the requested builder, or the detected one, when it differs from
+// the app's current builder. The outcome is noted in the trace.
+func applyDetectedBuilder(appName, requestedBuilder string, trace *utils.DetectionTrace) {
+	builder, source := trace.Builder, trace.BuilderSource
+	if requestedBuilder != "" {
+		builder, source = requestedBuilder, "request"
+	}
+	if builder == "" {
+		return
+	}
+	trace.Builder, trace.BuilderSource = builder, source
+
+	valid := false
+	for _, candidate := range validBuilders {
+		valid = valid || candidate == builder
+	}
+	if !valid {
+		trace.Notes = append(trace.Notes, fmt.Sprintf("builder %q from %s is not supported, keeping the current builder", builder, source))
+		return
+	}
+	if utils.RequireCapability(utils.FeatureBuilder) != nil {
+		trace.Notes = append(trace.Notes, "host does not support builder:set, keeping the current builder")
+		return
+	}
+
+	if report, err := utils.GetBuilderReport(appName); err == nil && report["Builder selected"] == builder {
+		return
+	}
+	if _, err := utils.SetBuilder(appName, builder); err != nil {
+		trace.Notes = append(trace.Notes, fmt.Sprintf("failed to select builder %s: %v", builder, err))
+		return
+	}
+	trace.Notes = append(trace.Notes, fmt.Sprintf("selected builder %s from %s", builder, source))
+}
+
 // DeployApp deploys an app from a git repository
 func DeployApp(c *fiber.Ctx) error {
 	appName := c.Params("app_name")
@@ -364,11 +493,18 @@ func DeployApp(c *fiber.Ctx) error {
 		))
 	}
 
+	if missing, err := capabilityMissing(c, utils.FeatureGitSync); missing {
+		return err
+	}
+
 	var deployData struct {
 		GitURL    string `json:"git_url"`
 		GitBranch string `json:"git_branch"`
+		GitCommit string `json:"git_commit"` // pins the deploy to this commit of the branch
 		Builder   string `json:"builder"`
 		Buildpack string `json:"buildpack"`
+		// ReleaseName optionally names the release, it is numbered either way
+		ReleaseName string `json:"release_name"`
 	}
 
 	if err := c.BodyParser(&deployData); err != nil {
@@ -387,15 +523,49 @@ func DeployApp(c *fiber.Ctx) error {
 		))
 	}
 
+	deployData.GitCommit = strings.ToLower(strings.TrimSpace(deployData.GitCommit))
+	if deployData.GitCommit != "" && !utils.IsCommitSHA(deployData.GitCommit) {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Git commit must be a commit SHA of 7 to 40 hex characters",
+			nil,
+		))
+	}
+
+	deployData.ReleaseName = strings.TrimSpace(deployData.ReleaseName)
+	if err := validateReleaseName(deployData.ReleaseName); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	if deployData.ReleaseName != "" {
+		if _, err := api.Deployments.FindRelease(c.UserContext(), appName, deployData.ReleaseName); err == nil {
+			return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+				false,
+				fmt.Sprintf("Another release of %s is already named %s", appName, deployData.ReleaseName),
+				nil,
+			))
+		}
+	}
+
+	recordAppInteraction(c, appName, api.InteractionDeploy)
+
 	// 🔑 Get user ID for GitHub authentication
 	var userID *int
 	if userIDValue := c.Locals("user_id"); userIDValue != nil {
 		if uid, ok := userIDValue.(int); ok {
 			userID = &uid
-			fmt.Printf("[DEPLOY] 🔑 User authenticated: %d\n", uid)
 		}
 	}
 
+	if err := database.CheckBuildQuota(c.UserContext(), appName, userID); err != nil {
+		return buildQuotaResponse(c, err)
+	}
+
+	diagnostics := utils.NewDeployDiagnostics()
+
 	// Branch priority: 1. Frontend request, 2. Database connected repo, 3. Default "main"
 	if deployData.GitBranch == "" {
 		// If no branch provided in request, check database for connected repository
@@ -403,111 +573,62 @@ func DeployApp(c *fiber.Ctx) error {
 		if err == nil && deployBranch != "" {
 			// Use the deploy branch from connected repository
 			deployData.GitBranch = deployBranch
-			fmt.Printf("[DEPLOY] Using deploy branch from connected repository: %s\n", deployBranch)
+			diagnostics.Info("git", "using deploy branch %s of the connected repository", deployBranch)
 		} else {
 			// Final fallback to default
 			deployData.GitBranch = "main"
-			fmt.Printf("[DEPLOY] Using default branch: main\n")
+			diagnostics.Info("git", "no branch given, using main")
 		}
 	} else {
-		fmt.Printf("[DEPLOY] Using branch from request: %s\n", deployData.GitBranch)
+		diagnostics.Info("git", "using branch %s from the request", deployData.GitBranch)
 	}
 
-	// 🔧 AUTO-DETECT AND SET PORT BEFORE DEPLOY (WITH GITHUB TOKEN SUPPORT)
-	var portInfo *utils.ConfigPort
-	var portSetMessage string
-	
-	// Log port detection start
-	fmt.Printf("[PORT DETECTION] ==================== STARTING PORT DETECTION ====================\n")
-	fmt.Printf("[PORT DETECTION] Repository: %s\n", deployData.GitURL)
-	fmt.Printf("[PORT DETECTION] Branch: %s\n", deployData.GitBranch)
-	fmt.Printf("[PORT DETECTION] App Name: %s\n", appName)
-	fmt.Printf("[PORT DETECTION] User ID: %v\n", userID)
-	
-	// Get current port from database
-	var currentPort int
-	var currentPortSource string
-	
-	deployment, err := api.Deployments.GetDeploymentByAppName(context.Background(), appName)
-	if err == nil && deployment.Status == "deployed" {
-		currentPort = deployment.Port
-		currentPortSource = deployment.PortSource
-		fmt.Printf("[PORT DETECTION] 📊 Current port in database: %d (source: %s)\n", currentPort, currentPortSource)
-	} else {
-		fmt.Printf("[PORT DETECTION] 📊 No current port in database, will set if detected\n")
-	}
-	
-	// Try to detect port from config files (WITH GITHUB TOKEN)
-	if configPort, err := utils.DetectPortFromGitRepo(deployData.GitURL, deployData.GitBranch, userID); err == nil {
-		portInfo = configPort
-		fmt.Printf("[PORT DETECTION] ✅ Port detected: %d from %s\n", configPort.Port, configPort.Source)
-		
-		// Check if port changed
-		if currentPort != 0 && currentPort == configPort.Port {
-			portSetMessage = fmt.Sprintf("✅ Port %d unchanged from %s (skipping re-config)", configPort.Port, configPort.Source)
-			fmt.Printf("[PORT DETECTION] ↻ Port %d unchanged, skipping re-configuration\n", configPort.Port)
-		} else {
-			fmt.Printf("[PORT DETECTION] 🔄 Port changed from %d to %d, updating configuration\n", currentPort, configPort.Port)
-			
-			// 1. Set PORT environment variable so app runs on detected port
-			portEnv := map[string]string{
-				"PORT": fmt.Sprintf("%d", configPort.Port),
-			}
-			if _, envErr := utils.SetEnv(appName, portEnv); envErr != nil {
-				fmt.Printf("[PORT DETECTION] ⚠️ Failed to set PORT environment variable: %v\n", envErr)
-			} else {
-				fmt.Printf("[PORT DETECTION] ✅ PORT environment variable set to %d\n", configPort.Port)
-			}
-			
-			// 2. Set port mapping so nginx routes to correct port
-			if _, portErr := utils.SetPort(appName, fmt.Sprintf("%d", configPort.Port)); portErr == nil {
-				portSetMessage = fmt.Sprintf("✅ Port %d auto-configured from %s (both env & mapping)", configPort.Port, configPort.Source)
-				fmt.Printf("[PORT DETECTION] ✅ Port %d successfully set in Citizen (mapping)\n", configPort.Port)
-			} else {
-				portSetMessage = fmt.Sprintf("⚠️ Port %d detected from %s, env set but mapping failed: %v", configPort.Port, configPort.Source, portErr)
-				fmt.Printf("[PORT DETECTION] ❌ Failed to set port %d mapping in Citizen: %v\n", configPort.Port, portErr)
-			}
+	// Repositories outside GitHub are checked before anything is built
+	sourceCheck, err := utils.ValidateGitSource(c.UserContext(), deployData.GitURL, deployData.GitBranch)
+	if err != nil {
+		status := fiber.StatusUnprocessableEntity
+		if errors.Is(err, utils.ErrGitSourceRejected) {
+			status = fiber.StatusBadRequest
 		}
-	} else {
-		fmt.Printf("[PORT DETECTION] ⚠️ Config file detection failed: %v\n", err)
-		
-		// Try to extract port from package.json as fallback (WITH GITHUB TOKEN)
-		if pkgPort, pkgErr := utils.ExtractPortFromPackageJson(deployData.GitURL, deployData.GitBranch, userID); pkgErr == nil {
-			portInfo = pkgPort
-			fmt.Printf("[PORT DETECTION] ✅ Port detected from package.json: %d from %s\n", pkgPort.Port, pkgPort.Source)
-			
-			// Check if port changed
-			if currentPort != 0 && currentPort == pkgPort.Port {
-				portSetMessage = fmt.Sprintf("✅ Port %d unchanged from %s (skipping re-config)", pkgPort.Port, pkgPort.Source)
-				fmt.Printf("[PORT DETECTION] ↻ Port %d unchanged, skipping re-configuration\n", pkgPort.Port)
-			} else {
-				fmt.Printf("[PORT DETECTION] 🔄 Port changed from %d to %d, updating configuration\n", currentPort, pkgPort.Port)
-				
-				// 1. Set PORT environment variable so app runs on detected port
-				portEnv := map[string]string{
-					"PORT": fmt.Sprintf("%d", pkgPort.Port),
-				}
-				if _, envErr := utils.SetEnv(appName, portEnv); envErr != nil {
-					fmt.Printf("[PORT DETECTION] ⚠️ Failed to set PORT environment variable: %v\n", envErr)
-				} else {
-					fmt.Printf("[PORT DETECTION] ✅ PORT environment variable set to %d\n", pkgPort.Port)
-				}
-				
-				// 2. Set port mapping so nginx routes to correct port
-				if _, portErr := utils.SetPort(appName, fmt.Sprintf("%d", pkgPort.Port)); portErr == nil {
-					portSetMessage = fmt.Sprintf("✅ Port %d auto-configured from %s (both env & mapping)", pkgPort.Port, pkgPort.Source)
-					fmt.Printf("[PORT DETECTION] ✅ Port %d successfully set in Citizen (mapping)\n", pkgPort.Port)
-				} else {
-					portSetMessage = fmt.Sprintf("⚠️ Port %d detected from %s, env set but mapping failed: %v", pkgPort.Port, pkgPort.Source, portErr)
-					fmt.Printf("[PORT DETECTION] ❌ Failed to set port %d mapping in Citizen: %v\n", pkgPort.Port, portErr)
-				}
-			}
-		} else {
-			portSetMessage = "ℹ️ No port configuration found in config files, using existing/default port mapping"
-			fmt.Printf("[PORT DETECTION] ℹ️ No port found in any config file, using existing/default\n")
+		return c.Status(status).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			fiber.Map{"git_source": sourceCheck},
+		))
+	}
+	if sourceCheck != nil {
+		diagnostics.Info("git", "repository on %s is reachable", sourceCheck.Host)
+		if !sourceCheck.BranchVerified {
+			diagnostics.Warn("git", "%s looks like a commit, it can't be checked before the build", deployData.GitBranch)
 		}
 	}
 
+	// A pinned commit is built instead of the head of the branch
+	deployRef := deployData.GitBranch
+	var portHint *utils.PortDetectionHint
+	if deployData.GitCommit != "" {
+		deployRef = deployData.GitCommit
+		portHint = &utils.PortDetectionHint{CommitSHA: deployData.GitCommit}
+		diagnostics.Info("git", "pinned to commit %s", deployData.GitCommit)
+	}
+
+	// A Dockerfile path set for the app must exist at the ref being deployed
+	dockerfilePath, err := utils.CheckDockerfilePath(c.UserContext(), appName, deployData.GitURL, deployRef, userID)
+	if errors.Is(err, utils.ErrDockerfileNotFound) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			fiber.Map{"dockerfile_path": dockerfilePath},
+		))
+	}
+	if err != nil {
+		diagnostics.Warn("dockerfile", "could not read the dockerfile path: %v", err)
+	}
+
+	// 🔧 AUTO-DETECT AND SET PORT BEFORE DEPLOY (WITH GITHUB TOKEN SUPPORT)
+	detection, portSetMessage := detectAndApplyPort(diagnostics, appName, deployData.GitURL, deployData.GitBranch, userID, portHint, deployData.Builder)
+	portInfo := detection.Port
+
 	// 📝 Log deployment activity start
 	var activityUserID *int
 	if userIDValue := c.Locals("user_id"); userIDValue != nil {
@@ -516,30 +637,60 @@ func DeployApp(c *fiber.Ctx) error {
 		}
 	}
 	
-	deployActivity, activityErr := database.LogDeployActivity(appName, deployData.GitURL, deployData.GitBranch, "", "", activityUserID, database.TriggerManual)
+	deployActivity, activityErr := database.LogDeployActivity(appName, deployData.GitURL, deployData.GitBranch, deployData.GitCommit, "", activityUserID, database.TriggerManual)
 	if activityErr != nil {
 		fmt.Printf("[ACTIVITY] ⚠️ Failed to log deploy activity: %v\n", activityErr)
 	}
 
+	// 📝 Record this deploy attempt so its logs are kept alongside previous ones
+	deployRecord, recordErr := database.StartDeploymentRecord(appName, deployData.GitURL, deployData.GitBranch, deployData.GitCommit, "", deployActivity, activityUserID, database.TriggerManual)
+	if recordErr != nil {
+		fmt.Printf("[DEPLOY] ⚠️ Failed to record deployment: %v\n", recordErr)
+	}
+	recordDeploymentDockerfile(deployRecord, dockerfilePath)
+	if deployRecord != nil {
+		if deployData.ReleaseName != "" {
+			if err := database.NameRelease(deployRecord, deployData.ReleaseName); err != nil {
+				diagnostics.Warn("release", "failed to name the release %s: %v", deployData.ReleaseName, err)
+			}
+		}
+		diagnostics.Info("release", "deploying release %s", deployRecord.ReleaseLabel())
+	}
+
 	// 🚀 Deploy from git repository with specific branch (WITH GITHUB TOKEN)
-	output, err := utils.DeployFromGit(appName, deployData.GitURL, deployData.GitBranch, userID)
+	deployCtx, finishDeploy, err := deploymentContext(deployRecord, appName)
+	var output string
+	if err == nil {
+		output, err = utils.DeployFromGitContext(utils.WithDiagnostics(deployCtx, diagnostics), appName, deployData.GitURL, deployData.GitBranch, deployData.GitCommit, userID)
+		finishDeploy()
+	}
 	if err != nil {
 		// 📝 Update deployment activity as failed
 		if deployActivity != nil {
 			errorMsg := err.Error()
-			database.UpdateActivity(deployActivity.ID, database.StatusError, &errorMsg)
+			database.UpdateActivity(deployActivity.ID, deploymentFailureStatus(err), &errorMsg)
 		}
 		
 		// Deploy failed - include both error and any available output
-		errorMessage := "Failed to deploy app: " + err.Error()
 		
 		// Try to get build logs for failed deploys
 		buildLogs, _ := utils.GetBuildLogs(appName)
 		
+		if deployRecord != nil {
+			database.FinishDeploymentRecord(deployRecord.ID, deploymentFailureStatus(err), combineDeployLogs(output, buildLogs), err, diagnostics)
+			emitDeploymentEvent(deployRecord, err)
+		}
+		
 		responseData := fiber.Map{
 			"output": output,
 			"error_details": err.Error(),
 		}
+		if deployRecord != nil {
+			responseData["deployment_id"] = deployRecord.ID
+			responseData["release_number"] = deployRecord.ReleaseNumber
+			responseData["release"] = deployRecord.ReleaseLabel()
+			responseData["diagnostics_url"] = deploymentDiagnosticsURL(appName, deployRecord.ID)
+		}
 		
 		// Add build logs if available
 		if buildLogs != "" {
@@ -554,18 +705,22 @@ func DeployApp(c *fiber.Ctx) error {
 				"message":       portSetMessage,
 			}
 		}
+		responseData["detection"] = detection
 		
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			errorMessage,
-			responseData,
-		))
+		return commandErrorResponse(c, "Failed to deploy app", err, responseData)
 	}
 
 	// 📝 Update deployment activity as successful
 	if deployActivity != nil {
 		database.UpdateActivity(deployActivity.ID, database.StatusSuccess, nil)
 	}
+	if deployRecord != nil {
+		recordDeploymentImage(diagnostics, appName, deployRecord.ID)
+		database.FinishDeploymentRecord(deployRecord.ID, database.StatusSuccess, output, nil, diagnostics)
+		emitDeploymentEvent(deployRecord, nil)
+		recordDeploymentBuilder(appName, deployRecord.ID)
+	}
+	clearPendingRestart(appName)
 
 	// 💾 Save deployment info to database
 	newDeployment := &models.AppDeployment{
@@ -575,6 +730,10 @@ func DeployApp(c *fiber.Ctx) error {
 		Status:     "deployed",
 		LastDeploy: time.Now(),
 	}
+	// Record the revision dokku deployed, integrity checks compare it with later reports
+	if sha, err := utils.DeployedRevision(appName); err == nil {
+		newDeployment.GitCommit = sha
+	}
 	
 	// Add port info if detected
 	if portInfo != nil {
@@ -602,9 +761,16 @@ func DeployApp(c *fiber.Ctx) error {
 		"app_name": appName,
 		"git_url":  deployData.GitURL,
 		"branch":   deployData.GitBranch,
+		"commit":   deployData.GitCommit,
 		"output":   output,
 		"port_detection_message": portSetMessage,
 	}
+	if deployRecord != nil {
+		responseData["deployment_id"] = deployRecord.ID
+		responseData["release_number"] = deployRecord.ReleaseNumber
+		responseData["release"] = deployRecord.ReleaseLabel()
+		responseData["diagnostics_url"] = deploymentDiagnosticsURL(appName, deployRecord.ID)
+	}
 	
 	if portInfo != nil {
 		responseData["port_detection"] = fiber.Map{
@@ -613,11 +779,226 @@ func DeployApp(c *fiber.Ctx) error {
 			"message":       portSetMessage,
 		}
 	}
+	responseData["detection"] = detection
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"App deployment started successfully",
+		responseData,
+	))
+}
+
+// deploymentContext waits for the deploys of the app queued before this one, then bounds the
+// deploy by the max build duration and, when it was recorded, registers it under the deployment
+// ID so it can be cancelled. The activity of the deployment goes through the queued and running
+// states. The returned func must be called when the deploy ends, unless an error is returned.
+func deploymentContext(record *api.DeploymentRecord, appName string) (context.Context, func(), error) {
+	deploymentID := 0
+	var activityID *int
+	if record != nil {
+		deploymentID = record.ID
+		activityID = record.ActivityID
+	}
+	setActivityStatus := func(status database.ActivityStatus) {
+		if activityID == nil {
+			return
+		}
+		if err := database.SetActivityStatus(*activityID, status); err != nil {
+			fmt.Printf("[ACTIVITY] ⚠️ Failed to mark deploy activity %s: %v\n", status, err)
+		}
+	}
+
+	turn, err := database.WaitDeployTurn(context.Background(), appName, deploymentID, func(ahead int) {
+		setActivityStatus(database.StatusQueued)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	setActivityStatus(database.StatusRunning)
+
+	var ctx context.Context
+	var finish func()
+	// The deploy stops when its turn loses the deploy lock
+	if record == nil {
+		ctx, finish = context.WithTimeout(turn.Context(), utils.GetMaxBuildDuration())
+	} else {
+		ctx, finish = utils.StartDeploymentContext(turn.Context(), record.ID, appName)
+	}
+	return ctx, func() {
+		finish()
+		turn.Release()
+	}, nil
+}
+
+// runTrackedDeployment deploys ref from git as a recorded, cancellable deployment and completes
+// the given activity and deployment record with the outcome. tag is set when ref is a pushed tag,
+// diagnostics may be nil.
+func runTrackedDeployment(diagnostics *utils.DeployDiagnostics, appName, gitURL, ref, commit, tag string, activity *database.Activity, userID *int, triggerType database.TriggerType) (*api.DeploymentRecord, string, error) {
+	if diagnostics == nil {
+		diagnostics = utils.NewDeployDiagnostics()
+	}
+
+	// Deployments over a build quota are refused before anything is recorded or built
+	if err := database.CheckBuildQuota(context.Background(), appName, userID); err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+		return nil, "", err
+	}
+
+	record, recordErr := database.StartDeploymentRecord(appName, gitURL, ref, commit, tag, activity, userID, triggerType)
+	if recordErr != nil {
+		fmt.Printf("[DEPLOY] ⚠️ Failed to record deployment: %v\n", recordErr)
+	}
+
+	output, err := runRecordedDeployment(diagnostics, record, appName, gitURL, ref, activity, userID)
+	return record, output, err
+}
+
+// runRecordedDeployment deploys ref from git under a deployment record (nil when it couldn't be
+// created) and completes the activity and record with the outcome. userID authenticates git.
+func runRecordedDeployment(diagnostics *utils.DeployDiagnostics, record *api.DeploymentRecord, appName, gitURL, ref string, activity *database.Activity, userID *int) (string, error) {
+	if record != nil {
+		diagnostics.Info("release", "deploying release %s", record.ReleaseLabel())
+	}
+	deployCtx, finishDeploy, err := deploymentContext(record, appName)
+	var output string
+	if err == nil {
+		var dockerfilePath string
+		dockerfilePath, err = utils.CheckDockerfilePath(utils.WithDiagnostics(deployCtx, diagnostics), appName, gitURL, ref, userID)
+		if err != nil && !errors.Is(err, utils.ErrDockerfileNotFound) {
+			diagnostics.Warn("dockerfile", "could not read the dockerfile path: %v", err)
+			err = nil
+		}
+		if err == nil {
+			recordDeploymentDockerfile(record, dockerfilePath)
+			output, err = utils.DeployFromGitContext(utils.WithDiagnostics(deployCtx, diagnostics), appName, gitURL, ref, "", userID)
+		}
+		finishDeploy()
+	}
+
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, deploymentFailureStatus(err), &errorMsg)
+		}
+		if record != nil {
+			buildLogs, _ := utils.GetBuildLogs(appName)
+			database.FinishDeploymentRecord(record.ID, deploymentFailureStatus(err), combineDeployLogs(output, buildLogs), err, diagnostics)
+			emitDeploymentEvent(record, err)
+		}
+		return output, err
+	}
+
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+	if record != nil {
+		recordDeploymentImage(diagnostics, appName, record.ID)
+		database.FinishDeploymentRecord(record.ID, database.StatusSuccess, output, nil, diagnostics)
+		emitDeploymentEvent(record, nil)
+		recordDeploymentBuilder(appName, record.ID)
+	}
+	clearPendingRestart(appName)
+	return output, nil
+}
+
+// combineDeployLogs joins the deploy command output with the build logs fetched afterwards
+func combineDeployLogs(output, buildLogs string) string {
+	if strings.TrimSpace(buildLogs) == "" {
+		return output
+	}
+	return "=== Deploy Command Output ===\n" + output + "\n\n=== Build Process Logs ===\n" + buildLogs
+}
+
+// deploymentFailureStatus maps a deploy error to the activity status to record
+func deploymentFailureStatus(err error) database.ActivityStatus {
+	if errors.Is(err, utils.ErrDeploymentCancelled) {
+		return database.StatusCancelled
+	}
+	return database.StatusError
+}
+
+// ListRunningDeployments returns the deployments of an app that are still building
+func ListRunningDeployments(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	type runningDeployment struct {
+		utils.RunningDeployment
+		StreamURL string `json:"stream_url"`
+	}
+	deployments := []runningDeployment{}
+	for _, deployment := range utils.ListRunningDeployments(appName) {
+		deployments = append(deployments, runningDeployment{deployment, deploymentStreamURL(appName, deployment.ID)})
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Running deployments fetched successfully",
+		fiber.Map{
+			"deployments":        deployments,
+			"total":              len(deployments),
+			"max_build_duration": utils.GetMaxBuildDuration().String(),
+		},
+	))
+}
+
+// CancelDeployment aborts a running deployment and kills its remote build, or removes a queued
+// deployment from the deploy queue
+func CancelDeployment(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	// Served under both /deployments/:id/cancel and /deploys/:deploy_id/cancel
+	deploymentID, err := strconv.Atoi(c.Params("id", c.Params("deploy_id")))
+	if err != nil || deploymentID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid deployment ID",
+			nil,
+		))
+	}
+
+	// Deployments still waiting for their turn are taken out of the queue, the ones of other
+	// instances are cancelled through the shared queue
+	err = utils.CancelDeployment(appName, deploymentID)
+	if errors.Is(err, utils.ErrDeploymentNotFound) && database.CancelQueuedDeployment(appName, deploymentID) == nil {
+		err = nil
+	}
+	if errors.Is(err, utils.ErrDeploymentNotFound) && database.RequestDeployCancel(c.Context(), appName, deploymentID) == nil {
+		err = nil
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
 
-	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+	fmt.Printf("[DEPLOY] 🛑 Deployment %d of %s cancelled by user %v\n", deploymentID, appName, c.Locals("user_id"))
+
+	return c.Status(fiber.StatusAccepted).JSON(utils.NewCitizenResponse(
 		true,
-		"App deployment started successfully",
-		responseData,
+		"Deployment cancellation requested",
+		fiber.Map{
+			"app_name":      appName,
+			"deployment_id": deploymentID,
+		},
 	))
 }
 
@@ -635,7 +1016,8 @@ func SetEnv(c *fiber.Ctx) error {
 
 	// Parse request body
 	var data struct {
-		EnvVars map[string]string `json:"env_vars"`
+		EnvVars   map[string]string `json:"env_vars"`
+		NoRestart bool              `json:"no_restart"` // save now, apply with the next restart
 	}
 	if err := c.BodyParser(&data); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
@@ -663,6 +1045,17 @@ func SetEnv(c *fiber.Ctx) error {
 		))
 	}
 
+	// Protected keys can only be changed by admins
+	keys := make([]string, 0, len(data.EnvVars))
+	for key := range data.EnvVars {
+		keys = append(keys, key)
+	}
+	if blocked, err := protectedEnvChange(c, appName, keys); blocked {
+		return err
+	}
+
+	recordAppInteraction(c, appName, api.InteractionEnv)
+
 	// 📝 Log env activities for each variable
 	var userID *int
 	if userIDValue := c.Locals("user_id"); userIDValue != nil {
@@ -671,49 +1064,85 @@ func SetEnv(c *fiber.Ctx) error {
 		}
 	}
 	
-	var envActivities []*database.Activity
+	envActivities := make(map[string]*database.Activity)
 	for key := range data.EnvVars {
 		envActivity, activityErr := database.LogEnvActivity(appName, key, "set", userID)
 		if activityErr != nil {
 			fmt.Printf("[ACTIVITY] ⚠️ Failed to log env activity for %s: %v\n", key, activityErr)
 		} else {
-			envActivities = append(envActivities, envActivity)
+			envActivities[key] = envActivity
 		}
 	}
 
-	// Set environment variables
-	output, err := utils.SetEnv(appName, data.EnvVars)
-	if err != nil {
-		// 📝 Update env activities as failed
+	// Set environment variables, verify them and restart once unless asked not to
+	noRestart := data.NoRestart || c.QueryBool("no_restart")
+	result, err := utils.SetEnvVerified(appName, data.EnvVars, !noRestart)
+	if err != nil && result == nil {
 		for _, activity := range envActivities {
 			if activity != nil {
 				errorMsg := err.Error()
 				database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
 			}
 		}
-		
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"An error occurred while setting environment variables: "+err.Error(),
-			nil,
-		))
+
+		return commandErrorResponse(c, "An error occurred while setting environment variables", err, nil)
 	}
 
-	// 📝 Update env activities as successful
-	for _, activity := range envActivities {
-		if activity != nil {
+	trackEnvRestart(appName, result, userID)
+
+	// 📝 Complete each env activity with the verified outcome of its key
+	for _, keyResult := range result.Keys {
+		activity := envActivities[keyResult.Key]
+		if activity == nil {
+			continue
+		}
+		switch keyResult.Status {
+		case utils.EnvKeyApplied:
 			database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+		case utils.EnvKeyUnverified:
+			errorMsg := keyResult.Error
+			database.UpdateActivity(activity.ID, database.StatusWarning, &errorMsg)
+		default:
+			errorMsg := keyResult.Error
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
 		}
 	}
 
+	responseData := fiber.Map{
+		"app_name":        appName,
+		"env_vars":        data.EnvVars,
+		"keys":            result.Keys,
+		"applied":         result.Applied,
+		"failed":          result.Failed,
+		"restarted":       result.Restarted,
+		"restart_pending": result.RestartPending,
+		"output":          result.Output,
+	}
+	if result.RestartError != "" {
+		responseData["restart_error"] = result.RestartError
+	}
+
+	switch {
+	case err != nil:
+		return commandErrorResponse(c, "An error occurred while setting environment variables", err, responseData)
+	case result.Failed > 0:
+		return c.Status(fiber.StatusMultiStatus).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("%d of %d environment variables were not applied", result.Failed, len(result.Keys)),
+			responseData,
+		))
+	case result.RestartError != "":
+		return c.Status(fiber.StatusMultiStatus).JSON(utils.NewCitizenResponse(
+			false,
+			"Environment variables set but the app could not be restarted: "+result.RestartError,
+			responseData,
+		))
+	}
+
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
 		"Environment variables set successfully",
-		fiber.Map{
-			"app_name": appName,
-			"env_vars": data.EnvVars,
-			"output":   output,
-		},
+		responseData,
 	))
 }
 
@@ -729,6 +1158,20 @@ func GetAppInfo(c *fiber.Ctx) error {
 		))
 	}
 
+	// Environment changes saved without a restart, nil when the app runs its current config
+	pending, err := api.Apps.GetPendingRestart(context.Background(), appName)
+	if err != nil {
+		utils.WarnLog("Failed to get pending restart of %s: %v", appName, err)
+	}
+	info["restart_pending"] = pending
+
+	// Scaling changes suggested by the recent usage, applied with the recommendations endpoint
+	recommendations, err := utils.GetScalingRecommendations(context.Background(), appName)
+	if err != nil {
+		utils.WarnLog("Failed to get scaling recommendations of %s: %v", appName, err)
+	}
+	info["recommendations"] = recommendations
+
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
 		"App information retrieved successfully",
@@ -770,17 +1213,14 @@ func RestartApp(c *fiber.Ctx) error {
 			database.UpdateActivity(restartActivity.ID, database.StatusError, &errorMsg)
 		}
 		
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"An error occurred while restarting the app: "+err.Error(),
-			nil,
-		))
+		return commandErrorResponse(c, "An error occurred while restarting the app", err, nil)
 	}
 
 	// 📝 Update restart activity as successful
 	if restartActivity != nil {
 		database.UpdateActivity(restartActivity.ID, database.StatusSuccess, nil)
 	}
+	clearPendingRestart(appName)
 
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
@@ -794,7 +1234,18 @@ func RestartApp(c *fiber.Ctx) error {
 
 // BUILDPACK MANAGEMENT HANDLERS
 
-// ListBuildpacks lists the buildpacks of an app
+// setReportCacheHeaders tells whether a report was served from cache and how old it is, a
+// negative age is a fresh report
+func setReportCacheHeaders(c *fiber.Ctx, age time.Duration) {
+	if age < 0 {
+		c.Set("X-Cache", "MISS")
+		return
+	}
+	c.Set("X-Cache", "HIT")
+	c.Set(fiber.HeaderAge, strconv.Itoa(int(age.Seconds())))
+}
+
+// ListBuildpacks lists the buildpacks of an app, cached briefly; refresh=true reads them from dokku
 func ListBuildpacks(c *fiber.Ctx) error {
 	appName := c.Params("app_name")
 	if appName == "" {
@@ -805,7 +1256,9 @@ func ListBuildpacks(c *fiber.Ctx) error {
 		))
 	}
 
-	buildpacks, err := utils.ListBuildpacks(appName)
+	buildpacks, age, err := utils.CachedReport(utils.ReportBuildpacksList, appName, c.QueryBool("refresh"), func() ([]string, error) {
+		return utils.ListBuildpacks(appName)
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
 			false,
@@ -814,6 +1267,7 @@ func ListBuildpacks(c *fiber.Ctx) error {
 		))
 	}
 
+	setReportCacheHeaders(c, age)
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
 		"Buildpacks listed successfully",
@@ -832,6 +1286,10 @@ func AddBuildpack(c *fiber.Ctx) error {
 		))
 	}
 
+	if missing, err := capabilityMissing(c, utils.FeatureBuildpacks); missing {
+		return err
+	}
+
 	var data struct {
 		BuildpackURL string `json:"buildpack_url"`
 	}
@@ -853,11 +1311,7 @@ func AddBuildpack(c *fiber.Ctx) error {
 
 	output, err := utils.AddBuildpack(appName, data.BuildpackURL)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"An error occurred while adding the buildpack: "+err.Error(),
-			nil,
-		))
+		return commandErrorResponse(c, "An error occurred while adding the buildpack", err, nil)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
@@ -882,6 +1336,10 @@ func SetBuildpack(c *fiber.Ctx) error {
 		))
 	}
 
+	if missing, err := capabilityMissing(c, utils.FeatureBuildpacks); missing {
+		return err
+	}
+
 	var data struct {
 		BuildpackURL string `json:"buildpack_url"`
 		Index        int    `json:"index,omitempty"`
@@ -904,11 +1362,7 @@ func SetBuildpack(c *fiber.Ctx) error {
 
 	output, err := utils.SetBuildpack(appName, data.BuildpackURL, data.Index)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"An error occurred while setting the buildpack: "+err.Error(),
-			nil,
-		))
+		return commandErrorResponse(c, "An error occurred while setting the buildpack", err, nil)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
@@ -955,11 +1409,7 @@ func RemoveBuildpack(c *fiber.Ctx) error {
 
 	output, err := utils.RemoveBuildpack(appName, data.BuildpackURL)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"An error occurred while removing the buildpack: "+err.Error(),
-			nil,
-		))
+		return commandErrorResponse(c, "An error occurred while removing the buildpack", err, nil)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
@@ -986,11 +1436,7 @@ func ClearBuildpacks(c *fiber.Ctx) error {
 
 	output, err := utils.ClearBuildpacks(appName)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"An error occurred while clearing buildpacks: "+err.Error(),
-			nil,
-		))
+		return commandErrorResponse(c, "An error occurred while clearing buildpacks", err, nil)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
@@ -1003,7 +1449,7 @@ func ClearBuildpacks(c *fiber.Ctx) error {
 	))
 }
 
-// GetBuildpackReport gets the buildpack report of an app
+// GetBuildpackReport gets the buildpack report of an app, cached briefly; refresh=true reads it from dokku
 func GetBuildpackReport(c *fiber.Ctx) error {
 	appName := c.Params("app_name")
 	if appName == "" {
@@ -1014,7 +1460,9 @@ func GetBuildpackReport(c *fiber.Ctx) error {
 		))
 	}
 
-	report, err := utils.GetBuildpackReport(appName)
+	report, age, err := utils.CachedReport(utils.ReportBuildpacks, appName, c.QueryBool("refresh"), func() (map[string]interface{}, error) {
+		return utils.GetBuildpackReport(appName)
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
 			false,
@@ -1023,6 +1471,7 @@ func GetBuildpackReport(c *fiber.Ctx) error {
 		))
 	}
 
+	setReportCacheHeaders(c, age)
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
 		"Buildpack report retrieved successfully",
@@ -1041,6 +1490,10 @@ func SetBuilder(c *fiber.Ctx) error {
 		))
 	}
 
+	if missing, err := capabilityMissing(c, utils.FeatureBuilder); missing {
+		return err
+	}
+
 	var data struct {
 		BuilderType string `json:"builder_type"`
 	}
@@ -1053,7 +1506,6 @@ func SetBuilder(c *fiber.Ctx) error {
 	}
 
 	// Check valid builder types
-	validBuilders := []string{"herokuish", "pack", "dockerfile", "nixpacks"}
 	isValid := false
 	for _, valid := range validBuilders {
 		if data.BuilderType == valid {
@@ -1072,11 +1524,7 @@ func SetBuilder(c *fiber.Ctx) error {
 
 	output, err := utils.SetBuilder(appName, data.BuilderType)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"An error occurred while setting the builder: "+err.Error(),
-			nil,
-		))
+		return commandErrorResponse(c, "An error occurred while setting the builder", err, nil)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
@@ -1090,7 +1538,7 @@ func SetBuilder(c *fiber.Ctx) error {
 	))
 }
 
-// GetBuilderReport gets the builder report of an app
+// GetBuilderReport gets the builder report of an app, cached briefly; refresh=true reads it from dokku
 func GetBuilderReport(c *fiber.Ctx) error {
 	appName := c.Params("app_name")
 	if appName == "" {
@@ -1101,7 +1549,9 @@ func GetBuilderReport(c *fiber.Ctx) error {
 		))
 	}
 
-	report, err := utils.GetBuilderReport(appName)
+	report, age, err := utils.CachedReport(utils.ReportBuilder, appName, c.QueryBool("refresh"), func() (map[string]interface{}, error) {
+		return utils.GetBuilderReport(appName)
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
 			false,
@@ -1110,6 +1560,7 @@ func GetBuilderReport(c *fiber.Ctx) error {
 		))
 	}
 
+	setReportCacheHeaders(c, age)
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
 		"Builder report retrieved successfully",
@@ -1130,13 +1581,61 @@ func GetAppLogs(c *fiber.Ctx) error {
 		))
 	}
 
+	recordAppInteraction(c, appName, api.InteractionLogs)
+
 	// Get query parameters
 	tail := c.QueryInt("tail", 100) // Default 100 lines
 	logType := c.Query("type", "app") // app, build, deploy
 	processType := c.Query("process", "web") // web, worker, all
 
+	// Optional time window and cursor, so clients can poll for new lines only
+	var window utils.LogWindow
+	for param, target := range map[string]*time.Time{"since": &window.Since, "until": &window.Until} {
+		if value := c.Query(param); value != "" {
+			parsed, err := utils.ParseLogTime(value)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+					false,
+					err.Error(),
+					nil,
+				))
+			}
+			*target = parsed
+		}
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		parsed, err := utils.DecodeLogCursor(cursor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Invalid cursor",
+				nil,
+			))
+		}
+		window.Cursor = parsed
+	}
+	// Server-side filtering, so the frontend doesn't download everything to filter
+	filter, err := utils.ParseLogFilter(c.Query("grep"), c.Query("level"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	raw := c.QueryBool("raw", false) // keep ANSI colors for terminal UIs
+
+	windowed := !window.Since.IsZero() || !window.Until.IsZero() || window.Cursor != nil ||
+		c.QueryBool("with_cursor", false)
+	if windowed && (logType == "build" || logType == "deploy") {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"since, until and cursor are only supported for app logs",
+			nil,
+		))
+	}
+
 	var logs string
-	var err error
 
 	switch logType {
 	case "build":
@@ -1145,14 +1644,24 @@ func GetAppLogs(c *fiber.Ctx) error {
 		logs, err = utils.GetDeployLogs(appName)
 	case "all":
 		// Logs for all processes
-		logs, err = utils.GetAllProcessLogs(appName, tail)
+		if raw {
+			logs, err = utils.GetRawProcessLogs(appName, "", tail)
+		} else {
+			logs, err = utils.GetAllProcessLogs(appName, tail)
+		}
 	default:
 		// Logs for a specific process or web process
 		if processType == "all" {
-			logs, err = utils.GetAllProcessLogs(appName, tail)
+			processType = ""
+		}
+		if raw {
+			logs, err = utils.GetRawProcessLogs(appName, processType, tail)
 		} else {
 			logs, err = utils.GetProcessSpecificLogs(appName, processType, tail)
 		}
+		if processType == "" {
+			processType = "all"
+		}
 	}
 
 	if err != nil {
@@ -1163,16 +1672,31 @@ func GetAppLogs(c *fiber.Ctx) error {
 		))
 	}
 
+	data := fiber.Map{
+		"logs": logs,
+		"type": logType,
+		"process": processType,
+		"tail": tail,
+		"timestamp": time.Now().Unix(),
+	}
+	if windowed {
+		result := utils.FilterLogWindow(logs, tail, window)
+		data["logs"] = result.Logs
+		data["lines"] = result.Lines
+		data["next_cursor"] = result.NextCursor
+		data["truncated"] = result.Truncated
+	}
+	if filter != nil {
+		data["logs"] = filter.Apply(data["logs"].(string))
+		data["grep"] = c.Query("grep")
+		data["level"] = filter.MinLevel
+	}
+	data["raw"] = raw
+
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
 		"Logs fetched successfully",
-		fiber.Map{
-			"logs": logs,
-			"type": logType,
-			"process": processType,
-			"tail": tail,
-			"timestamp": time.Now().Unix(),
-		},
+		data,
 	))
 }
 
@@ -1187,6 +1711,8 @@ func StreamAppLogs(c *fiber.Ctx) error {
 		))
 	}
 
+	recordAppInteraction(c, appName, api.InteractionLogs)
+
 	// Set SSE headers
 	c.Set("Content-Type", "text/event-stream")
 	c.Set("Cache-Control", "no-cache")
@@ -1234,6 +1760,85 @@ func StreamAppLogs(c *fiber.Ctx) error {
 	return nil
 }
 
+// logTailMaxFollow bounds how long a followed log tail stays open
+const logTailMaxFollow = time.Hour
+
+// TailAppLogs streams the logs of an app as chunked plain text, e.g. for curl or the CLI
+func TailAppLogs(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	recordAppInteraction(c, appName, api.InteractionLogs)
+
+	options := utils.LogTailOptions{
+		Process: c.Query("process"),
+		Tail:    c.QueryInt("tail", 100),
+		Follow:  c.QueryBool("follow", false),
+		Raw:     c.QueryBool("raw", false),
+	}
+	if options.Process == "all" {
+		options.Process = ""
+	}
+	filter, err := utils.ParseLogFilter(c.Query("grep"), c.Query("level"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	options.Filter = filter
+	if options.Tail < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"tail must not be negative",
+			nil,
+		))
+	}
+
+	c.Set("Content-Type", "text/plain; charset=utf-8")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("X-Content-Type-Options", "nosniff")
+
+	// No content length is set, so the body is sent with chunked transfer encoding
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		maxDuration := 2 * time.Minute
+		if options.Follow {
+			maxDuration = logTailMaxFollow
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), maxDuration)
+		defer cancel()
+
+		err := utils.TailAppLogs(ctx, appName, options, &flushingWriter{w: w})
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			fmt.Fprintf(w, "[citizen] log tail ended: %v\n", err)
+		}
+		w.Flush()
+	})
+
+	return nil
+}
+
+// flushingWriter flushes after every write so each log line reaches the client immediately.
+// A failed flush means the client went away, which ends the tail.
+type flushingWriter struct {
+	w *bufio.Writer
+}
+
+func (f *flushingWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, f.w.Flush()
+}
+
 // GetLogInfo gets log information
 func GetLogInfo(c *fiber.Ctx) error {
 	appName := c.Params("app_name")
@@ -1275,7 +1880,8 @@ func RemoveEnv(c *fiber.Ctx) error {
 
 	// Parse request body
 	var data struct {
-		Key string `json:"key"`
+		Key       string `json:"key"`
+		NoRestart bool   `json:"no_restart"` // remove now, apply with the next restart
 	}
 	if err := c.BodyParser(&data); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
@@ -1303,6 +1909,13 @@ func RemoveEnv(c *fiber.Ctx) error {
 		))
 	}
 
+	// Protected keys can only be removed by admins
+	if blocked, err := protectedEnvChange(c, appName, []string{data.Key}); blocked {
+		return err
+	}
+
+	recordAppInteraction(c, appName, api.InteractionEnv)
+
 	// 📝 Log env remove activity start
 	var userID *int
 	if userIDValue := c.Locals("user_id"); userIDValue != nil {
@@ -1316,8 +1929,9 @@ func RemoveEnv(c *fiber.Ctx) error {
 		fmt.Printf("[ACTIVITY] ⚠️ Failed to log env activity: %v\n", activityErr)
 	}
 
-	// Remove environment variable
-	output, err := utils.RemoveEnv(appName, data.Key)
+	// Remove environment variable, restarting unless asked not to
+	noRestart := data.NoRestart || c.QueryBool("no_restart")
+	result, err := utils.RemoveEnvVerified(appName, data.Key, !noRestart)
 	if err != nil {
 		// 📝 Update env activity as failed
 		if envActivity != nil {
@@ -1325,26 +1939,36 @@ func RemoveEnv(c *fiber.Ctx) error {
 			database.UpdateActivity(envActivity.ID, database.StatusError, &errorMsg)
 		}
 		
-		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
-			false,
-			"An error occurred while removing the environment variable: "+err.Error(),
-			nil,
-		))
+		return commandErrorResponse(c, "An error occurred while removing the environment variable", err, nil)
 	}
 
+	trackEnvRestart(appName, result, userID)
+
 	// 📝 Update env activity as successful
 	if envActivity != nil {
 		database.UpdateActivity(envActivity.ID, database.StatusSuccess, nil)
 	}
 
+	responseData := fiber.Map{
+		"app_name":        appName,
+		"key":             data.Key,
+		"output":          result.Output,
+		"restarted":       result.Restarted,
+		"restart_pending": result.RestartPending,
+	}
+	if result.RestartError != "" {
+		responseData["restart_error"] = result.RestartError
+		return c.Status(fiber.StatusMultiStatus).JSON(utils.NewCitizenResponse(
+			false,
+			"Environment variable removed but the app could not be restarted: "+result.RestartError,
+			responseData,
+		))
+	}
+
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
 		"Environment variable removed successfully",
-		fiber.Map{
-			"app_name": appName,
-			"key":      data.Key,
-			"output":   output,
-		},
+		responseData,
 	))
 }
 
@@ -1370,6 +1994,53 @@ func GetEnv(c *fiber.Ctx) error {
 		))
 	}
 
+	// Values are masked, each one is revealed on demand after re-authentication
+	maskEnvValues(envVars)
+
+	// The detailed form tells which keys are protected or can't be revealed, the default one stays a plain map
+	if c.QueryBool("detailed") {
+		protected, err := protectedEnvKeySet(c, appName)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+				false,
+				"An error occurred while getting protected environment variables: "+err.Error(),
+				nil,
+			))
+		}
+		masked, err := api.Apps.ListMaskedEnvKeys(c.Context(), appName)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+				false,
+				"An error occurred while getting masked environment variables: "+err.Error(),
+				nil,
+			))
+		}
+		protectedKeys, maskedKeys := []string{}, []string{}
+		for key := range protected {
+			if _, ok := envVars[key]; ok {
+				protectedKeys = append(protectedKeys, key)
+			}
+		}
+		for _, k := range masked {
+			if _, ok := envVars[k.Key]; ok {
+				maskedKeys = append(maskedKeys, k.Key)
+			}
+		}
+		slices.Sort(protectedKeys)
+
+		return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+			true,
+			"Environment variables retrieved successfully",
+			fiber.Map{
+				"env_vars":           envVars,
+				"protected_keys":     protectedKeys,
+				"always_masked_keys": maskedKeys,
+				"can_edit_protected": isAdminRequest(c),
+				"reveal_url":         fmt.Sprintf("/api/v1/citizen/apps/%s/env/reveal", appName),
+			},
+		))
+	}
+
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
 		"Environment variables retrieved successfully",
@@ -1377,7 +2048,8 @@ func GetEnv(c *fiber.Ctx) error {
 	))
 }
 
-// GetAppActivities gets the activities of an app
+// GetAppActivities gets a page of the activities of an app, filtered by the type, status and
+// trigger query params (comma separated) and the since/until dates
 func GetAppActivities(c *fiber.Ctx) error {
 	appName := c.Params("app_name")
 	if appName == "" {
@@ -1388,8 +2060,24 @@ func GetAppActivities(c *fiber.Ctx) error {
 		))
 	}
 
-	// Use new activity system
-	activities, err := database.GetAppActivities(appName, 10)
+	limit := c.QueryInt("limit", 10)
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+	filter, err := parseActivityFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	activities, total, err := api.Activities.ListAppActivities(c.Context(), appName, filter, limit, offset)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
 			false,
@@ -1409,9 +2097,15 @@ func GetAppActivities(c *fiber.Ctx) error {
 			"status":    string(activity.Status),
 		}
 
-		// Add details if available
+		// Add details if available (command traces are served by the drill-down endpoint)
 		if activity.Details != nil {
-			formattedActivity["details"] = activity.Details
+			details := fiber.Map{}
+			for key, value := range activity.Details {
+				if key != "commands" {
+					details[key] = value
+				}
+			}
+			formattedActivity["details"] = details
 		}
 
 		// Add duration if available
@@ -1435,11 +2129,122 @@ func GetAppActivities(c *fiber.Ctx) error {
 		"Activities retrieved successfully",
 		fiber.Map{
 			"activities": formattedActivities,
-			"total":      len(formattedActivities),
+			"total":      total,
+			"limit":      limit,
+			"offset":     offset,
+			"has_more":   offset+len(activities) < total,
 		},
 	))
 }
 
+// activityFilterValues are the values each activity filter accepts
+var activityFilterValues = map[string][]string{
+	"type": {
+		string(api.ActivityDeploy), string(api.ActivityRestart), string(api.ActivityDomain), string(api.ActivityConfig),
+		string(api.ActivityEnv), string(api.ActivityBuild), string(api.ActivityAlert),
+	},
+	"status": {
+		string(api.StatusSuccess), string(api.StatusError), string(api.StatusWarning), string(api.StatusInfo),
+		string(api.StatusPending), string(api.StatusQueued), string(api.StatusRunning), string(api.StatusCancelled),
+		string(api.StatusSkipped), string(api.StatusPendingApproval), string(api.StatusRejected),
+	},
+	"trigger": {string(api.TriggerManual), string(api.TriggerWebhook), string(api.TriggerAutomatic)},
+}
+
+// parseActivityFilter reads the activity filters of a request. Dates are RFC 3339 timestamps or
+// YYYY-MM-DD days, an until day including the whole day.
+func parseActivityFilter(c *fiber.Ctx) (api.ActivityFilter, error) {
+	var filter api.ActivityFilter
+
+	values := func(param string) ([]string, error) {
+		var list []string
+		for _, value := range strings.Split(c.Query(param), ",") {
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			if !slices.Contains(activityFilterValues[param], value) {
+				return nil, fmt.Errorf("invalid %s %q, expected one of %s", param, value, strings.Join(activityFilterValues[param], ", "))
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	}
+	var err error
+	if filter.Types, err = values("type"); err != nil {
+		return filter, err
+	}
+	if filter.Statuses, err = values("status"); err != nil {
+		return filter, err
+	}
+	if filter.Triggers, err = values("trigger"); err != nil {
+		return filter, err
+	}
+
+	date := func(param string) (*time.Time, error) {
+		value := c.Query(param)
+		if value == "" {
+			return nil, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return &t, nil
+		}
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s date %q, use YYYY-MM-DD or RFC 3339", param, value)
+		}
+		if param == "until" {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t, nil
+	}
+	if filter.Since, err = date("since"); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = date("until"); err != nil {
+		return filter, err
+	}
+	if filter.Since != nil && filter.Until != nil && !filter.Since.Before(*filter.Until) {
+		return filter, fmt.Errorf("since must be before until")
+	}
+	return filter, nil
+}
+
+// GetAppActivity returns a single activity with its full details, including executed dokku commands
+func GetAppActivity(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	activityID, err := strconv.Atoi(c.Params("activity_id"))
+	if err != nil || activityID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid activity ID",
+			nil,
+		))
+	}
+
+	activity, err := database.GetActivityByID(activityID)
+	if err != nil || activity.AppName != appName {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Activity not found",
+			nil,
+		))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Activity retrieved successfully",
+		activity,
+	))
+}
+
 // GetLiveBuildLogs gets only build/deploy output (simplified)
 func GetLiveBuildLogs(c *fiber.Ctx) error {
 	appName := c.Params("app_name")
@@ -1480,6 +2285,21 @@ func GetAllAppsInfo(c *fiber.Ctx) error {
 		))
 	}
 
+	// Apps whose reports could not be fetched carry an "errors" field
+	failedApps := 0
+	for _, info := range allInfo {
+		if _, hasErrors := info["errors"]; hasErrors {
+			failedApps++
+		}
+	}
+	if failedApps > 0 {
+		return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+			true,
+			fmt.Sprintf("Detailed information retrieved with errors for %d of %d apps", failedApps, len(allInfo)),
+			allInfo,
+		))
+	}
+
 	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
 		true,
 		"Detailed information for all apps retrieved successfully",
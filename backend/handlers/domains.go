@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListAllDomains lists every domain of every app with its DNS verification and TLS certificate
+// status as of the last check, certificates expiring first. The checks run hourly in the
+// background; refresh=true runs them again before answering.
+func ListAllDomains(c *fiber.Ctx) error {
+	var checks []api.DomainCheck
+	var err error
+	if c.QueryBool("refresh") {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		checks, err = utils.CheckAllDomains(ctx)
+		if err == nil {
+			// Same order as the stored list
+			checks, err = api.Settings.ListDomainChecks(ctx)
+		}
+	} else {
+		checks, err = api.Settings.ListDomainChecks(context.Background())
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve domains: "+err.Error(),
+			nil,
+		))
+	}
+
+	summary := map[string]int{
+		"total":        len(checks),
+		"expiring":     0,
+		"expired":      0,
+		"tls_problems": 0,
+		"dns_problems": 0,
+	}
+	var lastCheckedAt *time.Time
+	for i, check := range checks {
+		switch check.TLSStatus {
+		case utils.TLSExpiring:
+			summary["expiring"]++
+		case utils.TLSExpired:
+			summary["expired"]++
+			summary["tls_problems"]++
+		case utils.TLSInvalid, utils.TLSMissing:
+			summary["tls_problems"]++
+		}
+		if check.VerificationStatus == utils.DomainMismatch || check.VerificationStatus == utils.DomainUnresolved {
+			summary["dns_problems"]++
+		}
+		if lastCheckedAt == nil || check.LastCheckedAt.After(*lastCheckedAt) {
+			lastCheckedAt = &checks[i].LastCheckedAt
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Domains retrieved successfully",
+		fiber.Map{
+			"domains":         checks,
+			"summary":         summary,
+			"last_checked_at": lastCheckedAt,
+		},
+	))
+}
+
+// ListDomainPropagation lists the custom domains of an app watched after being added, with
+// whether they resolve to the server and the app answers through them
+func ListDomainPropagation(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	propagations, err := api.Settings.ListDomainPropagations(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve domain propagation: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Domain propagation retrieved successfully",
+		propagations,
+	))
+}
+
+// RecheckDomainPropagation starts watching a custom domain of an app again, for a domain whose
+// DNS was fixed after its watch timed out. The first check runs within a minute.
+func RecheckDomainPropagation(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	domain := c.Params("domain")
+	if appName == "" || domain == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name and domain are required",
+			nil,
+		))
+	}
+
+	domains, err := api.Settings.GetCustomDomains(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve custom domains: "+err.Error(),
+			nil,
+		))
+	}
+	if !slices.Contains(domains, domain) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Domain "+domain+" is not a custom domain of "+appName,
+			nil,
+		))
+	}
+
+	propagation, err := api.Settings.StartDomainPropagation(c.Context(), appName, domain)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to restart domain propagation checks: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Domain propagation checks restarted",
+		propagation,
+	))
+}
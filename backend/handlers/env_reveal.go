@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errReauthFailed is returned when the password or passkey given to re-authenticate is wrong
+var errReauthFailed = errors.New("re-authentication failed")
+
+// maskEnvValues replaces the values of an env with the mask, empty values stay empty
+func maskEnvValues(env map[string]string) {
+	for key, value := range env {
+		if value != "" {
+			env[key] = maskedEnvValue
+		}
+	}
+}
+
+// BeginEnvReveal starts a passkey re-authentication for revealing env values and returns the
+// options for navigator.credentials.get(). Users without a passkey re-authenticate with their password.
+func BeginEnvReveal(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"User not authenticated",
+			nil,
+		))
+	}
+
+	passkeys, err := api.Users.ListPasskeys(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list passkeys: "+err.Error(),
+			nil,
+		))
+	}
+	if len(passkeys) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"No passkey registered, re-authenticate with your password",
+			nil,
+		))
+	}
+
+	ceremonyID, ceremony, err := startPasskeyCeremony("reauth", userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to start passkey re-authentication",
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Passkey re-authentication started",
+		fiber.Map{
+			"ceremony_id": ceremonyID,
+			"public_key": fiber.Map{
+				"rpId":             utils.GetWebAuthnRelyingParty().ID,
+				"challenge":        utils.EncodeWebAuthnBytes(ceremony.Challenge),
+				"timeout":          passkeyCeremonyTTL.Milliseconds(),
+				"allowCredentials": passkeyDescriptors(passkeys),
+				"userVerification": "required",
+			},
+		},
+	))
+}
+
+// RevealEnv returns the value of an env key of an app. The user re-authenticates with their
+// password, or a passkey answering a ceremony of BeginEnvReveal, and every attempt is audited.
+// Always masked keys are never revealed, protected keys only to admins.
+func RevealEnv(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+	userID, ok := c.Locals("user_id").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"User not authenticated",
+			nil,
+		))
+	}
+
+	var req struct {
+		Key        string                    `json:"key"`
+		Password   string                    `json:"password"`
+		CeremonyID string                    `json:"ceremony_id"`
+		Credential *utils.WebAuthnCredential `json:"credential"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if !envKeyPattern.MatchString(req.Key) {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"A valid environment variable key is required",
+			nil,
+		))
+	}
+
+	masked, err := api.Apps.IsEnvKeyMasked(c.Context(), appName, req.Key)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to check masked environment variables: "+err.Error(),
+			nil,
+		))
+	}
+	if masked {
+		auditSystemAction(c, "env_reveal", appName, map[string]interface{}{"key": req.Key}, errors.New("key is always masked"))
+		return c.Status(fiber.StatusForbidden).JSON(utils.NewCitizenResponse(
+			false,
+			"Environment variable "+req.Key+" is always masked and can't be revealed",
+			nil,
+		))
+	}
+	if !isAdminRequest(c) {
+		protected, err := protectedEnvKeySet(c, appName)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+				false,
+				"Failed to check protected environment variables: "+err.Error(),
+				nil,
+			))
+		}
+		if protected[req.Key] {
+			auditSystemAction(c, "env_reveal", appName, map[string]interface{}{"key": req.Key}, errors.New("key is protected"))
+			return c.Status(fiber.StatusForbidden).JSON(utils.NewCitizenResponse(
+				false,
+				"Environment variable "+req.Key+" is protected, only admins can reveal it",
+				nil,
+			))
+		}
+	}
+
+	method, err := verifyReauthentication(c, userID, req.Password, req.CeremonyID, req.Credential)
+	details := map[string]interface{}{"key": req.Key, "method": method}
+	if err != nil {
+		auditSystemAction(c, "env_reveal", appName, details, err)
+		utils.SecurityLog("Env reveal of %s on %s denied for user %d: %v", req.Key, appName, userID, err)
+		status := fiber.StatusUnauthorized
+		if !errors.Is(err, errReauthFailed) {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	env, err := utils.GetEnv(appName)
+	if err != nil {
+		auditSystemAction(c, "env_reveal", appName, details, err)
+		return commandErrorResponse(c, "An error occurred while getting environment variables", err, nil)
+	}
+	value, ok := env[req.Key]
+	if !ok {
+		auditSystemAction(c, "env_reveal", appName, details, errors.New("key not set"))
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Environment variable "+req.Key+" is not set",
+			nil,
+		))
+	}
+
+	auditSystemAction(c, "env_reveal", appName, details, nil)
+	utils.SecurityLog("Env %s of %s revealed to user %d (%s)", req.Key, appName, userID, method)
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Environment variable revealed",
+		fiber.Map{
+			"app_name": appName,
+			"key":      req.Key,
+			"value":    value,
+		},
+	))
+}
+
+// verifyReauthentication checks the password of a user, or the assertion of one of their passkeys
+// for a reauth ceremony, and returns the method used
+func verifyReauthentication(c *fiber.Ctx, userID int, password, ceremonyID string, credential *utils.WebAuthnCredential) (string, error) {
+	switch {
+	case ceremonyID != "" && credential != nil:
+		ceremony, ok := takePasskeyCeremony(ceremonyID, "reauth")
+		if !ok || ceremony.UserID != userID {
+			return "passkey", fmt.Errorf("%w: passkey re-authentication expired, start it again", errReauthFailed)
+		}
+		credentialID, err := utils.DecodeWebAuthnBytes(credential.RawID)
+		if err != nil || len(credentialID) == 0 {
+			return "passkey", fmt.Errorf("%w: invalid passkey", errReauthFailed)
+		}
+		passkey, err := api.Users.GetPasskeyByCredentialID(c.Context(), credentialID)
+		if err != nil || passkey.UserID != userID {
+			return "passkey", fmt.Errorf("%w: invalid passkey", errReauthFailed)
+		}
+		signCount, err := utils.GetWebAuthnRelyingParty().VerifyWebAuthnAssertion(credential, ceremony.Challenge, passkey.PublicKey, passkey.SignCount)
+		if err != nil {
+			return "passkey", fmt.Errorf("%w: invalid passkey", errReauthFailed)
+		}
+		if err := api.Users.RecordPasskeyUse(context.Background(), passkey.ID, signCount); err != nil {
+			utils.WarnLog("Failed to record the use of passkey %d: %v", passkey.ID, err)
+		}
+		return "passkey", nil
+
+	case password != "":
+		user, err := api.Users.GetUserByID(c.Context(), userID)
+		if err != nil || !utils.CheckPasswordHash(password, user.Password) {
+			return "password", fmt.Errorf("%w: wrong password", errReauthFailed)
+		}
+		return "password", nil
+	}
+	return "", errors.New("Re-authenticate with your password or a passkey to access environment variables")
+}
+
+// ListMaskedEnvKeys lists the env keys of an app whose values are always masked
+func ListMaskedEnvKeys(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	keys, err := api.Apps.ListMaskedEnvKeys(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve masked environment variables: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Masked environment variables retrieved successfully",
+		fiber.Map{
+			"app_name":    appName,
+			"masked_keys": keys,
+		},
+	))
+}
+
+// MarkMaskedEnvKeys keeps the values of env keys of an app always masked, they can't be revealed
+// until an admin unmarks them
+func MarkMaskedEnvKeys(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		Keys []string `json:"keys"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if len(req.Keys) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"At least one environment variable key is required",
+			nil,
+		))
+	}
+	for _, key := range req.Keys {
+		if !envKeyPattern.MatchString(key) {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				fmt.Sprintf("Invalid environment variable key %q", key),
+				nil,
+			))
+		}
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	for _, key := range req.Keys {
+		if err := api.Apps.MarkEnvKeyMasked(c.Context(), appName, key, userID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+				false,
+				"Failed to mark masked environment variables: "+err.Error(),
+				nil,
+			))
+		}
+	}
+
+	sort.Strings(req.Keys)
+	message := "Always masked environment variables " + strings.Join(req.Keys, ", ")
+	if activity, err := database.LogConfigActivity(appName, "masked_env", message, userID); err != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log masked env activity: %v\n", err)
+	} else {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+	auditSystemAction(c, "env_mask", appName, map[string]interface{}{"keys": req.Keys}, nil)
+
+	return ListMaskedEnvKeys(c)
+}
+
+// UnmarkMaskedEnvKey lets the value of an env key of an app be revealed again
+func UnmarkMaskedEnvKey(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	key := c.Params("key")
+	if appName == "" || key == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name and key are required",
+			nil,
+		))
+	}
+
+	err := api.Apps.UnmarkEnvKeyMasked(c.Context(), appName, key)
+	if errors.Is(err, api.ErrMaskedEnvKeyNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Environment variable "+key+" is not always masked",
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to unmark masked environment variable: "+err.Error(),
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if activity, err := database.LogConfigActivity(appName, "masked_env", "Environment variable "+key+" can be revealed again", userID); err != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log masked env activity: %v\n", err)
+	} else {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+	auditSystemAction(c, "env_unmask", appName, map[string]interface{}{"key": key}, nil)
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Environment variable "+key+" can be revealed again",
+		fiber.Map{"app_name": appName, "key": key},
+	))
+}
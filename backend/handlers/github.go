@@ -62,8 +62,9 @@ func GitHubAuthInit(c *fiber.Ctx) error {
 	randomComponent := hex.EncodeToString(randomBytes)
 	state := fmt.Sprintf("user_%v_%d_%s", userID, time.Now().Unix(), randomComponent)
 	
-	// Generate OAuth URL
-	authURL, err := utils.GetGitHubOAuthURL(state)
+	// Generate OAuth URL, redirecting back to the registered URI of the host the flow started on
+	redirectURI := utils.SelectGitHubRedirectURI(c.Hostname())
+	authURL, err := utils.GetGitHubOAuthURL(state, redirectURI)
 	if err != nil {
 		log.Printf("[GITHUB] Failed to generate OAuth URL: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
@@ -77,8 +78,9 @@ func GitHubAuthInit(c *fiber.Ctx) error {
 		true,
 		"GitHub OAuth URL generated",
 		fiber.Map{
-			"auth_url": authURL,
-			"state":    state,
+			"auth_url":     authURL,
+			"state":        state,
+			"redirect_uri": redirectURI,
 		},
 	))
 }
@@ -321,6 +323,7 @@ func ConnectRepository(c *fiber.Ctx) error {
 		FullName      string `json:"full_name"`
 		AutoDeploy    bool   `json:"auto_deploy"`
 		DeployBranch  string `json:"deploy_branch"`
+		BuildPath     string `json:"build_path"`
 	}
 
 	if err := c.BodyParser(&connectData); err != nil {
@@ -342,6 +345,14 @@ func ConnectRepository(c *fiber.Ctx) error {
 		))
 	}
 	
+	if err := utils.ValidateBuildPath(connectData.BuildPath); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	
 	// Set default branch if not provided
 	if connectData.DeployBranch == "" {
 		connectData.DeployBranch = "main"
@@ -415,6 +426,11 @@ func ConnectRepository(c *fiber.Ctx) error {
 		// Don't fail the entire connection, just log the error
 	} else {
 		log.Printf("[GITHUB] ✅ Repository connection saved successfully")
+		if connectData.BuildPath != "" {
+			if err := api.GitHub.SetBuildPath(c.Context(), connectData.AppName, connectData.BuildPath); err != nil {
+				log.Printf("[GITHUB] ❌ Failed to save build path: %v", err)
+			}
+		}
 	}
 	
 	log.Printf("[GITHUB] ✅ Repository connected: %s to app %s", connectData.FullName, connectData.AppName)
@@ -427,6 +443,7 @@ func ConnectRepository(c *fiber.Ctx) error {
 			"repository":      githubRepo,
 			"auto_deploy":     connectData.AutoDeploy,
 			"deploy_branch":   connectData.DeployBranch,
+			"build_path":      connectData.BuildPath,
 			"webhook_id":      webhookID,
 			"webhook_active":  webhookID != nil,
 		},
@@ -580,6 +597,11 @@ func GitHubWebhookHandler(c *fiber.Ctx) error {
 	
 	log.Printf("[WEBHOOK] Received GitHub webhook: %s (ID: %s)", eventType, deliveryID)
 	
+	// Comment commands are handled separately from push deployments
+	if eventType == "issue_comment" {
+		return handleIssueCommentEvent(c)
+	}
+	
 	// Only process push events for now
 	if eventType != "push" {
 		return c.JSON(fiber.Map{
@@ -593,6 +615,7 @@ func GitHubWebhookHandler(c *fiber.Ctx) error {
 		Ref        string `json:"ref"`
 		Before     string `json:"before"`
 		After      string `json:"after"`
+		Deleted    bool   `json:"deleted"`
 		Repository struct {
 			ID       int64  `json:"id"`
 			FullName string `json:"full_name"`
@@ -601,10 +624,22 @@ func GitHubWebhookHandler(c *fiber.Ctx) error {
 			ID      string `json:"id"`
 			Message string `json:"message"`
 			Author  struct {
-				Name  string `json:"name"`
-				Email string `json:"email"`
+				Name     string `json:"name"`
+				Email    string `json:"email"`
+				Username string `json:"username"`
 			} `json:"author"`
 		} `json:"head_commit"`
+		Pusher struct {
+			Name string `json:"name"`
+		} `json:"pusher"`
+		Sender struct {
+			Login string `json:"login"`
+		} `json:"sender"`
+		Commits []struct {
+			Added    []string `json:"added"`
+			Removed  []string `json:"removed"`
+			Modified []string `json:"modified"`
+		} `json:"commits"`
 	}
 	
 	if err := c.BodyParser(&pushEvent); err != nil {
@@ -617,7 +652,7 @@ func GitHubWebhookHandler(c *fiber.Ctx) error {
 	// Extract branch name from ref (refs/heads/main -> main)
 	branch := strings.TrimPrefix(pushEvent.Ref, "refs/heads/")
 	
-	log.Printf("[WEBHOOK] Push to %s/%s on branch %s (commit: %s)", 
+	log.Printf("[WEBHOOK] Push to %s on branch %s (commit: %s)", 
 		pushEvent.Repository.FullName, branch, pushEvent.HeadCommit.ID)
 	
 	// Find repository connection in database
@@ -631,29 +666,119 @@ func GitHubWebhookHandler(c *fiber.Ctx) error {
 		})
 	}
 	
-	appName := repoConnection.AppName
+	connectedApp := repoConnection.AppName
 	autoDeploy := repoConnection.AutoDeployEnabled
-	deployBranch := repoConnection.DeployBranch
 	
 	// Check if auto deploy is enabled
 	if !autoDeploy {
-		log.Printf("[WEBHOOK] Auto deploy disabled for %s", appName)
+		log.Printf("[WEBHOOK] Auto deploy disabled for %s", connectedApp)
 		return c.JSON(fiber.Map{
 			"status": "ignored",
 			"reason": "Auto deploy disabled",
 		})
 	}
 	
-	// Check if this is the correct branch for deployment
-	if branch != deployBranch {
-		log.Printf("[WEBHOOK] Branch %s does not match deploy branch %s for app %s", 
-			branch, deployBranch, appName)
+	// Pick the app to deploy from the branch rules, falling back to the deploy branch
+	branchRules, err := api.GitHub.GetBranchRules(c.Context(), connectedApp)
+	if err != nil {
+		log.Printf("[WEBHOOK] ⚠️ Failed to load branch rules of %s, using the deploy branch: %v", connectedApp, err)
+		branchRules = &api.BranchRules{AppName: connectedApp, DeployBranch: repoConnection.DeployBranch}
+	}
+	match := utils.MatchBranchRules(branchRules, pushEvent.Ref)
+	if match.Deploy && match.Tag != "" && pushEvent.Deleted {
+		match.Deploy = false
+		match.Reason = fmt.Sprintf("Tag %s was deleted", match.Tag)
+	}
+	if !match.Deploy {
+		log.Printf("[WEBHOOK] %s for app %s", match.Reason, connectedApp)
 		return c.JSON(fiber.Map{
 			"status": "ignored",
-			"reason": fmt.Sprintf("Branch %s does not match deploy branch %s", branch, deployBranch),
+			"reason": match.Reason,
 		})
 	}
+	appName := match.TargetApp
+	// Tag pushes deploy the tag, annotated tags point After at the tag object rather than the commit
+	commit := pushEvent.After
+	if match.Tag != "" {
+		branch = match.Tag
+		commit = pushEvent.HeadCommit.ID
+	}
+	pattern := ""
+	if match.Rule != nil {
+		pattern = match.Rule.Pattern
+		log.Printf("[WEBHOOK] Branch %s matches pattern %s of %s, deploying %s", 
+			branch, pattern, connectedApp, appName)
+	} else if match.Tag != "" {
+		pattern = branchRules.TagPattern
+		log.Printf("[WEBHOOK] %s", match.Reason)
+	}
+	
+	// Skip pushes by GitHub users the push filter of the connected app doesn't let deploy
+	pusher := pushEvent.Sender.Login
+	if pusher == "" {
+		pusher = pushEvent.Pusher.Name
+	}
+	author := pushEvent.HeadCommit.Author.Username
+	pushFilter, err := api.GitHub.GetPushFilter(c.Context(), connectedApp)
+	if err != nil {
+		// Fail closed, a filter that can't be read must not let every push through
+		log.Printf("[WEBHOOK] ⚠️ Failed to load push filter of %s: %v", connectedApp, err)
+		return skipWebhookDeployment(c, appName, branch, pushEvent.HeadCommit.ID, pushEvent.HeadCommit.Message,
+			pusher, author, "Failed to load the push filter")
+	}
+	if !pushFilter.IsEmpty() {
+		accessToken := ""
+		if connection, err := api.GitHub.GetGitHubRepositoryConnectionByAppName(c.Context(), connectedApp); err == nil {
+			accessToken, _ = api.GitHub.GetUserGitHubAccessToken(c.Context(), connection.UserID)
+		}
+		filterResult := utils.CheckPushFilter(pushFilter, accessToken, pusher, author)
+		if !filterResult.Allowed {
+			return skipWebhookDeployment(c, appName, branch, pushEvent.HeadCommit.ID, pushEvent.HeadCommit.Message,
+				pusher, author, filterResult.Reason)
+		}
+		log.Printf("[WEBHOOK] Push filter of %s: %s", connectedApp, filterResult.Reason)
+	}
 	
+	// Pushes to production apps wait for an admin, fail closed when the flag can't be read
+	production, err := api.Apps.IsProductionApp(c.Context(), appName)
+	if err != nil {
+		log.Printf("[WEBHOOK] ⚠️ Failed to load production flag of %s, requiring approval: %v", appName, err)
+		production = true
+	}
+	if production {
+		gitURL := fmt.Sprintf("https://github.com/%s.git", pushEvent.Repository.FullName)
+		deployActivity, activityErr := database.LogWebhookDeployment(appName, gitURL, branch, pushEvent.HeadCommit.ID,
+			pushEvent.HeadCommit.Message, pushEvent.HeadCommit.Author.Name)
+		if activityErr != nil {
+			log.Printf("[WEBHOOK] ⚠️ Failed to log webhook deployment activity: %v", activityErr)
+		}
+		var userID *int
+		if repoConnection, err := api.GitHub.GetGitHubRepositoryConnectionByAppName(c.Context(), connectedApp); err == nil && repoConnection.UserID != 0 {
+			uid := repoConnection.UserID
+			userID = &uid
+		}
+
+		record, err := requestDeploymentApproval(appName, gitURL, branch, commit, match.Tag, deployActivity, userID, database.TriggerWebhook)
+		if err != nil {
+			log.Printf("[WEBHOOK] ❌ Failed to request approval of the deployment of %s: %v", appName, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to request deployment approval",
+			})
+		}
+		return c.JSON(fiber.Map{
+			"status":        "accepted",
+			"event_type":    eventType,
+			"repository":    pushEvent.Repository.FullName,
+			"branch":        branch,
+			"tag":           match.Tag,
+			"commit":        pushEvent.HeadCommit.ID,
+			"app_name":      appName,
+			"pattern":       pattern,
+			"deployment_id": record.ID,
+			"action":        "approval_requested",
+		})
+	}
+
 	log.Printf("[WEBHOOK] 🚀 Triggering deployment for app %s from %s/%s", 
 		appName, pushEvent.Repository.FullName, branch)
 	
@@ -677,7 +802,7 @@ func GitHubWebhookHandler(c *fiber.Ctx) error {
 		
 		// Get the connected user's ID for authentication
 		var userID *int
-		repoConnection, err := api.GitHub.GetGitHubRepositoryConnectionByAppName(context.Background(), appName)
+		repoConnection, err := api.GitHub.GetGitHubRepositoryConnectionByAppName(context.Background(), connectedApp)
 		if err == nil && repoConnection.UserID != 0 {
 			uid := repoConnection.UserID
 			userID = &uid
@@ -686,18 +811,29 @@ func GitHubWebhookHandler(c *fiber.Ctx) error {
 			log.Printf("[WEBHOOK] ⚠️ No user ID found for webhook authentication: %v", err)
 		}
 		
+		// 🔧 Detect port, reusing the cached result when the push didn't touch config files
+		hint := &utils.PortDetectionHint{
+			CommitSHA:    commit,
+			BaseSHA:      pushEvent.Before,
+			ChangedFiles: []string{},
+		}
+		for _, commit := range pushEvent.Commits {
+			hint.ChangedFiles = append(hint.ChangedFiles, commit.Added...)
+			hint.ChangedFiles = append(hint.ChangedFiles, commit.Removed...)
+			hint.ChangedFiles = append(hint.ChangedFiles, commit.Modified...)
+		}
+		// GitHub caps the commit list of large pushes, so the file list can't be trusted then
+		if len(pushEvent.Commits) == 0 || len(pushEvent.Commits) >= 20 {
+			hint.ChangedFiles = nil
+		}
+		diagnostics := utils.NewDeployDiagnostics()
+		detectAndApplyPort(diagnostics, appName, gitURL, branch, userID, hint, "")
+		
 		// 🚀 Trigger deployment using existing deploy logic (WITH GITHUB TOKEN)
-		output, err := utils.DeployFromGit(appName, gitURL, branch, userID)
+		_, output, err := runTrackedDeployment(diagnostics, appName, gitURL, branch, commit, match.Tag, deployActivity, userID, database.TriggerWebhook)
 		if err != nil {
 			log.Printf("[WEBHOOK] ❌ Deployment failed for %s: %v", appName, err)
 			
-			// 📝 Update deployment activity as failed
-			if deployActivity != nil {
-				errorMsg := err.Error()
-				database.UpdateActivity(deployActivity.ID, database.StatusError, &errorMsg)
-			}
-			
-			
 			// Update GitHub deployment status as failed
 			errorOutput := err.Error()
 			database.UpdateGitHubDeploymentStatus(appName, pushEvent.HeadCommit.ID, "failed", &output, &errorOutput)
@@ -705,11 +841,6 @@ func GitHubWebhookHandler(c *fiber.Ctx) error {
 			log.Printf("[WEBHOOK] ✅ Deployment completed for %s", appName)
 			log.Printf("[WEBHOOK] Deploy output: %s", output)
 			
-			// 📝 Update deployment activity as successful
-			if deployActivity != nil {
-				database.UpdateActivity(deployActivity.ID, database.StatusSuccess, nil)
-			}
-			
 			// Update GitHub deployment status as successful
 			database.UpdateGitHubDeploymentStatus(appName, pushEvent.HeadCommit.ID, "success", &output, nil)
 			
@@ -723,8 +854,10 @@ func GitHubWebhookHandler(c *fiber.Ctx) error {
 		"event_type": eventType,
 		"repository": pushEvent.Repository.FullName,
 		"branch":     branch,
+		"tag":        match.Tag,
 		"commit":     pushEvent.HeadCommit.ID,
 		"app_name":   appName,
+		"pattern":    pattern,
 		"action":     "deployment_triggered",
 	})
 }
@@ -798,6 +931,21 @@ func GetGitHubStatus(c *fiber.Ctx) error {
 	githubUsername := user.GitHubUsername
 	githubID := user.GitHubID
 	
+	// Remaining API quota for the user's token (last observed, or fetched from /rate_limit)
+	var rateLimit *utils.GitHubRateLimit
+	if githubConnected {
+		if accessToken, err := api.GitHub.GetUserGitHubAccessToken(c.Context(), userID.(int)); err == nil && accessToken != "" {
+			rateLimit = utils.GetGitHubRateLimit(accessToken)
+			if rateLimit == nil {
+				if fetched, err := utils.FetchGitHubRateLimit(accessToken); err == nil {
+					rateLimit = fetched
+				} else {
+					log.Printf("[GITHUB] Failed to fetch rate limit: %v", err)
+				}
+			}
+		}
+	}
+	
 	return c.JSON(utils.NewCitizenResponse(
 		true,
 		"GitHub status fetched successfully",
@@ -806,6 +954,8 @@ func GetGitHubStatus(c *fiber.Ctx) error {
 			"github_connected":  githubConnected,
 			"github_username":   githubUsername,
 			"github_id":         githubID,
+			"rate_limit":        rateLimit,
+			"api_stats":         utils.GetGitHubClientStats(),
 		},
 	))
 }
@@ -814,7 +964,8 @@ func GetGitHubStatus(c *fiber.Ctx) error {
 type GitHubConfigRequest struct {
 	ClientID     string `json:"client_id" validate:"required"`
 	ClientSecret string `json:"client_secret" validate:"required"`
-	RedirectURI  string `json:"redirect_uri" validate:"required"`
+	RedirectURI  string   `json:"redirect_uri" validate:"required"`
+	RedirectURIs []string `json:"redirect_uris"` // additional hostnames the instance is reachable under
 }
 
 // GitHubConfigResponse represents GitHub config response (without secrets)
@@ -841,11 +992,18 @@ func SetupGitHubConfig(c *fiber.Ctx) error {
 		})
 	}
 
+	redirectURIs := utils.NormalizeGitHubRedirectURIs(req.RedirectURI, req.RedirectURIs)
+	if err := utils.ValidateGitHubRedirectURIs(redirectURIs); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	// Generate webhook secret
 	webhookSecret := generateSecureSecret()
 	
 	// Save to database (encrypted)
-	err := saveGitHubConfigToDB(req.ClientID, req.ClientSecret, req.RedirectURI, webhookSecret)
+	err := saveGitHubConfigToDB(req.ClientID, req.ClientSecret, req.RedirectURI, redirectURIs, webhookSecret)
 	if err != nil {
 		log.Printf("[GITHUB] Failed to save GitHub config to database: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -861,6 +1019,7 @@ func SetupGitHubConfig(c *fiber.Ctx) error {
 			"error": "Failed to setup GitHub OAuth",
 		})
 	}
+	utils.SetGitHubRedirectURIs(redirectURIs)
 
 	log.Printf("[GITHUB] ✅ GitHub OAuth setup completed")
 	return c.JSON(fiber.Map{
@@ -913,6 +1072,7 @@ func GetGitHubConfig(c *fiber.Ctx) error {
 		"configured":   true,
 		"client_id":    maskedClientID,
 		"redirect_uri": config.RedirectURI,
+		"redirect_uris": utils.NormalizeGitHubRedirectURIs(config.RedirectURI, config.RedirectURIs),
 		"is_active":    true,
 		"configured_at": config.CreatedAt.Format(time.RFC3339),
 	}
@@ -949,7 +1109,7 @@ func generateSecureSecret() string {
 }
 
 // saveGitHubConfigToDB saves GitHub configuration to database (encrypted)
-func saveGitHubConfigToDB(clientID, clientSecret, redirectURI, webhookSecret string) error {
+func saveGitHubConfigToDB(clientID, clientSecret, redirectURI string, redirectURIs []string, webhookSecret string) error {
 	// Encrypt sensitive data
 	encryptedClientID, err := utils.EncryptString(clientID)
 	if err != nil {
@@ -967,7 +1127,7 @@ func saveGitHubConfigToDB(clientID, clientSecret, redirectURI, webhookSecret str
 	}
 	
 	// Save to database - first deactivate old configs, then insert new
-	err = api.GitHub.SaveGitHubConfig(context.Background(), encryptedClientID, encryptedClientSecret, encryptedWebhookSecret, redirectURI)
+	err = api.GitHub.SaveGitHubConfig(context.Background(), encryptedClientID, encryptedClientSecret, encryptedWebhookSecret, redirectURI, redirectURIs)
 	if err != nil {
 		return fmt.Errorf("failed to save GitHub config to database: %w", err)
 	}
@@ -977,28 +1137,28 @@ func saveGitHubConfigToDB(clientID, clientSecret, redirectURI, webhookSecret str
 }
 
 // LoadGitHubConfigFromDB loads GitHub configuration from database (decrypted)
-func LoadGitHubConfigFromDB() (clientID, clientSecret, redirectURI, webhookSecret string, err error) {
+func LoadGitHubConfigFromDB() (clientID, clientSecret, redirectURI, webhookSecret string, redirectURIs []string, err error) {
 	config, err := api.GitHub.GetGitHubConfigFull(context.Background())
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("failed to load GitHub config from database: %w", err)
+		return "", "", "", "", nil, fmt.Errorf("failed to load GitHub config from database: %w", err)
 	}
 	
 	// Decrypt sensitive data
 	clientID, err = utils.DecryptString(config.ClientID)
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("failed to decrypt client ID: %w", err)
+		return "", "", "", "", nil, fmt.Errorf("failed to decrypt client ID: %w", err)
 	}
 	
 	clientSecret, err = utils.DecryptString(config.ClientSecret)
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("failed to decrypt client secret: %w", err)
+		return "", "", "", "", nil, fmt.Errorf("failed to decrypt client secret: %w", err)
 	}
 	
 	webhookSecret, err = utils.DecryptString(config.WebhookSecret)
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("failed to decrypt webhook secret: %w", err)
+		return "", "", "", "", nil, fmt.Errorf("failed to decrypt webhook secret: %w", err)
 	}
 	
 	fmt.Printf("[CONFIG] ✅ GitHub config loaded from database\n")
-	return clientID, clientSecret, config.RedirectURI, webhookSecret, nil
+	return clientID, clientSecret, config.RedirectURI, webhookSecret, config.RedirectURIs, nil
 }
\ No newline at end of file
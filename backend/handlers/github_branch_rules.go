@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BranchRulesRequest replaces the branch rules of a connected app, evaluated in the order given
+type BranchRulesRequest struct {
+	Strict bool `json:"strict"`
+	Rules  []struct {
+		Pattern     string `json:"pattern"`
+		PatternType string `json:"pattern_type"`
+		TargetApp   string `json:"target_app"`
+	} `json:"rules"`
+}
+
+// DeployPolicyRequest sets whether branch pushes or pushed tags auto deploy a connected app
+type DeployPolicyRequest struct {
+	DeployTrigger string `json:"deploy_trigger"`
+	TagPattern    string `json:"tag_pattern"`
+}
+
+// branchRulesFromParams loads the branch rules of the connected app of the request
+func branchRulesFromParams(c *fiber.Ctx) (*api.BranchRules, error) {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	set, err := api.GitHub.GetBranchRules(c.Context(), appName)
+	if errors.Is(err, api.ErrRepositoryNotConnected) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("No repository connected to %s", appName),
+			nil,
+		))
+	}
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve branch rules: "+err.Error(),
+			nil,
+		))
+	}
+	return set, nil
+}
+
+// GetBranchRules lists the branch rules of a connected app and whether they are strict
+func GetBranchRules(c *fiber.Ctx) error {
+	set, err := branchRulesFromParams(c)
+	if set == nil {
+		return err
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Branch rules retrieved successfully",
+		set,
+	))
+}
+
+// SetBranchRules replaces the branch rules of a connected app. In strict mode pushes to branches
+// no rule matches deploy nothing, otherwise the deploy branch still deploys the connected app.
+func SetBranchRules(c *fiber.Ctx) error {
+	set, err := branchRulesFromParams(c)
+	if set == nil {
+		return err
+	}
+
+	var req BranchRulesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	rules := make([]api.BranchRule, 0, len(req.Rules))
+	for _, rule := range req.Rules {
+		rules = append(rules, api.BranchRule{Pattern: rule.Pattern, PatternType: rule.PatternType, TargetApp: rule.TargetApp})
+	}
+	if err := utils.ValidateBranchRules(rules); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	if req.Strict && len(rules) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Strict mode needs at least one branch rule, otherwise no push would deploy",
+			nil,
+		))
+	}
+
+	err = api.GitHub.ReplaceBranchRules(c.Context(), set.AppName, req.Strict, rules)
+	auditSystemAction(c, "github.branch_rules.update", set.AppName, map[string]interface{}{
+		"strict": req.Strict,
+		"rules":  len(rules),
+	}, err)
+	if err != nil {
+		log.Printf("[GITHUB] Failed to save branch rules of %s: %v", set.AppName, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save branch rules: "+err.Error(),
+			nil,
+		))
+	}
+
+	saved, err := api.GitHub.GetBranchRules(c.Context(), set.AppName)
+	if err != nil {
+		set.Strict, set.Rules = req.Strict, rules
+		saved = set
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Branch rules saved successfully",
+		saved,
+	))
+}
+
+// MatchBranchRule tells what a push to the ref of the query (refs/heads/release/1.2, release/1.2
+// or refs/tags/v1.2.0) would deploy, without deploying anything
+func MatchBranchRule(c *fiber.Ctx) error {
+	set, err := branchRulesFromParams(c)
+	if set == nil {
+		return err
+	}
+
+	ref := c.Query("ref")
+	if ref == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"ref is required",
+			nil,
+		))
+	}
+
+	match := utils.MatchBranchRules(set, ref)
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		match.Reason,
+		match,
+	))
+}
+
+// SetDeployPolicy switches a connected app between deploying on branch pushes and deploying on
+// pushed tags matching a pattern, like v*. Branch rules only apply to branch pushes.
+func SetDeployPolicy(c *fiber.Ctx) error {
+	set, err := branchRulesFromParams(c)
+	if set == nil {
+		return err
+	}
+
+	var req DeployPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	req.TagPattern = strings.TrimSpace(req.TagPattern)
+	if req.DeployTrigger != utils.DeployTriggerTag {
+		req.TagPattern = ""
+	}
+	if err := utils.ValidateDeployPolicy(req.DeployTrigger, req.TagPattern); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	err = api.GitHub.SetDeployPolicy(c.Context(), set.AppName, req.DeployTrigger, req.TagPattern)
+	auditSystemAction(c, "github.deploy_policy.update", set.AppName, map[string]interface{}{
+		"deploy_trigger": req.DeployTrigger,
+		"tag_pattern":    req.TagPattern,
+	}, err)
+	if err != nil {
+		log.Printf("[GITHUB] Failed to save deploy policy of %s: %v", set.AppName, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save deploy policy: "+err.Error(),
+			nil,
+		))
+	}
+	set.DeployTrigger, set.TagPattern = req.DeployTrigger, req.TagPattern
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Deploy policy saved successfully",
+		set,
+	))
+}
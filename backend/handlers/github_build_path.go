@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetBuildPath returns the subdirectory of its repository a connected app builds from, "" for
+// the repository root
+func GetBuildPath(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	buildPath, err := api.GitHub.GetBuildPath(c.Context(), appName)
+	if errors.Is(err, api.ErrRepositoryNotConnected) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("No repository connected to %s", appName),
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve build path: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Build path retrieved successfully",
+		fiber.Map{"app_name": appName, "build_path": buildPath},
+	))
+}
+
+// SetBuildPath sets the subdirectory of its repository a connected app builds from, like apps/api
+// in a monorepo, back to the repository root when empty. It is applied to the host right away and
+// again before every deploy.
+func SetBuildPath(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		BuildPath string `json:"build_path"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	req.BuildPath = strings.Trim(strings.TrimSpace(req.BuildPath), "/")
+	if err := utils.ValidateBuildPath(req.BuildPath); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	if req.BuildPath != "" {
+		if missing, err := capabilityMissing(c, utils.FeatureBuilder); missing {
+			return err
+		}
+	}
+
+	err := api.GitHub.SetBuildPath(c.Context(), appName, req.BuildPath)
+	if errors.Is(err, api.ErrRepositoryNotConnected) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("No repository connected to %s", appName),
+			nil,
+		))
+	}
+	auditSystemAction(c, "github.build_path.update", appName, map[string]interface{}{
+		"build_path": req.BuildPath,
+	}, err)
+	if err != nil {
+		log.Printf("[GITHUB] Failed to save build path of %s: %v", appName, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save build path: "+err.Error(),
+			nil,
+		))
+	}
+
+	data := fiber.Map{"app_name": appName, "build_path": req.BuildPath}
+	if err := utils.SyncBuildPath(c.UserContext(), appName); err != nil {
+		data["warning"] = fmt.Sprintf("%v, it is retried on the next deploy", err)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Build path saved, it applies from the next build",
+		data,
+	))
+}
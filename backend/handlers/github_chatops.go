@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// chatOpsPrefix starts every comment command, e.g. "/citizen deploy staging"
+const chatOpsPrefix = "/citizen"
+
+const chatOpsHelp = "Available commands:\n" +
+	"- `/citizen deploy [app]` deploys the pull request head, or the deploy branch on issues\n" +
+	"- `/citizen rollback [app]` redeploys the previous successful commit\n" +
+	"- `/citizen status [app]` shows the latest deployment\n" +
+	"- `/citizen help` shows this message\n\n" +
+	"`[app]` is only needed when the repository is connected to several apps."
+
+// issueCommentEvent is the part of GitHub's issue_comment payload used for commands
+type issueCommentEvent struct {
+	Action string `json:"action"`
+	Issue  struct {
+		Number      int       `json:"number"`
+		PullRequest *struct{} `json:"pull_request"`
+	} `json:"issue"`
+	Comment struct {
+		Body string `json:"body"`
+		User struct {
+			ID    int64  `json:"id"`
+			Login string `json:"login"`
+			Type  string `json:"type"`
+		} `json:"user"`
+	} `json:"comment"`
+	Repository struct {
+		ID       int64  `json:"id"`
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// chatOpsCommand is a parsed comment command
+type chatOpsCommand struct {
+	Name string
+	App  string
+}
+
+// parseChatOpsCommand reads the command from the first line of a comment
+func parseChatOpsCommand(body string) (*chatOpsCommand, bool) {
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(body), "\n", 2)[0])
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != chatOpsPrefix {
+		return nil, false
+	}
+
+	command := &chatOpsCommand{Name: "help"}
+	if len(fields) > 1 {
+		command.Name = strings.ToLower(fields[1])
+	}
+	if len(fields) > 2 {
+		command.App = fields[2]
+	}
+	return command, true
+}
+
+// handleIssueCommentEvent runs /citizen commands posted on pull requests and issues
+func handleIssueCommentEvent(c *fiber.Ctx) error {
+	var event issueCommentEvent
+	if err := c.BodyParser(&event); err != nil {
+		log.Printf("[CHATOPS] Failed to parse issue_comment event: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid payload",
+		})
+	}
+
+	if event.Action != "created" || event.Comment.User.Type == "Bot" {
+		return c.JSON(fiber.Map{
+			"status": "ignored",
+			"reason": "Not a new comment from a user",
+		})
+	}
+
+	command, ok := parseChatOpsCommand(event.Comment.Body)
+	if !ok {
+		return c.JSON(fiber.Map{
+			"status": "ignored",
+			"reason": "Comment is not a command",
+		})
+	}
+
+	repositories, err := api.GitHub.ListGitHubRepositoriesByID(c.Context(), event.Repository.ID)
+	if err != nil || len(repositories) == 0 {
+		log.Printf("[CHATOPS] No repository connection found for %s (ID: %d): %v",
+			event.Repository.FullName, event.Repository.ID, err)
+		return c.JSON(fiber.Map{
+			"status": "ignored",
+			"reason": "Repository not connected",
+		})
+	}
+
+	log.Printf("[CHATOPS] %s ran '%s' on %s#%d",
+		event.Comment.User.Login, command.Name, event.Repository.FullName, event.Issue.Number)
+
+	go runChatOpsCommand(event, command, repositories)
+
+	return c.JSON(fiber.Map{
+		"status":     "accepted",
+		"event_type": "issue_comment",
+		"repository": event.Repository.FullName,
+		"command":    command.Name,
+	})
+}
+
+// runChatOpsCommand executes a command and replies to the thread with the result
+func runChatOpsCommand(event issueCommentEvent, command *chatOpsCommand, repositories []api.GitHubRepository) {
+	ctx := context.Background()
+	reply := func(appName, message string) {
+		replyToChatOps(event, repositories, appName, message)
+	}
+
+	if command.Name == "help" {
+		reply("", chatOpsHelp)
+		return
+	}
+
+	repository, message := resolveChatOpsApp(repositories, command.App)
+	if repository == nil {
+		reply("", message)
+		return
+	}
+	appName := repository.AppName
+
+	connection, err := api.GitHub.GetGitHubRepositoryConnectionByAppName(ctx, appName)
+	if err != nil {
+		log.Printf("[CHATOPS] ⚠️ Failed to load connection of %s: %v", appName, err)
+		return
+	}
+
+	// GitHub users act with the permissions of the Citizen account linked to them
+	userID, err := api.GitHub.GetUserIDByGitHubID(ctx, event.Comment.User.ID)
+	if err != nil {
+		reply(appName, fmt.Sprintf("@%s your GitHub account is not linked to a Citizen user.", event.Comment.User.Login))
+		return
+	}
+	if !canRunChatOps(ctx, userID, connection) {
+		reply(appName, fmt.Sprintf("@%s you are not allowed to manage `%s`.", event.Comment.User.Login, appName))
+		return
+	}
+
+	switch command.Name {
+	case "deploy":
+		reply(appName, chatOpsDeploy(event, repository, connection, userID))
+	case "rollback":
+		reply(appName, chatOpsRollback(event, repository, userID))
+	case "status":
+		reply(appName, chatOpsStatus(appName))
+	default:
+		reply(appName, fmt.Sprintf("Unknown command `%s`.\n\n%s", command.Name, chatOpsHelp))
+	}
+}
+
+// resolveChatOpsApp picks the app a command targets, or explains why it can't
+func resolveChatOpsApp(repositories []api.GitHubRepository, appName string) (*api.GitHubRepository, string) {
+	if appName != "" {
+		for i := range repositories {
+			if repositories[i].AppName == appName {
+				return &repositories[i], ""
+			}
+		}
+		return nil, fmt.Sprintf("App `%s` is not connected to this repository.", appName)
+	}
+
+	if len(repositories) == 1 {
+		return &repositories[0], ""
+	}
+
+	names := make([]string, 0, len(repositories))
+	for _, repository := range repositories {
+		names = append(names, "`"+repository.AppName+"`")
+	}
+	return nil, fmt.Sprintf("This repository is connected to several apps (%s), add the app name to the command.",
+		strings.Join(names, ", "))
+}
+
+// canRunChatOps reports whether a user may run commands for a connected app
+func canRunChatOps(ctx context.Context, userID int, connection *api.GitHubRepositoryConnection) bool {
+	if connection.UserID == userID {
+		return true
+	}
+	isAdmin, err := api.Users.IsUserAdmin(ctx, userID)
+	return err == nil && isAdmin
+}
+
+// chatOpsDeploy deploys the pull request head, or the deploy branch when commented on an issue
+func chatOpsDeploy(event issueCommentEvent, repository *api.GitHubRepository, connection *api.GitHubRepositoryConnection, userID int) string {
+	if err := utils.RequireCapability(utils.FeatureGitSync); err != nil {
+		return err.Error()
+	}
+
+	ref, commit := repository.DeployBranch, ""
+	if event.Issue.PullRequest != nil {
+		accessToken, err := api.GitHub.GetUserGitHubAccessToken(context.Background(), connection.UserID)
+		if err != nil {
+			return "Failed to read the pull request: GitHub token not available."
+		}
+		head, err := utils.GetPullRequestHead(accessToken, event.Repository.FullName, event.Issue.Number)
+		if err != nil {
+			return fmt.Sprintf("Failed to read the pull request: %v", err)
+		}
+		// Code from forks was never reviewed by anyone with access to the app
+		if head.RepoName != event.Repository.FullName {
+			return "Pull requests from forks can't be deployed."
+		}
+		ref, commit = head.SHA, head.SHA
+	}
+
+	return chatOpsRunDeploy(event, repository.AppName, ref, commit, userID, "Deployment")
+}
+
+// chatOpsRollback redeploys the commit of the previous successful deployment
+func chatOpsRollback(event issueCommentEvent, repository *api.GitHubRepository, userID int) string {
+	candidates, err := api.Deployments.ListRollbackCandidates(context.Background(), repository.AppName, 2)
+	if err != nil {
+		return fmt.Sprintf("Failed to load deployment history: %v", err)
+	}
+	if len(candidates) < 2 {
+		return "There is no previous successful deployment to roll back to."
+	}
+
+	target := candidates[1]
+	return chatOpsRunDeploy(event, repository.AppName, target.GitCommit, target.GitCommit, userID, "Rollback")
+}
+
+// chatOpsRunDeploy runs a tracked deployment and describes the outcome
+func chatOpsRunDeploy(event issueCommentEvent, appName, ref, commit string, userID int, label string) string {
+	gitURL := fmt.Sprintf("https://github.com/%s.git", event.Repository.FullName)
+
+	activity, activityErr := database.LogDeployActivity(appName, gitURL, ref, commit,
+		fmt.Sprintf("%s requested by @%s on #%d", label, event.Comment.User.Login, event.Issue.Number),
+		&userID, database.TriggerManual)
+	if activityErr != nil {
+		log.Printf("[CHATOPS] ⚠️ Failed to log deployment activity: %v", activityErr)
+	}
+
+	record, _, err := runTrackedDeployment(nil, appName, gitURL, ref, commit, "", activity, &userID, database.TriggerManual)
+	reference := ""
+	if record != nil {
+		reference = fmt.Sprintf(" (release %s, deployment #%d)", record.ReleaseLabel(), record.ID)
+	}
+	if err != nil {
+		log.Printf("[CHATOPS] ❌ %s of %s failed: %v", label, appName, err)
+		return fmt.Sprintf("❌ %s of `%s` at `%s` failed%s: %v", label, appName, shortRef(ref), reference, err)
+	}
+
+	log.Printf("[CHATOPS] ✅ %s of %s completed", label, appName)
+	return fmt.Sprintf("✅ %s of `%s` at `%s` succeeded%s.", label, appName, shortRef(ref), reference)
+}
+
+// chatOpsStatus describes the latest deployment of an app
+func chatOpsStatus(appName string) string {
+	if running := utils.ListRunningDeployments(appName); len(running) > 0 {
+		return fmt.Sprintf("A deployment of `%s` is in progress (deployment #%d, started %s).",
+			appName, running[0].ID, running[0].StartedAt.Format("2006-01-02 15:04:05 MST"))
+	}
+
+	records, _, err := database.ListDeploymentRecords(appName, 1, 0)
+	if err != nil {
+		return fmt.Sprintf("Failed to load deployment history: %v", err)
+	}
+	if len(records) == 0 {
+		return fmt.Sprintf("`%s` has not been deployed yet.", appName)
+	}
+
+	latest := records[0]
+	ref := latest.GitBranch
+	if latest.GitCommit != "" {
+		ref = latest.GitCommit
+	}
+	return fmt.Sprintf("Latest deployment of `%s`: release %s (#%d) `%s` at `%s` (%s trigger, started %s).",
+		appName, latest.ReleaseLabel(), latest.ID, latest.Status, shortRef(ref), latest.TriggerType,
+		latest.StartedAt.Format("2006-01-02 15:04:05 MST"))
+}
+
+// replyToChatOps posts a comment on the thread using the token of the repository owner
+func replyToChatOps(event issueCommentEvent, repositories []api.GitHubRepository, appName, message string) {
+	if appName == "" {
+		appName = repositories[0].AppName
+	}
+
+	connection, err := api.GitHub.GetGitHubRepositoryConnectionByAppName(context.Background(), appName)
+	if err != nil {
+		log.Printf("[CHATOPS] ⚠️ Can't reply, no connection for %s: %v", appName, err)
+		return
+	}
+	accessToken, err := api.GitHub.GetUserGitHubAccessToken(context.Background(), connection.UserID)
+	if err != nil || accessToken == "" {
+		log.Printf("[CHATOPS] ⚠️ Can't reply, no GitHub token for user %d: %v", connection.UserID, err)
+		return
+	}
+
+	if err := utils.CreateIssueComment(accessToken, event.Repository.FullName, event.Issue.Number, message); err != nil {
+		log.Printf("[CHATOPS] ⚠️ Failed to reply on %s#%d: %v", event.Repository.FullName, event.Issue.Number, err)
+	}
+}
+
+// shortRef shortens commit SHAs for display
+func shortRef(ref string) string {
+	if len(ref) == 40 {
+		return ref[:7]
+	}
+	return ref
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Outcomes of cleaning up a webhook while revoking a GitHub connection
+const (
+	webhookDeleted = "deleted"
+	webhookShared  = "skipped_shared" // another user's connection relies on the same webhook
+	webhookFailed  = "failed"
+)
+
+// webhookCleanup is what happened to the webhook of one repository connection
+type webhookCleanup struct {
+	AppName   string `json:"app_name"`
+	FullName  string `json:"full_name"`
+	WebhookID int64  `json:"webhook_id"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// GetGitHubConnectionHealth checks the stored GitHub token of the current user against GitHub
+// and reports the scopes it lacks
+func GetGitHubConnectionHealth(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"User not authenticated",
+			nil,
+		))
+	}
+
+	accessToken, err := api.GitHub.GetUserGitHubAccessToken(c.Context(), userID)
+	if err != nil || accessToken == "" {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"GitHub account not connected",
+			nil,
+		))
+	}
+
+	health, err := utils.CheckGitHubToken(accessToken)
+	if err != nil {
+		log.Printf("[GITHUB] Failed to check token of user %d: %v", userID, err)
+		return c.Status(fiber.StatusBadGateway).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to check the GitHub token: "+err.Error(),
+			nil,
+		))
+	}
+
+	message := "GitHub connection is healthy"
+	switch {
+	case !health.Valid:
+		message = "GitHub token is invalid or was revoked, reconnect GitHub"
+	case len(health.MissingScopes) > 0:
+		message = "GitHub token is missing scopes: " + strings.Join(health.MissingScopes, ", ") + ", reconnect GitHub"
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		message,
+		fiber.Map{
+			"healthy":         health.Valid && len(health.MissingScopes) == 0,
+			"required_scopes": utils.GitHubRequiredScopes,
+			"token":           health,
+		},
+	))
+}
+
+// RevokeGitHubConnection disconnects the GitHub account of the current user: it deletes the
+// webhooks of their repository connections unless another user's connection shares them,
+// revokes the token at GitHub and forgets it. The connections stay, without auto deploy.
+func RevokeGitHubConnection(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"User not authenticated",
+			nil,
+		))
+	}
+
+	accessToken, err := api.GitHub.GetUserGitHubAccessToken(c.Context(), userID)
+	if err != nil || accessToken == "" {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"GitHub account not connected",
+			nil,
+		))
+	}
+
+	// Webhooks are deleted first, they need the token
+	connections, err := api.GitHub.ListUserWebhookConnections(c.Context(), userID)
+	if err != nil {
+		log.Printf("[GITHUB] Failed to list webhooks of user %d: %v", userID, err)
+	}
+	webhooks := []webhookCleanup{}
+	for _, connection := range connections {
+		cleanup := webhookCleanup{
+			AppName:   connection.AppName,
+			FullName:  connection.FullName,
+			WebhookID: connection.WebhookID,
+			Status:    webhookDeleted,
+		}
+		owner, repoName, found := strings.Cut(connection.FullName, "/")
+		switch {
+		case connection.Shared:
+			cleanup.Status = webhookShared
+		case !found:
+			cleanup.Status = webhookFailed
+			cleanup.Error = "invalid repository name"
+		default:
+			if err := utils.DeleteWebhook(accessToken, owner, repoName, connection.WebhookID); err != nil {
+				cleanup.Status = webhookFailed
+				cleanup.Error = err.Error()
+			}
+		}
+		if cleanup.Status == webhookDeleted {
+			if err := api.GitHub.ClearRepositoryWebhook(c.Context(), connection.AppName); err != nil {
+				log.Printf("[GITHUB] Failed to clear webhook of %s: %v", connection.AppName, err)
+			}
+		}
+		webhooks = append(webhooks, cleanup)
+	}
+
+	revokeErr := utils.RevokeGitHubToken(accessToken)
+	if revokeErr != nil {
+		log.Printf("[GITHUB] Failed to revoke token of user %d: %v", userID, revokeErr)
+	}
+
+	if err := api.Users.DisconnectGitHub(c.Context(), userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to disconnect GitHub account: "+err.Error(),
+			fiber.Map{"webhooks": webhooks, "token_revoked": revokeErr == nil},
+		))
+	}
+	log.Printf("[GITHUB] ✅ GitHub account of user %d disconnected", userID)
+
+	data := fiber.Map{
+		"github_connected": false,
+		"token_revoked":    revokeErr == nil,
+		"webhooks":         webhooks,
+	}
+	if revokeErr != nil {
+		data["revoke_error"] = revokeErr.Error()
+		return c.Status(fiber.StatusMultiStatus).JSON(utils.NewCitizenResponse(
+			true,
+			"GitHub account disconnected, but the token could not be revoked at GitHub",
+			data,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"GitHub account disconnected and token revoked",
+		data,
+	))
+}
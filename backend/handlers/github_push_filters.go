@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PushFilterRequest replaces the GitHub users and teams allowed or denied to auto-deploy an app
+type PushFilterRequest struct {
+	AllowedUsers []string `json:"allowed_users"`
+	AllowedTeams []string `json:"allowed_teams"`
+	DeniedUsers  []string `json:"denied_users"`
+	DeniedTeams  []string `json:"denied_teams"`
+}
+
+// pushFilterFromParams loads the push filter of the connected app of the request
+func pushFilterFromParams(c *fiber.Ctx) (*api.PushFilter, error) {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	if _, err := api.GitHub.GetGitHubRepositoryConnectionByAppName(c.Context(), appName); err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("No repository connected to %s", appName),
+			nil,
+		))
+	}
+
+	filter, err := api.GitHub.GetPushFilter(c.Context(), appName)
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve push filter: "+err.Error(),
+			nil,
+		))
+	}
+	return filter, nil
+}
+
+// GetPushFilter returns the GitHub users and teams allowed or denied to auto-deploy a connected app
+func GetPushFilter(c *fiber.Ctx) error {
+	filter, err := pushFilterFromParams(c)
+	if filter == nil {
+		return err
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Push filter retrieved successfully",
+		filter,
+	))
+}
+
+// SetPushFilter replaces the push filter of a connected app. Denied users and teams win over
+// allowed ones; with any user or team allowed, pushes by everyone else are skipped. Empty lists
+// let every push auto-deploy again.
+func SetPushFilter(c *fiber.Ctx) error {
+	filter, err := pushFilterFromParams(c)
+	if filter == nil {
+		return err
+	}
+
+	var req PushFilterRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	filter.AllowedUsers, filter.AllowedTeams = req.AllowedUsers, req.AllowedTeams
+	filter.DeniedUsers, filter.DeniedTeams = req.DeniedUsers, req.DeniedTeams
+	if err := utils.NormalizePushFilter(filter); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	filter.UpdatedBy = nil
+	if uid, ok := c.Locals("user_id").(int); ok {
+		filter.UpdatedBy = &uid
+	}
+
+	err = api.GitHub.SavePushFilter(c.Context(), filter)
+	auditSystemAction(c, "github.push_filter.update", filter.AppName, map[string]interface{}{
+		"allowed_users": filter.AllowedUsers,
+		"allowed_teams": filter.AllowedTeams,
+		"denied_users":  filter.DeniedUsers,
+		"denied_teams":  filter.DeniedTeams,
+	}, err)
+	if err != nil {
+		log.Printf("[GITHUB] Failed to save push filter of %s: %v", filter.AppName, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save push filter: "+err.Error(),
+			nil,
+		))
+	}
+
+	message := "Push filter saved successfully"
+	if len(filter.AllowedTeams) > 0 || len(filter.DeniedTeams) > 0 {
+		message += ", team checks need a GitHub token with the read:org scope"
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		message,
+		filter,
+	))
+}
+
+// skipWebhookDeployment records a push the push filter blocked as a skipped deploy of the app and
+// answers the webhook
+func skipWebhookDeployment(c *fiber.Ctx, appName, branch, commit, commitMessage, pusher, author, reason string) error {
+	log.Printf("[WEBHOOK] Skipping deployment of %s: %s", appName, reason)
+	if _, err := database.LogSkippedWebhookDeployment(appName, branch, commit, commitMessage, pusher, author, reason); err != nil {
+		log.Printf("[WEBHOOK] ⚠️ Failed to log skipped deployment of %s: %v", appName, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":   "skipped",
+		"reason":   reason,
+		"app_name": appName,
+		"pusher":   pusher,
+	})
+}
@@ -196,13 +196,27 @@ func checkSSHHealth() ComponentHealth {
 		}
 	}
 
-	// For now, just return configured status
-	// A more comprehensive check could be implemented later
+	// The circuit breaker tells whether commands currently reach the host
+	breaker := utils.GetSSHBreakerStatus()
+	if breaker.State != utils.SSHBreakerClosed {
+		return ComponentHealth{
+			Status:    "unhealthy",
+			Message:   "SSH circuit breaker open, dokku commands are refused until the host recovers",
+			Error:     breaker.LastError,
+			Details: map[string]interface{}{
+				"ssh_host": sshHost,
+				"breaker":  breaker,
+			},
+			LastCheck: now,
+		}
+	}
+
 	return ComponentHealth{
 		Status:    "configured",
 		Message:   "SSH connection configured",
 		Details: map[string]interface{}{
 			"ssh_host": sshHost,
+			"breaker":  breaker,
 		},
 		LastCheck: now,
 	}
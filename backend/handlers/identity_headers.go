@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// identityCacheTTL is how long identity settings and users are cached, ForwardAuth runs on
+	// every request
+	identityCacheTTL = time.Minute
+	// maxCachedIdentities bounds the users cached, the cache is emptied past it
+	maxCachedIdentities = 1000
+)
+
+// identitySettings caches the identity settings stored for apps, with decrypted token secrets
+var identitySettings = struct {
+	sync.Mutex
+	settings  map[string]api.AppIdentitySetting
+	fetchedAt time.Time
+}{}
+
+// cachedIdentities caches the identity of the users signed in to apps
+var cachedIdentities = struct {
+	sync.Mutex
+	users map[int]cachedIdentity
+}{users: make(map[int]cachedIdentity)}
+
+type cachedIdentity struct {
+	identity  utils.Identity
+	fetchedAt time.Time
+}
+
+// appIdentitySetting returns the identity setting of an app. Settings are loaded on first use and
+// reloaded in the background once stale, requests use the cached ones meanwhile.
+func appIdentitySetting(appName string) api.AppIdentitySetting {
+	identitySettings.Lock()
+	loaded := identitySettings.settings != nil
+	stale := time.Since(identitySettings.fetchedAt) >= identityCacheTTL
+	if stale {
+		// Retried after identityCacheTTL when the database is unavailable
+		identitySettings.fetchedAt = time.Now()
+	}
+	identitySettings.Unlock()
+
+	if !loaded {
+		reloadIdentitySettings()
+	} else if stale {
+		go reloadIdentitySettings()
+	}
+
+	identitySettings.Lock()
+	defer identitySettings.Unlock()
+	if setting, ok := identitySettings.settings[appName]; ok {
+		return setting
+	}
+	return api.AppIdentitySetting{AppName: appName, HeadersEnabled: true}
+}
+
+// reloadIdentitySettings reads the identity settings of all apps and decrypts their token secrets
+func reloadIdentitySettings() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stored, err := api.Settings.ListAppIdentitySettings(ctx)
+	if err != nil {
+		utils.WarnLog("Failed to load identity header settings: %v", err)
+		return
+	}
+
+	settings := make(map[string]api.AppIdentitySetting, len(stored))
+	for _, setting := range stored {
+		if setting.TokenSecret != "" {
+			secret, err := utils.DecryptString(setting.TokenSecret)
+			if err != nil {
+				utils.WarnLog("Failed to decrypt the identity token secret of %s: %v", setting.AppName, err)
+				setting.TokenEnabled = false
+			}
+			setting.TokenSecret = secret
+		}
+		settings[setting.AppName] = setting
+	}
+	identitySettings.Lock()
+	identitySettings.settings = settings
+	identitySettings.fetchedAt = time.Now()
+	identitySettings.Unlock()
+}
+
+// userIdentity returns the identity of a user, cached for identityCacheTTL
+func userIdentity(ctx context.Context, userID int) (utils.Identity, error) {
+	cachedIdentities.Lock()
+	cached, ok := cachedIdentities.users[userID]
+	cachedIdentities.Unlock()
+	if ok && time.Since(cached.fetchedAt) < identityCacheTTL {
+		return cached.identity, nil
+	}
+
+	user, err := api.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		return utils.Identity{}, err
+	}
+	isAdmin, err := api.Users.IsUserAdmin(ctx, userID)
+	if err != nil {
+		return utils.Identity{}, err
+	}
+	identity := utils.Identity{UserID: userID, Username: user.Username, Email: user.Email, Admin: isAdmin}
+
+	cachedIdentities.Lock()
+	if len(cachedIdentities.users) >= maxCachedIdentities {
+		cachedIdentities.users = make(map[int]cachedIdentity)
+	}
+	cachedIdentities.users[userID] = cachedIdentity{identity: identity, fetchedAt: time.Now()}
+	cachedIdentities.Unlock()
+	return identity, nil
+}
+
+// setIdentityHeaders adds the identity of the signed-in user to the ForwardAuth response of an
+// app, unless the app opted out. A missing identity only leaves the headers out, the request is
+// still let in.
+func setIdentityHeaders(c *fiber.Ctx, appName string, userID int) {
+	setting := appIdentitySetting(appName)
+	if !setting.HeadersEnabled && !setting.TokenEnabled {
+		return
+	}
+
+	identity, err := userIdentity(c.UserContext(), userID)
+	if err != nil {
+		utils.WarnLog("Failed to read the identity of user %d for %s: %v", userID, appName, err)
+		return
+	}
+
+	if setting.HeadersEnabled {
+		c.Set(utils.HeaderCitizenUserID, strconv.Itoa(identity.UserID))
+		c.Set(utils.HeaderCitizenUsername, identity.Username)
+		if identity.Email != "" {
+			c.Set(utils.HeaderCitizenEmail, identity.Email)
+		}
+	}
+	if setting.TokenEnabled && setting.TokenSecret != "" {
+		token, err := utils.SignIdentityToken(setting.TokenSecret, appName, identity, time.Now())
+		if err != nil {
+			utils.WarnLog("Failed to sign the identity token of user %d for %s: %v", userID, appName, err)
+			return
+		}
+		c.Set(utils.HeaderCitizenIdentityToken, token)
+	}
+}
+
+// identitySettingResponse describes the identity setting of an app without its secret
+func identitySettingResponse(setting *api.AppIdentitySetting) fiber.Map {
+	return fiber.Map{
+		"app_name":         setting.AppName,
+		"headers_enabled":  setting.HeadersEnabled,
+		"token_enabled":    setting.TokenEnabled,
+		"token_secret_set": setting.TokenSecret != "",
+		"headers": []string{
+			utils.HeaderCitizenUserID, utils.HeaderCitizenUsername, utils.HeaderCitizenEmail,
+			utils.HeaderCitizenServiceAccount,
+		},
+		"token_header": utils.HeaderCitizenIdentityToken,
+	}
+}
+
+// GetIdentityHeaders returns which identity headers ForwardAuth passes to an app
+func GetIdentityHeaders(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	setting, err := api.Settings.GetAppIdentitySetting(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve identity headers setting: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Identity headers setting retrieved successfully",
+		identitySettingResponse(setting),
+	))
+}
+
+// SetIdentityHeaders opts an app out of (or back into) the identity headers, and in or out of the
+// signed identity token. The secret verifying the token is generated when the token is enabled,
+// or replaced with rotate_secret, and only returned then.
+func SetIdentityHeaders(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	setting, err := api.Settings.GetAppIdentitySetting(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve identity headers setting: "+err.Error(),
+			nil,
+		))
+	}
+
+	var req struct {
+		HeadersEnabled *bool `json:"headers_enabled"`
+		TokenEnabled   *bool `json:"token_enabled"`
+		RotateSecret   bool  `json:"rotate_secret"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if req.HeadersEnabled != nil {
+		setting.HeadersEnabled = *req.HeadersEnabled
+	}
+	if req.TokenEnabled != nil {
+		setting.TokenEnabled = *req.TokenEnabled
+	}
+
+	var secret string
+	if setting.TokenEnabled && (setting.TokenSecret == "" || req.RotateSecret) {
+		if secret, err = utils.GenerateIdentitySecret(); err == nil {
+			setting.TokenSecret, err = utils.EncryptString(secret)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+				false,
+				"Failed to generate identity token secret: "+err.Error(),
+				nil,
+			))
+		}
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	message := fmt.Sprintf("Identity headers %s, identity token %s", enabledLabel(setting.HeadersEnabled), enabledLabel(setting.TokenEnabled))
+	if secret != "" && req.RotateSecret {
+		message += ", secret rotated"
+	}
+	activity, activityErr := database.LogConfigActivity(appName, "identity_headers", message, userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log identity headers activity: %v\n", activityErr)
+	}
+
+	err = api.Settings.SetAppIdentitySetting(c.Context(), setting, userID)
+	if activity != nil {
+		var errorMsg *string
+		status := database.StatusSuccess
+		if err != nil {
+			text := err.Error()
+			errorMsg = &text
+			status = database.StatusError
+		}
+		database.UpdateActivity(activity.ID, status, errorMsg)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to update identity headers setting: "+err.Error(),
+			nil,
+		))
+	}
+	reloadIdentitySettings()
+
+	data := identitySettingResponse(setting)
+	if secret != "" {
+		data["token_secret"] = secret
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Identity headers setting updated",
+		data,
+	))
+}
+
+// enabledLabel describes a setting being on or off
+func enabledLabel(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetImageCleanup returns the image cleanup config, the report of the last cleanup and a preview
+// of what a cleanup would remove now, with the reclaimable space before and after it
+func GetImageCleanup(c *fiber.Ctx) error {
+	data := fiber.Map{
+		"config":      utils.GetImageCleanupConfig(c.Context()),
+		"last_report": utils.LastImageCleanupReport(),
+	}
+	preview, err := utils.RunImageCleanup(c.UserContext(), true)
+	if err != nil {
+		data["preview_error"] = err.Error()
+	} else {
+		data["preview"] = preview
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Image cleanup retrieved successfully",
+		data,
+	))
+}
+
+// SetImageCleanupConfig changes how many releases of each app keep their image
+func SetImageCleanupConfig(c *fiber.Ctx) error {
+	var config utils.ImageCleanupConfig
+	if err := c.BodyParser(&config); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	if err := config.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	err := utils.SaveImageCleanupConfig(c.Context(), &config)
+	auditSystemAction(c, "image_cleanup_set", utils.ImageCleanupSettingKey, map[string]interface{}{
+		"keep_releases": config.KeepReleases,
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save image cleanup config: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Image cleanup config updated",
+		config,
+	))
+}
+
+// RunImageCleanup removes the unused images of old releases now instead of waiting for the
+// scheduled cleanup, or only reports what it would remove with ?dry_run=true
+func RunImageCleanup(c *fiber.Ctx) error {
+	dryRun := c.QueryBool("dry_run")
+	report, err := utils.RunImageCleanup(c.UserContext(), dryRun)
+	if !dryRun {
+		details := map[string]interface{}{}
+		if report != nil {
+			details["images_removed"] = report.ImagesRemoved
+			details["reclaimed"] = report.Reclaimed
+		}
+		auditSystemAction(c, "image_cleanup_run", utils.ImageCleanupSettingKey, details, err)
+	}
+	if errors.Is(err, utils.ErrImageCleanupRunning) {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			"An image cleanup is already running",
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Image cleanup failed: "+err.Error(),
+			nil,
+		))
+	}
+
+	message := "Image cleanup completed"
+	if dryRun {
+		message = "Image cleanup previewed"
+	}
+	return c.JSON(utils.NewCitizenResponse(true, message, report))
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultLogAlertCooldown is the cooldown of rules created without one
+const defaultLogAlertCooldown = 5 * time.Minute
+
+// LogAlertRuleRequest creates a log alert rule or, with only some fields set, updates one
+type LogAlertRuleRequest struct {
+	Name            *string `json:"name"`
+	Pattern         *string `json:"pattern"`
+	IsRegex         *bool   `json:"is_regex"`
+	ProcessType     *string `json:"process_type"`
+	ChannelType     *string `json:"channel_type"`
+	ChannelURL      *string `json:"channel_url"`
+	CooldownSeconds *int    `json:"cooldown_seconds"`
+	Enabled         *bool   `json:"enabled"`
+}
+
+// apply sets the fields present in the request on a rule and validates the result. A new channel
+// URL is encrypted; changing the channel type requires a new URL.
+func (r *LogAlertRuleRequest) apply(rule *api.LogAlertRule) error {
+	if r.Name != nil {
+		rule.Name = strings.TrimSpace(*r.Name)
+	}
+	if r.Pattern != nil {
+		rule.Pattern = *r.Pattern
+	}
+	if r.IsRegex != nil {
+		rule.IsRegex = *r.IsRegex
+	}
+	if r.ProcessType != nil {
+		rule.ProcessType = *r.ProcessType
+	}
+	if r.CooldownSeconds != nil {
+		rule.CooldownSeconds = *r.CooldownSeconds
+	}
+	if r.Enabled != nil {
+		rule.Enabled = *r.Enabled
+	}
+
+	if rule.Name == "" || len(rule.Name) > 100 {
+		return fmt.Errorf("name must be between 1 and 100 characters")
+	}
+	if _, err := utils.CompileLogAlertPattern(rule.Pattern, rule.IsRegex); err != nil {
+		return err
+	}
+	if rule.ProcessType != "" && !utils.IsValidProcessType(rule.ProcessType) {
+		return fmt.Errorf("invalid process type: %s", rule.ProcessType)
+	}
+	if time.Duration(rule.CooldownSeconds)*time.Second < utils.MinLogAlertCooldown {
+		return fmt.Errorf("cooldown_seconds must be at least %d", int(utils.MinLogAlertCooldown.Seconds()))
+	}
+
+	if r.ChannelType == nil && r.ChannelURL == nil {
+		return nil
+	}
+	if r.ChannelType != nil {
+		rule.ChannelType = *r.ChannelType
+	}
+	channelURL := ""
+	if r.ChannelURL != nil {
+		channelURL = *r.ChannelURL
+	}
+	if err := utils.ValidateLogAlertChannel(rule.ChannelType, channelURL); err != nil {
+		return err
+	}
+	rule.ChannelURL = ""
+	if channelURL != "" {
+		encrypted, err := utils.EncryptString(channelURL)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt channel URL: %w", err)
+		}
+		rule.ChannelURL = encrypted
+	}
+	return nil
+}
+
+// ListLogAlertRules lists the log alert rules of an app
+func ListLogAlertRules(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	rules, err := api.LogAlerts.ListLogAlertRules(context.Background(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve log alert rules: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Log alert rules retrieved successfully",
+		rules,
+	))
+}
+
+// CreateLogAlertRule adds a log alert rule to an app
+func CreateLogAlertRule(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req LogAlertRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	rule := &api.LogAlertRule{
+		AppName:         appName,
+		CooldownSeconds: int(defaultLogAlertCooldown.Seconds()),
+		Enabled:         true,
+	}
+	if uid, ok := c.Locals("user_id").(int); ok {
+		rule.CreatedBy = &uid
+	}
+	if err := req.apply(rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+	}
+
+	if err := api.LogAlerts.CreateLogAlertRule(context.Background(), rule); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to create log alert rule: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(utils.NewCitizenResponse(
+		true,
+		"Log alert rule created successfully",
+		rule,
+	))
+}
+
+// UpdateLogAlertRule changes the fields of a log alert rule present in the request
+func UpdateLogAlertRule(c *fiber.Ctx) error {
+	rule, err := logAlertRuleFromParams(c)
+	if rule == nil {
+		return err
+	}
+
+	var req LogAlertRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if err := req.apply(rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+	}
+
+	if err := api.LogAlerts.UpdateLogAlertRule(context.Background(), rule); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to update log alert rule: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Log alert rule updated successfully",
+		rule,
+	))
+}
+
+// DeleteLogAlertRule removes a log alert rule from an app
+func DeleteLogAlertRule(c *fiber.Ctx) error {
+	rule, err := logAlertRuleFromParams(c)
+	if rule == nil {
+		return err
+	}
+
+	if err := api.LogAlerts.DeleteLogAlertRule(context.Background(), rule.AppName, rule.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to delete log alert rule: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Log alert rule deleted successfully",
+		fiber.Map{"id": rule.ID},
+	))
+}
+
+// TestLogAlertRule matches a pattern against the recent logs of an app without alerting
+func TestLogAlertRule(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		Pattern     string `json:"pattern"`
+		IsRegex     bool   `json:"is_regex"`
+		ProcessType string `json:"process_type"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	pattern, err := utils.CompileLogAlertPattern(req.Pattern, req.IsRegex)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+	}
+
+	logs, err := utils.GetAllProcessLogs(appName, 500)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to get logs: "+err.Error(),
+			nil,
+		))
+	}
+
+	rule := api.LogAlertRule{AppName: appName, ProcessType: req.ProcessType}
+	lines, matches := utils.MatchLogAlertRule(rule, pattern, strings.Split(logs, "\n"))
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		fmt.Sprintf("Pattern matched %d of the recent log lines", matches),
+		fiber.Map{"matches": matches, "lines": lines},
+	))
+}
+
+// logAlertRuleFromParams loads the rule named by the route, writing an error response when it can't.
+// When the rule is nil the handler must return the accompanying error (the result of the write).
+func logAlertRuleFromParams(c *fiber.Ctx) (*api.LogAlertRule, error) {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	ruleID, err := strconv.Atoi(c.Params("id"))
+	if err != nil || ruleID <= 0 {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid log alert rule ID",
+			nil,
+		))
+	}
+
+	rule, err := api.LogAlerts.GetLogAlertRule(context.Background(), appName, ruleID)
+	if errors.Is(err, api.ErrLogAlertRuleNotFound) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Log alert rule not found",
+			nil,
+		))
+	}
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve log alert rule: "+err.Error(),
+			nil,
+		))
+	}
+	return rule, nil
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LogSinkRequest creates a log sink or, with only some fields set, updates one
+type LogSinkRequest struct {
+	Name        *string `json:"name"`
+	SinkType    *string `json:"sink_type"`
+	URL         *string `json:"url"`
+	AuthHeader  *string `json:"auth_header"`
+	ProcessType *string `json:"process_type"`
+	Enabled     *bool   `json:"enabled"`
+}
+
+// apply sets the fields present in the request on a sink and validates the result. The URL and
+// auth header are encrypted; changing the sink type requires a new URL.
+func (r *LogSinkRequest) apply(sink *api.LogSink) error {
+	if r.Name != nil {
+		sink.Name = strings.TrimSpace(*r.Name)
+	}
+	if r.ProcessType != nil {
+		sink.ProcessType = *r.ProcessType
+	}
+	if r.Enabled != nil {
+		sink.Enabled = *r.Enabled
+	}
+
+	if sink.Name == "" || len(sink.Name) > 100 {
+		return fmt.Errorf("name must be between 1 and 100 characters")
+	}
+	if sink.ProcessType != "" && !utils.IsValidProcessType(sink.ProcessType) {
+		return fmt.Errorf("invalid process type: %s", sink.ProcessType)
+	}
+
+	if r.AuthHeader != nil {
+		sink.AuthHeader = ""
+		if *r.AuthHeader != "" {
+			encrypted, err := utils.EncryptString(*r.AuthHeader)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt auth header: %w", err)
+			}
+			sink.AuthHeader = encrypted
+		}
+	}
+
+	if r.SinkType == nil && r.URL == nil {
+		return nil
+	}
+	if r.SinkType != nil {
+		sink.SinkType = *r.SinkType
+	}
+	sinkURL := ""
+	if r.URL != nil {
+		sinkURL = *r.URL
+	}
+	if err := utils.ValidateLogSink(sink.SinkType, sinkURL); err != nil {
+		return err
+	}
+	encrypted, err := utils.EncryptString(sinkURL)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt sink URL: %w", err)
+	}
+	sink.URL = encrypted
+	return nil
+}
+
+// ListLogSinks lists the log sinks of an app with their forwarding counters
+func ListLogSinks(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	sinks, err := api.LogAlerts.ListLogSinks(context.Background(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve log sinks: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Log sinks retrieved successfully",
+		sinks,
+	))
+}
+
+// CreateLogSink adds a log sink to an app. New log lines are forwarded to it from the next
+// ingestion run.
+func CreateLogSink(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req LogSinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if req.SinkType == nil || req.URL == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"sink_type and url are required",
+			nil,
+		))
+	}
+
+	sink := &api.LogSink{AppName: appName, Enabled: true}
+	if uid, ok := c.Locals("user_id").(int); ok {
+		sink.CreatedBy = &uid
+	}
+	if err := req.apply(sink); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+	}
+
+	if err := api.LogAlerts.CreateLogSink(context.Background(), sink); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to create log sink: "+err.Error(),
+			nil,
+		))
+	}
+	auditSystemAction(c, "log_sink_create", appName, map[string]interface{}{"sink_id": sink.ID, "sink_type": sink.SinkType}, nil)
+
+	return c.Status(fiber.StatusCreated).JSON(utils.NewCitizenResponse(
+		true,
+		"Log sink created successfully",
+		sink,
+	))
+}
+
+// UpdateLogSink changes the fields of a log sink present in the request
+func UpdateLogSink(c *fiber.Ctx) error {
+	sink, err := logSinkFromParams(c)
+	if sink == nil {
+		return err
+	}
+
+	var req LogSinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if err := req.apply(sink); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+	}
+
+	if err := api.LogAlerts.UpdateLogSink(context.Background(), sink); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to update log sink: "+err.Error(),
+			nil,
+		))
+	}
+	auditSystemAction(c, "log_sink_update", sink.AppName, map[string]interface{}{"sink_id": sink.ID, "sink_type": sink.SinkType}, nil)
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Log sink updated successfully",
+		sink,
+	))
+}
+
+// DeleteLogSink removes a log sink from an app, the lines still buffered for it are discarded
+func DeleteLogSink(c *fiber.Ctx) error {
+	sink, err := logSinkFromParams(c)
+	if sink == nil {
+		return err
+	}
+
+	if err := api.LogAlerts.DeleteLogSink(context.Background(), sink.AppName, sink.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to delete log sink: "+err.Error(),
+			nil,
+		))
+	}
+	auditSystemAction(c, "log_sink_delete", sink.AppName, map[string]interface{}{"sink_id": sink.ID}, nil)
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Log sink deleted successfully",
+		fiber.Map{"id": sink.ID},
+	))
+}
+
+// TestLogSink sends a test line to a log sink right away, outside its buffer
+func TestLogSink(c *fiber.Ctx) error {
+	sink, err := logSinkFromParams(c)
+	if sink == nil {
+		return err
+	}
+
+	entry := utils.AppLogEntry{
+		Timestamp: time.Now().UTC(),
+		App:       sink.AppName,
+		Level:     "info",
+		Message:   "Citizen log forwarding test to sink " + sink.Name,
+	}
+	ctx, cancel := context.WithTimeout(c.UserContext(), 20*time.Second)
+	defer cancel()
+	if err := utils.SendLogEntries(ctx, *sink, []utils.AppLogEntry{entry}); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(utils.NewCitizenResponse(
+			false,
+			"Log sink test failed: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Test line sent to the log sink",
+		fiber.Map{"id": sink.ID},
+	))
+}
+
+// logSinkFromParams loads the sink named by the route, writing an error response when it can't.
+// When the sink is nil the handler must return the accompanying error (the result of the write).
+func logSinkFromParams(c *fiber.Ctx) (*api.LogSink, error) {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	sinkID, err := strconv.Atoi(c.Params("id"))
+	if err != nil || sinkID <= 0 {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid log sink ID",
+			nil,
+		))
+	}
+
+	sink, err := api.LogAlerts.GetLogSink(context.Background(), appName, sinkID)
+	if errors.Is(err, api.ErrLogSinkNotFound) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Log sink not found",
+			nil,
+		))
+	}
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve log sink: "+err.Error(),
+			nil,
+		))
+	}
+	return sink, nil
+}
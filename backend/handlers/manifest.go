@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"backend/database"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ExportAppManifest renders the configuration of an app as citizen.yml, to version it in the app
+// repository and apply it back with ApplyAppManifest. ?format=json returns it as JSON instead.
+func ExportAppManifest(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	manifest, err := utils.ReadAppManifest(c.UserContext(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to export app configuration: "+err.Error(),
+			nil,
+		))
+	}
+
+	if c.Query("format") == "json" {
+		return c.JSON(utils.NewCitizenResponse(
+			true,
+			"App configuration exported",
+			manifest,
+		))
+	}
+
+	c.Set(fiber.HeaderContentType, "application/yaml; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="citizen.yml"`)
+	return c.SendString(utils.RenderAppManifest(manifest))
+}
+
+// ApplyAppManifest brings an app to the configuration of a citizen.yml sent as the body, YAML or
+// JSON. Sections left out of the manifest are not changed, domains it doesn't list are only
+// removed with ?prune=true, and ?dry_run=true only returns the planned changes. Changes are
+// applied in order and stop at the first failure.
+func ApplyAppManifest(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var desired *utils.AppManifest
+	var err error
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		desired = &utils.AppManifest{}
+		err = json.Unmarshal(c.Body(), desired)
+	} else {
+		desired, err = utils.ParseAppManifest(c.Body())
+	}
+	if err == nil {
+		err = desired.Validate()
+	}
+	if err == nil && desired.App != "" && desired.App != appName {
+		err = fmt.Errorf("manifest is for app %s", desired.App)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid manifest: "+err.Error(),
+			nil,
+		))
+	}
+
+	current, err := utils.ReadAppManifest(c.UserContext(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to read app configuration: "+err.Error(),
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	dryRun := c.QueryBool("dry_run", false)
+	changes := utils.PlanAppManifest(appName, current, desired, c.QueryBool("prune", false), userID)
+	if dryRun {
+		return c.JSON(utils.NewCitizenResponse(
+			true,
+			fmt.Sprintf("%d changes planned, nothing applied", len(changes)),
+			fiber.Map{"dry_run": true, "changes": changes},
+		))
+	}
+
+	activity, activityErr := database.LogConfigActivity(appName, "manifest", "Apply citizen.yml", userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log manifest activity: %v\n", activityErr)
+	}
+	ok := utils.ApplyManifestChanges(c.UserContext(), changes)
+	if activity != nil {
+		if ok {
+			database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+		} else {
+			errorMsg := "citizen.yml partially applied"
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+	}
+
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to apply manifest, changes before the failed one were applied",
+			fiber.Map{"dry_run": false, "changes": changes},
+		))
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Manifest applied",
+		fiber.Map{"dry_run": false, "changes": changes},
+	))
+}
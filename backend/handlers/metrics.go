@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Metrics serves counters in the Prometheus text format. When METRICS_TOKEN is set, scrapers
+// must send it as a bearer token.
+func Metrics(c *fiber.Ctx) error {
+	if token := os.Getenv("METRICS_TOKEN"); token != "" {
+		sent := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+	}
+
+	var b strings.Builder
+	stats := api.QueryStats()
+
+	metric := func(name, kind, help string, value func(api.QueryStat) string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, stat := range stats {
+			fmt.Fprintf(&b, "%s{query=%q} %s\n", name, stat.Name, value(stat))
+		}
+	}
+	metric("citizen_db_queries_total", "counter", "Database queries run, by query name.",
+		func(s api.QueryStat) string { return fmt.Sprint(s.Count) })
+	metric("citizen_db_query_errors_total", "counter", "Database queries that failed, by query name.",
+		func(s api.QueryStat) string { return fmt.Sprint(s.Errors) })
+	metric("citizen_db_slow_queries_total", "counter", "Database queries slower than the slow query threshold, by query name.",
+		func(s api.QueryStat) string { return fmt.Sprint(s.Slow) })
+	metric("citizen_db_query_duration_seconds_total", "counter", "Time spent in database queries, by query name.",
+		func(s api.QueryStat) string { return fmt.Sprintf("%.6f", s.TotalDuration.Seconds()) })
+	metric("citizen_db_query_duration_seconds_max", "gauge", "Slowest execution of each query since startup.",
+		func(s api.QueryStat) string { return fmt.Sprintf("%.6f", s.MaxDuration.Seconds()) })
+
+	if database.DB != nil {
+		pool := database.DB.Stat()
+		value := func(name, kind, help string, v interface{}) {
+			fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, v)
+		}
+		value("citizen_db_pool_max_conns", "gauge", "Maximum size of the database connection pool.", pool.MaxConns())
+		value("citizen_db_pool_total_conns", "gauge", "Connections currently in the pool.", pool.TotalConns())
+		value("citizen_db_pool_idle_conns", "gauge", "Idle connections in the pool.", pool.IdleConns())
+		value("citizen_db_pool_acquired_conns", "gauge", "Connections currently acquired from the pool.", pool.AcquiredConns())
+		value("citizen_db_pool_constructing_conns", "gauge", "Connections being established.", pool.ConstructingConns())
+		value("citizen_db_pool_acquires_total", "counter", "Successful acquires from the pool.", pool.AcquireCount())
+		value("citizen_db_pool_empty_acquires_total", "counter", "Acquires that waited for a connection because none was idle.", pool.EmptyAcquireCount())
+		value("citizen_db_pool_canceled_acquires_total", "counter", "Acquires cancelled before getting a connection.", pool.CanceledAcquireCount())
+		value("citizen_db_pool_acquire_duration_seconds_total", "counter", "Time spent acquiring connections.",
+			fmt.Sprintf("%.6f", pool.AcquireDuration().Seconds()))
+		value("citizen_db_pool_new_conns_total", "counter", "Connections opened by the pool.", pool.NewConnsCount())
+		value("citizen_db_pool_max_lifetime_destroys_total", "counter", "Connections closed for exceeding their max lifetime.", pool.MaxLifetimeDestroyCount())
+		value("citizen_db_pool_max_idle_destroys_total", "counter", "Connections closed for exceeding their max idle time.", pool.MaxIdleDestroyCount())
+	}
+
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.SendString(b.String())
+}
+
+// ListSlowQueries returns the slowest database queries since startup and the per-query stats
+func ListSlowQueries(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	stats := api.QueryStats()
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	slowest := api.SlowQueries()
+	if len(slowest) > limit {
+		slowest = slowest[:limit]
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Slow queries retrieved successfully",
+		fiber.Map{
+			"threshold_ms":    api.SlowQueryThreshold.Milliseconds(),
+			"slow_queries":    slowest,
+			"queries_by_time": stats,
+		},
+	))
+}
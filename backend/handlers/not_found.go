@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// notFoundSettingKey is the system setting holding the "app not found" page config as JSON
+const notFoundSettingKey = "routing.not_found"
+
+// NotFoundPageConfig configures the page served for hosts that don't map to an app
+type NotFoundPageConfig struct {
+	Enabled     bool   `json:"enabled"`            // false serves a plain 404
+	Title       string `json:"title"`              // page heading
+	Message     string `json:"message,omitempty"`  // text below the heading
+	HomeURL     string `json:"home_url,omitempty"` // optional link back to the instance
+	Suggestions string `json:"suggestions"`        // off, public or all: which app names may be suggested
+}
+
+// defaultNotFoundPageConfig is used until an admin saves a config
+var defaultNotFoundPageConfig = NotFoundPageConfig{
+	Enabled:     true,
+	Title:       "App not found",
+	Message:     "There is no app at this address. Check the URL or ask the app owner for the right link.",
+	Suggestions: "off",
+}
+
+// Validate checks the config values
+func (c *NotFoundPageConfig) Validate() error {
+	switch c.Suggestions {
+	case "off", "public", "all":
+	default:
+		return fmt.Errorf("suggestions must be off, public or all")
+	}
+	if len(c.Title) > 200 || len(c.Message) > 2000 {
+		return fmt.Errorf("title must be at most 200 and message at most 2000 characters")
+	}
+	if c.HomeURL != "" && !strings.HasPrefix(c.HomeURL, "https://") && !strings.HasPrefix(c.HomeURL, "http://") {
+		return fmt.Errorf("home_url must be an http(s) URL")
+	}
+	// The config is stored as a system setting, which rejects SQL-like text
+	if err := api.ValidateArgs(c.Title, c.Message, c.HomeURL); err != nil {
+		return fmt.Errorf("title, message and home_url may not contain SQL-like text")
+	}
+	return nil
+}
+
+// getNotFoundPageConfig returns the stored config, or the default when none is stored
+func getNotFoundPageConfig(ctx context.Context) NotFoundPageConfig {
+	value, err := api.Settings.GetSystemSetting(ctx, notFoundSettingKey)
+	if err != nil {
+		if !errors.Is(err, api.ErrSettingNotFound) {
+			utils.WarnLog("Failed to load not found page config, using defaults: %v", err)
+		}
+		return defaultNotFoundPageConfig
+	}
+
+	var config NotFoundPageConfig
+	if err := json.Unmarshal([]byte(value), &config); err != nil || config.Validate() != nil {
+		utils.WarnLog("Invalid not found page config stored, using defaults: %v", err)
+		return defaultNotFoundPageConfig
+	}
+	return config
+}
+
+// HostResolution tells which app, if any, a host is routed to
+type HostResolution struct {
+	Host        string   `json:"host"`
+	Known       bool     `json:"known"`
+	Kind        string   `json:"kind"` // login, app, custom_domain, unknown
+	AppName     string   `json:"app_name,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// knownAppsTTL is how long the app list used to resolve hosts is cached
+const knownAppsTTL = 30 * time.Second
+
+// knownAppsCache caches the dokku app list so host checks don't run an SSH command per request
+var knownAppsCache struct {
+	sync.Mutex
+	apps      map[string]bool
+	fetchedAt time.Time
+}
+
+// knownApps returns the set of existing apps. ok is false when the list could not be fetched.
+func knownApps() (apps map[string]bool, ok bool) {
+	knownAppsCache.Lock()
+	defer knownAppsCache.Unlock()
+
+	if knownAppsCache.apps != nil && time.Since(knownAppsCache.fetchedAt) < knownAppsTTL {
+		return knownAppsCache.apps, true
+	}
+
+	list, err := utils.ListApps()
+	if err != nil {
+		utils.WarnLog("Failed to list apps for host resolution: %v", err)
+		// A stale list is better than treating every host as unknown
+		return knownAppsCache.apps, knownAppsCache.apps != nil
+	}
+
+	knownAppsCache.apps = make(map[string]bool, len(list))
+	for _, app := range list {
+		knownAppsCache.apps[app] = true
+	}
+	knownAppsCache.fetchedAt = time.Now()
+	return knownAppsCache.apps, true
+}
+
+// resolveHost finds the app a host is routed to. When the app list is unavailable the host is
+// reported as known so callers fall back to their normal behavior.
+func resolveHost(host string) HostResolution {
+	host = strings.ToLower(strings.Split(host, ":")[0])
+	resolution := HostResolution{Host: host, Kind: "unknown"}
+
+	switch getDomainType(host) {
+	case DomainTypeLogin:
+		resolution.Known, resolution.Kind = true, "login"
+		return resolution
+	case DomainTypeCustom:
+		if appName := extractAppNameFromHost(host); appName != "" {
+			resolution.Known, resolution.Kind, resolution.AppName = true, "custom_domain", appName
+		}
+		return resolution
+	}
+
+	appName := extractAppNameFromHost(host)
+	if appName == "" {
+		return resolution
+	}
+	apps, ok := knownApps()
+	if !ok || apps[appName] {
+		resolution.Known, resolution.Kind, resolution.AppName = true, "app", appName
+	}
+	return resolution
+}
+
+// suggestApps returns up to three apps whose names are close to the requested one
+func suggestApps(requested, mode string) []string {
+	if mode == "off" || requested == "" {
+		return nil
+	}
+
+	var candidates []string
+	if mode == "public" {
+		public, err := api.Settings.ListPublicApps(context.Background())
+		if err != nil {
+			return nil
+		}
+		candidates = public
+	} else {
+		apps, _ := knownApps()
+		for app := range apps {
+			candidates = append(candidates, app)
+		}
+	}
+
+	type match struct {
+		name     string
+		distance int
+	}
+	var matches []match
+	for _, candidate := range candidates {
+		distance := editDistance(requested, candidate)
+		if distance <= 2 || strings.HasPrefix(candidate, requested) || strings.HasPrefix(requested, candidate) {
+			matches = append(matches, match{candidate, distance})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	suggestions := []string{}
+	for i := 0; i < len(matches) && i < 3; i++ {
+		suggestions = append(suggestions, matches[i].name)
+	}
+	return suggestions
+}
+
+// editDistance is the Levenshtein distance between two names
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// requestedAppName is the app name an unknown subdomain asked for
+func requestedAppName(host string) string {
+	loginHost := getLoginHost()
+	if !strings.HasSuffix(host, "."+loginHost) {
+		return ""
+	}
+	return strings.TrimSuffix(host, "."+loginHost)
+}
+
+// GetHostStatus reports whether a host maps to an app, so the routing layer and the UI can
+// tell unknown hosts apart from apps that are down
+func GetHostStatus(c *fiber.Ctx) error {
+	host := c.Query("host")
+	if host == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Host is required",
+			nil,
+		))
+	}
+
+	resolution := resolveHost(host)
+	if !resolution.Known {
+		config := getNotFoundPageConfig(c.Context())
+		resolution.Suggestions = suggestApps(requestedAppName(resolution.Host), config.Suggestions)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Host resolved",
+		resolution,
+	))
+}
+
+// HostNotFound serves the "app not found" page. Traefik routes hosts that match no app router
+// here, and ValidateForTraefik serves it for subdomains of apps that no longer exist.
+func HostNotFound(c *fiber.Ctx) error {
+	host := c.Get("X-Forwarded-Host")
+	if host == "" {
+		host = c.Hostname()
+	}
+	return renderHostNotFound(c, host)
+}
+
+// notFoundPage renders the "app not found" page
+var notFoundPage = template.Must(template.New("not_found").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <title>{{.Title}}</title>
+    <style>
+        body { margin: 0; min-height: 100vh; display: flex; align-items: center; justify-content: center;
+               font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+               background: #0f172a; color: #e2e8f0; }
+        main { max-width: 32rem; padding: 2rem; text-align: center; }
+        h1 { font-size: 1.75rem; margin: 0 0 0.75rem; }
+        p { color: #94a3b8; line-height: 1.5; }
+        code { color: #e2e8f0; }
+        ul { list-style: none; padding: 0; }
+        a { color: #38bdf8; }
+    </style>
+</head>
+<body>
+<main>
+    <h1>{{.Title}}</h1>
+    <p><code>{{.Host}}</code></p>
+    <p>{{.Message}}</p>
+    {{if .Suggestions}}<p>Did you mean</p>
+    <ul>{{range .Suggestions}}<li><a href="{{$.Scheme}}://{{.}}.{{$.LoginHost}}/">{{.}}.{{$.LoginHost}}</a></li>{{end}}</ul>{{end}}
+    {{if .HomeURL}}<p><a href="{{.HomeURL}}">Go to the home page</a></p>{{end}}
+</main>
+</body>
+</html>
+`))
+
+// renderHostNotFound writes the configured 404 response for host
+func renderHostNotFound(c *fiber.Ctx, host string) error {
+	c.Set("Cache-Control", "no-store")
+	c.Set(utils.HostNotFoundHeader, "1")
+
+	config := getNotFoundPageConfig(c.Context())
+	if !config.Enabled {
+		return c.Status(fiber.StatusNotFound).SendString("404 page not found")
+	}
+
+	host = strings.ToLower(strings.Split(host, ":")[0])
+	scheme := "http"
+	if isHttpsRequired() {
+		scheme = "https"
+	}
+
+	var page strings.Builder
+	err := notFoundPage.Execute(&page, map[string]interface{}{
+		"Title":       config.Title,
+		"Message":     config.Message,
+		"HomeURL":     config.HomeURL,
+		"Host":        host,
+		"Suggestions": suggestApps(requestedAppName(host), config.Suggestions),
+		"Scheme":      scheme,
+		"LoginHost":   getLoginHost(),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).SendString("404 page not found")
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Status(fiber.StatusNotFound).SendString(page.String())
+}
+
+// GetNotFoundPageConfig returns the config of the page served for unknown hosts
+func GetNotFoundPageConfig(c *fiber.Ctx) error {
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Not found page config retrieved successfully",
+		getNotFoundPageConfig(c.Context()),
+	))
+}
+
+// SetNotFoundPageConfig changes the page served for unknown hosts
+func SetNotFoundPageConfig(c *fiber.Ctx) error {
+	var config NotFoundPageConfig
+	if err := c.BodyParser(&config); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if config.Suggestions == "" {
+		config.Suggestions = "off"
+	}
+	if config.Title == "" {
+		config.Title = defaultNotFoundPageConfig.Title
+	}
+
+	if err := config.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	value, err := json.Marshal(config)
+	if err == nil {
+		err = api.Settings.SetSystemSetting(c.Context(), notFoundSettingKey, string(value))
+	}
+	auditSystemAction(c, "not_found_page_set", notFoundSettingKey, map[string]interface{}{
+		"enabled":     config.Enabled,
+		"suggestions": config.Suggestions,
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save not found page config: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Not found page config updated",
+		config,
+	))
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"time"
+
+	"backend/database/api"
+	"backend/models"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DeploySampleApp creates an app and deploys a known-good sample repository to it, so a new user
+// can check that Citizen, dokku and Traefik work together before connecting their own repositories.
+// The deployment runs in the background and is followed like any other one.
+func DeploySampleApp(c *fiber.Ctx) error {
+	var req struct {
+		AppName string `json:"app_name"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Invalid request content",
+				nil,
+			))
+		}
+	}
+
+	requested := req.AppName != ""
+	if !requested {
+		req.AppName = utils.DefaultSampleAppName
+	}
+	check, err := checkAppName(req.AppName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while listing apps: "+err.Error(),
+			nil,
+		))
+	}
+	if !check.Valid {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid app name: "+check.Reason,
+			check,
+		))
+	}
+	appName := check.Name
+	if !check.Available {
+		// The default name is only a convenience, a free variant of it does as well
+		if requested || len(check.Suggestions) == 0 {
+			return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+				false,
+				"App name is already taken",
+				check,
+			))
+		}
+		appName = check.Suggestions[0]
+	}
+
+	gitURL, branch := utils.SampleAppSource()
+	if _, err := utils.ValidateGitSource(c.UserContext(), gitURL, branch); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(utils.NewCitizenResponse(
+			false,
+			"The sample app repository can't be used: "+err.Error(),
+			fiber.Map{"git_url": gitURL, "branch": branch},
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+
+	output, err := utils.CreateApp(appName)
+	auditSystemAction(c, "onboarding_sample_app", appName, map[string]interface{}{
+		"git_url": gitURL,
+		"branch":  branch,
+	}, err)
+	if err != nil {
+		return commandErrorResponse(c, "An error occurred while creating the sample app", err, nil)
+	}
+
+	deployment := &models.AppDeployment{
+		AppName:    appName,
+		GitURL:     gitURL,
+		GitBranch:  branch,
+		Status:     "pending",
+		LastDeploy: time.Now(),
+	}
+	if err := api.Deployments.UpsertDeployment(c.UserContext(), deployment); err != nil {
+		utils.WarnLog("Failed to record the deployment of sample app %s: %v", appName, err)
+	}
+
+	go func() {
+		trace, _ := detectAndApplyPort(utils.NewDeployDiagnostics(), appName, gitURL, branch, userID, nil, "")
+		if trace != nil && trace.Port != nil {
+			deployment.Port, deployment.PortSource = trace.Port.Port, trace.Port.Source
+		}
+		deployNewApp(deployment, userID, "Onboarding sample app deployment")
+	}()
+
+	return c.Status(fiber.StatusAccepted).JSON(utils.NewCitizenResponse(
+		true,
+		"Sample app created, its first deployment is running",
+		fiber.Map{
+			"app_name":        appName,
+			"git_url":         gitURL,
+			"branch":          branch,
+			"output":          output,
+			"deployments_url": "/api/v1/citizen/apps/" + appName + "/deployments",
+			"activities_url":  "/api/v1/citizen/apps/" + appName + "/activities",
+		},
+	))
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"backend/database"
+	"backend/utils"
+)
+
+// oneTimeValues keeps the values of putOneTimeValue while Redis is unavailable
+var oneTimeValues = struct {
+	sync.Mutex
+	byKey map[string]oneTimeValue
+}{byKey: make(map[string]oneTimeValue)}
+
+type oneTimeValue struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// putOneTimeValue stores a value to be taken once with takeOneTimeValue, in Redis when available
+// so any instance can take it, and in memory otherwise
+func putOneTimeValue(key string, value interface{}, ttl time.Duration) error {
+	if err := database.SetJSON(key, value, ttl); err == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	oneTimeValues.Lock()
+	defer oneTimeValues.Unlock()
+	for k, stale := range oneTimeValues.byKey {
+		if time.Now().After(stale.expiresAt) {
+			delete(oneTimeValues.byKey, k)
+		}
+	}
+	oneTimeValues.byKey[key] = oneTimeValue{data: data, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// takeOneTimeValue reads a value stored with putOneTimeValue into dest and forgets it. Taking is
+// atomic in both stores, so concurrent callers can't both get the value.
+func takeOneTimeValue(key string, dest interface{}) bool {
+	found, err := database.TakeJSON(key, dest)
+	if found {
+		return true
+	}
+	if err != nil && database.IsRedisAvailable() {
+		utils.WarnLog("Failed to take %s from Redis: %v", key, err)
+	}
+
+	oneTimeValues.Lock()
+	value, ok := oneTimeValues.byKey[key]
+	delete(oneTimeValues.byKey, key)
+	oneTimeValues.Unlock()
+	if !ok || time.Now().After(value.expiresAt) {
+		return false
+	}
+	return json.Unmarshal(value.data, dest) == nil
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultOperationsLimit = 50
+	maxOperationsLimit     = 500
+)
+
+var operationStatuses = []string{
+	string(api.OperationRunning),
+	string(api.OperationCompleted),
+	string(api.OperationCompensating),
+	string(api.OperationCompensated),
+	string(api.OperationRetrying),
+	string(api.OperationFailed),
+	string(api.OperationResolved),
+}
+
+// ListOperations lists the recorded operations across dokku and the database. status=stuck, the
+// default, lists the failed ones and the unfinished ones no longer updated; status=all lists every
+// operation.
+func ListOperations(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultOperationsLimit)
+	if limit < 1 || limit > maxOperationsLimit {
+		limit = defaultOperationsLimit
+	}
+
+	var operations []api.Operation
+	var err error
+	switch status := c.Query("status", "stuck"); {
+	case status == "stuck":
+		operations, err = api.Operations.ListStuckOperations(c.Context(), time.Now().Add(-utils.OperationRetryDelay))
+		if len(operations) > limit {
+			operations = operations[:limit]
+		}
+	case status == "all":
+		operations, err = api.Operations.ListOperations(c.Context(), nil, limit)
+	case slices.Contains(operationStatuses, status):
+		operations, err = api.Operations.ListOperations(c.Context(), []string{status}, limit)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid status: "+status,
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list operations: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Operations retrieved successfully",
+		fiber.Map{"operations": operations},
+	))
+}
+
+// ReconcileOperation compensates or retries an unfinished or failed operation right away
+func ReconcileOperation(c *fiber.Ctx) error {
+	op, response := operationFromParams(c)
+	if op == nil {
+		return response
+	}
+	switch op.Status {
+	case api.OperationRunning, api.OperationCompensating, api.OperationRetrying, api.OperationFailed:
+	default:
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			"Operation is "+string(op.Status)+", there is nothing to reconcile",
+			nil,
+		))
+	}
+
+	err := utils.ReconcileOperation(c.UserContext(), op)
+	auditSystemAction(c, "operation_reconcile", strconv.Itoa(op.ID), map[string]interface{}{
+		"kind":     op.Kind,
+		"app_name": op.AppName,
+		"status":   op.Status,
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to reconcile operation: "+err.Error(),
+			fiber.Map{"operation": op},
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Operation reconciled",
+		fiber.Map{"operation": op},
+	))
+}
+
+// ResolveOperation marks an operation as fixed by hand, so it is no longer reconciled
+func ResolveOperation(c *fiber.Ctx) error {
+	op, response := operationFromParams(c)
+	if op == nil {
+		return response
+	}
+	if op.Status == api.OperationCompleted || op.Status == api.OperationCompensated || op.Status == api.OperationResolved {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			"Operation is already "+string(op.Status),
+			nil,
+		))
+	}
+
+	previous := op.Status
+	op.Status = api.OperationResolved
+	now := time.Now()
+	op.CompletedAt = &now
+	err := api.Operations.SaveOperation(c.Context(), op)
+	auditSystemAction(c, "operation_resolve", strconv.Itoa(op.ID), map[string]interface{}{
+		"kind":     op.Kind,
+		"app_name": op.AppName,
+		"previous": previous,
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to resolve operation: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Operation marked as resolved",
+		fiber.Map{"operation": op},
+	))
+}
+
+// operationFromParams loads the operation of the :id param, or writes the error response
+func operationFromParams(c *fiber.Ctx) (*api.Operation, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil || id < 1 {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid operation ID",
+			nil,
+		))
+	}
+
+	op, err := api.Operations.GetOperation(c.Context(), id)
+	if errors.Is(err, api.ErrOperationNotFound) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Operation not found",
+			nil,
+		))
+	}
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to get operation: "+err.Error(),
+			nil,
+		))
+	}
+	return op, nil
+}
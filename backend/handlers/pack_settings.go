@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"fmt"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetPackSettings returns the builder image, run image and build env of the pack builds of an
+// app, with the builder image dokku currently resolves
+func GetPackSettings(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	settings, err := api.Apps.GetPackSettings(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve pack settings: "+err.Error(),
+			nil,
+		))
+	}
+
+	buildEnv := map[string]string{}
+	if len(settings.BuildEnvKeys) > 0 {
+		env, err := utils.ExportEnv(appName)
+		if err != nil {
+			return commandErrorResponse(c, "Failed to read the build env", err, nil)
+		}
+		for _, key := range settings.BuildEnvKeys {
+			if value, ok := env[key]; ok {
+				buildEnv[key] = value
+			}
+		}
+	}
+	data := fiber.Map{
+		"app_name":      appName,
+		"builder_image": settings.BuilderImage,
+		"run_image":     settings.RunImage,
+		"build_env":     buildEnv,
+	}
+	if effective, err := utils.PackBuilderImage(appName); err == nil {
+		data["effective_builder_image"] = effective
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Pack settings retrieved successfully",
+		data,
+	))
+}
+
+// SetPackSettings replaces the pack settings of an app: empty images restore the defaults of
+// dokku and build env keys left out are unset. They apply from the next build.
+func SetPackSettings(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req utils.PackBuildSettings
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	previous, err := api.Apps.GetPackSettings(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve pack settings: "+err.Error(),
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	activity, activityErr := database.LogConfigActivity(appName, "pack_settings",
+		fmt.Sprintf("Updated pack build settings (builder image %q, run image %q, %d build env keys)",
+			req.BuilderImage, req.RunImage, len(req.BuildEnv)), userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log pack settings activity: %v\n", activityErr)
+	}
+
+	applied, err := utils.ApplyPackSettings(appName, previous, &req)
+	if err == nil {
+		err = api.Apps.SetPackSettings(c.Context(), applied, userID)
+	}
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+		return commandErrorResponse(c, "Failed to apply pack settings", err, nil)
+	}
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Pack settings updated, they apply from the next build",
+		applied,
+	))
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// trackEnvRestart records the keys of an env update left waiting for a restart, or forgets the
+// pending restart of an app the update restarted
+func trackEnvRestart(appName string, result *utils.EnvUpdateResult, userID *int) {
+	if result.Restarted {
+		clearPendingRestart(appName)
+		return
+	}
+	if !result.RestartPending {
+		return
+	}
+
+	var keys []string
+	for _, key := range result.Keys {
+		if key.Status != utils.EnvKeyFailed {
+			keys = append(keys, key.Key)
+		}
+	}
+	if err := api.Apps.MarkRestartPending(context.Background(), appName, keys, userID); err != nil {
+		utils.WarnLog("Failed to mark restart pending for %s: %v", appName, err)
+	}
+}
+
+// clearPendingRestart forgets the pending restart of an app that just restarted or deployed
+func clearPendingRestart(appName string) {
+	if err := api.Apps.ClearPendingRestart(context.Background(), appName); err != nil {
+		utils.WarnLog("Failed to clear pending restart of %s: %v", appName, err)
+	}
+}
+
+// ApplyPendingEnv restarts an app to apply the environment changes saved with no_restart
+func ApplyPendingEnv(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	pending, err := api.Apps.GetPendingRestart(context.Background(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to get pending environment changes: "+err.Error(),
+			nil,
+		))
+	}
+	if pending == nil {
+		return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+			true,
+			"No pending environment changes to apply",
+			fiber.Map{"app_name": appName, "restarted": false},
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+
+	activity, activityErr := database.LogRestartActivity(appName, userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log restart activity: %v\n", activityErr)
+	}
+
+	output, err := utils.RestartApp(appName)
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while restarting the app: "+err.Error(),
+			fiber.Map{"pending": pending},
+		))
+	}
+
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+	clearPendingRestart(appName)
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Pending environment changes applied successfully",
+		fiber.Map{
+			"app_name":     appName,
+			"restarted":    true,
+			"applied_keys": pending.ChangedKeys,
+			"output":       output,
+		},
+	))
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetPipeline returns the deployment pipeline of an app, null when its deployments go straight
+// to traffic
+func GetPipeline(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	pipeline, err := api.Apps.GetPipeline(c.Context(), appName)
+	if err != nil && !errors.Is(err, api.ErrPipelineNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve pipeline: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Pipeline retrieved successfully",
+		fiber.Map{
+			"app_name": appName,
+			"pipeline": pipeline,
+			"stages":   []string{utils.PipelineStageBuild, utils.PipelineStageTest, utils.PipelineStageDeploy},
+		},
+	))
+}
+
+// SetPipeline creates or replaces the deployment pipeline of an app. From its next deployment, the
+// new build runs test_command in a one-off container and only gets traffic when it passes.
+func SetPipeline(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		TestCommand        string `json:"test_command"`
+		TestTimeoutSeconds int    `json:"test_timeout_seconds"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	pipeline := &api.Pipeline{
+		AppName:            appName,
+		TestCommand:        req.TestCommand,
+		TestTimeoutSeconds: req.TestTimeoutSeconds,
+	}
+	if err := utils.ValidatePipeline(pipeline); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if err := api.Apps.SetPipeline(c.Context(), pipeline, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save pipeline: "+err.Error(),
+			nil,
+		))
+	}
+
+	message := fmt.Sprintf("Set the pipeline test stage with a %ds timeout", pipeline.TestTimeoutSeconds)
+	if activity, err := database.LogConfigActivity(appName, "pipeline", message, userID); err != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log pipeline activity: %v\n", err)
+	} else {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	saved, err := api.Apps.GetPipeline(c.Context(), appName)
+	if err != nil {
+		saved = pipeline
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Pipeline saved, it applies to the next deployment",
+		fiber.Map{
+			"app_name": appName,
+			"pipeline": saved,
+		},
+	))
+}
+
+// DeletePipeline removes the deployment pipeline of an app, its next deployments are no longer tested
+func DeletePipeline(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	err := api.Apps.DeletePipeline(c.Context(), appName)
+	if errors.Is(err, api.ErrPipelineNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"App has no pipeline",
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to delete pipeline: "+err.Error(),
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if activity, err := database.LogConfigActivity(appName, "pipeline", "Removed the pipeline", userID); err != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log pipeline activity: %v\n", err)
+	} else {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Pipeline removed",
+		fiber.Map{"app_name": appName},
+	))
+}
+
+// GetDeploymentStages returns the build, test and deploy stages of a deployment with their logs.
+// Deployments made without a pipeline have no stages.
+func GetDeploymentStages(c *fiber.Ctx) error {
+	record, err := deploymentRecordFromParams(c)
+	if record == nil {
+		return err
+	}
+
+	stages, err := api.Deployments.ListDeploymentStages(c.Context(), record.AppName, record.ID, true)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve deployment stages: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Deployment stages retrieved successfully",
+		fiber.Map{
+			"deployment_id": record.ID,
+			"app_name":      record.AppName,
+			"status":        record.Status,
+			"stages":        stages,
+		},
+	))
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PromoteApp deploys the image currently running on a source app (e.g. staging) to an app (e.g.
+// production) without rebuilding. The image is retagged under a unique name and deployed with
+// git:from-image; the deployment record links back to the source deployment.
+func PromoteApp(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	sourceApp := c.Params("source_app")
+	if appName == "" || sourceApp == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name and source app name are required",
+			nil,
+		))
+	}
+	return promoteImage(c, appName, sourceApp)
+}
+
+// promoteImage deploys the image running on sourceApp to appName and answers the request
+func promoteImage(c *fiber.Ctx, appName, sourceApp string) error {
+	if appName == sourceApp {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"An app cannot be promoted from itself",
+			nil,
+		))
+	}
+
+	if missing, err := capabilityMissing(c, utils.FeatureGitImage); missing {
+		return err
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if err := database.CheckBuildQuota(c.UserContext(), appName, userID); err != nil {
+		return buildQuotaResponse(c, err)
+	}
+
+	apps, err := utils.ListApps()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list apps: "+err.Error(),
+			nil,
+		))
+	}
+	for _, name := range []string{appName, sourceApp} {
+		if !slices.Contains(apps, name) {
+			return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+				false,
+				fmt.Sprintf("App %s does not exist", name),
+				nil,
+			))
+		}
+	}
+
+	// Promote what is running on the source app, which is the image of its current release
+	sourceRecord, err := database.GetLatestSuccessfulDeployment(sourceApp)
+	if err != nil {
+		return deploymentImageError(c, sourceApp, sourceRecord, err)
+	}
+	running, err := utils.InspectImage(context.Background(), utils.AppImageRef(sourceApp))
+	if err != nil {
+		return deploymentImageError(c, sourceApp, sourceRecord, err)
+	}
+
+	warnings := []string{}
+	if sourceRecord.ImageID != "" && sourceRecord.ImageID != running.ID {
+		warnings = append(warnings, fmt.Sprintf("%s is not running the image of its latest successful deployment %d",
+			sourceApp, sourceRecord.ID))
+	}
+
+	// git:from-image only deploys when the image name changes, so every promotion gets its own tag
+	image := fmt.Sprintf("citizen/%s:promoted-%s-%d-%d", appName, sourceApp, sourceRecord.ID, time.Now().Unix())
+	if err := utils.TagImage(context.Background(), running.ID, image); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to tag the image: "+err.Error(),
+			nil,
+		))
+	}
+
+	recordAppInteraction(c, appName, api.InteractionDeploy)
+
+	activity, activityErr := database.LogDeployActivity(appName, sourceRecord.GitURL, sourceRecord.GitBranch, sourceRecord.GitCommit,
+		fmt.Sprintf("Promoted from %s (deployment %d)", sourceApp, sourceRecord.ID), userID, database.TriggerManual)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log promotion activity: %v\n", activityErr)
+	}
+
+	record, recordErr := database.StartPromotionRecord(appName, sourceRecord, activity, userID)
+	if recordErr != nil {
+		fmt.Printf("[DEPLOY] ⚠️ Failed to record promotion: %v\n", recordErr)
+	}
+
+	diagnostics := utils.NewDeployDiagnostics()
+	diagnostics.Info("promote", "promoting image %s of %s (deployment %d) as %s", running.ID, sourceApp, sourceRecord.ID, image)
+
+	deployCtx, finishDeploy, err := deploymentContext(record, appName)
+	var output string
+	if err == nil {
+		output, err = utils.DeployFromImageContext(utils.WithDiagnostics(deployCtx, diagnostics), appName, image)
+		finishDeploy()
+	}
+
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, deploymentFailureStatus(err), &errorMsg)
+		}
+		if record != nil {
+			database.FinishDeploymentRecord(record.ID, deploymentFailureStatus(err), output, err, diagnostics)
+			emitDeploymentEvent(record, err)
+		}
+
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, utils.ErrDeploymentCancelled) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(utils.NewCitizenResponse(
+			false,
+			"Promotion failed: "+err.Error(),
+			fiber.Map{"output": output},
+		))
+	}
+
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+	clearPendingRestart(appName)
+	responseData := fiber.Map{
+		"app_name":             appName,
+		"source_app":           sourceApp,
+		"source_deployment_id": sourceRecord.ID,
+		"source_image_id":      running.ID,
+		"image":                image,
+		"git_commit":           sourceRecord.GitCommit,
+		"warnings":             warnings,
+		"output":               output,
+	}
+	if record != nil {
+		recordDeploymentImage(diagnostics, appName, record.ID)
+		database.FinishDeploymentRecord(record.ID, database.StatusSuccess, output, nil, diagnostics)
+		emitDeploymentEvent(record, nil)
+		responseData["deployment_id"] = record.ID
+		responseData["diagnostics_url"] = deploymentDiagnosticsURL(appName, record.ID)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		fmt.Sprintf("%s promoted from %s successfully", appName, sourceApp),
+		responseData,
+	))
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxPromotionChain bounds the links followed when looking for a loop, chains are short in practice
+const maxPromotionChain = 20
+
+// GetPromotionLink returns the app an app is promoted to, null when it has none, and the apps
+// promoted to it
+func GetPromotionLink(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	link, err := api.Apps.GetPromotionLink(c.Context(), appName)
+	if err != nil && !errors.Is(err, api.ErrPromotionLinkNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve promotion link: "+err.Error(),
+			nil,
+		))
+	}
+	sources, err := api.Apps.ListPromotionSources(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve promotion link: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Promotion link retrieved successfully",
+		fiber.Map{
+			"app_name":      appName,
+			"link":          link,
+			"promoted_from": sources,
+		},
+	))
+}
+
+// SetPromotionLink links an app (e.g. staging) to the app POST /promote deploys its image to (e.g.
+// production)
+func SetPromotionLink(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		TargetApp string `json:"target_app"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if req.TargetApp == "" || req.TargetApp == appName {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"target_app must be another app",
+			nil,
+		))
+	}
+
+	apps, err := utils.ListApps()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list apps: "+err.Error(),
+			nil,
+		))
+	}
+	for _, name := range []string{appName, req.TargetApp} {
+		if !slices.Contains(apps, name) {
+			return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+				false,
+				fmt.Sprintf("App %s does not exist", name),
+				nil,
+			))
+		}
+	}
+
+	// Promotions go one way, an app can't end up promoted to itself through the chain
+	next := req.TargetApp
+	for i := 0; i < maxPromotionChain; i++ {
+		link, err := api.Apps.GetPromotionLink(c.Context(), next)
+		if errors.Is(err, api.ErrPromotionLinkNotFound) {
+			break
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+				false,
+				"Failed to retrieve promotion link: "+err.Error(),
+				nil,
+			))
+		}
+		if link.TargetApp == appName {
+			return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+				false,
+				fmt.Sprintf("%s is already promoted to %s", req.TargetApp, appName),
+				nil,
+			))
+		}
+		next = link.TargetApp
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	link := &api.PromotionLink{AppName: appName, TargetApp: req.TargetApp}
+	if err := api.Apps.SetPromotionLink(c.Context(), link, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save promotion link: "+err.Error(),
+			nil,
+		))
+	}
+
+	if activity, err := database.LogConfigActivity(appName, "promotion_link", "Linked for promotion to "+req.TargetApp, userID); err != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log promotion link activity: %v\n", err)
+	} else {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	saved, err := api.Apps.GetPromotionLink(c.Context(), appName)
+	if err != nil {
+		saved = link
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		fmt.Sprintf("%s is now promoted to %s", appName, req.TargetApp),
+		fiber.Map{
+			"app_name": appName,
+			"link":     saved,
+		},
+	))
+}
+
+// DeletePromotionLink unlinks an app from the app it is promoted to
+func DeletePromotionLink(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	err := api.Apps.DeletePromotionLink(c.Context(), appName)
+	if errors.Is(err, api.ErrPromotionLinkNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"App is not linked to an app to promote to",
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to delete promotion link: "+err.Error(),
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if activity, err := database.LogConfigActivity(appName, "promotion_link", "Removed the promotion link", userID); err != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log promotion link activity: %v\n", err)
+	} else {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Promotion link removed",
+		fiber.Map{"app_name": appName},
+	))
+}
+
+// PromoteToLinkedApp deploys the image running on an app (e.g. staging) to the app it is linked to
+// (e.g. production), exactly like POST /promote-from on the linked app
+func PromoteToLinkedApp(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	link, err := api.Apps.GetPromotionLink(c.Context(), appName)
+	if errors.Is(err, api.ErrPromotionLinkNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App is not linked to an app to promote to, link it with PUT /promotion-link first",
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve promotion link: "+err.Error(),
+			nil,
+		))
+	}
+
+	return promoteImage(c, link.TargetApp, appName)
+}
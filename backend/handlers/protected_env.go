@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maskedEnvValue replaces the values users aren't allowed to see
+const maskedEnvValue = "********"
+
+// envKeyPattern matches the env keys that can be protected
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+
+// protectedEnvKeySet returns the protected env keys of an app as a set
+func protectedEnvKeySet(c *fiber.Ctx, appName string) (map[string]bool, error) {
+	keys, err := api.Apps.ListProtectedEnvKeys(c.Context(), appName)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k.Key] = true
+	}
+	return set, nil
+}
+
+// protectedEnvChange writes a forbidden response when a user who isn't an admin changes or
+// removes protected env keys of an app. Changes are refused when the protected keys can't be read.
+func protectedEnvChange(c *fiber.Ctx, appName string, keys []string) (bool, error) {
+	if isAdminRequest(c) {
+		return false, nil
+	}
+
+	protected, err := protectedEnvKeySet(c, appName)
+	if err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to check protected environment variables: "+err.Error(),
+			nil,
+		))
+	}
+	blocked := []string{}
+	for _, key := range keys {
+		if protected[key] {
+			blocked = append(blocked, key)
+		}
+	}
+	if len(blocked) == 0 {
+		return false, nil
+	}
+	sort.Strings(blocked)
+
+	utils.SecurityLog("Change of protected env keys %s of %s denied for user %v", strings.Join(blocked, ", "), appName, c.Locals("user_id"))
+	return true, c.Status(fiber.StatusForbidden).JSON(utils.NewCitizenResponse(
+		false,
+		fmt.Sprintf("Environment variables %s are protected, only admins can change or remove them", strings.Join(blocked, ", ")),
+		fiber.Map{"protected_keys": blocked},
+	))
+}
+
+// ListProtectedEnvKeys lists the env keys of an app only admins can change or remove
+func ListProtectedEnvKeys(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	keys, err := api.Apps.ListProtectedEnvKeys(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve protected environment variables: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Protected environment variables retrieved successfully",
+		fiber.Map{
+			"app_name":       appName,
+			"protected_keys": keys,
+		},
+	))
+}
+
+// ProtectEnvKeys protects env keys of an app: only admins can change or remove them from then on,
+// and their values are masked for other users. Keys don't have to be set yet.
+func ProtectEnvKeys(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		Keys []string `json:"keys"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if len(req.Keys) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"At least one environment variable key is required",
+			nil,
+		))
+	}
+	for _, key := range req.Keys {
+		if !envKeyPattern.MatchString(key) {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				fmt.Sprintf("Invalid environment variable key %q", key),
+				nil,
+			))
+		}
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	for _, key := range req.Keys {
+		if err := api.Apps.ProtectEnvKey(c.Context(), appName, key, userID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+				false,
+				"Failed to protect environment variables: "+err.Error(),
+				nil,
+			))
+		}
+	}
+
+	sort.Strings(req.Keys)
+	message := "Protected environment variables " + strings.Join(req.Keys, ", ")
+	if activity, err := database.LogConfigActivity(appName, "protected_env", message, userID); err != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log protected env activity: %v\n", err)
+	} else {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+	auditSystemAction(c, "env_protect", appName, map[string]interface{}{"keys": req.Keys}, nil)
+
+	return ListProtectedEnvKeys(c)
+}
+
+// UnprotectEnvKey lets any user change or remove an env key of an app again
+func UnprotectEnvKey(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	key := c.Params("key")
+	if appName == "" || key == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name and key are required",
+			nil,
+		))
+	}
+
+	err := api.Apps.UnprotectEnvKey(c.Context(), appName, key)
+	if errors.Is(err, api.ErrProtectedEnvKeyNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Environment variable "+key+" is not protected",
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to unprotect environment variable: "+err.Error(),
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if activity, err := database.LogConfigActivity(appName, "protected_env", "Unprotected environment variable "+key, userID); err != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log protected env activity: %v\n", err)
+	} else {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+	auditSystemAction(c, "env_unprotect", appName, map[string]interface{}{"key": key}, nil)
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Environment variable "+key+" is no longer protected",
+		fiber.Map{"app_name": appName, "key": key},
+	))
+}
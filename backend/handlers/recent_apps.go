@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// defaultRecentApps is how many recent apps are listed when no limit is given
+	defaultRecentApps = 10
+	// maxRecentApps bounds the limit of the recent apps list
+	maxRecentApps = 50
+)
+
+// recordAppInteraction records in the background that the current user interacted with an app,
+// so the request isn't slowed down; failures are only logged
+func recordAppInteraction(c *fiber.Ctx, appName string, interaction api.InteractionType) {
+	userID, ok := c.Locals("user_id").(int)
+	if !ok || appName == "" {
+		return
+	}
+
+	// Fiber reuses the memory of route params once the handler returns
+	appName = strings.Clone(appName)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := api.Users.RecordAppInteraction(ctx, userID, appName, interaction); err != nil {
+			utils.DebugLog("Failed to record %s interaction of user %d with %s: %v", interaction, userID, appName, err)
+		}
+	}()
+}
+
+// GetRecentApps lists the apps the current user recently deployed, viewed the logs of or edited
+// the environment of, most recent first. Apps that no longer exist are skipped.
+func GetRecentApps(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"User not authenticated",
+			nil,
+		))
+	}
+
+	limit := c.QueryInt("limit", defaultRecentApps)
+	if limit <= 0 || limit > maxRecentApps {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"limit must be between 1 and 50",
+			nil,
+		))
+	}
+
+	recent, err := api.Users.ListRecentApps(context.Background(), userID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve recent apps: "+err.Error(),
+			nil,
+		))
+	}
+
+	// Apps destroyed outside Citizen still have interactions, hide them
+	if apps, err := utils.ListApps(); err == nil {
+		existing := make(map[string]bool, len(apps))
+		for _, name := range apps {
+			existing[name] = true
+		}
+		filtered := recent[:0]
+		for _, app := range recent {
+			if existing[app.AppName] {
+				filtered = append(filtered, app)
+			}
+		}
+		recent = filtered
+	} else {
+		utils.WarnLog("Failed to list apps for recent apps: %v", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Recent apps retrieved successfully",
+		recent,
+	))
+}
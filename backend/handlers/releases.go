@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// maxChangelogReleases bounds the tag deployments read to build a changelog
+	maxChangelogReleases = 500
+	// defaultReleasesPerPage and maxReleasesPerPage bound a page of the release timeline
+	defaultReleasesPerPage = 20
+	maxReleasesPerPage     = 100
+	// maxReleasesWithLogs bounds a page of releases returned with their build logs
+	maxReleasesWithLogs = 20
+	// maxReleaseNameLength bounds a release name
+	maxReleaseNameLength = 100
+)
+
+// releaseNumberPattern matches release references by number, which names can't look like
+var releaseNumberPattern = regexp.MustCompile(`^[vV]?[0-9]+$`)
+
+// validateReleaseName checks a trimmed release name can reference a release
+func validateReleaseName(name string) error {
+	switch {
+	case len(name) > maxReleaseNameLength:
+		return fmt.Errorf("release name must be at most %d characters", maxReleaseNameLength)
+	case releaseNumberPattern.MatchString(name):
+		return fmt.Errorf("release name %q looks like a release number", name)
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		return fmt.Errorf("release name must not contain control characters")
+	}
+	return nil
+}
+
+// appRelease is a deployment of an app in its release timeline
+type appRelease struct {
+	api.DeploymentRecord
+	// Current is set for the release serving traffic, the last successful one
+	Current bool   `json:"current"`
+	LogsURL string `json:"logs_url"`
+}
+
+// ListReleases returns the release timeline of an app, one entry per deployment with its commit,
+// branch, status and duration, newest first. It is paginated with page and per_page, filtered with
+// status, branch and tag (* for any tag), and with_logs=true adds the build logs.
+func ListReleases(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	withLogs := c.QueryBool("with_logs")
+	perPage := c.QueryInt("per_page", defaultReleasesPerPage)
+	if perPage < 1 || perPage > maxReleasesPerPage {
+		perPage = defaultReleasesPerPage
+	}
+	if withLogs && perPage > maxReleasesWithLogs {
+		perPage = maxReleasesWithLogs
+	}
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+
+	filter := api.ReleaseFilter{Status: c.Query("status"), Branch: c.Query("branch"), Tag: c.Query("tag")}
+	records, total, err := api.Deployments.ListReleases(c.Context(), appName, filter, perPage, (page-1)*perPage, withLogs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve releases: "+err.Error(),
+			nil,
+		))
+	}
+
+	currentID := 0
+	if current, err := api.Deployments.GetLatestSuccessfulDeployment(c.Context(), appName); err == nil && current != nil {
+		currentID = current.ID
+	}
+	releases := make([]appRelease, 0, len(records))
+	for _, record := range records {
+		releases = append(releases, appRelease{
+			DeploymentRecord: record,
+			Current:          record.ID == currentID,
+			LogsURL:          deploymentLogsURL(appName, record.ID),
+		})
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Releases retrieved successfully",
+		fiber.Map{
+			"app_name":    appName,
+			"releases":    releases,
+			"total":       total,
+			"page":        page,
+			"per_page":    perPage,
+			"total_pages": (total + perPage - 1) / perPage,
+		},
+	))
+}
+
+// GetChangelog returns the tags deployed to an app, newest first, each with the tag deployed
+// before it and a GitHub compare link between them
+func GetChangelog(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	records, err := api.Deployments.ListTaggedReleases(c.Context(), appName, maxChangelogReleases)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve changelog: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Changelog retrieved successfully",
+		fiber.Map{
+			"app_name": appName,
+			"entries":  utils.BuildChangelog(records),
+		},
+	))
+}
+
+// releaseFromParams loads the release addressed by :app_name and :release, a release number
+// (42 or v42), a release name or a git tag. When it returns nil the error response was already sent.
+func releaseFromParams(c *fiber.Ctx) (*api.DeploymentRecord, error) {
+	appName := c.Params("app_name")
+	release := c.Params("release")
+	if appName == "" || release == "" {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name and release are required",
+			nil,
+		))
+	}
+
+	record, err := api.Deployments.FindRelease(c.Context(), appName, release)
+	if errors.Is(err, api.ErrDeploymentRecordNotFound) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("Release %s not found", release),
+			nil,
+		))
+	}
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve release: "+err.Error(),
+			nil,
+		))
+	}
+	return record, nil
+}
+
+// GetRelease returns a release of an app by number, name or tag
+func GetRelease(c *fiber.Ctx) error {
+	record, err := releaseFromParams(c)
+	if record == nil {
+		return err
+	}
+
+	current := false
+	if latest, err := api.Deployments.GetLatestSuccessfulDeployment(c.Context(), record.AppName); err == nil && latest != nil {
+		current = latest.ID == record.ID
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Release "+record.ReleaseLabel()+" retrieved successfully",
+		appRelease{
+			DeploymentRecord: *record,
+			Current:          current,
+			LogsURL:          deploymentLogsURL(record.AppName, record.ID),
+		},
+	))
+}
+
+// SetReleaseName names a release so it can be referenced by name, an empty name removes it
+func SetReleaseName(c *fiber.Ctx) error {
+	record, err := releaseFromParams(c)
+	if record == nil {
+		return err
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	name := strings.TrimSpace(req.Name)
+	if err := validateReleaseName(name); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	err = database.NameRelease(record, name)
+	auditSystemAction(c, "release.rename", record.AppName, map[string]interface{}{
+		"release_number": record.ReleaseNumber,
+		"deployment_id":  record.ID,
+		"name":           name,
+	}, err)
+	if errors.Is(err, api.ErrReleaseNameTaken) {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("Another release of %s is already named %s", record.AppName, name),
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to name release: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		fmt.Sprintf("Release v%d renamed successfully", record.ReleaseNumber),
+		record,
+	))
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"backend/database"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetRuntimeVersions lists the runtimes and versions an app can be pinned to
+func GetRuntimeVersions(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Runtime versions retrieved successfully",
+		utils.RuntimeVersions,
+	))
+}
+
+// GetAppRuntime returns the runtime pins of an app, the versions its repository declares and
+// the pins that conflict with them
+func GetAppRuntime(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	env, err := utils.GetEnv(appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to get environment variables: "+err.Error(),
+			nil,
+		))
+	}
+	pins := utils.RuntimePinsFromEnv(env)
+
+	declarations, conflicts, detectionErr := appRuntimeConflicts(c, appName, pins)
+	data := fiber.Map{
+		"app_name":     appName,
+		"pins":         pins,
+		"declarations": declarations,
+		"conflicts":    conflicts,
+	}
+	if detectionErr != nil {
+		data["detection_error"] = detectionErr.Error()
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Runtime pins retrieved successfully",
+		data,
+	))
+}
+
+// SetAppRuntime pins runtime versions of an app, e.g. {"node": "20", "python": "3.12"}. The pins
+// are set as the config vars each builder reads, which restarts the app; they apply from the next
+// deploy. Conflicts with the repository's declared versions are returned as warnings.
+func SetAppRuntime(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var pins map[string]string
+	if err := c.BodyParser(&pins); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if len(pins) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"At least one runtime version is required",
+			nil,
+		))
+	}
+
+	envVars := make(map[string]string)
+	for runtime, version := range pins {
+		version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+		if err := utils.ValidateRuntimePin(runtime, version); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+		}
+		pins[runtime] = version
+		for key, value := range utils.RuntimePinEnv(runtime, version) {
+			envVars[key] = value
+		}
+	}
+
+	var userID *int
+	if userIDValue := c.Locals("user_id"); userIDValue != nil {
+		if uid, ok := userIDValue.(int); ok {
+			userID = &uid
+		}
+	}
+
+	activity, activityErr := database.LogConfigActivity(appName, "runtime", "Pinning runtime versions: "+formatRuntimePins(pins), userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log runtime activity: %v\n", activityErr)
+	}
+
+	output, err := utils.SetEnv(appName, envVars)
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while pinning runtime versions: "+err.Error(),
+			nil,
+		))
+	}
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	declarations, conflicts, detectionErr := appRuntimeConflicts(c, appName, pins)
+	data := fiber.Map{
+		"app_name":     appName,
+		"pins":         pins,
+		"env_vars":     envVars,
+		"declarations": declarations,
+		"conflicts":    conflicts,
+		"output":       output,
+	}
+	if detectionErr != nil {
+		data["detection_error"] = detectionErr.Error()
+	}
+
+	message := "Runtime versions pinned successfully, they apply from the next deploy"
+	if len(conflicts) > 0 {
+		message = fmt.Sprintf("Runtime versions pinned with %d conflict(s) with the repository", len(conflicts))
+	}
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(true, message, data))
+}
+
+// RemoveAppRuntime removes the pin of one runtime from an app
+func RemoveAppRuntime(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	runtime := c.Params("runtime")
+	keys := utils.RuntimePinEnvKeys(runtime)
+	if len(keys) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Unknown runtime: "+runtime,
+			nil,
+		))
+	}
+
+	var userID *int
+	if userIDValue := c.Locals("user_id"); userIDValue != nil {
+		if uid, ok := userIDValue.(int); ok {
+			userID = &uid
+		}
+	}
+
+	activity, activityErr := database.LogConfigActivity(appName, "runtime", "Removing the "+runtime+" runtime pin", userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log runtime activity: %v\n", activityErr)
+	}
+
+	env, err := utils.GetEnv(appName)
+	if err == nil {
+		for _, key := range keys {
+			if _, exists := env[key]; !exists {
+				continue
+			}
+			if _, err = utils.RemoveEnv(appName, key); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while removing the runtime pin: "+err.Error(),
+			nil,
+		))
+	}
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Runtime pin removed successfully",
+		fiber.Map{
+			"app_name": appName,
+			"runtime":  runtime,
+		},
+	))
+}
+
+// appRuntimeConflicts reads the runtime versions declared in an app's repository and checks the
+// pins against them. Apps without a GitHub source have no declarations.
+func appRuntimeConflicts(c *fiber.Ctx, appName string, pins map[string]string) ([]utils.RuntimeDeclaration, []utils.RuntimeConflict, error) {
+	gitURL, branch, err := appGitSource(appName)
+	if err != nil {
+		return []utils.RuntimeDeclaration{}, []utils.RuntimeConflict{}, err
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+
+	declarations, err := utils.DetectRuntimeDeclarations(gitURL, branch, userID)
+	if err != nil {
+		return []utils.RuntimeDeclaration{}, []utils.RuntimeConflict{}, err
+	}
+	return declarations, utils.RuntimeConflicts(pins, declarations), nil
+}
+
+// formatRuntimePins formats pins as "node 20, python 3.12"
+func formatRuntimePins(pins map[string]string) string {
+	parts := make([]string, 0, len(pins))
+	for runtime, version := range pins {
+		parts = append(parts, runtime+" "+version)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"backend/database"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetScalingRecommendations returns the scaling changes suggested by the recent usage of an app,
+// along with the usage samples they are based on
+func GetScalingRecommendations(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	recommendations, err := utils.GetScalingRecommendations(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to get scaling recommendations: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Scaling recommendations retrieved successfully",
+		fiber.Map{
+			"app_name":        appName,
+			"recommendations": recommendations,
+			"usage":           utils.Usage.AppUsage(appName),
+		},
+	))
+}
+
+// ApplyScalingRecommendation applies a recommendation that still holds for the current usage
+func ApplyScalingRecommendation(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+	id := c.Params("id")
+
+	recommendations, err := utils.GetScalingRecommendations(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to get scaling recommendations: "+err.Error(),
+			nil,
+		))
+	}
+	var recommendation *utils.ScalingRecommendation
+	for i := range recommendations {
+		if recommendations[i].ID == id {
+			recommendation = &recommendations[i]
+		}
+	}
+	if recommendation == nil {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"No such recommendation for this app, the usage it was based on may have changed",
+			fiber.Map{"recommendations": recommendations},
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+
+	message := fmt.Sprintf("Scale %s %s from %d to %d", recommendation.ProcessType, recommendation.Kind,
+		recommendation.Current, recommendation.Recommended)
+	activity, activityErr := database.LogActivity(appName, database.ActivityConfig, database.StatusPending, message,
+		map[string]interface{}{
+			"config_type":    "scaling",
+			"recommendation": recommendation,
+		}, userID, database.TriggerManual)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log scaling activity: %v\n", activityErr)
+	}
+
+	output, err := utils.ApplyScalingRecommendation(c.UserContext(), appName, *recommendation)
+	if err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to apply recommendation: "+err.Error(),
+			fiber.Map{"output": output},
+		))
+	}
+	if activity != nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+	if recommendation.RequiresRestart {
+		clearPendingRestart(appName)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Recommendation applied",
+		fiber.Map{
+			"app_name":       appName,
+			"recommendation": recommendation,
+			"output":         strings.TrimSpace(output),
+		},
+	))
+}
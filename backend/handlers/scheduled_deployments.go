@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxScheduleAhead bounds how far in the future a deployment can be scheduled
+const maxScheduleAhead = 90 * 24 * time.Hour
+
+// ListScheduledDeployments lists the deployments of an app waiting for their time, or with
+// ?all=true also those that started or were cancelled
+func ListScheduledDeployments(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	scheduled, err := api.Deployments.ListScheduledDeployments(c.Context(), appName, c.QueryBool("all"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list scheduled deployments: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Scheduled deployments retrieved successfully",
+		fiber.Map{"app_name": appName, "scheduled_deployments": scheduled, "total": len(scheduled)},
+	))
+}
+
+// CreateScheduledDeployment schedules a deployment of a git branch, optionally pinned to a commit,
+// at scheduled_at (RFC 3339), or at the next HH:MM of at in timezone (UTC by default), e.g. to
+// deploy main at 02:00. The branch defaults to the deploy branch of the connected repository.
+func CreateScheduledDeployment(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		GitURL      string `json:"git_url"`
+		GitBranch   string `json:"git_branch"`
+		GitCommit   string `json:"git_commit"`
+		ScheduledAt string `json:"scheduled_at"`
+		At          string `json:"at"`
+		Timezone    string `json:"timezone"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	if req.GitURL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Git URL is required",
+			nil,
+		))
+	}
+	req.GitCommit = strings.ToLower(strings.TrimSpace(req.GitCommit))
+	if req.GitCommit != "" && !utils.IsCommitSHA(req.GitCommit) {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Git commit must be a commit SHA of 7 to 40 hex characters",
+			nil,
+		))
+	}
+
+	now := time.Now()
+	scheduledAt, err := parseDeploymentSchedule(req.ScheduledAt, req.At, req.Timezone, now)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+	}
+	if !scheduledAt.After(now) {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"The deployment must be scheduled in the future",
+			nil,
+		))
+	}
+	if scheduledAt.Sub(now) > maxScheduleAhead {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("Deployments can be scheduled at most %d days ahead", int(maxScheduleAhead.Hours()/24)),
+			nil,
+		))
+	}
+
+	apps, err := utils.ListApps()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list apps: "+err.Error(),
+			nil,
+		))
+	}
+	if !slices.Contains(apps, appName) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("App %s does not exist", appName),
+			nil,
+		))
+	}
+
+	if req.GitBranch == "" {
+		req.GitBranch = "main"
+		if branch, err := api.GitHub.GetGitHubRepositoryDeployBranch(c.Context(), appName); err == nil && branch != "" {
+			req.GitBranch = branch
+		}
+	}
+
+	// The repository is checked now rather than failing at the scheduled time
+	if sourceCheck, err := utils.ValidateGitSource(c.UserContext(), req.GitURL, req.GitBranch); err != nil {
+		status := fiber.StatusUnprocessableEntity
+		if errors.Is(err, utils.ErrGitSourceRejected) {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			fiber.Map{"git_source": sourceCheck},
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+
+	scheduled := &api.ScheduledDeployment{
+		AppName:     appName,
+		GitURL:      req.GitURL,
+		GitBranch:   req.GitBranch,
+		GitCommit:   req.GitCommit,
+		ScheduledAt: scheduledAt,
+		CreatedBy:   userID,
+	}
+	message := fmt.Sprintf("Scheduled a deployment of %s for %s", req.GitBranch, scheduledAt.UTC().Format(time.RFC3339))
+	activity, activityErr := database.LogConfigActivity(appName, "scheduled_deployment", message, userID)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log scheduled deployment activity: %v\n", activityErr)
+	}
+
+	err = api.Deployments.CreateScheduledDeployment(c.Context(), scheduled)
+	if activity != nil {
+		var errorMsg *string
+		status := database.StatusSuccess
+		if err != nil {
+			text := err.Error()
+			errorMsg = &text
+			status = database.StatusError
+		}
+		database.UpdateActivity(activity.ID, status, errorMsg)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to schedule deployment: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(utils.NewCitizenResponse(
+		true,
+		message,
+		scheduled,
+	))
+}
+
+// CancelScheduledDeployment cancels a scheduled deployment that hasn't started yet
+func CancelScheduledDeployment(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid scheduled deployment ID",
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+
+	err = api.Deployments.CancelScheduledDeployment(c.Context(), appName, id, userID)
+	if errors.Is(err, api.ErrScheduledDeploymentNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Scheduled deployment not found",
+			nil,
+		))
+	}
+	if errors.Is(err, api.ErrScheduledDeploymentStarted) {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("Scheduled deployment %d already started or was cancelled", id),
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to cancel scheduled deployment: "+err.Error(),
+			nil,
+		))
+	}
+
+	if activity, err := database.LogConfigActivity(appName, "scheduled_deployment",
+		fmt.Sprintf("Cancelled scheduled deployment %d", id), userID); err == nil {
+		database.UpdateActivity(activity.ID, database.StatusSuccess, nil)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		fmt.Sprintf("Scheduled deployment %d cancelled", id),
+		fiber.Map{"app_name": appName, "id": id},
+	))
+}
+
+// parseDeploymentSchedule returns the time of a scheduled deployment, given either as an RFC 3339
+// time or as the HH:MM of a time zone, which is its next occurrence after now
+func parseDeploymentSchedule(scheduledAt, at, timezone string, now time.Time) (time.Time, error) {
+	switch {
+	case scheduledAt != "" && at != "":
+		return time.Time{}, errors.New("give either scheduled_at or at, not both")
+	case scheduledAt != "":
+		parsed, err := time.Parse(time.RFC3339, scheduledAt)
+		if err != nil {
+			return time.Time{}, errors.New("scheduled_at must be an RFC 3339 time like 2026-10-17T02:00:00Z")
+		}
+		return parsed, nil
+	case at == "":
+		return time.Time{}, errors.New("scheduled_at or at is required")
+	}
+
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return time.Time{}, errors.New("at must be a time of day like 02:00")
+	}
+	location := time.UTC
+	if timezone != "" {
+		if location, err = time.LoadLocation(timezone); err != nil || timezone == "Local" {
+			return time.Time{}, fmt.Errorf("unknown time zone %q, use an IANA name like Europe/Paris", timezone)
+		}
+	}
+
+	local := now.In(location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, location)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+// RunDueScheduledDeployments starts the scheduled deployments whose time has come, each in the
+// background, and returns how many were started
+func RunDueScheduledDeployments(ctx context.Context) (int, error) {
+	due, err := api.Deployments.ClaimDueScheduledDeployments(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for _, scheduled := range due {
+		go runScheduledDeployment(scheduled)
+	}
+	return len(due), nil
+}
+
+// runScheduledDeployment deploys a scheduled deployment like a manual one of its creator, whose
+// GitHub connection authenticates git, and records the outcome on the schedule
+func runScheduledDeployment(scheduled api.ScheduledDeployment) {
+	appName, userID := scheduled.AppName, scheduled.CreatedBy
+	log.Printf("[DEPLOY] ⏰ Starting scheduled deployment %d of %s", scheduled.ID, appName)
+
+	diagnostics := utils.NewDeployDiagnostics()
+	diagnostics.Info("schedule", "scheduled for %s", scheduled.ScheduledAt.UTC().Format(time.RFC3339))
+
+	ref := scheduled.GitBranch
+	var portHint *utils.PortDetectionHint
+	if scheduled.GitCommit != "" {
+		ref = scheduled.GitCommit
+		portHint = &utils.PortDetectionHint{CommitSHA: scheduled.GitCommit}
+		diagnostics.Info("git", "pinned to commit %s", scheduled.GitCommit)
+	}
+
+	finish := func(status string, record *api.DeploymentRecord, deployErr error) {
+		var deploymentID *int
+		if record != nil {
+			deploymentID = &record.ID
+		}
+		errorMessage := ""
+		if deployErr != nil {
+			errorMessage = deployErr.Error()
+		}
+		if err := api.Deployments.FinishScheduledDeployment(context.Background(), scheduled.ID, status, deploymentID, errorMessage); err != nil {
+			log.Printf("[DEPLOY] ⚠️ Failed to record the outcome of scheduled deployment %d: %v", scheduled.ID, err)
+		}
+	}
+
+	activity, activityErr := database.LogDeployActivity(appName, scheduled.GitURL, scheduled.GitBranch, scheduled.GitCommit,
+		"Scheduled deployment", userID, database.TriggerScheduled)
+	if activityErr != nil {
+		fmt.Printf("[ACTIVITY] ⚠️ Failed to log deploy activity: %v\n", activityErr)
+	}
+
+	if err := database.CheckBuildQuota(context.Background(), appName, userID); err != nil {
+		if activity != nil {
+			errorMsg := err.Error()
+			database.UpdateActivity(activity.ID, database.StatusError, &errorMsg)
+		}
+		finish(api.ScheduledDeploymentError, nil, err)
+		return
+	}
+
+	detectAndApplyPort(diagnostics, appName, scheduled.GitURL, scheduled.GitBranch, userID, portHint, "")
+
+	record, recordErr := database.StartDeploymentRecord(appName, scheduled.GitURL, scheduled.GitBranch, scheduled.GitCommit, "",
+		activity, userID, database.TriggerScheduled)
+	if recordErr != nil {
+		fmt.Printf("[DEPLOY] ⚠️ Failed to record deployment: %v\n", recordErr)
+	}
+
+	if _, err := runRecordedDeployment(diagnostics, record, appName, scheduled.GitURL, ref, activity, userID); err != nil {
+		log.Printf("[DEPLOY] ❌ Scheduled deployment %d of %s failed: %v", scheduled.ID, appName, err)
+		finish(api.ScheduledDeploymentError, record, err)
+		return
+	}
+	log.Printf("[DEPLOY] ✅ Scheduled deployment %d of %s succeeded", scheduled.ID, appName)
+	finish(api.ScheduledDeploymentSuccess, record, nil)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"backend/database/api"
+	"backend/scheduler"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListScheduledTasks returns the schedule and last-run status of all background tasks
+func ListScheduledTasks(c *fiber.Ctx) error {
+	tasks := scheduler.Default.StatusAll()
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Scheduled tasks fetched successfully",
+		fiber.Map{
+			"tasks": tasks,
+			"total": len(tasks),
+		},
+	))
+}
+
+// GetScheduledTask returns the status of a single background task
+func GetScheduledTask(c *fiber.Ctx) error {
+	taskName := c.Params("task_name")
+
+	status, err := scheduler.Default.Status(taskName)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Task not found: "+taskName,
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Scheduled task fetched successfully",
+		status,
+	))
+}
+
+// RunScheduledTask triggers a background task on demand
+func RunScheduledTask(c *fiber.Ctx) error {
+	taskName := c.Params("task_name")
+
+	err := scheduler.Default.Trigger(taskName)
+	if errors.Is(err, scheduler.ErrTaskNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Task not found: "+taskName,
+			nil,
+		))
+	}
+	if errors.Is(err, scheduler.ErrTaskAlreadyRunning) {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			"Task is already running: "+taskName,
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while triggering task: "+err.Error(),
+			nil,
+		))
+	}
+
+	utils.InfoLog("Scheduled task %s triggered manually by user %v", taskName, c.Locals("user_id"))
+
+	return c.Status(fiber.StatusAccepted).JSON(utils.NewCitizenResponse(
+		true,
+		"Task triggered successfully",
+		fiber.Map{
+			"task_name": taskName,
+		},
+	))
+}
+
+// UpdateScheduledTaskInterval changes a task interval and persists it to system settings
+func UpdateScheduledTaskInterval(c *fiber.Ctx) error {
+	taskName := c.Params("task_name")
+
+	var req struct {
+		Interval string `json:"interval"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	interval, err := time.ParseDuration(req.Interval)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid interval, expected a duration such as 30s, 5m or 1h",
+			nil,
+		))
+	}
+
+	if err := scheduler.Default.SetInterval(taskName, interval); err != nil {
+		if errors.Is(err, scheduler.ErrTaskNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+				false,
+				"Task not found: "+taskName,
+				nil,
+			))
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	if err := api.Settings.SetSystemSetting(context.Background(), scheduler.IntervalSettingKey(taskName), interval.String()); err != nil {
+		utils.WarnLog("Failed to persist interval for task %s: %v", taskName, err)
+	}
+
+	status, _ := scheduler.Default.Status(taskName)
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Task interval updated successfully",
+		status,
+	))
+}
@@ -0,0 +1,895 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	scimSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	scimContentType = "application/scim+json"
+
+	defaultSCIMPageSize = 100
+	maxSCIMPageSize     = 200
+	maxSCIMUsername     = 50
+
+	// inactiveUsersTTL bounds how long a session of a user deactivated on another instance keeps working
+	inactiveUsersTTL = 30 * time.Second
+)
+
+// scimFilterPattern matches the only filters identity providers need, attribute eq "value"
+var scimFilterPattern = regexp.MustCompile(`(?i)^\s*([a-z][a-z0-9.]*)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// scimMemberPathPattern matches the path removing one member of a group, members[value eq "12"]
+var scimMemberPathPattern = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([0-9]+)"\s*\]$`)
+
+// inactiveUsers caches the users that can't sign in, checked by ForwardAuth on every request
+var inactiveUsers = struct {
+	sync.Mutex
+	ids       map[int]bool
+	fetchedAt time.Time
+}{}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimRef struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type scimUserRequest struct {
+	UserName   string      `json:"userName"`
+	ExternalID string      `json:"externalId"`
+	Active     interface{} `json:"active"`
+	Emails     []scimEmail `json:"emails"`
+	Password   string      `json:"password"`
+}
+
+type scimGroupRequest struct {
+	DisplayName string    `json:"displayName"`
+	ExternalID  string    `json:"externalId"`
+	Members     []scimRef `json:"members"`
+}
+
+type scimPatchRequest struct {
+	Operations []struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	} `json:"Operations"`
+}
+
+// scimError answers a SCIM request with an error in the format SCIM clients expect
+func scimError(c *fiber.Ctx, status int, scimType, detail string) error {
+	body := fiber.Map{
+		"schemas": []string{scimSchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	return scimJSON(c, status, body)
+}
+
+func scimJSON(c *fiber.Ctx, status int, body interface{}) error {
+	if err := c.Status(status).JSON(body); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, scimContentType)
+	return nil
+}
+
+// scimLocation returns the URL of a SCIM resource
+func scimLocation(c *fiber.Ctx, resource string, id int) string {
+	return fmt.Sprintf("%s/api/v1/scim/v2/%s/%d", c.BaseURL(), resource, id)
+}
+
+func scimUserResource(c *fiber.Ctx, user *api.SCIMUser) fiber.Map {
+	resource := fiber.Map{
+		"schemas":  []string{scimSchemaUser},
+		"id":       strconv.Itoa(user.ID),
+		"userName": user.Username,
+		"active":   user.Active,
+		"meta": fiber.Map{
+			"resourceType": "User",
+			"created":      user.CreatedAt.UTC().Format(time.RFC3339),
+			"lastModified": user.UpdatedAt.UTC().Format(time.RFC3339),
+			"location":     scimLocation(c, "Users", user.ID),
+		},
+	}
+	if user.ExternalID != "" {
+		resource["externalId"] = user.ExternalID
+	}
+	if user.Email != "" {
+		resource["emails"] = []scimEmail{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	groups := make([]scimRef, 0, len(user.Groups))
+	for _, group := range user.Groups {
+		groups = append(groups, scimRef{Value: strconv.Itoa(group.ID), Display: group.DisplayName})
+	}
+	resource["groups"] = groups
+	return resource
+}
+
+func scimGroupResource(c *fiber.Ctx, group *api.SCIMGroup, withMembers bool) fiber.Map {
+	resource := fiber.Map{
+		"schemas":     []string{scimSchemaGroup},
+		"id":          strconv.Itoa(group.ID),
+		"displayName": group.DisplayName,
+		"meta": fiber.Map{
+			"resourceType": "Group",
+			"created":      group.CreatedAt.UTC().Format(time.RFC3339),
+			"lastModified": group.UpdatedAt.UTC().Format(time.RFC3339),
+			"location":     scimLocation(c, "Groups", group.ID),
+		},
+	}
+	if group.ExternalID != "" {
+		resource["externalId"] = group.ExternalID
+	}
+	if withMembers {
+		members := make([]scimRef, 0, len(group.Members))
+		for _, member := range group.Members {
+			members = append(members, scimRef{Value: strconv.Itoa(member.UserID), Display: member.Username})
+		}
+		resource["members"] = members
+	}
+	return resource
+}
+
+// SCIMAuth lets the identity provider in with the SCIM bearer token, SCIM answers 404 until an
+// admin generates one
+func SCIMAuth(c *fiber.Ctx) error {
+	config := utils.GetSCIMConfig(c.Context())
+	if !config.Enabled() {
+		return scimError(c, fiber.StatusNotFound, "", "SCIM provisioning is not enabled")
+	}
+
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || !config.CheckToken(strings.TrimSpace(token)) {
+		utils.SecurityLog("Invalid SCIM token from %s", utils.ClientIP(c))
+		return scimError(c, fiber.StatusUnauthorized, "", "Invalid SCIM token")
+	}
+
+	c.Locals("scim_config", config)
+	return c.Next()
+}
+
+func scimConfig(c *fiber.Ctx) *utils.SCIMConfig {
+	if config, ok := c.Locals("scim_config").(*utils.SCIMConfig); ok {
+		return config
+	}
+	return utils.GetSCIMConfig(c.Context())
+}
+
+// scimPage returns the offset and limit of the startIndex and count query parameters
+func scimPage(c *fiber.Ctx) (startIndex, offset, limit int) {
+	startIndex = c.QueryInt("startIndex", 1)
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	limit = c.QueryInt("count", defaultSCIMPageSize)
+	if limit < 0 {
+		limit = 0
+	}
+	if limit > maxSCIMPageSize {
+		limit = maxSCIMPageSize
+	}
+	return startIndex, startIndex - 1, limit
+}
+
+// parseSCIMFilter returns the attribute, lowercased, and value of a filter
+func parseSCIMFilter(filter string) (string, string, error) {
+	match := scimFilterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", fmt.Errorf(`unsupported filter %q, only attribute eq "value" is supported`, filter)
+	}
+	value, err := strconv.Unquote(match[2])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid filter value %s", match[2])
+	}
+	return strings.ToLower(match[1]), value, nil
+}
+
+func scimListResponse(c *fiber.Ctx, resources []fiber.Map, total, startIndex int) error {
+	return scimJSON(c, fiber.StatusOK, fiber.Map{
+		"schemas":      []string{scimSchemaListResponse},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	})
+}
+
+// isInstanceAdmin reports whether a username is the admin configured by ADMIN_USERNAME, which the
+// identity provider can't change or lock out
+func isInstanceAdmin(username string) bool {
+	admin := os.Getenv("ADMIN_USERNAME")
+	return admin != "" && username == admin
+}
+
+// ListSCIMUsers lists users for the identity provider, which filters by userName to match its
+// users to existing ones
+func ListSCIMUsers(c *fiber.Ctx) error {
+	var filter api.SCIMFilter
+	if raw := c.Query("filter"); raw != "" {
+		attr, value, err := parseSCIMFilter(raw)
+		if err != nil {
+			return scimError(c, fiber.StatusBadRequest, "invalidFilter", err.Error())
+		}
+		switch attr {
+		case "username":
+			filter.Username = value
+		case "externalid":
+			filter.ExternalID = value
+		case "emails", "emails.value":
+			filter.Email = value
+		default:
+			return scimError(c, fiber.StatusBadRequest, "invalidFilter", fmt.Sprintf("filtering users by %s is not supported", attr))
+		}
+	}
+
+	startIndex, offset, limit := scimPage(c)
+	users, total, err := api.Users.ListSCIMUsers(c.Context(), filter, offset, limit)
+	if err != nil {
+		return scimError(c, fiber.StatusInternalServerError, "", "Failed to list users: "+err.Error())
+	}
+
+	resources := make([]fiber.Map, 0, len(users))
+	for i := range users {
+		resources = append(resources, scimUserResource(c, &users[i]))
+	}
+	return scimListResponse(c, resources, total, startIndex)
+}
+
+// GetSCIMUser returns a user for the identity provider
+func GetSCIMUser(c *fiber.Ctx) error {
+	user, status, err := scimUserParam(c)
+	if err != nil {
+		return scimError(c, status, "", err.Error())
+	}
+	return scimJSON(c, fiber.StatusOK, scimUserResource(c, user))
+}
+
+// scimUserParam returns the user of the id route parameter
+func scimUserParam(c *fiber.Ctx) (*api.SCIMUser, int, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, fiber.StatusNotFound, api.ErrUserNotFound
+	}
+	user, err := api.Users.GetSCIMUser(c.Context(), id)
+	if errors.Is(err, api.ErrUserNotFound) {
+		return nil, fiber.StatusNotFound, err
+	}
+	if err != nil {
+		return nil, fiber.StatusInternalServerError, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, fiber.StatusOK, nil
+}
+
+// CreateSCIMUser provisions a user. Users sign in with the password the identity provider sends,
+// or one an admin sets when it sends none.
+func CreateSCIMUser(c *fiber.Ctx) error {
+	var req scimUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return scimError(c, fiber.StatusBadRequest, "invalidSyntax", "Invalid request content")
+	}
+
+	user := &api.SCIMUser{Active: true}
+	if err := applySCIMUserRequest(user, &req); err != nil {
+		return scimError(c, fiber.StatusBadRequest, "invalidValue", err.Error())
+	}
+	if isInstanceAdmin(user.Username) {
+		return scimError(c, fiber.StatusConflict, "uniqueness", "The instance admin can't be provisioned over SCIM")
+	}
+
+	password := req.Password
+	if password == "" {
+		password = generateSecureID()
+	}
+	passwordHash, err := utils.HashPassword(password)
+	if err != nil {
+		return scimError(c, fiber.StatusInternalServerError, "", "Failed to hash password")
+	}
+
+	err = api.Users.CreateSCIMUser(c.Context(), user, passwordHash)
+	if errors.Is(err, api.ErrSCIMConflict) {
+		return scimError(c, fiber.StatusConflict, "uniqueness", fmt.Sprintf("User %s already exists", user.Username))
+	}
+	if err != nil {
+		return scimError(c, fiber.StatusInternalServerError, "", "Failed to create user: "+err.Error())
+	}
+
+	setUserInactive(user.ID, !user.Active)
+	applySCIMRoles(c.Context(), scimConfig(c), []int{user.ID})
+	utils.SecurityLog("SCIM provisioned user %d (%s), active: %t", user.ID, user.Username, user.Active)
+	return scimJSON(c, fiber.StatusCreated, scimUserResource(c, user))
+}
+
+// ReplaceSCIMUser replaces the name, email, status and external ID of a user, which SCIM manages
+// from then on
+func ReplaceSCIMUser(c *fiber.Ctx) error {
+	user, status, err := scimUserParam(c)
+	if err != nil {
+		return scimError(c, status, "", err.Error())
+	}
+	if isInstanceAdmin(user.Username) {
+		return scimError(c, fiber.StatusForbidden, "mutability", "The instance admin is not managed over SCIM")
+	}
+
+	var req scimUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return scimError(c, fiber.StatusBadRequest, "invalidSyntax", "Invalid request content")
+	}
+	user.ExternalID = ""
+	user.Email = ""
+	if err := applySCIMUserRequest(user, &req); err != nil {
+		return scimError(c, fiber.StatusBadRequest, "invalidValue", err.Error())
+	}
+	return saveSCIMUser(c, user, req.Password)
+}
+
+// PatchSCIMUser applies a SCIM patch to a user, identity providers deactivate users this way.
+// Attributes Citizen doesn't store, like name, are ignored.
+func PatchSCIMUser(c *fiber.Ctx) error {
+	user, status, err := scimUserParam(c)
+	if err != nil {
+		return scimError(c, status, "", err.Error())
+	}
+	if isInstanceAdmin(user.Username) {
+		return scimError(c, fiber.StatusForbidden, "mutability", "The instance admin is not managed over SCIM")
+	}
+
+	var req scimPatchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return scimError(c, fiber.StatusBadRequest, "invalidSyntax", "Invalid request content")
+	}
+
+	password := ""
+	for _, op := range req.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			values := map[string]interface{}{}
+			if op.Path == "" {
+				object, ok := op.Value.(map[string]interface{})
+				if !ok {
+					return scimError(c, fiber.StatusBadRequest, "invalidValue", "A patch without a path needs an object value")
+				}
+				values = object
+			} else {
+				values[op.Path] = op.Value
+			}
+			for attr, value := range values {
+				if err := patchSCIMUserAttribute(user, attr, value, &password); err != nil {
+					return scimError(c, fiber.StatusBadRequest, "invalidValue", err.Error())
+				}
+			}
+		case "remove":
+			switch attr := strings.ToLower(op.Path); {
+			case attr == "externalid":
+				user.ExternalID = ""
+			case strings.HasPrefix(attr, "emails"):
+				user.Email = ""
+			}
+		default:
+			return scimError(c, fiber.StatusBadRequest, "invalidSyntax", fmt.Sprintf("Unsupported patch operation %q", op.Op))
+		}
+	}
+	if err := validateSCIMUsername(user.Username); err != nil {
+		return scimError(c, fiber.StatusBadRequest, "invalidValue", err.Error())
+	}
+	return saveSCIMUser(c, user, password)
+}
+
+// patchSCIMUserAttribute sets one attribute of a user from a patch value
+func patchSCIMUserAttribute(user *api.SCIMUser, attr string, value interface{}, password *string) error {
+	attr = strings.ToLower(attr)
+	switch {
+	case attr == "active":
+		active, ok := scimBool(value)
+		if !ok {
+			return fmt.Errorf("active must be true or false")
+		}
+		user.Active = active
+	case attr == "username":
+		user.Username, _ = value.(string)
+	case attr == "externalid":
+		user.ExternalID, _ = value.(string)
+	case attr == "password":
+		*password, _ = value.(string)
+	case strings.HasPrefix(attr, "emails"):
+		user.Email = scimEmailValue(value)
+	}
+	return nil
+}
+
+// scimBool reads a boolean some identity providers send as a string
+func scimBool(value interface{}) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(v)
+		return b, err == nil
+	}
+	return false, false
+}
+
+// scimEmailValue reads the primary email of an emails value, a list of emails or one address
+func scimEmailValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		email := ""
+		for _, item := range v {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			address, _ := entry["value"].(string)
+			if primary, _ := entry["primary"].(bool); primary || email == "" {
+				email = address
+			}
+		}
+		return email
+	}
+	return ""
+}
+
+// applySCIMUserRequest sets the attributes of a user sent in a full user representation
+func applySCIMUserRequest(user *api.SCIMUser, req *scimUserRequest) error {
+	user.Username = strings.TrimSpace(req.UserName)
+	if err := validateSCIMUsername(user.Username); err != nil {
+		return err
+	}
+	user.ExternalID = req.ExternalID
+	for _, email := range req.Emails {
+		if email.Primary || user.Email == "" {
+			user.Email = email.Value
+		}
+	}
+	if req.Active != nil {
+		active, ok := scimBool(req.Active)
+		if !ok {
+			return fmt.Errorf("active must be true or false")
+		}
+		user.Active = active
+	}
+	return nil
+}
+
+func validateSCIMUsername(username string) error {
+	if username == "" || len(username) > maxSCIMUsername {
+		return fmt.Errorf("userName must be between 1 and %d characters", maxSCIMUsername)
+	}
+	return nil
+}
+
+// saveSCIMUser stores a user changed over SCIM and ends its sessions when it was deactivated
+func saveSCIMUser(c *fiber.Ctx, user *api.SCIMUser, password string) error {
+	err := api.Users.UpdateSCIMUser(c.Context(), user)
+	if errors.Is(err, api.ErrSCIMConflict) {
+		return scimError(c, fiber.StatusConflict, "uniqueness", fmt.Sprintf("User %s already exists", user.Username))
+	}
+	if errors.Is(err, api.ErrUserNotFound) {
+		return scimError(c, fiber.StatusNotFound, "", err.Error())
+	}
+	if err != nil {
+		return scimError(c, fiber.StatusInternalServerError, "", "Failed to update user: "+err.Error())
+	}
+
+	if password != "" {
+		passwordHash, err := utils.HashPassword(password)
+		if err == nil {
+			err = api.Users.UpdateUserPassword(c.Context(), user.ID, passwordHash)
+		}
+		if err != nil {
+			return scimError(c, fiber.StatusInternalServerError, "", "Failed to update password: "+err.Error())
+		}
+	}
+
+	setUserInactive(user.ID, !user.Active)
+	if !user.Active {
+		clearUserSSOSessions(user.ID)
+		utils.SecurityLog("SCIM deactivated user %d (%s), sessions ended", user.ID, user.Username)
+	}
+	forgetIdentity(user.ID)
+	return scimJSON(c, fiber.StatusOK, scimUserResource(c, user))
+}
+
+// DeleteSCIMUser deactivates a user removed from the identity provider. The account is kept for
+// the deployments and activity pointing at it, and restored if the user is provisioned again.
+func DeleteSCIMUser(c *fiber.Ctx) error {
+	user, status, err := scimUserParam(c)
+	if err != nil {
+		return scimError(c, status, "", err.Error())
+	}
+	if isInstanceAdmin(user.Username) {
+		return scimError(c, fiber.StatusForbidden, "mutability", "The instance admin is not managed over SCIM")
+	}
+
+	if err := api.Users.DeleteSCIMUser(c.Context(), user.ID); err != nil {
+		if errors.Is(err, api.ErrUserNotFound) {
+			return scimError(c, fiber.StatusNotFound, "", err.Error())
+		}
+		return scimError(c, fiber.StatusInternalServerError, "", "Failed to delete user: "+err.Error())
+	}
+
+	setUserInactive(user.ID, true)
+	clearUserSSOSessions(user.ID)
+	applySCIMRoles(c.Context(), scimConfig(c), []int{user.ID})
+	utils.SecurityLog("SCIM deleted user %d (%s), account deactivated", user.ID, user.Username)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListSCIMGroups lists groups for the identity provider, without members when it asks with
+// excludedAttributes=members
+func ListSCIMGroups(c *fiber.Ctx) error {
+	var filter api.SCIMFilter
+	if raw := c.Query("filter"); raw != "" {
+		attr, value, err := parseSCIMFilter(raw)
+		if err != nil {
+			return scimError(c, fiber.StatusBadRequest, "invalidFilter", err.Error())
+		}
+		switch attr {
+		case "displayname":
+			filter.DisplayName = value
+		case "externalid":
+			filter.ExternalID = value
+		default:
+			return scimError(c, fiber.StatusBadRequest, "invalidFilter", fmt.Sprintf("filtering groups by %s is not supported", attr))
+		}
+	}
+	withMembers := !strings.Contains(strings.ToLower(c.Query("excludedAttributes")), "members")
+
+	startIndex, offset, limit := scimPage(c)
+	groups, total, err := api.Users.ListSCIMGroups(c.Context(), filter, offset, limit, withMembers)
+	if err != nil {
+		return scimError(c, fiber.StatusInternalServerError, "", "Failed to list groups: "+err.Error())
+	}
+
+	resources := make([]fiber.Map, 0, len(groups))
+	for i := range groups {
+		resources = append(resources, scimGroupResource(c, &groups[i], withMembers))
+	}
+	return scimListResponse(c, resources, total, startIndex)
+}
+
+// GetSCIMGroup returns a group with its members
+func GetSCIMGroup(c *fiber.Ctx) error {
+	group, status, err := scimGroupParam(c)
+	if err != nil {
+		return scimError(c, status, "", err.Error())
+	}
+	withMembers := !strings.Contains(strings.ToLower(c.Query("excludedAttributes")), "members")
+	return scimJSON(c, fiber.StatusOK, scimGroupResource(c, group, withMembers))
+}
+
+// scimGroupParam returns the group of the id route parameter
+func scimGroupParam(c *fiber.Ctx) (*api.SCIMGroup, int, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, fiber.StatusNotFound, api.ErrSCIMGroupNotFound
+	}
+	group, err := api.Users.GetSCIMGroup(c.Context(), id)
+	if errors.Is(err, api.ErrSCIMGroupNotFound) {
+		return nil, fiber.StatusNotFound, err
+	}
+	if err != nil {
+		return nil, fiber.StatusInternalServerError, fmt.Errorf("failed to get group: %w", err)
+	}
+	return group, fiber.StatusOK, nil
+}
+
+// CreateSCIMGroup creates a group with its members, who get the roles the group maps to
+func CreateSCIMGroup(c *fiber.Ctx) error {
+	var req scimGroupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return scimError(c, fiber.StatusBadRequest, "invalidSyntax", "Invalid request content")
+	}
+	group := &api.SCIMGroup{}
+	return saveSCIMGroup(c, group, &req, fiber.StatusCreated)
+}
+
+// ReplaceSCIMGroup replaces the name and members of a group
+func ReplaceSCIMGroup(c *fiber.Ctx) error {
+	group, status, err := scimGroupParam(c)
+	if err != nil {
+		return scimError(c, status, "", err.Error())
+	}
+	var req scimGroupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return scimError(c, fiber.StatusBadRequest, "invalidSyntax", "Invalid request content")
+	}
+	return saveSCIMGroup(c, group, &req, fiber.StatusOK)
+}
+
+// PatchSCIMGroup applies a SCIM patch to a group, identity providers add and remove members
+// this way
+func PatchSCIMGroup(c *fiber.Ctx) error {
+	group, status, err := scimGroupParam(c)
+	if err != nil {
+		return scimError(c, status, "", err.Error())
+	}
+	var patch scimPatchRequest
+	if err := c.BodyParser(&patch); err != nil {
+		return scimError(c, fiber.StatusBadRequest, "invalidSyntax", "Invalid request content")
+	}
+
+	req := scimGroupRequest{DisplayName: group.DisplayName, ExternalID: group.ExternalID}
+	for _, member := range group.Members {
+		req.Members = append(req.Members, scimRef{Value: strconv.Itoa(member.UserID)})
+	}
+
+	for _, op := range patch.Operations {
+		path := strings.ToLower(strings.TrimSpace(op.Path))
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			values := map[string]interface{}{}
+			if path == "" {
+				object, ok := op.Value.(map[string]interface{})
+				if !ok {
+					return scimError(c, fiber.StatusBadRequest, "invalidValue", "A patch without a path needs an object value")
+				}
+				for attr, value := range object {
+					values[strings.ToLower(attr)] = value
+				}
+			} else {
+				values[path] = op.Value
+			}
+			for attr, value := range values {
+				switch attr {
+				case "displayname":
+					req.DisplayName, _ = value.(string)
+				case "externalid":
+					req.ExternalID, _ = value.(string)
+				case "members":
+					refs := scimMemberRefs(value)
+					if strings.EqualFold(op.Op, "replace") {
+						req.Members = refs
+					} else {
+						req.Members = append(req.Members, refs...)
+					}
+				}
+			}
+		case "remove":
+			if match := scimMemberPathPattern.FindStringSubmatch(op.Path); match != nil {
+				req.Members = removeSCIMMembers(req.Members, []scimRef{{Value: match[1]}})
+			} else if path == "members" {
+				if op.Value == nil {
+					req.Members = nil
+				} else {
+					req.Members = removeSCIMMembers(req.Members, scimMemberRefs(op.Value))
+				}
+			} else if path == "externalid" {
+				req.ExternalID = ""
+			}
+		default:
+			return scimError(c, fiber.StatusBadRequest, "invalidSyntax", fmt.Sprintf("Unsupported patch operation %q", op.Op))
+		}
+	}
+	return saveSCIMGroup(c, group, &req, fiber.StatusOK)
+}
+
+// scimMemberRefs reads the members of a patch value, a list of {"value": "12"}
+func scimMemberRefs(value interface{}) []scimRef {
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+	refs := []scimRef{}
+	for _, item := range items {
+		if entry, ok := item.(map[string]interface{}); ok {
+			if id, ok := entry["value"].(string); ok {
+				refs = append(refs, scimRef{Value: id})
+			}
+		}
+	}
+	return refs
+}
+
+func removeSCIMMembers(members, removed []scimRef) []scimRef {
+	return slices.DeleteFunc(members, func(member scimRef) bool {
+		return slices.ContainsFunc(removed, func(r scimRef) bool { return r.Value == member.Value })
+	})
+}
+
+// saveSCIMGroup stores a group and updates the roles of the users it gained or lost, or of all its
+// members when it was renamed
+func saveSCIMGroup(c *fiber.Ctx, group *api.SCIMGroup, req *scimGroupRequest, status int) error {
+	req.DisplayName = strings.TrimSpace(req.DisplayName)
+	if req.DisplayName == "" || len(req.DisplayName) > 255 {
+		return scimError(c, fiber.StatusBadRequest, "invalidValue", "displayName must be between 1 and 255 characters")
+	}
+	memberIDs := []int{}
+	for _, member := range req.Members {
+		id, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return scimError(c, fiber.StatusBadRequest, "invalidValue", fmt.Sprintf("Unknown member %q", member.Value))
+		}
+		if !slices.Contains(memberIDs, id) {
+			memberIDs = append(memberIDs, id)
+		}
+	}
+
+	renamed := group.ID != 0 && !strings.EqualFold(group.DisplayName, req.DisplayName)
+	group.DisplayName = req.DisplayName
+	group.ExternalID = req.ExternalID
+	changed, err := api.Users.SaveSCIMGroup(c.Context(), group, memberIDs)
+	if errors.Is(err, api.ErrSCIMConflict) {
+		return scimError(c, fiber.StatusConflict, "uniqueness", fmt.Sprintf("Group %s already exists", group.DisplayName))
+	}
+	if errors.Is(err, api.ErrSCIMGroupNotFound) {
+		return scimError(c, fiber.StatusNotFound, "", err.Error())
+	}
+	if err != nil {
+		return scimError(c, fiber.StatusInternalServerError, "", "Failed to save group: "+err.Error())
+	}
+
+	saved, err := api.Users.GetSCIMGroup(c.Context(), group.ID)
+	if err != nil {
+		return scimError(c, fiber.StatusInternalServerError, "", "Failed to get group: "+err.Error())
+	}
+	if renamed {
+		for _, member := range saved.Members {
+			changed = append(changed, member.UserID)
+		}
+	}
+	applySCIMRoles(c.Context(), scimConfig(c), changed)
+	return scimJSON(c, status, scimGroupResource(c, saved, true))
+}
+
+// DeleteSCIMGroup removes a group, its members lose the roles it mapped to
+func DeleteSCIMGroup(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return scimError(c, fiber.StatusNotFound, "", api.ErrSCIMGroupNotFound.Error())
+	}
+
+	members, err := api.Users.DeleteSCIMGroup(c.Context(), id)
+	if errors.Is(err, api.ErrSCIMGroupNotFound) {
+		return scimError(c, fiber.StatusNotFound, "", err.Error())
+	}
+	if err != nil {
+		return scimError(c, fiber.StatusInternalServerError, "", "Failed to delete group: "+err.Error())
+	}
+
+	applySCIMRoles(c.Context(), scimConfig(c), members)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetSCIMServiceProviderConfig describes the SCIM features supported
+func GetSCIMServiceProviderConfig(c *fiber.Ctx) error {
+	return scimJSON(c, fiber.StatusOK, fiber.Map{
+		"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"patch":          fiber.Map{"supported": true},
+		"bulk":           fiber.Map{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         fiber.Map{"supported": true, "maxResults": maxSCIMPageSize},
+		"changePassword": fiber.Map{"supported": true},
+		"sort":           fiber.Map{"supported": false},
+		"etag":           fiber.Map{"supported": false},
+		"authenticationSchemes": []fiber.Map{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "The SCIM token generated in the Citizen admin settings",
+		}},
+	})
+}
+
+// GetSCIMResourceTypes lists the SCIM resources served
+func GetSCIMResourceTypes(c *fiber.Ctx) error {
+	resources := []fiber.Map{
+		{"schemas": []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"}, "id": "User", "name": "User", "endpoint": "/Users", "schema": scimSchemaUser},
+		{"schemas": []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": scimSchemaGroup},
+	}
+	return scimListResponse(c, resources, len(resources), 1)
+}
+
+// applySCIMRoles gives users the admin flag and team their groups map to. Users SCIM doesn't
+// manage keep theirs.
+func applySCIMRoles(ctx context.Context, config *utils.SCIMConfig, userIDs []int) {
+	if len(config.AdminGroups) == 0 && len(config.TeamGroups) == 0 {
+		return
+	}
+	for _, userID := range userIDs {
+		groups, err := api.Users.ListSCIMUserGroups(ctx, userID)
+		if err != nil {
+			utils.WarnLog("Failed to read the SCIM groups of user %d: %v", userID, err)
+			continue
+		}
+		names := make([]string, 0, len(groups))
+		for _, group := range groups {
+			names = append(names, group.DisplayName)
+		}
+		isAdmin, team := config.Roles(names)
+		if err := api.Users.SetSCIMRoles(ctx, userID, isAdmin, team); err != nil {
+			utils.WarnLog("Failed to set the SCIM roles of user %d: %v", userID, err)
+			continue
+		}
+		forgetIdentity(userID)
+	}
+}
+
+// forgetIdentity drops the cached identity of a user, so apps see its changes right away
+func forgetIdentity(userID int) {
+	cachedIdentities.Lock()
+	delete(cachedIdentities.users, userID)
+	cachedIdentities.Unlock()
+}
+
+// isUserInactive reports whether a user was deactivated. The list is loaded on first use and
+// reloaded in the background every inactiveUsersTTL, so deactivations on another instance apply.
+func isUserInactive(userID int) bool {
+	inactiveUsers.Lock()
+	loaded := inactiveUsers.ids != nil
+	stale := time.Since(inactiveUsers.fetchedAt) >= inactiveUsersTTL
+	if stale {
+		inactiveUsers.fetchedAt = time.Now()
+	}
+	inactiveUsers.Unlock()
+
+	if !loaded {
+		reloadInactiveUsers()
+	} else if stale {
+		go reloadInactiveUsers()
+	}
+
+	inactiveUsers.Lock()
+	defer inactiveUsers.Unlock()
+	return inactiveUsers.ids[userID]
+}
+
+// reloadInactiveUsers reads the users that can't sign in, a failed reload keeps the previous list
+func reloadInactiveUsers() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	list, err := api.Users.ListInactiveUserIDs(ctx)
+	if err != nil {
+		utils.WarnLog("Failed to load inactive users: %v", err)
+		return
+	}
+
+	ids := make(map[int]bool, len(list))
+	for _, id := range list {
+		ids[id] = true
+	}
+	inactiveUsers.Lock()
+	inactiveUsers.ids = ids
+	inactiveUsers.Unlock()
+}
+
+// setUserInactive updates the cached status of a user changed on this instance
+func setUserInactive(userID int, inactive bool) {
+	inactiveUsers.Lock()
+	defer inactiveUsers.Unlock()
+	if inactiveUsers.ids == nil {
+		return
+	}
+	if inactive {
+		inactiveUsers.ids[userID] = true
+	} else {
+		delete(inactiveUsers.ids, userID)
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// scimTokenPrefix tells SCIM tokens apart from other secrets in identity provider settings
+const scimTokenPrefix = "scim_"
+
+// scimSettingsResponse describes the SCIM config without its token hash
+func scimSettingsResponse(c *fiber.Ctx, config *utils.SCIMConfig) fiber.Map {
+	adminGroups := config.AdminGroups
+	if adminGroups == nil {
+		adminGroups = []string{}
+	}
+	teamGroups := config.TeamGroups
+	if teamGroups == nil {
+		teamGroups = map[string]string{}
+	}
+	return fiber.Map{
+		"enabled":      config.Enabled(),
+		"base_url":     c.BaseURL() + "/api/v1/scim/v2",
+		"admin_groups": adminGroups,
+		"team_groups":  teamGroups,
+	}
+}
+
+// GetSCIMSettings returns whether SCIM provisioning is enabled and how groups map to roles
+func GetSCIMSettings(c *fiber.Ctx) error {
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"SCIM settings retrieved successfully",
+		scimSettingsResponse(c, utils.GetSCIMConfig(c.Context())),
+	))
+}
+
+// SetSCIMSettings sets which SCIM groups make their members admins and which team each group
+// puts its members in. The roles of provisioned users are updated right away.
+func SetSCIMSettings(c *fiber.Ctx) error {
+	var req struct {
+		AdminGroups []string          `json:"admin_groups"`
+		TeamGroups  map[string]string `json:"team_groups"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	for group, team := range req.TeamGroups {
+		if !teamNamePattern.MatchString(team) {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Team of group "+group+": team names use lowercase letters, digits, - and _, up to 100 characters",
+				nil,
+			))
+		}
+	}
+
+	config := utils.GetSCIMConfig(c.Context())
+	config.AdminGroups = req.AdminGroups
+	config.TeamGroups = req.TeamGroups
+	if err := config.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	err := utils.SaveSCIMConfig(c.Context(), config)
+	auditSystemAction(c, "scim_settings_set", utils.SCIMSettingKey, map[string]interface{}{
+		"admin_groups": config.AdminGroups,
+		"team_groups":  config.TeamGroups,
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save SCIM settings: "+err.Error(),
+			nil,
+		))
+	}
+
+	data := scimSettingsResponse(c, config)
+	if err := reapplySCIMRoles(c.Context(), config); err != nil {
+		data["warning"] = "Roles of provisioned users not updated: " + err.Error()
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"SCIM settings updated",
+		data,
+	))
+}
+
+// reapplySCIMRoles updates the roles of all the users SCIM manages after the mapping changed
+func reapplySCIMRoles(ctx context.Context, config *utils.SCIMConfig) error {
+	ids, err := api.Users.ListSCIMManagedUserIDs(ctx)
+	if err != nil {
+		return err
+	}
+	applySCIMRoles(ctx, config, ids)
+	return nil
+}
+
+// CreateSCIMToken generates the bearer token the identity provider provisions with, enabling
+// SCIM. A previous token stops working. The token is only returned here, it is stored hashed.
+func CreateSCIMToken(c *fiber.Ctx) error {
+	token := scimTokenPrefix + strings.TrimRight(generateSecureID(), "=")
+
+	config := utils.GetSCIMConfig(c.Context())
+	rotated := config.Enabled()
+	config.TokenHash = utils.HashSCIMToken(token)
+	err := utils.SaveSCIMConfig(c.Context(), config)
+	auditSystemAction(c, "scim_token_create", utils.SCIMSettingKey, map[string]interface{}{"rotated": rotated}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save SCIM token: "+err.Error(),
+			nil,
+		))
+	}
+
+	utils.SecurityLog("SCIM token generated, previous token revoked: %t", rotated)
+	return c.Status(fiber.StatusCreated).JSON(utils.NewCitizenResponse(
+		true,
+		"SCIM token generated, it is only shown once",
+		fiber.Map{
+			"token":    token,
+			"base_url": c.BaseURL() + "/api/v1/scim/v2",
+		},
+	))
+}
+
+// DeleteSCIMToken revokes the SCIM token, disabling provisioning. Provisioned users and groups
+// are kept.
+func DeleteSCIMToken(c *fiber.Ctx) error {
+	config := utils.GetSCIMConfig(c.Context())
+	config.TokenHash = ""
+	err := utils.SaveSCIMConfig(c.Context(), config)
+	auditSystemAction(c, "scim_token_delete", utils.SCIMSettingKey, nil, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to revoke SCIM token: "+err.Error(),
+			nil,
+		))
+	}
+
+	utils.SecurityLog("SCIM token revoked, provisioning disabled")
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"SCIM token revoked, provisioning is disabled",
+		nil,
+	))
+}
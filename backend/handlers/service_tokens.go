@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// serviceTokenPrefix tells service tokens apart from other secrets in scripts and logs
+	serviceTokenPrefix = "cst_"
+
+	defaultServiceTokenDays = 90
+	maxServiceTokenDays     = 365
+	maxServiceTokenPrefixes = 20
+
+	// serviceTokenCacheTTL bounds how long a revoked service token keeps working
+	serviceTokenCacheTTL = 30 * time.Second
+	// serviceTokenUseInterval is how often the last use of a service token is stored
+	serviceTokenUseInterval = time.Minute
+)
+
+type cachedServiceToken struct {
+	token      *api.ServiceToken
+	fetchedAt  time.Time
+	recordedAt time.Time
+}
+
+var (
+	serviceTokenCache   = make(map[string]*cachedServiceToken)
+	serviceTokenCacheMu sync.Mutex
+)
+
+// ListServiceTokens lists the service tokens of an app with their last use
+func ListServiceTokens(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	tokens, err := api.Apps.ListServiceTokens(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve service tokens: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Service tokens retrieved successfully",
+		fiber.Map{
+			"app_name": appName,
+			"tokens":   tokens,
+			"header":   utils.HeaderCitizenServiceToken,
+		},
+	))
+}
+
+// CreateServiceToken creates a token letting scripts and probes through the SSO of an app,
+// optionally limited to path prefixes and read-only requests. The token is only returned here,
+// it is stored hashed.
+func CreateServiceToken(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		PathPrefixes  []string `json:"path_prefixes"`
+		ReadOnly      bool     `json:"read_only"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"name must be between 1 and 100 characters",
+			nil,
+		))
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultServiceTokenDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxServiceTokenDays {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("expires_in_days must be between 1 and %d", maxServiceTokenDays),
+			nil,
+		))
+	}
+	prefixes, err := normalizeServiceTokenPrefixes(req.PathPrefixes)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	secret := serviceTokenPrefix + generateSecureID()
+	token := &api.ServiceToken{
+		AppName:      appName,
+		Name:         req.Name,
+		PathPrefixes: prefixes,
+		ReadOnly:     req.ReadOnly,
+		ExpiresAt:    time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour),
+	}
+	if uid, ok := c.Locals("user_id").(int); ok {
+		token.CreatedBy = &uid
+	}
+	err = api.Apps.CreateServiceToken(c.Context(), token, utils.HashToken(secret))
+	auditSystemAction(c, "service_token_create", appName, map[string]interface{}{
+		"token_id":      token.ID,
+		"name":          token.Name,
+		"path_prefixes": token.PathPrefixes,
+		"read_only":     token.ReadOnly,
+		"expires_at":    token.ExpiresAt,
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to create service token: "+err.Error(),
+			nil,
+		))
+	}
+
+	utils.SecurityLog("Service token %d created for app %s, expires %s", token.ID, appName, token.ExpiresAt.Format(time.RFC3339))
+	return c.Status(fiber.StatusCreated).JSON(utils.NewCitizenResponse(
+		true,
+		"Service token created, it is only shown once",
+		fiber.Map{
+			"service_token": token,
+			"token":         secret,
+			"header":        utils.HeaderCitizenServiceToken,
+		},
+	))
+}
+
+// RevokeServiceToken ends the access a service token grants, within serviceTokenCacheTTL
+func RevokeServiceToken(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	id, err := strconv.Atoi(c.Params("id"))
+	if appName == "" || err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name and service token ID are required",
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	err = api.Apps.RevokeServiceToken(c.Context(), appName, id, userID)
+	if errors.Is(err, api.ErrServiceTokenNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Service token not found or already revoked",
+			nil,
+		))
+	}
+	auditSystemAction(c, "service_token_revoke", appName, map[string]interface{}{"token_id": id}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to revoke service token: "+err.Error(),
+			nil,
+		))
+	}
+
+	serviceTokenCacheMu.Lock()
+	for hash, entry := range serviceTokenCache {
+		if entry.token != nil && entry.token.ID == id {
+			delete(serviceTokenCache, hash)
+		}
+	}
+	serviceTokenCacheMu.Unlock()
+
+	utils.SecurityLog("Service token %d of app %s revoked", id, appName)
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Service token revoked",
+		fiber.Map{"id": id},
+	))
+}
+
+// authorizeServiceToken lets requests presenting a service token of the app through ForwardAuth.
+// Requests with an unknown, expired or out of scope token are refused rather than sent to the
+// login page, scripts can't sign in. It reports whether it answered the request.
+func authorizeServiceToken(c *fiber.Ctx, appName, forwardedUri string) (bool, error) {
+	secret := c.Get(utils.HeaderCitizenServiceToken)
+	if secret == "" {
+		return false, nil
+	}
+
+	tokenHash := utils.HashToken(secret)
+	token := cachedServiceTokenByHash(c.Context(), tokenHash)
+	if token == nil || token.AppName != appName || !token.Active() {
+		utils.SecurityLog("Invalid or expired service token for app %s from %s", appName, utils.ClientIP(c))
+		return true, c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid or expired service token",
+			nil,
+		))
+	}
+
+	method := c.Get("X-Forwarded-Method")
+	if !serviceTokenAllows(token, method, forwardedUri) {
+		utils.SecurityLog("Service token %d of app %s refused %s %s from %s", token.ID, appName, method, forwardedUri, utils.ClientIP(c))
+		return true, c.Status(fiber.StatusForbidden).JSON(utils.NewCitizenResponse(
+			false,
+			"The service token does not allow this request",
+			nil,
+		))
+	}
+
+	recordServiceTokenUse(tokenHash, token, utils.ClientIP(c))
+	if appIdentitySetting(appName).HeadersEnabled {
+		c.Set(utils.HeaderCitizenServiceAccount, token.Name)
+	}
+	utils.AuthDebugLog("Service token %d grants access to app %s", token.ID, appName)
+	return true, c.SendStatus(fiber.StatusOK)
+}
+
+// serviceTokenAllows checks a request against the scope of a service token
+func serviceTokenAllows(token *api.ServiceToken, method, forwardedUri string) bool {
+	if token.ReadOnly {
+		switch strings.ToUpper(method) {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		default:
+			return false
+		}
+	}
+	if len(token.PathPrefixes) == 0 {
+		return true
+	}
+
+	rawPath, _, _ := strings.Cut(forwardedUri, "?")
+	unescaped, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return false
+	}
+	requestPath := path.Clean("/" + unescaped)
+	for _, prefix := range token.PathPrefixes {
+		if prefix == "/" || requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeServiceTokenPrefixes checks and cleans the path prefixes of a service token, dropping
+// duplicates
+func normalizeServiceTokenPrefixes(prefixes []string) ([]string, error) {
+	if len(prefixes) > maxServiceTokenPrefixes {
+		return nil, fmt.Errorf("a service token can have at most %d path prefixes", maxServiceTokenPrefixes)
+	}
+	normalized := []string{}
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSpace(prefix)
+		if !strings.HasPrefix(prefix, "/") || len(prefix) > 200 || strings.ContainsAny(prefix, "?#") {
+			return nil, fmt.Errorf("path prefix %q must start with / and be a path of at most 200 characters", prefix)
+		}
+		prefix = path.Clean(prefix)
+		if !slices.Contains(normalized, prefix) {
+			normalized = append(normalized, prefix)
+		}
+	}
+	return normalized, nil
+}
+
+// cachedServiceTokenByHash returns the service token of a token hash, read from the database at
+// most every serviceTokenCacheTTL as ForwardAuth checks every request
+func cachedServiceTokenByHash(ctx context.Context, tokenHash string) *api.ServiceToken {
+	serviceTokenCacheMu.Lock()
+	cached, ok := serviceTokenCache[tokenHash]
+	serviceTokenCacheMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < serviceTokenCacheTTL {
+		return cached.token
+	}
+
+	token, err := api.Apps.GetServiceTokenByHash(ctx, tokenHash)
+	if err != nil && !errors.Is(err, api.ErrServiceTokenNotFound) {
+		utils.WarnLog("Failed to get service token: %v", err)
+		return nil
+	}
+
+	serviceTokenCacheMu.Lock()
+	for hash, entry := range serviceTokenCache {
+		if time.Since(entry.fetchedAt) >= serviceTokenCacheTTL {
+			delete(serviceTokenCache, hash)
+		}
+	}
+	entry := &cachedServiceToken{token: token, fetchedAt: time.Now()}
+	if ok {
+		entry.recordedAt = cached.recordedAt
+	}
+	serviceTokenCache[tokenHash] = entry
+	serviceTokenCacheMu.Unlock()
+	return token
+}
+
+// recordServiceTokenUse stores the last use of a service token, at most every
+// serviceTokenUseInterval
+func recordServiceTokenUse(tokenHash string, token *api.ServiceToken, ip string) {
+	serviceTokenCacheMu.Lock()
+	entry, ok := serviceTokenCache[tokenHash]
+	due := ok && time.Since(entry.recordedAt) >= serviceTokenUseInterval
+	if due {
+		entry.recordedAt = time.Now()
+	}
+	serviceTokenCacheMu.Unlock()
+	if !due {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := api.Apps.RecordServiceTokenUse(ctx, token.ID, ip); err != nil {
+			utils.WarnLog("Failed to record use of service token %d: %v", token.ID, err)
+		}
+	}()
+}
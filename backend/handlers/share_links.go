@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// shareLinkParam is the query parameter a share link carries its token in
+	shareLinkParam = "citizen_share"
+	// shareLinkCookie keeps a visitor who opened a share link signed in to the app host
+	shareLinkCookie = "citizen_share"
+
+	defaultShareLinkHours = 48
+	maxShareLinkHours     = 30 * 24
+
+	// shareLinkCacheTTL bounds how long a revoked link keeps working for visitors who opened it
+	shareLinkCacheTTL = 30 * time.Second
+)
+
+type cachedShareLink struct {
+	link      *api.ShareLink
+	fetchedAt time.Time
+}
+
+var (
+	shareLinkCache   = make(map[int]cachedShareLink)
+	shareLinkCacheMu sync.Mutex
+)
+
+// ListShareLinks lists the share links of an app with their usage
+func ListShareLinks(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	links, err := api.Apps.ListShareLinks(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve share links: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Share links retrieved successfully",
+		links,
+	))
+}
+
+// CreateShareLink creates a time-limited access link to a private app. The token is only
+// returned here, it is stored hashed.
+func CreateShareLink(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	var req struct {
+		Label          string `json:"label"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = defaultShareLinkHours
+	}
+	if req.ExpiresInHours < 1 || req.ExpiresInHours > maxShareLinkHours {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("expires_in_hours must be between 1 and %d", maxShareLinkHours),
+			nil,
+		))
+	}
+	req.Label = strings.TrimSpace(req.Label)
+	if len(req.Label) > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"label must be at most 100 characters",
+			nil,
+		))
+	}
+
+	domains, err := utils.ListDomains(appName)
+	if err != nil || len(domains) == 0 {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			"App "+appName+" has no domain to share",
+			nil,
+		))
+	}
+
+	token := generateSecureID()
+	link := &api.ShareLink{
+		AppName:   appName,
+		Label:     req.Label,
+		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour),
+	}
+	if uid, ok := c.Locals("user_id").(int); ok {
+		link.CreatedBy = &uid
+	}
+	if err := api.Apps.CreateShareLink(c.Context(), link, utils.HashToken(token)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to create share link: "+err.Error(),
+			nil,
+		))
+	}
+
+	protocol := "http://"
+	if isHttpsRequired() {
+		protocol = "https://"
+	}
+	urls := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		urls = append(urls, protocol+domain+"/?"+shareLinkParam+"="+url.QueryEscape(token))
+	}
+
+	utils.SecurityLog("Share link %d created for app %s, expires %s", link.ID, appName, link.ExpiresAt.Format(time.RFC3339))
+	return c.Status(fiber.StatusCreated).JSON(utils.NewCitizenResponse(
+		true,
+		"Share link created, it is only shown once",
+		fiber.Map{
+			"link":  link,
+			"token": token,
+			"url":   urls[0],
+			"urls":  urls,
+		},
+	))
+}
+
+// RevokeShareLink ends the access a share link grants, visitors who already opened it lose
+// access within shareLinkCacheTTL
+func RevokeShareLink(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	id, err := strconv.Atoi(c.Params("id"))
+	if appName == "" || err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name and share link ID are required",
+			nil,
+		))
+	}
+
+	err = api.Apps.RevokeShareLink(c.Context(), appName, id)
+	if errors.Is(err, api.ErrShareLinkNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Share link not found or already revoked",
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to revoke share link: "+err.Error(),
+			nil,
+		))
+	}
+
+	shareLinkCacheMu.Lock()
+	delete(shareLinkCache, id)
+	shareLinkCacheMu.Unlock()
+
+	utils.SecurityLog("Share link %d of app %s revoked", id, appName)
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Share link revoked",
+		fiber.Map{"id": id},
+	))
+}
+
+// authorizeShareLink lets visitors of a private app in with a share link, in the ForwardAuth
+// flow. A link opened with its token is exchanged for a signed cookie on the app host and the
+// visitor redirected to the URL without the token. It reports whether it answered the request.
+func authorizeShareLink(c *fiber.Ctx, appName, forwardedHost, forwardedUri string) (bool, error) {
+	if token := shareTokenFromURI(forwardedUri); token != "" {
+		link, err := api.Apps.GetShareLinkByToken(c.Context(), utils.HashToken(token))
+		if err != nil || link.AppName != appName || !link.Active() {
+			utils.SecurityLog("Invalid or expired share link for app %s from %s", appName, utils.ClientIP(c))
+			return false, nil
+		}
+
+		if err := api.Apps.RecordShareLinkUse(c.Context(), link.ID, utils.ClientIP(c)); err != nil {
+			utils.WarnLog("Failed to record use of share link %d: %v", link.ID, err)
+		}
+		value, err := utils.SignCookie(shareLinkCookie, strconv.Itoa(link.ID))
+		if err != nil {
+			utils.ErrorLog("Failed to sign share link cookie: %v", err)
+			return false, nil
+		}
+		c.Cookie(&fiber.Cookie{
+			Name:     shareLinkCookie,
+			Value:    value,
+			Path:     "/",
+			Expires:  link.ExpiresAt,
+			HTTPOnly: true,
+			SameSite: "Lax",
+			Secure:   strings.HasPrefix(c.Get("X-Forwarded-Proto"), "https"),
+		})
+
+		proto := c.Get("X-Forwarded-Proto")
+		if proto == "" {
+			proto = "http"
+		}
+		target := proto + "://" + forwardedHost + stripShareToken(forwardedUri)
+		utils.AuthDebugLog("Share link %d opened for app %s, redirecting to %s", link.ID, appName, target)
+		return true, c.Redirect(target, fiber.StatusTemporaryRedirect)
+	}
+
+	cookie := c.Cookies(shareLinkCookie)
+	if cookie == "" {
+		return false, nil
+	}
+	value, err := utils.VerifyCookie(shareLinkCookie, cookie)
+	if err != nil {
+		return false, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return false, nil
+	}
+	link := cachedShareLinkByID(c.Context(), id)
+	if link == nil || link.AppName != appName || !link.Active() {
+		return false, nil
+	}
+
+	utils.AuthDebugLog("Share link %d grants access to app %s", id, appName)
+	return true, c.SendStatus(fiber.StatusOK)
+}
+
+// cachedShareLinkByID returns a share link, read from the database at most every shareLinkCacheTTL
+// as ForwardAuth checks every request of the visitor
+func cachedShareLinkByID(ctx context.Context, id int) *api.ShareLink {
+	shareLinkCacheMu.Lock()
+	cached, ok := shareLinkCache[id]
+	shareLinkCacheMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < shareLinkCacheTTL {
+		return cached.link
+	}
+
+	link, err := api.Apps.GetShareLink(ctx, id)
+	if err != nil && !errors.Is(err, api.ErrShareLinkNotFound) {
+		utils.WarnLog("Failed to get share link %d: %v", id, err)
+		return nil
+	}
+
+	shareLinkCacheMu.Lock()
+	for cachedID, entry := range shareLinkCache {
+		if time.Since(entry.fetchedAt) >= shareLinkCacheTTL {
+			delete(shareLinkCache, cachedID)
+		}
+	}
+	shareLinkCache[id] = cachedShareLink{link: link, fetchedAt: time.Now()}
+	shareLinkCacheMu.Unlock()
+	return link
+}
+
+// shareTokenFromURI returns the share link token of a forwarded URI
+func shareTokenFromURI(uri string) string {
+	_, rawQuery, ok := strings.Cut(uri, "?")
+	if !ok {
+		return ""
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return ""
+	}
+	return query.Get(shareLinkParam)
+}
+
+// stripShareToken removes the share link token from a forwarded URI
+func stripShareToken(uri string) string {
+	path, rawQuery, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return path
+	}
+	query.Del(shareLinkParam)
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
+}
@@ -0,0 +1,557 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	slackActionApproveDeploy = "deploy_approve"
+	slackActionCancelDeploy  = "deploy_cancel"
+	// slackStateMaxAge is how long an install link stays valid
+	slackStateMaxAge = 10 * time.Minute
+	// slackApprovalMaxAge is how long a requested deployment can be approved
+	slackApprovalMaxAge = time.Hour
+)
+
+const slackHelp = "Available commands:\n" +
+	"• `/citizen deploy <app>` asks for approval, then deploys the app from its git source\n" +
+	"• `/citizen status <app>` shows the latest deployment\n" +
+	"• `/citizen help` shows this message"
+
+// SlackConfigRequest represents a Slack app configuration request
+type SlackConfigRequest struct {
+	ClientID      string `json:"client_id"`
+	ClientSecret  string `json:"client_secret"`
+	SigningSecret string `json:"signing_secret"`
+	RedirectURI   string `json:"redirect_uri"`
+}
+
+// slackInstallState is the session an install link was generated for, the callback only links
+// the Slack account of the same session
+type slackInstallState struct {
+	UserID    int    `json:"user_id"`
+	SessionID string `json:"session_id"`
+}
+
+// slackDeployRequest is a deployment requested with /citizen deploy. It waits for another user
+// allowed to deploy the app to approve it, and is taken once by the first approval or cancellation.
+type slackDeployRequest struct {
+	TeamID      string    `json:"team_id"`
+	AppName     string    `json:"app_name"`
+	SlackUserID string    `json:"slack_user_id"`
+	UserID      int       `json:"user_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// slackInteraction is the part of a block_actions payload used for buttons
+type slackInteraction struct {
+	Type string `json:"type"`
+	Team struct {
+		ID string `json:"id"`
+	} `json:"team"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+}
+
+// SetupSlackConfig stores the Slack app credentials (encrypted) and enables the integration
+func SetupSlackConfig(c *fiber.Ctx) error {
+	var req SlackConfigRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, "Invalid request content", nil))
+	}
+
+	if req.ClientID == "" || req.ClientSecret == "" || req.SigningSecret == "" || req.RedirectURI == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, "All fields are required", nil))
+	}
+
+	encrypted := make([]string, 0, 3)
+	for _, value := range []string{req.ClientID, req.ClientSecret, req.SigningSecret} {
+		ciphertext, err := utils.EncryptString(value)
+		if err != nil {
+			log.Printf("[SLACK] Failed to encrypt Slack config: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(false, "Failed to encrypt Slack config", nil))
+		}
+		encrypted = append(encrypted, ciphertext)
+	}
+
+	if err := api.Slack.SaveSlackConfig(c.Context(), encrypted[0], encrypted[1], encrypted[2], req.RedirectURI); err != nil {
+		log.Printf("[SLACK] Failed to save Slack config: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(false, "Failed to save Slack config", nil))
+	}
+
+	utils.SetupSlack(req.ClientID, req.ClientSecret, req.SigningSecret, req.RedirectURI)
+	auditSystemAction(c, "slack_configure", req.RedirectURI, nil, nil)
+
+	log.Printf("[SLACK] ✅ Slack app configured")
+	return c.JSON(utils.NewCitizenResponse(true, "Slack integration configured", fiber.Map{
+		"configured":       true,
+		"commands_url":     c.BaseURL() + "/api/v1/slack/commands",
+		"interactions_url": c.BaseURL() + "/api/v1/slack/interactions",
+	}))
+}
+
+// GetSlackConfig returns the Slack app configuration without secrets
+func GetSlackConfig(c *fiber.Ctx) error {
+	config, err := api.Slack.GetSlackConfig(c.Context())
+	if err != nil || !utils.IsSlackConfigured() {
+		return c.JSON(utils.NewCitizenResponse(true, "Slack not configured", fiber.Map{
+			"configured": false,
+		}))
+	}
+
+	clientID, err := utils.DecryptString(config.ClientID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(false, "Failed to decrypt Slack config", nil))
+	}
+	if len(clientID) > 8 {
+		clientID = clientID[:8] + "..."
+	}
+
+	return c.JSON(utils.NewCitizenResponse(true, "Slack configuration loaded", fiber.Map{
+		"configured":    true,
+		"client_id":     clientID,
+		"redirect_uri":  config.RedirectURI,
+		"configured_at": config.CreatedAt.Format(time.RFC3339),
+	}))
+}
+
+// DeleteSlackConfig disables the Slack integration
+func DeleteSlackConfig(c *fiber.Ctx) error {
+	if err := api.Slack.DeleteSlackConfig(c.Context()); err != nil {
+		log.Printf("[SLACK] Failed to delete Slack config: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(false, "Failed to delete Slack config", nil))
+	}
+
+	utils.ClearSlack()
+	auditSystemAction(c, "slack_unconfigure", "", nil, nil)
+
+	return c.JSON(utils.NewCitizenResponse(true, "Slack integration removed", nil))
+}
+
+// LoadSlackConfigFromDB loads the Slack app configuration from the database (decrypted)
+func LoadSlackConfigFromDB() error {
+	config, err := api.Slack.GetSlackConfig(context.Background())
+	if err != nil {
+		return err
+	}
+
+	values := make([]string, 0, 3)
+	for _, ciphertext := range []string{config.ClientID, config.ClientSecret, config.SigningSecret} {
+		value, err := utils.DecryptString(ciphertext)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt Slack config: %w", err)
+		}
+		values = append(values, value)
+	}
+
+	utils.SetupSlack(values[0], values[1], values[2], config.RedirectURI)
+	return nil
+}
+
+// SlackInstallInit returns the URL that installs the Slack app and links the caller's Slack account
+func SlackInstallInit(c *fiber.Ctx) error {
+	session, ok := c.Locals("sso_session").(*SSOSession)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(false, "User not authenticated", nil))
+	}
+	if !utils.IsSlackConfigured() {
+		return c.Status(fiber.StatusPreconditionFailed).JSON(utils.NewCitizenResponse(false, "Slack integration is not configured", nil))
+	}
+
+	randomBytes := make([]byte, 16)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(false, "Failed to generate secure state parameter", nil))
+	}
+	state := "slack_" + hex.EncodeToString(randomBytes)
+	if err := putOneTimeValue(slackStateKey(state), slackInstallState{UserID: session.UserID, SessionID: session.SessionID}, slackStateMaxAge); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(false, "Failed to store state parameter", nil))
+	}
+
+	installURL, err := utils.GetSlackInstallURL(state)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(false, "Failed to generate Slack install URL", nil))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(true, "Slack install URL generated", fiber.Map{
+		"install_url": installURL,
+		"state":       state,
+	}))
+}
+
+// SlackInstallCallback completes the install, storing the workspace token and linking the Slack
+// user. The state must have been generated by SlackInstallInit for the same session, it is used once.
+func SlackInstallCallback(c *fiber.Ctx) error {
+	session, ok := c.Locals("sso_session").(*SSOSession)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(false, "User not authenticated", nil))
+	}
+	userID := session.UserID
+
+	code := c.Query("code")
+	if code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, "Authorization code is required", nil))
+	}
+	var state slackInstallState
+	if !takeOneTimeValue(slackStateKey(c.Query("state")), &state) || state.UserID != userID || state.SessionID != session.SessionID {
+		log.Printf("[SLACK] CSRF Protection: invalid install state for user %d", userID)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, "Invalid state parameter - CSRF protection failed", nil))
+	}
+
+	oauthResp, err := utils.ExchangeSlackCode(code)
+	if err != nil {
+		log.Printf("[SLACK] Failed to exchange install code: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(utils.NewCitizenResponse(false, "Failed to complete Slack install", nil))
+	}
+
+	botToken, err := utils.EncryptString(oauthResp.AccessToken)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(false, "Failed to encrypt Slack token", nil))
+	}
+
+	workspace := &api.SlackWorkspace{
+		TeamID:      oauthResp.Team.ID,
+		TeamName:    oauthResp.Team.Name,
+		BotUserID:   oauthResp.BotUserID,
+		BotToken:    botToken,
+		InstalledBy: &userID,
+	}
+	if err := api.Slack.SaveSlackWorkspace(c.Context(), workspace); err != nil {
+		log.Printf("[SLACK] Failed to save workspace %s: %v", oauthResp.Team.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(false, "Failed to save Slack workspace", nil))
+	}
+	if err := api.Slack.LinkSlackUser(c.Context(), oauthResp.Team.ID, oauthResp.AuthedUser.ID, userID); err != nil {
+		log.Printf("[SLACK] Failed to link Slack user %s: %v", oauthResp.AuthedUser.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(false, "Failed to link Slack account", nil))
+	}
+
+	log.Printf("[SLACK] ✅ Installed in %s (%s), linked Slack user %s to user %d",
+		oauthResp.Team.Name, oauthResp.Team.ID, oauthResp.AuthedUser.ID, userID)
+	return c.JSON(utils.NewCitizenResponse(true, "Slack workspace connected", fiber.Map{
+		"team_id":   oauthResp.Team.ID,
+		"team_name": oauthResp.Team.Name,
+	}))
+}
+
+// ListSlackWorkspaces lists the workspaces the Slack app is installed in
+func ListSlackWorkspaces(c *fiber.Ctx) error {
+	workspaces, err := api.Slack.ListSlackWorkspaces(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(false, "Failed to list Slack workspaces", nil))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(true, "Slack workspaces retrieved", workspaces))
+}
+
+// DeleteSlackWorkspace removes an installed workspace and its user links
+func DeleteSlackWorkspace(c *fiber.Ctx) error {
+	teamID := c.Params("team_id")
+
+	deleted, err := api.Slack.DeleteSlackWorkspace(c.Context(), teamID)
+	auditSystemAction(c, "slack_workspace_delete", teamID, nil, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(false, "Failed to delete Slack workspace", nil))
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(false, "Slack workspace not found", nil))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(true, "Slack workspace removed", nil))
+}
+
+// SlackCommandHandler handles the /citizen slash command
+func SlackCommandHandler(c *fiber.Ctx) error {
+	if !verifySlackRequest(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid signature"})
+	}
+
+	form, err := url.ParseQuery(string(c.Body()))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+
+	fields := strings.Fields(form.Get("text"))
+	command, appName := "help", ""
+	if len(fields) > 0 {
+		command = strings.ToLower(fields[0])
+	}
+	if len(fields) > 1 {
+		appName = fields[1]
+	}
+
+	if command == "help" {
+		return c.JSON(slackEphemeral(slackHelp))
+	}
+	if appName == "" {
+		return c.JSON(slackEphemeral(fmt.Sprintf("Usage: `/citizen %s <app>`", command)))
+	}
+
+	userID, err := slackLinkedUser(form.Get("team_id"), form.Get("user_id"))
+	if err != nil {
+		return c.JSON(slackEphemeral(err.Error()))
+	}
+
+	log.Printf("[SLACK] %s ran '%s %s' in %s", form.Get("user_name"), command, appName, form.Get("team_id"))
+
+	switch command {
+	case "status":
+		return c.JSON(slackEphemeral(chatOpsStatus(appName)))
+	case "deploy":
+		if !canDeployFromSlack(c.Context(), userID, appName) {
+			return c.JSON(slackEphemeral(fmt.Sprintf("You are not allowed to deploy `%s`.", appName)))
+		}
+		gitURL, branch, err := appGitSource(appName)
+		if err != nil {
+			return c.JSON(slackEphemeral(err.Error()))
+		}
+
+		request := slackDeployRequest{
+			TeamID:      form.Get("team_id"),
+			AppName:     appName,
+			SlackUserID: form.Get("user_id"),
+			UserID:      userID,
+			ExpiresAt:   time.Now().Add(slackApprovalMaxAge),
+		}
+		requestID := generateSecureID()
+		if err := putOneTimeValue(slackDeployRequestKey(requestID), request, slackApprovalMaxAge); err != nil {
+			log.Printf("[SLACK] Failed to store deployment request of %s: %v", appName, err)
+			return c.JSON(slackEphemeral("Failed to request the deployment, try again later."))
+		}
+		return c.JSON(slackDeployApproval(requestID, &request, gitURL, branch))
+	default:
+		return c.JSON(slackEphemeral(fmt.Sprintf("Unknown command `%s`.\n\n%s", command, slackHelp)))
+	}
+}
+
+// SlackInteractionHandler handles button clicks on Slack messages
+func SlackInteractionHandler(c *fiber.Ctx) error {
+	if !verifySlackRequest(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid signature"})
+	}
+
+	form, err := url.ParseQuery(string(c.Body()))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+
+	var interaction slackInteraction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &interaction); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+	if interaction.Type != "block_actions" || len(interaction.Actions) == 0 {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	action := interaction.Actions[0]
+	if action.ActionID != slackActionApproveDeploy && action.ActionID != slackActionCancelDeploy {
+		return c.SendStatus(fiber.StatusOK)
+	}
+	reply := func(text string) error {
+		go postSlackResponse(interaction.ResponseURL, &utils.SlackMessage{ResponseType: "ephemeral", Text: text})
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	userID, err := slackLinkedUser(interaction.Team.ID, interaction.User.ID)
+	if err != nil {
+		return reply(err.Error())
+	}
+
+	// Taking the request is atomic, so a deployment is approved or cancelled once, whoever clicks
+	var request slackDeployRequest
+	key := slackDeployRequestKey(action.Value)
+	if !takeOneTimeValue(key, &request) || request.TeamID != interaction.Team.ID {
+		return reply("This deployment request expired or was already handled.")
+	}
+	// A user who may not act on the request leaves it for someone who can
+	keep := func(text string) error {
+		if ttl := time.Until(request.ExpiresAt); ttl > 0 {
+			if err := putOneTimeValue(key, request, ttl); err != nil {
+				log.Printf("[SLACK] Failed to keep deployment request of %s: %v", request.AppName, err)
+			}
+		}
+		return reply(text)
+	}
+
+	allowed := canDeployFromSlack(c.Context(), userID, request.AppName)
+	switch action.ActionID {
+	case slackActionCancelDeploy:
+		if !allowed && userID != request.UserID {
+			return keep(fmt.Sprintf("You are not allowed to cancel deployments of `%s`.", request.AppName))
+		}
+		go postSlackResponse(interaction.ResponseURL, &utils.SlackMessage{
+			ReplaceOriginal: true,
+			Text:            fmt.Sprintf("Deployment of `%s` cancelled by <@%s>.", request.AppName, interaction.User.ID),
+		})
+	case slackActionApproveDeploy:
+		if userID == request.UserID || interaction.User.ID == request.SlackUserID {
+			return keep("A deployment must be approved by someone other than the person who requested it.")
+		}
+		if !allowed {
+			return keep(fmt.Sprintf("You are not allowed to deploy `%s`.", request.AppName))
+		}
+		go runSlackDeploy(interaction, request.AppName, userID)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// runSlackDeploy deploys an approved app and reports the outcome in the original message
+func runSlackDeploy(interaction slackInteraction, appName string, userID int) {
+	gitURL, branch, err := appGitSource(appName)
+	if err != nil {
+		postSlackResponse(interaction.ResponseURL, &utils.SlackMessage{ReplaceOriginal: true, Text: err.Error()})
+		return
+	}
+
+	postSlackResponse(interaction.ResponseURL, &utils.SlackMessage{
+		ReplaceOriginal: true,
+		Text:            fmt.Sprintf("⏳ Deploying `%s` from `%s`, approved by <@%s>...", appName, branch, interaction.User.ID),
+	})
+
+	activity, activityErr := database.LogDeployActivity(appName, gitURL, branch, "",
+		fmt.Sprintf("Deployment approved in Slack by %s", interaction.User.Username), &userID, database.TriggerManual)
+	if activityErr != nil {
+		log.Printf("[SLACK] ⚠️ Failed to log deployment activity: %v", activityErr)
+	}
+
+	record, _, err := runTrackedDeployment(nil, appName, gitURL, branch, "", "", activity, &userID, database.TriggerManual)
+	reference := ""
+	if record != nil {
+		reference = fmt.Sprintf(" (deployment #%d)", record.ID)
+	}
+
+	text := fmt.Sprintf("✅ Deployment of `%s` from `%s` succeeded%s.", appName, branch, reference)
+	if err != nil {
+		log.Printf("[SLACK] ❌ Deployment of %s failed: %v", appName, err)
+		text = fmt.Sprintf("❌ Deployment of `%s` from `%s` failed%s: %v", appName, branch, reference, err)
+	}
+	postSlackResponse(interaction.ResponseURL, &utils.SlackMessage{ResponseType: "in_channel", ReplaceOriginal: true, Text: text})
+}
+
+// slackDeployApproval is the message asking the channel to approve a deployment request, its
+// buttons carry the request ID
+func slackDeployApproval(requestID string, request *slackDeployRequest, gitURL, branch string) *utils.SlackMessage {
+	text := fmt.Sprintf("<@%s> requested a deployment of `%s` from `%s` (%s), someone else allowed to deploy it has to approve it.",
+		request.SlackUserID, request.AppName, branch, gitURL)
+	button := func(label, actionID, style string) map[string]interface{} {
+		element := map[string]interface{}{
+			"type":      "button",
+			"text":      map[string]string{"type": "plain_text", "text": label},
+			"action_id": actionID,
+			"value":     requestID,
+		}
+		if style != "" {
+			element["style"] = style
+		}
+		return element
+	}
+
+	return &utils.SlackMessage{
+		ResponseType: "in_channel",
+		Text:         text,
+		Blocks: []interface{}{
+			map[string]interface{}{
+				"type": "section",
+				"text": map[string]string{"type": "mrkdwn", "text": text},
+			},
+			map[string]interface{}{
+				"type": "actions",
+				"elements": []interface{}{
+					button("Approve", slackActionApproveDeploy, "primary"),
+					button("Cancel", slackActionCancelDeploy, "danger"),
+				},
+			},
+		},
+	}
+}
+
+// appGitSource returns the repository and branch an app was last deployed from
+func appGitSource(appName string) (string, string, error) {
+	if deployment, err := database.GetAppDeployment(appName); err == nil && deployment.GitURL != "" {
+		return deployment.GitURL, deployment.GitBranch, nil
+	}
+
+	connection, err := api.GitHub.GetGitHubRepositoryConnectionByAppName(context.Background(), appName)
+	if err != nil {
+		return "", "", fmt.Errorf("`%s` has no git source, deploy it from Citizen first", appName)
+	}
+	branch, err := api.GitHub.GetGitHubRepositoryDeployBranch(context.Background(), appName)
+	if err != nil || branch == "" {
+		branch = "main"
+	}
+	return fmt.Sprintf("https://github.com/%s.git", connection.FullName), branch, nil
+}
+
+// canDeployFromSlack reports whether a user may request or approve deployments of an app from
+// Slack: admins, and the user who connected the repository of the app, as with canRunChatOps
+func canDeployFromSlack(ctx context.Context, userID int, appName string) bool {
+	if connection, err := api.GitHub.GetGitHubRepositoryConnectionByAppName(ctx, appName); err == nil {
+		return canRunChatOps(ctx, userID, connection)
+	}
+	isAdmin, err := api.Users.IsUserAdmin(ctx, userID)
+	return err == nil && isAdmin
+}
+
+// slackStateKey stores the session an install state was generated for
+func slackStateKey(state string) string {
+	return "slack_install_state:" + state
+}
+
+// slackDeployRequestKey stores a deployment request waiting for approval
+func slackDeployRequestKey(requestID string) string {
+	return "slack_deploy_request:" + requestID
+}
+
+// slackLinkedUser returns the Citizen user a Slack user acts as, or a message telling them how to link
+func slackLinkedUser(teamID, slackUserID string) (int, error) {
+	userID, err := api.Slack.GetLinkedUserID(context.Background(), teamID, slackUserID)
+	if errors.Is(err, api.ErrSlackUserNotLinked) {
+		return 0, errors.New("Your Slack account is not linked to Citizen. Connect Slack from your Citizen profile first.")
+	}
+	if err != nil {
+		log.Printf("[SLACK] Failed to look up Slack user %s: %v", slackUserID, err)
+		return 0, errors.New("Failed to look up your Citizen account, try again later.")
+	}
+	return userID, nil
+}
+
+// verifySlackRequest checks the Slack signature of the raw request body
+func verifySlackRequest(c *fiber.Ctx) bool {
+	if !utils.IsSlackConfigured() {
+		return false
+	}
+	return utils.ValidateSlackSignature(c.Get("X-Slack-Request-Timestamp"), c.Body(), c.Get("X-Slack-Signature"))
+}
+
+// slackEphemeral is a response only visible to the user who ran the command
+func slackEphemeral(text string) *utils.SlackMessage {
+	return &utils.SlackMessage{ResponseType: "ephemeral", Text: text}
+}
+
+// postSlackResponse sends a delayed response, logging failures
+func postSlackResponse(responseURL string, message *utils.SlackMessage) {
+	if err := utils.PostSlackResponse(responseURL, message); err != nil {
+		log.Printf("[SLACK] ⚠️ Failed to post response: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultSoftDeleteRetentionDays is how long soft-deleted rows are kept by a purge without older_than_days
+const defaultSoftDeleteRetentionDays = 30
+
+// ListSoftDeleted returns the soft-deleted deployments and repository connections, flagging the
+// apps that still exist on dokku and can be restored
+func ListSoftDeleted(c *fiber.Ctx) error {
+	deployments, err := api.Deployments.ListSoftDeletedDeployments(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list soft-deleted deployments: "+err.Error(),
+			nil,
+		))
+	}
+	repositories, err := api.Deployments.ListSoftDeletedRepositories(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list soft-deleted repositories: "+err.Error(),
+			nil,
+		))
+	}
+
+	apps, err := utils.ListApps()
+	if err != nil {
+		utils.WarnLog("Failed to list dokku apps for soft-deleted rows: %v", err)
+	}
+	restorable := []string{}
+	seen := make(map[string]bool)
+	add := func(appName string) {
+		if !seen[appName] && slices.Contains(apps, appName) {
+			restorable = append(restorable, appName)
+		}
+		seen[appName] = true
+	}
+	for _, deployment := range deployments {
+		add(deployment.AppName)
+	}
+	for _, repository := range repositories {
+		add(repository.AppName)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Soft-deleted data retrieved successfully",
+		fiber.Map{
+			"deployments":     deployments,
+			"repositories":    repositories,
+			"restorable_apps": restorable,
+		},
+	))
+}
+
+// RestoreSoftDeleted restores the soft-deleted deployment and repository connection of an app
+// that still exists on dokku
+func RestoreSoftDeleted(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	apps, err := utils.ListApps()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list dokku apps: "+err.Error(),
+			nil,
+		))
+	}
+	if !slices.Contains(apps, appName) {
+		return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+			false,
+			"App "+appName+" no longer exists on dokku, its data can only be purged",
+			nil,
+		))
+	}
+
+	restored, err := api.Deployments.RestoreSoftDeletedApp(c.Context(), appName)
+	auditSystemAction(c, "soft_deleted_restore", appName, map[string]interface{}{"restored": restored}, err)
+	if errors.Is(err, api.ErrNothingToRestore) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"No soft-deleted data for app "+appName,
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to restore app data: "+err.Error(),
+			nil,
+		))
+	}
+
+	message := "App data restored"
+	if restored.Repositories > 0 {
+		message += ", re-enable auto deploy to recreate the GitHub webhook"
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		message,
+		fiber.Map{"app_name": appName, "restored": restored},
+	))
+}
+
+// PurgeSoftDeleted permanently deletes the rows soft-deleted more than older_than_days ago
+func PurgeSoftDeleted(c *fiber.Ctx) error {
+	days := defaultSoftDeleteRetentionDays
+	if value := c.Query("older_than_days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"older_than_days must be a number of days, 0 or more",
+				nil,
+			))
+		}
+		days = parsed
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	purged, err := api.Deployments.PurgeSoftDeleted(c.Context(), cutoff)
+	auditSystemAction(c, "soft_deleted_purge", cutoff.Format(time.RFC3339), map[string]interface{}{
+		"older_than_days": days,
+		"purged":          purged,
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to purge soft-deleted data: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Soft-deleted data purged",
+		fiber.Map{
+			"older_than_days": days,
+			"deleted_before":  cutoff,
+			"purged":          purged,
+		},
+	))
+}
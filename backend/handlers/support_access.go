@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// SupportTokenHeader is the header the platform operator sends a support access token in
+	SupportTokenHeader = "X-Citizen-Support-Token"
+
+	defaultSupportGrantHours = 24
+	maxSupportGrantHours     = 7 * 24
+)
+
+// supportReadableSections are the app routes a support token can read, "" being the app itself.
+// Routes returning secrets, config holding them or whole exports of the app are left out: env,
+// build-vars, export, image, share-links, webhooks, hooks, log-alerts, log-sinks, service-tokens
+// and identity-headers. New routes stay unreadable until they are added here.
+var supportReadableSections = []string{
+	"", "activities", "analytics", "badges", "builder", "buildpacks", "changelog", "custom-domains",
+	"deployment", "deployments", "domain-propagation", "domains", "logs", "pipeline", "production",
+	"promotion-link", "public-setting", "recommendations", "releases", "runtime", "scheduled-deploys",
+	"traffic", "type",
+}
+
+// ErrSupportAccessDenied is returned for support tokens used outside of what they grant
+var ErrSupportAccessDenied = errors.New("support access doesn't cover this request")
+
+// hashSupportToken returns the hash a support access token is stored as
+func hashSupportToken(token string) string {
+	return utils.HashToken(token)
+}
+
+// AuthenticateSupportToken returns the grant of the support token of a request, when the request
+// is a read of the app the grant is scoped to. The holder doesn't act as the granting user: no
+// user is attached to the request.
+func AuthenticateSupportToken(c *fiber.Ctx) (*api.SupportGrant, error) {
+	token := c.Get(SupportTokenHeader)
+	grant, err := api.Users.GetSupportGrantByToken(c.Context(), hashSupportToken(token))
+	if err != nil {
+		utils.SecurityLog("Rejected support token from %s: %v", utils.ClientIP(c), err)
+		return nil, err
+	}
+	if !grant.Active() {
+		utils.SecurityLog("Rejected expired or revoked support grant %d from %s", grant.ID, utils.ClientIP(c))
+		return nil, fmt.Errorf("support access grant expired or revoked")
+	}
+
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead:
+	default:
+		return grant, fmt.Errorf("%w: support access is read-only", ErrSupportAccessDenied)
+	}
+	// Routes match case-insensitively and with extra slashes, the path is matched the same way
+	requestPath := strings.ToLower(path.Clean(c.Path()))
+	rest, ok := strings.CutPrefix(requestPath, "/api/v1/citizen/apps/"+strings.ToLower(grant.AppName))
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return grant, fmt.Errorf("%w: support access is limited to app %s", ErrSupportAccessDenied, grant.AppName)
+	}
+	section, _, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+	if !slices.Contains(supportReadableSections, section) {
+		return grant, fmt.Errorf("%w: %s of app %s is not readable with support access", ErrSupportAccessDenied, section, grant.AppName)
+	}
+
+	if err := api.Users.RecordSupportGrantUse(context.Background(), grant.ID, utils.ClientIP(c)); err != nil {
+		utils.WarnLog("Failed to record the use of support grant %d: %v", grant.ID, err)
+	}
+	utils.SecurityLog("Support grant %d of user %d used from %s: %s %s", grant.ID, grant.GrantedBy, utils.ClientIP(c), c.Method(), c.Path())
+	return grant, nil
+}
+
+// CreateSupportGrant gives read-only access to an app to whoever holds the returned token, for
+// the platform operator to debug it. The token is only returned here, it is stored hashed.
+func CreateSupportGrant(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+	userID, ok := c.Locals("user_id").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"User not authenticated",
+			nil,
+		))
+	}
+
+	var req struct {
+		Reason         string `json:"reason"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = defaultSupportGrantHours
+	}
+	if req.ExpiresInHours < 1 || req.ExpiresInHours > maxSupportGrantHours {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			fmt.Sprintf("expires_in_hours must be between 1 and %d", maxSupportGrantHours),
+			nil,
+		))
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"reason must be at most 255 characters",
+			nil,
+		))
+	}
+
+	apps, err := utils.ListApps()
+	if err != nil {
+		return commandErrorResponse(c, "Failed to list apps", err, nil)
+	}
+	if !slices.Contains(apps, appName) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"App "+appName+" not found",
+			nil,
+		))
+	}
+
+	token := "support_" + generateSecureID()
+	grant := &api.SupportGrant{
+		AppName:   appName,
+		Reason:    req.Reason,
+		GrantedBy: userID,
+		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour),
+	}
+	if err := api.Users.CreateSupportGrant(c.Context(), grant, hashSupportToken(token)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to create support access grant: "+err.Error(),
+			nil,
+		))
+	}
+
+	utils.SecurityLog("User %d granted support access %d to app %s, expires %s", userID, grant.ID, appName, grant.ExpiresAt.Format(time.RFC3339))
+	return c.Status(fiber.StatusCreated).JSON(utils.NewCitizenResponse(
+		true,
+		"Support access granted, the token is only shown once",
+		fiber.Map{
+			"grant":  grant,
+			"token":  token,
+			"header": SupportTokenHeader,
+		},
+	))
+}
+
+// ListSupportGrants lists the support access grants the current user gave, with their usage
+func ListSupportGrants(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"User not authenticated",
+			nil,
+		))
+	}
+
+	grants, err := api.Users.ListSupportGrants(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve support access grants: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Support access grants retrieved successfully",
+		grants,
+	))
+}
+
+// RevokeSupportGrant ends a support access grant of the current user
+func RevokeSupportGrant(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"User not authenticated",
+			nil,
+		))
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid support access grant ID",
+			nil,
+		))
+	}
+
+	err = api.Users.RevokeSupportGrant(c.Context(), userID, id)
+	if errors.Is(err, api.ErrSupportGrantNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Support access grant not found or already revoked",
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to revoke support access grant: "+err.Error(),
+			nil,
+		))
+	}
+
+	utils.SecurityLog("User %d revoked support access %d", userID, id)
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Support access revoked",
+		fiber.Map{"id": id},
+	))
+}
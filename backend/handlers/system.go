@@ -0,0 +1,743 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// restartSettingKey stores the pending restart of all apps so it survives API restarts
+const restartSettingKey = "system.restart_apps.scheduled"
+
+// missedRestartGrace is how late a restart restored at startup may still run
+const missedRestartGrace = time.Hour
+
+// ScheduledRestart is a pending restart of all apps on the dokku host
+type ScheduledRestart struct {
+	At          time.Time `json:"at"`
+	Reason      string    `json:"reason,omitempty"`
+	ScheduledBy *int      `json:"scheduled_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+var (
+	restartMu      sync.Mutex
+	pendingRestart *ScheduledRestart
+	restartTimer   *time.Timer
+)
+
+// auditSystemAction records an admin operation on the dokku host in the system audit log
+func auditSystemAction(c *fiber.Ctx, action, target string, details map[string]interface{}, actionErr error) {
+	entry := &api.SystemAuditEntry{
+		Action:  action,
+		Target:  target,
+		Status:  "success",
+		Details: details,
+	}
+	if c != nil {
+		if uid, ok := c.Locals("user_id").(int); ok {
+			entry.UserID = &uid
+		}
+		entry.IPAddress = utils.ClientIP(c)
+	}
+	if actionErr != nil {
+		entry.Status = "error"
+		errorMsg := actionErr.Error()
+		entry.ErrorMessage = &errorMsg
+	}
+
+	if err := api.Audit.LogSystemAudit(context.Background(), entry); err != nil {
+		utils.WarnLog("Failed to write system audit entry for %s: %v", action, err)
+	}
+	actor := "scheduler"
+	if entry.UserID != nil {
+		actor = fmt.Sprintf("user %d", *entry.UserID)
+	}
+	utils.SecurityLog("System action %s on %q by %s: %s", action, target, actor, entry.Status)
+}
+
+// GetSystemCapabilities returns the dokku version, plugins and supported features of the host
+func GetSystemCapabilities(c *fiber.Ctx) error {
+	capabilities, err := utils.GetCapabilities(c.QueryBool("refresh", false))
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while probing host capabilities: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Capabilities fetched successfully",
+		capabilities,
+	))
+}
+
+// capabilityMissing writes a 501 response with guidance when the host lacks feature. When it
+// returns true the handler must return the accompanying error (the result of the write).
+func capabilityMissing(c *fiber.Ctx, feature string) (bool, error) {
+	var capErr *utils.CapabilityError
+	if err := utils.RequireCapability(feature); !errors.As(err, &capErr) {
+		return false, nil
+	}
+
+	return true, c.Status(fiber.StatusNotImplemented).JSON(utils.NewCitizenResponse(
+		false,
+		capErr.Error()+". "+capErr.Guidance,
+		capErr,
+	))
+}
+
+// GetDokkuVersion returns the dokku version of the host
+func GetDokkuVersion(c *fiber.Ctx) error {
+	version, err := utils.GetDokkuVersion()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while getting dokku version: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Dokku version fetched successfully",
+		fiber.Map{
+			"version": version,
+		},
+	))
+}
+
+// ListDokkuPlugins lists the plugins installed on the dokku host
+func ListDokkuPlugins(c *fiber.Ctx) error {
+	plugins, err := utils.ListPlugins()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while listing plugins: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Plugins fetched successfully",
+		fiber.Map{
+			"plugins": plugins,
+			"total":   len(plugins),
+		},
+	))
+}
+
+// InstallDokkuPlugin installs a plugin on the dokku host from a git URL
+func InstallDokkuPlugin(c *fiber.Ctx) error {
+	var req struct {
+		URL  string `json:"url"`
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	if req.URL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Plugin URL is required",
+			nil,
+		))
+	}
+
+	output, err := utils.InstallPlugin(req.URL, req.Name)
+	utils.InvalidateCapabilities()
+	auditSystemAction(c, "plugin_install", req.URL, map[string]interface{}{"name": req.Name}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while installing plugin: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Plugin installed successfully",
+		fiber.Map{
+			"url":    req.URL,
+			"name":   req.Name,
+			"output": output,
+		},
+	))
+}
+
+// UpdateDokkuPlugin updates an installed plugin, optionally to a specific version
+func UpdateDokkuPlugin(c *fiber.Ctx) error {
+	pluginName := c.Params("plugin_name")
+
+	var req struct {
+		Version string `json:"version"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Invalid request content",
+				nil,
+			))
+		}
+	}
+
+	output, err := utils.UpdatePlugin(pluginName, req.Version)
+	utils.InvalidateCapabilities()
+	auditSystemAction(c, "plugin_update", pluginName, map[string]interface{}{"version": req.Version}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while updating plugin: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Plugin updated successfully",
+		fiber.Map{
+			"name":    pluginName,
+			"version": req.Version,
+			"output":  output,
+		},
+	))
+}
+
+// GetGlobalDomains returns the global domain configuration of the dokku host
+func GetGlobalDomains(c *fiber.Ctx) error {
+	domains, enabled, err := utils.GetGlobalDomains()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while getting global domains: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Global domains fetched successfully",
+		fiber.Map{
+			"domains": domains,
+			"enabled": enabled,
+		},
+	))
+}
+
+// SetGlobalDomains replaces the global domains of the dokku host
+func SetGlobalDomains(c *fiber.Ctx) error {
+	var req struct {
+		Domains []string `json:"domains"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	_, err := utils.SetGlobalDomains(req.Domains)
+	auditSystemAction(c, "global_domains_set", "", map[string]interface{}{"domains": req.Domains}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while setting global domains: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Global domains updated successfully",
+		fiber.Map{
+			"domains": req.Domains,
+		},
+	))
+}
+
+// AddGlobalDomain adds a global domain to the dokku host
+func AddGlobalDomain(c *fiber.Ctx) error {
+	var req struct {
+		Domain string `json:"domain"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	if req.Domain == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Domain name is required",
+			nil,
+		))
+	}
+
+	_, err := utils.AddGlobalDomain(req.Domain)
+	auditSystemAction(c, "global_domain_add", req.Domain, nil, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while adding global domain: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Global domain added successfully",
+		fiber.Map{
+			"domain": req.Domain,
+		},
+	))
+}
+
+// RemoveGlobalDomain removes a global domain from the dokku host
+func RemoveGlobalDomain(c *fiber.Ctx) error {
+	domain := c.Params("domain")
+
+	_, err := utils.RemoveGlobalDomain(domain)
+	auditSystemAction(c, "global_domain_remove", domain, nil, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while removing global domain: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Global domain removed successfully",
+		fiber.Map{
+			"domain": domain,
+		},
+	))
+}
+
+// GetScheduledRestart returns the pending restart of all apps, if any
+func GetScheduledRestart(c *fiber.Ctx) error {
+	restartMu.Lock()
+	restart := pendingRestart
+	restartMu.Unlock()
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Scheduled restart fetched successfully",
+		fiber.Map{
+			"scheduled": restart != nil,
+			"restart":   restart,
+		},
+	))
+}
+
+// ScheduleRestart schedules a restart of all apps on the dokku host at a given time or after a
+// delay, replacing any restart already scheduled. The host itself is not rebooted, the API only
+// has dokku-user SSH access.
+func ScheduleRestart(c *fiber.Ctx) error {
+	var req struct {
+		At     string `json:"at"`
+		Delay  string `json:"delay"`
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	var at time.Time
+	switch {
+	case req.At != "":
+		parsed, err := time.Parse(time.RFC3339, req.At)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Invalid time, expected RFC3339 such as 2026-01-02T03:04:05Z",
+				nil,
+			))
+		}
+		at = parsed
+	case req.Delay != "":
+		delay, err := time.ParseDuration(req.Delay)
+		if err != nil || delay < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Invalid delay, expected a duration such as 30s, 5m or 1h",
+				nil,
+			))
+		}
+		at = time.Now().Add(delay)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Either at or delay is required",
+			nil,
+		))
+	}
+
+	if at.Before(time.Now().Add(-time.Minute)) {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Restart time must be in the future",
+			nil,
+		))
+	}
+
+	restart := &ScheduledRestart{
+		At:        at,
+		Reason:    req.Reason,
+		CreatedAt: time.Now(),
+	}
+	if uid, ok := c.Locals("user_id").(int); ok {
+		restart.ScheduledBy = &uid
+	}
+
+	err := persistScheduledRestart(restart)
+	auditSystemAction(c, "restart_apps_schedule", at.Format(time.RFC3339), map[string]interface{}{"reason": req.Reason}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while scheduling the restart: "+err.Error(),
+			nil,
+		))
+	}
+	armRestart(restart)
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Restart of all apps scheduled successfully",
+		restart,
+	))
+}
+
+// CancelScheduledRestart cancels the pending restart of all apps
+func CancelScheduledRestart(c *fiber.Ctx) error {
+	restartMu.Lock()
+	restart := pendingRestart
+	if restartTimer != nil {
+		restartTimer.Stop()
+		restartTimer = nil
+	}
+	pendingRestart = nil
+	restartMu.Unlock()
+
+	if restart == nil {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"No restart is scheduled",
+			nil,
+		))
+	}
+
+	err := api.Settings.DeleteSystemSetting(context.Background(), restartSettingKey)
+	auditSystemAction(c, "restart_apps_cancel", restart.At.Format(time.RFC3339), nil, err)
+	if err != nil {
+		utils.WarnLog("Failed to clear persisted restart schedule: %v", err)
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Scheduled restart cancelled successfully",
+		nil,
+	))
+}
+
+// GetDeployDetectionConfig returns the order in which deploys detect their port and builder
+func GetDeployDetectionConfig(c *fiber.Ctx) error {
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Deploy detection config retrieved successfully",
+		fiber.Map{
+			"config":        utils.GetDetectionConfig(c.Context()),
+			"default_order": utils.DefaultDetectionOrder,
+		},
+	))
+}
+
+// SetDeployDetectionConfig changes the order in which deploys detect their port and builder
+func SetDeployDetectionConfig(c *fiber.Ctx) error {
+	var config utils.DetectionConfig
+	if err := c.BodyParser(&config); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	if err := config.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	err := utils.SaveDetectionConfig(c.Context(), &config)
+	auditSystemAction(c, "deploy_detection_set", utils.DetectionSettingKey, map[string]interface{}{
+		"order":        config.Order,
+		"default_port": config.DefaultPort,
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save deploy detection config: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Deploy detection config updated",
+		config,
+	))
+}
+
+// GetGitSourceConfig returns the hosts apps can be deployed from by git URL
+func GetGitSourceConfig(c *fiber.Ctx) error {
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Git source config retrieved successfully",
+		fiber.Map{
+			"config":          utils.GetGitSourceConfig(c.Context()),
+			"allowed_schemes": utils.AllowedGitSchemes,
+		},
+	))
+}
+
+// SetGitSourceConfig changes the hosts apps can be deployed from by git URL
+func SetGitSourceConfig(c *fiber.Ctx) error {
+	var config utils.GitSourceConfig
+	if err := c.BodyParser(&config); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	if err := config.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	err := utils.SaveGitSourceConfig(c.Context(), &config)
+	auditSystemAction(c, "git_sources_set", utils.GitSourceSettingKey, map[string]interface{}{
+		"allowed_hosts": config.AllowedHosts,
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save git source config: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Git source config updated",
+		config,
+	))
+}
+
+// GetDatabasePoolConfig returns the stored database pool settings, the ones in effect and the
+// pool statistics
+func GetDatabasePoolConfig(c *fiber.Ctx) error {
+	settings := database.GetPoolSettings(c.Context())
+	effective := database.EffectivePoolSettings()
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Database pool config retrieved successfully",
+		fiber.Map{
+			"config":           settings,
+			"effective":        effective,
+			"defaults":         database.DefaultPoolSettings(),
+			"restart_required": settings.RestartRequired(effective),
+			"stats":            database.GetDBStats(),
+		},
+	))
+}
+
+// SetDatabasePoolConfig changes the database pool settings. Connection settings apply right
+// away, pool sizes and lifetimes on the next restart.
+func SetDatabasePoolConfig(c *fiber.Ctx) error {
+	settings := database.GetPoolSettings(c.Context())
+	if err := c.BodyParser(settings); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	if err := settings.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	restartRequired, err := database.SavePoolSettings(c.Context(), settings)
+	auditSystemAction(c, "database_pool_set", database.PoolSettingKey, map[string]interface{}{
+		"settings":         settings,
+		"restart_required": restartRequired,
+	}, err)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to save database pool config: "+err.Error(),
+			nil,
+		))
+	}
+
+	message := "Database pool config updated"
+	if len(restartRequired) > 0 {
+		message += ", restart Citizen to apply " + strings.Join(restartRequired, ", ")
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		message,
+		fiber.Map{
+			"config":           settings,
+			"effective":        database.EffectivePoolSettings(),
+			"restart_required": restartRequired,
+		},
+	))
+}
+
+// ListSystemAudit returns the audit trail of admin operations on the dokku host
+func ListSystemAudit(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, err := api.Audit.ListSystemAudit(context.Background(), limit, offset)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"An error occurred while listing the audit log: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Audit log fetched successfully",
+		fiber.Map{
+			"entries": entries,
+			"limit":   limit,
+			"offset":  offset,
+		},
+	))
+}
+
+// RestoreScheduledRestart re-arms a restart persisted before the API restarted
+func RestoreScheduledRestart() {
+	value, err := api.Settings.GetSystemSetting(context.Background(), restartSettingKey)
+	if err != nil {
+		if !errors.Is(err, api.ErrSettingNotFound) {
+			utils.WarnLog("Failed to load scheduled restart: %v", err)
+		}
+		return
+	}
+
+	var restart ScheduledRestart
+	if err := json.Unmarshal([]byte(value), &restart); err != nil {
+		utils.WarnLog("Ignoring invalid scheduled restart %q: %v", value, err)
+		return
+	}
+
+	if time.Since(restart.At) > missedRestartGrace {
+		utils.WarnLog("Dropping scheduled restart for %s, it was missed while the API was down", restart.At.Format(time.RFC3339))
+		api.Settings.DeleteSystemSetting(context.Background(), restartSettingKey)
+		auditSystemAction(nil, "restart_apps_missed", restart.At.Format(time.RFC3339), nil, nil)
+		return
+	}
+
+	utils.InfoLog("Restored scheduled restart for %s", restart.At.Format(time.RFC3339))
+	armRestart(&restart)
+}
+
+// persistScheduledRestart stores the restart in system settings
+func persistScheduledRestart(restart *ScheduledRestart) error {
+	value, err := json.Marshal(restart)
+	if err != nil {
+		return err
+	}
+	return api.Settings.SetSystemSetting(context.Background(), restartSettingKey, string(value))
+}
+
+// armRestart replaces the pending restart timer
+func armRestart(restart *ScheduledRestart) {
+	restartMu.Lock()
+	defer restartMu.Unlock()
+
+	if restartTimer != nil {
+		restartTimer.Stop()
+	}
+	pendingRestart = restart
+	restartTimer = time.AfterFunc(time.Until(restart.At), func() {
+		runScheduledRestart(restart)
+	})
+}
+
+// runScheduledRestart restarts every app on the dokku host
+func runScheduledRestart(restart *ScheduledRestart) {
+	restartMu.Lock()
+	if pendingRestart != restart {
+		// Cancelled or replaced after the timer fired
+		restartMu.Unlock()
+		return
+	}
+	pendingRestart = nil
+	restartTimer = nil
+	restartMu.Unlock()
+
+	utils.InfoLog("Running scheduled restart of all apps (reason: %s)", restart.Reason)
+	_, err := utils.RestartAllApps()
+	auditSystemAction(nil, "restart_apps_execute", restart.At.Format(time.RFC3339), map[string]interface{}{"reason": restart.Reason}, err)
+	if err != nil {
+		utils.WarnLog("Scheduled restart of all apps failed: %v", err)
+	}
+
+	if err := api.Settings.DeleteSystemSetting(context.Background(), restartSettingKey); err != nil {
+		utils.WarnLog("Failed to clear persisted restart schedule: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"os"
+	"strings"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// trafficRanges are the default and maximum time ranges of each traffic granularity
+var trafficRanges = map[string]struct{ defaultRange, maxRange time.Duration }{
+	"hour": {24 * time.Hour, 31 * 24 * time.Hour},
+	"day":  {30 * 24 * time.Hour, 366 * 24 * time.Hour},
+}
+
+// GetAppTraffic returns request counts, status code distribution and latency of an app,
+// rolled up per hour or per day from the Traefik access logs
+func GetAppTraffic(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	granularity := c.Query("granularity", "hour")
+	ranges, ok := trafficRanges[granularity]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid granularity: use hour or day",
+			nil,
+		))
+	}
+
+	until := time.Now()
+	if value := c.Query("until"); value != "" {
+		parsed, err := utils.ParseLogTime(value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+		}
+		until = parsed
+	}
+	since := until.Add(-ranges.defaultRange)
+	if value := c.Query("since"); value != "" {
+		parsed, err := utils.ParseLogTime(value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(false, err.Error(), nil))
+		}
+		since = parsed
+	}
+	if !since.Before(until) || until.Sub(since) > ranges.maxRange {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"since must be before until and the range at most "+ranges.maxRange.String(),
+			nil,
+		))
+	}
+
+	// Include the hour the range starts in, and the day when rolling up per day
+	since = since.UTC().Truncate(time.Hour)
+	if granularity == "day" {
+		since = time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	rollups, err := api.Traffic.ListTrafficRollups(context.Background(), appName, since, until)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve traffic: "+err.Error(),
+			nil,
+		))
+	}
+
+	buckets, total := utils.SummarizeTraffic(rollups, granularity)
+	return c.Status(fiber.StatusOK).JSON(utils.NewCitizenResponse(
+		true,
+		"Traffic retrieved successfully",
+		fiber.Map{
+			"app_name":    appName,
+			"granularity": granularity,
+			"since":       since,
+			"until":       until,
+			"buckets":     buckets,
+			"total":       total,
+		},
+	))
+}
+
+// IngestTraffic accepts Traefik JSON access log lines pushed by a log shipper. The shipper
+// authenticates with the TRAFFIC_INGEST_TOKEN bearer token.
+func IngestTraffic(c *fiber.Ctx) error {
+	token := os.Getenv("TRAFFIC_INGEST_TOKEN")
+	if token == "" {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"Traffic ingestion is not enabled",
+			nil,
+		))
+	}
+
+	provided := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		utils.SecurityLog("Rejected traffic ingestion with invalid token from %s", utils.ClientIP(c))
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid ingestion token",
+			nil,
+		))
+	}
+
+	accepted, skipped, err := utils.IngestAccessLog(bytes.NewReader(c.Body()))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to read access log: "+err.Error(),
+			fiber.Map{"accepted": accepted, "skipped": skipped},
+		))
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(utils.NewCitizenResponse(
+		true,
+		"Access log ingested",
+		fiber.Map{"accepted": accepted, "skipped": skipped},
+	))
+}
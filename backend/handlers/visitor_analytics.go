@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultVisitorDays = 30
+	maxVisitorDays     = 365
+)
+
+// GetVisitorAnalytics returns the visitor analytics setting of an app with its daily requests and
+// unique visitors over ?days (30 by default). Counts are estimates from sampled requests and
+// lag up to an hour behind, the time between two flushes.
+func GetVisitorAnalytics(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+	days := c.QueryInt("days", defaultVisitorDays)
+	if days < 1 || days > maxVisitorDays {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"days must be between 1 and 365",
+			nil,
+		))
+	}
+
+	setting, err := api.Traffic.GetVisitorAnalyticsSetting(c.Context(), appName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve visitor analytics setting: "+err.Error(),
+			nil,
+		))
+	}
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -(days - 1))
+	stats, err := api.Traffic.ListVisitorStats(c.Context(), appName, since)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to retrieve visitor analytics: "+err.Error(),
+			nil,
+		))
+	}
+
+	var requests, visitors int64
+	for _, day := range stats {
+		requests += day.Requests
+		visitors += day.Visitors
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Visitor analytics retrieved successfully",
+		fiber.Map{
+			"setting": setting,
+			"days":    stats,
+			// Visitors are unique per day, the total counts a visitor once per day they came
+			"totals": fiber.Map{"requests": requests, "visitors": visitors},
+		},
+	))
+}
+
+// SetVisitorAnalytics opts an app in or out of visitor analytics. Busy apps can record a
+// sample_percent of their requests only.
+func SetVisitorAnalytics(c *fiber.Ctx) error {
+	appName := c.Params("app_name")
+	if appName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"App name is required",
+			nil,
+		))
+	}
+
+	setting := &api.VisitorAnalyticsSetting{AppName: appName, SamplePercent: 100}
+	if err := c.BodyParser(setting); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	setting.AppName = appName
+	if setting.SamplePercent < 1 || setting.SamplePercent > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"sample_percent must be between 1 and 100",
+			nil,
+		))
+	}
+	if setting.Enabled && !database.IsRedisAvailable() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(utils.NewCitizenResponse(
+			false,
+			"Visitor analytics need Redis, which is not available",
+			nil,
+		))
+	}
+
+	var userID *int
+	if uid, ok := c.Locals("user_id").(int); ok {
+		userID = &uid
+	}
+	if err := api.Traffic.SetVisitorAnalyticsSetting(c.Context(), setting, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to update visitor analytics setting: "+err.Error(),
+			nil,
+		))
+	}
+	database.ReloadVisitorSampling()
+
+	message := "Visitor analytics disabled"
+	if setting.Enabled {
+		message = "Visitor analytics enabled"
+	}
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		message,
+		setting,
+	))
+}
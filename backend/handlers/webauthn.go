@@ -0,0 +1,485 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database"
+	"backend/database/api"
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// passkeyCeremonyTTL is how long a registration or login ceremony can take once started
+const passkeyCeremonyTTL = 5 * time.Minute
+
+// passkeyCeremony is the challenge of a WebAuthn ceremony in progress. UserID is the user
+// registering a passkey, or the user named at login, 0 when any passkey may answer.
+type passkeyCeremony struct {
+	Type      string    `json:"type"`
+	Challenge []byte    `json:"challenge"`
+	UserID    int       `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Ceremonies live in Redis when available, so any instance can finish them, and in memory otherwise
+var (
+	passkeyCeremonies     = make(map[string]*passkeyCeremony)
+	passkeyCeremoniesLock = &sync.Mutex{}
+)
+
+// startPasskeyCeremony stores a new ceremony and returns its ID
+func startPasskeyCeremony(ceremonyType string, userID int) (string, *passkeyCeremony, error) {
+	challenge, err := utils.NewWebAuthnChallenge()
+	if err != nil {
+		return "", nil, err
+	}
+	ceremonyID := generateSecureID()
+	ceremony := &passkeyCeremony{
+		Type:      ceremonyType,
+		Challenge: challenge,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(passkeyCeremonyTTL),
+	}
+	if err := database.SetJSON("passkey_ceremony:"+ceremonyID, ceremony, passkeyCeremonyTTL); err != nil {
+		passkeyCeremoniesLock.Lock()
+		for id, stale := range passkeyCeremonies {
+			if time.Now().After(stale.ExpiresAt) {
+				delete(passkeyCeremonies, id)
+			}
+		}
+		passkeyCeremonies[ceremonyID] = ceremony
+		passkeyCeremoniesLock.Unlock()
+	}
+	return ceremonyID, ceremony, nil
+}
+
+// takePasskeyCeremony returns a ceremony of the given type and forgets it, a challenge is only
+// answered once
+func takePasskeyCeremony(ceremonyID, ceremonyType string) (*passkeyCeremony, bool) {
+	if ceremonyID == "" {
+		return nil, false
+	}
+	// Taking the ceremony is atomic in both stores, so concurrent answers to a challenge can't both
+	// get it. A ceremony missing from Redis was consumed or expired, unless it was only kept in
+	// memory because Redis was unavailable when it began.
+	var ceremony *passkeyCeremony
+	var stored passkeyCeremony
+	if found, err := database.TakeJSON("passkey_ceremony:"+ceremonyID, &stored); found {
+		ceremony = &stored
+	} else {
+		if err != nil {
+			utils.WarnLog("Failed to take passkey ceremony from Redis: %v", err)
+		}
+		passkeyCeremoniesLock.Lock()
+		ceremony = passkeyCeremonies[ceremonyID]
+		delete(passkeyCeremonies, ceremonyID)
+		passkeyCeremoniesLock.Unlock()
+	}
+	if ceremony == nil || ceremony.Type != ceremonyType || time.Now().After(ceremony.ExpiresAt) {
+		return nil, false
+	}
+	return ceremony, true
+}
+
+// passkeyUserHandle is the user handle passkeys of a user are created with
+func passkeyUserHandle(userID int) string {
+	return utils.EncodeWebAuthnBytes([]byte(strconv.Itoa(userID)))
+}
+
+// passkeyDescriptors lists passkeys as credential descriptors of ceremony options
+func passkeyDescriptors(passkeys []api.Passkey) []fiber.Map {
+	descriptors := make([]fiber.Map, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		descriptor := fiber.Map{"type": "public-key", "id": utils.EncodeWebAuthnBytes(passkey.CredentialID)}
+		if len(passkey.Transports) > 0 {
+			descriptor["transports"] = passkey.Transports
+		}
+		descriptors = append(descriptors, descriptor)
+	}
+	return descriptors
+}
+
+// validPasskeyName checks the name a user gives a passkey
+func validPasskeyName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "Passkey", nil
+	}
+	if len(name) > 100 {
+		return "", errors.New("passkey name must be at most 100 characters")
+	}
+	return name, nil
+}
+
+// ListPasskeys lists the passkeys of the current user
+func ListPasskeys(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+
+	passkeys, err := api.Users.ListPasskeys(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list passkeys: "+err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Passkeys retrieved successfully",
+		passkeys,
+	))
+}
+
+// BeginPasskeyRegistration starts the registration of a passkey for the current user and returns
+// the options for navigator.credentials.create()
+func BeginPasskeyRegistration(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+
+	user, err := api.Users.GetUserByID(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(utils.NewCitizenResponse(
+			false,
+			"User not found",
+			nil,
+		))
+	}
+	passkeys, err := api.Users.ListPasskeys(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to list passkeys: "+err.Error(),
+			nil,
+		))
+	}
+
+	ceremonyID, ceremony, err := startPasskeyCeremony("registration", userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to start passkey registration",
+			nil,
+		))
+	}
+
+	rp := utils.GetWebAuthnRelyingParty()
+	params := make([]fiber.Map, 0, len(utils.WebAuthnAlgorithms))
+	for _, algorithm := range utils.WebAuthnAlgorithms {
+		params = append(params, fiber.Map{"type": "public-key", "alg": algorithm})
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Passkey registration started",
+		fiber.Map{
+			"ceremony_id": ceremonyID,
+			"public_key": fiber.Map{
+				"rp":   fiber.Map{"id": rp.ID, "name": rp.Name},
+				"user": fiber.Map{"id": passkeyUserHandle(userID), "name": user.Username, "displayName": user.Username},
+				// Challenges and IDs are base64url, for PublicKeyCredential.parseCreationOptionsFromJSON()
+				"challenge":          utils.EncodeWebAuthnBytes(ceremony.Challenge),
+				"pubKeyCredParams":   params,
+				"timeout":            passkeyCeremonyTTL.Milliseconds(),
+				"excludeCredentials": passkeyDescriptors(passkeys),
+				"attestation":        "none",
+				"authenticatorSelection": fiber.Map{
+					"residentKey":      "preferred",
+					"userVerification": "required",
+				},
+			},
+		},
+	))
+}
+
+// FinishPasskeyRegistration verifies the credential created for a registration and stores it
+func FinishPasskeyRegistration(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+
+	var req struct {
+		CeremonyID string                   `json:"ceremony_id"`
+		Name       string                   `json:"name"`
+		Credential utils.WebAuthnCredential `json:"credential"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	name, err := validPasskeyName(req.Name)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	ceremony, ok := takePasskeyCeremony(req.CeremonyID, "registration")
+	if !ok || ceremony.UserID != userID {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Passkey registration expired, start it again",
+			nil,
+		))
+	}
+
+	registration, err := utils.GetWebAuthnRelyingParty().VerifyWebAuthnRegistration(&req.Credential, ceremony.Challenge)
+	if err != nil {
+		utils.SecurityLog("User %d PASSKEY REGISTRATION FAILED - %v", userID, err)
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	transports := req.Credential.Response.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+	passkey := &api.Passkey{
+		UserID:         userID,
+		CredentialID:   registration.CredentialID,
+		PublicKey:      registration.PublicKey,
+		Algorithm:      registration.Algorithm,
+		SignCount:      registration.SignCount,
+		AAGUID:         registration.AAGUID,
+		Transports:     transports,
+		BackupEligible: registration.BackupEligible,
+		Name:           name,
+	}
+	if err := api.Users.CreatePasskey(c.Context(), passkey); err != nil {
+		if _, lookupErr := api.Users.GetPasskeyByCredentialID(c.Context(), registration.CredentialID); lookupErr == nil {
+			return c.Status(fiber.StatusConflict).JSON(utils.NewCitizenResponse(
+				false,
+				"This passkey is already registered",
+				nil,
+			))
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to store passkey: "+err.Error(),
+			nil,
+		))
+	}
+	utils.SecurityLog("User %d PASSKEY REGISTERED - ID: %d, Name: %s", userID, passkey.ID, passkey.Name)
+
+	return c.Status(fiber.StatusCreated).JSON(utils.NewCitizenResponse(
+		true,
+		"Passkey registered successfully",
+		passkey,
+	))
+}
+
+// RenamePasskey renames a passkey of the current user
+func RenamePasskey(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid passkey ID",
+			nil,
+		))
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+	name, err := validPasskeyName(req.Name)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	if err := api.Users.RenamePasskey(c.Context(), userID, id, name); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, api.ErrPasskeyNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Passkey renamed successfully",
+		fiber.Map{"id": id, "name": name},
+	))
+}
+
+// DeletePasskey removes a passkey of the current user, who can still log in with their password
+func DeletePasskey(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid passkey ID",
+			nil,
+		))
+	}
+
+	if err := api.Users.DeletePasskey(c.Context(), userID, id); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, api.ErrPasskeyNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	utils.SecurityLog("User %d PASSKEY DELETED - ID: %d", userID, id)
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Passkey deleted successfully",
+		nil,
+	))
+}
+
+// BeginPasskeyLogin starts a passkey login and returns the options for navigator.credentials.get().
+// With a username the passkeys of that user are listed, without one the browser offers the
+// passkeys it holds for Citizen. Unknown usernames get the same answer as users without passkeys.
+func BeginPasskeyLogin(c *fiber.Ctx) error {
+	var req struct {
+		Username string `json:"username"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Invalid request content",
+				nil,
+			))
+		}
+	}
+
+	userID := 0
+	passkeys := []api.Passkey{}
+	if req.Username != "" {
+		if user, err := api.Users.GetUserByUsername(c.Context(), req.Username); err == nil {
+			userID = int(user.ID)
+			if listed, err := api.Users.ListPasskeys(c.Context(), userID); err == nil {
+				passkeys = listed
+			}
+		} else {
+			// Tie the ceremony to no account, it can't be answered by any passkey
+			userID = -1
+		}
+	}
+
+	ceremonyID, ceremony, err := startPasskeyCeremony("login", userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(utils.NewCitizenResponse(
+			false,
+			"Failed to start passkey login",
+			nil,
+		))
+	}
+
+	return c.JSON(utils.NewCitizenResponse(
+		true,
+		"Passkey login started",
+		fiber.Map{
+			"ceremony_id": ceremonyID,
+			"public_key": fiber.Map{
+				"rpId":             utils.GetWebAuthnRelyingParty().ID,
+				"challenge":        utils.EncodeWebAuthnBytes(ceremony.Challenge),
+				"timeout":          passkeyCeremonyTTL.Milliseconds(),
+				"allowCredentials": passkeyDescriptors(passkeys),
+				"userVerification": "required",
+			},
+		},
+	))
+}
+
+// FinishPasskeyLogin verifies the assertion of a passkey login and opens a session like a
+// password login does. Password login stays available for users without a passkey at hand.
+func FinishPasskeyLogin(c *fiber.Ctx) error {
+	redirectURL := c.Query("redirect")
+
+	var req struct {
+		CeremonyID string                   `json:"ceremony_id"`
+		Credential utils.WebAuthnCredential `json:"credential"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid request content",
+			nil,
+		))
+	}
+
+	ceremony, ok := takePasskeyCeremony(req.CeremonyID, "login")
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+			false,
+			"Passkey login expired, start it again",
+			nil,
+		))
+	}
+
+	passkeyFailure := func(reason error) error {
+		utils.SecurityLog("PASSKEY LOGIN FAILED - Host: %s, Reason: %v", c.Hostname(), reason)
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"Passkey login failed",
+			nil,
+		))
+	}
+
+	credentialID, err := utils.DecodeWebAuthnBytes(req.Credential.RawID)
+	if err != nil || len(credentialID) == 0 {
+		return passkeyFailure(errors.New("invalid credential ID"))
+	}
+	passkey, err := api.Users.GetPasskeyByCredentialID(c.Context(), credentialID)
+	if err != nil {
+		return passkeyFailure(err)
+	}
+	if ceremony.UserID != 0 && ceremony.UserID != passkey.UserID {
+		return passkeyFailure(fmt.Errorf("passkey %d doesn't belong to the user named at login", passkey.ID))
+	}
+	if handle := req.Credential.Response.UserHandle; handle != "" && strings.TrimRight(handle, "=") != passkeyUserHandle(passkey.UserID) {
+		return passkeyFailure(fmt.Errorf("user handle doesn't match passkey %d", passkey.ID))
+	}
+
+	signCount, err := utils.GetWebAuthnRelyingParty().VerifyWebAuthnAssertion(&req.Credential, ceremony.Challenge, passkey.PublicKey, passkey.SignCount)
+	if err != nil {
+		return passkeyFailure(fmt.Errorf("passkey %d: %w", passkey.ID, err))
+	}
+	if err := api.Users.RecordPasskeyUse(context.Background(), passkey.ID, signCount); err != nil {
+		utils.WarnLog("Failed to record the use of passkey %d: %v", passkey.ID, err)
+	}
+
+	user, err := api.Users.GetUserByID(c.Context(), passkey.UserID)
+	if err != nil {
+		return passkeyFailure(err)
+	}
+	utils.SecurityLog("User %d PASSKEY LOGIN - Passkey: %d", passkey.UserID, passkey.ID)
+	return completeLogin(c, user, redirectURL)
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 	"time"
 
+	"backend/config"
 	"backend/database"
+	"backend/database/api"
 	"backend/handlers"
+	"backend/middleware"
 	"backend/routes"
+	"backend/scheduler"
 	"backend/utils"
 
 	"github.com/gofiber/fiber/v2"
@@ -19,6 +24,11 @@ import (
 )
 
 func main() {
+	// Keep the recent output for diagnostics bundles
+	if err := utils.CaptureRecentLogs(); err != nil {
+		log.Printf("Failed to capture recent logs: %v", err)
+	}
+
 	// Start startup process
 	utils.StartupLog("🚀 Starting Citizen Backend...")
 	
@@ -41,6 +51,9 @@ func main() {
 		utils.StartupLog("Loaded .env file")
 	}
 
+	// Validate the configuration, strict mode refuses to start on critical misconfiguration
+	validateConfig()
+
 	// Initialize encryption system (required for production)
 	utils.StartupLog("Initializing encryption system...")
 	if err := utils.InitEncryption(); err != nil {
@@ -68,6 +81,11 @@ func main() {
 			log.Fatalf("Migration failed: %v", err)
 		}
 		utils.StartupLog("Database migrations completed")
+
+		// Pool settings stored through the settings API need the system_settings table
+		if err := database.ApplyStoredPoolSettings(context.Background()); err != nil {
+			utils.WarnLog("Keeping the default database pool settings: %v", err)
+		}
 		
 		// Create admin user (if environment variables are set)
 		if err := database.CreateAdminUserFromEnv(); err != nil {
@@ -81,6 +99,16 @@ func main() {
 		// Load GitHub config from database
 		utils.StartupLog("Loading GitHub configuration...")
 		loadGitHubConfigFromDB()
+		
+		// Load Slack config from database
+		if err := handlers.LoadSlackConfigFromDB(); err != nil {
+			utils.DatabaseDebugLog("No Slack config found in database: %v", err)
+		}
+
+		// Load dashboard origins and cookie domains
+		if err := utils.LoadDashboardAccessConfig(context.Background()); err != nil {
+			utils.WarnLog("Failed to load dashboard access config: %v", err)
+		}
 	} else {
 		utils.WarnLog("SKIP_DB_PING=true - Database connection skipped")
 	}
@@ -106,6 +134,13 @@ func main() {
 		WriteTimeout: 30 * time.Second,  // 30 second write timeout
 		ServerHeader: "",                // Hide server info
 		ErrorHandler: customErrorHandler,
+		// Forwarded host and protocol are only read from requests of trusted proxies
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          utils.TrustedProxies(),
+		// Bodies are streamed so deploy archives can exceed BodyLimit, middleware.BodyLimit
+		// holds every other route to it
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 	})
 
 	// Add middleware
@@ -121,8 +156,8 @@ func main() {
 		})
 	})
 
-	// Background cleanup task
-	go startBackgroundTasks()
+	// Background maintenance tasks
+	startBackgroundTasks()
 
 	// Setup routes
 	utils.StartupLog("Setting up API routes...")
@@ -142,16 +177,28 @@ func main() {
 
 // setupMiddleware configures all middleware
 func setupMiddleware(app *fiber.App) {
+	// Correlation ID first, so every log line of a request can include it
+	app.Use(middleware.CorrelationID())
+
+	// Request bodies over BodyLimit are refused, deploy archive uploads are capped by their handler
+	app.Use(middleware.BodyLimit())
+
+	// Forwarded headers from anything but a trusted proxy are spoofed
+	app.Use(middleware.ForwardedHeaders())
+
+	// Requests refused by the SSH circuit breaker answer 503 while the dokku host is down
+	app.Use(middleware.SSHCircuitBreaker())
+
 	// Enhanced logger middleware
 	if utils.IsDevelopmentEnvironment() {
 		app.Use(logger.New(logger.Config{
-			Format: "[${time}] ${status} - ${method} ${path} - ${latency}\n",
+			Format: "[${time}] ${status} - ${method} ${path} - ${latency} - ${locals:request_id}\n",
 			TimeFormat: "15:04:05",
 		}))
 	} else {
 		// Minimal logging in production
 		app.Use(logger.New(logger.Config{
-			Format: "${time} ${status} ${method} ${path} ${latency}\n",
+			Format: "${time} ${status} ${method} ${path} ${latency} ${locals:request_id}\n",
 			TimeFormat: time.RFC3339,
 		}))
 	}
@@ -216,57 +263,28 @@ func setupMiddleware(app *fiber.App) {
 
 // setupCORS configures CORS based on environment
 func setupCORS(app *fiber.App, isProduction bool) {
-	var corsOrigins string
 	var allowedMethods string
 	var allowedHeaders string
 	
 	if isProduction {
-		// Production: Subdomain support
-		mainDomain := os.Getenv("MAIN_DOMAIN")
-		if mainDomain == "" {
-			mainDomain = "localhost" // Fallback for testing
-		}
-		corsOrigins = fmt.Sprintf("https://%s,https://*.%s", mainDomain, mainDomain)
+		// Production: MAIN_DOMAIN, its subdomains and the configured dashboard origins
 		allowedMethods = "GET,POST,PUT,DELETE,OPTIONS"
-		allowedHeaders = "Origin,Content-Type,Accept,Authorization,X-Requested-With,Cookie"
+		allowedHeaders = "Origin,Content-Type,Accept,Authorization,X-Requested-With,Cookie,X-Request-ID"
 	} else {
 		// Development: Dynamic CORS policy for localhost subdomain support
-		corsOrigins = "*" // Allow all origins in development
 		allowedMethods = "GET,POST,PUT,DELETE,OPTIONS,PATCH,HEAD"
-		allowedHeaders = "Origin,Content-Type,Accept,Authorization,X-Requested-With,Cookie,X-Forwarded-For,X-Real-IP,User-Agent,Referer"
+		allowedHeaders = "Origin,Content-Type,Accept,Authorization,X-Requested-With,Cookie,X-Forwarded-For,X-Real-IP,User-Agent,Referer,X-Request-ID"
 	}
 	
-	utils.StartupLog("CORS Origins: %s", corsOrigins)
+	utils.StartupLog("CORS Origins: MAIN_DOMAIN=%s, dashboard origins: %v", os.Getenv("MAIN_DOMAIN"), utils.GetDashboardAccessConfig().Origins)
 	
-	if isProduction {
-		// Production: Use strict CORS
-		app.Use(cors.New(cors.Config{
-			AllowOrigins:     corsOrigins,
-			AllowCredentials: true,
-			AllowMethods:     allowedMethods,
-			AllowHeaders:     allowedHeaders,
-			ExposeHeaders:    "Set-Cookie",
-		}))
-	} else {
-		// Development: Dynamic CORS for localhost subdomains
-		app.Use(cors.New(cors.Config{
-			AllowOriginsFunc: func(origin string) bool {
-				// Allow localhost and any *.localhost subdomain
-				if strings.Contains(origin, "localhost") {
-					return true
-				}
-				// Allow common dev ports
-				if strings.Contains(origin, "127.0.0.1") {
-					return true
-				}
-				return false
-			},
-			AllowCredentials: true,
-			AllowMethods:     allowedMethods,
-			AllowHeaders:     allowedHeaders,
-			ExposeHeaders:    "Set-Cookie",
-		}))
-	}
+	app.Use(cors.New(cors.Config{
+		AllowOriginsFunc: utils.DashboardOriginAllowed,
+		AllowCredentials: true,
+		AllowMethods:     allowedMethods,
+		AllowHeaders:     allowedHeaders,
+		ExposeHeaders:    "Set-Cookie,X-Request-ID",
+	}))
 }
 
 // customErrorHandler handles errors in a structured way
@@ -289,21 +307,279 @@ func customErrorHandler(c *fiber.Ctx, err error) error {
 	})
 }
 
-// startBackgroundTasks starts background maintenance tasks
+// webhookEventRetention is how long GitHub webhook events are kept before pruning
+const webhookEventRetention = 30 * 24 * time.Hour
+
+// portCacheRetention is how long cached port detection results are kept
+const portCacheRetention = 30 * 24 * time.Hour
+
+// trafficRetention is how long hourly traffic rollups are kept
+const trafficRetention = 90 * 24 * time.Hour
+
+// startBackgroundTasks registers background maintenance tasks and starts the scheduler
 func startBackgroundTasks() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-	
-	utils.StartupLog("Background cleanup tasks started")
-	
-	for {
-		select {
-		case <-ticker.C:
-			// Clean expired SSO tokens
+	scheduler.Default.Register("session_cleanup", "Remove expired SSO sessions from memory", 5*time.Minute,
+		func(ctx context.Context) error {
 			handlers.CleanExpiredSSOTokens()
-			utils.DebugLog("Expired SSO tokens cleanup completed")
-		}
+			return nil
+		})
+
+	scheduler.Default.Register("webhook_event_pruning", "Delete GitHub webhook events older than 30 days", 24*time.Hour,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			deleted, err := api.GitHub.PruneWebhookEvents(ctx, time.Now().Add(-webhookEventRetention))
+			if err != nil {
+				return err
+			}
+			utils.DebugLog("Pruned %d webhook events", deleted)
+			return nil
+		})
+
+	scheduler.Default.Register("port_cache_pruning", "Delete cached port detection results older than 30 days", 24*time.Hour,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			deleted, err := api.PortDetection.PruneCachedPorts(ctx, time.Now().Add(-portCacheRetention))
+			if err != nil {
+				return err
+			}
+			utils.DebugLog("Pruned %d cached port detections", deleted)
+			return nil
+		})
+
+	scheduler.Default.Register("traffic_rollup", "Ingest the Traefik access log and store per-app traffic rollups", time.Minute,
+		func(ctx context.Context) error {
+			if _, err := utils.IngestAccessLogFile(); err != nil {
+				utils.WarnLog("Failed to read Traefik access log: %v", err)
+			}
+			if database.DB == nil {
+				return nil
+			}
+			return utils.Traffic.Flush(ctx)
+		})
+
+	scheduler.Default.Register("traffic_pruning", "Delete traffic rollups older than 90 days", 24*time.Hour,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			deleted, err := api.Traffic.PruneTrafficRollups(ctx, time.Now().Add(-trafficRetention))
+			if err != nil {
+				return err
+			}
+			utils.DebugLog("Pruned %d traffic rollups", deleted)
+			return nil
+		})
+
+	scheduler.Default.Register("visitor_stats_flush", "Copy the visitor analytics counters from Redis to the daily stats", time.Hour,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			return database.FlushVisitorStats(ctx)
+		})
+
+	scheduler.Default.Register("visitor_stats_pruning", "Delete daily visitor stats older than 13 months", 24*time.Hour,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			deleted, err := api.Traffic.PruneVisitorStats(ctx, time.Now().Add(-database.VisitorStatsRetention))
+			if err != nil {
+				return err
+			}
+			utils.DebugLog("Pruned %d daily visitor stats", deleted)
+			return nil
+		})
+
+	scheduler.Default.Register("usage_sampling", "Sample the CPU and memory use of app containers for scaling recommendations", utils.UsageSampleInterval,
+		func(ctx context.Context) error {
+			return utils.Usage.Sample(ctx)
+		})
+
+	scheduler.Default.Register("log_alerts", "Match new app log lines against log alert rules and forward them to log sinks", time.Minute,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			return utils.IngestAppLogs(ctx)
+		})
+
+	scheduler.Default.Register("domain_checks", "Check the DNS records and TLS certificates of all app domains", time.Hour,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			_, err := utils.CheckAllDomains(ctx)
+			return err
+		})
+
+	scheduler.Default.Register("domain_propagation", "Re-check new custom domains until their DNS and app route are live", time.Minute,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			_, err := utils.RunDomainPropagationChecks(ctx)
+			return err
+		})
+
+	scheduler.Default.Register("operation_reconcile", "Compensate or retry operations left unfinished across dokku and the database", 5*time.Minute,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			reconciled, err := utils.ReconcileOperations(ctx)
+			if reconciled > 0 {
+				utils.InfoLog("Reconciled %d unfinished operations", reconciled)
+			}
+			return err
+		})
+
+	scheduler.Default.Register("webhook_delivery", "Retry due app webhook deliveries and prune old ones", time.Minute,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			if _, err := utils.DeliverDueWebhooks(ctx); err != nil {
+				return err
+			}
+			pruned, err := api.Webhooks.PruneWebhookDeliveries(ctx, time.Now().Add(-utils.WebhookDeliveryRetention))
+			if err != nil {
+				return err
+			}
+			utils.DebugLog("Pruned %d webhook deliveries", pruned)
+			return nil
+		})
+
+	scheduler.Default.Register("notification_digests", "Send the daily and weekly digests due in the time zone of each user", 15*time.Minute,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			sent, err := utils.SendDueDigests(ctx)
+			if sent > 0 {
+				utils.InfoLog("Sent %d notification digests", sent)
+			}
+			return err
+		})
+
+	scheduler.Default.Register("app_crash_watch", "Send app.crashed webhooks for app containers restarting or exited with an error", time.Minute,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			return utils.DetectAppCrashes(ctx)
+		})
+
+	scheduler.Default.Register("apps_health", "Recompute the traffic light health overview of all apps", time.Minute,
+		func(ctx context.Context) error {
+			if database.DB == nil || os.Getenv("SSH_HOST") == "" {
+				return nil
+			}
+			_, err := utils.RefreshAppsHealth(ctx)
+			return err
+		})
+
+	scheduler.Default.Register("uptime_sampling", "Sample whether the apps with status badges are up", time.Minute,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			return utils.SampleAppUptime(ctx)
+		})
+
+	scheduler.Default.Register("uptime_pruning", "Delete uptime samples older than 90 days", 24*time.Hour,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			deleted, err := api.Apps.PruneUptimeSamples(ctx, time.Now().Add(-utils.UptimeRetention))
+			if err != nil {
+				return err
+			}
+			utils.DebugLog("Pruned %d uptime samples", deleted)
+			return nil
+		})
+
+	scheduler.Default.Register("scheduled_deployments", "Start the deployments scheduled for a time that has come", time.Minute,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			started, err := handlers.RunDueScheduledDeployments(ctx)
+			if started > 0 {
+				utils.InfoLog("Started %d scheduled deployments", started)
+			}
+			return err
+		})
+
+	scheduler.Default.Register("image_cleanup", "Remove the unused images of old app releases and dangling build images", 24*time.Hour,
+		func(ctx context.Context) error {
+			if database.DB == nil || os.Getenv("SSH_HOST") == "" {
+				return nil
+			}
+			report, err := utils.RunImageCleanup(ctx, false)
+			if err != nil {
+				return err
+			}
+			if report.ImagesRemoved > 0 {
+				utils.InfoLog("Removed %d unused app images, reclaiming %s", report.ImagesRemoved, utils.FormatImageSize(report.Reclaimed))
+			}
+			return nil
+		})
+
+	scheduler.Default.Register("cache_refresh", "Reload GitHub OAuth, Slack and dashboard access configuration from database", 15*time.Minute,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			loadGitHubConfigFromDB()
+			if err := handlers.LoadSlackConfigFromDB(); err != nil {
+				utils.DatabaseDebugLog("No Slack config found in database: %v", err)
+			}
+			return utils.LoadDashboardAccessConfig(ctx)
+		})
+
+	scheduler.Default.Register("db_replica_checks", "Check the read replicas and their replication lag, and clear the primary reconnect backoff", 15*time.Second,
+		func(ctx context.Context) error {
+			if database.DB == nil {
+				return nil
+			}
+			return api.CheckReplicas(ctx)
+		})
+
+	scheduler.Default.Register("health_probes", "Probe database, Redis and SSH connectivity", time.Minute,
+		func(ctx context.Context) error {
+			var failures []string
+			if err := database.HealthCheck(); err != nil {
+				failures = append(failures, "database: "+err.Error())
+			}
+			if database.IsRedisAvailable() {
+				if err := database.RedisHealthCheck(); err != nil {
+					failures = append(failures, "redis: "+err.Error())
+				}
+			}
+			if os.Getenv("SSH_HOST") != "" {
+				if err := utils.SSHConnect(); err != nil {
+					failures = append(failures, "ssh: "+err.Error())
+				}
+			}
+			if len(failures) > 0 {
+				return fmt.Errorf("health probes failed: %s", strings.Join(failures, "; "))
+			}
+			return nil
+		})
+
+	// Override default intervals with values stored in system settings
+	if database.DB != nil {
+		scheduler.Default.LoadIntervalsFromSettings(context.Background())
+		handlers.RestoreScheduledRestart()
 	}
+
+	scheduler.Default.Start()
 }
 
 // loadGitHubConfigFromDB loads GitHub configuration from database on startup
@@ -311,7 +587,7 @@ func loadGitHubConfigFromDB() {
 	utils.DatabaseDebugLog("Loading GitHub config from database...")
 	
 	// Try to load config from database
-	clientID, clientSecret, redirectURI, webhookSecret, err := handlers.LoadGitHubConfigFromDB()
+	clientID, clientSecret, redirectURI, webhookSecret, redirectURIs, err := handlers.LoadGitHubConfigFromDB()
 	if err != nil {
 		utils.DatabaseDebugLog("No GitHub config found in database: %v", err)
 		return
@@ -323,6 +599,29 @@ func loadGitHubConfigFromDB() {
 		utils.ErrorLog("Failed to setup GitHub OAuth from database: %v", err)
 		return
 	}
+	utils.SetGitHubRedirectURIs(redirectURIs)
 	
 	utils.StartupLog("GitHub configuration loaded from database")
 }
+
+// validateConfig logs the configuration issues found at startup and stops the backend on critical
+// ones when CONFIG_STRICT=true
+func validateConfig() {
+	report := config.ValidateEnvironment()
+	for _, issue := range report.Issues {
+		switch issue.Severity {
+		case config.SeverityWarning:
+			utils.WarnLog("Config %s: %s", issue.Setting, issue.Message)
+		default:
+			utils.ErrorLog("Config %s (%s): %s", issue.Setting, issue.Severity, issue.Message)
+		}
+	}
+	if report.HasCritical() {
+		if report.Strict {
+			log.Fatalf("Refusing to start with %d critical configuration issues (CONFIG_STRICT=true)", report.Critical)
+		}
+		utils.WarnLog("Starting with %d critical configuration issues, set CONFIG_STRICT=true to refuse", report.Critical)
+	} else if len(report.Issues) == 0 {
+		utils.StartupLog("Configuration validated")
+	}
+}
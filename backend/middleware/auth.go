@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"errors"
+
 	"backend/database"
+	"backend/database/api"
 	"backend/handlers"
 	"backend/models"
 	"backend/utils"
@@ -14,6 +17,11 @@ func Protected() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get SSO session
 		ssoSessionID := c.Cookies("sso_session")
+
+		// Support access: a read-only token scoped to one app, without the session of a user
+		if ssoSessionID == "" && c.Get(handlers.SupportTokenHeader) != "" {
+			return supportAccess(c)
+		}
 		
 		// If SSO session is not found, return unauthorized
 		if ssoSessionID == "" {
@@ -25,7 +33,7 @@ func Protected() fiber.Handler {
 		}
 		
 		// Validate SSO session
-		session, err := handlers.GetSSOSession(ssoSessionID)
+		session, err := handlers.AuthenticateSSOCookie(c)
 		if err != nil || session == nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
 				false,
@@ -37,7 +45,7 @@ func Protected() fiber.Handler {
 		// Check user
 		var user models.User
 		err = database.DB.QueryRow(c.Context(),
-			"SELECT id, username, email, created_at, updated_at FROM users WHERE id = $1",
+			"SELECT id, username, email, created_at, updated_at FROM users WHERE id = $1 AND active",
 			session.UserID).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
@@ -50,7 +58,78 @@ func Protected() fiber.Handler {
 		// Save user ID to locals
 		c.Locals("user_id", session.UserID)
 		c.Locals("user", user)
+		c.Locals("sso_session", session)
 		
 		return c.Next()
 	}
-} 
\ No newline at end of file
+} 
+
+// AdminOnly restricts a route to admin users, must be used after Protected. The session gets a new
+// ID once an admin changed something.
+func AdminOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("user_id").(int)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+				false,
+				"User not authenticated",
+				nil,
+			))
+		}
+
+		isAdmin, err := api.Users.IsUserAdmin(c.Context(), userID)
+		if err != nil || !isAdmin {
+			utils.SecurityLog("Admin access denied for user %d on %s", userID, c.Path())
+			return c.Status(fiber.StatusForbidden).JSON(utils.NewCitizenResponse(
+				false,
+				"Admin privileges required",
+				nil,
+			))
+		}
+
+		c.Locals("is_admin", true)
+		return rotateSession(c)
+	}
+}
+
+// rotateSession runs the rest of the chain and gives the session a new ID when the
+// privilege-sensitive request succeeded
+func rotateSession(c *fiber.Ctx) error {
+	if err := c.Next(); err != nil {
+		return err
+	}
+
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return nil
+	}
+	if c.Response().StatusCode() >= fiber.StatusBadRequest {
+		return nil
+	}
+	if session, ok := c.Locals("sso_session").(*handlers.SSOSession); ok {
+		handlers.RotateSSOSession(c, session)
+	}
+	return nil
+}
+
+// supportAccess lets a request with a support access token through when the grant covers it
+func supportAccess(c *fiber.Ctx) error {
+	grant, err := handlers.AuthenticateSupportToken(c)
+	if errors.Is(err, handlers.ErrSupportAccessDenied) {
+		return c.Status(fiber.StatusForbidden).JSON(utils.NewCitizenResponse(
+			false,
+			err.Error(),
+			nil,
+		))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(utils.NewCitizenResponse(
+			false,
+			"Invalid or expired support token",
+			nil,
+		))
+	}
+
+	c.Locals("support_grant", grant)
+	return c.Next()
+}
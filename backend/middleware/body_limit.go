@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"io"
+	"strings"
+
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimit holds request bodies to the BodyLimit of the app. The server streams bodies so deploy
+// archives can be larger, this reads the body of every other request, refusing it with a 413 past
+// the limit. Deploy archive uploads keep their stream, their handler caps it.
+func BodyLimit() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req := c.Request()
+		if !req.IsBodyStream() || (c.Method() == fiber.MethodPost && isDeployArchivePath(c.Path())) {
+			return c.Next()
+		}
+
+		limit := c.App().Config().BodyLimit
+		if req.Header.ContentLength() > limit {
+			return bodyTooLarge(c)
+		}
+		body, err := io.ReadAll(io.LimitReader(req.BodyStream(), int64(limit)+1))
+		if err != nil {
+			c.Context().SetConnectionClose()
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Failed to read the request body",
+				nil,
+			))
+		}
+		if len(body) > limit {
+			return bodyTooLarge(c)
+		}
+		req.SetBodyRaw(body)
+		return c.Next()
+	}
+}
+
+// bodyTooLarge refuses a request whose body is over the limit. The rest of the body is left
+// unread, so the connection is closed.
+func bodyTooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(utils.NewCitizenResponse(
+		false,
+		"Request body too large",
+		nil,
+	))
+}
+
+// isDeployArchivePath tells whether path is the /citizen/apps/:app_name/deploy-archive route,
+// matched like Fiber routes it: case-insensitively and with an optional trailing slash
+func isDeployArchivePath(path string) bool {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	return len(segments) == 6 &&
+		strings.EqualFold(segments[0], "api") &&
+		strings.EqualFold(segments[1], "v1") &&
+		strings.EqualFold(segments[2], "citizen") &&
+		strings.EqualFold(segments[3], "apps") &&
+		segments[4] != "" &&
+		strings.EqualFold(segments[5], "deploy-archive")
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"strings"
+
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestIDHeader carries the correlation ID of a request, in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// CorrelationID gives every request a correlation ID, reusing a well-formed X-Request-ID sent by
+// the client. The ID is returned in the response, stored in locals as request_id, carried by the
+// user context and bound to the app named in the path, so the dokku commands and Traefik reloads
+// the request triggers are tagged with it.
+func CorrelationID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(RequestIDHeader)
+		if !utils.ValidCorrelationID(id) {
+			id = utils.NewCorrelationID()
+		}
+
+		c.Locals("request_id", id)
+		c.Set(RequestIDHeader, id)
+		c.SetUserContext(utils.WithCorrelationID(c.UserContext(), id))
+
+		if appName := appNameFromPath(c.Path()); appName != "" {
+			unbind := utils.BindAppCorrelationID(appName, id)
+			defer unbind()
+		}
+		return c.Next()
+	}
+}
+
+// appNameFromPath returns the app of an /apps/:app_name route. Route params aren't known before
+// routing, so the path is read directly.
+func appNameFromPath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i] == "apps" {
+			// Fiber reuses the path memory once the request ends
+			return strings.Clone(segments[i+1])
+		}
+	}
+	return ""
+}
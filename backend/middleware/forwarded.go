@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ForwardedHeaders rejects requests carrying X-Forwarded-* or X-Real-IP headers that don't come
+// from a trusted proxy (TRUSTED_PROXIES), so a client reaching Citizen directly can't pick the
+// address or host its requests are logged, rate limited and audited with
+func ForwardedHeaders() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if header := utils.SpoofedForwardedHeader(c); header != "" {
+			utils.SecurityLog("Rejected %s header from untrusted source %s: %s %s", header, c.Context().RemoteIP(), c.Method(), c.Path())
+			return c.Status(fiber.StatusBadRequest).JSON(utils.NewCitizenResponse(
+				false,
+				"Forwarded headers are only accepted from trusted proxies",
+				nil,
+			))
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// RateLimit limits the requests of a client to max per window, for the endpoints open without
+// authentication. Clients over the limit get a 429 with Retry-After.
+func RateLimit(max int, window time.Duration) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:          max,
+		Expiration:   window,
+		KeyGenerator: clientIP,
+		LimitReached: func(c *fiber.Ctx) error {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(window.Seconds())))
+			return c.Status(fiber.StatusTooManyRequests).JSON(utils.NewCitizenResponse(
+				false,
+				"Too many requests, try again later",
+				nil,
+			))
+		},
+	})
+}
+
+// clientIP returns the address of the client, read from forwarded headers of trusted proxies only
+func clientIP(c *fiber.Ctx) string {
+	return utils.ClientIP(c)
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SSHCircuitBreaker turns the server errors of requests whose dokku commands the SSH circuit
+// breaker refused into a 503 with Retry-After, so clients back off until the host recovers.
+// A request was refused when it returns an SSHUnavailableError or one of its commands was
+// refused. Requests that don't need the host, or failed for another reason, are left unchanged.
+func SSHCircuitBreaker() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestID, _ := c.Locals("request_id").(string)
+		refused := utils.WatchSSHRefusals(requestID)
+		err := c.Next()
+		var unavailable *utils.SSHUnavailableError
+		if !refused() && !errors.As(err, &unavailable) {
+			return err
+		}
+		if err == nil && c.Response().StatusCode() < fiber.StatusInternalServerError {
+			return nil
+		}
+
+		status := utils.GetSSHBreakerStatus()
+		retryAfter := 1
+		if status.NextProbeAt != nil {
+			retryAfter = max(1, int(time.Until(*status.NextProbeAt).Seconds())+1)
+		}
+		c.Response().ResetBody()
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+		return c.Status(fiber.StatusServiceUnavailable).JSON(utils.NewCitizenResponse(
+			false,
+			"The dokku host is unreachable, try again later",
+			fiber.Map{"error": "ssh_unavailable", "retry_after": retryAfter, "ssh_breaker": status},
+		))
+	}
+}
@@ -0,0 +1,28 @@
+-- Migration: 003_add_system_settings.sql
+-- Description: Add admin flag on users and key/value system settings (scheduler intervals etc.)
+-- Created: 2026-10-16
+
+-- Admin flag for users (admin user from environment is promoted on startup)
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS is_admin BOOLEAN DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS idx_users_is_admin ON users(is_admin);
+
+-- Create system_settings table for instance-wide configuration
+CREATE TABLE IF NOT EXISTS system_settings (
+    key VARCHAR(150) PRIMARY KEY,
+    value TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Index for webhook event pruning
+CREATE INDEX IF NOT EXISTS idx_github_webhook_events_created_at ON github_webhook_events(created_at);
+
+-- Add trigger for updated_at
+DROP TRIGGER IF EXISTS update_system_settings_updated_at ON system_settings;
+CREATE TRIGGER update_system_settings_updated_at BEFORE UPDATE ON system_settings FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('003_add_system_settings')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,21 @@
+-- Migration: 004_add_port_detection_cache.sql
+-- Description: Cache port detection results per repository commit
+-- Created: 2026-10-16
+
+-- Create port_detection_cache table (port NULL means no port config was found at that commit)
+CREATE TABLE IF NOT EXISTS port_detection_cache (
+    id SERIAL PRIMARY KEY,
+    repository VARCHAR(255) NOT NULL, -- owner/repo
+    commit_sha VARCHAR(64) NOT NULL,
+    port INTEGER,
+    source VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(repository, commit_sha)
+);
+
+-- Indexes for port_detection_cache
+CREATE INDEX IF NOT EXISTS idx_port_detection_cache_created_at ON port_detection_cache(created_at);
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('004_add_port_detection_cache')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,36 @@
+-- Migration: 005_add_deployment_history.sql
+-- Description: Keep a record (with build logs) for every deployment instead of only the latest
+-- Created: 2026-10-16
+
+-- Create deployment_history table, one row per deploy attempt
+CREATE TABLE IF NOT EXISTS deployment_history (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(255) NOT NULL,
+    activity_id INTEGER REFERENCES app_activities(id) ON DELETE SET NULL,
+    git_url TEXT,
+    git_branch VARCHAR(255),
+    git_commit VARCHAR(255),
+    status VARCHAR(50) NOT NULL DEFAULT 'pending', -- pending, success, error, cancelled
+    trigger_type VARCHAR(50) DEFAULT 'manual', -- manual, webhook, automatic
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    logs TEXT,
+    error_message TEXT,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    duration_ms BIGINT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for deployment_history
+CREATE INDEX IF NOT EXISTS idx_deployment_history_app_name ON deployment_history(app_name);
+CREATE INDEX IF NOT EXISTS idx_deployment_history_app_started ON deployment_history(app_name, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_deployment_history_status ON deployment_history(status);
+
+-- Add trigger for updated_at
+DROP TRIGGER IF EXISTS update_deployment_history_updated_at ON deployment_history;
+CREATE TRIGGER update_deployment_history_updated_at BEFORE UPDATE ON deployment_history FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('005_add_deployment_history')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,25 @@
+-- Migration: 006_add_system_audit_log.sql
+-- Description: Audit trail for admin operations on the dokku host (plugins, global domains, scheduled app restarts)
+-- Created: 2026-10-16
+
+-- Create system_audit_log table
+CREATE TABLE IF NOT EXISTS system_audit_log (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(100) NOT NULL, -- plugin_install, plugin_update, global_domains_set, restart_apps_schedule, ...
+    target VARCHAR(255),
+    status VARCHAR(50) NOT NULL, -- success, error
+    details JSONB,
+    error_message TEXT,
+    ip_address VARCHAR(64),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for system_audit_log
+CREATE INDEX IF NOT EXISTS idx_system_audit_log_created_at ON system_audit_log(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_system_audit_log_action ON system_audit_log(action);
+CREATE INDEX IF NOT EXISTS idx_system_audit_log_user_id ON system_audit_log(user_id);
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('006_add_system_audit_log')
+ON CONFLICT (version) DO NOTHING;
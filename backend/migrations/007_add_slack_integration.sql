@@ -0,0 +1,49 @@
+-- Migration: 007_add_slack_integration.sql
+-- Description: Slack app configuration, installed workspaces and Slack to Citizen user links
+-- Created: 2026-10-16
+
+-- Create slack_config table (client credentials and signing secret are stored encrypted)
+CREATE TABLE IF NOT EXISTS slack_config (
+    id SERIAL PRIMARY KEY,
+    client_id TEXT NOT NULL,
+    client_secret TEXT NOT NULL,
+    signing_secret TEXT NOT NULL,
+    redirect_uri VARCHAR(500) NOT NULL,
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_slack_config_active ON slack_config(is_active);
+
+-- Create slack_workspaces table (bot tokens are stored encrypted)
+CREATE TABLE IF NOT EXISTS slack_workspaces (
+    id SERIAL PRIMARY KEY,
+    team_id VARCHAR(50) NOT NULL UNIQUE,
+    team_name VARCHAR(255),
+    bot_user_id VARCHAR(50),
+    bot_token TEXT NOT NULL,
+    installed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create slack_user_links table (which Citizen user a Slack user acts as)
+CREATE TABLE IF NOT EXISTS slack_user_links (
+    id SERIAL PRIMARY KEY,
+    team_id VARCHAR(50) NOT NULL REFERENCES slack_workspaces(team_id) ON DELETE CASCADE,
+    slack_user_id VARCHAR(50) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (team_id, slack_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_slack_user_links_user_id ON slack_user_links(user_id);
+
+-- Trigger to keep slack_workspaces.updated_at current
+DROP TRIGGER IF EXISTS update_slack_workspaces_updated_at ON slack_workspaces;
+CREATE TRIGGER update_slack_workspaces_updated_at BEFORE UPDATE ON slack_workspaces FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('007_add_slack_integration')
+ON CONFLICT (version) DO NOTHING;
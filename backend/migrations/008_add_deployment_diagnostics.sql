@@ -0,0 +1,10 @@
+-- Migration: 008_add_deployment_diagnostics.sql
+-- Description: Store the port detection trace and orchestration steps of each deployment
+-- Created: 2026-10-16
+
+-- Diagnostics are recorded when a deployment finishes
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS diagnostics JSONB;
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('008_add_deployment_diagnostics')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,30 @@
+-- Migration: 009_add_app_traffic.sql
+-- Description: Hourly per-app traffic rollups aggregated from Traefik access logs
+-- Created: 2026-10-16
+
+-- Create app_traffic_hourly table, one row per app and hour
+CREATE TABLE IF NOT EXISTS app_traffic_hourly (
+    app_name VARCHAR(255) NOT NULL,
+    hour_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    requests BIGINT NOT NULL DEFAULT 0,
+    status_2xx BIGINT NOT NULL DEFAULT 0,
+    status_3xx BIGINT NOT NULL DEFAULT 0,
+    status_4xx BIGINT NOT NULL DEFAULT 0,
+    status_5xx BIGINT NOT NULL DEFAULT 0,
+    latency_sum_ms BIGINT NOT NULL DEFAULT 0,
+    latency_buckets BIGINT[] NOT NULL, -- request counts per latency bucket, see utils.TrafficLatencyBuckets
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (app_name, hour_start)
+);
+
+-- Indexes for app_traffic_hourly
+CREATE INDEX IF NOT EXISTS idx_app_traffic_hourly_hour_start ON app_traffic_hourly(hour_start);
+
+-- Add trigger for updated_at
+DROP TRIGGER IF EXISTS update_app_traffic_hourly_updated_at ON app_traffic_hourly;
+CREATE TRIGGER update_app_traffic_hourly_updated_at BEFORE UPDATE ON app_traffic_hourly FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('009_add_app_traffic')
+ON CONFLICT (version) DO NOTHING;
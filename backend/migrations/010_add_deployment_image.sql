@@ -0,0 +1,10 @@
+-- Migration: 010_add_deployment_image.sql
+-- Description: Record the Docker image built by each successful deployment
+-- Created: 2026-10-16
+
+-- Image ID (sha256:...) of dokku/<app>:latest right after the deployment succeeded
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS image_id TEXT;
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('010_add_deployment_image')
+ON CONFLICT (version) DO NOTHING;
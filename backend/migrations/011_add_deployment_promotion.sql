@@ -0,0 +1,10 @@
+-- Migration: 011_add_deployment_promotion.sql
+-- Description: Link deployments promoted from another app's image to the deployment they came from
+-- Created: 2026-10-16
+
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS source_app VARCHAR(255);
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS source_deployment_id INTEGER REFERENCES deployment_history(id) ON DELETE SET NULL;
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('011_add_deployment_promotion')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,34 @@
+-- Migration: 012_add_log_alert_rules.sql
+-- Description: Alert rules matched against app logs
+-- Created: 2026-10-16
+
+-- Create log_alert_rules table (notification URLs are stored encrypted)
+CREATE TABLE IF NOT EXISTS log_alert_rules (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(255) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    pattern VARCHAR(200) NOT NULL,
+    is_regex BOOLEAN NOT NULL DEFAULT false,
+    process_type VARCHAR(63), -- NULL matches every process
+    channel_type VARCHAR(20), -- slack, webhook or NULL for activities only
+    channel_url TEXT,
+    cooldown_seconds INTEGER NOT NULL DEFAULT 300,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    last_triggered_at TIMESTAMP WITH TIME ZONE,
+    suppressed_matches INTEGER NOT NULL DEFAULT 0, -- matches during the cooldown since the last alert
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for log_alert_rules
+CREATE INDEX IF NOT EXISTS idx_log_alert_rules_app_name ON log_alert_rules(app_name);
+CREATE INDEX IF NOT EXISTS idx_log_alert_rules_enabled ON log_alert_rules(enabled);
+
+-- Add trigger for updated_at
+DROP TRIGGER IF EXISTS update_log_alert_rules_updated_at ON log_alert_rules;
+CREATE TRIGGER update_log_alert_rules_updated_at BEFORE UPDATE ON log_alert_rules FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('012_add_log_alert_rules')
+ON CONFLICT (version) DO NOTHING;
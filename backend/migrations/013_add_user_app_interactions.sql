@@ -0,0 +1,23 @@
+-- Migration: 013_add_user_app_interactions.sql
+-- Description: Track the apps each user recently interacted with
+-- Created: 2026-10-16
+
+-- Create user_app_interactions table, one row per user and app
+CREATE TABLE IF NOT EXISTS user_app_interactions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    app_name VARCHAR(255) NOT NULL,
+    last_interaction VARCHAR(50) NOT NULL, -- deploy, logs, env
+    interaction_count INTEGER NOT NULL DEFAULT 1,
+    last_interacted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, app_name)
+);
+
+-- Indexes for user_app_interactions
+CREATE INDEX IF NOT EXISTS idx_user_app_interactions_user_recent ON user_app_interactions(user_id, last_interacted_at DESC);
+CREATE INDEX IF NOT EXISTS idx_user_app_interactions_app_name ON user_app_interactions(app_name);
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('013_add_user_app_interactions')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,10 @@
+-- Migration: 014_add_github_redirect_uris.sql
+-- Description: Allow several GitHub OAuth redirect URIs for instances reachable under multiple hostnames
+-- Created: 2026-10-16
+
+-- Every allowed redirect URI; redirect_uri stays the default used when none matches the request host
+ALTER TABLE github_config ADD COLUMN IF NOT EXISTS redirect_uris TEXT[] NOT NULL DEFAULT '{}';
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('014_add_github_redirect_uris')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,12 @@
+-- Migration: 015_add_deployment_retry.sql
+-- Description: Link a retried deployment to the failed deployment it re-runs
+-- Created: 2026-10-16
+
+-- The failed deployment a retry re-runs; the failed record itself is kept unchanged
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS retry_of_id INTEGER REFERENCES deployment_history(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_deployment_history_retry_of_id ON deployment_history(retry_of_id);
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('015_add_deployment_retry')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,20 @@
+-- Migration: 016_add_app_pending_restarts.sql
+-- Description: Track environment changes saved without restarting the app
+-- Created: 2026-10-16
+
+-- Create app_pending_restarts table, one row per app with changes waiting for a restart
+CREATE TABLE IF NOT EXISTS app_pending_restarts (
+    app_name VARCHAR(255) PRIMARY KEY,
+    changed_keys TEXT[] NOT NULL DEFAULT '{}',
+    requested_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    pending_since TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Add trigger for updated_at
+DROP TRIGGER IF EXISTS update_app_pending_restarts_updated_at ON app_pending_restarts;
+CREATE TRIGGER update_app_pending_restarts_updated_at BEFORE UPDATE ON app_pending_restarts FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('016_add_app_pending_restarts')
+ON CONFLICT (version) DO NOTHING;
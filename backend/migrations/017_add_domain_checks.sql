@@ -0,0 +1,30 @@
+-- Migration: 017_add_domain_checks.sql
+-- Description: Store the last DNS and TLS check of every app domain
+-- Created: 2026-10-16
+
+-- Create domain_checks table, one row per domain served by an app
+CREATE TABLE IF NOT EXISTS domain_checks (
+    domain VARCHAR(255) PRIMARY KEY,
+    app_name VARCHAR(255) NOT NULL,
+    is_custom BOOLEAN NOT NULL DEFAULT false,
+    verification_status VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    resolved_ips TEXT[] NOT NULL DEFAULT '{}',
+    tls_status VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    tls_issuer TEXT,
+    tls_expires_at TIMESTAMP WITH TIME ZONE,
+    error TEXT,
+    last_checked_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_domain_checks_app_name ON domain_checks(app_name);
+CREATE INDEX IF NOT EXISTS idx_domain_checks_tls_expires_at ON domain_checks(tls_expires_at);
+
+-- Add trigger for updated_at
+DROP TRIGGER IF EXISTS update_domain_checks_updated_at ON domain_checks;
+CREATE TRIGGER update_domain_checks_updated_at BEFORE UPDATE ON domain_checks FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('017_add_domain_checks')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,22 @@
+-- Migration: 018_unique_active_custom_domains.sql
+-- Description: Allow an active custom domain to belong to only one app
+-- Created: 2026-10-16
+
+-- Deactivate duplicates registered on several apps, the app that registered the domain first keeps it
+UPDATE app_custom_domains d
+SET is_active = false
+WHERE d.is_active = true
+  AND EXISTS (
+      SELECT 1 FROM app_custom_domains o
+      WHERE o.is_active = true
+        AND LOWER(o.domain) = LOWER(d.domain)
+        AND (o.created_at, o.id) < (d.created_at, d.id)
+  );
+
+-- One active row per domain, case insensitive
+CREATE UNIQUE INDEX IF NOT EXISTS idx_app_custom_domains_active_domain
+    ON app_custom_domains (LOWER(domain)) WHERE is_active = true;
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('018_unique_active_custom_domains')
+ON CONFLICT (version) DO NOTHING;
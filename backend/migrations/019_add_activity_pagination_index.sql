@@ -0,0 +1,7 @@
+-- Migration: 019_add_activity_pagination_index.sql
+-- Description: Index app activities by app and start time for the paginated activity history
+-- Created: 2026-10-16
+
+CREATE INDEX IF NOT EXISTS idx_app_activities_app_started_at ON app_activities (app_name, started_at DESC, id DESC);
+
+INSERT INTO schema_migrations (version) VALUES ('019_add_activity_pagination_index') ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,27 @@
+-- Migration: 020_add_operations.sql
+-- Description: Record multi-step operations across dokku and the database so partial failures can be compensated
+-- Created: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS operations (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(50) NOT NULL,
+    app_name VARCHAR(100) NOT NULL,
+    target VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'running', -- running, completed, compensating, compensated, retrying, failed, resolved
+    steps JSONB NOT NULL DEFAULT '[]',
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    request_id VARCHAR(100),
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_operations_status_updated_at ON operations (status, updated_at);
+CREATE INDEX IF NOT EXISTS idx_operations_app_name ON operations (app_name);
+
+DROP TRIGGER IF EXISTS update_operations_updated_at ON operations;
+CREATE TRIGGER update_operations_updated_at BEFORE UPDATE ON operations FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO schema_migrations (version) VALUES ('020_add_operations') ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,25 @@
+-- Migration: 021_add_app_share_links.sql
+-- Description: Time-limited links giving visitors without an account access to a private app
+-- Created: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS app_share_links (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE, -- SHA-256 of the token, the token itself is only shown once
+    label VARCHAR(100) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    use_count INTEGER NOT NULL DEFAULT 0,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    last_used_ip VARCHAR(45),
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_share_links_app_name ON app_share_links (app_name);
+
+DROP TRIGGER IF EXISTS update_app_share_links_updated_at ON app_share_links;
+CREATE TRIGGER update_app_share_links_updated_at BEFORE UPDATE ON app_share_links FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO schema_migrations (version) VALUES ('021_add_app_share_links') ON CONFLICT (version) DO NOTHING;
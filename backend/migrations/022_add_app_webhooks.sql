@@ -0,0 +1,46 @@
+-- Migration: 022_add_app_webhooks.sql
+-- Description: Signed outbound webhooks of app events with their delivery log
+-- Created: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS app_webhooks (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(100) NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL, -- encrypted, signs the deliveries
+    events TEXT[] NOT NULL DEFAULT '{}',
+    description VARCHAR(200) NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_webhooks_app_name ON app_webhooks (app_name);
+
+DROP TRIGGER IF EXISTS update_app_webhooks_updated_at ON app_webhooks;
+CREATE TRIGGER update_app_webhooks_updated_at BEFORE UPDATE ON app_webhooks FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TABLE IF NOT EXISTS app_webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES app_webhooks(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, succeeded, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_code INTEGER,
+    response_body TEXT,
+    error TEXT,
+    duration_ms INTEGER,
+    next_attempt_at TIMESTAMP WITH TIME ZONE,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_webhook_deliveries_webhook ON app_webhook_deliveries (webhook_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_app_webhook_deliveries_due ON app_webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+DROP TRIGGER IF EXISTS update_app_webhook_deliveries_updated_at ON app_webhook_deliveries;
+CREATE TRIGGER update_app_webhook_deliveries_updated_at BEFORE UPDATE ON app_webhook_deliveries FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO schema_migrations (version) VALUES ('022_add_app_webhooks') ON CONFLICT (version) DO NOTHING;
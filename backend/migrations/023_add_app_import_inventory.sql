@@ -0,0 +1,13 @@
+-- Migration: 023_add_app_import_inventory.sql
+-- Description: Record when an existing dokku app was imported into Citizen and its env keys then
+-- Created: 2026-10-16
+
+-- Set when an app created outside Citizen was imported, NULL for apps created by Citizen
+ALTER TABLE app_deployments ADD COLUMN IF NOT EXISTS imported_at TIMESTAMP WITH TIME ZONE;
+
+-- Names of the env vars the app had when imported, values are never copied
+ALTER TABLE app_deployments ADD COLUMN IF NOT EXISTS imported_env_keys TEXT[];
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('023_add_app_import_inventory')
+ON CONFLICT (version) DO NOTHING;
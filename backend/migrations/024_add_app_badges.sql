@@ -0,0 +1,28 @@
+-- Migration: 024_add_app_badges.sql
+-- Description: Per-app opt-in to public status badges and the hourly uptime samples they show
+-- Created: 2026-10-16
+
+-- Apps whose deploy status and uptime can be read without authentication
+CREATE TABLE IF NOT EXISTS app_badge_settings (
+    app_name VARCHAR(100) PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS update_app_badge_settings_updated_at ON app_badge_settings;
+CREATE TRIGGER update_app_badge_settings_updated_at BEFORE UPDATE ON app_badge_settings FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Uptime samples of badge-enabled apps, one row per app and hour
+CREATE TABLE IF NOT EXISTS app_uptime_hourly (
+    app_name VARCHAR(100) NOT NULL,
+    hour_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    samples INTEGER NOT NULL DEFAULT 0,
+    up_samples INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (app_name, hour_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_uptime_hourly_hour_start ON app_uptime_hourly (hour_start);
+
+INSERT INTO schema_migrations (version) VALUES ('024_add_app_badges') ON CONFLICT (version) DO NOTHING;
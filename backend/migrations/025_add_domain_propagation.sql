@@ -0,0 +1,28 @@
+-- Migration: 025_add_domain_propagation.sql
+-- Description: Re-check newly added custom domains until their DNS points to the server and the app answers
+-- Created: 2026-10-16
+
+-- One row per custom domain being watched, kept once live or timed out to show the outcome
+CREATE TABLE IF NOT EXISTS domain_propagation (
+    domain VARCHAR(255) PRIMARY KEY,
+    app_name VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, live or timed_out
+    attempts INTEGER NOT NULL DEFAULT 0,
+    verification_status VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    http_status INTEGER,
+    error TEXT,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    next_check_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_checked_at TIMESTAMP WITH TIME ZONE,
+    live_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_domain_propagation_app_name ON domain_propagation (app_name);
+CREATE INDEX IF NOT EXISTS idx_domain_propagation_due ON domain_propagation (next_check_at) WHERE status = 'pending';
+
+DROP TRIGGER IF EXISTS update_domain_propagation_updated_at ON domain_propagation;
+CREATE TRIGGER update_domain_propagation_updated_at BEFORE UPDATE ON domain_propagation FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO schema_migrations (version) VALUES ('025_add_domain_propagation') ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,36 @@
+-- Migration: 026_add_visitor_analytics.sql
+-- Description: Opt-in per-app visitor analytics sampled in ForwardAuth, with daily rollups
+-- Created: 2026-10-16
+
+-- Apps whose ForwardAuth requests are sampled for visitor analytics
+CREATE TABLE IF NOT EXISTS app_analytics_settings (
+    app_name VARCHAR(100) PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    sample_percent INTEGER NOT NULL DEFAULT 100 CHECK (sample_percent BETWEEN 1 AND 100),
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS update_app_analytics_settings_updated_at ON app_analytics_settings;
+CREATE TRIGGER update_app_analytics_settings_updated_at BEFORE UPDATE ON app_analytics_settings FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Daily visitor rollups, one row per app and UTC day, rewritten by every flush of the day
+CREATE TABLE IF NOT EXISTS app_visitors_daily (
+    app_name VARCHAR(100) NOT NULL,
+    day DATE NOT NULL,
+    requests BIGINT NOT NULL DEFAULT 0,
+    visitors BIGINT NOT NULL DEFAULT 0,
+    top_paths JSONB NOT NULL DEFAULT '[]', -- [{"value": "/path", "count": 12}], estimated counts
+    top_hosts JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (app_name, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_visitors_daily_day ON app_visitors_daily (day);
+
+DROP TRIGGER IF EXISTS update_app_visitors_daily_updated_at ON app_visitors_daily;
+CREATE TRIGGER update_app_visitors_daily_updated_at BEFORE UPDATE ON app_visitors_daily FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO schema_migrations (version) VALUES ('026_add_visitor_analytics') ON CONFLICT (version) DO NOTHING;
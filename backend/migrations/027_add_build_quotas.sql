@@ -0,0 +1,30 @@
+-- Migration: 027_add_build_quotas.sql
+-- Description: Teams of users, and monthly build minute and deploy concurrency caps per user, team or app
+-- Created: 2026-10-16
+
+-- The team a user's build time is accounted to, none by default
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS team VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_users_team ON users(team) WHERE team IS NOT NULL;
+
+-- Caps enforced when a deployment is submitted, NULL leaves a limit unset
+CREATE TABLE IF NOT EXISTS build_quotas (
+    scope VARCHAR(20) NOT NULL CHECK (scope IN ('user', 'team', 'app')),
+    subject VARCHAR(255) NOT NULL, -- user ID, team name or app name
+    monthly_minutes INTEGER CHECK (monthly_minutes > 0),
+    max_concurrent INTEGER CHECK (max_concurrent > 0),
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (scope, subject)
+);
+
+DROP TRIGGER IF EXISTS update_build_quotas_updated_at ON build_quotas;
+CREATE TRIGGER update_build_quotas_updated_at BEFORE UPDATE ON build_quotas FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Usage reports sum the deployments of a month
+CREATE INDEX IF NOT EXISTS idx_deployment_history_started_at ON deployment_history(started_at);
+CREATE INDEX IF NOT EXISTS idx_deployment_history_user_started ON deployment_history(user_id, started_at) WHERE user_id IS NOT NULL;
+
+INSERT INTO schema_migrations (version) VALUES ('027_add_build_quotas') ON CONFLICT (version) DO NOTHING;
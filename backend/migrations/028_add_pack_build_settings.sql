@@ -0,0 +1,23 @@
+-- Migration: 028_add_pack_build_settings.sql
+-- Description: Per-app settings of pack (Cloud Native Buildpacks) builds and the builder image of each deployment
+-- Created: 2026-10-16
+
+-- Builder and run images of pack builds, and the app config keys meant for build time. The values
+-- of the build env live in the app config, only their keys are kept here.
+CREATE TABLE IF NOT EXISTS app_pack_settings (
+    app_name VARCHAR(100) PRIMARY KEY,
+    builder_image VARCHAR(255),
+    run_image VARCHAR(255),
+    build_env_keys JSONB NOT NULL DEFAULT '[]',
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS update_app_pack_settings_updated_at ON app_pack_settings;
+CREATE TRIGGER update_app_pack_settings_updated_at BEFORE UPDATE ON app_pack_settings FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- The builder image a pack deployment was built with
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS builder_image VARCHAR(255);
+
+INSERT INTO schema_migrations (version) VALUES ('028_add_pack_build_settings') ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,8 @@
+-- Migration: 029_add_deployment_dockerfile_path.sql
+-- Description: Record the Dockerfile each Dockerfile deployment was built from
+-- Created: 2026-10-16
+
+-- The Dockerfile path relative to the repository root, NULL for the root Dockerfile or other builders
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS dockerfile_path VARCHAR(255);
+
+INSERT INTO schema_migrations (version) VALUES ('029_add_deployment_dockerfile_path') ON CONFLICT (version) DO NOTHING;
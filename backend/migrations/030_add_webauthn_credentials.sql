@@ -0,0 +1,28 @@
+-- Migration: 030_add_webauthn_credentials.sql
+-- Description: Passkeys (WebAuthn credentials) users log into the dashboard with
+-- Created: 2026-10-16
+
+-- The public key is the COSE_Key the authenticator created, sign_count its signature counter as
+-- last seen, used to spot cloned authenticators
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BYTEA NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    algorithm INTEGER NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    aaguid BYTEA,
+    transports JSONB NOT NULL DEFAULT '[]',
+    backup_eligible BOOLEAN NOT NULL DEFAULT false,
+    name VARCHAR(100) NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user ON webauthn_credentials(user_id);
+
+DROP TRIGGER IF EXISTS update_webauthn_credentials_updated_at ON webauthn_credentials;
+CREATE TRIGGER update_webauthn_credentials_updated_at BEFORE UPDATE ON webauthn_credentials FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO schema_migrations (version) VALUES ('030_add_webauthn_credentials') ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,26 @@
+-- Migration: 031_add_support_access_grants.sql
+-- Description: Read-only support access to one app, granted by a user to the platform operator
+-- Created: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS support_access_grants (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE, -- SHA-256 of the token, the token itself is only shown once
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    granted_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    use_count INTEGER NOT NULL DEFAULT 0,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    last_used_ip VARCHAR(45),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_support_access_grants_granted_by ON support_access_grants (granted_by);
+CREATE INDEX IF NOT EXISTS idx_support_access_grants_app_name ON support_access_grants (app_name);
+
+DROP TRIGGER IF EXISTS update_support_access_grants_updated_at ON support_access_grants;
+CREATE TRIGGER update_support_access_grants_updated_at BEFORE UPDATE ON support_access_grants FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO schema_migrations (version) VALUES ('031_add_support_access_grants') ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,19 @@
+-- Migration: 032_add_app_build_vars.sql
+-- Description: Build-time only variables of apps, passed to builds but never set on the running containers
+-- Created: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS app_build_vars (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(100) NOT NULL,
+    key VARCHAR(128) NOT NULL,
+    value_encrypted TEXT NOT NULL, -- encrypted with ENCRYPTION_KEY
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (app_name, key)
+);
+
+DROP TRIGGER IF EXISTS update_app_build_vars_updated_at ON app_build_vars;
+CREATE TRIGGER update_app_build_vars_updated_at BEFORE UPDATE ON app_build_vars FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO schema_migrations (version) VALUES ('032_add_app_build_vars') ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,34 @@
+-- Migration: 033_add_app_pipelines.sql
+-- Description: Per-app deployment pipelines with a test stage, and the stages each deployment went through
+-- Created: 2026-10-16
+
+-- The test command runs in a one-off container of the new build before it gets traffic
+CREATE TABLE IF NOT EXISTS app_pipelines (
+    app_name VARCHAR(100) PRIMARY KEY,
+    test_command TEXT NOT NULL,
+    test_timeout_seconds INTEGER NOT NULL DEFAULT 600,
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS update_app_pipelines_updated_at ON app_pipelines;
+CREATE TRIGGER update_app_pipelines_updated_at BEFORE UPDATE ON app_pipelines FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Build, test and deploy stages of the deployments of apps with a pipeline, with their own logs
+CREATE TABLE IF NOT EXISTS deployment_stages (
+    id SERIAL PRIMARY KEY,
+    deployment_id INTEGER NOT NULL REFERENCES deployment_history(id) ON DELETE CASCADE,
+    name VARCHAR(20) NOT NULL,
+    position INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    logs TEXT NOT NULL DEFAULT '',
+    error_message TEXT,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (deployment_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_deployment_stages_deployment ON deployment_stages(deployment_id, position);
+
+INSERT INTO schema_migrations (version) VALUES ('033_add_app_pipelines') ON CONFLICT (version) DO NOTHING;
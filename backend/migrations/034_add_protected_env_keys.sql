@@ -0,0 +1,14 @@
+-- Migration: 034_add_protected_env_keys.sql
+-- Description: Env keys of apps only admins can change or remove, their values are masked for other users
+-- Created: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS app_protected_env_keys (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(100) NOT NULL,
+    key VARCHAR(128) NOT NULL,
+    protected_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (app_name, key)
+);
+
+INSERT INTO schema_migrations (version) VALUES ('034_add_protected_env_keys') ON CONFLICT (version) DO NOTHING;
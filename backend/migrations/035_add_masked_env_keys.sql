@@ -0,0 +1,14 @@
+-- Migration: 035_add_masked_env_keys.sql
+-- Description: Env keys of apps whose values are always masked and can't be revealed through the API
+-- Created: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS app_masked_env_keys (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(100) NOT NULL,
+    key VARCHAR(128) NOT NULL,
+    marked_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (app_name, key)
+);
+
+INSERT INTO schema_migrations (version) VALUES ('035_add_masked_env_keys') ON CONFLICT (version) DO NOTHING;
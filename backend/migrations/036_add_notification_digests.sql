@@ -0,0 +1,28 @@
+-- Migration: 036_add_notification_digests.sql
+-- Description: Daily or weekly digests of deployments, uptime and recommendations sent to users
+-- Created: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS user_digest_subscriptions (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    frequency VARCHAR(10) NOT NULL DEFAULT 'daily', -- daily, weekly
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC', -- IANA time zone the send time is in
+    send_hour SMALLINT NOT NULL DEFAULT 8, -- local hour the digest is sent at
+    send_weekday SMALLINT NOT NULL DEFAULT 1, -- day weekly digests are sent on, 0 is Sunday
+    email_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    webhook_url TEXT,
+    webhook_secret TEXT, -- encrypted, signs the webhook deliveries
+    apps TEXT[] NOT NULL DEFAULT '{}', -- empty: the apps the user recently worked on
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    last_period_end TIMESTAMP WITH TIME ZONE, -- end of the last period a digest was sent for
+    last_sent_at TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS update_user_digest_subscriptions_updated_at ON user_digest_subscriptions;
+CREATE TRIGGER update_user_digest_subscriptions_updated_at BEFORE UPDATE ON user_digest_subscriptions FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('036_add_notification_digests')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,34 @@
+-- Migration: 037_add_app_log_sinks.sql
+-- Description: External sinks the logs of an app are forwarded to
+-- Created: 2026-10-16
+
+-- Create app_log_sinks table (endpoint URLs and auth headers are stored encrypted)
+CREATE TABLE IF NOT EXISTS app_log_sinks (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(255) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    sink_type VARCHAR(20) NOT NULL, -- syslog, https or vector
+    url TEXT NOT NULL,
+    auth_header TEXT, -- sent as the Authorization header of https and vector sinks
+    process_type VARCHAR(63), -- NULL forwards every process
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    last_delivered_at TIMESTAMP WITH TIME ZONE,
+    forwarded_lines BIGINT NOT NULL DEFAULT 0,
+    dropped_lines BIGINT NOT NULL DEFAULT 0, -- lines lost when the buffer of the sink overflowed
+    last_error TEXT,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for app_log_sinks
+CREATE INDEX IF NOT EXISTS idx_app_log_sinks_app_name ON app_log_sinks(app_name);
+CREATE INDEX IF NOT EXISTS idx_app_log_sinks_enabled ON app_log_sinks(enabled);
+
+-- Add trigger for updated_at
+DROP TRIGGER IF EXISTS update_app_log_sinks_updated_at ON app_log_sinks;
+CREATE TRIGGER update_app_log_sinks_updated_at BEFORE UPDATE ON app_log_sinks FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('037_add_app_log_sinks')
+ON CONFLICT (version) DO NOTHING;
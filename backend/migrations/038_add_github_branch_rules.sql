@@ -0,0 +1,30 @@
+-- Migration: 038_add_github_branch_rules.sql
+-- Description: Branch patterns mapping pushes of a connected repository to target apps
+-- Created: 2026-10-16
+
+-- In strict mode only the branch rules decide what a push deploys, the deploy branch is ignored
+ALTER TABLE github_repositories ADD COLUMN IF NOT EXISTS branch_rules_strict BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Create github_branch_rules table (rules are evaluated in position order, the first match wins)
+CREATE TABLE IF NOT EXISTS github_branch_rules (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(255) NOT NULL, -- app connected to the repository
+    position INTEGER NOT NULL,
+    pattern VARCHAR(255) NOT NULL,
+    pattern_type VARCHAR(10) NOT NULL DEFAULT 'glob', -- glob or regex
+    target_app VARCHAR(255) NOT NULL, -- app deployed when the pattern matches
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (app_name, position)
+);
+
+-- Indexes for github_branch_rules
+CREATE INDEX IF NOT EXISTS idx_github_branch_rules_target_app ON github_branch_rules(target_app);
+
+-- Add trigger for updated_at
+DROP TRIGGER IF EXISTS update_github_branch_rules_updated_at ON github_branch_rules;
+CREATE TRIGGER update_github_branch_rules_updated_at BEFORE UPDATE ON github_branch_rules FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('038_add_github_branch_rules')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,23 @@
+-- Migration: 039_add_github_push_filters.sql
+-- Description: GitHub users and teams allowed or denied to trigger auto-deploys of a connected app
+-- Created: 2026-10-16
+
+-- Create github_push_filters table (teams are stored as org/team-slug, logins lowercased)
+CREATE TABLE IF NOT EXISTS github_push_filters (
+    app_name VARCHAR(255) PRIMARY KEY, -- app connected to the repository
+    allowed_users TEXT[] NOT NULL DEFAULT '{}', -- when users or teams are allowed, everyone else is blocked
+    allowed_teams TEXT[] NOT NULL DEFAULT '{}',
+    denied_users TEXT[] NOT NULL DEFAULT '{}', -- denied users and teams are blocked even when allowed
+    denied_teams TEXT[] NOT NULL DEFAULT '{}',
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Add trigger for updated_at
+DROP TRIGGER IF EXISTS update_github_push_filters_updated_at ON github_push_filters;
+CREATE TRIGGER update_github_push_filters_updated_at BEFORE UPDATE ON github_push_filters FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('039_add_github_push_filters')
+ON CONFLICT (version) DO NOTHING;
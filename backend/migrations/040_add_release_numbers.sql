@@ -0,0 +1,41 @@
+-- Migration: 040_add_release_numbers.sql
+-- Description: Number the deployments of each app (v1, v2, ...) and let releases be named
+-- Created: 2026-10-16
+
+-- Release numbers are assigned when a deployment starts, names are optional and unique per app
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS release_number INTEGER;
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS release_name VARCHAR(100);
+
+-- Number the deployments recorded so far in the order they started
+UPDATE deployment_history AS history
+SET release_number = numbered.release_number
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY app_name ORDER BY started_at, id) AS release_number
+    FROM deployment_history
+) AS numbered
+WHERE history.id = numbered.id AND history.release_number IS NULL;
+
+-- Indexes for release lookups
+CREATE UNIQUE INDEX IF NOT EXISTS idx_deployment_history_app_release ON deployment_history(app_name, release_number);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_deployment_history_app_release_name ON deployment_history(app_name, release_name)
+    WHERE release_name IS NOT NULL;
+
+-- Create app_release_counters table, the last release number of each app; numbers are never reused
+CREATE TABLE IF NOT EXISTS app_release_counters (
+    app_name VARCHAR(255) PRIMARY KEY,
+    last_release INTEGER NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Continue the numbering of existing apps after their last deployment
+INSERT INTO app_release_counters (app_name, last_release)
+SELECT app_name, MAX(release_number) FROM deployment_history GROUP BY app_name
+ON CONFLICT (app_name) DO NOTHING;
+
+-- Add trigger for updated_at
+DROP TRIGGER IF EXISTS update_app_release_counters_updated_at ON app_release_counters;
+CREATE TRIGGER update_app_release_counters_updated_at BEFORE UPDATE ON app_release_counters FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('040_add_release_numbers')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,11 @@
+-- Migration: 041_add_github_deploy_policy.sql
+-- Description: Let connected repositories auto deploy on pushed tags matching a pattern instead of branch pushes
+-- Created: 2026-10-16
+
+-- deploy_trigger is branch (pushes to the deploy branch or branch rules) or tag (pushed tags matching tag_pattern)
+ALTER TABLE github_repositories ADD COLUMN IF NOT EXISTS deploy_trigger VARCHAR(10) NOT NULL DEFAULT 'branch';
+ALTER TABLE github_repositories ADD COLUMN IF NOT EXISTS tag_pattern VARCHAR(255);
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('041_add_github_deploy_policy')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,14 @@
+-- Migration: 042_add_deployment_git_tag.sql
+-- Description: Record the git tag a deployment was triggered by
+-- Created: 2026-10-16
+
+-- Set for deployments of pushed tags, and retries and promotions of them
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS git_tag VARCHAR(255);
+
+-- Indexes for tagged releases
+CREATE INDEX IF NOT EXISTS idx_deployment_history_app_tag ON deployment_history(app_name, git_tag)
+    WHERE git_tag IS NOT NULL;
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('042_add_deployment_git_tag')
+ON CONFLICT (version) DO NOTHING;
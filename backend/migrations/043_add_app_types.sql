@@ -0,0 +1,17 @@
+-- Migration: 043_add_app_types.sql
+-- Description: Mark apps as web apps or worker-only apps that run no web process
+-- Created: 2026-10-16
+
+-- Apps without a row are web apps. Worker-only apps get no port mapping, domains or proxy routes.
+CREATE TABLE IF NOT EXISTS app_types (
+    app_name VARCHAR(100) PRIMARY KEY,
+    app_type VARCHAR(20) NOT NULL DEFAULT 'web',
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS update_app_types_updated_at ON app_types;
+CREATE TRIGGER update_app_types_updated_at BEFORE UPDATE ON app_types FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO schema_migrations (version) VALUES ('043_add_app_types') ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,19 @@
+-- Migration: 044_add_deploy_hooks.sql
+-- Description: Per-app commands run in one-off containers before and after deployments
+-- Created: 2026-10-16
+
+-- pre_deploy hooks run in the release deployed so far before the build, a failure stops the
+-- deployment. post_deploy hooks run in the new release once it is deployed.
+CREATE TABLE IF NOT EXISTS app_deploy_hooks (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(100) NOT NULL,
+    stage VARCHAR(20) NOT NULL,
+    position INTEGER NOT NULL,
+    command TEXT NOT NULL,
+    timeout_seconds INTEGER NOT NULL DEFAULT 300,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (app_name, stage, position)
+);
+
+INSERT INTO schema_migrations (version) VALUES ('044_add_deploy_hooks') ON CONFLICT (version) DO NOTHING;
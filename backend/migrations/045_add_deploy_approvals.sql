@@ -0,0 +1,19 @@
+-- Migration: 045_add_deploy_approvals.sql
+-- Description: Flag production apps whose webhook deployments wait for the approval of an admin
+-- Created: 2026-10-16
+
+-- Pushes to production apps create a pending_approval deployment, built once an admin approves it
+CREATE TABLE IF NOT EXISTS app_production_flags (
+    app_name VARCHAR(100) PRIMARY KEY,
+    flagged_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Who approved or rejected a deployment waiting for approval, and when
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_deployment_history_pending_approval ON deployment_history(started_at)
+    WHERE status = 'pending_approval';
+
+INSERT INTO schema_migrations (version) VALUES ('045_add_deploy_approvals') ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,10 @@
+-- Migration: 046_add_deployment_source_image.sql
+-- Description: Record the registry image of deployments made from a prebuilt image
+-- Created: 2026-10-16
+
+-- Set for deployments of an image (git:from-image) instead of a git source
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS source_image TEXT;
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('046_add_deployment_source_image')
+ON CONFLICT (version) DO NOTHING;
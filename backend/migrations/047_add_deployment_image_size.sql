@@ -0,0 +1,11 @@
+-- Migration: 047_add_deployment_image_size.sql
+-- Description: Record the image size and layers of each deployment
+-- Created: 2026-10-16
+
+-- Size in bytes and docker history layers of the image a deployment built
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS image_size BIGINT;
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS image_layers JSONB;
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('047_add_deployment_image_size')
+ON CONFLICT (version) DO NOTHING;
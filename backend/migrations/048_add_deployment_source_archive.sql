@@ -0,0 +1,10 @@
+-- Migration: 048_add_deployment_source_archive.sql
+-- Description: Record the uploaded archive of deployments made with git:from-archive
+-- Created: 2026-10-16
+
+-- sha256 digest of the archive, set for deployments of an upload instead of a git source
+ALTER TABLE deployment_history ADD COLUMN IF NOT EXISTS source_archive TEXT;
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('048_add_deployment_source_archive')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,28 @@
+-- Migration: 049_add_scheduled_deployments.sql
+-- Description: Deployments of a git source scheduled for a later time
+-- Created: 2026-10-16
+
+-- A scheduled deployment is claimed (running) once its time has come and links the deployment it
+-- started. Cancelled ones are kept for the history of the app.
+CREATE TABLE IF NOT EXISTS scheduled_deployments (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(100) NOT NULL,
+    git_url TEXT NOT NULL,
+    git_branch VARCHAR(255) NOT NULL,
+    git_commit VARCHAR(40),
+    scheduled_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'scheduled', -- scheduled, running, success, error, cancelled
+    deployment_id INTEGER REFERENCES deployment_history(id) ON DELETE SET NULL,
+    error_message TEXT,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    cancelled_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_deployments_app ON scheduled_deployments(app_name, scheduled_at DESC);
+CREATE INDEX IF NOT EXISTS idx_scheduled_deployments_due ON scheduled_deployments(scheduled_at)
+    WHERE status = 'scheduled';
+
+INSERT INTO schema_migrations (version) VALUES ('049_add_scheduled_deployments') ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,20 @@
+-- Migration: 050_add_app_identity_settings.sql
+-- Description: Per-app identity headers ForwardAuth passes to apps behind SSO
+-- Created: 2026-10-16
+
+-- Apps without a row get the identity headers and no signed token. token_secret is encrypted and
+-- signs the identity token of the app, so the app can verify it.
+CREATE TABLE IF NOT EXISTS app_identity_settings (
+    app_name VARCHAR(100) PRIMARY KEY,
+    headers_enabled BOOLEAN NOT NULL DEFAULT true,
+    token_enabled BOOLEAN NOT NULL DEFAULT false,
+    token_secret TEXT,
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS update_app_identity_settings_updated_at ON app_identity_settings;
+CREATE TRIGGER update_app_identity_settings_updated_at BEFORE UPDATE ON app_identity_settings FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO schema_migrations (version) VALUES ('050_add_app_identity_settings') ON CONFLICT (version) DO NOTHING;
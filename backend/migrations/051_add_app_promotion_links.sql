@@ -0,0 +1,21 @@
+-- Migration: 051_add_app_promotion_links.sql
+-- Description: Link apps to the app they are promoted to (e.g. staging to production)
+-- Created: 2026-10-16
+
+-- Promoting app_name deploys the image it runs to target_app. An app has one target, a target
+-- can be promoted to from several apps.
+CREATE TABLE IF NOT EXISTS app_promotion_links (
+    app_name VARCHAR(100) PRIMARY KEY,
+    target_app VARCHAR(100) NOT NULL,
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (app_name <> target_app)
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_promotion_links_target ON app_promotion_links(target_app);
+
+DROP TRIGGER IF EXISTS update_app_promotion_links_updated_at ON app_promotion_links;
+CREATE TRIGGER update_app_promotion_links_updated_at BEFORE UPDATE ON app_promotion_links FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO schema_migrations (version) VALUES ('051_add_app_promotion_links') ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,29 @@
+-- Migration: 052_add_app_service_tokens.sql
+-- Description: Per-app service tokens letting scripts and probes through SSO without a browser session
+-- Created: 2026-10-16
+
+-- A token only opens its app, limited to path_prefixes when set and to GET/HEAD/OPTIONS when
+-- read_only. A token without prefixes opens the whole app.
+CREATE TABLE IF NOT EXISTS app_service_tokens (
+    id SERIAL PRIMARY KEY,
+    app_name VARCHAR(100) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE, -- SHA-256 of the token, the token itself is only shown once
+    path_prefixes TEXT[] NOT NULL DEFAULT '{}',
+    read_only BOOLEAN NOT NULL DEFAULT false,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    revoked_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    last_used_ip VARCHAR(45),
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_service_tokens_app_name ON app_service_tokens (app_name);
+
+DROP TRIGGER IF EXISTS update_app_service_tokens_updated_at ON app_service_tokens;
+CREATE TRIGGER update_app_service_tokens_updated_at BEFORE UPDATE ON app_service_tokens FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO schema_migrations (version) VALUES ('052_add_app_service_tokens') ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,10 @@
+-- Migration: 053_add_github_build_path.sql
+-- Description: Build connected apps from a subdirectory of their repository, for monorepos
+-- Created: 2026-10-16
+
+-- build_path is relative to the repository root, NULL builds the whole repository
+ALTER TABLE github_repositories ADD COLUMN IF NOT EXISTS build_path VARCHAR(255);
+
+-- Record this migration
+INSERT INTO schema_migrations (version) VALUES ('053_add_github_build_path')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,35 @@
+-- Migration: 054_add_scim_provisioning.sql
+-- Description: SCIM 2.0 provisioning of users and groups by an identity provider
+-- Created: 2026-10-16
+
+-- Deactivated users can't sign in. Users deleted over SCIM are deactivated and hidden from SCIM
+-- rather than removed, their deployments and activity keep pointing at them.
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT true,
+ADD COLUMN IF NOT EXISTS scim_managed BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN IF NOT EXISTS scim_external_id VARCHAR(255),
+ADD COLUMN IF NOT EXISTS scim_deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_inactive ON users(id) WHERE NOT active;
+
+-- Groups pushed by the identity provider, mapped to the admin role and teams by the SCIM settings
+CREATE TABLE IF NOT EXISTS scim_groups (
+    id SERIAL PRIMARY KEY,
+    display_name VARCHAR(255) NOT NULL UNIQUE,
+    external_id VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS update_scim_groups_updated_at ON scim_groups;
+CREATE TRIGGER update_scim_groups_updated_at BEFORE UPDATE ON scim_groups FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TABLE IF NOT EXISTS scim_group_members (
+    group_id INTEGER NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_scim_group_members_user ON scim_group_members(user_id);
+
+INSERT INTO schema_migrations (version) VALUES ('054_add_scim_provisioning') ON CONFLICT (version) DO NOTHING;
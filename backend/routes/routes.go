@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"time"
+
 	"backend/handlers"
 	"backend/middleware"
 
@@ -13,8 +15,12 @@ func SetupRoutes(app *fiber.App) {
 	app.Get("/sso/check", handlers.SSOCheck)
 	app.Get("/sso/init", handlers.SSOInit)
 
+	// "App not found" page, Traefik routes hosts matching no app here
+	app.Get("/host-not-found", handlers.HostNotFound)
+
 	// Health check endpoints
 	app.Get("/health", handlers.HealthCheck)
+	app.Get("/metrics", handlers.Metrics)
 	app.Get("/redis-status", handlers.RedisStatus)
 	app.Post("/clear-test-data", handlers.ClearRedisTestData)
 
@@ -25,6 +31,8 @@ func SetupRoutes(app *fiber.App) {
 	auth := api.Group("/auth")
 	// auth.Post("/register", handlers.Register)
 	auth.Post("/login", handlers.Login)
+	auth.Post("/passkeys/login/begin", middleware.RateLimit(30, time.Minute), handlers.BeginPasskeyLogin)
+	auth.Post("/passkeys/login/finish", middleware.RateLimit(30, time.Minute), handlers.FinishPasskeyLogin)
 	auth.Post("/logout", handlers.Logout)
 	auth.Get("/token-validate", handlers.ValidateSessionEndpoint)  // kept path for compatibility
 	auth.Post("/validate-token", handlers.ValidateSessionEndpoint) // kept path for compatibility
@@ -32,6 +40,24 @@ func SetupRoutes(app *fiber.App) {
 
 	// Traefik forward auth endpoint
 	auth.Get("/validate", handlers.ValidateForTraefik)
+	auth.Get("/host-status", handlers.GetHostStatus)
+
+	// SCIM 2.0 provisioning by the identity provider, authenticated by the SCIM bearer token
+	scim := api.Group("/scim/v2", middleware.RateLimit(600, time.Minute), handlers.SCIMAuth)
+	scim.Get("/ServiceProviderConfig", handlers.GetSCIMServiceProviderConfig)
+	scim.Get("/ResourceTypes", handlers.GetSCIMResourceTypes)
+	scim.Get("/Users", handlers.ListSCIMUsers)
+	scim.Post("/Users", handlers.CreateSCIMUser)
+	scim.Get("/Users/:id", handlers.GetSCIMUser)
+	scim.Put("/Users/:id", handlers.ReplaceSCIMUser)
+	scim.Patch("/Users/:id", handlers.PatchSCIMUser)
+	scim.Delete("/Users/:id", handlers.DeleteSCIMUser)
+	scim.Get("/Groups", handlers.ListSCIMGroups)
+	scim.Post("/Groups", handlers.CreateSCIMGroup)
+	scim.Get("/Groups/:id", handlers.GetSCIMGroup)
+	scim.Put("/Groups/:id", handlers.ReplaceSCIMGroup)
+	scim.Patch("/Groups/:id", handlers.PatchSCIMGroup)
+	scim.Delete("/Groups/:id", handlers.DeleteSCIMGroup)
 
 	// Cross-domain cookie endpoints (removed - not needed)
 
@@ -40,11 +66,40 @@ func SetupRoutes(app *fiber.App) {
 
 	// User profile
 	citizen.Get("/profile", handlers.GetProfile)
+	citizen.Get("/me/recent-apps", handlers.GetRecentApps)
+
+	// Passkeys of the current user
+	citizen.Get("/me/passkeys", handlers.ListPasskeys)
+	citizen.Post("/me/passkeys/register/begin", handlers.BeginPasskeyRegistration)
+	citizen.Post("/me/passkeys/register/finish", handlers.FinishPasskeyRegistration)
+	citizen.Put("/me/passkeys/:id", handlers.RenamePasskey)
+	citizen.Delete("/me/passkeys/:id", handlers.DeletePasskey)
+
+	// Support access grants of the current user
+	citizen.Get("/me/support-access", handlers.ListSupportGrants)
+	citizen.Delete("/me/support-access/:id", handlers.RevokeSupportGrant)
+
+	// Daily or weekly digest of the apps of the current user
+	citizen.Get("/me/digest", handlers.GetDigestSubscription)
+	citizen.Put("/me/digest", handlers.SetDigestSubscription)
+	citizen.Delete("/me/digest", handlers.DeleteDigestSubscription)
+	citizen.Get("/me/digest/preview", handlers.PreviewDigest)
+
+	// Dokku host capabilities
+	citizen.Get("/system/capabilities", handlers.GetSystemCapabilities)
+
+	// Dashboard home
+	citizen.Get("/dashboard/summary", handlers.GetDashboardSummary)
 
 	// App management
 	citizen.Get("/apps", handlers.ListApps)
 	citizen.Get("/apps-info", handlers.GetAllAppsInfo) // Get all apps info
 	citizen.Post("/apps", handlers.CreateApp)
+	citizen.Get("/apps/validate-name", handlers.ValidateAppName)
+	citizen.Get("/apps/health", handlers.GetAppsHealth) // Traffic light status of every app, refreshed by the scheduler
+	citizen.Post("/apps/import", middleware.AdminOnly(), handlers.ImportApps) // Take over dokku apps created outside Citizen
+	citizen.Post("/apps/import-bundle", middleware.AdminOnly(), handlers.ImportAppBundle) // Recreate an app exported by another Citizen instance
+	citizen.Post("/onboarding/sample-app", middleware.RateLimit(5, time.Minute), handlers.DeploySampleApp) // Deploy a known-good sample app end to end
 	citizen.Get("/apps/:app_name", handlers.GetAppInfo)
 	citizen.Delete("/apps/:app_name", handlers.DestroyApp)
 	citizen.Post("/apps/:app_name/restart", handlers.RestartApp)
@@ -61,19 +116,71 @@ func SetupRoutes(app *fiber.App) {
 	// Git deploy
 	citizen.Post("/apps/:app_name/git-deploy", handlers.DeployApp)
 	citizen.Post("/apps/:app_name/deploy", handlers.DeployApp)
+	citizen.Post("/apps/:app_name/promote-from/:source_app", handlers.PromoteApp)
+	citizen.Post("/apps/:app_name/promote", handlers.PromoteToLinkedApp)
+	citizen.Get("/apps/:app_name/promotion-link", handlers.GetPromotionLink)
+	citizen.Put("/apps/:app_name/promotion-link", handlers.SetPromotionLink)
+	citizen.Delete("/apps/:app_name/promotion-link", handlers.DeletePromotionLink)
+	citizen.Post("/apps/:app_name/deploy-image", handlers.DeployImage)
+	citizen.Post("/apps/:app_name/deploy-archive", handlers.DeployArchive)
+	citizen.Get("/apps/:app_name/scheduled-deploys", handlers.ListScheduledDeployments)
+	citizen.Post("/apps/:app_name/scheduled-deploys", handlers.CreateScheduledDeployment)
+	citizen.Delete("/apps/:app_name/scheduled-deploys/:id", handlers.CancelScheduledDeployment)
 
 	// Environment variables
 	citizen.Get("/apps/:app_name/env", handlers.GetEnv)
 	citizen.Post("/apps/:app_name/env", handlers.SetEnv)
 	citizen.Delete("/apps/:app_name/env", handlers.RemoveEnv)
+	citizen.Post("/apps/:app_name/env/apply", handlers.ApplyPendingEnv)
+	citizen.Get("/apps/:app_name/env/protected", handlers.ListProtectedEnvKeys)
+	citizen.Post("/apps/:app_name/env/protected", middleware.AdminOnly(), handlers.ProtectEnvKeys)
+	citizen.Delete("/apps/:app_name/env/protected/:key", middleware.AdminOnly(), handlers.UnprotectEnvKey)
+	citizen.Post("/apps/:app_name/env/reveal/begin", middleware.RateLimit(30, time.Minute), handlers.BeginEnvReveal)
+	citizen.Post("/apps/:app_name/env/reveal", middleware.RateLimit(30, time.Minute), handlers.RevealEnv)
+	citizen.Get("/apps/:app_name/env/masked", handlers.ListMaskedEnvKeys)
+	citizen.Post("/apps/:app_name/env/masked", handlers.MarkMaskedEnvKeys)
+	citizen.Delete("/apps/:app_name/env/masked/:key", middleware.AdminOnly(), handlers.UnmarkMaskedEnvKey)
+
 	citizen.Post("/apps/:app_name/config", handlers.SetEnv)
 
+	// Build-time only variables, kept out of the running containers
+	citizen.Get("/apps/:app_name/build-vars", handlers.ListBuildVars)
+	citizen.Post("/apps/:app_name/build-vars", handlers.SetBuildVars)
+	citizen.Delete("/apps/:app_name/build-vars/:key", handlers.DeleteBuildVar)
+
+	// Deployment pipeline: a test stage gating the traffic switch of new builds
+	citizen.Get("/apps/:app_name/pipeline", handlers.GetPipeline)
+	citizen.Put("/apps/:app_name/pipeline", handlers.SetPipeline)
+	citizen.Delete("/apps/:app_name/pipeline", handlers.DeletePipeline)
+	citizen.Get("/apps/:app_name/hooks", handlers.GetDeployHooks)
+	citizen.Put("/apps/:app_name/hooks", handlers.SetDeployHooks) // pre_deploy and post_deploy commands
+
+	// Deploy approvals: webhook deployments of production apps wait for an admin
+	citizen.Get("/apps/:app_name/production", handlers.GetProductionApp)
+	citizen.Put("/apps/:app_name/production", middleware.AdminOnly(), handlers.SetProductionApp)
+	citizen.Get("/deploys/pending", handlers.ListPendingApprovals)
+	citizen.Post("/deploys/:id/approve", middleware.AdminOnly(), handlers.ApproveDeployment)
+	citizen.Post("/deploys/:id/reject", middleware.AdminOnly(), handlers.RejectDeployment)
+
+	// Desired-state configuration as citizen.yml
+	citizen.Get("/apps/:app_name/export", handlers.ExportAppManifest)
+	citizen.Post("/apps/:app_name/export/bundle", handlers.ExportAppBundle) // Move the app to another Citizen instance
+	citizen.Post("/apps/:app_name/apply", handlers.ApplyAppManifest)
+
+	// Builder, buildpacks, port, env and domains in one call
+	citizen.Post("/apps/:app_name/configure", handlers.ConfigureApp)
+
 	// Custom domain management
 	citizen.Post("/apps/:app_name/custom-domain", handlers.SetCustomDomain)
 	citizen.Get("/apps/:app_name/custom-domains", handlers.GetCustomDomains)
 	citizen.Delete("/apps/:app_name/custom-domain", handlers.RemoveCustomDomain)
 	citizen.Get("/custom-domains", handlers.GetAllActiveCustomDomains)
 
+	// DNS and TLS status of every app domain
+	citizen.Get("/domains", handlers.ListAllDomains)
+	citizen.Get("/apps/:app_name/domain-propagation", handlers.ListDomainPropagation)
+	citizen.Post("/apps/:app_name/domain-propagation/:domain/recheck", handlers.RecheckDomainPropagation)
+
 	// Public app settings
 	citizen.Post("/apps/:app_name/public-setting", handlers.SetPublicApp)
 	citizen.Get("/apps/:app_name/public-setting", handlers.GetPublicAppSetting)
@@ -95,21 +202,182 @@ func SetupRoutes(app *fiber.App) {
 	// Builder management
 	citizen.Post("/apps/:app_name/builder", handlers.SetBuilder)
 	citizen.Get("/apps/:app_name/builder", handlers.GetBuilderReport)
+	citizen.Get("/apps/:app_name/builder/pack", handlers.GetPackSettings)
+	citizen.Put("/apps/:app_name/builder/pack", handlers.SetPackSettings)
+	citizen.Get("/apps/:app_name/builder/dockerfile", handlers.GetDockerfilePath)
+	citizen.Put("/apps/:app_name/builder/dockerfile", handlers.SetDockerfilePath)
+	citizen.Get("/apps/:app_name/type", handlers.GetAppType)
+	citizen.Put("/apps/:app_name/type", handlers.SetAppType) // web or worker (no port, domains or proxy)
+
+	// Runtime version pinning
+	citizen.Get("/runtimes", handlers.GetRuntimeVersions)
+	citizen.Get("/apps/:app_name/runtime", handlers.GetAppRuntime)
+	citizen.Put("/apps/:app_name/runtime", handlers.SetAppRuntime)
+	citizen.Delete("/apps/:app_name/runtime/:runtime", handlers.RemoveAppRuntime)
 
 	// App deployment info
 	citizen.Get("/deployments", handlers.GetAllAppDeployments)
 	citizen.Get("/apps/:app_name/deployment", handlers.GetAppDeployment)
 	citizen.Put("/apps/:app_name/deployment", handlers.UpdateAppDeployment)
 	citizen.Put("/apps/:app_name/deployment/status", handlers.UpdateAppDeploymentStatus)
+	citizen.Get("/apps/:app_name/deployment/integrity", handlers.CheckDeploymentIntegrity)
+	citizen.Post("/apps/:app_name/deployment/resync", handlers.ResyncDeployment)
+	citizen.Get("/apps/:app_name/deployments/running", handlers.ListRunningDeployments)
+	citizen.Get("/apps/:app_name/deployments/queue", handlers.ListDeployQueue)
+	citizen.Post("/apps/:app_name/deployments/:id/cancel", handlers.CancelDeployment)
+	citizen.Post("/apps/:app_name/deployments/:id/retry", handlers.RetryDeployment)
+	citizen.Get("/apps/:app_name/deployments", handlers.ListDeploymentHistory)
+	citizen.Get("/apps/:app_name/deployments/:id", handlers.GetDeploymentHistory)
+	citizen.Get("/apps/:app_name/deployments/:id/logs", handlers.GetDeploymentHistoryLogs)
+	citizen.Get("/apps/:app_name/deployments/:id/diagnostics", handlers.GetDeploymentDiagnostics)
+	citizen.Get("/apps/:app_name/deployments/:id/image", handlers.GetDeploymentImageReport) // image size and layers
+	citizen.Get("/apps/:app_name/deployments/:id/stages", handlers.GetDeploymentStages)
+	citizen.Get("/apps/:app_name/deployments/:id/stream", handlers.StreamDeploymentOutput)
+	citizen.Get("/apps/:app_name/releases", handlers.ListReleases) // Paginated release timeline, one entry per deployment
+	citizen.Get("/apps/:app_name/releases/:release", handlers.GetRelease) // By number (42 or v42) or name
+	citizen.Put("/apps/:app_name/releases/:release/name", handlers.SetReleaseName)
+	citizen.Get("/apps/:app_name/changelog", handlers.GetChangelog) // Deployed tags, newest first
+
+	// Built image of the latest successful deployment
+	citizen.Get("/apps/:app_name/image/export", handlers.ExportAppImage)
+	citizen.Post("/apps/:app_name/image/push", handlers.PushAppImage)
 
 	// Log management
 	citizen.Get("/apps/:app_name/logs", handlers.GetAppLogs)
 	citizen.Get("/apps/:app_name/logs/stream", handlers.StreamAppLogs)
+	citizen.Get("/apps/:app_name/logs/tail", handlers.TailAppLogs)
 	citizen.Get("/apps/:app_name/logs/info", handlers.GetLogInfo)
 	citizen.Get("/apps/:app_name/logs/live-build", handlers.GetLiveBuildLogs)
 
+	// Log alert rules
+	citizen.Get("/apps/:app_name/log-alerts", handlers.ListLogAlertRules)
+	citizen.Post("/apps/:app_name/log-alerts", handlers.CreateLogAlertRule)
+	citizen.Post("/apps/:app_name/log-alerts/test", handlers.TestLogAlertRule)
+	citizen.Put("/apps/:app_name/log-alerts/:id", handlers.UpdateLogAlertRule)
+	citizen.Delete("/apps/:app_name/log-alerts/:id", handlers.DeleteLogAlertRule)
+
+	// Forwarding of app logs to external syslog, https or Vector sinks
+	citizen.Get("/apps/:app_name/log-sinks", handlers.ListLogSinks)
+	citizen.Post("/apps/:app_name/log-sinks", handlers.CreateLogSink)
+	citizen.Put("/apps/:app_name/log-sinks/:id", handlers.UpdateLogSink)
+	citizen.Delete("/apps/:app_name/log-sinks/:id", handlers.DeleteLogSink)
+	citizen.Post("/apps/:app_name/log-sinks/:id/test", handlers.TestLogSink)
+
+	// Traffic stats from the Traefik access logs
+	citizen.Get("/apps/:app_name/traffic", handlers.GetAppTraffic)
+
+	// Scaling recommendations from the resource usage and traffic of an app
+	citizen.Get("/apps/:app_name/recommendations", handlers.GetScalingRecommendations)
+	citizen.Post("/apps/:app_name/recommendations/:id/apply", handlers.ApplyScalingRecommendation)
+
+	// Share links to private apps
+	citizen.Get("/apps/:app_name/share-links", handlers.ListShareLinks)
+	citizen.Post("/apps/:app_name/share-links", handlers.CreateShareLink)
+	citizen.Delete("/apps/:app_name/share-links/:id", handlers.RevokeShareLink)
+
+	// Service tokens letting scripts and probes through the SSO of an app
+	citizen.Get("/apps/:app_name/service-tokens", handlers.ListServiceTokens)
+	citizen.Post("/apps/:app_name/service-tokens", handlers.CreateServiceToken)
+	citizen.Delete("/apps/:app_name/service-tokens/:id", handlers.RevokeServiceToken)
+
+	// Read-only support access for the platform operator, listed and revoked under /me/support-access
+	citizen.Post("/apps/:app_name/support-access", handlers.CreateSupportGrant)
+
+	// Visitor analytics sampled in ForwardAuth
+	citizen.Get("/apps/:app_name/analytics", handlers.GetVisitorAnalytics)
+	citizen.Put("/apps/:app_name/analytics", handlers.SetVisitorAnalytics)
+
+	// Identity of the signed-in visitor passed to apps by ForwardAuth
+	citizen.Get("/apps/:app_name/identity-headers", handlers.GetIdentityHeaders)
+	citizen.Put("/apps/:app_name/identity-headers", handlers.SetIdentityHeaders)
+
+	// Public status badges
+	citizen.Get("/apps/:app_name/badges", handlers.GetAppBadges)
+	citizen.Put("/apps/:app_name/badges", handlers.SetAppBadges)
+
+	// Outbound webhooks of app events
+	citizen.Get("/apps/:app_name/webhooks", handlers.ListAppWebhooks)
+	citizen.Post("/apps/:app_name/webhooks", handlers.CreateAppWebhook)
+	citizen.Put("/apps/:app_name/webhooks/:id", handlers.UpdateAppWebhook)
+	citizen.Delete("/apps/:app_name/webhooks/:id", handlers.DeleteAppWebhook)
+	citizen.Get("/apps/:app_name/webhooks/:id/deliveries", handlers.ListAppWebhookDeliveries)
+	citizen.Post("/apps/:app_name/webhooks/:id/test", handlers.TestAppWebhook)
+	citizen.Post("/apps/:app_name/webhooks/:id/deliveries/:delivery_id/retry", handlers.RetryAppWebhookDelivery)
+
 	// Activities
 	citizen.Get("/apps/:app_name/activities", handlers.GetAppActivities)
+	citizen.Get("/apps/:app_name/activities/:activity_id", handlers.GetAppActivity)
+
+	// Admin routes (admin users only)
+	admin := api.Group("/admin", middleware.Protected(), middleware.AdminOnly())
+
+	// Background task scheduler
+	admin.Get("/tasks", handlers.ListScheduledTasks)
+	admin.Get("/tasks/:task_name", handlers.GetScheduledTask)
+	admin.Post("/tasks/:task_name/run", handlers.RunScheduledTask)
+	admin.Put("/tasks/:task_name", handlers.UpdateScheduledTaskInterval)
+
+	// Dokku host management
+	admin.Get("/system/version", handlers.GetDokkuVersion)
+	admin.Get("/system/plugins", handlers.ListDokkuPlugins)
+	admin.Post("/system/plugins", handlers.InstallDokkuPlugin)
+	admin.Put("/system/plugins/:plugin_name", handlers.UpdateDokkuPlugin)
+	admin.Get("/system/domains", handlers.GetGlobalDomains)
+	admin.Put("/system/domains", handlers.SetGlobalDomains)
+	admin.Post("/system/domains", handlers.AddGlobalDomain)
+	admin.Delete("/system/domains/:domain", handlers.RemoveGlobalDomain)
+	admin.Get("/system/restart-apps", handlers.GetScheduledRestart)
+	admin.Post("/system/restart-apps", handlers.ScheduleRestart)
+	admin.Delete("/system/restart-apps", handlers.CancelScheduledRestart)
+	admin.Get("/system/audit", handlers.ListSystemAudit)
+	admin.Get("/system/slow-queries", handlers.ListSlowQueries)
+	admin.Get("/system/database-pool", handlers.GetDatabasePoolConfig)
+	admin.Put("/system/database-pool", handlers.SetDatabasePoolConfig)
+	admin.Get("/system/config/validate", handlers.ValidateSystemConfig)
+	admin.Post("/system/diagnostics", handlers.CreateDiagnosticsBundle)
+	admin.Get("/system/deploy-detection", handlers.GetDeployDetectionConfig)
+	admin.Put("/system/deploy-detection", handlers.SetDeployDetectionConfig)
+	admin.Get("/system/git-sources", handlers.GetGitSourceConfig)
+	admin.Put("/system/git-sources", handlers.SetGitSourceConfig)
+	admin.Get("/system/dashboard-access", handlers.GetDashboardAccessConfig)
+	admin.Put("/system/dashboard-access", handlers.SetDashboardAccessConfig)
+	admin.Get("/system/dashboard-access/explain", handlers.ExplainCookiePolicy)
+	admin.Get("/system/not-found-page", handlers.GetNotFoundPageConfig)
+	admin.Put("/system/not-found-page", handlers.SetNotFoundPageConfig)
+	admin.Get("/system/image-cleanup", handlers.GetImageCleanup)
+	admin.Put("/system/image-cleanup", handlers.SetImageCleanupConfig)
+	admin.Post("/system/image-cleanup/run", handlers.RunImageCleanup)
+	admin.Post("/slack/config", handlers.SetupSlackConfig)
+	admin.Get("/slack/config", handlers.GetSlackConfig)
+	admin.Delete("/slack/config", handlers.DeleteSlackConfig)
+	admin.Get("/slack/workspaces", handlers.ListSlackWorkspaces)
+	admin.Delete("/slack/workspaces/:team_id", handlers.DeleteSlackWorkspace)
+
+	// Custom domain ownership
+	admin.Post("/custom-domains/:domain/move", handlers.ForceMoveCustomDomain)
+
+	// Soft-deleted app data
+	admin.Get("/soft-deleted", handlers.ListSoftDeleted)
+	admin.Post("/soft-deleted/:app_name/restore", handlers.RestoreSoftDeleted)
+	admin.Delete("/soft-deleted", handlers.PurgeSoftDeleted)
+
+	// Operations across dokku and the database
+	admin.Get("/operations", handlers.ListOperations)
+	admin.Post("/operations/:id/reconcile", handlers.ReconcileOperation)
+	admin.Post("/operations/:id/resolve", handlers.ResolveOperation)
+
+	// Build usage and quotas per user, team and app
+	admin.Get("/build-usage", handlers.GetBuildUsage)
+	admin.Get("/build-quotas", handlers.ListBuildQuotas)
+	admin.Put("/build-quotas/:scope/:subject", handlers.SetBuildQuota)
+	admin.Delete("/build-quotas/:scope/:subject", handlers.DeleteBuildQuota)
+	admin.Put("/users/:user_id/team", handlers.SetUserTeam)
+
+	// SCIM provisioning, enabled by generating a token
+	admin.Get("/scim", handlers.GetSCIMSettings)
+	admin.Put("/scim", handlers.SetSCIMSettings)
+	admin.Post("/scim/token", handlers.CreateSCIMToken)
+	admin.Delete("/scim/token", handlers.DeleteSCIMToken)
 
 	// GitHub integration endpoints
 	github := api.Group("/github")
@@ -123,12 +391,41 @@ func SetupRoutes(app *fiber.App) {
 	github.Get("/auth/init", middleware.Protected(), handlers.GitHubAuthInit)
 	github.Get("/auth/callback", middleware.Protected(), handlers.GitHubAuthCallback)
 	github.Get("/status", middleware.Protected(), handlers.GetGitHubStatus)
+	github.Get("/connection/health", middleware.Protected(), handlers.GetGitHubConnectionHealth)
+	github.Delete("/connection", middleware.Protected(), handlers.RevokeGitHubConnection)
 	github.Get("/repositories", middleware.Protected(), handlers.ListGitHubRepositories)
 	github.Get("/connections", middleware.Protected(), handlers.GetRepositoryConnections)
 	github.Post("/connect", middleware.Protected(), handlers.ConnectRepository)
 	github.Delete("/apps/:app_name/disconnect", middleware.Protected(), handlers.DisconnectRepository)
 	github.Put("/apps/:app_name/auto-deploy", middleware.Protected(), handlers.ToggleAutoDeploy)
+	github.Get("/apps/:app_name/branch-rules", middleware.Protected(), handlers.GetBranchRules)
+	github.Put("/apps/:app_name/branch-rules", middleware.Protected(), handlers.SetBranchRules)
+	github.Get("/apps/:app_name/branch-rules/match", middleware.Protected(), handlers.MatchBranchRule)
+	github.Put("/apps/:app_name/deploy-policy", middleware.Protected(), handlers.SetDeployPolicy)
+	github.Get("/apps/:app_name/build-path", middleware.Protected(), handlers.GetBuildPath)
+	github.Put("/apps/:app_name/build-path", middleware.Protected(), handlers.SetBuildPath)
+	github.Get("/apps/:app_name/push-filter", middleware.Protected(), handlers.GetPushFilter)
+	github.Put("/apps/:app_name/push-filter", middleware.Protected(), handlers.SetPushFilter)
 	
 	// GitHub webhook endpoint (public - no auth required)
 	github.Post("/webhook", handlers.GitHubWebhookHandler)
+
+	// Slack integration endpoints
+	slack := api.Group("/slack")
+	slack.Get("/install/init", middleware.Protected(), handlers.SlackInstallInit)
+	slack.Get("/install/callback", middleware.Protected(), handlers.SlackInstallCallback)
+
+	// Slack command and interaction endpoints (public - verified by Slack signature)
+	slack.Post("/commands", handlers.SlackCommandHandler)
+	slack.Post("/interactions", handlers.SlackInteractionHandler)
+
+	// Traefik access log push (public - verified by ingestion token)
+	api.Post("/traffic/ingest", handlers.IngestTraffic)
+
+	// Status badges of apps that enabled them (public - rate limited per client)
+	api.Get("/badges/:app_name/:badge", middleware.RateLimit(120, time.Minute), handlers.AppBadge)
+
+	// Deployment cancellation at the path it was first specified with, same as
+	// /citizen/apps/:app_name/deployments/:id/cancel
+	api.Post("/apps/:app_name/deploys/:deploy_id/cancel", middleware.Protected(), handlers.CancelDeployment)
 }
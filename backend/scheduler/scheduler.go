@@ -0,0 +1,349 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"backend/database/api"
+	"backend/utils"
+)
+
+var (
+	ErrTaskNotFound       = errors.New("task not found")
+	ErrTaskAlreadyRunning = errors.New("task is already running")
+	ErrInvalidInterval    = errors.New("interval must be at least 10 seconds")
+)
+
+// MinInterval is the shortest interval a task can be scheduled with
+const MinInterval = 10 * time.Second
+
+// settingKeyPrefix is the system_settings key prefix for task intervals
+const settingKeyPrefix = "scheduler."
+
+// TaskFunc is the work performed by a scheduled task
+type TaskFunc func(ctx context.Context) error
+
+// Task is a named background job run on a fixed interval
+type Task struct {
+	Name        string
+	Description string
+	Interval    time.Duration
+	Timeout     time.Duration
+	Run         TaskFunc
+
+	mu           sync.Mutex
+	running      bool
+	lastRun      *time.Time
+	nextRun      *time.Time
+	lastDuration time.Duration
+	lastError    string
+	runCount     int
+	failCount    int
+	reset        chan struct{}
+}
+
+// TaskStatus is a snapshot of a task's schedule and last execution
+type TaskStatus struct {
+	Name            string     `json:"name"`
+	Description     string     `json:"description"`
+	Interval        string     `json:"interval"`
+	IntervalSeconds int        `json:"interval_seconds"`
+	Running         bool       `json:"running"`
+	LastRun         *time.Time `json:"last_run"`
+	NextRun         *time.Time `json:"next_run"`
+	LastDurationMs  int64      `json:"last_duration_ms"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastStatus      string     `json:"last_status"`
+	RunCount        int        `json:"run_count"`
+	FailCount       int        `json:"fail_count"`
+}
+
+// Scheduler runs registered tasks in the background
+type Scheduler struct {
+	mu      sync.RWMutex
+	tasks   map[string]*Task
+	started bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// Default is the process-wide scheduler used by main and the admin handlers
+var Default = New()
+
+// New creates an empty scheduler
+func New() *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		tasks:  make(map[string]*Task),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// IntervalSettingKey returns the system setting key holding a task's interval
+func IntervalSettingKey(name string) string {
+	return settingKeyPrefix + name + ".interval"
+}
+
+// Register adds a task to the scheduler; tasks registered after Start are started immediately
+func (s *Scheduler) Register(name, description string, interval time.Duration, fn TaskFunc) {
+	task := &Task{
+		Name:        name,
+		Description: description,
+		Interval:    interval,
+		Timeout:     interval,
+		Run:         fn,
+		reset:       make(chan struct{}, 1),
+	}
+
+	s.mu.Lock()
+	s.tasks[name] = task
+	started := s.started
+	s.mu.Unlock()
+
+	if started {
+		go s.loop(task)
+	}
+}
+
+// LoadIntervalsFromSettings overrides default intervals with values stored in system settings
+func (s *Scheduler) LoadIntervalsFromSettings(ctx context.Context) {
+	settings, err := api.Settings.ListSystemSettings(ctx, settingKeyPrefix)
+	if err != nil {
+		utils.WarnLog("Failed to load scheduler settings, using defaults: %v", err)
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for name, task := range s.tasks {
+		value, ok := settings[IntervalSettingKey(name)]
+		if !ok {
+			continue
+		}
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < MinInterval {
+			utils.WarnLog("Ignoring invalid interval %q for task %s", value, name)
+			continue
+		}
+		task.mu.Lock()
+		task.Interval = interval
+		task.Timeout = interval
+		task.mu.Unlock()
+	}
+}
+
+// Start launches a goroutine per registered task
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = true
+	tasks := make([]*Task, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	s.mu.Unlock()
+
+	for _, task := range tasks {
+		go s.loop(task)
+	}
+
+	utils.StartupLog("Background scheduler started with %d tasks", len(tasks))
+}
+
+// Stop cancels all scheduled tasks
+func (s *Scheduler) Stop() {
+	s.cancel()
+}
+
+// loop waits for the task interval (or an interval change) and runs the task
+func (s *Scheduler) loop(task *Task) {
+	for {
+		task.mu.Lock()
+		interval := task.Interval
+		next := time.Now().Add(interval)
+		task.nextRun = &next
+		task.mu.Unlock()
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-task.reset:
+			timer.Stop()
+			continue
+		case <-timer.C:
+			s.execute(task)
+		}
+	}
+}
+
+// execute runs a task once, recording its outcome
+func (s *Scheduler) execute(task *Task) error {
+	task.mu.Lock()
+	if task.running {
+		task.mu.Unlock()
+		return ErrTaskAlreadyRunning
+	}
+	task.running = true
+	timeout := task.Timeout
+	task.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	// Each run gets its own correlation ID, passed on to the dokku commands it runs with ctx
+	runID := "task-" + task.Name + "-" + utils.NewCorrelationID()
+	ctx = utils.WithCorrelationID(ctx, runID)
+
+	start := time.Now()
+	err := runSafely(ctx, task)
+	duration := time.Since(start)
+
+	task.mu.Lock()
+	task.running = false
+	task.lastRun = &start
+	task.lastDuration = duration
+	task.runCount++
+	if err != nil {
+		task.failCount++
+		task.lastError = err.Error()
+	} else {
+		task.lastError = ""
+	}
+	task.mu.Unlock()
+
+	if err != nil {
+		utils.WarnLog("Scheduled task %s (%s) failed after %v: %v", task.Name, runID, duration, err)
+	} else {
+		utils.DebugLog("Scheduled task %s (%s) completed in %v", task.Name, runID, duration)
+	}
+	return err
+}
+
+// runSafely runs the task function, converting panics to errors
+func runSafely(ctx context.Context, task *Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in task %s: %v", task.Name, r)
+		}
+	}()
+	return task.Run(ctx)
+}
+
+// Trigger runs a task immediately in the background
+func (s *Scheduler) Trigger(name string) error {
+	task, err := s.get(name)
+	if err != nil {
+		return err
+	}
+
+	task.mu.Lock()
+	running := task.running
+	task.mu.Unlock()
+	if running {
+		return ErrTaskAlreadyRunning
+	}
+
+	go s.execute(task)
+	return nil
+}
+
+// SetInterval changes a task's interval and reschedules its next run
+func (s *Scheduler) SetInterval(name string, interval time.Duration) error {
+	if interval < MinInterval {
+		return ErrInvalidInterval
+	}
+
+	task, err := s.get(name)
+	if err != nil {
+		return err
+	}
+
+	task.mu.Lock()
+	task.Interval = interval
+	task.Timeout = interval
+	task.mu.Unlock()
+
+	// Wake up the loop so the new interval applies immediately
+	select {
+	case task.reset <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Status returns the status of a single task
+func (s *Scheduler) Status(name string) (*TaskStatus, error) {
+	task, err := s.get(name)
+	if err != nil {
+		return nil, err
+	}
+	status := task.status()
+	return &status, nil
+}
+
+// StatusAll returns the status of every registered task sorted by name
+func (s *Scheduler) StatusAll() []TaskStatus {
+	s.mu.RLock()
+	statuses := make([]TaskStatus, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		statuses = append(statuses, task.status())
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// get looks up a task by name
+func (s *Scheduler) get(name string) (*Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	task, ok := s.tasks[name]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	return task, nil
+}
+
+// status builds a TaskStatus snapshot
+func (t *Task) status() TaskStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lastStatus := "never_run"
+	if t.running {
+		lastStatus = "running"
+	} else if t.lastRun != nil {
+		if t.lastError != "" {
+			lastStatus = "error"
+		} else {
+			lastStatus = "success"
+		}
+	}
+
+	return TaskStatus{
+		Name:            t.Name,
+		Description:     t.Description,
+		Interval:        t.Interval.String(),
+		IntervalSeconds: int(t.Interval.Seconds()),
+		Running:         t.running,
+		LastRun:         t.lastRun,
+		NextRun:         t.nextRun,
+		LastDurationMs:  t.lastDuration.Milliseconds(),
+		LastError:       t.lastError,
+		LastStatus:      lastStatus,
+		RunCount:        t.runCount,
+		FailCount:       t.failCount,
+	}
+}
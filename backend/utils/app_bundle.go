@@ -0,0 +1,508 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// AppBundleVersion is the format of the bundles written by this instance
+	AppBundleVersion = 1
+	// appBundleFile is the bundle entry describing the app, always first
+	appBundleFile = "bundle.json"
+	// maxAppBundleFile bounds the size of bundle.json
+	maxAppBundleFile = 4 << 20
+	// defaultAppBundleMaxBytes bounds the service dumps read from a bundle when
+	// APP_BUNDLE_MAX_BYTES is unset
+	defaultAppBundleMaxBytes = 2 << 30
+)
+
+// DatastorePlugins are the dokku service plugins whose services linked to an app are bundled
+var DatastorePlugins = []string{"postgres", "mysql", "mariadb", "redis", "mongo"}
+
+var (
+	// ErrAppBundlePassphrase is returned when the env of a bundle can't be opened with a passphrase
+	ErrAppBundlePassphrase = errors.New("wrong passphrase for the env of the bundle")
+	// ErrAppBundleConflict is returned when a bundled service already exists on this instance
+	ErrAppBundleConflict = errors.New("bundled service already exists")
+
+	serviceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+)
+
+// AppBundle describes an app exported to be recreated on another Citizen instance: its
+// configuration, git source, env and the dumps of its linked services
+type AppBundle struct {
+	Version    int          `json:"version"`
+	App        string       `json:"app"`
+	ExportedAt time.Time    `json:"exported_at"`
+	SourceHost string       `json:"source_host,omitempty"`
+	Manifest   *AppManifest `json:"manifest"`
+	GitURL     string       `json:"git_url,omitempty"`
+	GitBranch  string       `json:"git_branch,omitempty"`
+	// DockerfilePath is the Dockerfile the app builds, "" for the repository root
+	DockerfilePath string `json:"dockerfile_path,omitempty"`
+	// EnvKeys are the names of the env vars of the app, their values are only in SealedEnv
+	EnvKeys   []string         `json:"env_keys"`
+	SealedEnv *SealedEnv       `json:"sealed_env,omitempty"`
+	Services  []BundledService `json:"services"`
+	Warnings  []string         `json:"warnings,omitempty"`
+}
+
+// BundledService is a dokku service linked to a bundled app, with the file of its dump
+type BundledService struct {
+	Plugin   string `json:"plugin"`
+	Name     string `json:"name"`
+	DumpFile string `json:"dump_file,omitempty"`
+}
+
+// SealedEnv is the env of a bundled app encrypted with a key derived from a passphrase, so
+// bundles can be moved around without exposing secrets
+type SealedEnv struct {
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// AppBundleOptions selects what goes in a bundle. The env values are only bundled with a
+// passphrase to seal them, without the values of OmitEnvKeys.
+type AppBundleOptions struct {
+	IncludeEnv      bool
+	Passphrase      string
+	OmitEnvKeys     []string
+	IncludeServices bool
+	GitURL          string
+	GitBranch       string
+}
+
+// AppBundleImport selects the name of the app created from a bundle
+type AppBundleImport struct {
+	AppName string
+	UserID  *int
+}
+
+// AppBundleMaxBytes returns how much service dump data a bundle may hold, from APP_BUNDLE_MAX_BYTES
+func AppBundleMaxBytes() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("APP_BUNDLE_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return defaultAppBundleMaxBytes
+}
+
+// bundleKey derives the key sealing a bundled env from a passphrase
+func bundleKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+// SealEnv encrypts an env with AES-GCM under a key derived from passphrase
+func SealEnv(env map[string]string, passphrase string) (*SealedEnv, error) {
+	plaintext, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	sealed := &SealedEnv{Salt: make([]byte, 16)}
+	if _, err := io.ReadFull(rand.Reader, sealed.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	gcm, err := bundleCipher(passphrase, sealed.Salt)
+	if err != nil {
+		return nil, err
+	}
+	sealed.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, sealed.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed.Ciphertext = gcm.Seal(nil, sealed.Nonce, plaintext, nil)
+	return sealed, nil
+}
+
+// Open decrypts a sealed env, ErrAppBundlePassphrase when passphrase is not the one it was sealed with
+func (s *SealedEnv) Open(passphrase string) (map[string]string, error) {
+	gcm, err := bundleCipher(passphrase, s.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid sealed env nonce")
+	}
+	plaintext, err := gcm.Open(nil, s.Nonce, s.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrAppBundlePassphrase
+	}
+	env := make(map[string]string)
+	if err := json.Unmarshal(plaintext, &env); err != nil {
+		return nil, fmt.Errorf("failed to parse the sealed env: %w", err)
+	}
+	return env, nil
+}
+
+func bundleCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := bundleKey(passphrase, salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive the bundle key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// ListLinkedServices lists the services of the datastore plugins linked to an app. Plugins that
+// aren't installed are skipped.
+func ListLinkedServices(ctx context.Context, appName string) []BundledService {
+	services := []BundledService{}
+	for _, plugin := range DatastorePlugins {
+		output, err := CitizenCommandContext(ctx, plugin+":app-links", appName)
+		if err != nil {
+			DebugLog("No %s services read for %s: %v", plugin, appName, err)
+			continue
+		}
+		for _, line := range strings.Split(output, "\n") {
+			name := strings.TrimSpace(line)
+			if serviceNamePattern.MatchString(name) {
+				services = append(services, BundledService{Plugin: plugin, Name: name})
+			}
+		}
+	}
+	return services
+}
+
+// BuildAppBundle exports an app to a gzipped tar holding bundle.json and the dumps of its
+// linked services. The bundle is written to a temporary file, removed when the returned reader
+// is closed.
+func BuildAppBundle(ctx context.Context, appName string, options AppBundleOptions) (*AppBundle, io.ReadCloser, int64, error) {
+	manifest, err := ReadAppManifest(ctx, appName)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	// Domains under MAIN_DOMAIN belong to this instance, the target gives the app its own
+	manifest.Domains = slices.DeleteFunc(manifest.Domains, isPlatformDomain)
+
+	bundle := &AppBundle{
+		Version:    AppBundleVersion,
+		App:        appName,
+		ExportedAt: time.Now().UTC(),
+		SourceHost: os.Getenv("LOGIN_HOST"),
+		Manifest:   manifest,
+		GitURL:     options.GitURL,
+		GitBranch:  options.GitBranch,
+		EnvKeys:    []string{},
+		Services:   []BundledService{},
+	}
+	if bundle.DockerfilePath, err = GetDockerfilePath(appName); err != nil {
+		bundle.Warnings = append(bundle.Warnings, "dockerfile path: "+err.Error())
+	}
+
+	env, err := ExportEnv(appName)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to read env: %w", err)
+	}
+	// Dokku sets its own variables, and the links set the service URLs again on the target
+	for key := range env {
+		if strings.HasPrefix(key, "DOKKU_") {
+			delete(env, key)
+			continue
+		}
+		bundle.EnvKeys = append(bundle.EnvKeys, key)
+	}
+	sort.Strings(bundle.EnvKeys)
+	if options.IncludeEnv {
+		omitted := []string{}
+		for _, key := range options.OmitEnvKeys {
+			if _, ok := env[key]; ok {
+				delete(env, key)
+				omitted = append(omitted, key)
+			}
+		}
+		if len(omitted) > 0 {
+			sort.Strings(omitted)
+			bundle.Warnings = append(bundle.Warnings, "env values not bundled, set them again: "+strings.Join(omitted, ", "))
+		}
+		if bundle.SealedEnv, err = SealEnv(env, options.Passphrase); err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to seal env: %w", err)
+		}
+	}
+
+	file, err := os.CreateTemp("", "citizen-bundle-*.tar.gz")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	bundleFile := &removeOnClose{File: file}
+	if err := writeAppBundle(ctx, file, bundle, options.IncludeServices); err != nil {
+		bundleFile.Close()
+		return nil, nil, 0, err
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		bundleFile.Close()
+		return nil, nil, 0, err
+	}
+	return bundle, bundleFile, size, nil
+}
+
+// writeAppBundle writes the archive of a bundle. The dumps are taken first, to temporary files,
+// since a tar entry needs its size before its content.
+func writeAppBundle(ctx context.Context, w io.Writer, bundle *AppBundle, includeServices bool) error {
+	var dumps []string
+	defer func() {
+		for _, dump := range dumps {
+			os.Remove(dump)
+		}
+	}()
+	if includeServices {
+		for _, service := range ListLinkedServices(ctx, bundle.App) {
+			dump, err := os.CreateTemp("", "citizen-dump-*")
+			if err != nil {
+				return err
+			}
+			dumps = append(dumps, dump.Name())
+			err = StreamSSHCommand(ctx, service.Plugin+":export "+service.Name, dump)
+			dump.Close()
+			if err != nil {
+				return fmt.Errorf("failed to export %s service %s: %w", service.Plugin, service.Name, err)
+			}
+			service.DumpFile = fmt.Sprintf("services/%s-%s.dump", service.Plugin, service.Name)
+			bundle.Services = append(bundle.Services, service)
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	manifest, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: appBundleFile, Mode: 0o600, Size: int64(len(manifest)), ModTime: bundle.ExportedAt}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := archive.Write(manifest); err != nil {
+		return err
+	}
+	for i, service := range bundle.Services {
+		if err := addBundleFile(archive, service.DumpFile, dumps[i], bundle.ExportedAt); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addBundleFile(archive *tar.Writer, name, path string, modTime time.Time) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: info.Size(), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err = io.Copy(archive, file)
+	return err
+}
+
+// ReadAppBundle reads a bundle archive, extracting its service dumps to dir
+func ReadAppBundle(r io.Reader, dir string) (*AppBundle, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("bundle is not a gzipped archive: %w", err)
+	}
+	archive := tar.NewReader(gz)
+
+	header, err := archive.Next()
+	if err != nil || header.Name != appBundleFile {
+		return nil, fmt.Errorf("bundle doesn't start with %s", appBundleFile)
+	}
+	data, err := io.ReadAll(io.LimitReader(archive, maxAppBundleFile+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxAppBundleFile {
+		return nil, fmt.Errorf("%s is too large", appBundleFile)
+	}
+	bundle := &AppBundle{}
+	if err := json.Unmarshal(data, bundle); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", appBundleFile, err)
+	}
+	if err := bundle.validate(); err != nil {
+		return nil, err
+	}
+
+	remaining := AppBundleMaxBytes()
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		i := slices.IndexFunc(bundle.Services, func(s BundledService) bool { return s.DumpFile == header.Name })
+		if i < 0 || header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected bundle entry %s", header.Name)
+		}
+		if header.Size > remaining {
+			return nil, fmt.Errorf("bundle service dumps exceed %d bytes", AppBundleMaxBytes())
+		}
+		remaining -= header.Size
+
+		file, err := os.OpenFile(bundleDumpPath(dir, i), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(file, io.LimitReader(archive, header.Size))
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w", header.Name, err)
+		}
+	}
+
+	for i, service := range bundle.Services {
+		if _, err := os.Stat(bundleDumpPath(dir, i)); err != nil {
+			return nil, fmt.Errorf("bundle is missing the dump of %s service %s", service.Plugin, service.Name)
+		}
+	}
+	return bundle, nil
+}
+
+func bundleDumpPath(dir string, i int) string {
+	return filepath.Join(dir, fmt.Sprintf("service-%d.dump", i))
+}
+
+// validate checks what an import passes to dokku
+func (b *AppBundle) validate() error {
+	if b.Version != AppBundleVersion {
+		return fmt.Errorf("unsupported bundle version %d, this instance reads version %d", b.Version, AppBundleVersion)
+	}
+	if b.Manifest == nil {
+		return fmt.Errorf("bundle has no app configuration")
+	}
+	if err := b.Manifest.Validate(); err != nil {
+		return fmt.Errorf("invalid app configuration: %w", err)
+	}
+	if b.DockerfilePath != "" {
+		if err := ValidateDockerfilePath(b.DockerfilePath); err != nil {
+			return err
+		}
+	}
+	for _, service := range b.Services {
+		if !slices.Contains(DatastorePlugins, service.Plugin) || !serviceNamePattern.MatchString(service.Name) {
+			return fmt.Errorf("invalid bundled service %s %s", service.Plugin, service.Name)
+		}
+	}
+	return nil
+}
+
+// PlanAppBundleImport lists the steps recreating a bundled app under appName: create it, set its
+// env, recreate, import and link its services, then apply its configuration. env is the opened
+// env of the bundle, nil when it has none. Services that already exist are refused upfront.
+func PlanAppBundleImport(ctx context.Context, bundle *AppBundle, dir string, env map[string]string, options AppBundleImport) ([]*ManifestChange, error) {
+	appName := options.AppName
+	for _, service := range bundle.Services {
+		_, err := CitizenCommandContext(ctx, service.Plugin+":exists", service.Name)
+		if err == nil {
+			return nil, fmt.Errorf("%w: %s service %s", ErrAppBundleConflict, service.Plugin, service.Name)
+		}
+		if strings.Contains(err.Error(), "is not a dokku command") {
+			return nil, fmt.Errorf("the %s plugin is not installed on this instance", service.Plugin)
+		}
+	}
+
+	var changes []*ManifestChange
+	add := func(section, action, detail string, run func(ctx context.Context) (string, error)) {
+		changes = append(changes, &ManifestChange{Section: section, Action: action, Detail: detail, run: run})
+	}
+
+	add("app", "create", appName, func(ctx context.Context) (string, error) {
+		return CitizenCommandContext(ctx, "apps:create", appName)
+	})
+	if len(env) > 0 {
+		add("env", "set", fmt.Sprintf("%d env vars", len(env)), func(ctx context.Context) (string, error) {
+			result, err := SetEnvVerified(appName, env, false)
+			if err == nil && result.Failed > 0 {
+				err = fmt.Errorf("%d env vars were not applied", result.Failed)
+			}
+			if result == nil {
+				return "", err
+			}
+			return result.Output, err
+		})
+	}
+
+	// Env is set before the links, which set the service URLs of this instance over the old ones
+	for i, service := range bundle.Services {
+		plugin, name, dump := service.Plugin, service.Name, bundleDumpPath(dir, i)
+		add("services", "create", plugin+" "+name, func(ctx context.Context) (string, error) {
+			return CitizenCommandContext(ctx, plugin+":create", name)
+		})
+		add("services", "import", plugin+" "+name, func(ctx context.Context) (string, error) {
+			file, err := os.Open(dump)
+			if err != nil {
+				return "", err
+			}
+			defer file.Close()
+			return RunSSHCommandInput(ctx, plugin+":import "+name, file)
+		})
+		add("services", "link", plugin+" "+name, func(ctx context.Context) (string, error) {
+			return CitizenCommandContext(ctx, plugin+":link", name, appName)
+		})
+	}
+
+	// A new app has no configuration, every section of the bundle is applied
+	current := &AppManifest{
+		App:        appName,
+		Domains:    []string{},
+		Buildpacks: []string{},
+		Env:        slices.Sorted(maps.Keys(env)),
+		Scale:      map[string]int{},
+		Checks:     &ManifestChecks{Disabled: []string{}, Skipped: []string{}},
+	}
+	changes = append(changes, PlanAppManifest(appName, current, bundle.Manifest, false, options.UserID)...)
+
+	if bundle.DockerfilePath != "" {
+		dockerfilePath := bundle.DockerfilePath
+		add("builder", "set", "dockerfile "+dockerfilePath, func(ctx context.Context) (string, error) {
+			return SetDockerfilePath(appName, dockerfilePath)
+		})
+	}
+	return changes, nil
+}
+
+// removeOnClose is a temporary file deleted once read
+type removeOnClose struct {
+	*os.File
+}
+
+func (f *removeOnClose) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database/api"
+)
+
+// Health statuses of an app, from best to worst
+const (
+	HealthGreen  = "green"
+	HealthYellow = "yellow"
+	HealthRed    = "red"
+)
+
+const (
+	// AppsHealthMaxAge is how old the cached health overview may get before a request refreshes it
+	AppsHealthMaxAge = 5 * time.Minute
+	// appHealthWindow is how far back uptime samples and log alerts count against the health
+	appHealthWindow = time.Hour
+)
+
+// healthRank orders the statuses so the worst one of several signals wins
+var healthRank = map[string]int{HealthGreen: 0, HealthYellow: 1, HealthRed: 2}
+
+// AppHealth is the traffic light status of an app with the reasons it isn't green
+type AppHealth struct {
+	AppName   string   `json:"app_name"`
+	AppType   string   `json:"app_type"`
+	Status    string   `json:"status"`
+	Reasons   []string `json:"reasons"`
+	Deployed  bool     `json:"deployed"`
+	Running   string   `json:"running"`
+	Processes int      `json:"processes"`
+	// LastDeployment is the last deployment of the app, nil when it was never deployed by Citizen
+	LastDeployment *api.DeploymentResult `json:"last_deployment,omitempty"`
+	UptimePercent  *float64              `json:"uptime_percent,omitempty"`
+}
+
+// degrade lowers the status of an app to status, when it is worse, and records why
+func (h *AppHealth) degrade(status, format string, args ...interface{}) {
+	if healthRank[status] > healthRank[h.Status] {
+		h.Status = status
+	}
+	h.Reasons = append(h.Reasons, fmt.Sprintf(format, args...))
+}
+
+// AppsHealth is the health of all apps at the time it was computed
+type AppsHealth struct {
+	Apps        []AppHealth    `json:"apps"`
+	Summary     map[string]int `json:"summary"`
+	RefreshedAt time.Time      `json:"refreshed_at"`
+}
+
+var appsHealth = struct {
+	sync.Mutex
+	current *AppsHealth
+	// refreshing serializes refreshes, so the scheduler and requests don't compute it twice
+	refreshing sync.Mutex
+}{}
+
+// CachedAppsHealth returns the health overview computed last, nil before the first refresh
+func CachedAppsHealth() *AppsHealth {
+	appsHealth.Lock()
+	defer appsHealth.Unlock()
+	return appsHealth.current
+}
+
+// AppsHealthOverview returns the cached health overview, refreshing it first when it is missing,
+// older than maxAge or refresh is set
+func AppsHealthOverview(ctx context.Context, maxAge time.Duration, refresh bool) (*AppsHealth, error) {
+	if current := CachedAppsHealth(); current != nil && !refresh && time.Since(current.RefreshedAt) < maxAge {
+		return current, nil
+	}
+	return RefreshAppsHealth(ctx)
+}
+
+// RefreshAppsHealth computes the health of every app from one ps:report of all apps, their last
+// deployment, their uptime samples, triggered log alerts and domain checks, and caches it.
+// Worker-only apps are judged on their processes alone, their domains aren't routed.
+func RefreshAppsHealth(ctx context.Context) (*AppsHealth, error) {
+	appsHealth.refreshing.Lock()
+	defer appsHealth.refreshing.Unlock()
+	// A refresh that finished while waiting is recent enough
+	if current := CachedAppsHealth(); current != nil && time.Since(current.RefreshedAt) < time.Second {
+		return current, nil
+	}
+
+	apps, err := ListApps()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list apps: %w", err)
+	}
+	output, err := CitizenCommandContext(ctx, "ps:report")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ps report: %w", err)
+	}
+	psReports := splitReportSections(output, " ps information")
+
+	// The other signals are optional, the overview degrades to ps:report without them
+	since := time.Now().Add(-appHealthWindow)
+	deployments, err := api.Deployments.ListLastDeploymentResults(ctx)
+	if err != nil {
+		WarnLog("Apps health without deployments: %v", err)
+	}
+	uptime, err := api.Apps.ListUptimeSince(ctx, since)
+	if err != nil {
+		WarnLog("Apps health without uptime: %v", err)
+	}
+	alerts, err := api.LogAlerts.ListTriggeredLogAlerts(ctx, since)
+	if err != nil {
+		WarnLog("Apps health without log alerts: %v", err)
+	}
+	domainChecks, err := api.Settings.ListDomainChecks(ctx)
+	if err != nil {
+		WarnLog("Apps health without domain checks: %v", err)
+	}
+	appTypes, err := api.Apps.ListAppTypes(ctx)
+	if err != nil {
+		WarnLog("Apps health without app types: %v", err)
+	}
+	domains := make(map[string][]api.DomainCheck)
+	for _, check := range domainChecks {
+		domains[check.AppName] = append(domains[check.AppName], check)
+	}
+
+	overview := &AppsHealth{
+		Apps:        make([]AppHealth, 0, len(apps)),
+		Summary:     map[string]int{HealthGreen: 0, HealthYellow: 0, HealthRed: 0},
+		RefreshedAt: time.Now(),
+	}
+	for _, appName := range apps {
+		health := AppHealth{AppName: appName, AppType: AppTypeWeb, Status: HealthGreen, Reasons: []string{}}
+		if appType, ok := appTypes[appName]; ok {
+			health.AppType = appType
+		}
+		applyPsReport(&health, parseReportSection(psReports[appName]))
+
+		if result, ok := deployments[appName]; ok {
+			health.LastDeployment = &result
+			switch result.Status {
+			case string(api.StatusError):
+				health.degrade(HealthYellow, "last deployment %d failed", result.ID)
+			case string(api.StatusPending):
+				health.Reasons = append(health.Reasons, fmt.Sprintf("deployment %d in progress", result.ID))
+			}
+		}
+		if count, ok := uptime[appName]; ok && count.Samples > 0 {
+			percent := float64(count.UpSamples*10000/count.Samples) / 100
+			health.UptimePercent = &percent
+			switch {
+			case count.UpSamples == 0:
+				health.degrade(HealthRed, "down in every uptime sample of the last hour")
+			case count.UpSamples < count.Samples:
+				health.degrade(HealthYellow, "up in %.2f%% of the uptime samples of the last hour", percent)
+			}
+		}
+		if names := alerts[appName]; len(names) > 0 {
+			health.degrade(HealthYellow, "log alerts triggered in the last hour: %s", strings.Join(names, ", "))
+		}
+		if health.AppType != AppTypeWorker {
+			for _, check := range domains[appName] {
+				applyDomainCheck(&health, check)
+			}
+		}
+
+		overview.Summary[health.Status]++
+		overview.Apps = append(overview.Apps, health)
+	}
+	// Worst first, so the apps needing attention lead the overview
+	sort.SliceStable(overview.Apps, func(i, j int) bool {
+		a, b := overview.Apps[i], overview.Apps[j]
+		if healthRank[a.Status] != healthRank[b.Status] {
+			return healthRank[a.Status] > healthRank[b.Status]
+		}
+		return a.AppName < b.AppName
+	})
+
+	appsHealth.Lock()
+	appsHealth.current = overview
+	appsHealth.Unlock()
+	return overview, nil
+}
+
+// applyPsReport sets the process state of an app from its ps:report. Apps never deployed are
+// yellow, deployed apps with no process running are red and with some processes down yellow.
+func applyPsReport(health *AppHealth, report map[string]string) {
+	health.Deployed = report["Deployed"] == "true"
+	health.Running = report["Running"]
+	fmt.Sscan(report["Processes"], &health.Processes)
+
+	if !health.Deployed {
+		health.degrade(HealthYellow, "not deployed")
+		return
+	}
+
+	var down, restarting []string
+	for key, value := range report {
+		process, ok := strings.CutPrefix(key, "Status ")
+		if !ok {
+			continue
+		}
+		state, _, _ := strings.Cut(value, " ")
+		switch state {
+		case "running":
+		case "restarting":
+			restarting = append(restarting, process)
+		default:
+			down = append(down, process)
+		}
+	}
+	sort.Strings(down)
+	sort.Strings(restarting)
+
+	switch {
+	case len(restarting) > 0:
+		health.degrade(HealthRed, "restarting: %s", strings.Join(restarting, ", "))
+	case health.Running == "false" && health.Processes > 0:
+		health.degrade(HealthRed, "no process running")
+	}
+	if len(down) > 0 && health.Running != "false" {
+		health.degrade(HealthYellow, "not running: %s", strings.Join(down, ", "))
+	}
+}
+
+// applyDomainCheck lowers the status of an app for a domain that doesn't serve it properly.
+// Development hostnames and domains not checked yet are left out.
+func applyDomainCheck(health *AppHealth, check api.DomainCheck) {
+	switch check.TLSStatus {
+	case TLSExpired, TLSInvalid:
+		health.degrade(HealthRed, "certificate of %s is %s", check.Domain, check.TLSStatus)
+	case TLSExpiring:
+		health.degrade(HealthYellow, "certificate of %s expires soon", check.Domain)
+	}
+	switch check.VerificationStatus {
+	case DomainMismatch:
+		health.degrade(HealthYellow, "%s points to another server", check.Domain)
+	case DomainUnresolved:
+		health.degrade(HealthYellow, "%s doesn't resolve", check.Domain)
+	}
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backend/database/api"
+)
+
+// AppInventory is what Citizen reads from dokku to take over the management of an existing app
+type AppInventory struct {
+	AppName string   `json:"app_name"`
+	Domains []string `json:"domains"`
+	// CustomDomains are the domains outside MAIN_DOMAIN, registered as custom domains on import
+	CustomDomains []string `json:"custom_domains"`
+	Port          int      `json:"port,omitempty"`
+	Builder       string   `json:"builder,omitempty"`
+	GitBranch     string   `json:"git_branch,omitempty"`
+	GitCommit     string   `json:"git_commit,omitempty"`
+	// EnvKeys are the names of the env vars of the app, their values are not read
+	EnvKeys  []string `json:"env_keys"`
+	Deployed bool     `json:"deployed"`
+	// Warnings list the parts of the app that couldn't be read
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ListUnmanagedApps lists the dokku apps Citizen has no deployment information for, like apps
+// created on the host before Citizen was installed
+func ListUnmanagedApps(ctx context.Context) ([]string, error) {
+	apps, err := ListApps()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dokku apps: %w", err)
+	}
+	managed, err := api.Deployments.ListManagedAppNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(managed))
+	for _, appName := range managed {
+		known[appName] = true
+	}
+	unmanaged := []string{}
+	for _, appName := range apps {
+		if !known[appName] {
+			unmanaged = append(unmanaged, appName)
+		}
+	}
+	return unmanaged, nil
+}
+
+// InspectDokkuApp reads the domains, port, builder, git state and env var names of a dokku app.
+// Only the domains are required, the parts that can't be read are reported as warnings.
+func InspectDokkuApp(appName string) (*AppInventory, error) {
+	domains, err := ListDomains(appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read domains of %s: %w", appName, err)
+	}
+
+	inventory := &AppInventory{
+		AppName:       appName,
+		Domains:       domains,
+		CustomDomains: []string{},
+		EnvKeys:       []string{},
+	}
+	if inventory.Domains == nil {
+		inventory.Domains = []string{}
+	}
+	for _, domain := range domains {
+		if !isPlatformDomain(domain) {
+			inventory.CustomDomains = append(inventory.CustomDomains, domain)
+		}
+	}
+
+	if portsMap, err := dokkuReportValue("ports:report", appName, "--ports-map"); err != nil {
+		inventory.Warnings = append(inventory.Warnings, "ports: "+err.Error())
+	} else {
+		inventory.Port = containerPortFromMap(portsMap)
+	}
+
+	if builder, err := dokkuReportValue("builder:report", appName, "--builder-selected"); err != nil {
+		inventory.Warnings = append(inventory.Warnings, "builder: "+err.Error())
+	} else {
+		inventory.Builder = builder
+	}
+
+	if branch, err := dokkuReportValue("git:report", appName, "--git-deploy-branch"); err != nil {
+		inventory.Warnings = append(inventory.Warnings, "git branch: "+err.Error())
+	} else {
+		inventory.GitBranch = branch
+	}
+	if sha, err := dokkuReportValue("git:report", appName, "--git-sha"); err == nil {
+		inventory.GitCommit = sha
+	}
+
+	if deployed, err := dokkuReportValue("ps:report", appName, "--deployed"); err != nil {
+		inventory.Warnings = append(inventory.Warnings, "process status: "+err.Error())
+	} else {
+		inventory.Deployed = deployed == "true"
+	}
+
+	if env, err := GetEnv(appName); err != nil {
+		inventory.Warnings = append(inventory.Warnings, "env: "+err.Error())
+	} else {
+		for key := range env {
+			inventory.EnvKeys = append(inventory.EnvKeys, key)
+		}
+		sort.Strings(inventory.EnvKeys)
+		if inventory.Port == 0 {
+			inventory.Port, _ = strconv.Atoi(env["PORT"])
+		}
+	}
+
+	return inventory, nil
+}
+
+// dokkuReportValue reads a single value of a dokku report, like "ports:report app --ports-map"
+func dokkuReportValue(command, appName, flag string) (string, error) {
+	output, err := CitizenCommand(command, appName, flag)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// containerPortFromMap returns the container port of a dokku ports map like
+// "http:80:5000 https:443:5000", preferring the http mapping
+func containerPortFromMap(portsMap string) int {
+	port := 0
+	for _, mapping := range strings.Fields(portsMap) {
+		parts := strings.Split(mapping, ":")
+		if len(parts) != 3 {
+			continue
+		}
+		containerPort, err := strconv.Atoi(parts[2])
+		if err != nil {
+			continue
+		}
+		if parts[0] == "http" {
+			return containerPort
+		}
+		if port == 0 {
+			port = containerPort
+		}
+	}
+	return port
+}
+
+// isPlatformDomain reports whether a domain is MAIN_DOMAIN or one of its subdomains, the domains
+// Citizen gives apps itself
+func isPlatformDomain(domain string) bool {
+	mainDomain := os.Getenv("MAIN_DOMAIN")
+	if mainDomain == "" || strings.Contains(domain, "localhost") {
+		return true
+	}
+	return domain == mainDomain || strings.HasSuffix(domain, "."+mainDomain)
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxAppNameLength keeps the app subdomain within the 63 character limit of a DNS label
+const MaxAppNameLength = 63
+
+// appNamePattern follows the dokku naming rules, restricted to names usable as a subdomain:
+// lowercase letters, digits and hyphens, starting and ending with a letter or digit
+var appNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// defaultReservedAppNames are subdomains of the login host used by Citizen itself or commonly
+// pointed elsewhere, apps named so would shadow them
+var defaultReservedAppNames = []string{
+	"www", "api", "app", "apps", "admin", "auth", "login", "logout", "dashboard", "citizen",
+	"traefik", "dokku", "mail", "smtp", "imap", "pop", "ftp", "ns1", "ns2", "status", "static",
+	"assets", "cdn", "docs", "help", "support", "localhost",
+}
+
+// ReservedAppNames returns the names apps can't use, the defaults plus the comma separated
+// RESERVED_APP_NAMES
+func ReservedAppNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range append(append([]string(nil), defaultReservedAppNames...), strings.Split(os.Getenv("RESERVED_APP_NAMES"), ",")...) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsReservedAppName reports whether an app name is reserved
+func IsReservedAppName(name string) bool {
+	for _, reserved := range ReservedAppNames() {
+		if name == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeAppName lowercases and trims an app name the way CreateApp stores it
+func NormalizeAppName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// ValidateAppName checks a normalized app name against the naming rules and the reserved names
+func ValidateAppName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("app name is required")
+	case len(name) > MaxAppNameLength:
+		return fmt.Errorf("app name must be at most %d characters", MaxAppNameLength)
+	case !appNamePattern.MatchString(name):
+		return fmt.Errorf("app name may only contain lowercase letters, digits and hyphens, and must start and end with a letter or digit")
+	case IsReservedAppName(name):
+		return fmt.Errorf("app name %q is reserved", name)
+	}
+	return nil
+}
+
+// invalidAppNameChars matches the runs of characters app names can't contain
+var invalidAppNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// SuggestAppNames returns up to count valid names derived from a name that are neither taken
+// nor reserved: the name with invalid characters replaced by hyphens, then numbered variants
+func SuggestAppNames(name string, taken map[string]bool, count int) []string {
+	base := strings.Trim(invalidAppNameChars.ReplaceAllString(NormalizeAppName(name), "-"), "-")
+	if len(base) > MaxAppNameLength {
+		base = strings.TrimRight(base[:MaxAppNameLength], "-")
+	}
+	if base == "" {
+		base = "app"
+	}
+
+	var suggestions []string
+	if base != name && !taken[base] && ValidateAppName(base) == nil {
+		suggestions = append(suggestions, base)
+	}
+	for i := 2; len(suggestions) < count && i < 100; i++ {
+		suffix := "-" + strconv.Itoa(i)
+		candidate := base
+		if len(candidate)+len(suffix) > MaxAppNameLength {
+			candidate = strings.TrimRight(candidate[:MaxAppNameLength-len(suffix)], "-")
+		}
+		candidate += suffix
+		if taken[candidate] || ValidateAppName(candidate) != nil {
+			continue
+		}
+		suggestions = append(suggestions, candidate)
+	}
+	return suggestions
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"backend/database/api"
+)
+
+// App types
+const (
+	AppTypeWeb    = "web"    // serves HTTP, ports, domains and proxy routes are managed
+	AppTypeWorker = "worker" // runs background processes only, nothing routes to it
+)
+
+// ValidateAppType checks an app type is known
+func ValidateAppType(appType string) error {
+	if appType != AppTypeWeb && appType != AppTypeWorker {
+		return fmt.Errorf("app type must be %s or %s", AppTypeWeb, AppTypeWorker)
+	}
+	return nil
+}
+
+// IsWorkerApp reports whether an app is worker-only. An app whose type can't be read is handled
+// as a web app, like before types existed.
+func IsWorkerApp(ctx context.Context, appName string) bool {
+	appType, err := api.Apps.GetAppType(ctx, appName)
+	if err != nil {
+		WarnLog("Failed to read the type of %s, handling it as a web app: %v", appName, err)
+		return false
+	}
+	return appType == AppTypeWorker
+}
+
+// ApplyAppType configures the proxy of an app for its type. Worker-only apps get their proxy
+// disabled and port mappings cleared, so no route is generated for them. Web apps get their proxy
+// enabled again, the port is mapped by the next deploy.
+func ApplyAppType(ctx context.Context, appName, appType string) (string, error) {
+	commands := [][]string{{"proxy:enable", appName}}
+	if appType == AppTypeWorker {
+		commands = [][]string{{"proxy:disable", appName}, {"ports:clear", appName}}
+	}
+
+	var outputs []string
+	for _, command := range commands {
+		output, err := CitizenCommandContext(ctx, command...)
+		outputs = append(outputs, strings.TrimSpace(output))
+		if err != nil {
+			return strings.Join(outputs, "\n"), fmt.Errorf("%s failed: %w", command[0], err)
+		}
+	}
+	return strings.Join(outputs, "\n"), nil
+}
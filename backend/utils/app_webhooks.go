@@ -0,0 +1,418 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/database/api"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// App events sent to webhooks
+const (
+	EventDeploymentSucceeded = "deployment.succeeded"
+	EventDeploymentFailed    = "deployment.failed"
+	EventAppCrashed          = "app.crashed"
+	EventDomainAdded         = "domain.added"
+	EventDomainRemoved       = "domain.removed"
+	EventDomainLive          = "domain.live"
+	// EventDeploymentPendingApproval is sent when a deployment of a production app waits for an admin
+	EventDeploymentPendingApproval = "deployment.pending_approval"
+	// EventPing is only sent by test deliveries
+	EventPing = "ping"
+)
+
+// WebhookEvents are the events a webhook can subscribe to
+var WebhookEvents = []string{
+	EventDeploymentSucceeded,
+	EventDeploymentFailed,
+	EventDeploymentPendingApproval,
+	EventAppCrashed,
+	EventDomainAdded,
+	EventDomainRemoved,
+	EventDomainLive,
+}
+
+const (
+	// maxWebhookAttempts is how many times a delivery is attempted before it is failed
+	maxWebhookAttempts = 6
+	// webhookRetryBase is the delay before the first retry, each retry waits 4 times longer
+	webhookRetryBase = time.Minute
+	// webhookDeliveryLease keeps a delivery being sent from being picked up by another attempt
+	webhookDeliveryLease = 2 * time.Minute
+	// webhookDeliveryBatch bounds the deliveries sent per run of the delivery task
+	webhookDeliveryBatch = 100
+	// WebhookDeliveryRetention is how long finished deliveries are kept in the delivery log
+	WebhookDeliveryRetention = 30 * 24 * time.Hour
+	// maxWebhookResponseBody truncates the response bodies of successful deliveries kept in the
+	// delivery log, the bodies of failed deliveries aren't kept
+	maxWebhookResponseBody = 256
+	// appCrashCooldown is the shortest time between two app.crashed events of an app
+	appCrashCooldown = 10 * time.Minute
+)
+
+// errPrivateWebhookHost is returned when a webhook URL resolves to a loopback, private or
+// link-local address, which would let deliveries reach internal services
+var errPrivateWebhookHost = errors.New("webhook host resolves to a private address")
+
+// webhookHTTPClient sends deliveries and never connects to private addresses, redirects are not
+// followed so a 3xx fails the delivery
+var webhookHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         publicOnlyDialer(10*time.Second, errPrivateWebhookHost).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// IsWebhookEvent reports whether a webhook can subscribe to an event
+func IsWebhookEvent(event string) bool {
+	for _, known := range WebhookEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateWebhookURL checks that deliveries can be sent to a URL: https, or http in development,
+// to a public host. Hostnames resolving to private addresses are refused when delivering.
+func ValidateWebhookURL(webhookURL string) error {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || parsed.Host == "" || parsed.User != nil {
+		return fmt.Errorf("invalid webhook URL")
+	}
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && IsDevelopmentEnvironment()) {
+		return fmt.Errorf("webhook URLs must use https")
+	}
+	if ip := net.ParseIP(parsed.Hostname()); isLocalHostname(parsed.Hostname()) || (ip != nil && isPrivateIP(ip)) {
+		return fmt.Errorf("webhook URLs must point to a public host")
+	}
+	return nil
+}
+
+// GenerateWebhookSecret returns a new secret to sign the deliveries of a webhook
+func GenerateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// SignWebhookPayload signs a delivery body sent at timestamp (unix seconds). Receivers recompute
+// HMAC-SHA256 of "<X-Citizen-Timestamp>.<body>" with the secret and compare it to the
+// X-Citizen-Signature header, rejecting old timestamps to prevent replays.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookPayload builds the body of an event delivery
+func webhookPayload(appName, event string, data interface{}) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"event":       event,
+		"app_name":    appName,
+		"occurred_at": time.Now().UTC(),
+		"data":        data,
+	})
+}
+
+// EmitAppEvent sends an event of an app to the webhooks subscribed to it. It returns right away:
+// deliveries are stored, attempted in the background and retried by DeliverDueWebhooks.
+func EmitAppEvent(appName, event string, data interface{}) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), webhookDeliveryLease)
+		defer cancel()
+
+		webhooks, err := api.Webhooks.ListSubscribedWebhooks(ctx, appName, event)
+		if err != nil {
+			WarnLog("Failed to list webhooks of app %s for %s: %v", appName, event, err)
+			return
+		}
+		if len(webhooks) == 0 {
+			return
+		}
+
+		payload, err := webhookPayload(appName, event, data)
+		if err != nil {
+			WarnLog("Failed to encode %s event of app %s: %v", event, appName, err)
+			return
+		}
+
+		for i := range webhooks {
+			nextAttempt := time.Now().Add(webhookDeliveryLease)
+			delivery := &api.WebhookDelivery{
+				WebhookID:     webhooks[i].ID,
+				Event:         event,
+				Payload:       payload,
+				Status:        api.WebhookDeliveryPending,
+				NextAttemptAt: &nextAttempt,
+			}
+			if err := api.Webhooks.CreateWebhookDelivery(ctx, delivery); err != nil {
+				WarnLog("Failed to store %s delivery for webhook %d: %v", event, webhooks[i].ID, err)
+				continue
+			}
+			attemptWebhookDelivery(ctx, &webhooks[i], delivery, true)
+		}
+	}()
+}
+
+// SendTestWebhook sends a ping event to a webhook once, without retries, and returns the delivery
+func SendTestWebhook(ctx context.Context, webhook *api.Webhook) (*api.WebhookDelivery, error) {
+	payload, err := webhookPayload(webhook.AppName, EventPing, map[string]interface{}{
+		"webhook_id": webhook.ID,
+		"events":     webhook.Events,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &api.WebhookDelivery{
+		WebhookID: webhook.ID,
+		Event:     EventPing,
+		Payload:   payload,
+		Status:    api.WebhookDeliveryPending,
+	}
+	if err := api.Webhooks.CreateWebhookDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	attemptWebhookDelivery(ctx, webhook, delivery, false)
+	return delivery, nil
+}
+
+// DeliverDueWebhooks attempts the pending deliveries whose retry is due and returns how many
+func DeliverDueWebhooks(ctx context.Context) (int, error) {
+	deliveries, err := api.Webhooks.ClaimDueWebhookDeliveries(ctx, webhookDeliveryLease, webhookDeliveryBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	webhooks := make(map[int]*api.Webhook)
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			webhook, err = api.Webhooks.GetWebhookByID(ctx, delivery.WebhookID)
+			if err != nil {
+				WarnLog("Failed to get webhook %d: %v", delivery.WebhookID, err)
+				continue
+			}
+			webhooks[delivery.WebhookID] = webhook
+		}
+
+		if !webhook.Enabled {
+			message := "webhook disabled"
+			delivery.Status = api.WebhookDeliveryFailed
+			delivery.Error = &message
+			delivery.NextAttemptAt = nil
+			if err := api.Webhooks.RecordWebhookAttempt(ctx, delivery); err != nil {
+				WarnLog("Failed to record webhook delivery %d: %v", delivery.ID, err)
+			}
+			continue
+		}
+		attemptWebhookDelivery(ctx, webhook, delivery, true)
+	}
+	return len(deliveries), nil
+}
+
+// attemptWebhookDelivery sends a delivery and records the outcome. A failed delivery is scheduled
+// for a retry with an exponential backoff when retry is set, until maxWebhookAttempts.
+func attemptWebhookDelivery(ctx context.Context, webhook *api.Webhook, delivery *api.WebhookDelivery, retry bool) {
+	delivery.Attempts++
+	started := time.Now()
+	code, body, err := sendWebhookDelivery(ctx, webhook, delivery)
+	duration := int(time.Since(started).Milliseconds())
+	delivery.DurationMs = &duration
+	delivery.ResponseCode = nil
+	delivery.ResponseBody = nil
+	delivery.Error = nil
+	if code != 0 {
+		delivery.ResponseCode = &code
+	}
+	if err == nil {
+		delivery.ResponseBody = &body
+	}
+
+	switch {
+	case err == nil:
+		now := time.Now()
+		delivery.Status = api.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	case retry && delivery.Attempts < maxWebhookAttempts:
+		message := err.Error()
+		delivery.Error = &message
+		delivery.Status = api.WebhookDeliveryPending
+		next := time.Now().Add(webhookRetryBase << (2 * (delivery.Attempts - 1)))
+		delivery.NextAttemptAt = &next
+	default:
+		message := err.Error()
+		delivery.Error = &message
+		delivery.Status = api.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+	}
+
+	if err != nil {
+		DebugLog("Webhook delivery %d (%s) to webhook %d failed, attempt %d: %v",
+			delivery.ID, delivery.Event, webhook.ID, delivery.Attempts, err)
+	}
+	if err := api.Webhooks.RecordWebhookAttempt(ctx, delivery); err != nil {
+		WarnLog("Failed to record webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// sendWebhookDelivery posts a signed delivery and returns the response code, and the truncated
+// body of a successful response
+func sendWebhookDelivery(ctx context.Context, webhook *api.Webhook, delivery *api.WebhookDelivery) (int, string, error) {
+	secret, err := DecryptString(webhook.Secret)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to decrypt webhook secret: %w", err)
+	}
+	if err := ValidateWebhookURL(webhook.URL); err != nil {
+		return 0, "", err
+	}
+
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Citizen-Webhooks/1.0")
+	req.Header.Set("X-Citizen-Event", delivery.Event)
+	req.Header.Set("X-Citizen-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Citizen-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Citizen-Signature", SignWebhookPayload(secret, timestamp, delivery.Payload))
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, "", fmt.Errorf("receiver answered HTTP %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBody))
+	return resp.StatusCode, string(body), nil
+}
+
+// exitCodeRegex reads the exit code from a docker container status like "Exited (1) 2 minutes ago"
+var exitCodeRegex = regexp.MustCompile(`^Exited \((\d+)\)`)
+
+// crashWatch remembers the crashed containers already reported
+var crashWatch = struct {
+	sync.Mutex
+	primed    bool
+	crashed   map[string]bool
+	lastEvent map[string]time.Time
+}{crashed: make(map[string]bool), lastEvent: make(map[string]time.Time)}
+
+// DetectAppCrashes emits app.crashed for the app containers that started restarting or exited
+// with an error since the last check, at most once per app every appCrashCooldown. Only apps with
+// a webhook subscribed to app.crashed are checked; crashes found on the first check are only
+// remembered, as they may have been reported before a restart of Citizen.
+func DetectAppCrashes(ctx context.Context) error {
+	apps, err := api.Webhooks.ListAppsSubscribedTo(ctx, EventAppCrashed)
+	if err != nil {
+		return err
+	}
+	subscribed := make(map[string]bool, len(apps))
+	for _, appName := range apps {
+		subscribed[appName] = true
+	}
+
+	crashWatch.Lock()
+	defer crashWatch.Unlock()
+	if len(subscribed) == 0 {
+		crashWatch.primed = false
+		crashWatch.crashed = make(map[string]bool)
+		return nil
+	}
+
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", "com.dokku.app-name"),
+			filters.Arg("label", "com.dokku.container-type=deploy"),
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list app containers: %w", err)
+	}
+
+	crashed := make(map[string]bool)
+	for _, c := range containers {
+		appName := c.Labels["com.dokku.app-name"]
+		if !subscribed[appName] {
+			continue
+		}
+
+		exitCode := -1
+		if matches := exitCodeRegex.FindStringSubmatch(c.Status); matches != nil {
+			exitCode, _ = strconv.Atoi(matches[1])
+		}
+		// Containers stopped by a deploy or a scale down exit with 0 or on SIGTERM (143)
+		if c.State != "restarting" && !(c.State == "exited" && exitCode != 0 && exitCode != 143) {
+			continue
+		}
+		crashed[c.ID] = true
+		if !crashWatch.primed || crashWatch.crashed[c.ID] {
+			continue
+		}
+		if time.Since(crashWatch.lastEvent[appName]) < appCrashCooldown {
+			continue
+		}
+		crashWatch.lastEvent[appName] = time.Now()
+
+		processType := c.Labels["com.dokku.process-type"]
+		if processType == "" {
+			processType = "web"
+		}
+		data := map[string]interface{}{
+			"container_id": c.ID[:min(12, len(c.ID))],
+			"process_type": processType,
+			"state":        c.State,
+			"status":       c.Status,
+		}
+		if exitCode >= 0 {
+			data["exit_code"] = exitCode
+		}
+		InfoLog("App %s crashed: container %s is %s", appName, data["container_id"], c.Status)
+		EmitAppEvent(appName, EventAppCrashed, data)
+	}
+
+	crashWatch.crashed = crashed
+	crashWatch.primed = true
+	return nil
+}
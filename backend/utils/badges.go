@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"time"
+	"unicode/utf8"
+
+	"backend/database/api"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+const (
+	// UptimeWindow is the period the uptime badge covers
+	UptimeWindow = 30 * 24 * time.Hour
+	// UptimeRetention is how long uptime samples are kept
+	UptimeRetention = 90 * 24 * time.Hour
+)
+
+// Badge colors, those of shields.io so badges fit next to the other badges of a README
+const (
+	BadgeColorGreen  = "#4c1"
+	BadgeColorYellow = "#dfb317"
+	BadgeColorRed    = "#e05d44"
+	BadgeColorBlue   = "#007ec6"
+	BadgeColorGrey   = "#9f9f9f"
+)
+
+// SampleAppUptime records whether each app with badges enabled has a running web container.
+// Worker-only apps, and apps without web process, count as up with any running container.
+func SampleAppUptime(ctx context.Context) error {
+	apps, err := api.Apps.ListBadgeApps(ctx)
+	if err != nil || len(apps) == 0 {
+		return err
+	}
+
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", "com.dokku.app-name"),
+			filters.Arg("label", "com.dokku.container-type=deploy"),
+			filters.Arg("status", "running"),
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list app containers: %w", err)
+	}
+
+	running := make(map[string]map[string]bool)
+	for _, c := range containers {
+		appName := c.Labels["com.dokku.app-name"]
+		if running[appName] == nil {
+			running[appName] = make(map[string]bool)
+		}
+		running[appName][c.Labels["com.dokku.process-type"]] = true
+	}
+
+	appTypes, err := api.Apps.ListAppTypes(ctx)
+	if err != nil {
+		WarnLog("Uptime sampling without app types: %v", err)
+	}
+
+	up := make(map[string]bool, len(apps))
+	for _, appName := range apps {
+		processTypes := running[appName]
+		worker := appTypes[appName] == AppTypeWorker
+		up[appName] = processTypes["web"] || (len(processTypes) > 0 && (worker || !appHasWebProcess(appName)))
+	}
+	return api.Apps.RecordUptimeSamples(ctx, time.Now().UTC().Truncate(time.Hour), up)
+}
+
+// appHasWebProcess reports whether an app is scaled with a web process, assuming it is when the
+// scale can't be read
+func appHasWebProcess(appName string) bool {
+	output, err := CitizenCommand("ps:scale", appName)
+	if err != nil {
+		return true
+	}
+	return parseProcessScale(output)["web"] > 0
+}
+
+// UptimeBadgeColor picks the color of an uptime percentage
+func UptimeBadgeColor(percent float64) string {
+	switch {
+	case percent >= 99.9:
+		return BadgeColorGreen
+	case percent >= 99:
+		return BadgeColorYellow
+	default:
+		return BadgeColorRed
+	}
+}
+
+// RenderBadgeSVG draws a flat badge with a label on the left and a colored message on the right
+func RenderBadgeSVG(label, message, color string) string {
+	labelWidth := badgeTextWidth(label)
+	messageWidth := badgeTextWidth(message)
+	width := labelWidth + messageWidth
+	label, message = html.EscapeString(label), html.EscapeString(message)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">`+
+		`<title>%[4]s: %[5]s</title>`+
+		`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`+
+		`<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>`+
+		`<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%[7]d" y="15" fill="#010101" fill-opacity=".3">%[4]s</text><text x="%[7]d" y="14">%[4]s</text>`+
+		`<text x="%[8]d" y="15" fill="#010101" fill-opacity=".3">%[5]s</text><text x="%[8]d" y="14">%[5]s</text>`+
+		`</g></svg>`,
+		width, labelWidth, messageWidth, label, message, html.EscapeString(color),
+		labelWidth/2, labelWidth+messageWidth/2)
+}
+
+// badgeTextWidth approximates the width of a badge text in Verdana 11px, with its padding
+func badgeTextWidth(text string) int {
+	return utf8.RuneCountInString(text)*7 + 10
+}
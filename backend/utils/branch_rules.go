@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"backend/database/api"
+)
+
+// Branch rule pattern types
+const (
+	BranchPatternGlob  = "glob"  // path.Match syntax, * doesn't cross a / (release/* matches release/1.2)
+	BranchPatternRegex = "regex" // RE2 syntax matched against the whole branch name
+)
+
+// Deploy triggers of a connected repository
+const (
+	DeployTriggerBranch = "branch" // pushes to the deploy branch or matching a branch rule deploy
+	DeployTriggerTag    = "tag"    // pushed tags matching the tag pattern deploy the connected app
+)
+
+// maxBranchRules bounds the rules of a connected app
+const maxBranchRules = 50
+
+// BranchMatch tells what a push to a ref deploys
+type BranchMatch struct {
+	Ref    string `json:"ref"`
+	Branch string `json:"branch,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+	Deploy bool   `json:"deploy"`
+	// TargetApp is the app the push deploys, empty when it deploys nothing
+	TargetApp string          `json:"target_app,omitempty"`
+	Rule      *api.BranchRule `json:"rule,omitempty"`
+	Reason    string          `json:"reason"`
+}
+
+// ValidateBranchRule checks a rule has a valid pattern of a known type and a target app,
+// defaulting the type to glob
+func ValidateBranchRule(rule *api.BranchRule) error {
+	rule.Pattern = strings.TrimSpace(rule.Pattern)
+	if rule.Pattern == "" || len(rule.Pattern) > 255 {
+		return fmt.Errorf("pattern must be between 1 and 255 characters")
+	}
+	if rule.PatternType == "" {
+		rule.PatternType = BranchPatternGlob
+	}
+	switch rule.PatternType {
+	case BranchPatternGlob:
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern %q", rule.Pattern)
+		}
+	case BranchPatternRegex:
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid regex pattern %q: %v", rule.Pattern, err)
+		}
+	default:
+		return fmt.Errorf("pattern_type must be %s or %s", BranchPatternGlob, BranchPatternRegex)
+	}
+	if err := ValidateAppName(rule.TargetApp); err != nil {
+		return fmt.Errorf("invalid target_app for pattern %q: %v", rule.Pattern, err)
+	}
+	return nil
+}
+
+// ValidateBranchRules checks every rule of a connected app
+func ValidateBranchRules(rules []api.BranchRule) error {
+	if len(rules) > maxBranchRules {
+		return fmt.Errorf("at most %d branch rules are allowed", maxBranchRules)
+	}
+	for i := range rules {
+		if err := ValidateBranchRule(&rules[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateDeployPolicy checks a deploy trigger is known and that tag triggers have a valid glob
+// pattern, like v* or v*.*.*
+func ValidateDeployPolicy(trigger, tagPattern string) error {
+	switch trigger {
+	case DeployTriggerBranch:
+		return nil
+	case DeployTriggerTag:
+		if tagPattern == "" || len(tagPattern) > 255 {
+			return fmt.Errorf("tag_pattern must be between 1 and 255 characters")
+		}
+		if _, err := path.Match(tagPattern, ""); err != nil {
+			return fmt.Errorf("invalid tag pattern %q", tagPattern)
+		}
+		return nil
+	default:
+		return fmt.Errorf("deploy_trigger must be %s or %s", DeployTriggerBranch, DeployTriggerTag)
+	}
+}
+
+// branchRuleMatches reports whether a branch matches the pattern of a rule. Regexes must match the
+// whole branch name.
+func branchRuleMatches(rule api.BranchRule, branch string) bool {
+	switch rule.PatternType {
+	case BranchPatternRegex:
+		re, err := regexp.Compile("^(?:" + rule.Pattern + ")$")
+		return err == nil && re.MatchString(branch)
+	default:
+		matched, err := path.Match(rule.Pattern, branch)
+		return err == nil && matched
+	}
+}
+
+// MatchBranchRules resolves what a push to ref deploys for a connected app. With a tag trigger
+// only pushed tags matching the tag pattern deploy, the connected app. Otherwise the first rule
+// whose pattern matches the branch picks the target app, and without a matching rule the push
+// deploys the connected app when the branch is its deploy branch, unless the rules are strict.
+func MatchBranchRules(set *api.BranchRules, ref string) BranchMatch {
+	match := BranchMatch{Ref: ref}
+	if set.DeployTrigger == DeployTriggerTag {
+		return matchTagPolicy(set, match)
+	}
+	if strings.HasPrefix(ref, "refs/") && !strings.HasPrefix(ref, "refs/heads/") {
+		match.Reason = fmt.Sprintf("%s is not a branch", ref)
+		return match
+	}
+	match.Branch = strings.TrimPrefix(ref, "refs/heads/")
+
+	for i := range set.Rules {
+		if branchRuleMatches(set.Rules[i], match.Branch) {
+			match.Deploy = true
+			match.TargetApp = set.Rules[i].TargetApp
+			match.Rule = &set.Rules[i]
+			match.Reason = fmt.Sprintf("Branch %s matches %s pattern %s", match.Branch, set.Rules[i].PatternType, set.Rules[i].Pattern)
+			return match
+		}
+	}
+
+	switch {
+	case set.Strict:
+		match.Reason = fmt.Sprintf("Branch %s matches no branch rule (strict mode)", match.Branch)
+	case match.Branch == set.DeployBranch:
+		match.Deploy = true
+		match.TargetApp = set.AppName
+		match.Reason = fmt.Sprintf("Branch %s is the deploy branch", match.Branch)
+	default:
+		match.Reason = fmt.Sprintf("Branch %s does not match deploy branch %s", match.Branch, set.DeployBranch)
+	}
+	return match
+}
+
+// matchTagPolicy resolves a push for a connected app deployed on tags
+func matchTagPolicy(set *api.BranchRules, match BranchMatch) BranchMatch {
+	tag, ok := strings.CutPrefix(match.Ref, "refs/tags/")
+	if !ok {
+		match.Reason = fmt.Sprintf("%s is not a tag, %s deploys on tags matching %s", match.Ref, set.AppName, set.TagPattern)
+		return match
+	}
+	match.Tag = tag
+
+	if matched, err := path.Match(set.TagPattern, tag); err != nil || !matched {
+		match.Reason = fmt.Sprintf("Tag %s does not match tag pattern %s", tag, set.TagPattern)
+		return match
+	}
+	match.Deploy = true
+	match.TargetApp = set.AppName
+	match.Reason = fmt.Sprintf("Tag %s matches tag pattern %s", tag, set.TagPattern)
+	return match
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"backend/database/api"
+)
+
+// ValidateBuildPath checks a build path is a subdirectory of the repository, like apps/api
+func ValidateBuildPath(buildPath string) error {
+	if buildPath == "" {
+		return nil
+	}
+	if len(buildPath) > 255 || strings.HasPrefix(buildPath, "/") || strings.ContainsAny(buildPath, " \t\n\\'\"$`;&|*?") {
+		return fmt.Errorf("invalid build path %q, use a directory relative to the repository root", buildPath)
+	}
+	cleaned := path.Clean(buildPath)
+	if cleaned != buildPath || cleaned == "." || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return fmt.Errorf("invalid build path %q, use a clean directory inside the repository", buildPath)
+	}
+	return nil
+}
+
+// GetBuildDir returns the subdirectory dokku builds an app from, "" for the repository root
+func GetBuildDir(appName string) (string, error) {
+	return dokkuReportValue("builder:report", appName, "--builder-build-dir")
+}
+
+// SetBuildDir sets the subdirectory dokku builds an app from, back to the repository root when empty
+func SetBuildDir(appName, buildDir string) (string, error) {
+	if err := RequireCapability(FeatureBuilder); err != nil {
+		return "", err
+	}
+	args := []string{"builder:set", appName, "build-dir"}
+	if buildDir != "" {
+		args = append(args, buildDir)
+	}
+	return CitizenCommand(args...)
+}
+
+// SyncBuildPath sets the build directory of an app to the build path of its repository connection
+// before a deploy. Apps without a connection keep the build directory set on the host.
+func SyncBuildPath(ctx context.Context, appName string) error {
+	buildPath, err := api.GitHub.GetBuildPath(ctx, appName)
+	if errors.Is(err, api.ErrRepositoryNotConnected) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	current, err := GetBuildDir(appName)
+	if err != nil {
+		// Hosts without builder:report don't support build directories, only a set path needs one
+		if buildPath == "" {
+			return nil
+		}
+		return fmt.Errorf("failed to read the build directory: %w", err)
+	}
+	if current == buildPath {
+		if buildPath != "" {
+			DiagnosticsFromContext(ctx).Info("build", "building from %s", buildPath)
+		}
+		return nil
+	}
+
+	if _, err := SetBuildDir(appName, buildPath); err != nil {
+		return fmt.Errorf("failed to set the build directory to %q: %w", buildPath, err)
+	}
+	if buildPath == "" {
+		DiagnosticsFromContext(ctx).Info("build", "building from the repository root")
+	} else {
+		DiagnosticsFromContext(ctx).Info("build", "building from %s", buildPath)
+	}
+	return nil
+}
+
+// BuildPath returns the subdirectory an app builds from: the build path of its repository
+// connection, or the build directory set on the host for apps without one
+func BuildPath(ctx context.Context, appName string) string {
+	buildPath, err := api.GitHub.GetBuildPath(ctx, appName)
+	if err == nil {
+		return buildPath
+	}
+	buildDir, _ := GetBuildDir(appName)
+	return buildDir
+}
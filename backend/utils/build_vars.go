@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"backend/database/api"
+)
+
+// ValidateBuildVar checks the key and value of a build variable
+func ValidateBuildVar(key, value string) error {
+	if !buildEnvKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid build variable key %q, use uppercase letters, digits and _", key)
+	}
+	if key == "PORT" {
+		return fmt.Errorf("PORT is set by Citizen and can't be a build variable")
+	}
+	if value == "" || len(value) > 4096 {
+		return fmt.Errorf("the value of %s must be between 1 and 4096 characters", key)
+	}
+	return nil
+}
+
+// SyncBuildVars replaces the build variables of an app on the dokku host with its stored ones,
+// removed keys included in case an earlier version set them as docker options. The citizen-env
+// plugin reads the values from stdin and passes them to every build in the form its builder reads:
+// build args for Dockerfile builds, env vars of the build container otherwise. Runs before every
+// deploy so a failed sync is caught up.
+func SyncBuildVars(ctx context.Context, appName string, removed ...string) error {
+	vars, err := api.Apps.ListBuildVars(ctx, appName)
+	if err != nil {
+		return err
+	}
+	if len(vars) == 0 && len(removed) == 0 {
+		return nil
+	}
+	if err := RequireCapability(FeatureEnvImport); err != nil {
+		return err
+	}
+
+	var input strings.Builder
+	for _, v := range vars {
+		value, err := DecryptString(v.ValueEncrypted)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt build variable %s: %w", v.Key, err)
+		}
+		input.WriteString(v.Key + "=" + base64.StdEncoding.EncodeToString([]byte(value)) + "\n")
+	}
+
+	args := append([]string{"citizen-env:build-import", appName}, removed...)
+	if _, err := runCommandInput(ctx, args, input.String()); err != nil {
+		return fmt.Errorf("failed to set the build variables: %w", err)
+	}
+	return nil
+}
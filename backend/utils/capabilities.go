@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Feature names used by handlers to check host support
+const (
+	FeatureGitSync     = "git_sync"
+	FeatureGitAuth     = "git_auth"
+	FeatureGitImage    = "git_from_image"
+	FeatureGitArchive  = "git_from_archive"
+	FeatureBuilder     = "builder"
+	FeatureBuildpacks  = "buildpacks"
+	FeatureAppLocking  = "app_locking"
+	FeatureLetsEncrypt = "letsencrypt"
+	FeaturePostgres    = "postgres"
+	FeatureRedis       = "redis"
+	FeatureEnvImport   = "env_import"
+)
+
+// featureRequirement is what the dokku host needs for a feature to work
+type featureRequirement struct {
+	minVersion string
+	plugin     string
+	guidance   string
+}
+
+var featureRequirements = map[string]featureRequirement{
+	FeatureGitSync: {
+		minVersion: "0.23.0",
+		guidance:   "Deploying from a git repository uses git:sync, upgrade dokku to 0.23.0 or later",
+	},
+	FeatureGitAuth: {
+		minVersion: "0.23.0",
+		guidance:   "Private repositories use git:auth, upgrade dokku to 0.23.0 or later",
+	},
+	FeatureGitImage: {
+		minVersion: "0.24.0",
+		guidance:   "Deploying an existing image uses git:from-image, upgrade dokku to 0.24.0 or later",
+	},
+	FeatureGitArchive: {
+		minVersion: "0.24.0",
+		guidance:   "Deploying an uploaded archive uses git:from-archive, upgrade dokku to 0.24.0 or later",
+	},
+	FeatureBuilder: {
+		minVersion: "0.25.0",
+		guidance:   "Selecting a builder uses builder:set, upgrade dokku to 0.25.0 or later",
+	},
+	FeatureBuildpacks: {
+		minVersion: "0.19.0",
+		guidance:   "Managing buildpacks uses the buildpacks plugin, upgrade dokku to 0.19.0 or later",
+	},
+	FeatureAppLocking: {
+		minVersion: "0.22.0",
+		guidance:   "Releasing deploy locks uses apps:unlock, upgrade dokku to 0.22.0 or later",
+	},
+	FeatureLetsEncrypt: {
+		plugin:   "letsencrypt",
+		guidance: "Install it with: dokku plugin:install https://github.com/dokku/dokku-letsencrypt.git",
+	},
+	FeaturePostgres: {
+		plugin:   "postgres",
+		guidance: "Install it with: dokku plugin:install https://github.com/dokku/dokku-postgres.git postgres",
+	},
+	FeatureRedis: {
+		plugin:   "redis",
+		guidance: "Install it with: dokku plugin:install https://github.com/dokku/dokku-redis.git redis",
+	},
+	FeatureEnvImport: {
+		plugin:   "citizen-env",
+		guidance: "Setting env vars sends their values over stdin with the citizen-env plugin, copy docker/scripts/dokku/plugins/citizen-env to /var/lib/dokku/plugins/available on the host and run: dokku plugin:enable citizen-env",
+	},
+}
+
+// Capabilities describes what the dokku host supports
+type Capabilities struct {
+	DokkuVersion string            `json:"dokku_version"`
+	Plugins      map[string]string `json:"plugins"`
+	Features     map[string]bool   `json:"features"`
+	ProbedAt     time.Time         `json:"probed_at"`
+}
+
+// CapabilityError is returned when the dokku host lacks a feature
+type CapabilityError struct {
+	Feature  string `json:"feature"`
+	Required string `json:"required"`
+	Guidance string `json:"guidance"`
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("dokku host does not support %s (requires %s)", e.Feature, e.Required)
+}
+
+var (
+	cachedCapabilities *Capabilities
+	capabilitiesMu     sync.Mutex
+)
+
+// GetCapabilities returns the host capabilities, probing the host only the first time or on refresh
+func GetCapabilities(refresh bool) (*Capabilities, error) {
+	capabilitiesMu.Lock()
+	defer capabilitiesMu.Unlock()
+
+	if cachedCapabilities != nil && !refresh {
+		return cachedCapabilities, nil
+	}
+
+	version, err := GetDokkuVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dokku version: %w", err)
+	}
+	plugins, err := ListPlugins()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plugins: %w", err)
+	}
+
+	capabilities := &Capabilities{
+		DokkuVersion: version,
+		Plugins:      make(map[string]string, len(plugins)),
+		Features:     make(map[string]bool, len(featureRequirements)),
+		ProbedAt:     time.Now(),
+	}
+	for _, plugin := range plugins {
+		if plugin.Enabled {
+			capabilities.Plugins[plugin.Name] = plugin.Version
+		}
+	}
+	for feature, requirement := range featureRequirements {
+		capabilities.Features[feature] = requirement.satisfiedBy(capabilities)
+	}
+
+	cachedCapabilities = capabilities
+	return capabilities, nil
+}
+
+// InvalidateCapabilities forces the next GetCapabilities call to probe the host again
+func InvalidateCapabilities() {
+	capabilitiesMu.Lock()
+	cachedCapabilities = nil
+	capabilitiesMu.Unlock()
+}
+
+// RequireCapability returns a *CapabilityError when the host lacks feature. When the host can't be
+// probed the check passes, so an unreachable host surfaces its own error from the actual command.
+func RequireCapability(feature string) error {
+	requirement, ok := featureRequirements[feature]
+	if !ok {
+		return nil
+	}
+
+	capabilities, err := GetCapabilities(false)
+	if err != nil {
+		WarnLog("Capability check for %s skipped: %v", feature, err)
+		return nil
+	}
+	if capabilities.Features[feature] {
+		return nil
+	}
+
+	required := "dokku " + requirement.minVersion
+	if requirement.plugin != "" {
+		required = "the " + requirement.plugin + " plugin"
+	}
+	return &CapabilityError{
+		Feature:  feature,
+		Required: required,
+		Guidance: requirement.guidance,
+	}
+}
+
+// satisfiedBy reports whether the probed host meets the requirement
+func (r featureRequirement) satisfiedBy(capabilities *Capabilities) bool {
+	if r.plugin != "" {
+		if _, installed := capabilities.Plugins[r.plugin]; !installed {
+			return false
+		}
+	}
+	if r.minVersion != "" {
+		return compareVersions(capabilities.DokkuVersion, r.minVersion) >= 0
+	}
+	return true
+}
+
+// compareVersions compares dotted numeric versions, ignoring any pre-release suffix.
+// Unparseable versions (e.g. a master build) are treated as newest.
+func compareVersions(a, b string) int {
+	partsA, okA := parseVersion(a)
+	partsB, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return 1
+	case !okB:
+		return -1
+	}
+
+	for i := 0; i < 3; i++ {
+		if partsA[i] != partsB[i] {
+			if partsA[i] < partsB[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseVersion parses "0.35.12" (optionally prefixed with v or suffixed with -rc1) into numbers
+func parseVersion(version string) ([3]int, bool) {
+	var parts [3]int
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if idx := strings.IndexAny(version, "-+ "); idx >= 0 {
+		version = version[:idx]
+	}
+
+	fields := strings.Split(version, ".")
+	if len(fields) < 2 {
+		return parts, false
+	}
+	for i := 0; i < len(fields) && i < 3; i++ {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"backend/database/api"
+)
+
+// ChangelogEntry is a tag deployed to an app with the tag deployed before it
+type ChangelogEntry struct {
+	Tag           string    `json:"tag"`
+	ReleaseNumber int       `json:"release_number"`
+	ReleaseName   string    `json:"release_name,omitempty"`
+	DeploymentID  int       `json:"deployment_id"`
+	Commit        string    `json:"commit,omitempty"`
+	DeployedAt    time.Time `json:"deployed_at"`
+	PreviousTag   string    `json:"previous_tag,omitempty"`
+	// CompareURL shows the commits between the previous tag and this one on GitHub
+	CompareURL string `json:"compare_url,omitempty"`
+}
+
+// BuildChangelog turns the successful tag deployments of an app, newest first, into one entry per
+// tag. A tag deployed again (a redeploy or a rollback to it) keeps its latest deployment.
+func BuildChangelog(records []api.DeploymentRecord) []ChangelogEntry {
+	seen := make(map[string]bool, len(records))
+	entries := []ChangelogEntry{}
+	newerGitURL := ""
+	for _, record := range records {
+		if record.GitTag == "" || seen[record.GitTag] {
+			continue
+		}
+		seen[record.GitTag] = true
+		deployedAt := record.StartedAt
+		if record.FinishedAt != nil {
+			deployedAt = *record.FinishedAt
+		}
+		entries = append(entries, ChangelogEntry{
+			Tag:           record.GitTag,
+			ReleaseNumber: record.ReleaseNumber,
+			ReleaseName:   record.ReleaseName,
+			DeploymentID:  record.ID,
+			Commit:        record.GitCommit,
+			DeployedAt:    deployedAt,
+		})
+		if n := len(entries); n > 1 {
+			linkChangelogEntries(&entries[n-2], record.GitTag, newerGitURL)
+		}
+		newerGitURL = record.GitURL
+	}
+	return entries
+}
+
+// linkChangelogEntries records the tag deployed before an entry and, when the entry was deployed
+// from GitHub, where to compare them
+func linkChangelogEntries(entry *ChangelogEntry, previousTag, gitURL string) {
+	entry.PreviousTag = previousTag
+	if owner, repo, ok := parseGitHubRepoURL(gitURL); ok {
+		entry.CompareURL = fmt.Sprintf("https://github.com/%s/%s/compare/%s...%s",
+			owner, repo, url.PathEscape(previousTag), url.PathEscape(entry.Tag))
+	}
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultTrustedProxies are the networks Traefik reaches Citizen from when TRUSTED_PROXIES is
+// unset: loopback and the private ranges of Docker networks
+var defaultTrustedProxies = []string{
+	"127.0.0.0/8", "::1/128",
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7",
+}
+
+// forwardedHeaders are the headers only trusted proxies may set
+var forwardedHeaders = []string{
+	fiber.HeaderXForwardedFor, "X-Real-IP", fiber.HeaderXForwardedHost,
+	fiber.HeaderXForwardedProto, "X-Forwarded-Port", "X-Forwarded-Uri", "X-Forwarded-Method", "Forwarded",
+}
+
+var (
+	trustedProxyNets  []*net.IPNet
+	trustedProxyOnce  sync.Once
+	trustedProxyInput []string
+)
+
+// TrustedProxies returns the trusted proxies from TRUSTED_PROXIES, comma separated addresses or
+// CIDRs, for the TrustedProxies setting of Fiber. Invalid entries are logged and left out.
+func TrustedProxies() []string {
+	loadTrustedProxies()
+	return trustedProxyInput
+}
+
+func loadTrustedProxies() {
+	trustedProxyOnce.Do(func() {
+		entries := defaultTrustedProxies
+		if value := strings.TrimSpace(os.Getenv("TRUSTED_PROXIES")); value != "" {
+			entries = strings.Split(value, ",")
+		}
+		for _, entry := range entries {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			network, err := ParseTrustedProxy(entry)
+			if err != nil {
+				WarnLog("Ignoring trusted proxy %q: %v", entry, err)
+				continue
+			}
+			trustedProxyNets = append(trustedProxyNets, network)
+			trustedProxyInput = append(trustedProxyInput, entry)
+		}
+	})
+}
+
+// ParseTrustedProxy parses a trusted proxy entry, an address is a network of one address
+func ParseTrustedProxy(entry string) (*net.IPNet, error) {
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: entry}
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(entry)
+	return network, err
+}
+
+// IsTrustedProxy reports whether an address belongs to a trusted proxy
+func IsTrustedProxy(address string) bool {
+	loadTrustedProxies()
+	ip := net.ParseIP(strings.TrimSpace(address))
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxyNets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client of a request. Forwarded headers are only read when
+// the request comes from a trusted proxy: X-Forwarded-For is walked from the right, proxies append
+// to it, and the first address that isn't a trusted proxy is the client. Security logs, rate
+// limits and audit records all use it.
+func ClientIP(c *fiber.Ctx) string {
+	remote := c.Context().RemoteIP().String()
+	if !IsTrustedProxy(remote) {
+		return remote
+	}
+
+	ips := c.IPs()
+	if len(ips) == 0 {
+		if realIP := strings.TrimSpace(c.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+			return realIP
+		}
+		return remote
+	}
+	client := remote
+	for i := len(ips) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(ips[i])
+		if net.ParseIP(ip) == nil {
+			// A malformed entry ends the chain, what is left of it can't be trusted
+			break
+		}
+		client = ip
+		if !IsTrustedProxy(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// SpoofedForwardedHeader returns the forwarded header a request from an untrusted source carries,
+// "" when it carries none or comes from a trusted proxy
+func SpoofedForwardedHeader(c *fiber.Ctx) string {
+	if IsTrustedProxy(c.Context().RemoteIP().String()) {
+		return ""
+	}
+	for _, header := range forwardedHeaders {
+		if c.Get(header) != "" {
+			return header
+		}
+	}
+	return ""
+}
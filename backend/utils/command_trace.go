@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxTracedCommands caps the number of commands kept per trace
+	maxTracedCommands = 50
+	// maxTracedOutput caps the stored output of each traced command
+	maxTracedOutput = 2000
+	// maxTraceAge is how long an unfinished trace is kept before it is discarded
+	maxTraceAge = 2 * time.Hour
+)
+
+// CommandRecord describes a single dokku command executed over SSH
+type CommandRecord struct {
+	Command    string    `json:"command"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Success    bool      `json:"success"`
+	Output     string    `json:"output,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Truncated  bool      `json:"truncated,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+}
+
+// CommandTrace collects the dokku commands run for an app while an activity is in progress
+type CommandTrace struct {
+	appName   string
+	startedAt time.Time
+	mu        sync.Mutex
+	records   []CommandRecord
+	dropped   int
+}
+
+var (
+	commandTraces   = make(map[*CommandTrace]struct{})
+	commandTracesMu sync.Mutex
+)
+
+// StartCommandTrace begins recording dokku commands that target appName
+func StartCommandTrace(appName string) *CommandTrace {
+	trace := &CommandTrace{
+		appName:   appName,
+		startedAt: time.Now(),
+	}
+
+	commandTracesMu.Lock()
+	defer commandTracesMu.Unlock()
+
+	// Drop traces whose activity never completed
+	for existing := range commandTraces {
+		if time.Since(existing.startedAt) > maxTraceAge {
+			delete(commandTraces, existing)
+		}
+	}
+	commandTraces[trace] = struct{}{}
+
+	return trace
+}
+
+// Stop ends the trace and returns the recorded commands
+func (t *CommandTrace) Stop() []CommandRecord {
+	commandTracesMu.Lock()
+	delete(commandTraces, t)
+	commandTracesMu.Unlock()
+
+	return t.Records()
+}
+
+// Records returns a copy of the commands recorded so far
+func (t *CommandTrace) Records() []CommandRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	records := make([]CommandRecord, len(t.records))
+	copy(records, t.records)
+	return records
+}
+
+// Dropped returns how many commands were not kept because the trace was full
+func (t *CommandTrace) Dropped() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+// add appends a record, respecting the per-trace cap
+func (t *CommandTrace) add(record CommandRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.records) >= maxTracedCommands {
+		t.dropped++
+		return
+	}
+	t.records = append(t.records, record)
+}
+
+// recordCommand stores an executed command in every active trace for the targeted app
+func recordCommand(args []string, requestID string, startedAt time.Time, output string, err error) {
+	commandTracesMu.Lock()
+	var targets []*CommandTrace
+	for trace := range commandTraces {
+		for _, arg := range args {
+			if arg == trace.appName {
+				targets = append(targets, trace)
+				break
+			}
+		}
+	}
+	commandTracesMu.Unlock()
+
+	if len(targets) == 0 {
+		return
+	}
+
+	record := CommandRecord{
+		Command:    sanitizeCommandArgs(args),
+		StartedAt:  startedAt,
+		DurationMs: time.Since(startedAt).Milliseconds(),
+		Success:    err == nil,
+		RequestID:  requestID,
+	}
+	if hidesCommandOutput(args) {
+		record.Output = "[hidden: output contains environment values]"
+	} else {
+		record.Output, record.Truncated = truncateOutput(stripANSIColors(output), maxTracedOutput)
+	}
+	if err != nil {
+		record.Error, _ = truncateOutput(stripANSIColors(err.Error()), maxTracedOutput)
+	}
+
+	for _, trace := range targets {
+		trace.add(record)
+	}
+}
+
+// sanitizeCommandArgs joins command arguments, hiding secrets such as env values and tokens
+func sanitizeCommandArgs(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	sanitized := make([]string, len(args))
+	copy(sanitized, args)
+
+	switch sanitized[0] {
+	case "config:set":
+		for i := 1; i < len(sanitized); i++ {
+			if idx := strings.Index(sanitized[i], "="); idx > 0 {
+				sanitized[i] = sanitized[i][:idx+1] + "***"
+			}
+		}
+	case "docker-options:add", "docker-options:remove":
+		// Options like --build-arg=KEY=VALUE or --env=KEY=VALUE may carry secrets
+		for i := 1; i < len(sanitized); i++ {
+			for _, prefix := range []string{"--build-arg=", "--env="} {
+				if rest, ok := strings.CutPrefix(sanitized[i], prefix); ok {
+					if key, _, found := strings.Cut(rest, "="); found {
+						sanitized[i] = prefix + key + "=***"
+					}
+				}
+			}
+		}
+	case "git:auth":
+		// git:auth <host> <username> <token>
+		if len(sanitized) > 3 {
+			sanitized[3] = "***"
+		}
+	}
+
+	return strings.Join(sanitized, " ")
+}
+
+// sensitiveOutputCommands print environment values and must never have their output logged
+var sensitiveOutputCommands = map[string]bool{
+	"config:show":   true,
+	"config:export": true,
+	"config:get":    true,
+	"config":        true,
+	// Build options may hold secret values, like the build variables of earlier versions
+	"docker-options:report": true,
+}
+
+// hidesCommandOutput reports whether the output of a command must be kept out of logs
+func hidesCommandOutput(args []string) bool {
+	return len(args) > 0 && sensitiveOutputCommands[args[0]]
+}
+
+// SanitizeCommandLine masks secrets in a space-joined dokku command for logging
+func SanitizeCommandLine(command string) string {
+	return sanitizeCommandArgs(strings.Fields(command))
+}
+
+// truncateOutput keeps the tail of long output, which usually holds the relevant result
+func truncateOutput(output string, limit int) (string, bool) {
+	if len(output) <= limit {
+		return output, false
+	}
+	return "..." + output[len(output)-limit:], true
+}
@@ -1,14 +1,14 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
-	"context"
+	"time"
 
 	"backend/database/api"
 	"github.com/pelletier/go-toml/v2"
@@ -100,195 +100,225 @@ type AppJson struct {
 	} `json:"formation"`
 }
 
-// DetectPortFromGitRepo detects port configuration from a Git repository with optional user authentication
+// portDetectionTimeout bounds the total time spent fetching config files for a deploy
+const portDetectionTimeout = 15 * time.Second
+
+// PortDetectionHint carries what a caller (e.g. a push webhook) already knows about the
+// commit being deployed, so unchanged config files don't have to be fetched again
+type PortDetectionHint struct {
+	CommitSHA    string   // commit being deployed
+	BaseSHA      string   // commit the changes are relative to (push "before")
+	ChangedFiles []string // files added, modified or removed between BaseSHA and CommitSHA
+}
+
+// DetectPortFromGitRepo detects port configuration from a Git repository with optional user authentication.
+// The repository root is listed with a single tree call and only the config files that exist are fetched.
 func DetectPortFromGitRepo(gitUrl, branch string, userID *int) (*ConfigPort, error) {
-	fmt.Printf("[CONFIG] ==================== DETECTING PORT CONFIG ====================\n")
-	fmt.Printf("[CONFIG] Git URL: %s\n", gitUrl)
-	fmt.Printf("[CONFIG] Branch: %s\n", branch)
-	
-	// Get GitHub access token if userID is provided
-	var accessToken string
-	if userID != nil && strings.Contains(gitUrl, "github.com") {
-		token, err := api.GitHub.GetUserGitHubAccessToken(context.Background(), *userID)
-		if err != nil {
-			fmt.Printf("[CONFIG] ⚠️ Failed to get GitHub access token for user %d: %v\n", *userID, err)
-			fmt.Printf("[CONFIG] Continuing without authentication (public repo assumed)\n")
-		} else {
-			accessToken = token
-			fmt.Printf("[CONFIG] 🔑 Using GitHub access token for private repository access\n")
-		}
+	return DetectPortFromGitRepoWithHint(gitUrl, branch, userID, nil)
+}
+
+// DetectPortFromGitRepoWithHint detects the port like DetectPortFromGitRepo, caching the
+// result per repository commit and reusing the previous commit's result when none of the
+// config files changed.
+func DetectPortFromGitRepoWithHint(gitUrl, branch string, userID *int, hint *PortDetectionHint) (*ConfigPort, error) {
+	trace := DetectDeployConfig(gitUrl, branch, userID, hint)
+	return trace.Port, trace.Err()
+}
+
+// DetectDeployConfig detects the port and builder of a deploy following the configured
+// detection order, returning a trace of every file checked
+func DetectDeployConfig(gitUrl, branch string, userID *int, hint *PortDetectionHint) *DetectionTrace {
+	startedAt := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), portDetectionTimeout)
+	defer cancel()
+
+	config := GetDetectionConfig(ctx)
+	trace := &DetectionTrace{Ref: branch, Order: config.Order, Steps: []DetectionStep{}}
+	defer finishTrace(trace, config, startedAt)
+
+	owner, repo, ok := parseGitHubRepoURL(gitUrl)
+	if !ok {
+		// For other Git providers, no config files can be fetched
+		trace.fail(fmt.Errorf("port detection is only supported for GitHub repositories"))
+		return trace
+	}
+	repository := owner + "/" + repo
+	trace.Repository = repository
+
+	accessToken := getGitHubAccessTokenForRepo(gitUrl, userID)
+	if accessToken != "" {
+		trace.note("using the GitHub token of user %d", *userID)
 	}
 
-	// Convert Git URL to raw file URLs with specific branch
-	rawUrls := convertGitToRawUrlsWithBranch(gitUrl, branch)
-	
-	fmt.Printf("[CONFIG] Generated raw URLs: %v\n", rawUrls)
-	
-	// Try to fetch and parse each config file
-	for _, configFile := range []string{"project.toml", "netlify.toml", "app.json"} {
-		if rawUrl, exists := rawUrls[configFile]; exists {
-			fmt.Printf("[CONFIG] Trying to fetch: %s from %s\n", configFile, rawUrl)
-			port, err := fetchAndParseConfigWithAuth(rawUrl, configFile, accessToken)
-			if err == nil && port != nil {
-				fmt.Printf("[CONFIG] ✅ SUCCESS: Found port %d from %s\n", port.Port, port.Source)
-				return port, nil
-			} else {
-				fmt.Printf("[CONFIG] ❌ FAILED: %s - %v\n", configFile, err)
+	// Resolve the commit being deployed so the result can be cached
+	var commitSHA string
+	if hint != nil && hint.CommitSHA != "" {
+		commitSHA = hint.CommitSHA
+	} else if sha, err := resolveGitHubCommitSHA(ctx, owner, repo, branch, accessToken); err == nil {
+		commitSHA = sha
+	} else {
+		trace.note("could not resolve commit of %s, cache disabled: %v", branch, err)
+	}
+	trace.Commit = commitSHA
+
+	if commitSHA != "" {
+		// A cached miss leaves Port nil, which finishTrace reports like a fresh miss
+		if port, _, hit := cachedPortDetection(ctx, repository, commitSHA); hit {
+			trace.Cached, trace.CachedFrom = true, commitSHA
+			trace.Port = port
+			return trace
+		}
+
+		// Reuse the base commit's result when no config file was touched by the push
+		if hint != nil && hint.BaseSHA != "" && hint.ChangedFiles != nil && !touchesPortConfig(hint.ChangedFiles, config.Order) {
+			if port, _, hit := cachedPortDetection(ctx, repository, hint.BaseSHA); hit {
+				trace.Cached, trace.CachedFrom = true, hint.BaseSHA
+				trace.note("config files unchanged since %s", hint.BaseSHA)
+				trace.Port = port
+				savePortDetection(ctx, repository, commitSHA, port)
+				return trace
 			}
-		} else {
-			fmt.Printf("[CONFIG] ⚠️ SKIPPED: %s - URL not generated\n", configFile)
 		}
 	}
-	
-	fmt.Printf("[CONFIG] ❌ NO PORT FOUND in any config file\n")
-	return nil, fmt.Errorf("no port configuration found in any config file")
-}
 
-// convertGitToRawUrlsWithBranch converts Git URL to raw file URLs with specific branch
-func convertGitToRawUrlsWithBranch(gitUrl, branch string) map[string]string {
-	// Remove .git suffix if present
-	cleanUrl := strings.TrimSuffix(gitUrl, ".git")
-	
-	// Convert GitHub URLs to raw format
-	if strings.Contains(cleanUrl, "github.com") {
-		rawBaseUrl := strings.Replace(cleanUrl, "github.com", "raw.githubusercontent.com", 1)
-		branchUrl := rawBaseUrl + "/" + branch
-		
-		return map[string]string{
-			"project.toml": branchUrl + "/project.toml",
-			"netlify.toml": branchUrl + "/netlify.toml",
-			"app.json":     branchUrl + "/app.json",
-			"package.json": branchUrl + "/package.json",
-		}
+	// Fetch at the resolved commit so the cached result matches exactly what is deployed
+	ref := branch
+	if commitSHA != "" {
+		ref = commitSHA
 	}
-	
-	// For other Git providers, return empty map
-	return map[string]string{}
-}
 
+	files, err := fetchGitHubRootFiles(ctx, owner, repo, ref, accessToken, config.Order)
+	if err != nil {
+		trace.fail(fmt.Errorf("failed to list repository files: %w", err))
+		return trace
+	}
+	detectFromFiles(trace, files)
+
+	if commitSHA != "" {
+		savePortDetection(ctx, repository, commitSHA, trace.Port)
+	}
+	return trace
+}
 
+// errNoPortConfig is returned when none of the config files define a port
+var errNoPortConfig = errors.New("no port configuration found in any config file")
 
-// fetchAndParseConfigWithAuth fetches and parses a config file from URL with optional authentication
-func fetchAndParseConfigWithAuth(url, configType, accessToken string) (*ConfigPort, error) {
-	// Create HTTP request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
+// touchesPortConfig reports whether any of the changed files is a root-level detection file
+func touchesPortConfig(changedFiles []string, order []string) bool {
+	for _, file := range changedFiles {
+		for _, configFile := range order {
+			if file == configFile {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	// Add GitHub authentication header if token is available
-	if accessToken != "" && strings.Contains(url, "raw.githubusercontent.com") {
-		req.Header.Set("Authorization", "token "+accessToken)
-		fmt.Printf("[CONFIG] 🔑 Added GitHub authentication header\n")
+// cachedPortDetection returns the cached result for a commit; hit is false when nothing is cached
+func cachedPortDetection(ctx context.Context, repository, commitSHA string) (port *ConfigPort, err error, hit bool) {
+	cached, cacheErr := api.PortDetection.GetCachedPort(ctx, repository, commitSHA)
+	if cacheErr != nil || cached == nil {
+		return nil, nil, false
+	}
+	if cached.Port == nil {
+		return nil, errNoPortConfig, true
 	}
 
-	// Make the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	source := ""
+	if cached.Source != nil {
+		source = *cached.Source
 	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode == 401 {
-		return nil, fmt.Errorf("unauthorized access to %s - private repository requires authentication", url)
+	return &ConfigPort{Port: *cached.Port, Source: source}, nil, true
+}
+
+// savePortDetection stores a detection result for a commit (nil port means nothing was found)
+func savePortDetection(ctx context.Context, repository, commitSHA string, port *ConfigPort) {
+	var portValue *int
+	var source *string
+	if port != nil {
+		portValue = &port.Port
+		source = &port.Source
 	}
-	
-	if resp.StatusCode == 404 {
-		return nil, fmt.Errorf("file not found: %s", url)
+	if err := api.PortDetection.SaveCachedPort(ctx, repository, commitSHA, portValue, source); err != nil {
+		DebugLog("Failed to cache port detection for %s@%s: %v", repository, commitSHA, err)
 	}
-	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, url)
+}
+
+// getGitHubAccessTokenForRepo returns the user's GitHub token for GitHub repositories, or "" for public access
+func getGitHubAccessTokenForRepo(gitUrl string, userID *int) string {
+	if userID == nil || !strings.Contains(gitUrl, "github.com") {
+		return ""
 	}
-	
-	body, err := io.ReadAll(resp.Body)
+
+	token, err := api.GitHub.GetUserGitHubAccessToken(context.Background(), *userID)
 	if err != nil {
-		return nil, err
+		DebugLog("No GitHub access token for user %d, assuming a public repository: %v", *userID, err)
+		return ""
 	}
-	
-	// Parse based on config type
+
+	return token
+}
+
+// parsePortConfig parses a config file based on its name
+func parsePortConfig(configType string, data []byte) (*ConfigPort, error) {
 	switch configType {
 	case "project.toml":
-		return parseProjectToml(body)
+		return parseProjectToml(data)
 	case "netlify.toml":
-		return parseNetlifyToml(body)
+		return parseNetlifyToml(data)
 	case "app.json":
-		return parseAppJson(body)
+		return parseAppJson(data)
+	case "package.json":
+		return parsePackageJson(data)
 	default:
 		return nil, fmt.Errorf("unsupported config type: %s", configType)
 	}
 }
 
-// fetchAndParseConfig - backward compatibility wrapper
-func fetchAndParseConfig(url, configType string) (*ConfigPort, error) {
-	return fetchAndParseConfigWithAuth(url, configType, "")
-}
-
 // parseProjectToml parses project.toml file
 func parseProjectToml(data []byte) (*ConfigPort, error) {
-	fmt.Printf("[TOML] ==================== PARSING PROJECT.TOML ====================\n")
-	fmt.Printf("[TOML] Data length: %d bytes\n", len(data))
-	previewLen := 200
-	if len(data) < previewLen {
-		previewLen = len(data)
-	}
-	fmt.Printf("[TOML] First %d chars: %s\n", previewLen, string(data[:previewLen]))
-	
 	var config ProjectToml
 	if err := toml.Unmarshal(data, &config); err != nil {
-		fmt.Printf("[TOML] ❌ UNMARSHAL ERROR: %v\n", err)
 		return nil, err
 	}
-	
-	fmt.Printf("[TOML] ✅ Successfully parsed TOML\n")
-	
+
 	// Try different port sources in order of preference
 	// Check metadata sections first (CNB standard)
-	fmt.Printf("[TOML] Checking metadata.dokku.port: %d\n", config.Metadata.Dokku.Port)
 	if config.Metadata.Dokku.Port != 0 {
-		fmt.Printf("[TOML] ✅ Found port in metadata.dokku.port: %d\n", config.Metadata.Dokku.Port)
 		return &ConfigPort{
 			Port:   config.Metadata.Dokku.Port,
 			Source: "project.toml (metadata.dokku.port)",
 		}, nil
 	}
-	
-	fmt.Printf("[TOML] Checking metadata.deploy.port: %d\n", config.Metadata.Deploy.Port)
+
 	if config.Metadata.Deploy.Port != 0 {
-		fmt.Printf("[TOML] ✅ Found port in metadata.deploy.port: %d\n", config.Metadata.Deploy.Port)
 		return &ConfigPort{
 			Port:   config.Metadata.Deploy.Port,
 			Source: "project.toml (metadata.deploy.port)",
 		}, nil
 	}
-	
+
 	// Fallback to direct sections
-	fmt.Printf("[TOML] Checking dokku.port: %d\n", config.Dokku.Port)
 	if config.Dokku.Port != 0 {
-		fmt.Printf("[TOML] ✅ Found port in dokku.port: %d\n", config.Dokku.Port)
 		return &ConfigPort{
 			Port:   config.Dokku.Port,
 			Source: "project.toml (dokku.port)",
 		}, nil
 	}
-	
-	fmt.Printf("[TOML] Checking deploy.port: %d\n", config.Deploy.Port)
+
 	if config.Deploy.Port != 0 {
-		fmt.Printf("[TOML] ✅ Found port in deploy.port: %d\n", config.Deploy.Port)
 		return &ConfigPort{
 			Port:   config.Deploy.Port,
 			Source: "project.toml (deploy.port)",
 		}, nil
 	}
-	
+
 	// Check environment variables
-	fmt.Printf("[TOML] Checking build.env variables: %d entries\n", len(config.Build.Env))
-	for i, env := range config.Build.Env {
-		fmt.Printf("[TOML] Env[%d]: %s = %s\n", i, env.Name, env.Value)
+	for _, env := range config.Build.Env {
 		if env.Name == "PORT" {
 			if port, err := strconv.Atoi(env.Value); err == nil {
-				fmt.Printf("[TOML] ✅ Found port in build.env.PORT: %d\n", port)
 				return &ConfigPort{
 					Port:   port,
 					Source: "project.toml (build.env.PORT)",
@@ -296,9 +326,8 @@ func parseProjectToml(data []byte) (*ConfigPort, error) {
 			}
 		}
 	}
-	
-	fmt.Printf("[TOML] ❌ NO PORT FOUND in any section\n")
-	return nil, fmt.Errorf("no port found in project.toml")
+
+	return nil, fmt.Errorf("%w in project.toml", errNoPortInFile)
 }
 
 // parseNetlifyToml parses netlify.toml file
@@ -335,7 +364,7 @@ func parseNetlifyToml(data []byte) (*ConfigPort, error) {
 		}
 	}
 	
-	return nil, fmt.Errorf("no port found in netlify.toml")
+	return nil, fmt.Errorf("%w in netlify.toml", errNoPortInFile)
 }
 
 // parseAppJson parses app.json file (Heroku-style)
@@ -355,78 +384,44 @@ func parseAppJson(data []byte) (*ConfigPort, error) {
 		}
 	}
 	
-	return nil, fmt.Errorf("no port found in app.json")
+	return nil, fmt.Errorf("%w in app.json", errNoPortInFile)
 }
 
 // ExtractPortFromPackageJson extracts port from package.json start scripts with optional authentication
 func ExtractPortFromPackageJson(gitUrl, branch string, userID *int) (*ConfigPort, error) {
-	// Get GitHub access token if userID is provided
-	var accessToken string
-	if userID != nil && strings.Contains(gitUrl, "github.com") {
-		token, err := api.GitHub.GetUserGitHubAccessToken(context.Background(), *userID)
-		if err != nil {
-			fmt.Printf("[CONFIG] ⚠️ Failed to get GitHub access token for user %d: %v\n", *userID, err)
-		} else {
-			accessToken = token
-			fmt.Printf("[CONFIG] 🔑 Using GitHub access token for package.json access\n")
-		}
-	}
-
-	// Convert to raw URL for package.json with specific branch
-	rawUrls := convertGitToRawUrlsWithBranch(gitUrl, branch)
-	rawUrl := rawUrls["package.json"]
-	
-	if rawUrl == "" {
+	owner, repo, ok := parseGitHubRepoURL(gitUrl)
+	if !ok {
 		return nil, fmt.Errorf("could not generate package.json URL")
 	}
-	
-	// Create HTTP request
-	req, err := http.NewRequest("GET", rawUrl, nil)
-	if err != nil {
-		return nil, err
-	}
 
-	// Add GitHub authentication header if token is available
-	if accessToken != "" {
-		req.Header.Set("Authorization", "token "+accessToken)
-		fmt.Printf("[CONFIG] 🔑 Added GitHub authentication header for package.json\n")
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), portDetectionTimeout)
+	defer cancel()
 
-	// Make the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	files, err := fetchGitHubRootFiles(ctx, owner, repo, branch, getGitHubAccessTokenForRepo(gitUrl, userID), []string{"package.json"})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode == 401 {
-		return nil, fmt.Errorf("unauthorized access to package.json - private repository requires authentication")
+	data, exists := files["package.json"]
+	if !exists {
+		return nil, errNoPortConfig
 	}
-	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("package.json not found or inaccessible")
-	}
-	
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	
-	// Parse package.json
+	return parsePackageJson(data)
+}
+
+// parsePackageJson extracts a port from the package.json start script
+func parsePackageJson(data []byte) (*ConfigPort, error) {
 	var pkg struct {
 		Scripts map[string]string `json:"scripts"`
 	}
 	
-	if err := json.Unmarshal(body, &pkg); err != nil {
+	if err := json.Unmarshal(data, &pkg); err != nil {
 		return nil, err
 	}
 	
 	// Look for port in start script
 	if startScript, exists := pkg.Scripts["start"]; exists {
 		// Extract port from common patterns
-		portRegex := regexp.MustCompile(`(?:PORT[=:]|--port[=\s]|port[=\s])(\d+)`)
-		matches := portRegex.FindStringSubmatch(startScript)
+		matches := packageJsonPortRegex.FindStringSubmatch(startScript)
 		
 		if len(matches) > 1 {
 			if port, err := strconv.Atoi(matches[1]); err == nil {
@@ -438,5 +433,8 @@ func ExtractPortFromPackageJson(gitUrl, branch string, userID *int) (*ConfigPort
 		}
 	}
 	
-	return nil, fmt.Errorf("no port found in package.json")
-} 
\ No newline at end of file
+	return nil, fmt.Errorf("%w in package.json", errNoPortInFile)
+}
+
+// packageJsonPortRegex matches common port flags in start scripts
+var packageJsonPortRegex = regexp.MustCompile(`(?:PORT[=:]|--port[=\s]|port[=\s])(\d+)`)
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CorrelationIDEnv is the environment variable carrying the correlation ID to dokku commands
+const CorrelationIDEnv = "CITIZEN_REQUEST_ID"
+
+// correlationIDPattern is what an ID received from a client must look like to be reused
+var correlationIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+type correlationIDKey struct{}
+
+// NewCorrelationID returns a random ID for a request or a background job
+func NewCorrelationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidCorrelationID reports whether a client supplied ID is safe to reuse in logs and commands
+func ValidCorrelationID(id string) bool {
+	return correlationIDPattern.MatchString(id)
+}
+
+// WithCorrelationID returns a context carrying a correlation ID
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID of a context, or an empty string
+func CorrelationIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// appCorrelationIDs are the IDs of the requests in progress per app, so commands run without
+// a request context are still attributed to the requests working on their app
+var (
+	appCorrelationIDs   = make(map[string]map[string]int)
+	appCorrelationIDsMu sync.Mutex
+)
+
+// BindAppCorrelationID attributes the commands targeting an app to a correlation ID until the
+// returned function is called
+func BindAppCorrelationID(appName, id string) func() {
+	appCorrelationIDsMu.Lock()
+	if appCorrelationIDs[appName] == nil {
+		appCorrelationIDs[appName] = make(map[string]int)
+	}
+	appCorrelationIDs[appName][id]++
+	appCorrelationIDsMu.Unlock()
+
+	return func() {
+		appCorrelationIDsMu.Lock()
+		defer appCorrelationIDsMu.Unlock()
+		if appCorrelationIDs[appName][id]--; appCorrelationIDs[appName][id] <= 0 {
+			delete(appCorrelationIDs[appName], id)
+		}
+		if len(appCorrelationIDs[appName]) == 0 {
+			delete(appCorrelationIDs, appName)
+		}
+	}
+}
+
+// commandCorrelationID returns the correlation ID of a dokku command: the one of its context,
+// otherwise the IDs bound to the apps it targets, comma separated when several requests overlap
+func commandCorrelationID(ctx context.Context, args []string) string {
+	if id := CorrelationIDFromContext(ctx); id != "" {
+		return id
+	}
+
+	appCorrelationIDsMu.Lock()
+	defer appCorrelationIDsMu.Unlock()
+	if len(appCorrelationIDs) == 0 {
+		return ""
+	}
+	var ids []string
+	for _, arg := range args {
+		for id := range appCorrelationIDs[arg] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"backend/database/api"
+)
+
+// DashboardAccessSettingKey is the system setting holding the dashboard access config as JSON
+const DashboardAccessSettingKey = "auth.dashboard_access"
+
+// DashboardAccessConfig lets the dashboard be served from hosts outside LOGIN_HOST
+type DashboardAccessConfig struct {
+	// Origins are extra origins allowed to call the API with credentials, like
+	// "https://panel.example.com"
+	Origins []string `json:"origins"`
+	// CookieDomains are domains SSO cookies are shared across, like "example.com" for every
+	// host under it
+	CookieDomains []string `json:"cookie_domains"`
+}
+
+var (
+	dashboardAccess   = &DashboardAccessConfig{Origins: []string{}, CookieDomains: []string{}}
+	dashboardAccessMu sync.RWMutex
+)
+
+// LoadDashboardAccessConfig reads the stored dashboard access config into memory, as it is
+// checked on every cross-origin request
+func LoadDashboardAccessConfig(ctx context.Context) error {
+	value, err := api.Settings.GetSystemSetting(ctx, DashboardAccessSettingKey)
+	if errors.Is(err, api.ErrSettingNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var stored DashboardAccessConfig
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return fmt.Errorf("invalid dashboard access config stored: %w", err)
+	}
+	if err := stored.Validate(); err != nil {
+		return fmt.Errorf("invalid dashboard access config stored: %w", err)
+	}
+
+	dashboardAccessMu.Lock()
+	dashboardAccess = &stored
+	dashboardAccessMu.Unlock()
+	return nil
+}
+
+// GetDashboardAccessConfig returns the dashboard access config in use, it must not be modified
+func GetDashboardAccessConfig() *DashboardAccessConfig {
+	dashboardAccessMu.RLock()
+	defer dashboardAccessMu.RUnlock()
+	return dashboardAccess
+}
+
+// SaveDashboardAccessConfig validates, stores and applies the dashboard access config
+func SaveDashboardAccessConfig(ctx context.Context, config *DashboardAccessConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := api.Settings.SetSystemSetting(ctx, DashboardAccessSettingKey, string(value)); err != nil {
+		return err
+	}
+
+	dashboardAccessMu.Lock()
+	dashboardAccess = config
+	dashboardAccessMu.Unlock()
+	return nil
+}
+
+// Validate normalizes the origins to scheme://host[:port] and the cookie domains to bare
+// hostnames, rejecting anything else
+func (c *DashboardAccessConfig) Validate() error {
+	if c.Origins == nil {
+		c.Origins = []string{}
+	}
+	if c.CookieDomains == nil {
+		c.CookieDomains = []string{}
+	}
+
+	for i, origin := range c.Origins {
+		parsed, err := url.Parse(strings.ToLower(strings.TrimSpace(origin)))
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" ||
+			parsed.User != nil || strings.Trim(parsed.Path, "/") != "" || parsed.RawQuery != "" ||
+			strings.Contains(parsed.Host, "*") {
+			return fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+		}
+		c.Origins[i] = parsed.Scheme + "://" + parsed.Host
+	}
+
+	for i, domain := range c.CookieDomains {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain == "" || strings.ContainsAny(domain, "/:@* ") {
+			return fmt.Errorf("invalid cookie domain %q", c.CookieDomains[i])
+		}
+		// Browsers reject cookies for a public suffix, a single label is always one
+		if !strings.Contains(domain, ".") && domain != "localhost" {
+			return fmt.Errorf("cookie domain %q is too broad", c.CookieDomains[i])
+		}
+		c.CookieDomains[i] = domain
+	}
+	return nil
+}
+
+// AllowsOrigin reports whether an origin was added to the dashboard origins
+func (c *DashboardAccessConfig) AllowsOrigin(origin string) bool {
+	origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	for _, allowed := range c.Origins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// CookieDomainFor returns the configured cookie domain a host belongs to
+func (c *DashboardAccessConfig) CookieDomainFor(host string) (string, bool) {
+	host = strings.ToLower(host)
+	if h, _, found := strings.Cut(host, ":"); found {
+		host = h
+	}
+	for _, domain := range c.CookieDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return domain, true
+		}
+	}
+	return "", false
+}
+
+// DashboardOriginAllowed reports whether an origin may call the API with credentials: in
+// production MAIN_DOMAIN and its subdomains over HTTPS, in development localhost, and the
+// configured dashboard origins
+func DashboardOriginAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if GetDashboardAccessConfig().AllowsOrigin(origin) {
+		return true
+	}
+
+	if IsDevelopmentEnvironment() {
+		// Allow localhost and any *.localhost subdomain, and common dev ports
+		return strings.Contains(origin, "localhost") || strings.Contains(origin, "127.0.0.1")
+	}
+
+	mainDomain := os.Getenv("MAIN_DOMAIN")
+	if mainDomain == "" {
+		mainDomain = "localhost" // Fallback for testing
+	}
+	host, ok := strings.CutPrefix(origin, "https://")
+	return ok && (host == mainDomain || strings.HasSuffix(host, "."+mainDomain))
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"backend/database/api"
+)
+
+// NotifyDeploymentApprovers announces a deployment waiting for approval: the
+// deployment.pending_approval event goes to the webhooks of the app and, when SMTP is configured,
+// every admin with an email address is told how to approve or reject it
+func NotifyDeploymentApprovers(ctx context.Context, record *api.DeploymentRecord) {
+	data := map[string]interface{}{
+		"deployment_id": record.ID,
+		"git_url":       record.GitURL,
+		"git_branch":    record.GitBranch,
+		"git_commit":    record.GitCommit,
+		"trigger_type":  record.TriggerType,
+	}
+	if record.GitTag != "" {
+		data["git_tag"] = record.GitTag
+	}
+	EmitAppEvent(record.AppName, EventDeploymentPendingApproval, data)
+
+	if !SMTPConfigured() {
+		return
+	}
+	emails, err := api.Users.ListAdminEmails(ctx)
+	if err != nil {
+		WarnLog("Failed to list the approvers of deployment %d: %v", record.ID, err)
+		return
+	}
+
+	subject := fmt.Sprintf("Deployment of %s waiting for approval", record.AppName)
+	body := renderApprovalRequest(record)
+	for _, email := range emails {
+		if err := sendPlainEmail(email, subject, body); err != nil {
+			WarnLog("Failed to email the approval request of deployment %d to %s: %v", record.ID, email, err)
+		}
+	}
+}
+
+// renderApprovalRequest renders the email asking admins to review a deployment
+func renderApprovalRequest(record *api.DeploymentRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "A deployment of the production app %s is waiting for approval.\n\n", record.AppName)
+	fmt.Fprintf(&b, "Deployment: %d\n", record.ID)
+	fmt.Fprintf(&b, "Repository: %s\n", record.GitURL)
+	if record.GitTag != "" {
+		fmt.Fprintf(&b, "Tag: %s\n", record.GitTag)
+	} else {
+		fmt.Fprintf(&b, "Branch: %s\n", record.GitBranch)
+	}
+	if record.GitCommit != "" {
+		fmt.Fprintf(&b, "Commit: %s\n", record.GitCommit)
+	}
+	fmt.Fprintf(&b, "\nApprove: POST /api/v1/citizen/deploys/%d/approve\n", record.ID)
+	fmt.Fprintf(&b, "Reject:  POST /api/v1/citizen/deploys/%d/reject\n", record.ID)
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Archive types git:from-archive accepts
+const (
+	ArchiveTypeTar   = "tar"
+	ArchiveTypeTarGz = "tar.gz"
+	ArchiveTypeZip   = "zip"
+)
+
+const defaultDeployArchiveMaxBytes = 256 << 20
+
+// DeployArchiveMaxBytes returns how large an uploaded deploy archive may be, from
+// DEPLOY_ARCHIVE_MAX_BYTES
+func DeployArchiveMaxBytes() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("DEPLOY_ARCHIVE_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return defaultDeployArchiveMaxBytes
+}
+
+// DetectArchiveType tells the type of an archive from its first bytes (at least 262 of them for a
+// tar archive), as uploads don't reliably say what they are
+func DetectArchiveType(header []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		return ArchiveTypeZip, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return ArchiveTypeTarGz, nil
+	case len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar")):
+		return ArchiveTypeTar, nil
+	}
+	return "", errors.New("the archive must be a .tar, .tar.gz or .zip file")
+}
+
+// DeployFromArchiveContext deploys an app from an archive of its source, streamed to
+// git:from-archive over SSH, and builds it like a git push would. Cancelling ctx stops the
+// deployment and releases the deploy lock of the app.
+func DeployFromArchiveContext(ctx context.Context, appName, archiveType string, archive io.Reader) (string, error) {
+	diagnostics := DiagnosticsFromContext(ctx)
+	diagnostics.Info("deploy", "deploying %s from an uploaded %s archive", appName, archiveType)
+
+	// "--" makes git:from-archive read the archive from stdin instead of downloading it
+	result, err := RunSSHCommandInput(ctx, fmt.Sprintf("git:from-archive --archive-type %s %s --", archiveType, appName), archive)
+	if err != nil && ctx.Err() != nil {
+		reason := DeploymentErrorStatus(ctx)
+		diagnostics.Error("deploy", "git:from-archive aborted (%s)", reason)
+
+		if RequireCapability(FeatureAppLocking) == nil {
+			if _, unlockErr := UnlockApp(appName); unlockErr != nil {
+				diagnostics.Warn("deploy", "failed to release the deploy lock: %v", unlockErr)
+			}
+		}
+
+		if reason == "timeout" {
+			return result, fmt.Errorf("deployment exceeded the maximum build duration of %s", GetMaxBuildDuration())
+		}
+		return result, ErrDeploymentCancelled
+	}
+	if err != nil {
+		diagnostics.Error("deploy", "git:from-archive failed: %v", err)
+		return result, err
+	}
+
+	diagnostics.Info("deploy", "git:from-archive completed")
+	signalRouteUpdate(diagnostics, appName, "archive")
+	return result, nil
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/database/api"
+)
+
+// Deploy hook stages
+const (
+	HookStagePreDeploy  = "pre_deploy"  // in the release deployed so far, before the build
+	HookStagePostDeploy = "post_deploy" // in the new release, once it is deployed
+)
+
+const (
+	// DefaultDeployHookTimeout bounds the hooks saved without a timeout
+	DefaultDeployHookTimeout = 5 * time.Minute
+	// MaxDeployHookTimeout is the longest a hook can ask to run
+	MaxDeployHookTimeout = time.Hour
+	// maxDeployHooksPerStage bounds the hooks of a stage
+	maxDeployHooksPerStage = 10
+	// deployHookLogLimit caps the output kept of a hook, larger outputs keep their head and tail
+	deployHookLogLimit = 1 << 20
+	// deployHookDetailsLimit caps the output of a hook shown in the activity details, the end is kept
+	deployHookDetailsLimit = 16 << 10
+)
+
+// ErrPreDeployHookFailed is returned when a pre-deploy hook stops a deployment
+var ErrPreDeployHookFailed = errors.New("a pre-deploy hook failed, the deployment was not started")
+
+// DeployHookResult is the outcome of a hook run for a deployment
+type DeployHookResult struct {
+	Stage      string `json:"stage"`
+	Command    string `json:"command"`
+	Status     string `json:"status"`
+	Output     string `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// ValidateDeployHooks checks the stage, command and timeout of hooks, trimming their commands and
+// defaulting their timeouts. Commands go through the dokku command line like pipeline test commands.
+func ValidateDeployHooks(hooks []api.DeployHook) error {
+	perStage := make(map[string]int)
+	for i := range hooks {
+		hook := &hooks[i]
+		if hook.Stage != HookStagePreDeploy && hook.Stage != HookStagePostDeploy {
+			return fmt.Errorf("hook %d: stage must be %s or %s", i+1, HookStagePreDeploy, HookStagePostDeploy)
+		}
+		if perStage[hook.Stage]++; perStage[hook.Stage] > maxDeployHooksPerStage {
+			return fmt.Errorf("at most %d %s hooks can be set", maxDeployHooksPerStage, hook.Stage)
+		}
+		hook.Command = strings.TrimSpace(hook.Command)
+		if hook.Command == "" || len(hook.Command) > 1024 {
+			return fmt.Errorf("hook %d: the command must be between 1 and 1024 characters", i+1)
+		}
+		if strings.ContainsAny(hook.Command, unsafePipelineCommandChars) {
+			return fmt.Errorf("hook %d: the command can't contain quotes, newlines or shell operators, run a script of the app instead", i+1)
+		}
+		if hook.TimeoutSeconds == 0 {
+			hook.TimeoutSeconds = int(DefaultDeployHookTimeout / time.Second)
+		}
+		if hook.TimeoutSeconds < 10 || hook.TimeoutSeconds > int(MaxDeployHookTimeout/time.Second) {
+			return fmt.Errorf("hook %d: the timeout must be between 10 and %d seconds", i+1, int(MaxDeployHookTimeout/time.Second))
+		}
+	}
+	return nil
+}
+
+// runDeployHookStage runs the hooks of a stage in order in one-off containers of the app, stopping
+// at the first failure, and records their results in the details of the deployment activity. It
+// returns their output for the deploy logs. Pre-deploy hooks are skipped while the app has no
+// release to run them in.
+func runDeployHookStage(ctx context.Context, appName, stage string, hooks []api.DeployHook) (string, error) {
+	var staged []api.DeployHook
+	for _, hook := range hooks {
+		if hook.Stage == stage {
+			staged = append(staged, hook)
+		}
+	}
+	if len(staged) == 0 {
+		return "", nil
+	}
+
+	diagnostics := DiagnosticsFromContext(ctx)
+	if stage == HookStagePreDeploy {
+		if deployed, err := dokkuReportValue("ps:report", appName, "--deployed"); err == nil && deployed != "true" {
+			diagnostics.Info("hooks", "%s is not deployed yet, skipping its pre-deploy hooks", appName)
+			return "", nil
+		}
+	}
+
+	var output strings.Builder
+	results := make([]DeployHookResult, 0, len(staged))
+	var stageErr error
+	for _, hook := range staged {
+		result := DeployHookResult{Stage: stage, Command: hook.Command, Status: "skipped"}
+		if stageErr != nil {
+			results = append(results, result)
+			continue
+		}
+
+		diagnostics.Info("hooks", "running %s hook: %s", stage, hook.Command)
+		timeout := time.Duration(hook.TimeoutSeconds) * time.Second
+		hookCtx, cancel := context.WithTimeout(ctx, timeout)
+		hookOutput := newBoundedOutput(deployHookLogLimit, false)
+		startedAt := time.Now()
+		err := StreamSSHCommand(hookCtx, strings.Join([]string{"run", appName, hook.Command}, " "), hookOutput)
+		timedOut := errors.Is(hookCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+		cancel()
+
+		result.DurationMs = time.Since(startedAt).Milliseconds()
+		logs := hookOutput.String()
+		fmt.Fprintf(&output, "\n\n=== %s hook: %s ===\n%s", stage, hook.Command, logs)
+		result.Output = logs
+		if len(logs) > deployHookDetailsLimit {
+			result.Output = logs[len(logs)-deployHookDetailsLimit:]
+		}
+		switch {
+		case err == nil:
+			result.Status = "success"
+			diagnostics.Info("hooks", "%s hook passed in %dms", stage, result.DurationMs)
+		case timedOut:
+			result.Status = "timeout"
+			stageErr = fmt.Errorf("%s hook %q exceeded %s", stage, hook.Command, timeout)
+		case ctx.Err() != nil:
+			result.Status = stageFailureStatus(ctx)
+			stageErr = fmt.Errorf("%s hook %q aborted: %w", stage, hook.Command, ctx.Err())
+		default:
+			result.Status = "failed"
+			stageErr = fmt.Errorf("%s hook %q failed: %w", stage, hook.Command, err)
+		}
+		if stageErr != nil {
+			result.Error = stageErr.Error()
+			diagnostics.Error("hooks", "%v", stageErr)
+		}
+		results = append(results, result)
+	}
+
+	recordDeployHookResults(ctx, appName, stage, results)
+	return output.String(), stageErr
+}
+
+// withPostDeployHooks runs the post-deploy hooks once a deploy succeeded and adds their output to
+// the deploy output. A failing hook is reported, the new release stays deployed.
+func withPostDeployHooks(ctx context.Context, appName string, hooks []api.DeployHook, output string, err error) (string, error) {
+	if err != nil {
+		return output, err
+	}
+	hookOutput, hookErr := runDeployHookStage(ctx, appName, HookStagePostDeploy, hooks)
+	if hookErr != nil {
+		DiagnosticsFromContext(ctx).Warn("hooks", "post-deploy hooks failed, the new release stays deployed")
+	}
+	return output + hookOutput, nil
+}
+
+// recordDeployHookResults adds the results of the hooks of a stage to the details of the activity
+// of the deployment a context runs, nothing for deployments that weren't recorded
+func recordDeployHookResults(ctx context.Context, appName, stage string, results []DeployHookResult) {
+	deploymentID, ok := DeploymentIDFromContext(ctx)
+	if !ok {
+		return
+	}
+	record, err := api.Deployments.GetDeploymentRecord(context.Background(), appName, deploymentID)
+	if err != nil || record.ActivityID == nil {
+		return
+	}
+	details := map[string]interface{}{stage + "_hooks": results}
+	if err := api.Activities.MergeActivityDetails(context.Background(), *record.ActivityID, details); err != nil {
+		WarnLog("Failed to record the %s hooks of deployment %d: %v", stage, deploymentID, err)
+	}
+}
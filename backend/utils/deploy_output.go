@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+const (
+	// maxDeployOutputLines bounds the lines of a running deployment kept for viewers joining late
+	maxDeployOutputLines = 2000
+	// deployOutputViewerBuffer is how many lines a viewer may lag behind before it is dropped
+	deployOutputViewerBuffer = 512
+)
+
+// deployOutputContextKey carries the output of the running deployment a context belongs to
+type deployOutputContextKey struct{}
+
+// deployOutput collects the output of the commands of a running deployment line by line and fans
+// it out to the viewers following it
+type deployOutput struct {
+	mu      sync.Mutex
+	lines   []string
+	skipped int
+	viewers map[chan string]struct{}
+	closed  bool
+}
+
+func newDeployOutput() *deployOutput {
+	return &deployOutput{viewers: make(map[chan string]struct{})}
+}
+
+// publish adds a line to the output and sends it to the viewers. A viewer lagging too far behind
+// is dropped rather than slowing the deployment down.
+func (o *deployOutput) publish(line string) {
+	line = stripANSIColors(line)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return
+	}
+	o.lines = append(o.lines, line)
+	if overflow := len(o.lines) - maxDeployOutputLines; overflow > 0 {
+		o.lines = append([]string(nil), o.lines[overflow:]...)
+		o.skipped += overflow
+	}
+	for viewer := range o.viewers {
+		select {
+		case viewer <- line:
+		default:
+			delete(o.viewers, viewer)
+			close(viewer)
+		}
+	}
+}
+
+// close ends the output, the channels of the viewers are closed once they read what was sent
+func (o *deployOutput) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return
+	}
+	o.closed = true
+	for viewer := range o.viewers {
+		delete(o.viewers, viewer)
+		close(viewer)
+	}
+}
+
+// writer returns a writer publishing what is written to it line by line. Each stream of a command
+// needs its own writer, so stdout and stderr don't mix within a line.
+func (o *deployOutput) writer() *deployOutputWriter {
+	return &deployOutputWriter{output: o}
+}
+
+// deployOutputWriter splits a stream into lines for a deployment output. Carriage returns end a
+// line too, so progress bars show each update.
+type deployOutputWriter struct {
+	mu      sync.Mutex
+	output  *deployOutput
+	partial []byte
+}
+
+func (w *deployOutputWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		end := bytes.IndexAny(w.partial, "\r\n")
+		if end < 0 {
+			break
+		}
+		if end > 0 {
+			w.output.publish(string(w.partial[:end]))
+		}
+		w.partial = w.partial[end+1:]
+	}
+	return len(p), nil
+}
+
+// Flush publishes the last line of a stream that didn't end with a newline
+func (w *deployOutputWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		w.output.publish(string(w.partial))
+		w.partial = nil
+	}
+}
+
+// deployOutputFromContext returns the output of the running deployment ctx belongs to, or nil
+func deployOutputFromContext(ctx context.Context) *deployOutput {
+	output, _ := ctx.Value(deployOutputContextKey{}).(*deployOutput)
+	return output
+}
+
+// teeDeployOutput returns writers sending a copy of stdout and stderr of a command to the output
+// of the deployment ctx belongs to, and a func publishing their last partial lines. Outside of a
+// deployment the streams are returned unchanged.
+func teeDeployOutput(ctx context.Context, stdout, stderr io.Writer) (io.Writer, io.Writer, func()) {
+	output := deployOutputFromContext(ctx)
+	if output == nil {
+		return stdout, stderr, func() {}
+	}
+	stdoutLines, stderrLines := output.writer(), output.writer()
+	return io.MultiWriter(stdout, stdoutLines), io.MultiWriter(stderr, stderrLines), func() {
+		stdoutLines.Flush()
+		stderrLines.Flush()
+	}
+}
+
+// DeploymentOutputSubscription follows the output of a running deployment
+type DeploymentOutputSubscription struct {
+	// Replay holds the output produced before the subscription, Skipped the older lines no
+	// longer kept
+	Replay  []string
+	Skipped int
+	// Lines receives the new lines, it is closed when the deployment ends or the subscriber
+	// lagged too far behind
+	Lines <-chan string
+
+	output  *deployOutput
+	channel chan string
+}
+
+// Finished reports whether the deployment ended, once Lines is closed it tells an ended
+// deployment from a dropped subscriber
+func (s *DeploymentOutputSubscription) Finished() bool {
+	s.output.mu.Lock()
+	defer s.output.mu.Unlock()
+	return s.output.closed
+}
+
+// Close stops following the output
+func (s *DeploymentOutputSubscription) Close() {
+	s.output.mu.Lock()
+	defer s.output.mu.Unlock()
+	if _, ok := s.output.viewers[s.channel]; ok {
+		delete(s.output.viewers, s.channel)
+		close(s.channel)
+	}
+}
+
+// SubscribeDeploymentOutput follows the build output of a running deployment of appName as it
+// is produced
+func SubscribeDeploymentOutput(appName string, deploymentID int) (*DeploymentOutputSubscription, error) {
+	runningDeploymentsMu.Lock()
+	deployment, ok := runningDeployments[deploymentID]
+	runningDeploymentsMu.Unlock()
+	if !ok || deployment.AppName != appName {
+		return nil, ErrDeploymentNotFound
+	}
+
+	output := deployment.output
+	output.mu.Lock()
+	defer output.mu.Unlock()
+	channel := make(chan string, deployOutputViewerBuffer)
+	if output.closed {
+		close(channel)
+	} else {
+		output.viewers[channel] = struct{}{}
+	}
+	return &DeploymentOutputSubscription{
+		Replay:  append([]string(nil), output.lines...),
+		Skipped: output.skipped,
+		Lines:   channel,
+		output:  output,
+		channel: channel,
+	}, nil
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"backend/database/api"
+	"backend/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Outcomes of a deployment integrity check
+const (
+	IntegrityInSync      = "in_sync"      // the recorded commit is the one dokku deployed
+	IntegrityMismatch    = "mismatch"     // dokku deployed another commit, e.g. a git push to the host
+	IntegrityUnrecorded  = "unrecorded"   // dokku deployed a commit Citizen has no record of
+	IntegrityNotDeployed = "not_deployed" // dokku has no deployed revision
+)
+
+// DeploymentIntegrity compares the deployment Citizen recorded for an app with the revision
+// dokku reports as deployed
+type DeploymentIntegrity struct {
+	AppName        string `json:"app_name"`
+	Status         string `json:"status"`
+	RecordedCommit string `json:"recorded_commit,omitempty"`
+	RecordedBranch string `json:"recorded_branch,omitempty"`
+	DeployedCommit string `json:"deployed_commit,omitempty"`
+	DeployedBranch string `json:"deployed_branch,omitempty"`
+	// LatestDeploymentID is the latest successful deployment in the history, HistoryCommit its commit
+	LatestDeploymentID *int   `json:"latest_deployment_id,omitempty"`
+	HistoryCommit      string `json:"history_commit,omitempty"`
+	// Resyncable tells whether a resync would change the recorded deployment
+	Resyncable bool   `json:"resyncable"`
+	Detail     string `json:"detail"`
+}
+
+// DeployedRevision returns the commit dokku last deployed for an app, "" when it has none
+func DeployedRevision(appName string) (string, error) {
+	return dokkuReportValue("git:report", appName, "--git-sha")
+}
+
+// CheckDeploymentIntegrity compares the commit recorded in app_deployments with the one dokku
+// deployed. It returns the recorded deployment too, nil when there is none.
+func CheckDeploymentIntegrity(ctx context.Context, appName string) (*DeploymentIntegrity, *models.AppDeployment, error) {
+	deployed, err := DeployedRevision(appName)
+	if err != nil {
+		return nil, nil, err
+	}
+	integrity := &DeploymentIntegrity{AppName: appName, DeployedCommit: deployed}
+	if branch, err := dokkuReportValue("git:report", appName, "--git-deploy-branch"); err == nil {
+		integrity.DeployedBranch = branch
+	}
+
+	record, err := api.Deployments.GetDeploymentByAppName(ctx, appName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		record = nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if record != nil {
+		integrity.RecordedCommit = record.GitCommit
+		integrity.RecordedBranch = record.GitBranch
+	}
+	if latest, err := api.Deployments.GetLatestSuccessfulDeployment(ctx, appName); err == nil && latest != nil {
+		integrity.LatestDeploymentID = &latest.ID
+		integrity.HistoryCommit = latest.GitCommit
+	}
+
+	switch {
+	case deployed == "":
+		integrity.Status = IntegrityNotDeployed
+		integrity.Detail = "dokku has no deployed revision for this app"
+	case integrity.RecordedCommit == "":
+		integrity.Status = IntegrityUnrecorded
+		integrity.Detail = "no commit is recorded for the deployed revision"
+	case sameCommit(integrity.RecordedCommit, deployed):
+		integrity.Status = IntegrityInSync
+		integrity.Detail = "the recorded commit is deployed"
+	default:
+		integrity.Status = IntegrityMismatch
+		integrity.Detail = "dokku deployed another commit than the recorded one, likely outside of Citizen"
+	}
+	integrity.Resyncable = integrity.Status == IntegrityUnrecorded || integrity.Status == IntegrityMismatch
+	return integrity, record, nil
+}
+
+// ResyncDeploymentRecord records the revision dokku deployed as the deployment of an app,
+// keeping the rest of the recorded deployment
+func ResyncDeploymentRecord(ctx context.Context, integrity *DeploymentIntegrity, record *models.AppDeployment) (*models.AppDeployment, error) {
+	if record == nil {
+		record = &models.AppDeployment{AppName: integrity.AppName, Status: "deployed", LastDeploy: time.Now()}
+	}
+	record.GitCommit = integrity.DeployedCommit
+	if integrity.DeployedBranch != "" {
+		record.GitBranch = integrity.DeployedBranch
+	}
+	if err := api.Deployments.UpsertDeployment(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// sameCommit compares commits that may be abbreviated
+func sameCommit(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return len(a) >= 7 && strings.HasPrefix(b, a)
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultMaxBuildDuration bounds a deployment when DEPLOY_MAX_BUILD_DURATION is not set
+const defaultMaxBuildDuration = 30 * time.Minute
+
+var (
+	// ErrDeploymentNotFound is returned when no running deployment matches
+	ErrDeploymentNotFound = errors.New("deployment not found or already finished")
+	// ErrDeploymentCancelled is the cause attached to deployments cancelled by a user
+	ErrDeploymentCancelled = errors.New("deployment cancelled")
+)
+
+// RunningDeployment is a deployment whose build is still in progress
+type RunningDeployment struct {
+	ID        int       `json:"id"`
+	AppName   string    `json:"app_name"`
+	StartedAt time.Time `json:"started_at"`
+	Deadline  time.Time `json:"deadline"`
+
+	cancel context.CancelCauseFunc
+	output *deployOutput
+}
+
+// deploymentIDContextKey carries the ID of the recorded deployment a context runs
+type deploymentIDContextKey struct{}
+
+var (
+	runningDeployments   = make(map[int]*RunningDeployment)
+	runningDeploymentsMu sync.Mutex
+)
+
+// GetMaxBuildDuration returns the configured maximum build duration (DEPLOY_MAX_BUILD_DURATION)
+func GetMaxBuildDuration() time.Duration {
+	value := os.Getenv("DEPLOY_MAX_BUILD_DURATION")
+	if value == "" {
+		return defaultMaxBuildDuration
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		WarnLog("Invalid DEPLOY_MAX_BUILD_DURATION %q, using %s", value, defaultMaxBuildDuration)
+		return defaultMaxBuildDuration
+	}
+	return duration
+}
+
+// StartDeploymentContext returns a context bounded by the max build duration and registers the
+// deployment so it can be cancelled and its output followed by ID. The returned func must be
+// called when the deploy ends.
+func StartDeploymentContext(parent context.Context, deploymentID int, appName string) (context.Context, func()) {
+	maxDuration := GetMaxBuildDuration()
+
+	output := newDeployOutput()
+	parent = context.WithValue(parent, deployOutputContextKey{}, output)
+	cancelCtx, cancel := context.WithCancelCause(context.WithValue(parent, deploymentIDContextKey{}, deploymentID))
+	ctx, cancelTimeout := context.WithTimeout(cancelCtx, maxDuration)
+
+	deployment := &RunningDeployment{
+		ID:        deploymentID,
+		AppName:   appName,
+		StartedAt: time.Now(),
+		Deadline:  time.Now().Add(maxDuration),
+		cancel:    cancel,
+		output:    output,
+	}
+
+	runningDeploymentsMu.Lock()
+	runningDeployments[deploymentID] = deployment
+	runningDeploymentsMu.Unlock()
+
+	return ctx, func() {
+		runningDeploymentsMu.Lock()
+		if runningDeployments[deploymentID] == deployment {
+			delete(runningDeployments, deploymentID)
+		}
+		runningDeploymentsMu.Unlock()
+		output.close()
+
+		cancelTimeout()
+		cancel(nil)
+	}
+}
+
+// DeploymentIDFromContext returns the ID of the recorded deployment ctx runs, false outside of one
+func DeploymentIDFromContext(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(deploymentIDContextKey{}).(int)
+	return id, ok
+}
+
+// CancelDeployment aborts a running deployment of appName
+func CancelDeployment(appName string, deploymentID int) error {
+	runningDeploymentsMu.Lock()
+	deployment, ok := runningDeployments[deploymentID]
+	runningDeploymentsMu.Unlock()
+
+	if !ok || deployment.AppName != appName {
+		return ErrDeploymentNotFound
+	}
+
+	deployment.cancel(ErrDeploymentCancelled)
+	return nil
+}
+
+// ListRunningDeployments returns the deployments currently in progress for appName
+func ListRunningDeployments(appName string) []RunningDeployment {
+	runningDeploymentsMu.Lock()
+	defer runningDeploymentsMu.Unlock()
+
+	deployments := []RunningDeployment{}
+	for _, deployment := range runningDeployments {
+		if deployment.AppName == appName {
+			deployments = append(deployments, *deployment)
+		}
+	}
+	return deployments
+}
+
+// DeploymentErrorStatus describes why a deployment context ended early, or "" if it did not
+func DeploymentErrorStatus(ctx context.Context) string {
+	switch {
+	case errors.Is(context.Cause(ctx), ErrDeploymentCancelled):
+		return "cancelled"
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"backend/database/api"
+)
+
+// DetectionSettingKey is the system setting holding the detection config as JSON
+const DetectionSettingKey = "deploy.detection"
+
+// Files deploy detection can read, in the default precedence order
+var DefaultDetectionOrder = []string{"citizen.yml", "project.toml", "netlify.toml", "app.json", "Dockerfile", "package.json"}
+
+// detectionBuilders is the builder each file implies when it is the first one found
+var detectionBuilders = map[string]string{
+	"project.toml": "pack",
+	"Dockerfile":   "dockerfile",
+	"package.json": "herokuish",
+}
+
+// DetectionConfig configures how the port and builder of a deploy are detected
+type DetectionConfig struct {
+	Order       []string `json:"order"`                  // files checked, highest precedence first
+	DefaultPort int      `json:"default_port,omitempty"` // used when no file defines a port
+}
+
+// DetectionStep is the outcome of checking one file
+type DetectionStep struct {
+	Source  string `json:"source"`
+	Status  string `json:"status"` // found, missing, no_port, error
+	Port    int    `json:"port,omitempty"`
+	Builder string `json:"builder,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// DetectionTrace records how the port and builder of a deploy were chosen
+type DetectionTrace struct {
+	Repository    string          `json:"repository,omitempty"`
+	Ref           string          `json:"ref,omitempty"`
+	Commit        string          `json:"commit,omitempty"`
+	Order         []string        `json:"order"`
+	Cached        bool            `json:"cached"`
+	CachedFrom    string          `json:"cached_from,omitempty"`
+	Steps         []DetectionStep `json:"steps"`
+	Port          *ConfigPort     `json:"port,omitempty"`
+	Builder       string          `json:"builder,omitempty"`
+	BuilderSource string          `json:"builder_source,omitempty"`
+	Notes         []string        `json:"notes,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	DurationMs    int64           `json:"duration_ms"`
+
+	err error
+}
+
+// Err returns why no port was detected, or nil
+func (t *DetectionTrace) Err() error {
+	return t.err
+}
+
+// note adds a free-form line to the trace
+func (t *DetectionTrace) note(format string, args ...interface{}) {
+	t.Notes = append(t.Notes, fmt.Sprintf(format, args...))
+}
+
+// fail records the error that ended detection
+func (t *DetectionTrace) fail(err error) {
+	t.err = err
+	t.Error = err.Error()
+}
+
+// GetDetectionConfig returns the configured detection order, or the default when none is stored
+func GetDetectionConfig(ctx context.Context) *DetectionConfig {
+	config := &DetectionConfig{Order: append([]string(nil), DefaultDetectionOrder...)}
+
+	value, err := api.Settings.GetSystemSetting(ctx, DetectionSettingKey)
+	if err != nil {
+		if !errors.Is(err, api.ErrSettingNotFound) {
+			WarnLog("Failed to load detection config, using defaults: %v", err)
+		}
+		return config
+	}
+
+	var stored DetectionConfig
+	if err := json.Unmarshal([]byte(value), &stored); err != nil || stored.Validate() != nil {
+		WarnLog("Invalid detection config stored, using defaults: %v", err)
+		return config
+	}
+	return &stored
+}
+
+// SaveDetectionConfig validates and stores the detection config. Cached detections are
+// cleared because they were computed with the previous order.
+func SaveDetectionConfig(ctx context.Context, config *DetectionConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := api.Settings.SetSystemSetting(ctx, DetectionSettingKey, string(value)); err != nil {
+		return err
+	}
+	if _, err := api.PortDetection.ClearCachedPorts(ctx); err != nil {
+		WarnLog("Failed to clear port detection cache: %v", err)
+	}
+	return nil
+}
+
+// Validate checks the order only names known files, each once
+func (c *DetectionConfig) Validate() error {
+	if len(c.Order) == 0 {
+		return fmt.Errorf("order must list at least one file")
+	}
+
+	seen := make(map[string]bool, len(c.Order))
+	for _, source := range c.Order {
+		if !isDetectionSource(source) {
+			return fmt.Errorf("unknown detection source %q, expected one of %v", source, DefaultDetectionOrder)
+		}
+		if seen[source] {
+			return fmt.Errorf("detection source %q listed twice", source)
+		}
+		seen[source] = true
+	}
+
+	if c.DefaultPort < 0 || c.DefaultPort > 65535 {
+		return fmt.Errorf("default_port must be a valid port number")
+	}
+	return nil
+}
+
+// isDetectionSource reports whether source is a file detection can read
+func isDetectionSource(source string) bool {
+	for _, known := range DefaultDetectionOrder {
+		if source == known {
+			return true
+		}
+	}
+	return false
+}
+
+// detectFromFiles checks the fetched files in order, recording each one in the trace.
+// The first file defining a port wins, and the first file implying a builder picks it.
+func detectFromFiles(trace *DetectionTrace, files map[string][]byte) {
+	for _, source := range trace.Order {
+		step := DetectionStep{Source: source}
+
+		data, exists := files[source]
+		if !exists {
+			step.Status = "missing"
+			trace.Steps = append(trace.Steps, step)
+			continue
+		}
+
+		port, builder, err := parseDetectionFile(source, data)
+		if builder == "" {
+			builder = detectionBuilders[source]
+		}
+		step.Builder = builder
+		if builder != "" && trace.Builder == "" {
+			trace.Builder, trace.BuilderSource = builder, source
+		}
+
+		switch {
+		case err == nil && port != nil:
+			step.Status = "found"
+			step.Port = port.Port
+			step.Detail = port.Source
+			if trace.Port == nil {
+				trace.Port = port
+			}
+		case errors.Is(err, errNoPortInFile):
+			step.Status = "no_port"
+		default:
+			step.Status = "error"
+			step.Detail = err.Error()
+		}
+		trace.Steps = append(trace.Steps, step)
+	}
+}
+
+// errNoPortInFile is returned by parsers when a file is valid but defines no port
+var errNoPortInFile = errors.New("no port found")
+
+// parseDetectionFile reads the port (and explicit builder, if any) from a file
+func parseDetectionFile(source string, data []byte) (*ConfigPort, string, error) {
+	switch source {
+	case "citizen.yml":
+		return parseCitizenYml(data)
+	case "Dockerfile":
+		port, err := parseDockerfile(data)
+		return port, "", err
+	default:
+		port, err := parsePortConfig(source, data)
+		return port, "", err
+	}
+}
+
+var (
+	citizenYmlPortRegex  = regexp.MustCompile(`(?m)^port:\s*["']?(\d+)["']?\s*(?:#.*)?$`)
+	citizenYmlBuildRegex = regexp.MustCompile(`(?m)^builder:\s*["']?([a-z]+)["']?\s*(?:#.*)?$`)
+	dockerExposeRegex    = regexp.MustCompile(`(?mi)^\s*EXPOSE\s+(\d+)`)
+)
+
+// parseCitizenYml reads the top-level port and builder keys of citizen.yml
+func parseCitizenYml(data []byte) (*ConfigPort, string, error) {
+	builder := ""
+	if match := citizenYmlBuildRegex.FindSubmatch(data); match != nil {
+		builder = string(match[1])
+	}
+
+	match := citizenYmlPortRegex.FindSubmatch(data)
+	if match == nil {
+		return nil, builder, fmt.Errorf("%w in citizen.yml", errNoPortInFile)
+	}
+	port, err := strconv.Atoi(string(match[1]))
+	if err != nil {
+		return nil, builder, err
+	}
+	return &ConfigPort{Port: port, Source: "citizen.yml (port)"}, builder, nil
+}
+
+// parseDockerfile reads the first EXPOSEd port of a Dockerfile
+func parseDockerfile(data []byte) (*ConfigPort, error) {
+	match := dockerExposeRegex.FindSubmatch(data)
+	if match == nil {
+		return nil, fmt.Errorf("%w in Dockerfile", errNoPortInFile)
+	}
+	port, err := strconv.Atoi(string(match[1]))
+	if err != nil {
+		return nil, err
+	}
+	return &ConfigPort{Port: port, Source: "Dockerfile (EXPOSE)"}, nil
+}
+
+// finishTrace applies the configured default port and records the total duration
+func finishTrace(trace *DetectionTrace, config *DetectionConfig, startedAt time.Time) {
+	if trace.Port == nil && trace.err == nil && config.DefaultPort > 0 {
+		trace.Port = &ConfigPort{Port: config.DefaultPort, Source: "default"}
+		trace.note("no file defines a port, using the configured default %d", config.DefaultPort)
+	}
+	if trace.Port == nil && trace.err == nil {
+		trace.fail(errNoPortConfig)
+	}
+	trace.DurationMs = time.Since(startedAt).Milliseconds()
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DiagnosticEvent is one step taken while orchestrating a deployment
+type DiagnosticEvent struct {
+	Time    time.Time `json:"time"`
+	Stage   string    `json:"stage"` // port, builder, git, deploy, ...
+	Level   string    `json:"level"` // info, warn, error
+	Message string    `json:"message"`
+}
+
+// DeployDiagnostics collects the detection trace and orchestration steps of a deployment so a
+// failed deploy can be debugged after the fact. All methods are safe on a nil receiver.
+type DeployDiagnostics struct {
+	mu        sync.Mutex
+	detection *DetectionTrace
+	events    []DiagnosticEvent
+}
+
+type diagnosticsContextKey struct{}
+
+// NewDeployDiagnostics returns an empty diagnostics collector
+func NewDeployDiagnostics() *DeployDiagnostics {
+	return &DeployDiagnostics{events: []DiagnosticEvent{}}
+}
+
+// WithDiagnostics returns a context carrying d, so deploy helpers can record into it
+func WithDiagnostics(ctx context.Context, d *DeployDiagnostics) context.Context {
+	if d == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, diagnosticsContextKey{}, d)
+}
+
+// DiagnosticsFromContext returns the diagnostics carried by ctx, or nil
+func DiagnosticsFromContext(ctx context.Context) *DeployDiagnostics {
+	d, _ := ctx.Value(diagnosticsContextKey{}).(*DeployDiagnostics)
+	return d
+}
+
+// SetDetection stores the port and builder detection trace
+func (d *DeployDiagnostics) SetDetection(trace *DetectionTrace) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.detection = trace
+	d.mu.Unlock()
+}
+
+// Info records a step of the deployment
+func (d *DeployDiagnostics) Info(stage, format string, args ...interface{}) {
+	d.add(stage, "info", format, args...)
+}
+
+// Warn records a problem the deployment continued past
+func (d *DeployDiagnostics) Warn(stage, format string, args ...interface{}) {
+	d.add(stage, "warn", format, args...)
+}
+
+// Error records a problem that failed the deployment
+func (d *DeployDiagnostics) Error(stage, format string, args ...interface{}) {
+	d.add(stage, "error", format, args...)
+}
+
+func (d *DeployDiagnostics) add(stage, level, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if level == "info" {
+		DebugLog("[DEPLOY] %s: %s", stage, message)
+	} else {
+		WarnLog("[DEPLOY] %s: %s", stage, message)
+	}
+
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.events = append(d.events, DiagnosticEvent{Time: time.Now(), Stage: stage, Level: level, Message: message})
+	d.mu.Unlock()
+}
+
+// MarshalJSON encodes the detection trace and the recorded steps
+func (d *DeployDiagnostics) MarshalJSON() ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return json.Marshal(struct {
+		Detection *DetectionTrace   `json:"detection,omitempty"`
+		Events    []DiagnosticEvent `json:"events"`
+	}{d.detection, d.events})
+}
@@ -0,0 +1,415 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	// Time zones of digests don't depend on the zoneinfo of the host
+	_ "time/tzdata"
+
+	"backend/database/api"
+)
+
+// Digest frequencies
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// EventDigest is the event of digest webhook deliveries
+const EventDigest = "digest"
+
+const (
+	// maxDigestApps bounds the apps a digest summarizes
+	maxDigestApps = 50
+	// digestRetryWindow is how long after the end of its period a digest that failed to send is retried
+	digestRetryWindow = 6 * time.Hour
+	// defaultSMTPPort is the submission port used when SMTP_PORT is unset
+	defaultSMTPPort = "587"
+)
+
+// Digest summarizes the deployments, uptime and pending recommendations of the apps of a user
+// over a day or a week
+type Digest struct {
+	UserID      int         `json:"user_id"`
+	Username    string      `json:"username"`
+	Frequency   string      `json:"frequency"`
+	Timezone    string      `json:"timezone"`
+	PeriodStart time.Time   `json:"period_start"`
+	PeriodEnd   time.Time   `json:"period_end"`
+	Totals      DigestTotal `json:"totals"`
+	Apps        []DigestApp `json:"apps"`
+}
+
+// DigestTotal adds up the apps of a digest
+type DigestTotal struct {
+	Apps            int `json:"apps"`
+	Deployments     int `json:"deployments"`
+	Succeeded       int `json:"succeeded"`
+	Failed          int `json:"failed"`
+	Recommendations int `json:"recommendations"`
+}
+
+// DigestApp is the part of a digest about one app
+type DigestApp struct {
+	AppName     string                   `json:"app_name"`
+	Deployments api.AppDeploymentSummary `json:"deployments"`
+	// UptimePercent is only known for the apps whose uptime is sampled
+	UptimePercent   *float64                `json:"uptime_percent,omitempty"`
+	Recommendations []ScalingRecommendation `json:"recommendations"`
+	PendingRestart  *api.PendingRestart     `json:"pending_restart,omitempty"`
+}
+
+// ValidateDigestSubscription checks the schedule and delivery channels of a digest subscription
+func ValidateDigestSubscription(sub *api.DigestSubscription) error {
+	if sub.Frequency != DigestDaily && sub.Frequency != DigestWeekly {
+		return fmt.Errorf("frequency must be %s or %s", DigestDaily, DigestWeekly)
+	}
+	if _, err := time.LoadLocation(sub.Timezone); err != nil || sub.Timezone == "" || sub.Timezone == "Local" {
+		return fmt.Errorf("unknown time zone %q, use an IANA name like Europe/Paris", sub.Timezone)
+	}
+	if sub.SendHour < 0 || sub.SendHour > 23 {
+		return errors.New("send_hour must be between 0 and 23")
+	}
+	if sub.SendWeekday < 0 || sub.SendWeekday > 6 {
+		return errors.New("send_weekday must be between 0 (Sunday) and 6 (Saturday)")
+	}
+	if len(sub.Apps) > maxDigestApps {
+		return fmt.Errorf("a digest summarizes at most %d apps", maxDigestApps)
+	}
+	for _, app := range sub.Apps {
+		if err := ValidateAppName(app); err != nil {
+			return fmt.Errorf("invalid app %q: %w", app, err)
+		}
+	}
+	if sub.WebhookURL != nil {
+		if err := ValidateWebhookURL(*sub.WebhookURL); err != nil {
+			return err
+		}
+	}
+	if sub.WebhookURL == nil && !(sub.EmailEnabled && SMTPConfigured()) {
+		return errors.New("digests need a webhook_url, or email while SMTP is configured")
+	}
+	return nil
+}
+
+// DigestPeriod returns the period of the last digest due at now: it ends at the last send time
+// of the subscription in its time zone, and starts a day or a week earlier. Local dates are used,
+// so periods spanning a DST change are an hour shorter or longer.
+func DigestPeriod(sub *api.DigestSubscription, now time.Time) (time.Time, time.Time, error) {
+	loc, err := time.LoadLocation(sub.Timezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	local := now.In(loc)
+	year, month, day := local.Date()
+
+	days := 1
+	if sub.Frequency == DigestWeekly {
+		days = 7
+		day -= (int(local.Weekday()) - sub.SendWeekday + 7) % 7
+	}
+	end := time.Date(year, month, day, sub.SendHour, 0, 0, 0, loc)
+	if end.After(now) {
+		day -= days
+		end = time.Date(year, month, day, sub.SendHour, 0, 0, 0, loc)
+	}
+	start := time.Date(year, month, day-days, sub.SendHour, 0, 0, 0, loc)
+	return start, end, nil
+}
+
+// BuildDigest summarizes the apps of a subscription over [start, end). They are the apps of the
+// subscription, or the ones the user recently worked on.
+func BuildDigest(ctx context.Context, sub *api.DigestSubscription, start, end time.Time) (*Digest, error) {
+	user, err := api.Users.GetUserByID(ctx, sub.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	apps := sub.Apps
+	if len(apps) == 0 {
+		recent, err := api.Users.ListRecentApps(ctx, sub.UserID, maxDigestApps)
+		if err != nil {
+			return nil, err
+		}
+		for _, app := range recent {
+			apps = append(apps, app.AppName)
+		}
+	}
+
+	deployments, err := api.Deployments.SummarizeDeployments(ctx, apps, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := &Digest{
+		UserID:      sub.UserID,
+		Username:    user.Username,
+		Frequency:   sub.Frequency,
+		Timezone:    sub.Timezone,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Apps:        make([]DigestApp, 0, len(apps)),
+	}
+	for _, appName := range apps {
+		app := DigestApp{AppName: appName, Deployments: deployments[appName], Recommendations: []ScalingRecommendation{}}
+		app.Deployments.AppName = appName
+
+		if samples, up, err := api.Apps.GetUptime(ctx, appName, start); err != nil {
+			WarnLog("Failed to get the uptime of %s for a digest: %v", appName, err)
+		} else if samples > 0 {
+			percent := math.Round(float64(up)*10000/float64(samples)) / 100
+			app.UptimePercent = &percent
+		}
+		if recommendations, err := GetScalingRecommendations(ctx, appName); err == nil {
+			app.Recommendations = recommendations
+		}
+		if pending, err := api.Apps.GetPendingRestart(ctx, appName); err != nil {
+			WarnLog("Failed to get the pending restart of %s for a digest: %v", appName, err)
+		} else {
+			app.PendingRestart = pending
+		}
+
+		digest.Totals.Deployments += app.Deployments.Total
+		digest.Totals.Succeeded += app.Deployments.Succeeded
+		digest.Totals.Failed += app.Deployments.Failed
+		digest.Totals.Recommendations += len(app.Recommendations)
+		if app.PendingRestart != nil {
+			digest.Totals.Recommendations++
+		}
+		digest.Apps = append(digest.Apps, app)
+	}
+	digest.Totals.Apps = len(digest.Apps)
+	return digest, nil
+}
+
+// SendDueDigests sends the digests whose period ended since they were last sent. A digest that
+// fails to send is retried on the next runs for digestRetryWindow, then its period is skipped.
+func SendDueDigests(ctx context.Context) (int, error) {
+	subs, err := api.Users.ListEnabledDigestSubscriptions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	sent := 0
+	for i := range subs {
+		sub := &subs[i]
+		start, end, err := DigestPeriod(sub, now)
+		if err != nil {
+			WarnLog("Skipping the digest of user %d: %v", sub.UserID, err)
+			continue
+		}
+		if sub.LastPeriodEnd != nil && !end.After(*sub.LastPeriodEnd) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+
+		digest, err := BuildDigest(ctx, sub, start, end)
+		delivered := false
+		if err == nil {
+			delivered, err = DeliverDigest(ctx, sub, digest)
+		}
+
+		var message *string
+		if err != nil {
+			text := err.Error()
+			message = &text
+		}
+		switch {
+		case delivered:
+			sent++
+			err = api.Users.RecordDigestSent(ctx, sub.UserID, end, true, message)
+		case now.Sub(end) >= digestRetryWindow:
+			WarnLog("Giving up the %s digest of user %d for the period ending %s: %s", sub.Frequency, sub.UserID, end.Format(time.RFC3339), *message)
+			err = api.Users.RecordDigestSent(ctx, sub.UserID, end, false, message)
+		default:
+			DebugLog("Digest of user %d failed, it will be retried: %s", sub.UserID, *message)
+			err = api.Users.RecordDigestError(ctx, sub.UserID, *message)
+		}
+		if err != nil {
+			WarnLog("Failed to record the digest of user %d: %v", sub.UserID, err)
+		}
+	}
+	return sent, nil
+}
+
+// DeliverDigest sends a digest by email and to the webhook of its subscription. It reports
+// whether any channel received it, and the errors of the channels that failed.
+func DeliverDigest(ctx context.Context, sub *api.DigestSubscription, digest *Digest) (bool, error) {
+	var errs []error
+	delivered := false
+
+	if sub.EmailEnabled && SMTPConfigured() {
+		user, err := api.Users.GetUserByID(ctx, sub.UserID)
+		if err == nil {
+			err = sendDigestEmail(user.Email, digest)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		} else {
+			delivered = true
+		}
+	}
+	if sub.WebhookURL != nil {
+		if err := postDigestWebhook(ctx, sub, digest); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		} else {
+			delivered = true
+		}
+	}
+	if !delivered && len(errs) == 0 {
+		errs = append(errs, errors.New("no delivery channel is available"))
+	}
+	return delivered, errors.Join(errs...)
+}
+
+// postDigestWebhook posts a digest to the webhook of a subscription, signed like app webhooks
+func postDigestWebhook(ctx context.Context, sub *api.DigestSubscription, digest *Digest) error {
+	if sub.WebhookSecret == nil {
+		return errors.New("webhook has no secret")
+	}
+	secret, err := DecryptString(*sub.WebhookSecret)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt webhook secret: %w", err)
+	}
+	if err := ValidateWebhookURL(*sub.WebhookURL); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"event":       EventDigest,
+		"occurred_at": time.Now().UTC(),
+		"data":        digest,
+	})
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *sub.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Citizen-Webhooks/1.0")
+	req.Header.Set("X-Citizen-Event", EventDigest)
+	req.Header.Set("X-Citizen-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Citizen-Signature", SignWebhookPayload(secret, timestamp, body))
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver answered HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTPConfigured reports whether emails can be sent: SMTP_HOST and SMTP_FROM are set
+func SMTPConfigured() bool {
+	return os.Getenv("SMTP_HOST") != "" && os.Getenv("SMTP_FROM") != ""
+}
+
+// sendDigestEmail emails a digest in plain text
+func sendDigestEmail(to string, digest *Digest) error {
+	if _, err := mail.ParseAddress(to); err != nil {
+		return fmt.Errorf("invalid email address of user %d", digest.UserID)
+	}
+	return sendPlainEmail(to, fmt.Sprintf("Your %s Citizen digest", digest.Frequency), RenderDigestText(digest))
+}
+
+// sendPlainEmail emails a plain text message through the SMTP server of SMTP_HOST and SMTP_PORT,
+// authenticated with SMTP_USERNAME and SMTP_PASSWORD when they are set
+func sendPlainEmail(to, subject, body string) error {
+	from, err := mail.ParseAddress(os.Getenv("SMTP_FROM"))
+	if err != nil {
+		return fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid email address %q", to)
+	}
+
+	host := os.Getenv("SMTP_HOST")
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = defaultSMTPPort
+	}
+	var auth smtp.Auth
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", recipient.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return smtp.SendMail(net.JoinHostPort(host, port), auth, from.Address, []string{recipient.Address}, []byte(msg.String()))
+}
+
+// RenderDigestText renders a digest as plain text, times in the time zone of the digest
+func RenderDigestText(digest *Digest) string {
+	loc, err := time.LoadLocation(digest.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	const layout = "Mon Jan 2 15:04 MST"
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hi %s,\n\n", digest.Username)
+	fmt.Fprintf(&b, "Here is what happened to your apps from %s to %s.\n\n",
+		digest.PeriodStart.In(loc).Format(layout), digest.PeriodEnd.In(loc).Format(layout))
+	fmt.Fprintf(&b, "%d deployments across %d apps, %d succeeded and %d failed. %d recommendations are pending.\n",
+		digest.Totals.Deployments, digest.Totals.Apps, digest.Totals.Succeeded, digest.Totals.Failed, digest.Totals.Recommendations)
+
+	for _, app := range digest.Apps {
+		fmt.Fprintf(&b, "\n%s\n", app.AppName)
+		fmt.Fprintf(&b, "  Deployments: %d (%d succeeded, %d failed)\n",
+			app.Deployments.Total, app.Deployments.Succeeded, app.Deployments.Failed)
+		if app.Deployments.LastError != nil {
+			fmt.Fprintf(&b, "  Last failure: %s\n", firstLine(*app.Deployments.LastError))
+		}
+		if app.UptimePercent != nil {
+			fmt.Fprintf(&b, "  Uptime: %.2f%%\n", *app.UptimePercent)
+		}
+		for _, recommendation := range app.Recommendations {
+			fmt.Fprintf(&b, "  Recommendation: %s\n", recommendation.Reason)
+		}
+		if app.PendingRestart != nil {
+			fmt.Fprintf(&b, "  Restart pending to apply %s\n", strings.Join(app.PendingRestart.ChangedKeys, ", "))
+		}
+	}
+	if len(digest.Apps) == 0 {
+		b.WriteString("\nYou haven't worked on any app yet, pick the apps of your digest in its settings.\n")
+	}
+	return b.String()
+}
+
+// firstLine returns the first line of a text, shortened to 200 characters
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	if len(line) > 200 {
+		line = line[:200] + "..."
+	}
+	return line
+}
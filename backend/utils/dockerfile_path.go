@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrDockerfileNotFound is returned when the Dockerfile path of an app doesn't exist in the
+// repository being deployed
+var ErrDockerfileNotFound = errors.New("dockerfile not found")
+
+// ValidateDockerfilePath checks a Dockerfile path is relative to the repository root and stays in it
+func ValidateDockerfilePath(dockerfilePath string) error {
+	if dockerfilePath == "" {
+		return nil
+	}
+	if len(dockerfilePath) > 255 || strings.HasPrefix(dockerfilePath, "/") || strings.ContainsAny(dockerfilePath, " \t\n\\'\"$`;&|") {
+		return fmt.Errorf("invalid dockerfile path %q, use a path relative to the repository root", dockerfilePath)
+	}
+	cleaned := path.Clean(dockerfilePath)
+	if cleaned != dockerfilePath || cleaned == "." || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return fmt.Errorf("invalid dockerfile path %q, use a clean path inside the repository", dockerfilePath)
+	}
+	return nil
+}
+
+// GetDockerfilePath returns the Dockerfile path set for an app, "" when it builds the Dockerfile
+// at the repository root
+func GetDockerfilePath(appName string) (string, error) {
+	return dokkuReportValue("builder-dockerfile:report", appName, "--builder-dockerfile-dockerfile-path")
+}
+
+// SetDockerfilePath sets the Dockerfile an app builds, back to the root Dockerfile when empty
+func SetDockerfilePath(appName, dockerfilePath string) (string, error) {
+	args := []string{"builder-dockerfile:set", appName, "dockerfile-path"}
+	if dockerfilePath != "" {
+		args = append(args, dockerfilePath)
+	}
+	return CitizenCommand(args...)
+}
+
+// CheckDockerfilePath verifies the Dockerfile path of an app exists in a GitHub repository ref
+// before it is built, relative to the build path of monorepo apps. It returns the path, "" when none is set. Repositories outside GitHub, or
+// that can't be read, are not checked, the build reports a missing file then.
+func CheckDockerfilePath(ctx context.Context, appName, gitURL, ref string, userID *int) (string, error) {
+	dockerfilePath, err := GetDockerfilePath(appName)
+	if err != nil || dockerfilePath == "" {
+		return "", err
+	}
+	// The path only matters to Dockerfile builds, selected or detected
+	if builder, err := dokkuReportValue("builder:report", appName, "--builder-computed-selected"); err == nil && builder != "" && builder != "dockerfile" {
+		return "", nil
+	}
+
+	diagnostics := DiagnosticsFromContext(ctx)
+	repoPath := dockerfilePath
+	if buildPath := BuildPath(ctx, appName); buildPath != "" {
+		repoPath = path.Join(buildPath, dockerfilePath)
+	}
+	owner, repo, ok := parseGitHubRepoURL(gitURL)
+	if !ok {
+		diagnostics.Info("dockerfile", "using %s, not checked outside GitHub", dockerfilePath)
+		return dockerfilePath, nil
+	}
+
+	accessToken := getGitHubAccessTokenForRepo(gitURL, userID)
+	exists, err := githubFileExists(ctx, owner, repo, ref, repoPath, accessToken)
+	if err != nil {
+		diagnostics.Warn("dockerfile", "could not check %s exists: %v", dockerfilePath, err)
+		return dockerfilePath, nil
+	}
+	if !exists {
+		// Private repositories answer 404 without access, only a readable repository proves the file missing
+		if _, err := listGitHubRootFiles(ctx, owner, repo, ref, accessToken); err != nil {
+			diagnostics.Warn("dockerfile", "could not check %s exists: %v", dockerfilePath, err)
+			return dockerfilePath, nil
+		}
+		return dockerfilePath, fmt.Errorf("%w: %s is not a file of %s/%s at %s", ErrDockerfileNotFound, repoPath, owner, repo, ref)
+	}
+
+	diagnostics.Info("dockerfile", "using %s", dockerfilePath)
+	return dockerfilePath, nil
+}
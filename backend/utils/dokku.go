@@ -3,21 +3,43 @@ package utils
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 
 	"backend/database/api"
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 // CitizenCommand executes Citizen CLI command via SSH and returns the result
 func CitizenCommand(args ...string) (string, error) {
+	return CitizenCommandContext(context.Background(), args...)
+}
+
+// CitizenCommandContext executes Citizen CLI command via SSH, aborting it when ctx is done
+func CitizenCommandContext(ctx context.Context, args ...string) (string, error) {
 	// Join command (no need to add doktu prefix, as we connect to dokku user via SSH)
 	command := strings.Join(args, " ")
+	defer invalidateReportsAfter(args)
 	
-	// Execute command via SSH
-	return RunSSHCommand(command)
+	// Tag the command with the request or job that runs it, so host logs can be traced back
+	correlationID := commandCorrelationID(ctx, args)
+	if correlationID != "" {
+		ctx = WithCorrelationID(ctx, correlationID)
+	}
+
+	// Execute command via SSH, recording it for any activity in progress
+	startedAt := time.Now()
+	output, err := RunSSHCommandContext(ctx, command)
+	recordCommand(args, correlationID, startedAt, output, err)
+	if isDokkuLockError(err) && ctx.Err() == nil {
+		return retryLockedCommand(ctx, args, correlationID, output, err)
+	}
+
+	return output, err
 }
 
 // ListApps lists all Citizen applications
@@ -113,20 +135,15 @@ func RemoveDomain(appName, domain string) (string, error) {
 
 // GitDeploy, deploy from Git repository (backward compatibility)
 func GitDeploy(appName, gitURL string) (string, error) {
-	return DeployFromGit(appName, gitURL, "main", nil)
+	return DeployFromGit(appName, gitURL, "main", "", nil)
 }
 
 
 
-// SetEnv, set environment variables for an application
+// SetEnv, set environment variables for an application and restart it
+// Values are sent over the SSH session's stdin (see ImportEnv), never as command arguments.
 func SetEnv(appName string, envVars map[string]string) (string, error) {
-	args := []string{"config:set", appName}
-	
-	for key, value := range envVars {
-		args = append(args, key+"="+value)
-	}
-	
-	return CitizenCommand(args...)
+	return ImportEnv(context.Background(), appName, envVars, true)
 }
 
 // RemoveEnv, remove an environment variable from an application
@@ -169,7 +186,24 @@ func GetEnv(appName string) (map[string]string, error) {
 	return envVars, nil
 }
 
-// GetAllAppsInfo, get all applications's information at once - for performance
+// maxAppInfoWorkers bounds how many apps are parsed (or queried individually) at once
+const maxAppInfoWorkers = 8
+
+// appReports are the dokku reports merged into the app info, keyed by a short name
+var appReports = []struct {
+	name    string
+	command string
+	suffix  string
+}{
+	{"apps", "apps:report", " app information"},
+	{"ps", "ps:report", " ps information"},
+	{"domains", "domains:report", " domains information"},
+}
+
+// GetAllAppsInfo, get all applications's information at once - for performance.
+// The report commands run concurrently and apps are parsed in parallel. When a report fails
+// for everyone, it is retried per app and apps that still fail get an "errors" field instead
+// of failing the whole request.
 func GetAllAppsInfo() (map[string]map[string]interface{}, error) {
 	// Get all applications's list
 	apps, err := ListApps()
@@ -181,217 +215,186 @@ func GetAllAppsInfo() (map[string]map[string]interface{}, error) {
 		return make(map[string]map[string]interface{}), nil
 	}
 	
-	// Run apps:report for all applications (single command)
-	appsOutput, err := CitizenCommand("apps:report")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get apps report: %w", err)
+	// Run every report for all applications concurrently (one command each)
+	sections := make([]map[string]string, len(appReports))
+	reportErrs := make([]error, len(appReports))
+	var wg sync.WaitGroup
+	for i, report := range appReports {
+		wg.Add(1)
+		go func(i int, command, suffix string) {
+			defer wg.Done()
+			output, err := CitizenCommand(command)
+			if err != nil {
+				reportErrs[i] = err
+				return
+			}
+			sections[i] = splitReportSections(output, suffix)
+		}(i, report.command, report.suffix)
 	}
+	wg.Wait()
 	
-	// Run ps:report for all applications (single command)
-	psOutput, err := CitizenCommand("ps:report")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get ps report: %w", err)
+	failed := 0
+	for i, err := range reportErrs {
+		if err != nil {
+			failed++
+			WarnLog("Failed to get %s for all apps, falling back to per-app reports: %v", appReports[i].command, err)
+		}
 	}
-	
-	// Run domains:report for all applications (single command)
-	domainsOutput, err := CitizenCommand("domains:report")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get domains report: %w", err)
+	if failed == len(appReports) {
+		return nil, fmt.Errorf("failed to get app reports: %w", reportErrs[0])
+	}
+	
+	// Parse (and fetch missing reports for) each application in parallel
+	result := make(map[string]map[string]interface{}, len(apps))
+	var mu sync.Mutex
+	jobs := make(chan string)
+	workers := maxAppInfoWorkers
+	if len(apps) < workers {
+		workers = len(apps)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for appName := range jobs {
+				appInfo := buildAppInfo(appName, sections, reportErrs)
+				mu.Lock()
+				result[appName] = appInfo
+				mu.Unlock()
+			}
+		}()
 	}
-	
-	// Merge information for each application
-	result := make(map[string]map[string]interface{})
-	
-	// Parse apps report
-	appsData := parseAppsReport(appsOutput)
-	
-	// Parse ps report
-	psData := parsePsReport(psOutput)
-	
-	// Parse domains report
-	domainsData := parseDomainsReport(domainsOutput)
-	
-	// Merge information for each application
 	for _, appName := range apps {
-		appInfo := make(map[string]interface{})
-		
-		// Add apps report information
-		if appData, exists := appsData[appName]; exists {
-			for key, value := range appData {
-				appInfo[key] = value
-			}
-		}
-		
-		// Add ps report information
-		var isRunning, isDeployed bool
-		if psAppData, exists := psData[appName]; exists {
-			if running, ok := psAppData["Running"]; ok {
-				isRunning = running == "true"
-			}
-			if deployed, ok := psAppData["Deployed"]; ok {
-				isDeployed = deployed == "true"
-			}
-		}
-		
-		// Add domain information
-		var domains []string
-		if domainsAppData, exists := domainsData[appName]; exists {
-			if vhosts, ok := domainsAppData["Domains app vhosts"]; ok && vhosts != "" {
-				domains = strings.Split(vhosts, " ")
-			}
-		}
-
-		// If in production environment, replace localhost with real login host
-		if !IsDevelopmentEnvironment() {
-			loginHost := os.Getenv("LOGIN_HOST")
-			if loginHost != "" && loginHost != "localhost" {
-				for i, domain := range domains {
-					if strings.Contains(domain, "localhost") {
-						domains[i] = strings.Replace(domain, "localhost", loginHost, -1)
-					}
-				}
-			}
-		}
-		
-		// Add port information
-		ports := make(map[string]string)
-		if appData, exists := appsData[appName]; exists {
-			if portStr, ok := appData["App ports"]; ok && portStr != "" {
-				// Format: "http:80:5000"
-				if portParts := strings.Split(portStr, ":"); len(portParts) >= 3 {
-					ports["http"] = portParts[2] // Internal port
-				}
-			}
-		}
-		
-		// If port information is not available, set default 5000
-		if len(ports) == 0 {
-			ports["http"] = "5000"
-		}
-		
-		// Create result object
-		appInfo["running"] = isRunning
-		appInfo["deployed"] = isDeployed
-		appInfo["domains"] = domains
-		appInfo["ports"] = ports
-		
-		result[appName] = appInfo
+		jobs <- appName
 	}
+	close(jobs)
+	wg.Wait()
 	
 	return result, nil
 }
 
-// parseAppsReport, parse apps:report output
-func parseAppsReport(output string) map[string]map[string]string {
-	result := make(map[string]map[string]string)
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	
-	var currentApp string
+// buildAppInfo merges the reports of a single app, querying any report that failed globally
+func buildAppInfo(appName string, sections []map[string]string, reportErrs []error) map[string]interface{} {
+	reports := make(map[string]map[string]string, len(appReports))
+	appErrors := make(map[string]string)
 	
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
+	for i, report := range appReports {
+		if reportErrs[i] == nil {
+			reports[report.name] = parseReportSection(sections[i][appName])
 			continue
 		}
 		
-		// Find app header (example: "=====> node-js-app app information")
-		if strings.HasPrefix(line, "=====> ") && strings.HasSuffix(line, " app information") {
-			// Extract app name
-			parts := strings.Fields(line)
-			if len(parts) >= 2 {
-				currentApp = parts[1]
-				result[currentApp] = make(map[string]string)
-			}
+		output, err := CitizenCommand(report.command, appName)
+		if err != nil {
+			appErrors[report.name] = err.Error()
+			reports[report.name] = map[string]string{}
 			continue
 		}
-		
-		// Parse information lines
-		if currentApp != "" && strings.Contains(line, ":") {
-			parts := strings.SplitN(line, ":", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-				result[currentApp][key] = value
+		reports[report.name] = parseReportSection(splitReportSections(output, report.suffix)[appName])
+	}
+	
+	appInfo := make(map[string]interface{})
+	
+	// Add apps report information
+	appData := reports["apps"]
+	for key, value := range appData {
+		appInfo[key] = value
+	}
+	
+	// Add ps report information
+	psAppData := reports["ps"]
+	isRunning := psAppData["Running"] == "true"
+	isDeployed := psAppData["Deployed"] == "true"
+	
+	// Add domain information
+	var domains []string
+	if vhosts, ok := reports["domains"]["Domains app vhosts"]; ok && vhosts != "" {
+		domains = strings.Split(vhosts, " ")
+	}
+
+	// If in production environment, replace localhost with real login host
+	if !IsDevelopmentEnvironment() {
+		loginHost := os.Getenv("LOGIN_HOST")
+		if loginHost != "" && loginHost != "localhost" {
+			for i, domain := range domains {
+				if strings.Contains(domain, "localhost") {
+					domains[i] = strings.Replace(domain, "localhost", loginHost, -1)
+				}
 			}
 		}
 	}
 	
-	return result
+	// Add port information
+	ports := make(map[string]string)
+	if portStr, ok := appData["App ports"]; ok && portStr != "" {
+		// Format: "http:80:5000"
+		if portParts := strings.Split(portStr, ":"); len(portParts) >= 3 {
+			ports["http"] = portParts[2] // Internal port
+		}
+	}
+	
+	// If port information is not available, set default 5000
+	if len(ports) == 0 {
+		ports["http"] = "5000"
+	}
+	
+	// Create result object
+	appInfo["running"] = isRunning
+	appInfo["deployed"] = isDeployed
+	appInfo["domains"] = domains
+	appInfo["ports"] = ports
+	if len(appErrors) > 0 {
+		appInfo["errors"] = appErrors
+	}
+	
+	return appInfo
 }
 
-// parsePsReport, parse ps:report output
-func parsePsReport(output string) map[string]map[string]string {
-	result := make(map[string]map[string]string)
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	
+// splitReportSections splits a multi-app dokku report into the raw lines of each app,
+// using headers such as "=====> node-js-app ps information"
+func splitReportSections(output, suffix string) map[string]string {
+	sections := make(map[string]string)
 	var currentApp string
+	var current strings.Builder
 	
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+	flush := func() {
+		if currentApp != "" {
+			sections[currentApp] = current.String()
 		}
-		
-		// Find app header (example: "=====> node-js-app ps information")
-		if strings.HasPrefix(line, "=====> ") && strings.HasSuffix(line, " ps information") {
-			// Extract app name
-			parts := strings.Fields(line)
-			if len(parts) >= 2 {
+		current.Reset()
+	}
+	
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "=====> ") && strings.HasSuffix(trimmed, suffix) {
+			flush()
+			currentApp = ""
+			if parts := strings.Fields(trimmed); len(parts) >= 2 {
 				currentApp = parts[1]
-				result[currentApp] = make(map[string]string)
 			}
 			continue
 		}
-		
-		// Parse information lines
-		if currentApp != "" && strings.Contains(line, ":") {
-			parts := strings.SplitN(line, ":", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-				result[currentApp][key] = value
-			}
+		if currentApp != "" {
+			current.WriteString(trimmed)
+			current.WriteString("\n")
 		}
 	}
+	flush()
 	
-	return result
+	return sections
 }
 
-// parseDomainsReport, parse domains:report output
-func parseDomainsReport(output string) map[string]map[string]string {
-	result := make(map[string]map[string]string)
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	
-	var currentApp string
-	
-	for _, line := range lines {
+// parseReportSection parses the "Key: value" lines of a single app report
+func parseReportSection(section string) map[string]string {
+	result := make(map[string]string)
+	for _, line := range strings.Split(section, "\n") {
 		line = strings.TrimSpace(line)
-		if line == "" {
+		if line == "" || !strings.Contains(line, ":") {
 			continue
 		}
-		
-		// Find app header (example: "=====> node-js-app domains information")
-		if strings.HasPrefix(line, "=====> ") && strings.HasSuffix(line, " domains information") {
-			// Extract app name
-			parts := strings.Fields(line)
-			if len(parts) >= 2 {
-				currentApp = parts[1]
-				result[currentApp] = make(map[string]string)
-			}
-			continue
-		}
-		
-		// Parse information lines
-		if currentApp != "" && strings.Contains(line, ":") {
-			parts := strings.SplitN(line, ":", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-				result[currentApp][key] = value
-			}
-		}
+		parts := strings.SplitN(line, ":", 2)
+		result[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
 	}
-	
 	return result
 }
 
@@ -486,6 +489,11 @@ func GetAppInfo(appName string) (map[string]interface{}, error) {
 	return result, nil
 }
 
+// UnlockApp releases the deploy lock of an app
+func UnlockApp(appName string) (string, error) {
+	return CitizenCommand("apps:unlock", appName)
+}
+
 // RestartApp, restart an application
 func RestartApp(appName string) (string, error) {
 	return CitizenCommand("ps:restart", appName)
@@ -595,14 +603,17 @@ type CitizenResponse struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
+	// Truncated flags the fields of Data holding a command output cut to the SSH output limit
+	Truncated map[string]*OutputTruncation `json:"truncated,omitempty"`
 }
 
 // NewCitizenResponse, standard API response
 func NewCitizenResponse(success bool, message string, data interface{}) CitizenResponse {
 	return CitizenResponse{
-		Success: success,
-		Message: message,
-		Data:    data,
+		Success:   success,
+		Message:   message,
+		Data:      data,
+		Truncated: responseTruncations(data),
 	}
 }
 
@@ -615,25 +626,28 @@ func (r CitizenResponse) ToJSON() ([]byte, error) {
 
 // LOG MANAGEMENT FUNCTIONS
 
+// ansiPatterns match ANSI escape sequences, compiled once
+var ansiPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\x1b\[[0-9;]*m`),      // Standard color codes
+	regexp.MustCompile(`\x1b\[[0-9;]*[mGKHF]`), // Cursor movement and other codes
+	regexp.MustCompile(`\x1b\[?[0-9]*[hl]`),   // Mode settings
+	regexp.MustCompile(`\x1b\[[0-9]*[ABCD]`),  // Cursor directions
+	regexp.MustCompile(`\x1b\[[0-9]*[JK]`),    // Erase functions
+	regexp.MustCompile(`\x1b\[s`),             // Save cursor position
+	regexp.MustCompile(`\x1b\[u`),             // Restore cursor position
+	regexp.MustCompile(`\x1b\[2J`),            // Clear screen
+	regexp.MustCompile(`\x1b\[H`),             // Home cursor
+	regexp.MustCompile(`\x1b\[0?[0-9]*[ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz]`), // General catch-all
+}
+
 // stripANSIColors removes ANSI color codes from log output
 func stripANSIColors(text string) string {
-	// Comprehensive ANSI escape sequence regex patterns
-	patterns := []string{
-		`\x1b\[[0-9;]*m`,      // Standard color codes
-		`\x1b\[[0-9;]*[mGKHF]`, // Cursor movement and other codes
-		`\x1b\[?[0-9]*[hl]`,   // Mode settings
-		`\x1b\[[0-9]*[ABCD]`,  // Cursor directions
-		`\x1b\[[0-9]*[JK]`,    // Erase functions
-		`\x1b\[s`,             // Save cursor position
-		`\x1b\[u`,             // Restore cursor position
-		`\x1b\[2J`,            // Clear screen
-		`\x1b\[H`,             // Home cursor
-		`\x1b\[0?[0-9]*[ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz]`, // General catch-all
+	if !strings.Contains(text, "\x1b") {
+		return text
 	}
-	
+
 	result := text
-	for _, pattern := range patterns {
-		regex := regexp.MustCompile(pattern)
+	for _, regex := range ansiPatterns {
 		result = regex.ReplaceAllString(result, "")
 	}
 	
@@ -670,16 +684,8 @@ func GetAppLogs(appName string, tail int, follow bool) (string, error) {
 
 // GetAllProcessLogs, get logs of all processes (more detailed)
 func GetAllProcessLogs(appName string, tail int) (string, error) {
-	args := []string{"logs", appName}
-	
-	if tail > 0 {
-		args = append(args, "-n", fmt.Sprintf("%d", tail))
-	}
-	
 	// Get logs of all processes (-p parameter is not used)
-	// Use timestamps and details
-	
-	result, err := CitizenCommand(args...)
+	result, err := GetRawProcessLogs(appName, "", tail)
 	if err != nil {
 		return "", err
 	}
@@ -690,6 +696,17 @@ func GetAllProcessLogs(appName string, tail int) (string, error) {
 
 // GetProcessSpecificLogs, get logs of a specific process
 func GetProcessSpecificLogs(appName, processType string, tail int) (string, error) {
+	result, err := GetRawProcessLogs(appName, processType, tail)
+	if err != nil {
+		return "", err
+	}
+	
+	// Clean ANSI color codes
+	return stripANSIColors(result), nil
+}
+
+// GetRawProcessLogs gets the logs of a process (all processes when empty) with ANSI colors preserved
+func GetRawProcessLogs(appName, processType string, tail int) (string, error) {
 	args := []string{"logs", appName}
 	
 	if tail > 0 {
@@ -701,13 +718,7 @@ func GetProcessSpecificLogs(appName, processType string, tail int) (string, erro
 		args = append(args, "-p", processType)
 	}
 	
-	result, err := CitizenCommand(args...)
-	if err != nil {
-		return "", err
-	}
-	
-	// Clean ANSI color codes
-	return stripANSIColors(result), nil
+	return CitizenCommand(args...)
 }
 
 // GetDockerContainerLogs gets app logs only (simplified)
@@ -767,75 +778,138 @@ func GetLogInfo(appName string) (map[string]interface{}, error) {
 func SetupGitAuthForRepo(appName string, gitURL string, userID *int) error {
 	// If userID is not provided, assume public repo
 	if userID == nil {
-		fmt.Printf("[GIT AUTH] No userID provided, skipping git auth setup (assuming public repo)\n")
+		DebugLog("No user for git auth of %s, assuming a public repository", appName)
 		return nil
 	}
 
 	// Check if GitHub URL
 	if !strings.Contains(gitURL, "github.com") {
-		fmt.Printf("[GIT AUTH] Not a GitHub repository, skipping git auth setup\n")
+		DebugLog("%s is not a GitHub repository, skipping git auth", gitURL)
 		return nil
 	}
 
 	// Get user's GitHub access token
 	accessToken, err := api.GitHub.GetUserGitHubAccessToken(context.Background(), *userID)
 	if err != nil {
-		fmt.Printf("[GIT AUTH] ⚠️ Failed to get GitHub access token for user %d: %v\n", *userID, err)
 		return fmt.Errorf("failed to get GitHub access token: %w", err)
 	}
 
 	if accessToken == "" {
-		fmt.Printf("[GIT AUTH] ⚠️ Empty GitHub access token for user %d\n", *userID)
 		return fmt.Errorf("empty GitHub access token")
 	}
 
 	// GitHub username'i token'dan al
 	githubUser, err := GetGitHubUser(accessToken)
 	if err != nil {
-		fmt.Printf("[GIT AUTH] ⚠️ Failed to get GitHub user info: %v\n", err)
 		return fmt.Errorf("failed to get GitHub user info: %w", err)
 	}
 
-	fmt.Printf("[GIT AUTH] 🔑 Setting up git auth for %s with token for user %s\n", gitURL, githubUser.Login)
-
 	// dokku git:auth komutu ile GitHub authentication setup
 	// Format: git:auth <host> <username> <token>
 	_, err = CitizenCommand("git:auth", "github.com", githubUser.Login, accessToken)
 	if err != nil {
-		fmt.Printf("[GIT AUTH] ❌ Failed to setup git auth: %v\n", err)
 		return fmt.Errorf("failed to setup git auth: %w", err)
 	}
 
-	fmt.Printf("[GIT AUTH] ✅ Git authentication successfully configured for %s\n", githubUser.Login)
+	DebugLog("Git auth configured for GitHub user %s", githubUser.Login)
 	return nil
 }
 
-// DeployFromGit deploys an app from a git repository with specific branch and optional user authentication
-func DeployFromGit(appName, gitURL, branch string, userID *int) (string, error) {
+// DeployFromGit deploys an app from a git repository with specific branch, pinned to commit when it
+// is set, and optional user authentication
+func DeployFromGit(appName, gitURL, branch, commit string, userID *int) (string, error) {
+	return DeployFromGitContext(context.Background(), appName, gitURL, branch, commit, userID)
+}
+
+// DeployFromGitContext deploys an app from git, aborting the remote build when ctx is cancelled or times out.
+// A commit SHA pins the deploy to that commit instead of the head of the branch.
+func DeployFromGitContext(ctx context.Context, appName, gitURL, branch, commit string, userID *int) (string, error) {
 	if branch == "" {
 		branch = "main"
 	}
 
-	fmt.Printf("[DEPLOY] 🚀 Starting deployment: %s from %s:%s\n", appName, gitURL, branch)
+	diagnostics := DiagnosticsFromContext(ctx)
+	ref := branch
+	if commit != "" {
+		if !IsCommitSHA(commit) {
+			return "", fmt.Errorf("invalid commit SHA %q", commit)
+		}
+		ref = commit
+		diagnostics.Info("deploy", "deploying %s from %s:%s pinned to commit %s", appName, gitURL, branch, commit)
+	} else {
+		diagnostics.Info("deploy", "deploying %s from %s:%s", appName, gitURL, branch)
+	}
 
 	// 🔑 Setup Git authentication for private repositories
 	if err := SetupGitAuthForRepo(appName, gitURL, userID); err != nil {
-		fmt.Printf("[DEPLOY] ⚠️ Git auth setup failed (continuing anyway): %v\n", err)
+		diagnostics.Warn("git", "git auth setup failed, continuing as a public repository: %v", err)
 		// Don't fail deployment if git auth fails - might be public repo
 	}
 
-	// Use git:sync command with branch specification and --build flag for immediate build
-	result, err := CitizenCommand("git:sync", "--build", appName, gitURL, branch)
+	// Build variables reach the build through the citizen-env plugin, never as command arguments
+	if err := SyncBuildVars(ctx, appName); err != nil {
+		diagnostics.Warn("build", "failed to apply the build variables: %v", err)
+	}
+
+	// Monorepo apps build the subdirectory of their repository connection
+	if err := SyncBuildPath(ctx, appName); err != nil {
+		diagnostics.Error("build", "failed to apply the build path: %v", err)
+		return "", fmt.Errorf("failed to apply the build path, the deploy was not started: %w", err)
+	}
+
+	// Pre-deploy hooks run in the release deployed so far, a failing one stops the deploy
+	hooks, err := api.Apps.ListDeployHooks(ctx, appName)
+	if err != nil {
+		diagnostics.Error("hooks", "failed to read the deploy hooks: %v", err)
+		return "", fmt.Errorf("failed to read the deploy hooks, the deploy was not started: %w", err)
+	}
+	hookOutput, err := runDeployHookStage(ctx, appName, HookStagePreDeploy, hooks)
+	if err != nil {
+		return strings.TrimSpace(hookOutput), fmt.Errorf("%w: %v", ErrPreDeployHookFailed, err)
+	}
+	if hookOutput != "" {
+		hookOutput = strings.TrimPrefix(hookOutput, "\n\n") + "\n\n"
+	}
+
+	// Apps with a pipeline are built, tested, then deployed in separate stages
+	pipeline, err := api.Apps.GetPipeline(ctx, appName)
+	if err == nil {
+		output, err := deployThroughPipeline(ctx, pipeline, appName, gitURL, ref)
+		return withPostDeployHooks(ctx, appName, hooks, hookOutput+output, err)
+	}
+	if !errors.Is(err, api.ErrPipelineNotFound) {
+		diagnostics.Error("pipeline", "failed to read the pipeline: %v", err)
+		return "", fmt.Errorf("failed to read the pipeline, the deploy was not started: %w", err)
+	}
+
+	// Use git:sync command with the branch, or the pinned commit, and --build flag for immediate build
+	result, err := CitizenCommandContext(ctx, "git:sync", "--build", appName, gitURL, ref)
+	if err != nil && ctx.Err() != nil {
+		reason := DeploymentErrorStatus(ctx)
+		diagnostics.Error("deploy", "git:sync aborted (%s)", reason)
+
+		// The killed build leaves the deploy lock behind, release it so the next deploy can run
+		if RequireCapability(FeatureAppLocking) == nil {
+			if _, unlockErr := UnlockApp(appName); unlockErr != nil {
+				diagnostics.Warn("deploy", "failed to release the deploy lock: %v", unlockErr)
+			}
+		}
+
+		if reason == "timeout" {
+			return result, fmt.Errorf("deployment exceeded the maximum build duration of %s", GetMaxBuildDuration())
+		}
+		return result, ErrDeploymentCancelled
+	}
 	
+	if err != nil {
+		diagnostics.Error("deploy", "git:sync failed: %v", err)
+	} else {
+		diagnostics.Info("deploy", "git:sync completed")
+	}
+
 	// 🚀 Signal Traefik Watcher for immediate route regeneration
 	if err == nil {
-		// Create signal file to trigger immediate Traefik route update
-		signalFile := "/tmp/dokku-deploy-signal"
-		if signalErr := os.WriteFile(signalFile, []byte(fmt.Sprintf("deploy:%s:%s", appName, gitURL)), 0644); signalErr == nil {
-			fmt.Printf("[DEPLOY] ✅ Traefik update signal sent for %s\n", appName)
-		} else {
-			fmt.Printf("[DEPLOY] ⚠️ Failed to send Traefik signal: %v\n", signalErr)
-		}
+		signalRouteUpdate(diagnostics, appName, gitURL)
 	}
 	
 	// After deploy, immediately get build logs (for deploy process)
@@ -846,9 +920,51 @@ func DeployFromGit(appName, gitURL, branch string, userID *int) (string, error)
 			// Combine deploy output with build logs
 			combinedOutput := "=== Deploy Command Output ===\n" + result + 
 							  "\n\n=== Build Process Logs ===\n" + buildLogs
-			return combinedOutput, nil
+			return withPostDeployHooks(ctx, appName, hooks, hookOutput+combinedOutput, nil)
 		}
 	}
 	
-	return result, err
-} 
\ No newline at end of file
+	return withPostDeployHooks(ctx, appName, hooks, hookOutput+result, err)
+} 
+
+// signalRouteUpdate creates the signal file that triggers an immediate Traefik route update
+func signalRouteUpdate(diagnostics *DeployDiagnostics, appName, source string) {
+	signalFile := "/tmp/dokku-deploy-signal"
+	if signalErr := os.WriteFile(signalFile, []byte(fmt.Sprintf("deploy:%s:%s", appName, source)), 0644); signalErr == nil {
+		diagnostics.Info("traefik", "route update signal sent")
+	} else {
+		diagnostics.Warn("traefik", "failed to send route update signal: %v", signalErr)
+	}
+}
+
+// DeployFromImageContext deploys an image present on the Docker host with git:from-image, without
+// building the app. The image name must differ from the previously deployed one.
+func DeployFromImageContext(ctx context.Context, appName, image string) (string, error) {
+	diagnostics := DiagnosticsFromContext(ctx)
+	diagnostics.Info("deploy", "deploying %s from image %s", appName, image)
+
+	result, err := CitizenCommandContext(ctx, "git:from-image", appName, image)
+	if err != nil && ctx.Err() != nil {
+		reason := DeploymentErrorStatus(ctx)
+		diagnostics.Error("deploy", "git:from-image aborted (%s)", reason)
+
+		if RequireCapability(FeatureAppLocking) == nil {
+			if _, unlockErr := UnlockApp(appName); unlockErr != nil {
+				diagnostics.Warn("deploy", "failed to release the deploy lock: %v", unlockErr)
+			}
+		}
+
+		if reason == "timeout" {
+			return result, fmt.Errorf("deployment exceeded the maximum build duration of %s", GetMaxBuildDuration())
+		}
+		return result, ErrDeploymentCancelled
+	}
+	if err != nil {
+		diagnostics.Error("deploy", "git:from-image failed: %v", err)
+		return result, err
+	}
+
+	diagnostics.Info("deploy", "git:from-image completed")
+	signalRouteUpdate(diagnostics, appName, image)
+	return result, nil
+}
@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"backend/database/api"
+)
+
+// ErrAppLocked is wrapped by the errors of dokku commands refused because another operation holds
+// the lock of the app
+var ErrAppLocked = errors.New("app is busy")
+
+// dokkuLockRetryDelays are the waits before each retry of an idempotent command refused by the
+// app lock. Short deploys and config changes release it within seconds.
+var dokkuLockRetryDelays = []time.Duration{2 * time.Second, 5 * time.Second, 10 * time.Second}
+
+// dokkuLockPattern matches the messages dokku and its plugins print when the app lock is held
+var dokkuLockPattern = regexp.MustCompile(`(?i)(deploy lock|currently being deployed or locked|lock (is )?in place|app is locked|is locked|lock held|another (deploy|build) is in progress)`)
+
+// idempotentDokkuCommands can run again with the same result, they are retried while the app
+// lock is held. Read-only subcommands (:report, :list...) are retried too.
+var idempotentDokkuCommands = map[string]bool{
+	"config:set":              true,
+	"config:unset":            true,
+	"ports:set":               true,
+	"builder:set":             true,
+	"builder-dockerfile:set":  true,
+	"buildpacks:set":          true,
+	"buildpacks:clear":        true,
+	"buildpacks:set-property": true,
+	"ps:restart":              true,
+	"ps:start":                true,
+	"ps:stop":                 true,
+	"ps:scale":                true,
+	"domains:set":             true,
+}
+
+var readOnlyDokkuSuffixes = []string{":report", ":list", ":show", ":get", ":inspect", ":exists"}
+
+// AppLockConflict is the operation holding the lock of an app, as far as Citizen knows it
+type AppLockConflict struct {
+	// Kind is "deployment" or "operation" for Citizen's own work, "dokku" for a lock taken
+	// outside of Citizen, such as a git push or a command run on the host
+	Kind      string     `json:"kind"`
+	ID        int        `json:"id,omitempty"`
+	Detail    string     `json:"detail,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// AppLockedError is returned by dokku commands refused because the app is locked, once retries
+// are exhausted or right away for commands that can't be retried
+type AppLockedError struct {
+	AppName  string           `json:"app_name"`
+	Command  string           `json:"command"`
+	Attempts int              `json:"attempts"`
+	Conflict *AppLockConflict `json:"conflict,omitempty"`
+	Err      error            `json:"-"`
+}
+
+func (e *AppLockedError) Error() string {
+	message := fmt.Sprintf("app %s is busy", e.AppName)
+	if e.Conflict != nil && e.Conflict.Detail != "" {
+		message += ": " + e.Conflict.Detail
+	}
+	if e.Err != nil {
+		message += " (" + e.Err.Error() + ")"
+	}
+	return message
+}
+
+func (e *AppLockedError) Unwrap() []error {
+	return []error{ErrAppLocked, e.Err}
+}
+
+// isDokkuLockError reports whether a command failed because the app lock is held
+func isDokkuLockError(err error) bool {
+	return err != nil && dokkuLockPattern.MatchString(err.Error())
+}
+
+// isIdempotentDokkuCommand reports whether a command can safely run again after being refused
+func isIdempotentDokkuCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	if idempotentDokkuCommands[args[0]] {
+		return true
+	}
+	for _, suffix := range readOnlyDokkuSuffixes {
+		if strings.HasSuffix(args[0], suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// dokkuCommandApp returns the app a command runs against, its first argument that isn't a flag
+func dokkuCommandApp(args []string) string {
+	for _, arg := range args[1:] {
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+	}
+	return ""
+}
+
+// retryLockedCommand runs again an idempotent command refused by the app lock, backing off
+// between attempts, and returns an AppLockedError once the lock is still held
+func retryLockedCommand(ctx context.Context, args []string, correlationID string, output string, err error) (string, error) {
+	attempts := 1
+	if isIdempotentDokkuCommand(args) {
+		command := strings.Join(args, " ")
+		for _, delay := range dokkuLockRetryDelays {
+			DebugLog("App locked, retrying %s in %s", args[0], delay)
+			select {
+			case <-ctx.Done():
+				return output, err
+			case <-time.After(delay):
+			}
+
+			attempts++
+			startedAt := time.Now()
+			output, err = RunSSHCommandContext(ctx, command)
+			recordCommand(args, correlationID, startedAt, output, err)
+			if !isDokkuLockError(err) {
+				return output, err
+			}
+		}
+	}
+
+	appName := dokkuCommandApp(args)
+	WarnLog("App %s is locked, %s failed after %d attempts", appName, args[0], attempts)
+	return output, &AppLockedError{
+		AppName:  appName,
+		Command:  args[0],
+		Attempts: attempts,
+		Conflict: FindAppLockConflict(ctx, appName),
+		Err:      err,
+	}
+}
+
+// FindAppLockConflict looks up what holds the lock of an app: a deployment running on this
+// instance, else a running operation, else a lock taken outside of Citizen
+func FindAppLockConflict(ctx context.Context, appName string) *AppLockConflict {
+	if deployments := ListRunningDeployments(appName); len(deployments) > 0 {
+		deployment := deployments[0]
+		return &AppLockConflict{
+			Kind:      "deployment",
+			ID:        deployment.ID,
+			Detail:    fmt.Sprintf("deployment #%d in progress", deployment.ID),
+			StartedAt: &deployment.StartedAt,
+		}
+	}
+
+	operations, err := api.Operations.ListOperations(ctx, []string{string(api.OperationRunning)}, 100)
+	if err != nil {
+		DebugLog("Failed to list running operations of %s: %v", appName, err)
+	}
+	// The command may be a step of a running operation, which doesn't conflict with itself
+	ownRequest := CorrelationIDFromContext(ctx)
+	for _, op := range operations {
+		if op.AppName != appName || (ownRequest != "" && op.RequestID != nil && *op.RequestID == ownRequest) {
+			continue
+		}
+		return &AppLockConflict{
+			Kind:      "operation",
+			ID:        op.ID,
+			Detail:    fmt.Sprintf("%s operation #%d in progress", op.Kind, op.ID),
+			StartedAt: &op.CreatedAt,
+		}
+	}
+
+	return &AppLockConflict{
+		Kind:   "dokku",
+		Detail: "locked by a deploy or command outside of Citizen",
+	}
+}
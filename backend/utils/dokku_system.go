@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	pluginNameRegex       = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+	pluginURLRegex        = regexp.MustCompile(`^(https://|git@)[A-Za-z0-9._~:/@+-]+$`)
+	pluginCommittishRegex = regexp.MustCompile(`^[A-Za-z0-9._/-]{1,100}$`)
+	domainNameRegex       = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	dokkuVersionRegex     = regexp.MustCompile(`(\d+\.\d+\.\d+\S*)`)
+)
+
+// DokkuPlugin is an entry of plugin:list
+type DokkuPlugin struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Enabled     bool   `json:"enabled"`
+	Description string `json:"description,omitempty"`
+}
+
+// GetDokkuVersion returns the dokku version of the host (e.g. "0.35.12")
+func GetDokkuVersion() (string, error) {
+	output, err := CitizenCommand("version")
+	if err != nil {
+		return "", err
+	}
+
+	output = strings.TrimSpace(stripANSIColors(output))
+	if match := dokkuVersionRegex.FindString(output); match != "" {
+		return match, nil
+	}
+	return output, nil
+}
+
+// ListPlugins returns the plugins installed on the dokku host
+func ListPlugins() ([]DokkuPlugin, error) {
+	output, err := CitizenCommand("plugin:list")
+	if err != nil {
+		return nil, err
+	}
+	return parsePluginList(output), nil
+}
+
+// parsePluginList parses plugin:list output, e.g. "  letsencrypt  0.20.4 enabled  Automated TLS"
+func parsePluginList(output string) []DokkuPlugin {
+	plugins := []DokkuPlugin{}
+	for _, line := range strings.Split(stripANSIColors(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "--") || strings.HasPrefix(fields[0], "==") {
+			continue
+		}
+		if fields[2] != "enabled" && fields[2] != "disabled" {
+			continue
+		}
+		plugins = append(plugins, DokkuPlugin{
+			Name:        fields[0],
+			Version:     fields[1],
+			Enabled:     fields[2] == "enabled",
+			Description: strings.Join(fields[3:], " "),
+		})
+	}
+	return plugins
+}
+
+// InstallPlugin installs a dokku plugin from a git URL, optionally under a specific name
+func InstallPlugin(pluginURL, name string) (string, error) {
+	if !pluginURLRegex.MatchString(pluginURL) {
+		return "", fmt.Errorf("invalid plugin URL: must be an https:// or git@ repository URL")
+	}
+
+	args := []string{"plugin:install", pluginURL}
+	if name != "" {
+		if !pluginNameRegex.MatchString(name) {
+			return "", fmt.Errorf("invalid plugin name: %s", name)
+		}
+		args = append(args, "--name", name)
+	}
+	return CitizenCommand(args...)
+}
+
+// UpdatePlugin updates an installed dokku plugin, optionally to a specific commit, tag or branch
+func UpdatePlugin(name, committish string) (string, error) {
+	if !pluginNameRegex.MatchString(name) {
+		return "", fmt.Errorf("invalid plugin name: %s", name)
+	}
+
+	args := []string{"plugin:update", name}
+	if committish != "" {
+		if !pluginCommittishRegex.MatchString(committish) {
+			return "", fmt.Errorf("invalid plugin version: %s", committish)
+		}
+		args = append(args, committish)
+	}
+	return CitizenCommand(args...)
+}
+
+// GetGlobalDomains returns the global vhost domains and whether global domains are enabled
+func GetGlobalDomains() ([]string, bool, error) {
+	output, err := CitizenCommand("domains:report", "--global")
+	if err != nil {
+		return nil, false, err
+	}
+
+	report := parseReportSection(stripANSIColors(output))
+	domains := strings.Fields(report["Domains global vhosts"])
+	return domains, report["Domains global enabled"] == "true", nil
+}
+
+// SetGlobalDomains replaces the global vhost domains
+func SetGlobalDomains(domains []string) (string, error) {
+	if len(domains) == 0 {
+		return CitizenCommand("domains:clear-global")
+	}
+	if err := validateDomainNames(domains); err != nil {
+		return "", err
+	}
+	return CitizenCommand(append([]string{"domains:set-global"}, domains...)...)
+}
+
+// AddGlobalDomain adds a global vhost domain
+func AddGlobalDomain(domain string) (string, error) {
+	if err := validateDomainNames([]string{domain}); err != nil {
+		return "", err
+	}
+	return CitizenCommand("domains:add-global", domain)
+}
+
+// RemoveGlobalDomain removes a global vhost domain
+func RemoveGlobalDomain(domain string) (string, error) {
+	if err := validateDomainNames([]string{domain}); err != nil {
+		return "", err
+	}
+	return CitizenCommand("domains:remove-global", domain)
+}
+
+// RestartAllApps restarts every app on the dokku host
+func RestartAllApps() (string, error) {
+	return CitizenCommand("ps:restart", "--all")
+}
+
+// validateDomainNames checks domains are plain host names (optionally wildcard)
+func validateDomainNames(domains []string) error {
+	for _, domain := range domains {
+		if len(domain) > 253 || !domainNameRegex.MatchString(strings.ToLower(domain)) {
+			return fmt.Errorf("invalid domain name: %s", domain)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database/api"
+)
+
+// Verification statuses of a domain, from its DNS records
+const (
+	DomainVerified   = "verified"   // resolves to the server
+	DomainMismatch   = "mismatch"   // resolves to other addresses than the server
+	DomainUnresolved = "unresolved" // has no address records
+	DomainLocal      = "local"      // a development hostname, not checked
+	DomainUnknown    = "unknown"    // resolves, but the server address is unknown
+)
+
+// TLS statuses of a domain, from the certificate served on port 443
+const (
+	TLSValid    = "valid"    // trusted and not expiring soon
+	TLSExpiring = "expiring" // trusted, expires within TLSExpiryWarning
+	TLSExpired  = "expired"  // expired
+	TLSInvalid  = "invalid"  // untrusted or issued for another name
+	TLSMissing  = "missing"  // no TLS handshake on port 443
+	TLSUnknown  = "unknown"  // not checked
+)
+
+const (
+	// TLSExpiryWarning is how long before expiry a certificate is reported as expiring
+	TLSExpiryWarning = 14 * 24 * time.Hour
+	// domainCheckTimeout bounds the DNS lookup and TLS handshake of one domain
+	domainCheckTimeout = 10 * time.Second
+	// domainCheckWorkers is how many domains are checked at once
+	domainCheckWorkers = 8
+)
+
+// CheckDomain resolves a domain, compares its addresses with the server addresses and inspects
+// the certificate it serves. Failures are reported in the statuses and Error of the check.
+func CheckDomain(ctx context.Context, domain string, serverIPs map[string]bool) *api.DomainCheck {
+	check := &api.DomainCheck{
+		Domain:             domain,
+		VerificationStatus: DomainUnknown,
+		TLSStatus:          TLSUnknown,
+		LastCheckedAt:      time.Now(),
+	}
+
+	hostname := strings.ToLower(strings.TrimSuffix(domain, "."))
+	if isLocalDomain(hostname) {
+		check.VerificationStatus = DomainLocal
+		return check
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, domainCheckTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, hostname)
+	if err != nil || len(addrs) == 0 {
+		check.VerificationStatus = DomainUnresolved
+		if err != nil {
+			check.Error = "dns: " + err.Error()
+		}
+		return check
+	}
+	sort.Strings(addrs)
+	check.ResolvedIPs = addrs
+
+	if len(serverIPs) > 0 {
+		check.VerificationStatus = DomainMismatch
+		for _, addr := range addrs {
+			if serverIPs[addr] {
+				check.VerificationStatus = DomainVerified
+				break
+			}
+		}
+	}
+
+	checkCertificate(ctx, hostname, check)
+	return check
+}
+
+// isLocalDomain reports whether a hostname is a development hostname public DNS can't resolve
+func isLocalDomain(hostname string) bool {
+	return isLocalHostname(hostname) || strings.HasSuffix(hostname, ".localhost") || strings.HasSuffix(hostname, ".local")
+}
+
+// checkCertificate fetches the certificate served for a hostname and verifies it against the
+// system roots, so untrusted certificates still report their expiry
+func checkCertificate(ctx context.Context, hostname string, check *api.DomainCheck) {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{},
+		Config:    &tls.Config{ServerName: hostname, InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(hostname, "443"))
+	if err != nil {
+		check.TLSStatus = TLSMissing
+		check.Error = "tls: " + err.Error()
+		return
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		check.TLSStatus = TLSMissing
+		check.Error = "tls: no certificate served"
+		return
+	}
+
+	leaf := certs[0]
+	expiresAt := leaf.NotAfter
+	check.TLSExpiresAt = &expiresAt
+	check.TLSIssuer = leaf.Issuer.CommonName
+	if len(leaf.Issuer.Organization) > 0 {
+		check.TLSIssuer = leaf.Issuer.Organization[0]
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	now := time.Now()
+	_, verifyErr := leaf.Verify(x509.VerifyOptions{
+		DNSName:       hostname,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+
+	switch {
+	case now.After(expiresAt):
+		check.TLSStatus = TLSExpired
+	case verifyErr != nil:
+		check.TLSStatus = TLSInvalid
+		check.Error = "tls: " + verifyErr.Error()
+	case expiresAt.Sub(now) < TLSExpiryWarning:
+		check.TLSStatus = TLSExpiring
+	default:
+		check.TLSStatus = TLSValid
+	}
+}
+
+// ServerIPs resolves MAIN_DOMAIN to the addresses app domains are expected to point to. It
+// returns nil when MAIN_DOMAIN is not set or doesn't resolve.
+func ServerIPs(ctx context.Context) map[string]bool {
+	mainDomain := os.Getenv("MAIN_DOMAIN")
+	if mainDomain == "" || isLocalHostname(mainDomain) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, domainCheckTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, mainDomain)
+	if err != nil {
+		WarnLog("Failed to resolve MAIN_DOMAIN %s: %v", mainDomain, err)
+		return nil
+	}
+
+	ips := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		ips[addr] = true
+	}
+	return ips
+}
+
+// CheckAllDomains checks every domain of every app, stores the results and forgets the checks
+// of domains no app serves anymore. Custom domains registered in the database are marked so.
+func CheckAllDomains(ctx context.Context) ([]api.DomainCheck, error) {
+	apps, err := ListApps()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list apps: %w", err)
+	}
+
+	custom := make(map[string]bool)
+	if domains, err := api.Settings.GetAllActiveCustomDomains(ctx); err == nil {
+		for _, domain := range domains {
+			custom[domain.Domain] = true
+		}
+	} else {
+		WarnLog("Failed to list custom domains for domain checks: %v", err)
+	}
+
+	domainApps := make(map[string]string)
+	complete := true
+	for _, app := range apps {
+		domains, err := ListDomains(app)
+		if err != nil {
+			WarnLog("Failed to list domains of %s: %v", app, err)
+			complete = false
+			continue
+		}
+		for _, domain := range domains {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				domainApps[domain] = app
+			}
+		}
+	}
+
+	domains := make([]string, 0, len(domainApps))
+	for domain := range domainApps {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	serverIPs := ServerIPs(ctx)
+	checks := make([]api.DomainCheck, len(domains))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < domainCheckWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				check := CheckDomain(ctx, domains[i], serverIPs)
+				check.AppName = domainApps[domains[i]]
+				check.IsCustom = custom[domains[i]]
+				checks[i] = *check
+			}
+		}()
+	}
+	for i := range domains {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := range checks {
+		if err := api.Settings.UpsertDomainCheck(ctx, &checks[i]); err != nil {
+			WarnLog("Failed to save domain check of %s: %v", checks[i].Domain, err)
+		}
+	}
+	// Keep the checks of apps whose domains couldn't be listed this time
+	if complete {
+		if _, err := api.Settings.PruneDomainChecks(ctx, domains); err != nil {
+			WarnLog("Failed to prune domain checks: %v", err)
+		}
+	}
+
+	return checks, nil
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"backend/database/api"
+)
+
+// Statuses of a domain propagation watch
+const (
+	PropagationPending  = "pending"   // DNS or the app route isn't there yet, checked again later
+	PropagationLive     = "live"      // resolves to the server and the app answers through it
+	PropagationTimedOut = "timed_out" // not live within DomainPropagationWindow
+)
+
+// HostNotFoundHeader marks the "app not found" responses of hosts Traefik routes to no app
+const HostNotFoundHeader = "X-Citizen-Host-Not-Found"
+
+const (
+	// DomainPropagationWindow is how long a new custom domain is re-checked before giving up
+	DomainPropagationWindow = 24 * time.Hour
+	// domainPropagationLease keeps a domain being checked from being picked up by another run
+	domainPropagationLease = 5 * time.Minute
+	// domainPropagationBatch bounds the domains checked per run of the propagation task
+	domainPropagationBatch = 20
+)
+
+// domainPropagationDelays are the waits between checks, DNS changes usually show up within
+// minutes; later checks are an hour apart
+var domainPropagationDelays = []time.Duration{
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+}
+
+// propagationHTTPClient requests the domain through Traefik. Certificates are not verified, the
+// certificate status is reported by the domain check, and may lag behind the route while
+// Let's Encrypt issues it.
+var propagationHTTPClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	},
+}
+
+// StartDomainPropagation watches a custom domain just added to an app, checking it right away
+// and then on the schedule of domainPropagationDelays until it goes live or
+// DomainPropagationWindow passes. Development hostnames are not watched.
+func StartDomainPropagation(ctx context.Context, appName, domain string) error {
+	if isLocalDomain(strings.ToLower(strings.TrimSuffix(domain, "."))) {
+		return nil
+	}
+	if _, err := api.Settings.StartDomainPropagation(ctx, appName, domain); err != nil {
+		return err
+	}
+	DebugLog("Watching propagation of domain %s of %s", domain, appName)
+	return nil
+}
+
+// RunDomainPropagationChecks checks the watched domains due for a check and returns how many
+// went live
+func RunDomainPropagationChecks(ctx context.Context) (int, error) {
+	propagations, err := api.Settings.ClaimDueDomainPropagations(ctx, domainPropagationLease, domainPropagationBatch)
+	if err != nil || len(propagations) == 0 {
+		return 0, err
+	}
+
+	serverIPs := ServerIPs(ctx)
+	live := 0
+	for i := range propagations {
+		if checkDomainPropagation(ctx, &propagations[i], serverIPs) {
+			live++
+		}
+	}
+	return live, nil
+}
+
+// checkDomainPropagation checks whether a watched domain resolves to the server and the app
+// answers through it, records the outcome and reports whether the domain went live
+func checkDomainPropagation(ctx context.Context, p *api.DomainPropagation, serverIPs map[string]bool) bool {
+	// The domain may have been removed or moved to another app since the watch started
+	domains, err := api.Settings.GetCustomDomains(ctx, p.AppName)
+	if err == nil && !slices.Contains(domains, p.Domain) {
+		if err := api.Settings.DeleteDomainPropagation(ctx, p.Domain); err != nil {
+			WarnLog("Failed to stop watching domain %s: %v", p.Domain, err)
+		}
+		return false
+	}
+
+	check := CheckDomain(ctx, p.Domain, serverIPs)
+	check.AppName = p.AppName
+	check.IsCustom = true
+	if err := api.Settings.UpsertDomainCheck(ctx, check); err != nil {
+		WarnLog("Failed to save domain check of %s: %v", p.Domain, err)
+	}
+
+	now := time.Now()
+	p.Attempts++
+	p.LastCheckedAt = &now
+	p.VerificationStatus = check.VerificationStatus
+	p.HTTPStatus = nil
+	p.Error = check.Error
+
+	// Without the server addresses DNS can't be compared, the app answering tells instead
+	resolves := check.VerificationStatus == DomainVerified || check.VerificationStatus == DomainUnknown
+	if resolves {
+		status, err := domainAnswers(ctx, p.Domain)
+		if status != 0 {
+			p.HTTPStatus = &status
+		}
+		if err == nil {
+			p.Status = PropagationLive
+			p.LiveAt = &now
+			p.Error = ""
+		} else {
+			p.Error = "http: " + err.Error()
+		}
+	} else if p.Error == "" {
+		p.Error = fmt.Sprintf("dns: resolves to %s instead of the server", strings.Join(check.ResolvedIPs, ", "))
+	}
+
+	if p.Status != PropagationLive {
+		delay := time.Hour
+		if p.Attempts-1 < len(domainPropagationDelays) {
+			delay = domainPropagationDelays[p.Attempts-1]
+		}
+		p.NextCheckAt = now.Add(delay)
+		if p.NextCheckAt.After(p.StartedAt.Add(DomainPropagationWindow)) {
+			p.Status = PropagationTimedOut
+			WarnLog("Domain %s of %s not live after %s: %s", p.Domain, p.AppName, DomainPropagationWindow, p.Error)
+		}
+	}
+
+	if err := api.Settings.RecordDomainPropagationCheck(ctx, p); err != nil {
+		WarnLog("Failed to record propagation check of %s: %v", p.Domain, err)
+	}
+	if p.Status != PropagationLive {
+		return false
+	}
+
+	InfoLog("Domain %s of %s is live after %d checks", p.Domain, p.AppName, p.Attempts)
+	EmitAppEvent(p.AppName, EventDomainLive, map[string]interface{}{
+		"domain":     p.Domain,
+		"started_at": p.StartedAt,
+		"live_at":    now,
+		"tls_status": check.TLSStatus,
+	})
+	return true
+}
+
+// domainAnswers requests a domain over HTTP, following redirects like the HTTPS one, and returns
+// the status of the response. It fails when Traefik has no route for the host or can't reach the
+// app; any other response, errors included, is the app answering.
+func domainAnswers(ctx context.Context, domain string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+domain+"/", nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "Citizen-Domain-Check/1.0")
+	resp, err := propagationHTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.Header.Get(HostNotFoundHeader) != "":
+		return resp.StatusCode, fmt.Errorf("no app is routed at %s yet", domain)
+	case resp.StatusCode == http.StatusNotFound && strings.TrimSpace(string(body)) == "404 page not found":
+		// Traefik's own answer for hosts it has no router for
+		return resp.StatusCode, fmt.Errorf("no route for %s in Traefik yet", domain)
+	case resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable ||
+		resp.StatusCode == http.StatusGatewayTimeout:
+		return resp.StatusCode, fmt.Errorf("the app doesn't answer through Traefik (%d)", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
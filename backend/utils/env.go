@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Statuses of a single environment variable in an update
+const (
+	EnvKeyApplied    = "applied"    // the effective value matches the requested one
+	EnvKeyFailed     = "failed"     // the effective value differs from the requested one
+	EnvKeyUnverified = "unverified" // the command succeeded but the config couldn't be read back
+)
+
+// EnvKeyResult is the outcome of an update for one environment variable
+type EnvKeyResult struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// EnvUpdateResult is the verified outcome of an environment update
+type EnvUpdateResult struct {
+	Keys         []EnvKeyResult `json:"keys"`
+	Applied      int            `json:"applied"`
+	Failed       int            `json:"failed"`
+	Restarted    bool           `json:"restarted"`
+	RestartError string         `json:"restart_error,omitempty"`
+	// RestartPending is set when a deployed app changed without a restart
+	RestartPending bool   `json:"restart_pending"`
+	Output         string `json:"output,omitempty"`
+}
+
+// Changed reports whether any variable may have changed, so the app needs a restart to pick it up
+func (r *EnvUpdateResult) Changed() bool {
+	return r.Failed < len(r.Keys)
+}
+
+// ExportEnv reads the exact environment of an app with config:export, unlike GetEnv which parses
+// the display output of config:show
+func ExportEnv(appName string) (map[string]string, error) {
+	output, err := CitizenCommand("config:export", "--format", "json", appName)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string)
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &env); err != nil {
+		return nil, fmt.Errorf("failed to parse the config of %s: %w", appName, err)
+	}
+	return env, nil
+}
+
+// IsAppDeployed reports whether an app has been deployed, i.e. has containers to restart
+func IsAppDeployed(appName string) (bool, error) {
+	output, err := CitizenCommand("ps:report", appName, "--deployed")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(output) == "true", nil
+}
+
+// SetEnvVerified sets environment variables without restarting, reads the config back to confirm
+// the effective value of every key, then restarts the app once if anything changed and restart is
+// set. A failed import can still have applied some keys, the read back tells which.
+func SetEnvVerified(appName string, envVars map[string]string, restart bool) (*EnvUpdateResult, error) {
+	keys := make([]string, 0, len(envVars))
+	for key := range envVars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	output, setErr := ImportEnv(context.Background(), appName, envVars, false)
+
+	result := &EnvUpdateResult{Output: output}
+	current, readErr := ExportEnv(appName)
+	for _, key := range keys {
+		keyResult := EnvKeyResult{Key: key}
+		switch {
+		case readErr != nil && setErr == nil:
+			keyResult.Status = EnvKeyUnverified
+			keyResult.Error = "could not read the config back: " + readErr.Error()
+		case readErr != nil:
+			keyResult.Status = EnvKeyFailed
+			keyResult.Error = setErr.Error()
+		case current[key] == envVars[key]:
+			keyResult.Status = EnvKeyApplied
+			result.Applied++
+		default:
+			keyResult.Status = EnvKeyFailed
+			keyResult.Error = "value was not applied"
+			if setErr != nil {
+				keyResult.Error = setErr.Error()
+			}
+		}
+		if keyResult.Status == EnvKeyFailed {
+			result.Failed++
+		}
+		result.Keys = append(result.Keys, keyResult)
+	}
+
+	if result.Changed() {
+		restartEnvChange(appName, result, restart)
+	}
+
+	if setErr != nil && result.Applied == 0 {
+		return result, setErr
+	}
+	return result, nil
+}
+
+// ImportEnv sets environment variables through the citizen-env plugin, which reads them from the
+// SSH session's stdin: their values never appear on a command line, locally or on the host
+func ImportEnv(ctx context.Context, appName string, envVars map[string]string, restart bool) (string, error) {
+	if err := RequireCapability(FeatureEnvImport); err != nil {
+		return "", err
+	}
+
+	keys := make([]string, 0, len(envVars))
+	for key := range envVars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var input strings.Builder
+	for _, key := range keys {
+		input.WriteString(key + "=" + base64.StdEncoding.EncodeToString([]byte(envVars[key])) + "\n")
+	}
+
+	args := []string{"citizen-env:import", appName}
+	if !restart {
+		args = append(args, "--no-restart")
+	}
+	return runCommandInput(ctx, args, input.String())
+}
+
+// runCommandInput runs a dokku command reading input from the SSH session's stdin, traced like
+// the commands of CitizenCommandContext
+func runCommandInput(ctx context.Context, args []string, input string) (string, error) {
+	correlationID := commandCorrelationID(ctx, args)
+	if correlationID != "" {
+		ctx = WithCorrelationID(ctx, correlationID)
+	}
+	startedAt := time.Now()
+	output, err := RunSSHCommandInput(ctx, strings.Join(args, " "), strings.NewReader(input))
+	recordCommand(args, correlationID, startedAt, output, err)
+	return output, err
+}
+
+// RemoveEnvVerified unsets an environment variable, with or without restarting the app
+func RemoveEnvVerified(appName, key string, restart bool) (*EnvUpdateResult, error) {
+	output, err := CitizenCommand("config:unset", "--no-restart", appName, key)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &EnvUpdateResult{
+		Keys:    []EnvKeyResult{{Key: key, Status: EnvKeyApplied}},
+		Applied: 1,
+		Output:  output,
+	}
+	restartEnvChange(appName, result, restart)
+	return result, nil
+}
+
+// restartEnvChange restarts a deployed app once to apply its new environment or, without
+// restart, marks the result as waiting for one
+func restartEnvChange(appName string, result *EnvUpdateResult, restart bool) {
+	deployed, err := IsAppDeployed(appName)
+	if err != nil {
+		// Assume the app runs, the change then waits for a restart like any other
+		result.RestartPending = true
+		if restart {
+			result.RestartError = "could not check whether the app is deployed: " + err.Error()
+		}
+		return
+	}
+	// Apps that were never deployed pick up their environment on the first deploy
+	if !deployed {
+		return
+	}
+	if !restart {
+		result.RestartPending = true
+		return
+	}
+
+	if _, err := RestartApp(appName); err != nil {
+		result.RestartPending = true
+		result.RestartError = err.Error()
+		return
+	}
+	result.Restarted = true
+}
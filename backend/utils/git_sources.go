@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/database/api"
+)
+
+// GitSourceSettingKey is the system setting holding the git source config as JSON
+const GitSourceSettingKey = "deploy.git_sources"
+
+// AllowedGitSchemes are the URL schemes non-GitHub repositories can be deployed from
+var AllowedGitSchemes = []string{"https", "http"}
+
+const (
+	// gitSourceCheckTimeout bounds the reachability check of a repository
+	gitSourceCheckTimeout = 10 * time.Second
+	// maxRefAdvertisement bounds how much of the ref list of a repository is read
+	maxRefAdvertisement = 4 << 20
+)
+
+// ErrGitSourceRejected is returned for git URLs the configuration doesn't allow
+var ErrGitSourceRejected = errors.New("git source not allowed")
+
+// ErrGitSourceUnreachable is returned when a repository or its branch can't be found
+var ErrGitSourceUnreachable = errors.New("git source unreachable")
+
+// commitRefPattern matches refs that look like commit SHAs, which ref advertisements don't list
+var commitRefPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// IsCommitSHA reports whether ref is an abbreviated or full commit SHA
+func IsCommitSHA(ref string) bool {
+	return commitRefPattern.MatchString(ref)
+}
+
+// GitSourceConfig restricts where apps can be deployed from, GitHub excepted
+type GitSourceConfig struct {
+	// AllowedHosts limits deploys to these hosts, "*.example.com" matching subdomains. Empty
+	// allows any public host.
+	AllowedHosts []string `json:"allowed_hosts"`
+}
+
+// GitSourceCheck is the outcome of validating a git URL before a deploy
+type GitSourceCheck struct {
+	Host      string `json:"host"`
+	Reachable bool   `json:"reachable"`
+	Branch    string `json:"branch"`
+	// BranchVerified is false for refs that can't be checked, like commit SHAs
+	BranchVerified bool `json:"branch_verified"`
+}
+
+// GetGitSourceConfig returns the stored git source config, or one allowing any host
+func GetGitSourceConfig(ctx context.Context) *GitSourceConfig {
+	config := &GitSourceConfig{AllowedHosts: []string{}}
+
+	value, err := api.Settings.GetSystemSetting(ctx, GitSourceSettingKey)
+	if err != nil {
+		if !errors.Is(err, api.ErrSettingNotFound) {
+			WarnLog("Failed to load git source config, allowing any host: %v", err)
+		}
+		return config
+	}
+
+	var stored GitSourceConfig
+	if err := json.Unmarshal([]byte(value), &stored); err != nil || stored.Validate() != nil {
+		WarnLog("Invalid git source config stored, allowing any host: %v", err)
+		return config
+	}
+	return &stored
+}
+
+// SaveGitSourceConfig validates and stores the git source config
+func SaveGitSourceConfig(ctx context.Context, config *GitSourceConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return api.Settings.SetSystemSetting(ctx, GitSourceSettingKey, string(value))
+}
+
+// Validate normalizes the allowed hosts and checks they are plain hostnames or wildcards
+func (c *GitSourceConfig) Validate() error {
+	if c.AllowedHosts == nil {
+		c.AllowedHosts = []string{}
+	}
+	for i, host := range c.AllowedHosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		name := strings.TrimPrefix(host, "*.")
+		if name == "" || strings.ContainsAny(name, "/:@* ") {
+			return fmt.Errorf("invalid allowed host %q", c.AllowedHosts[i])
+		}
+		c.AllowedHosts[i] = host
+	}
+	return nil
+}
+
+// allowsHost reports whether a hostname matches the allowed hosts
+func (c *GitSourceConfig) allowsHost(hostname string) bool {
+	if len(c.AllowedHosts) == 0 {
+		return true
+	}
+	for _, allowed := range c.AllowedHosts {
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(hostname, "."+suffix) {
+				return true
+			}
+		} else if hostname == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateGitSource checks a non-GitHub git URL before it is deployed: the scheme must be
+// allowed, the URL must carry no credentials, the host must be public and allowed by the git
+// source config, and the repository must answer with the branch. GitHub URLs return nil, they
+// are checked with the GitHub API and the user's token.
+func ValidateGitSource(ctx context.Context, gitURL, branch string) (*GitSourceCheck, error) {
+	if _, _, ok := parseGitHubRepoURL(gitURL); ok {
+		return nil, nil
+	}
+
+	parsed, err := url.Parse(strings.TrimSpace(gitURL))
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: %q is not a valid repository URL", ErrGitSourceRejected, gitURL)
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	allowedScheme := false
+	for _, allowed := range AllowedGitSchemes {
+		if scheme == allowed {
+			allowedScheme = true
+		}
+	}
+	if !allowedScheme {
+		return nil, fmt.Errorf("%w: scheme %q is not supported, use one of %s", ErrGitSourceRejected, parsed.Scheme,
+			strings.Join(AllowedGitSchemes, ", "))
+	}
+	if parsed.User != nil {
+		return nil, fmt.Errorf("%w: repository URLs must not contain credentials", ErrGitSourceRejected)
+	}
+
+	hostname := strings.ToLower(parsed.Hostname())
+	if !GetGitSourceConfig(ctx).allowsHost(hostname) {
+		return nil, fmt.Errorf("%w: host %s is not in the allowed git hosts", ErrGitSourceRejected, hostname)
+	}
+
+	check := &GitSourceCheck{Host: hostname, Branch: branch}
+	refs, err := fetchGitRefs(ctx, parsed)
+	if err != nil {
+		return check, err
+	}
+	check.Reachable = true
+
+	if commitRefPattern.MatchString(branch) {
+		return check, nil
+	}
+	if !refs["refs/heads/"+branch] && !refs["refs/tags/"+branch] {
+		return check, fmt.Errorf("%w: branch %s not found in %s", ErrGitSourceUnreachable, branch, gitURL)
+	}
+	check.BranchVerified = true
+	return check, nil
+}
+
+// fetchGitRefs lists the refs of a repository with the smart HTTP protocol, the request git
+// clone starts with
+func fetchGitRefs(ctx context.Context, repoURL *url.URL) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitSourceCheckTimeout)
+	defer cancel()
+
+	refsURL := *repoURL
+	refsURL.Path = strings.TrimSuffix(refsURL.Path, "/") + "/info/refs"
+	refsURL.RawQuery = "service=git-upload-pack"
+
+	req, err := http.NewRequestWithContext(ctx, "GET", refsURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGitSourceRejected, err)
+	}
+	req.Header.Set("User-Agent", "git/2.0 (citizen)")
+
+	resp, err := gitSourceClient.Do(req)
+	if err != nil {
+		if errors.Is(err, errPrivateGitHost) {
+			return nil, fmt.Errorf("%w: %v", ErrGitSourceRejected, err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrGitSourceUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("%w: the repository requires authentication, only public repositories can be deployed by URL", ErrGitSourceUnreachable)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%w: the server answered HTTP %d, is this a git repository?", ErrGitSourceUnreachable, resp.StatusCode)
+	case !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/x-git-upload-pack-advertisement"):
+		return nil, fmt.Errorf("%w: the server doesn't speak the git smart HTTP protocol", ErrGitSourceUnreachable)
+	}
+
+	return parseRefAdvertisement(io.LimitReader(resp.Body, maxRefAdvertisement))
+}
+
+// parseRefAdvertisement reads the ref names of a git-upload-pack advertisement, a sequence of
+// pkt-lines "<4 hex length><sha> <ref>[\0capabilities]\n"
+func parseRefAdvertisement(r io.Reader) (map[string]bool, error) {
+	reader := bufio.NewReader(r)
+	refs := make(map[string]bool)
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return refs, nil
+			}
+			return nil, fmt.Errorf("%w: truncated ref advertisement", ErrGitSourceUnreachable)
+		}
+		length, err := strconv.ParseUint(string(header), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid ref advertisement", ErrGitSourceUnreachable)
+		}
+		if length < 4 {
+			continue // flush packet
+		}
+
+		payload := make([]byte, length-4)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return nil, fmt.Errorf("%w: truncated ref advertisement", ErrGitSourceUnreachable)
+		}
+		line := strings.TrimSuffix(string(payload), "\n")
+		if strings.HasPrefix(line, "#") {
+			continue // "# service=git-upload-pack"
+		}
+		line, _, _ = strings.Cut(line, "\x00")
+		if _, ref, ok := strings.Cut(line, " "); ok {
+			refs[ref] = true
+		}
+	}
+}
+
+// errPrivateGitHost is returned when a git URL resolves to a loopback, private or link-local
+// address, which would let deploys probe the internal network
+var errPrivateGitHost = errors.New("repository host resolves to a private address")
+
+// gitSourceClient checks repositories following a few redirects, and never connects to private
+// addresses, whatever the URL or its redirects resolve to
+var gitSourceClient = &http.Client{
+	Timeout: gitSourceCheckTimeout,
+	Transport: &http.Transport{
+		DialContext:         publicOnlyDialer(gitSourceCheckTimeout, errPrivateGitHost).DialContext,
+		TLSHandshakeTimeout: gitSourceCheckTimeout,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return errors.New("too many redirects")
+		}
+		return nil
+	},
+}
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 )
@@ -156,18 +157,24 @@ type GitHubWebhook struct {
 	Events []string `json:"events"`
 }
 
-// GetGitHubOAuthURL returns the GitHub OAuth authorization URL
-func GetGitHubOAuthURL(state string) (string, error) {
-	clientID, _, redirectURI, _ := GetGitHubConfig()
-	if clientID == "" || redirectURI == "" {
+// GetGitHubOAuthURL returns the GitHub OAuth authorization URL. redirectURI must be one of the
+// allowed redirect URIs (see SelectGitHubRedirectURI); empty uses the default.
+func GetGitHubOAuthURL(state, redirectURI string) (string, error) {
+	clientID, _, defaultURI, _ := GetGitHubConfig()
+	if clientID == "" || defaultURI == "" {
 		return "", fmt.Errorf("github oauth not configured")
 	}
+	if redirectURI == "" {
+		redirectURI = defaultURI
+	} else if !slices.Contains(GitHubRedirectURIs(), redirectURI) {
+		return "", fmt.Errorf("redirect URI %s is not allowed", redirectURI)
+	}
 	
 	baseURL := "https://github.com/login/oauth/authorize"
 	params := url.Values{}
 	params.Add("client_id", clientID)
 	params.Add("redirect_uri", redirectURI)
-	params.Add("scope", "repo,read:user,user:email")
+	params.Add("scope", strings.Join(GitHubRequiredScopes, ","))
 	params.Add("state", state)
 	
 	return fmt.Sprintf("%s?%s", baseURL, params.Encode()), nil
@@ -193,8 +200,7 @@ func ExchangeCodeForToken(code string) (*GitHubOAuthResponse, error) {
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doGitHubRequest(req)
 	if err != nil {
 		return nil, err
 	}
@@ -223,8 +229,7 @@ func GetGitHubUser(accessToken string) (*GitHubUser, error) {
 	req.Header.Set("Authorization", "token "+accessToken)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doGitHubRequest(req)
 	if err != nil {
 		return nil, err
 	}
@@ -255,8 +260,7 @@ func GetUserRepositories(accessToken string, page int) ([]GitHubRepository, erro
 	req.Header.Set("Authorization", "token "+accessToken)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doGitHubRequest(req)
 	if err != nil {
 		return nil, err
 	}
@@ -311,7 +315,7 @@ func CreateWebhook(accessToken, owner, repo, webhookURL string) (*GitHubWebhook,
 	webhook := map[string]interface{}{
 		"name":   "web",
 		"active": true,
-		"events": []string{"push", "pull_request"},
+		"events": []string{"push", "pull_request", "issue_comment"},
 		"config": map[string]interface{}{
 			"url":          webhookURL,
 			"content_type": "json",
@@ -335,8 +339,7 @@ func CreateWebhook(accessToken, owner, repo, webhookURL string) (*GitHubWebhook,
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	req.Header.Set("Content-Type", "application/json")
 	
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doGitHubRequest(req)
 	if err != nil {
 		return nil, err
 	}
@@ -370,8 +373,7 @@ func DeleteWebhook(accessToken, owner, repo string, webhookID int64) error {
 	req.Header.Set("Authorization", "token "+accessToken)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doGitHubRequest(req)
 	if err != nil {
 		return err
 	}
@@ -397,8 +399,7 @@ func GetRepositoryInfo(accessToken, owner, repo string) (*GitHubRepository, erro
 	req.Header.Set("Authorization", "token "+accessToken)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doGitHubRequest(req)
 	if err != nil {
 		return nil, err
 	}
@@ -421,6 +422,89 @@ func GetRepositoryInfo(accessToken, owner, repo string) (*GitHubRepository, erro
 	return &repository, nil
 }
 
+// GitHubPullRequestHead is the branch and commit a pull request proposes
+type GitHubPullRequestHead struct {
+	Ref      string
+	SHA      string
+	RepoName string // full name of the head repository, differs from the base for forks
+}
+
+// GetPullRequestHead gets the head branch and commit of a pull request
+func GetPullRequestHead(accessToken, fullName string, number int) (*GitHubPullRequestHead, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/pulls/%d", fullName, number)
+	
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	
+	req.Header.Set("Authorization", "token "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	
+	resp, err := doGitHubRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pull request #%d not found (HTTP %d)", number, resp.StatusCode)
+	}
+	
+	var pullRequest struct {
+		Head struct {
+			Ref  string `json:"ref"`
+			SHA  string `json:"sha"`
+			Repo *struct {
+				FullName string `json:"full_name"`
+			} `json:"repo"`
+		} `json:"head"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pullRequest); err != nil {
+		return nil, err
+	}
+	
+	head := &GitHubPullRequestHead{
+		Ref: pullRequest.Head.Ref,
+		SHA: pullRequest.Head.SHA,
+	}
+	if pullRequest.Head.Repo != nil {
+		head.RepoName = pullRequest.Head.Repo.FullName
+	}
+	return head, nil
+}
+
+// CreateIssueComment posts a comment on an issue or pull request
+func CreateIssueComment(accessToken, fullName string, number int, body string) error {
+	jsonData, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	
+	url := fmt.Sprintf("https://api.github.com/repos/%s/issues/%d/comments", fullName, number)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	
+	req.Header.Set("Authorization", "token "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+	
+	resp, err := doGitHubRequest(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	
+	if resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to create comment: %s", string(respBody))
+	}
+	
+	return nil
+}
+
 // ValidateGitHubSignature validates GitHub webhook signature
 func ValidateGitHubSignature(payload []byte, signature string) bool {
 	if !strings.HasPrefix(signature, "sha256=") {
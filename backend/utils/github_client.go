@@ -0,0 +1,302 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// githubRequestTimeout bounds a single GitHub HTTP request
+	githubRequestTimeout = 15 * time.Second
+	// githubMaxRetries is how many times a rate-limited or failed request is retried
+	githubMaxRetries = 3
+	// githubMaxWait is the longest we block a caller waiting for a rate limit to reset
+	githubMaxWait = 60 * time.Second
+)
+
+// ErrGitHubRateLimited is returned when the token's quota is exhausted for longer than githubMaxWait
+var ErrGitHubRateLimited = errors.New("GitHub API rate limit exceeded")
+
+// githubHTTPClient is shared by all GitHub API calls
+var githubHTTPClient = &http.Client{Timeout: githubRequestTimeout}
+
+// GitHubRateLimit is the last known rate-limit state of a token
+type GitHubRateLimit struct {
+	Limit              int        `json:"limit"`
+	Remaining          int        `json:"remaining"`
+	Used               int        `json:"used"`
+	Resource           string     `json:"resource,omitempty"`
+	ResetAt            time.Time  `json:"reset_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	SecondaryLimitedAt *time.Time `json:"secondary_limited_at,omitempty"`
+}
+
+// GitHubClientStats are process-wide counters for GitHub API usage
+type GitHubClientStats struct {
+	Requests    int64 `json:"requests"`
+	Retries     int64 `json:"retries"`
+	RateLimited int64 `json:"rate_limited"`
+	Failures    int64 `json:"failures"`
+}
+
+var (
+	githubRateLimits   = make(map[string]*GitHubRateLimit)
+	githubRateLimitsMu sync.RWMutex
+
+	githubRequests    int64
+	githubRetries     int64
+	githubRateLimited int64
+	githubFailures    int64
+)
+
+// githubTokenKey identifies a token in the rate-limit table without keeping the token itself
+func githubTokenKey(accessToken string) string {
+	if accessToken == "" {
+		return "anonymous"
+	}
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:8])
+}
+
+// requestToken extracts the token from a request's Authorization header
+func requestToken(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	auth = strings.TrimPrefix(auth, "token ")
+	return strings.TrimPrefix(auth, "Bearer ")
+}
+
+// GetGitHubRateLimit returns the last known rate limit for a token, or nil if none was observed
+func GetGitHubRateLimit(accessToken string) *GitHubRateLimit {
+	githubRateLimitsMu.RLock()
+	defer githubRateLimitsMu.RUnlock()
+
+	limit, ok := githubRateLimits[githubTokenKey(accessToken)]
+	if !ok {
+		return nil
+	}
+	snapshot := *limit
+	return &snapshot
+}
+
+// GetGitHubClientStats returns the process-wide GitHub API counters
+func GetGitHubClientStats() GitHubClientStats {
+	return GitHubClientStats{
+		Requests:    atomic.LoadInt64(&githubRequests),
+		Retries:     atomic.LoadInt64(&githubRetries),
+		RateLimited: atomic.LoadInt64(&githubRateLimited),
+		Failures:    atomic.LoadInt64(&githubFailures),
+	}
+}
+
+// FetchGitHubRateLimit queries the rate_limit endpoint (which does not count against the quota)
+func FetchGitHubRateLimit(accessToken string) (*GitHubRateLimit, error) {
+	req, err := http.NewRequest("GET", "https://api.github.com/rate_limit", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "token "+accessToken)
+	}
+
+	resp, err := doGitHubRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub rate_limit returned HTTP %d", resp.StatusCode)
+	}
+
+	limit := GetGitHubRateLimit(accessToken)
+	if limit == nil {
+		return nil, fmt.Errorf("GitHub rate_limit response had no rate limit headers")
+	}
+	return limit, nil
+}
+
+// updateGitHubRateLimit records the rate-limit headers of a response
+func updateGitHubRateLimit(key string, resp *http.Response) {
+	remainingHeader := resp.Header.Get("X-RateLimit-Remaining")
+	if remainingHeader == "" {
+		return
+	}
+
+	limit := &GitHubRateLimit{UpdatedAt: time.Now()}
+	limit.Remaining, _ = strconv.Atoi(remainingHeader)
+	limit.Limit, _ = strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	limit.Used, _ = strconv.Atoi(resp.Header.Get("X-RateLimit-Used"))
+	limit.Resource = resp.Header.Get("X-RateLimit-Resource")
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		limit.ResetAt = time.Unix(reset, 0)
+	}
+
+	githubRateLimitsMu.Lock()
+	if previous, ok := githubRateLimits[key]; ok {
+		limit.SecondaryLimitedAt = previous.SecondaryLimitedAt
+	}
+	githubRateLimits[key] = limit
+	githubRateLimitsMu.Unlock()
+}
+
+// markSecondaryLimited records that a token hit a secondary (abuse) rate limit
+func markSecondaryLimited(key string) {
+	now := time.Now()
+
+	githubRateLimitsMu.Lock()
+	defer githubRateLimitsMu.Unlock()
+	if limit, ok := githubRateLimits[key]; ok {
+		limit.SecondaryLimitedAt = &now
+		return
+	}
+	githubRateLimits[key] = &GitHubRateLimit{UpdatedAt: now, SecondaryLimitedAt: &now}
+}
+
+// primaryLimitWait returns how long to wait before the token's exhausted quota resets
+func primaryLimitWait(key string) time.Duration {
+	githubRateLimitsMu.RLock()
+	defer githubRateLimitsMu.RUnlock()
+
+	limit, ok := githubRateLimits[key]
+	if !ok || limit.Remaining > 0 || limit.ResetAt.IsZero() {
+		return 0
+	}
+	return time.Until(limit.ResetAt)
+}
+
+// rateLimitBackoff decides whether a response is rate limited and how long to wait before retrying
+func rateLimitBackoff(resp *http.Response, body []byte, attempt int) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Until(time.Unix(reset, 0)) + time.Second, true
+		}
+	}
+
+	if strings.Contains(strings.ToLower(string(body)), "secondary rate limit") || resp.StatusCode == http.StatusTooManyRequests {
+		// Exponential backoff: 1s, 2s, 4s...
+		return time.Duration(1<<attempt) * time.Second, true
+	}
+
+	return 0, false
+}
+
+// sleepForRequest waits for d unless the request's context is cancelled first
+func sleepForRequest(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// doGitHubRequest sends a GitHub request through the shared client, tracking the token's rate
+// limit and retrying with backoff on rate limiting (including secondary limits) and 5xx errors
+func doGitHubRequest(req *http.Request) (*http.Response, error) {
+	key := githubTokenKey(requestToken(req))
+
+	for attempt := 0; ; attempt++ {
+		// Wait for an exhausted quota to reset instead of burning a request
+		if wait := primaryLimitWait(key); wait > 0 {
+			if wait > githubMaxWait {
+				atomic.AddInt64(&githubRateLimited, 1)
+				return nil, fmt.Errorf("%w: resets in %s", ErrGitHubRateLimited, wait.Round(time.Second))
+			}
+			if err := sleepForRequest(req, wait); err != nil {
+				return nil, err
+			}
+		}
+
+		// Requests with a body must be rewound before being retried
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		atomic.AddInt64(&githubRequests, 1)
+		resp, err := githubHTTPClient.Do(req)
+		if err != nil {
+			atomic.AddInt64(&githubFailures, 1)
+			if attempt < githubMaxRetries && req.Context().Err() == nil && (req.Body == nil || req.GetBody != nil) {
+				atomic.AddInt64(&githubRetries, 1)
+				if sleepErr := sleepForRequest(req, time.Duration(1<<attempt)*time.Second); sleepErr != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, err
+		}
+
+		updateGitHubRateLimit(key, resp)
+
+		if attempt >= githubMaxRetries {
+			return resp, nil
+		}
+
+		var wait time.Duration
+		switch {
+		case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+
+			var limited bool
+			wait, limited = rateLimitBackoff(resp, body, attempt)
+			if !limited {
+				// Plain permission error: hand the response back untouched
+				resp.Body = io.NopCloser(strings.NewReader(string(body)))
+				return resp, nil
+			}
+
+			atomic.AddInt64(&githubRateLimited, 1)
+			if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+				markSecondaryLimited(key)
+			}
+			if wait > githubMaxWait {
+				return nil, fmt.Errorf("%w: retry after %s", ErrGitHubRateLimited, wait.Round(time.Second))
+			}
+		case resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout:
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			wait = time.Duration(1<<attempt) * time.Second
+		default:
+			return resp, nil
+		}
+
+		if req.Body != nil && req.GetBody == nil {
+			return nil, fmt.Errorf("GitHub request failed with HTTP %d and cannot be retried", resp.StatusCode)
+		}
+
+		atomic.AddInt64(&githubRetries, 1)
+		WarnLog("GitHub API %s %s returned HTTP %d, retrying in %s (attempt %d/%d)",
+			req.Method, req.URL.Path, resp.StatusCode, wait.Round(time.Millisecond), attempt+1, githubMaxRetries)
+		if err := sleepForRequest(req, wait); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GitHubRequiredScopes are the OAuth scopes Citizen requests and needs to clone private
+// repositories, manage webhooks and identify the user
+var GitHubRequiredScopes = []string{"repo", "read:user", "user:email"}
+
+// gitHubImpliedScopes lists the scopes granted along with a broader scope
+var gitHubImpliedScopes = map[string][]string{
+	"user": {"read:user", "user:email", "user:follow"},
+}
+
+// GitHubTokenHealth is the result of checking a stored GitHub token
+type GitHubTokenHealth struct {
+	Valid         bool             `json:"valid"`
+	Login         string           `json:"login,omitempty"`
+	Scopes        []string         `json:"scopes"`
+	MissingScopes []string         `json:"missing_scopes"`
+	RateLimit     *GitHubRateLimit `json:"rate_limit,omitempty"`
+	CheckedAt     time.Time        `json:"checked_at"`
+}
+
+// CheckGitHubToken calls GitHub with a token and compares the scopes it was granted, read from
+// the X-OAuth-Scopes header, with GitHubRequiredScopes. A token GitHub rejects is reported as
+// invalid rather than as an error.
+func CheckGitHubToken(accessToken string) (*GitHubTokenHealth, error) {
+	req, err := http.NewRequest("GET", "https://api.github.com/user", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := doGitHubRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	health := &GitHubTokenHealth{Scopes: []string{}, MissingScopes: []string{}, CheckedAt: time.Now()}
+	if resp.StatusCode == http.StatusUnauthorized {
+		health.MissingScopes = append(health.MissingScopes, GitHubRequiredScopes...)
+		return health, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub returned HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var user GitHubUser
+	if err := json.Unmarshal(body, &user); err != nil {
+		return nil, err
+	}
+	health.Valid = true
+	health.Login = user.Login
+	health.RateLimit = GetGitHubRateLimit(accessToken)
+
+	for _, scope := range strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			health.Scopes = append(health.Scopes, scope)
+		}
+	}
+	health.MissingScopes = missingGitHubScopes(health.Scopes)
+	return health, nil
+}
+
+// missingGitHubScopes returns the required scopes not covered by the granted ones
+func missingGitHubScopes(granted []string) []string {
+	covered := make(map[string]bool)
+	for _, scope := range granted {
+		covered[scope] = true
+		for _, implied := range gitHubImpliedScopes[scope] {
+			covered[implied] = true
+		}
+	}
+
+	missing := []string{}
+	for _, scope := range GitHubRequiredScopes {
+		if !covered[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// RevokeGitHubToken revokes an OAuth token of the configured GitHub app. A token GitHub no
+// longer knows counts as revoked.
+func RevokeGitHubToken(accessToken string) error {
+	clientID, clientSecret, _, _ := GetGitHubConfig()
+	if clientID == "" || clientSecret == "" {
+		return fmt.Errorf("github oauth not configured")
+	}
+
+	payload, err := json.Marshal(map[string]string{"access_token": accessToken})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("https://api.github.com/applications/%s/token", clientID), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(clientID, clientSecret)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := doGitHubRequest(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !slices.Contains([]int{http.StatusNoContent, http.StatusNotFound}, resp.StatusCode) {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to revoke token: HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// maxGitHubRedirectURIs bounds how many redirect URIs can be registered
+const maxGitHubRedirectURIs = 20
+
+// gitHubRedirectURIs are the allowed OAuth redirect URIs, guarded by gitHubConfigMutex. The
+// default redirect URI is used alone when the list is empty.
+var gitHubRedirectURIs []string
+
+// SetGitHubRedirectURIs sets the allowed OAuth redirect URIs in memory
+func SetGitHubRedirectURIs(uris []string) {
+	gitHubConfigMutex.Lock()
+	defer gitHubConfigMutex.Unlock()
+	gitHubRedirectURIs = append([]string(nil), uris...)
+}
+
+// GitHubRedirectURIs returns the allowed OAuth redirect URIs, the default first. Without a
+// configuration in memory it reads the comma separated GITHUB_REDIRECT_URIS.
+func GitHubRedirectURIs() []string {
+	_, _, defaultURI, _ := GetGitHubConfig()
+
+	gitHubConfigMutex.RLock()
+	uris := append([]string(nil), gitHubRedirectURIs...)
+	gitHubConfigMutex.RUnlock()
+
+	if len(uris) == 0 {
+		for _, uri := range strings.Split(os.Getenv("GITHUB_REDIRECT_URIS"), ",") {
+			if uri = strings.TrimSpace(uri); uri != "" {
+				uris = append(uris, uri)
+			}
+		}
+	}
+	return NormalizeGitHubRedirectURIs(defaultURI, uris)
+}
+
+// NormalizeGitHubRedirectURIs returns the default redirect URI followed by the other URIs,
+// without duplicates
+func NormalizeGitHubRedirectURIs(defaultURI string, uris []string) []string {
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, uri := range append([]string{defaultURI}, uris...) {
+		uri = strings.TrimSpace(uri)
+		if uri == "" || seen[uri] {
+			continue
+		}
+		seen[uri] = true
+		normalized = append(normalized, uri)
+	}
+	return normalized
+}
+
+// ValidateGitHubRedirectURIs checks redirect URIs are absolute http(s) URLs without credentials,
+// query or fragment. Plain http is only accepted for localhost.
+func ValidateGitHubRedirectURIs(uris []string) error {
+	if len(uris) == 0 {
+		return fmt.Errorf("at least one redirect URI is required")
+	}
+	if len(uris) > maxGitHubRedirectURIs {
+		return fmt.Errorf("at most %d redirect URIs can be registered", maxGitHubRedirectURIs)
+	}
+
+	for _, uri := range uris {
+		parsed, err := url.Parse(uri)
+		if err != nil || parsed.Host == "" {
+			return fmt.Errorf("invalid redirect URI %q", uri)
+		}
+		switch parsed.Scheme {
+		case "https":
+		case "http":
+			if !isLocalHostname(parsed.Hostname()) {
+				return fmt.Errorf("redirect URI %q must use https", uri)
+			}
+		default:
+			return fmt.Errorf("invalid redirect URI %q", uri)
+		}
+		if parsed.User != nil || parsed.RawQuery != "" || parsed.Fragment != "" {
+			return fmt.Errorf("redirect URI %q must not contain credentials, a query or a fragment", uri)
+		}
+	}
+	return nil
+}
+
+// SelectGitHubRedirectURI returns the allowed redirect URI for the host a request was made to,
+// preferring an exact host and port match, then a hostname match. It falls back to the default
+// redirect URI, so the host of a request never ends up in a redirect unless it is registered.
+func SelectGitHubRedirectURI(host string) string {
+	uris := GitHubRedirectURIs()
+	if len(uris) == 0 {
+		return ""
+	}
+
+	host = strings.ToLower(strings.TrimSpace(host))
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+
+	var hostnameMatch string
+	for _, uri := range uris {
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			continue
+		}
+		if strings.ToLower(parsed.Host) == host {
+			return uri
+		}
+		if hostnameMatch == "" && strings.ToLower(parsed.Hostname()) == hostname {
+			hostnameMatch = uri
+		}
+	}
+	if hostnameMatch != "" {
+		return hostnameMatch
+	}
+	return uris[0]
+}
+
+// isLocalHostname reports whether a hostname points to the local machine
+func isLocalHostname(hostname string) bool {
+	if hostname == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(hostname)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HostResources is the resource usage of the Docker host running the apps. Fields the host
+// doesn't report are left at zero.
+type HostResources struct {
+	CPUs              int     `json:"cpus"`
+	Load1             float64 `json:"load_1"`
+	Load5             float64 `json:"load_5"`
+	Load15            float64 `json:"load_15"`
+	MemoryTotalMB     uint64  `json:"memory_total_mb"`
+	MemoryAvailableMB uint64  `json:"memory_available_mb"`
+	MemoryUsedPercent float64 `json:"memory_used_percent"`
+	DiskTotalMB       uint64  `json:"disk_total_mb"`
+	DiskFreeMB        uint64  `json:"disk_free_mb"`
+	DiskUsedPercent   float64 `json:"disk_used_percent"`
+	ContainersRunning int     `json:"containers_running"`
+	ContainersStopped int     `json:"containers_stopped"`
+}
+
+// GetHostResources reads the load and memory of the host from /proc (shared with the host when
+// running in a container), the disk usage of the root filesystem and the CPU and container counts
+// from the Docker daemon. It returns what it could read along with the first error.
+func GetHostResources(ctx context.Context) (*HostResources, error) {
+	resources := &HostResources{}
+	var errs []string
+
+	if err := readLoadAverage(resources); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := readMemoryInfo(resources); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := readDiskUsage("/", resources); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := readDockerInfo(ctx, resources); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return resources, fmt.Errorf("failed to read host resources: %s", strings.Join(errs, "; "))
+	}
+	return resources, nil
+}
+
+// readLoadAverage reads /proc/loadavg
+func readLoadAverage(resources *HostResources) error {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return fmt.Errorf("load average: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return fmt.Errorf("load average: unexpected format")
+	}
+	resources.Load1, _ = strconv.ParseFloat(fields[0], 64)
+	resources.Load5, _ = strconv.ParseFloat(fields[1], 64)
+	resources.Load15, _ = strconv.ParseFloat(fields[2], 64)
+	return nil
+}
+
+// readMemoryInfo reads MemTotal and MemAvailable from /proc/meminfo
+func readMemoryInfo(resources *HostResources) error {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return fmt.Errorf("memory: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			resources.MemoryTotalMB = kb / 1024
+		case "MemAvailable:":
+			resources.MemoryAvailableMB = kb / 1024
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("memory: %w", err)
+	}
+
+	if resources.MemoryTotalMB > 0 {
+		used := resources.MemoryTotalMB - min(resources.MemoryAvailableMB, resources.MemoryTotalMB)
+		resources.MemoryUsedPercent = percent(used, resources.MemoryTotalMB)
+	}
+	return nil
+}
+
+// readDockerInfo reads the CPU count and the container counts of the Docker host
+func readDockerInfo(ctx context.Context, resources *HostResources) error {
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("docker info: %w", err)
+	}
+	resources.CPUs = info.NCPU
+	resources.ContainersRunning = info.ContainersRunning
+	resources.ContainersStopped = info.ContainersStopped
+	return nil
+}
+
+// percent returns part/total as a percentage rounded to one decimal
+func percent(part, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part*1000/total) / 10
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package utils
+
+import "fmt"
+
+// readDiskUsage is not supported outside unix systems
+func readDiskUsage(path string, resources *HostResources) error {
+	return fmt.Errorf("disk: not supported on this platform")
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package utils
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// readDiskUsage reads the size and free space of the filesystem holding path
+func readDiskUsage(path string, resources *HostResources) error {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return fmt.Errorf("disk: %w", err)
+	}
+	blockSize := uint64(stat.Bsize)
+	resources.DiskTotalMB = stat.Blocks * blockSize / 1024 / 1024
+	resources.DiskFreeMB = stat.Bavail * blockSize / 1024 / 1024
+	if resources.DiskTotalMB > 0 {
+		resources.DiskUsedPercent = percent(resources.DiskTotalMB-min(resources.DiskFreeMB, resources.DiskTotalMB), resources.DiskTotalMB)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Headers of the ForwardAuth response that Traefik copies to the requests of apps behind SSO.
+// Traefik removes them from the incoming request first (authResponseHeaders), so an app can
+// trust them: a visitor can't set them, and they are missing when nobody is signed in.
+const (
+	HeaderCitizenUserID        = "X-Citizen-User-Id"
+	HeaderCitizenUsername      = "X-Citizen-Username"
+	HeaderCitizenEmail         = "X-Citizen-Email"
+	HeaderCitizenIdentityToken = "X-Citizen-Identity-Token"
+	// HeaderCitizenServiceAccount names the service token a request came in with, instead of a user
+	HeaderCitizenServiceAccount = "X-Citizen-Service-Account"
+)
+
+// HeaderCitizenServiceToken is the request header scripts and probes present a service token of
+// an app in. Traefik lists it in authResponseHeaders too, so the token never reaches the app.
+const HeaderCitizenServiceToken = "X-Citizen-Service-Token"
+
+// IdentityTokenTTL is how long an identity token is valid. ForwardAuth signs a new one for every
+// request, so it only needs to outlive the request.
+const IdentityTokenTTL = 5 * time.Minute
+
+// Identity is the signed-in visitor of an app as passed by ForwardAuth
+type Identity struct {
+	UserID   int
+	Username string
+	Email    string
+	Admin    bool
+}
+
+// GenerateIdentitySecret returns a new secret to sign the identity tokens of an app
+func GenerateIdentitySecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "idsec_" + hex.EncodeToString(b), nil
+}
+
+// SignIdentityToken returns a JWT (HS256) signed with the identity secret of an app, issued by
+// citizen for the app (aud), whose subject is the user ID. Apps verify it with the secret, which
+// proves the headers came through ForwardAuth even when the app is reachable another way.
+func SignIdentityToken(secret, appName string, identity Identity, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims := map[string]interface{}{
+		"iss":                "citizen",
+		"aud":                appName,
+		"sub":                strconv.Itoa(identity.UserID),
+		"preferred_username": identity.Username,
+		"admin":              identity.Admin,
+		"iat":                now.Unix(),
+		"exp":                now.Add(IdentityTokenTTL).Unix(),
+	}
+	if identity.Email != "" {
+		claims["email"] = identity.Email
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,329 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database/api"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// ImageCleanupSettingKey is the system setting holding the image cleanup config as JSON
+const ImageCleanupSettingKey = "images.cleanup"
+
+const (
+	defaultKeepReleases = 5
+	maxKeepReleases     = 100
+	// imageCleanupGrace spares recent images, which may belong to a deployment still finishing
+	imageCleanupGrace = time.Hour
+)
+
+// ErrImageCleanupRunning is returned when a cleanup is started while another one runs
+var ErrImageCleanupRunning = errors.New("an image cleanup is already running")
+
+// ImageCleanupConfig configures which images of old releases the cleanup removes
+type ImageCleanupConfig struct {
+	KeepReleases int `json:"keep_releases"` // releases whose image is kept per app, 0 keeps every release
+}
+
+// CleanedImage is an image the cleanup removed, or would remove in a dry run
+type CleanedImage struct {
+	ID       string   `json:"id"`
+	Tags     []string `json:"tags,omitempty"`
+	Size     int64    `json:"size"` // bytes not shared with other images
+	Dangling bool     `json:"dangling,omitempty"`
+}
+
+// AppImageCleanup is the outcome of the cleanup for one app
+type AppImageCleanup struct {
+	App     string         `json:"app"`
+	Kept    int            `json:"kept"`
+	Removed []CleanedImage `json:"removed"`
+	Skipped string         `json:"skipped,omitempty"`
+	Errors  []string       `json:"errors,omitempty"`
+}
+
+// ImageCleanupReport is the outcome of a cleanup. Reclaimable space is the size of the app images
+// no container uses, before and after the cleanup; a dry run estimates the space after.
+type ImageCleanupReport struct {
+	DryRun            bool              `json:"dry_run"`
+	KeepReleases      int               `json:"keep_releases"`
+	ReclaimableBefore int64             `json:"reclaimable_before"`
+	ReclaimableAfter  int64             `json:"reclaimable_after"`
+	Reclaimed         int64             `json:"reclaimed"`
+	ImagesRemoved     int               `json:"images_removed"`
+	Apps              []AppImageCleanup `json:"apps"`
+	StartedAt         time.Time         `json:"started_at"`
+	FinishedAt        time.Time         `json:"finished_at"`
+}
+
+var (
+	// imageCleanupRunning is held while a cleanup removes images
+	imageCleanupRunning sync.Mutex
+
+	lastImageCleanup struct {
+		sync.Mutex
+		report *ImageCleanupReport
+	}
+)
+
+// GetImageCleanupConfig returns the stored image cleanup config, or the default of keeping the
+// images of the last 5 releases
+func GetImageCleanupConfig(ctx context.Context) *ImageCleanupConfig {
+	config := &ImageCleanupConfig{KeepReleases: defaultKeepReleases}
+
+	value, err := api.Settings.GetSystemSetting(ctx, ImageCleanupSettingKey)
+	if err != nil {
+		if !errors.Is(err, api.ErrSettingNotFound) {
+			WarnLog("Failed to load image cleanup config, using defaults: %v", err)
+		}
+		return config
+	}
+
+	var stored ImageCleanupConfig
+	if err := json.Unmarshal([]byte(value), &stored); err != nil || stored.Validate() != nil {
+		WarnLog("Invalid image cleanup config stored, using defaults: %v", err)
+		return config
+	}
+	return &stored
+}
+
+// SaveImageCleanupConfig validates and stores the image cleanup config
+func SaveImageCleanupConfig(ctx context.Context, config *ImageCleanupConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return api.Settings.SetSystemSetting(ctx, ImageCleanupSettingKey, string(value))
+}
+
+// Validate checks the number of releases kept is within bounds
+func (c *ImageCleanupConfig) Validate() error {
+	if c.KeepReleases < 0 || c.KeepReleases > maxKeepReleases {
+		return fmt.Errorf("keep_releases must be between 0 and %d", maxKeepReleases)
+	}
+	return nil
+}
+
+// LastImageCleanupReport returns the report of the last cleanup that removed images, nil before
+// the first one
+func LastImageCleanupReport() *ImageCleanupReport {
+	lastImageCleanup.Lock()
+	defer lastImageCleanup.Unlock()
+	return lastImageCleanup.report
+}
+
+// RunImageCleanup removes the images of Citizen apps that no container uses and that are neither
+// the image of one of the last kept releases of their app nor the current one, along with the
+// dangling images left by their builds. Images of other projects on the Docker host are never
+// touched, nor are apps with a deployment running. A dry run only reports what would be removed.
+func RunImageCleanup(ctx context.Context, dryRun bool) (*ImageCleanupReport, error) {
+	if !dryRun {
+		if !imageCleanupRunning.TryLock() {
+			return nil, ErrImageCleanupRunning
+		}
+		defer imageCleanupRunning.Unlock()
+	}
+
+	config := GetImageCleanupConfig(ctx)
+	report := &ImageCleanupReport{DryRun: dryRun, KeepReleases: config.KeepReleases, Apps: []AppImageCleanup{}, StartedAt: time.Now()}
+
+	apps, err := ListApps()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list apps: %w", err)
+	}
+	cli, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	images, err := listAppImages(ctx, cli, apps)
+	if err != nil {
+		return nil, err
+	}
+	report.ReclaimableBefore = reclaimableImageSize(images)
+
+	// Images other images are built on can't be removed before their children
+	parents := make(map[string]bool)
+	for _, appImages := range images {
+		for _, img := range appImages {
+			if img.ParentID != "" {
+				parents[img.ParentID] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(images))
+	for name := range images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		result := AppImageCleanup{App: name, Removed: []CleanedImage{}}
+		if len(ListRunningDeployments(name)) > 0 {
+			result.Skipped = "a deployment is running"
+			result.Kept = len(images[name])
+			report.Apps = append(report.Apps, result)
+			continue
+		}
+
+		keep, err := keptReleaseImages(ctx, name, config.KeepReleases)
+		if err != nil {
+			result.Skipped = err.Error()
+			result.Kept = len(images[name])
+			report.Apps = append(report.Apps, result)
+			continue
+		}
+
+		for _, img := range images[name] {
+			dangling := isDanglingImage(img)
+			if img.Containers > 0 || keep[img.ID] || parents[img.ID] ||
+				time.Since(time.Unix(img.Created, 0)) < imageCleanupGrace ||
+				(config.KeepReleases == 0 && !dangling) {
+				result.Kept++
+				continue
+			}
+
+			if !dryRun {
+				if _, err := cli.ImageRemove(ctx, img.ID, image.RemoveOptions{Force: true, PruneChildren: true}); err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("failed to remove %s: %v", img.ID, err))
+					result.Kept++
+					continue
+				}
+			}
+			cleaned := CleanedImage{ID: img.ID, Size: uniqueImageSize(img), Dangling: dangling}
+			if !dangling {
+				cleaned.Tags = img.RepoTags
+			}
+			result.Removed = append(result.Removed, cleaned)
+			report.Reclaimed += cleaned.Size
+			report.ImagesRemoved++
+		}
+		report.Apps = append(report.Apps, result)
+	}
+
+	report.ReclaimableAfter = report.ReclaimableBefore - report.Reclaimed
+	if !dryRun {
+		if after, err := listAppImages(ctx, cli, apps); err == nil {
+			report.ReclaimableAfter = reclaimableImageSize(after)
+		} else {
+			WarnLog("Failed to measure the reclaimable space after the image cleanup: %v", err)
+		}
+	}
+	report.FinishedAt = time.Now()
+
+	if !dryRun {
+		lastImageCleanup.Lock()
+		lastImageCleanup.report = report
+		lastImageCleanup.Unlock()
+	}
+	return report, nil
+}
+
+// keptReleaseImages returns the images the cleanup keeps for an app: those of its last releases
+// and the one it currently runs
+func keptReleaseImages(ctx context.Context, appName string, keepReleases int) (map[string]bool, error) {
+	keep := make(map[string]bool)
+	if keepReleases > 0 {
+		imageIDs, err := api.Deployments.ListReleaseImageIDs(ctx, appName, keepReleases)
+		if err != nil {
+			return nil, err
+		}
+		for _, imageID := range imageIDs {
+			keep[imageID] = true
+		}
+	}
+
+	current, err := InspectImage(ctx, AppImageRef(appName))
+	if err != nil && !errors.Is(err, ErrImageNotFound) {
+		return nil, err
+	}
+	if current != nil {
+		keep[current.ID] = true
+	}
+	return keep, nil
+}
+
+// listAppImages returns the images on the Docker host belonging to the given apps, by app: those
+// Dokku labelled with the app and those tagged in its dokku/ or citizen/ repository
+func listAppImages(ctx context.Context, cli *client.Client, apps []string) (map[string][]*image.Summary, error) {
+	usage, err := cli.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.ImageObject}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Docker disk usage: %w", err)
+	}
+
+	managed := make(map[string]bool, len(apps))
+	for _, app := range apps {
+		managed[app] = true
+	}
+
+	images := make(map[string][]*image.Summary)
+	for _, img := range usage.Images {
+		if app := imageAppName(img); managed[app] {
+			images[app] = append(images[app], img)
+		}
+	}
+	return images, nil
+}
+
+// imageAppName returns the app an image belongs to, empty when it belongs to none
+func imageAppName(img *image.Summary) string {
+	if app := img.Labels["com.dokku.app-name"]; app != "" {
+		return app
+	}
+	for _, tag := range img.RepoTags {
+		repository, _, _ := strings.Cut(tag, ":")
+		for _, prefix := range []string{"dokku/", "citizen/"} {
+			if app, ok := strings.CutPrefix(repository, prefix); ok && app != "" {
+				return app
+			}
+		}
+	}
+	return ""
+}
+
+// isDanglingImage tells whether an image has no tag
+func isDanglingImage(img *image.Summary) bool {
+	for _, tag := range img.RepoTags {
+		if tag != "<none>:<none>" {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueImageSize returns the bytes removing an image frees, those it doesn't share with others
+func uniqueImageSize(img *image.Summary) int64 {
+	if img.SharedSize > 0 {
+		return img.Size - img.SharedSize
+	}
+	return img.Size
+}
+
+// reclaimableImageSize returns the bytes of the images no container uses
+func reclaimableImageSize(images map[string][]*image.Summary) int64 {
+	var size int64
+	for _, appImages := range images {
+		for _, img := range appImages {
+			if img.Containers == 0 {
+				size += uniqueImageSize(img)
+			}
+		}
+	}
+	return size
+}
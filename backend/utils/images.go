@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// defaultImageSizeWarnPercent is the image growth over the previous release that warns by default
+const defaultImageSizeWarnPercent = 20
+
+// ErrImageNotFound is returned when an image is no longer present on the Docker host
+var ErrImageNotFound = errors.New("image not found on the Docker host")
+
+// imageReferenceRegex matches a repository with an optional registry host and tag,
+// e.g. "ghcr.io/acme/api:v1.2" or "acme/api"
+var imageReferenceRegex = regexp.MustCompile(`^([a-z0-9.-]+(:[0-9]+)?/)?[a-z0-9]+([._-][a-z0-9]+)*(/[a-z0-9]+([._-][a-z0-9]+)*)*(:[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?$`)
+
+// ImageInfo describes an image present on the Docker host
+type ImageInfo struct {
+	ID       string    `json:"id"`
+	RepoTags []string  `json:"repo_tags"`
+	Size     int64     `json:"size"`
+	Created  time.Time `json:"created"`
+}
+
+// AppImageRef returns the image Dokku tags with the current release of an app
+func AppImageRef(appName string) string {
+	return "dokku/" + appName + ":latest"
+}
+
+// ValidateImageReference checks a push target is a valid image reference
+func ValidateImageReference(ref string) error {
+	if len(ref) > 255 || !imageReferenceRegex.MatchString(ref) {
+		return fmt.Errorf("invalid image reference %q", ref)
+	}
+	return nil
+}
+
+// ValidateDeployImage checks an image to deploy is a valid reference, optionally pinned by digest
+func ValidateDeployImage(ref string) error {
+	if err := ValidateImageReference(imageWithoutDigest(ref)); err != nil {
+		return fmt.Errorf("invalid image reference %q", ref)
+	}
+	return nil
+}
+
+// newDockerClient connects to the Docker daemon configured by the environment (DOCKER_HOST etc.)
+func newDockerClient() (*client.Client, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("could not create Docker client: %w", err)
+	}
+	return cli, nil
+}
+
+// InspectImage returns the image a reference or image ID points to
+func InspectImage(ctx context.Context, ref string) (*ImageInfo, error) {
+	cli, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, ErrImageNotFound
+		}
+		return nil, fmt.Errorf("failed to inspect image %s: %w", ref, err)
+	}
+
+	info := &ImageInfo{ID: inspect.ID, RepoTags: inspect.RepoTags, Size: inspect.Size}
+	info.Created, _ = time.Parse(time.RFC3339Nano, inspect.Created)
+	return info, nil
+}
+
+// ImageSizeWarnPercent is how much, in percent, the image of a release may grow over the image of
+// the previous release before its deployment warns, from IMAGE_SIZE_WARN_PERCENT (20 by default)
+func ImageSizeWarnPercent() int {
+	if value := os.Getenv("IMAGE_SIZE_WARN_PERCENT"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			return parsed
+		}
+		WarnLog("Invalid IMAGE_SIZE_WARN_PERCENT %q, using %d", value, defaultImageSizeWarnPercent)
+	}
+	return defaultImageSizeWarnPercent
+}
+
+// ImageSizeGrowth returns how much, in percent, an image grew over the previous one, and whether
+// that is beyond ImageSizeWarnPercent
+func ImageSizeGrowth(previous, current int64) (float64, bool) {
+	if previous <= 0 {
+		return 0, false
+	}
+	growth := float64(current-previous) * 100 / float64(previous)
+	return growth, growth > float64(ImageSizeWarnPercent())
+}
+
+// FormatImageSize formats a size in bytes in MB, as docker images does
+func FormatImageSize(size int64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/1e6)
+}
+
+// ImageLayer is a layer of an image as listed by docker history
+type ImageLayer struct {
+	ID        string    `json:"id,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	Size      int64     `json:"size"`
+	Created   time.Time `json:"created"`
+}
+
+// ImageHistory returns the layers of an image, newest first, like docker history
+func ImageHistory(ctx context.Context, ref string) ([]ImageLayer, error) {
+	cli, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	history, err := cli.ImageHistory(ctx, ref)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, ErrImageNotFound
+		}
+		return nil, fmt.Errorf("failed to get history of image %s: %w", ref, err)
+	}
+
+	layers := make([]ImageLayer, 0, len(history))
+	for _, item := range history {
+		// Layers pulled from a registry have no local ID
+		id := item.ID
+		if id == "<missing>" {
+			id = ""
+		}
+		layers = append(layers, ImageLayer{ID: id, CreatedBy: item.CreatedBy, Size: item.Size, Created: time.Unix(item.Created, 0)})
+	}
+	return layers, nil
+}
+
+// SaveImage returns the image as a `docker save` tarball. The caller closes the stream.
+func SaveImage(ctx context.Context, ref string) (io.ReadCloser, error) {
+	cli, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := cli.ImageSave(ctx, []string{ref})
+	if err != nil {
+		cli.Close()
+		if client.IsErrNotFound(err) {
+			return nil, ErrImageNotFound
+		}
+		return nil, fmt.Errorf("failed to save image %s: %w", ref, err)
+	}
+	return &clientStream{ReadCloser: stream, cli: cli}, nil
+}
+
+// clientStream closes the Docker client along with the stream it returned
+type clientStream struct {
+	io.ReadCloser
+	cli *client.Client
+}
+
+func (s *clientStream) Close() error {
+	err := s.ReadCloser.Close()
+	s.cli.Close()
+	return err
+}
+
+// TagImage tags source (a reference or image ID) as target
+func TagImage(ctx context.Context, source, target string) error {
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	if err := cli.ImageTag(ctx, source, target); err != nil {
+		if client.IsErrNotFound(err) {
+			return ErrImageNotFound
+		}
+		return fmt.Errorf("failed to tag image as %s: %w", target, err)
+	}
+	return nil
+}
+
+// PullImage pulls an image from its registry and returns its ID on the Docker host. registryAuth
+// is the base64 encoded registry credentials (empty for public images).
+func PullImage(ctx context.Context, ref, registryAuth string) (string, error) {
+	cli, err := newDockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	stream, err := cli.ImagePull(ctx, ref, image.PullOptions{RegistryAuth: registryAuth})
+	if err != nil {
+		return "", fmt.Errorf("failed to pull %s: %w", ref, err)
+	}
+	defer stream.Close()
+
+	if _, err := readImageProgress(stream, "pull"); err != nil {
+		return "", err
+	}
+
+	info, err := InspectImage(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	return info.ID, nil
+}
+
+// PushImage tags source as target and pushes it. registryAuth is the base64 encoded registry
+// credentials (empty for anonymous pushes). It returns the digest reported by the registry.
+func PushImage(ctx context.Context, source, target, registryAuth string) (string, error) {
+	if err := TagImage(ctx, source, target); err != nil {
+		return "", err
+	}
+
+	cli, err := newDockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	stream, err := cli.ImagePush(ctx, target, image.PushOptions{RegistryAuth: registryAuth})
+	if err != nil {
+		return "", fmt.Errorf("failed to push %s: %w", target, err)
+	}
+	defer stream.Close()
+
+	return readImageProgress(stream, "push")
+}
+
+// progressMessage is a line of the progress stream returned by a push or a pull
+type progressMessage struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Aux    struct {
+		Digest string `json:"Digest"`
+	} `json:"aux"`
+}
+
+// readImageProgress reads the progress stream of a push or a pull to its end and returns the
+// digest it reported. Failures are reported in the stream rather than as an HTTP error.
+func readImageProgress(stream io.Reader, action string) (string, error) {
+	var digest string
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var message progressMessage
+		if json.Unmarshal(scanner.Bytes(), &message) != nil {
+			continue
+		}
+		if message.Error != "" {
+			return "", fmt.Errorf("%s failed: %s", action, message.Error)
+		}
+		if message.Aux.Digest != "" {
+			digest = message.Aux.Digest
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read %s progress: %w", action, err)
+	}
+	return digest, nil
+}
@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database/api"
+)
+
+const (
+	// logAlertTail is how many recent log lines of an app are read per ingestion run
+	logAlertTail = 500
+	// maxLogAlertLines bounds the matched lines kept in an alert
+	maxLogAlertLines = 20
+	// maxLogAlertLineLength truncates long matched lines
+	maxLogAlertLineLength = 500
+	// MinLogAlertCooldown is the shortest cooldown a rule can have between two alerts
+	MinLogAlertCooldown = 60 * time.Second
+)
+
+// logAlertHTTPClient sends alert notifications
+var logAlertHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// logProcessRegex reads the process type from the "app[web.1]:" prefix of a dokku log line
+var logProcessRegex = regexp.MustCompile(`\[([a-zA-Z0-9_-]+)\.\d+\]:`)
+
+// CompileLogAlertPattern compiles a rule pattern, quoting it unless it is a regular expression
+func CompileLogAlertPattern(pattern string, isRegex bool) (*regexp.Regexp, error) {
+	if pattern == "" || len(pattern) > maxLogGrepLength {
+		return nil, fmt.Errorf("pattern must be between 1 and %d characters", maxLogGrepLength)
+	}
+	if !isRegex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	return compiled, nil
+}
+
+// IsValidProcessType reports whether name is a valid dokku process type
+func IsValidProcessType(name string) bool {
+	return processTypeRegex.MatchString(name)
+}
+
+// ValidateLogAlertChannel checks the notification channel of a rule. Slack channels are incoming
+// webhook URLs, webhook channels receive the alert as JSON.
+func ValidateLogAlertChannel(channelType, channelURL string) error {
+	switch channelType {
+	case "":
+		if channelURL != "" {
+			return fmt.Errorf("channel_type is required with channel_url")
+		}
+		return nil
+	case "slack":
+		if !strings.HasPrefix(channelURL, "https://hooks.slack.com/") {
+			return fmt.Errorf("slack channels need an incoming webhook URL (https://hooks.slack.com/...)")
+		}
+		return nil
+	case "webhook":
+		parsed, err := url.Parse(channelURL)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("webhook channels need an https URL")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid channel_type %q: use slack or webhook", channelType)
+	}
+}
+
+// LogAlert is a rule that matched new log lines
+type LogAlert struct {
+	Rule    api.LogAlertRule
+	Lines   []string
+	Matches int
+}
+
+// MatchLogAlertRule returns the lines of logs matched by a rule, at most maxLogAlertLines of them,
+// and the total number of matches
+func MatchLogAlertRule(rule api.LogAlertRule, pattern *regexp.Regexp, lines []string) ([]string, int) {
+	var matched []string
+	var count int
+	for _, line := range lines {
+		if rule.ProcessType != "" {
+			process := logProcessRegex.FindStringSubmatch(line)
+			if process == nil || process[1] != rule.ProcessType {
+				continue
+			}
+		}
+		if !pattern.MatchString(line) {
+			continue
+		}
+		count++
+		if len(matched) < maxLogAlertLines {
+			if len(line) > maxLogAlertLineLength {
+				line = line[:maxLogAlertLineLength] + "…"
+			}
+			matched = append(matched, line)
+		}
+	}
+	return matched, count
+}
+
+// logAlertWatermarks remembers, per app, the timestamp of the newest log line already evaluated
+var (
+	logAlertWatermarks   = make(map[string]time.Time)
+	logAlertWatermarksMu sync.Mutex
+)
+
+// newLogLines returns the lines of logs newer than the app's watermark and advances it. Lines
+// without a timestamp (stack traces) belong to the line before them. The first evaluation of an
+// app only sets the watermark, so old lines don't alert after a restart.
+func newLogLines(appName, logs string) []string {
+	logAlertWatermarksMu.Lock()
+	defer logAlertWatermarksMu.Unlock()
+
+	watermark, seen := logAlertWatermarks[appName]
+	newest := watermark
+
+	var lines []string
+	include := false
+	for _, line := range strings.Split(logs, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if timestamp, ok := logLineTimestamp(line); ok {
+			include = timestamp.After(watermark)
+			if timestamp.After(newest) {
+				newest = timestamp
+			}
+		}
+		if include {
+			lines = append(lines, strings.TrimRight(line, "\r"))
+		}
+	}
+
+	logAlertWatermarks[appName] = newest
+	if !seen {
+		return nil
+	}
+	return lines
+}
+
+// IngestAppLogs reads the new log lines of every app with enabled alert rules or log sinks, once
+// per app. The lines are matched against the rules, which record an alert activity and notify
+// their channel; a rule alerts at most once per cooldown, matches during the cooldown are counted
+// and reported with the next alert. The lines are then queued for the log sinks of the app, which
+// are flushed at the end of the run.
+func IngestAppLogs(ctx context.Context) error {
+	rules, err := api.LogAlerts.ListLogAlertRules(ctx, "")
+	if err != nil {
+		return err
+	}
+	sinks, err := api.LogAlerts.ListLogSinks(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	rulesByApp := make(map[string][]api.LogAlertRule)
+	for _, rule := range rules {
+		rulesByApp[rule.AppName] = append(rulesByApp[rule.AppName], rule)
+	}
+	sinksByApp := make(map[string][]api.LogSink)
+	for _, sink := range sinks {
+		sinksByApp[sink.AppName] = append(sinksByApp[sink.AppName], sink)
+	}
+	apps := make(map[string]bool, len(rulesByApp)+len(sinksByApp))
+	for appName := range rulesByApp {
+		apps[appName] = true
+	}
+	for appName := range sinksByApp {
+		apps[appName] = true
+	}
+
+	var failures []string
+	for appName := range apps {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		logs, err := GetAllProcessLogs(appName, logAlertTail)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", appName, err))
+			continue
+		}
+		lines := newLogLines(appName, logs)
+		if len(lines) == 0 {
+			continue
+		}
+
+		for _, rule := range rulesByApp[appName] {
+			if err := evaluateLogAlertRule(ctx, rule, lines); err != nil {
+				failures = append(failures, fmt.Sprintf("%s rule %d: %v", appName, rule.ID, err))
+			}
+		}
+		QueueLogLines(appName, lines, sinksByApp[appName])
+	}
+
+	if err := FlushLogSinks(ctx, sinks); err != nil {
+		failures = append(failures, err.Error())
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("log ingestion failed: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// evaluateLogAlertRule matches a rule against new log lines and alerts unless it is cooling down
+func evaluateLogAlertRule(ctx context.Context, rule api.LogAlertRule, lines []string) error {
+	pattern, err := CompileLogAlertPattern(rule.Pattern, rule.IsRegex)
+	if err != nil {
+		return err
+	}
+
+	matched, count := MatchLogAlertRule(rule, pattern, lines)
+	if count == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	cooldown := time.Duration(rule.CooldownSeconds) * time.Second
+	if rule.LastTriggeredAt != nil && now.Sub(*rule.LastTriggeredAt) < cooldown {
+		DebugLog("Log alert %d of %s cooling down, %d matches suppressed", rule.ID, rule.AppName, count)
+		return api.LogAlerts.AddSuppressedLogAlertMatches(ctx, rule.ID, count)
+	}
+
+	alert := &LogAlert{Rule: rule, Lines: matched, Matches: count}
+	message := fmt.Sprintf("Log alert %q matched %d line(s)", rule.Name, count)
+	if rule.SuppressedMatches > 0 {
+		message += fmt.Sprintf(" (%d more during the cooldown)", rule.SuppressedMatches)
+	}
+
+	_, err = api.Activities.LogActivity(ctx, rule.AppName, api.ActivityAlert, api.StatusWarning, message,
+		map[string]interface{}{
+			"rule_id":            rule.ID,
+			"rule_name":          rule.Name,
+			"pattern":            rule.Pattern,
+			"matches":            count,
+			"suppressed_matches": rule.SuppressedMatches,
+			"lines":              matched,
+		}, nil, api.TriggerAutomatic)
+	if err != nil {
+		return err
+	}
+	if err := api.LogAlerts.RecordLogAlertTriggered(ctx, rule.ID, now); err != nil {
+		return err
+	}
+
+	if rule.ChannelType != "" {
+		if err := notifyLogAlert(ctx, alert, message); err != nil {
+			WarnLog("Failed to notify log alert %d of %s: %v", rule.ID, rule.AppName, err)
+		}
+	}
+	return nil
+}
+
+// notifyLogAlert sends an alert to the channel of its rule
+func notifyLogAlert(ctx context.Context, alert *LogAlert, message string) error {
+	channelURL, err := DecryptString(alert.Rule.ChannelURL)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt channel URL: %w", err)
+	}
+	if err := ValidateLogAlertChannel(alert.Rule.ChannelType, channelURL); err != nil {
+		return err
+	}
+
+	var payload interface{}
+	if alert.Rule.ChannelType == "slack" {
+		payload = map[string]string{
+			"text": fmt.Sprintf(":rotating_light: *%s*: %s\n```%s```", alert.Rule.AppName, message,
+				strings.Join(alert.Lines, "\n")),
+		}
+	} else {
+		payload = map[string]interface{}{
+			"app_name":  alert.Rule.AppName,
+			"rule_id":   alert.Rule.ID,
+			"rule_name": alert.Rule.Name,
+			"message":   message,
+			"matches":   alert.Matches,
+			"lines":     alert.Lines,
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, channelURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := logAlertHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification failed (HTTP %d)", resp.StatusCode)
+	}
+	return nil
+}
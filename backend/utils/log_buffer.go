@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// maxRecentLogLines is how many backend log lines are kept in memory for diagnostics
+const maxRecentLogLines = 2000
+
+// LogBuffer keeps the most recent log lines written through it
+type LogBuffer struct {
+	mu      sync.Mutex
+	lines   []string
+	next    int
+	partial []byte
+}
+
+// RecentLogs holds the recent backend output once CaptureRecentLogs ran
+var RecentLogs = &LogBuffer{}
+
+// CaptureRecentLogs copies the standard logger and stdout into RecentLogs, keeping them on their
+// original outputs. It must run before anything keeps a reference to os.Stdout.
+func CaptureRecentLogs() error {
+	log.SetOutput(io.MultiWriter(os.Stderr, RecentLogs))
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	go func() {
+		_, _ = io.Copy(io.MultiWriter(stdout, RecentLogs), r)
+	}()
+	return nil
+}
+
+// Write stores the complete lines of p, keeping an incomplete last line for the next write
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data := append(b.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		b.add(string(data[:i]))
+		data = data[i+1:]
+	}
+	b.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+func (b *LogBuffer) add(line string) {
+	if len(b.lines) < maxRecentLogLines {
+		b.lines = append(b.lines, line)
+		return
+	}
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % maxRecentLogLines
+}
+
+// Lines returns the kept lines, oldest first
+func (b *LogBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lines := make([]string, 0, len(b.lines))
+	lines = append(lines, b.lines[b.next:]...)
+	return append(lines, b.lines[:b.next]...)
+}
@@ -0,0 +1,368 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database/api"
+)
+
+// Log sink types
+const (
+	LogSinkSyslog = "syslog" // RFC 5424 messages over syslog+tcp://, syslog+tls:// or syslog+udp://
+	LogSinkHTTPS  = "https"  // JSON arrays of entries POSTed to an https endpoint
+	LogSinkVector = "vector" // newline delimited JSON POSTed to a Vector http_server source
+)
+
+const (
+	// maxLogSinkBuffer bounds the lines kept per sink while it can't be reached, the oldest are dropped
+	maxLogSinkBuffer = 10000
+	// logSinkBatch is how many lines are sent to a sink at once
+	logSinkBatch = 500
+	// logSinkRetryBase is the delay before retrying a failed sink, doubled per failure up to logSinkMaxRetry
+	logSinkRetryBase = 30 * time.Second
+	logSinkMaxRetry  = 15 * time.Minute
+	// logSinkTimeout bounds a delivery to a sink
+	logSinkTimeout = 15 * time.Second
+)
+
+// platformServicePorts are the ports of the services Citizen runs on its host (SSH, the API,
+// Traefik, Postgres, Redis and Docker), which log sinks can't point to even on a public address
+var platformServicePorts = []string{"22", "2222", "2375", "2376", "3000", "5432", "6379", "8080"}
+
+// errPrivateLogSinkHost is returned when a log sink resolves to a loopback, private or link-local
+// address, which would let sinks send data to internal services
+var errPrivateLogSinkHost = errors.New("log sink host resolves to a private address")
+
+// logSinkDialer connects to sinks, never to private addresses
+var logSinkDialer = publicOnlyDialer(logSinkTimeout, errPrivateLogSinkHost)
+
+// logSinkHTTPClient sends log batches, redirects are not followed so a 3xx fails the delivery
+var logSinkHTTPClient = &http.Client{
+	Timeout: logSinkTimeout,
+	Transport: &http.Transport{
+		DialContext:         logSinkDialer.DialContext,
+		TLSHandshakeTimeout: logSinkTimeout,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// AppLogEntry is a log line of an app as sent to sinks
+type AppLogEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	App       string    `json:"app"`
+	Process   string    `json:"process,omitempty"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+}
+
+// ValidateLogSink checks that logs can be forwarded to a sink of a type at a URL, on a public
+// host and a port other than those of the platform's services. Hostnames resolving to private
+// addresses are refused when sending.
+func ValidateLogSink(sinkType, sinkURL string) error {
+	parsed, err := url.Parse(sinkURL)
+	if err != nil || parsed.Host == "" || parsed.User != nil {
+		return fmt.Errorf("invalid log sink URL")
+	}
+	if ip := net.ParseIP(parsed.Hostname()); isLocalHostname(parsed.Hostname()) || (ip != nil && isPrivateIP(ip)) {
+		return fmt.Errorf("log sinks must point to a public host")
+	}
+	if slices.Contains(platformServicePorts, parsed.Port()) {
+		return fmt.Errorf("log sinks can't use port %s, it is used by the platform's own services", parsed.Port())
+	}
+
+	switch sinkType {
+	case LogSinkSyslog:
+		switch parsed.Scheme {
+		case "syslog+tcp", "syslog+tls", "syslog+udp":
+		default:
+			return fmt.Errorf("syslog sinks use syslog+tcp://, syslog+tls:// or syslog+udp:// URLs")
+		}
+		if parsed.Port() == "" {
+			return fmt.Errorf("syslog sink URLs need a port")
+		}
+	case LogSinkHTTPS, LogSinkVector:
+		if parsed.Scheme != "https" && !(parsed.Scheme == "http" && IsDevelopmentEnvironment()) {
+			return fmt.Errorf("%s sinks must use https", sinkType)
+		}
+	default:
+		return fmt.Errorf("sink_type must be %s, %s or %s", LogSinkSyslog, LogSinkHTTPS, LogSinkVector)
+	}
+	return nil
+}
+
+// parseLogEntries turns dokku log lines of an app into entries. Lines without a timestamp (stack
+// traces) are entries of their own with the timestamp and process of the line before them.
+func parseLogEntries(appName string, lines []string) []AppLogEntry {
+	entries := make([]AppLogEntry, 0, len(lines))
+	var timestamp time.Time
+	process := ""
+	for _, line := range lines {
+		message := line
+		if ts, ok := logLineTimestamp(line); ok {
+			timestamp = ts
+			_, message, _ = strings.Cut(line, " ")
+			process = ""
+			if match := logProcessRegex.FindStringSubmatch(message); match != nil {
+				process = match[1]
+			}
+			if _, rest, found := strings.Cut(message, "]: "); found {
+				message = rest
+			}
+		}
+		if timestamp.IsZero() {
+			timestamp = time.Now().UTC()
+		}
+		level, ok := detectLogLevel(message)
+		if !ok {
+			level = "info"
+		}
+		entries = append(entries, AppLogEntry{Timestamp: timestamp, App: appName, Process: process, Level: level, Message: message})
+	}
+	return entries
+}
+
+// logSinkBuffer holds the entries waiting to be sent to a sink
+type logSinkBuffer struct {
+	entries     []AppLogEntry
+	dropped     int
+	failures    int
+	nextAttempt time.Time
+}
+
+var logSinkBuffers = struct {
+	sync.Mutex
+	byID map[int]*logSinkBuffer
+}{byID: make(map[int]*logSinkBuffer)}
+
+// QueueLogLines adds new log lines of an app to the buffers of its sinks, keeping the lines of
+// the process a sink is limited to. Full buffers drop their oldest lines.
+func QueueLogLines(appName string, lines []string, sinks []api.LogSink) {
+	if len(sinks) == 0 || len(lines) == 0 {
+		return
+	}
+	entries := parseLogEntries(appName, lines)
+
+	logSinkBuffers.Lock()
+	defer logSinkBuffers.Unlock()
+	for _, sink := range sinks {
+		buffer := logSinkBuffers.byID[sink.ID]
+		if buffer == nil {
+			buffer = &logSinkBuffer{}
+			logSinkBuffers.byID[sink.ID] = buffer
+		}
+		for _, entry := range entries {
+			if sink.ProcessType == "" || entry.Process == sink.ProcessType {
+				buffer.entries = append(buffer.entries, entry)
+			}
+		}
+		if overflow := len(buffer.entries) - maxLogSinkBuffer; overflow > 0 {
+			buffer.entries = append([]AppLogEntry(nil), buffer.entries[overflow:]...)
+			buffer.dropped += overflow
+		}
+	}
+}
+
+// FlushLogSinks sends the buffered lines of the enabled sinks in batches. A sink that fails keeps
+// its lines and is retried with an exponential backoff. Buffers of sinks no longer enabled are
+// discarded.
+func FlushLogSinks(ctx context.Context, sinks []api.LogSink) error {
+	enabled := make(map[int]bool, len(sinks))
+	for _, sink := range sinks {
+		enabled[sink.ID] = true
+	}
+	logSinkBuffers.Lock()
+	for id := range logSinkBuffers.byID {
+		if !enabled[id] {
+			delete(logSinkBuffers.byID, id)
+		}
+	}
+	logSinkBuffers.Unlock()
+
+	var failures []string
+	for _, sink := range sinks {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := flushLogSink(ctx, sink); err != nil {
+			failures = append(failures, fmt.Sprintf("%s sink %d: %v", sink.AppName, sink.ID, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("log forwarding failed: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// flushLogSink sends the buffered lines of a sink and records the outcome
+func flushLogSink(ctx context.Context, sink api.LogSink) error {
+	logSinkBuffers.Lock()
+	buffer := logSinkBuffers.byID[sink.ID]
+	if buffer == nil || (len(buffer.entries) == 0 && buffer.dropped == 0) || time.Now().Before(buffer.nextAttempt) {
+		logSinkBuffers.Unlock()
+		return nil
+	}
+	dropped := buffer.dropped
+	buffer.dropped = 0
+	logSinkBuffers.Unlock()
+
+	forwarded := 0
+	var sendErr error
+	for {
+		logSinkBuffers.Lock()
+		batch := append([]AppLogEntry(nil), buffer.entries[:min(logSinkBatch, len(buffer.entries))]...)
+		logSinkBuffers.Unlock()
+		if len(batch) == 0 {
+			break
+		}
+
+		if sendErr = SendLogEntries(ctx, sink, batch); sendErr != nil {
+			break
+		}
+		forwarded += len(batch)
+		logSinkBuffers.Lock()
+		buffer.entries = buffer.entries[len(batch):]
+		logSinkBuffers.Unlock()
+	}
+
+	logSinkBuffers.Lock()
+	if sendErr != nil {
+		buffer.failures++
+		buffer.nextAttempt = time.Now().Add(min(logSinkRetryBase<<min(buffer.failures-1, 5), logSinkMaxRetry))
+	} else {
+		buffer.failures = 0
+		buffer.nextAttempt = time.Time{}
+	}
+	logSinkBuffers.Unlock()
+
+	var message *string
+	if sendErr != nil {
+		text := sendErr.Error()
+		message = &text
+	}
+	if err := api.LogAlerts.RecordLogSinkFlush(ctx, sink.ID, forwarded, dropped, message); err != nil {
+		WarnLog("Failed to record the flush of log sink %d: %v", sink.ID, err)
+	}
+	return sendErr
+}
+
+// SendLogEntries delivers entries to a sink in the format of its type
+func SendLogEntries(ctx context.Context, sink api.LogSink, entries []AppLogEntry) error {
+	sinkURL, err := DecryptString(sink.URL)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt sink URL: %w", err)
+	}
+	if err := ValidateLogSink(sink.SinkType, sinkURL); err != nil {
+		return err
+	}
+
+	if sink.SinkType == LogSinkSyslog {
+		return sendSyslog(ctx, sinkURL, entries)
+	}
+
+	var body bytes.Buffer
+	contentType := "application/json"
+	if sink.SinkType == LogSinkVector {
+		contentType = "application/x-ndjson"
+		encoder := json.NewEncoder(&body)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+	} else if err := json.NewEncoder(&body).Encode(entries); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sinkURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "Citizen-Logs/1.0")
+	if sink.AuthHeader != "" {
+		authHeader, err := DecryptString(sink.AuthHeader)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt sink auth header: %w", err)
+		}
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	resp, err := logSinkHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sink answered HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// syslogSeverities maps the detected levels to syslog severities
+var syslogSeverities = map[string]int{"debug": 7, "info": 6, "warn": 4, "error": 3}
+
+// sendSyslog sends entries as RFC 5424 messages of the user facility. Stream transports frame
+// them with octet counting (RFC 6587), UDP sends a datagram per message.
+func sendSyslog(ctx context.Context, sinkURL string, entries []AppLogEntry) error {
+	parsed, err := url.Parse(sinkURL)
+	if err != nil {
+		return err
+	}
+
+	var conn net.Conn
+	switch parsed.Scheme {
+	case "syslog+udp":
+		conn, err = logSinkDialer.DialContext(ctx, "udp", parsed.Host)
+	case "syslog+tls":
+		tlsDialer := &tls.Dialer{NetDialer: logSinkDialer, Config: &tls.Config{ServerName: parsed.Hostname()}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", parsed.Host)
+	default:
+		conn, err = logSinkDialer.DialContext(ctx, "tcp", parsed.Host)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(logSinkTimeout))
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	stream := parsed.Scheme != "syslog+udp"
+	var out bytes.Buffer
+	for _, entry := range entries {
+		procID := entry.Process
+		if procID == "" {
+			procID = "-"
+		}
+		message := fmt.Sprintf("<%d>1 %s %s %s %s - - %s", 8+syslogSeverities[entry.Level],
+			entry.Timestamp.UTC().Format(time.RFC3339Nano), hostname, entry.App, procID, entry.Message)
+		if !stream {
+			if _, err := conn.Write([]byte(message)); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(&out, "%d %s", len(message), message)
+	}
+	if stream {
+		_, err = conn.Write(out.Bytes())
+	}
+	return err
+}
@@ -0,0 +1,331 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processTypeRegex matches dokku process types (web, worker, release, ...)
+var processTypeRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,63}$`)
+
+// LogTailOptions selects which log lines TailAppLogs streams
+type LogTailOptions struct {
+	Process string // process type, empty for all processes
+	Tail    int    // number of lines to start with
+	Follow  bool   // keep streaming new lines
+	Raw     bool   // keep ANSI colors
+	Filter  *LogFilter
+}
+
+// TailAppLogs streams the logs of an app to w, one cleaned line at a time
+func TailAppLogs(ctx context.Context, appName string, options LogTailOptions, w io.Writer) error {
+	args := []string{"logs", appName}
+	if options.Tail > 0 {
+		args = append(args, "-n", fmt.Sprintf("%d", options.Tail))
+	}
+	if options.Process != "" {
+		if !processTypeRegex.MatchString(options.Process) {
+			return fmt.Errorf("invalid process type: %s", options.Process)
+		}
+		args = append(args, "-p", options.Process)
+	}
+	if options.Follow {
+		args = append(args, "-t")
+	}
+
+	transform := stripANSIColors
+	if options.Raw {
+		transform = func(line string) string { return line }
+	}
+	if options.Filter != nil {
+		match, clean := options.Filter.matcher(), transform
+		transform = func(line string) string {
+			if !match(line) {
+				return ""
+			}
+			return clean(line)
+		}
+	}
+
+	lines := &lineWriter{w: w, transform: transform}
+	err := StreamSSHCommand(ctx, strings.Join(args, " "), lines)
+	if flushErr := lines.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// lineWriter buffers partial lines and writes each complete line through transform
+type lineWriter struct {
+	w         io.Writer
+	transform func(string) string
+	partial   []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.partial = append(l.partial, p...)
+	for {
+		idx := bytes.IndexByte(l.partial, '\n')
+		if idx < 0 {
+			return len(p), nil
+		}
+		line := string(l.partial[:idx+1])
+		l.partial = l.partial[idx+1:]
+		if _, err := io.WriteString(l.w, l.transform(line)); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Flush writes a trailing line that did not end with a newline
+func (l *lineWriter) Flush() error {
+	if len(l.partial) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(l.w, l.transform(string(l.partial)))
+	l.partial = nil
+	return err
+}
+
+// LogCursor marks the last log line a client has seen
+type LogCursor struct {
+	Timestamp time.Time `json:"t"`
+	Skip      int       `json:"s"` // lines with exactly Timestamp already seen
+}
+
+// LogWindow selects log lines by time and by what the client already has
+type LogWindow struct {
+	Since  time.Time
+	Until  time.Time
+	Cursor *LogCursor
+}
+
+// LogWindowResult is the outcome of FilterLogWindow
+type LogWindowResult struct {
+	Logs       string
+	Lines      int
+	NextCursor string
+	// Truncated is set when lines between the cursor and the fetched tail were missed
+	Truncated bool
+}
+
+// EncodeLogCursor returns the opaque form of a cursor
+func EncodeLogCursor(cursor *LogCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeLogCursor parses a cursor returned by a previous call
+func DecodeLogCursor(value string) (*LogCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor LogCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Timestamp.IsZero() || cursor.Skip < 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// ParseLogTime parses an RFC3339 timestamp, unix seconds or a duration ago such as "15m"
+func ParseLogTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil && duration > 0 {
+		return time.Now().Add(-duration), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use RFC3339, unix seconds or a duration like 15m", value)
+}
+
+// FilterLogWindow keeps the lines of timestamped dokku log output inside the window.
+// Lines without a timestamp (e.g. wrapped stack traces) belong to the line before them.
+func FilterLogWindow(logs string, tail int, window LogWindow) LogWindowResult {
+	var kept []string
+	var lastTimestamp, firstTimestamp time.Time
+	seenAtTimestamp := 0
+	total := 0
+
+	for _, line := range strings.SplitAfter(logs, "\n") {
+		if line == "" {
+			continue
+		}
+		total++
+
+		if timestamp, ok := logLineTimestamp(line); ok {
+			if firstTimestamp.IsZero() {
+				firstTimestamp = timestamp
+			}
+			if timestamp.Equal(lastTimestamp) {
+				seenAtTimestamp++
+			} else {
+				lastTimestamp, seenAtTimestamp = timestamp, 1
+			}
+		}
+
+		if !window.includes(lastTimestamp, seenAtTimestamp) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	result := LogWindowResult{
+		Logs:  strings.Join(kept, ""),
+		Lines: len(kept),
+	}
+
+	// The next poll continues after the newest line fetched, even if it was filtered out
+	next := window.Cursor
+	if !lastTimestamp.IsZero() && (next == nil || !lastTimestamp.Before(next.Timestamp)) {
+		next = &LogCursor{Timestamp: lastTimestamp, Skip: seenAtTimestamp}
+	}
+	result.NextCursor = EncodeLogCursor(next)
+
+	if window.Cursor != nil && tail > 0 && total >= tail && firstTimestamp.After(window.Cursor.Timestamp) {
+		result.Truncated = true
+	}
+	return result
+}
+
+// includes reports whether a line logged at timestamp (the n-th line with that timestamp) is in the window
+func (w LogWindow) includes(timestamp time.Time, n int) bool {
+	if timestamp.IsZero() {
+		return w.Since.IsZero() && w.Cursor == nil
+	}
+	if !w.Since.IsZero() && timestamp.Before(w.Since) {
+		return false
+	}
+	if !w.Until.IsZero() && timestamp.After(w.Until) {
+		return false
+	}
+	if w.Cursor != nil {
+		if timestamp.Before(w.Cursor.Timestamp) {
+			return false
+		}
+		if timestamp.Equal(w.Cursor.Timestamp) && n <= w.Cursor.Skip {
+			return false
+		}
+	}
+	return true
+}
+
+// logLineTimestamp reads the leading timestamp dokku adds to log lines
+func logLineTimestamp(line string) (time.Time, bool) {
+	line = stripANSIColors(line)
+	end := strings.IndexByte(line, ' ')
+	if end <= 0 {
+		return time.Time{}, false
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, line[:end])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return timestamp, true
+}
+
+// maxLogGrepLength bounds the grep pattern a client can send
+const maxLogGrepLength = 200
+
+// logLevels ranks the levels a filter can select, lowest first
+var logLevels = map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+// logLevelRegex finds a level keyword such as "ERROR", "level=warn" or "\"level\":\"info\"" in a line
+var logLevelRegex = regexp.MustCompile(`(?i)\b(fatal|panic|crit(?:ical)?|err(?:or)?|warn(?:ing)?|info|notice|debug|trace)\b`)
+
+// LogFilter selects log lines by pattern and minimum level
+type LogFilter struct {
+	Pattern  *regexp.Regexp
+	MinLevel string
+}
+
+// ParseLogFilter builds a filter from a grep pattern and a minimum level, either may be empty
+func ParseLogFilter(grep, level string) (*LogFilter, error) {
+	filter := &LogFilter{}
+	if grep != "" {
+		if len(grep) > maxLogGrepLength {
+			return nil, fmt.Errorf("grep pattern must be at most %d characters", maxLogGrepLength)
+		}
+		pattern, err := regexp.Compile(grep)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grep pattern: %w", err)
+		}
+		filter.Pattern = pattern
+	}
+	if level != "" {
+		level = strings.ToLower(level)
+		if _, ok := logLevels[level]; !ok {
+			return nil, fmt.Errorf("invalid level %q: use debug, info, warn or error", level)
+		}
+		filter.MinLevel = level
+	}
+	if filter.Pattern == nil && filter.MinLevel == "" {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// Apply returns the lines of logs the filter keeps
+func (f *LogFilter) Apply(logs string) string {
+	if f == nil {
+		return logs
+	}
+
+	match := f.matcher()
+	var kept strings.Builder
+	for _, line := range strings.SplitAfter(logs, "\n") {
+		if line != "" && match(line) {
+			kept.WriteString(line)
+		}
+	}
+	return kept.String()
+}
+
+// matcher returns a line predicate. Lines without a level (e.g. stack traces) take the level of the
+// line before them, so a kept error keeps its trace.
+func (f *LogFilter) matcher() func(line string) bool {
+	currentLevel := "info"
+	return func(line string) bool {
+		plain := stripANSIColors(line)
+		if level, ok := detectLogLevel(plain); ok {
+			currentLevel = level
+		}
+		if f.MinLevel != "" && logLevels[currentLevel] < logLevels[f.MinLevel] {
+			return false
+		}
+		return f.Pattern == nil || f.Pattern.MatchString(plain)
+	}
+}
+
+// detectLogLevel guesses the level of a log line from common level keywords
+func detectLogLevel(line string) (string, bool) {
+	match := logLevelRegex.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+
+	switch keyword := strings.ToLower(match[1]); {
+	case keyword == "trace" || keyword == "debug":
+		return "debug", true
+	case keyword == "info" || keyword == "notice":
+		return "info", true
+	case strings.HasPrefix(keyword, "warn"):
+		return "warn", true
+	default:
+		return "error", true
+	}
+}
@@ -0,0 +1,656 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/database/api"
+)
+
+// AppManifest is the desired configuration of an app, kept in the app repository as citizen.yml.
+// Sections left out (nil) are not managed when the manifest is applied.
+type AppManifest struct {
+	App        string   `json:"app,omitempty"`
+	Type       string   `json:"type,omitempty"` // web or worker, worker apps have no port or domains
+	Builder    string   `json:"builder,omitempty"`
+	Port       int      `json:"port,omitempty"`
+	Buildpacks []string `json:"buildpacks,omitempty"`
+	// Env lists the names of the env vars the app needs, values are never exported
+	Env     []string        `json:"env,omitempty"`
+	Domains []string        `json:"domains,omitempty"`
+	Scale   map[string]int  `json:"scale,omitempty"`
+	Checks  *ManifestChecks `json:"checks,omitempty"`
+}
+
+// ManifestChecks are the process types whose zero-downtime checks are disabled or skipped
+type ManifestChecks struct {
+	Disabled []string `json:"disabled"`
+	Skipped  []string `json:"skipped"`
+}
+
+// ManifestChange is a change applying a manifest makes, or would make, to an app
+type ManifestChange struct {
+	Section string `json:"section"`
+	Action  string `json:"action"`
+	Detail  string `json:"detail"`
+	Applied bool   `json:"applied"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+	run     func(ctx context.Context) (string, error)
+}
+
+// ReadAppManifest reads the current configuration of an app from dokku. The domains dokku keeps
+// for worker-only apps are left out, nothing routes to them.
+func ReadAppManifest(ctx context.Context, appName string) (*AppManifest, error) {
+	domains, err := ListDomains(appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read domains: %w", err)
+	}
+	manifest := &AppManifest{
+		App:        appName,
+		Domains:    domains,
+		Buildpacks: []string{},
+		Env:        []string{},
+		Scale:      map[string]int{},
+		Checks:     &ManifestChecks{Disabled: []string{}, Skipped: []string{}},
+	}
+	if manifest.Type, err = api.Apps.GetAppType(ctx, appName); err != nil {
+		return nil, fmt.Errorf("failed to read app type: %w", err)
+	}
+	if manifest.Domains == nil || manifest.Type == AppTypeWorker {
+		manifest.Domains = []string{}
+	}
+
+	if manifest.Builder, err = dokkuReportValue("builder:report", appName, "--builder-selected"); err != nil {
+		return nil, fmt.Errorf("failed to read builder: %w", err)
+	}
+	portsMap, err := dokkuReportValue("ports:report", appName, "--ports-map")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ports: %w", err)
+	}
+	manifest.Port = containerPortFromMap(portsMap)
+	buildpacks, err := ListBuildpacks(appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read buildpacks: %w", err)
+	}
+	if buildpacks != nil {
+		manifest.Buildpacks = buildpacks
+	}
+
+	env, err := GetEnv(appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env: %w", err)
+	}
+	for key := range env {
+		if key != "PORT" {
+			manifest.Env = append(manifest.Env, key)
+		}
+	}
+	sort.Strings(manifest.Env)
+
+	scaleOutput, err := CitizenCommandContext(ctx, "ps:scale", appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scale: %w", err)
+	}
+	manifest.Scale = parseProcessScale(scaleOutput)
+
+	for _, list := range []struct {
+		flag  string
+		value *[]string
+	}{
+		{"--checks-disabled-list", &manifest.Checks.Disabled},
+		{"--checks-skipped-list", &manifest.Checks.Skipped},
+	} {
+		value, err := dokkuReportValue("checks:report", appName, list.flag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read checks: %w", err)
+		}
+		*list.value = parseProcessList(value)
+	}
+
+	return manifest, nil
+}
+
+// parseProcessScale reads the "web: 2" lines of ps:scale
+func parseProcessScale(output string) map[string]int {
+	scale := make(map[string]int)
+	for _, line := range strings.Split(output, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || !IsValidProcessType(name) {
+			continue
+		}
+		if count, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			scale[name] = count
+		}
+	}
+	return scale
+}
+
+// parseProcessList reads a comma separated list of process types, where "none" is empty
+func parseProcessList(value string) []string {
+	list := []string{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && name != "none" {
+			list = append(list, name)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Validate checks the values of a manifest before it is applied
+func (m *AppManifest) Validate() error {
+	if m.Type != "" {
+		if err := ValidateAppType(m.Type); err != nil {
+			return err
+		}
+	}
+	if m.Type == AppTypeWorker && (m.Port != 0 || len(m.Domains) > 0) {
+		return fmt.Errorf("worker apps serve no HTTP, remove port and domains from the manifest")
+	}
+	if m.Builder != "" && !slices.Contains([]string{"herokuish", "pack", "dockerfile", "nixpacks"}, m.Builder) {
+		return fmt.Errorf("invalid builder %q", m.Builder)
+	}
+	if m.Port < 0 || m.Port > 65535 {
+		return fmt.Errorf("invalid port %d", m.Port)
+	}
+	for _, buildpack := range m.Buildpacks {
+		if !strings.HasPrefix(buildpack, "https://") && !strings.HasPrefix(buildpack, "http://") {
+			return fmt.Errorf("invalid buildpack %q, expected a URL", buildpack)
+		}
+	}
+	for _, domain := range m.Domains {
+		if domain == "" || strings.ContainsAny(domain, " /:@") {
+			return fmt.Errorf("invalid domain %q", domain)
+		}
+	}
+	for processType, count := range m.Scale {
+		if !IsValidProcessType(processType) || count < 0 {
+			return fmt.Errorf("invalid scale %s=%d", processType, count)
+		}
+	}
+	if m.Checks != nil {
+		for _, processType := range append(slices.Clone(m.Checks.Disabled), m.Checks.Skipped...) {
+			if processType != "_all_" && !IsValidProcessType(processType) {
+				return fmt.Errorf("invalid process type %q in checks", processType)
+			}
+		}
+	}
+	return nil
+}
+
+// PlanAppManifest lists the changes that bring an app from its current configuration to the
+// desired one. Domains missing from the manifest are only removed with prune. Env vars are never
+// set, missing ones are reported. The port and new domains of worker-only apps are reported and
+// skipped.
+func PlanAppManifest(appName string, current, desired *AppManifest, prune bool, userID *int) []*ManifestChange {
+	var changes []*ManifestChange
+	add := func(section, action, detail string, run func(ctx context.Context) (string, error)) {
+		changes = append(changes, &ManifestChange{Section: section, Action: action, Detail: detail, run: run})
+	}
+
+	appType := current.Type
+	if desired.Type != "" && desired.Type != current.Type {
+		appType = desired.Type
+		add("type", "set", fmt.Sprintf("%q -> %q", current.Type, appType), func(ctx context.Context) (string, error) {
+			output, err := ApplyAppType(ctx, appName, appType)
+			if err == nil {
+				err = api.Apps.SetAppType(ctx, appName, appType, userID)
+			}
+			return output, err
+		})
+	}
+	worker := appType == AppTypeWorker
+
+	if desired.Builder != "" && desired.Builder != current.Builder {
+		builder := desired.Builder
+		add("builder", "set", fmt.Sprintf("%q -> %q", current.Builder, builder), func(ctx context.Context) (string, error) {
+			return CitizenCommandContext(ctx, "builder:set", appName, "selected", builder)
+		})
+	}
+
+	if desired.Buildpacks != nil && !slices.Equal(desired.Buildpacks, current.Buildpacks) {
+		buildpacks := desired.Buildpacks
+		add("buildpacks", "replace", strings.Join(buildpacks, ", "), func(ctx context.Context) (string, error) {
+			output, err := CitizenCommandContext(ctx, "buildpacks:clear", appName)
+			for _, buildpack := range buildpacks {
+				if err != nil {
+					break
+				}
+				var addOutput string
+				addOutput, err = CitizenCommandContext(ctx, "buildpacks:add", appName, buildpack)
+				output += "\n" + addOutput
+			}
+			return output, err
+		})
+	}
+
+	if worker && desired.Port != 0 {
+		changes = append(changes, &ManifestChange{Section: "port", Action: "skip", Detail: "worker apps have no port"})
+	} else if desired.Port != 0 && desired.Port != current.Port {
+		port := strconv.Itoa(desired.Port)
+		add("port", "set", fmt.Sprintf("%d -> %d", current.Port, desired.Port), func(ctx context.Context) (string, error) {
+			return CitizenCommandContext(ctx, "ports:set", appName, "http:80:"+port)
+		})
+	}
+
+	if desired.Domains != nil {
+		for _, domain := range desired.Domains {
+			if slices.Contains(current.Domains, domain) {
+				continue
+			}
+			if worker {
+				changes = append(changes, &ManifestChange{Section: "domains", Action: "skip", Detail: domain + " is not added, worker apps have no domains"})
+				continue
+			}
+			kind := OperationDomainAdd
+			if !isPlatformDomain(domain) {
+				kind = OperationCustomDomainAdd
+			}
+			add("domains", "add", domain, manifestOperation(kind, appName, domain, userID))
+		}
+		for _, domain := range current.Domains {
+			if slices.Contains(desired.Domains, domain) {
+				continue
+			}
+			if !prune {
+				changes = append(changes, &ManifestChange{Section: "domains", Action: "keep", Detail: domain + " is not in the manifest, apply with prune to remove it"})
+				continue
+			}
+			domain := domain
+			if isPlatformDomain(domain) {
+				add("domains", "remove", domain, func(ctx context.Context) (string, error) {
+					return CitizenCommandContext(ctx, "domains:remove", appName, domain)
+				})
+			} else {
+				add("domains", "remove", domain, manifestOperation(OperationCustomDomainRemove, appName, domain, userID))
+			}
+		}
+	}
+
+	if desired.Scale != nil {
+		var scale []string
+		processTypes := make([]string, 0, len(desired.Scale))
+		for processType := range desired.Scale {
+			processTypes = append(processTypes, processType)
+		}
+		sort.Strings(processTypes)
+		for _, processType := range processTypes {
+			if count, ok := current.Scale[processType]; !ok || count != desired.Scale[processType] {
+				scale = append(scale, processType+"="+strconv.Itoa(desired.Scale[processType]))
+			}
+		}
+		if len(scale) > 0 {
+			add("scale", "set", strings.Join(scale, " "), func(ctx context.Context) (string, error) {
+				return CitizenCommandContext(ctx, append([]string{"ps:scale", appName}, scale...)...)
+			})
+		}
+	}
+
+	if desired.Checks != nil && current.Checks != nil {
+		planChecks(appName, current.Checks, desired.Checks, add)
+	}
+
+	for _, key := range desired.Env {
+		if !slices.Contains(current.Env, key) && key != "PORT" {
+			changes = append(changes, &ManifestChange{Section: "env", Action: "missing", Detail: key + " is not set, set it with the env API"})
+		}
+	}
+
+	return changes
+}
+
+// planChecks re-enables the checks of process types no longer listed, then disables and skips
+// the listed ones
+func planChecks(appName string, current, desired *ManifestChecks, add func(string, string, string, func(context.Context) (string, error))) {
+	var enable []string
+	for _, processType := range append(slices.Clone(current.Disabled), current.Skipped...) {
+		if !slices.Contains(desired.Disabled, processType) && !slices.Contains(desired.Skipped, processType) &&
+			!slices.Contains(enable, processType) {
+			enable = append(enable, processType)
+		}
+	}
+	if len(enable) > 0 {
+		list := strings.Join(enable, ",")
+		add("checks", "enable", list, func(ctx context.Context) (string, error) {
+			return CitizenCommandContext(ctx, "checks:enable", appName, list)
+		})
+	}
+
+	for _, step := range []struct {
+		action   string
+		current  []string
+		desired  []string
+		argument string
+	}{
+		{"disable", current.Disabled, desired.Disabled, "checks:disable"},
+		{"skip", current.Skipped, desired.Skipped, "checks:skip"},
+	} {
+		var missing []string
+		for _, processType := range step.desired {
+			if !slices.Contains(step.current, processType) {
+				missing = append(missing, processType)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		list, command := strings.Join(missing, ","), step.argument
+		add("checks", step.action, list, func(ctx context.Context) (string, error) {
+			return CitizenCommandContext(ctx, command, appName, list)
+		})
+	}
+}
+
+// manifestOperation runs a domain change as an operation, so the database stays in line with dokku
+func manifestOperation(kind, appName, domain string, userID *int) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		op, err := RunOperation(ctx, kind, appName, domain, userID)
+		step := "dokku_add"
+		if kind == OperationCustomDomainRemove {
+			step = "dokku_remove"
+		}
+		return OperationStepOutput(op, step), err
+	}
+}
+
+// ApplyManifestChanges runs the planned changes in order, stopping at the first failure, and
+// reports whether they all succeeded
+func ApplyManifestChanges(ctx context.Context, changes []*ManifestChange) bool {
+	for _, change := range changes {
+		if change.run == nil {
+			continue
+		}
+		output, err := change.run(ctx)
+		change.Output = strings.TrimSpace(output)
+		if err != nil {
+			change.Error = err.Error()
+			return false
+		}
+		change.Applied = true
+	}
+	return true
+}
+
+// RenderAppManifest writes a manifest as citizen.yml
+func RenderAppManifest(m *AppManifest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# citizen.yml of %s, exported by Citizen on %s\n", m.App, time.Now().UTC().Format(time.RFC3339))
+	b.WriteString("# Apply it with POST /api/v1/apps/<app>/apply. Env values are not exported,\n")
+	b.WriteString("# the keys listed under env must be set with the env API.\n")
+
+	writeScalar := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", key, manifestScalar(value))
+		}
+	}
+	writeList := func(indent, key string, values []string) {
+		if len(values) == 0 {
+			fmt.Fprintf(&b, "%s%s: []\n", indent, key)
+			return
+		}
+		fmt.Fprintf(&b, "%s%s:\n", indent, key)
+		for _, value := range values {
+			fmt.Fprintf(&b, "%s  - %s\n", indent, manifestScalar(value))
+		}
+	}
+
+	writeScalar("app", m.App)
+	writeScalar("type", m.Type)
+	writeScalar("builder", m.Builder)
+	if m.Port != 0 {
+		fmt.Fprintf(&b, "port: %d\n", m.Port)
+	}
+	writeList("", "buildpacks", m.Buildpacks)
+	writeList("", "env", m.Env)
+	writeList("", "domains", m.Domains)
+
+	if len(m.Scale) == 0 {
+		b.WriteString("scale: {}\n")
+	} else {
+		b.WriteString("scale:\n")
+		processTypes := make([]string, 0, len(m.Scale))
+		for processType := range m.Scale {
+			processTypes = append(processTypes, processType)
+		}
+		sort.Strings(processTypes)
+		for _, processType := range processTypes {
+			fmt.Fprintf(&b, "  %s: %d\n", processType, m.Scale[processType])
+		}
+	}
+
+	if m.Checks != nil {
+		b.WriteString("checks:\n")
+		writeList("  ", "disabled", m.Checks.Disabled)
+		writeList("  ", "skipped", m.Checks.Skipped)
+	}
+	return b.String()
+}
+
+// manifestScalar quotes a value when YAML wouldn't read it back as the same string
+func manifestScalar(value string) string {
+	if value == "" || strings.ContainsAny(value, ":#'\"{}[],&*!|>%@`") || strings.TrimSpace(value) != value ||
+		slices.Contains([]string{"true", "false", "yes", "no", "null", "~"}, strings.ToLower(value)) {
+		return strconv.Quote(value)
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// ParseAppManifest reads citizen.yml. It supports the subset of YAML RenderAppManifest writes:
+// scalars, lists of scalars and maps of scalars, block or flow style, one level deep (two for
+// checks). Unknown keys are rejected so a typo doesn't silently leave a section unmanaged.
+func ParseAppManifest(data []byte) (*AppManifest, error) {
+	manifest := &AppManifest{}
+	var section, subsection string
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		raw := stripManifestComment(scanner.Text())
+		if strings.TrimSpace(raw) == "" || strings.TrimSpace(raw) == "---" {
+			continue
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+		line := strings.TrimSpace(raw)
+		fail := func(format string, args ...interface{}) (*AppManifest, error) {
+			return nil, fmt.Errorf("citizen.yml line %d: %s", lineNumber, fmt.Sprintf(format, args...))
+		}
+
+		if item, ok := strings.CutPrefix(line, "- "); ok || line == "-" {
+			value, err := unquoteManifestScalar(item)
+			if err != nil {
+				return fail("%v", err)
+			}
+			list := manifest.listFor(section, subsection)
+			if list == nil {
+				return fail("unexpected list item")
+			}
+			*list = append(*list, value)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fail("expected key: value")
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		if indent == 0 {
+			section, subsection = key, ""
+			if err := manifest.setTopLevel(key, value); err != nil {
+				return fail("%v", err)
+			}
+			continue
+		}
+
+		switch section {
+		case "scale":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return fail("scale of %s must be a number", key)
+			}
+			manifest.Scale[key] = count
+		case "checks":
+			if key != "disabled" && key != "skipped" {
+				return fail("unknown checks key %q", key)
+			}
+			subsection = key
+			list := manifest.listFor(section, subsection)
+			values, err := parseManifestFlowList(value)
+			if err != nil {
+				return fail("%v", err)
+			}
+			*list = append(*list, values...)
+		default:
+			return fail("unexpected nested key %q", key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// setTopLevel sets a top-level key of the manifest, value being empty for block sections
+func (m *AppManifest) setTopLevel(key, value string) error {
+	switch key {
+	case "app", "type", "builder":
+		scalar, err := unquoteManifestScalar(value)
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "app":
+			m.App = scalar
+		case "type":
+			m.Type = scalar
+		default:
+			m.Builder = scalar
+		}
+	case "port":
+		scalar, err := unquoteManifestScalar(value)
+		if err != nil {
+			return err
+		}
+		port, err := strconv.Atoi(scalar)
+		if err != nil {
+			return fmt.Errorf("port must be a number")
+		}
+		m.Port = port
+	case "buildpacks", "env", "domains":
+		values, err := parseManifestFlowList(value)
+		if err != nil {
+			return err
+		}
+		*m.listFor(key, "") = values
+	case "scale":
+		m.Scale = map[string]int{}
+		flow := strings.TrimSpace(value)
+		if flow == "" || flow == "{}" {
+			return nil
+		}
+		if !strings.HasPrefix(flow, "{") || !strings.HasSuffix(flow, "}") {
+			return fmt.Errorf("scale must be a map")
+		}
+		for _, entry := range strings.Split(strings.Trim(flow, "{}"), ",") {
+			processType, count, ok := strings.Cut(entry, ":")
+			n, err := strconv.Atoi(strings.TrimSpace(count))
+			if !ok || err != nil {
+				return fmt.Errorf("invalid scale entry %q", strings.TrimSpace(entry))
+			}
+			m.Scale[strings.TrimSpace(processType)] = n
+		}
+	case "checks":
+		m.Checks = &ManifestChecks{Disabled: []string{}, Skipped: []string{}}
+		if value != "" && value != "{}" {
+			return fmt.Errorf("checks must be a block with disabled and skipped lists")
+		}
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	return nil
+}
+
+// listFor returns the list a "- item" line under a section belongs to
+func (m *AppManifest) listFor(section, subsection string) *[]string {
+	switch section {
+	case "buildpacks":
+		return &m.Buildpacks
+	case "env":
+		return &m.Env
+	case "domains":
+		return &m.Domains
+	case "checks":
+		switch subsection {
+		case "disabled":
+			return &m.Checks.Disabled
+		case "skipped":
+			return &m.Checks.Skipped
+		}
+	}
+	return nil
+}
+
+// parseManifestFlowList reads an inline list like "[a, b]", an empty value starting a block list
+func parseManifestFlowList(value string) ([]string, error) {
+	values := []string{}
+	if value == "" || value == "[]" {
+		return values, nil
+	}
+	if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("expected a list, got %q", value)
+	}
+	for _, item := range strings.Split(strings.Trim(value, "[]"), ",") {
+		scalar, err := unquoteManifestScalar(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		if scalar != "" {
+			values = append(values, scalar)
+		}
+	}
+	return values, nil
+}
+
+// unquoteManifestScalar reads a plain, single or double quoted scalar
+func unquoteManifestScalar(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("unterminated quoted value %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	return value, nil
+}
+
+// stripManifestComment removes a comment from a line, leaving # inside quotes alone
+func stripManifestComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
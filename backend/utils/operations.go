@@ -0,0 +1,360 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"backend/database/api"
+)
+
+// Kinds of operations run as recorded steps
+const (
+	OperationCustomDomainAdd    = "custom_domain_add"
+	OperationCustomDomainRemove = "custom_domain_remove"
+	OperationDomainAdd          = "domain_add"
+	OperationAppDestroy         = "app_destroy"
+)
+
+const (
+	// OperationStaleAfter is how long an unfinished operation goes without update before it is
+	// considered abandoned by the API and reconciled
+	OperationStaleAfter = 15 * time.Minute
+	// OperationRetryDelay is how long a retrying operation waits between attempts
+	OperationRetryDelay = 2 * time.Minute
+	// maxOperationAttempts is how many times a retrying operation runs before it is failed
+	maxOperationAttempts = 5
+	// maxStepOutput bounds the command output kept with a step
+	maxStepOutput = 2000
+)
+
+// OperationStep is one step of an operation
+type OperationStep struct {
+	Name string
+	Do   func(ctx context.Context) (string, error)
+	// Undo compensates Do. Once a step without one is done, the operation can't be undone and a
+	// later failure is retried instead of compensated.
+	Undo func(ctx context.Context) error
+	// BestEffort steps record their failure without failing the operation
+	BestEffort bool
+}
+
+// operationKinds builds the steps of each kind of operation from its app and target, so an
+// operation the API stopped running can be picked up from its record
+var operationKinds = map[string]func(appName, target string) []OperationStep{
+	OperationCustomDomainAdd: func(appName, domain string) []OperationStep {
+		return []OperationStep{
+			{
+				Name: "db_register",
+				Do: func(ctx context.Context) (string, error) {
+					return "", api.Settings.CreateCustomDomain(ctx, appName, domain)
+				},
+				Undo: func(ctx context.Context) error { return api.Settings.DeleteCustomDomain(ctx, appName, domain) },
+			},
+			{
+				Name: "deployment_domain",
+				Do: func(ctx context.Context) (string, error) {
+					return "", api.Deployments.UpdateDeploymentDomain(ctx, appName, domain)
+				},
+				BestEffort: true,
+			},
+			{
+				Name: "dokku_add",
+				Do:   func(ctx context.Context) (string, error) { return AddDomain(appName, domain) },
+				Undo: func(ctx context.Context) error { _, err := RemoveDomain(appName, domain); return err },
+			},
+			traefikReloadStep(),
+			{
+				Name: "propagation_watch",
+				Do: func(ctx context.Context) (string, error) {
+					return "", StartDomainPropagation(ctx, appName, domain)
+				},
+				BestEffort: true,
+			},
+		}
+	},
+	OperationCustomDomainRemove: func(appName, domain string) []OperationStep {
+		return []OperationStep{
+			{
+				Name: "dokku_remove",
+				Do:   func(ctx context.Context) (string, error) { return RemoveDomain(appName, domain) },
+				Undo: func(ctx context.Context) error { _, err := AddDomain(appName, domain); return err },
+			},
+			{
+				Name: "db_unregister",
+				Do: func(ctx context.Context) (string, error) {
+					return "", api.Settings.DeleteCustomDomain(ctx, appName, domain)
+				},
+				Undo: func(ctx context.Context) error { return api.Settings.CreateCustomDomain(ctx, appName, domain) },
+			},
+			{
+				Name: "deployment_domain",
+				Do: func(ctx context.Context) (string, error) {
+					return "", api.Deployments.UpdateDeploymentDomain(ctx, appName, "")
+				},
+				BestEffort: true,
+			},
+			traefikReloadStep(),
+		}
+	},
+	OperationDomainAdd: func(appName, domain string) []OperationStep {
+		return []OperationStep{
+			{
+				Name: "dokku_add",
+				Do:   func(ctx context.Context) (string, error) { return AddDomain(appName, domain) },
+				Undo: func(ctx context.Context) error { _, err := RemoveDomain(appName, domain); return err },
+			},
+		}
+	},
+	OperationAppDestroy: func(appName, _ string) []OperationStep {
+		return []OperationStep{
+			{
+				Name: "dokku_destroy",
+				Do:   func(ctx context.Context) (string, error) { return DestroyApp(appName) },
+			},
+			{
+				Name: "db_cleanup",
+				Do: func(ctx context.Context) (string, error) {
+					return "", api.Deployments.DeleteAllAppData(ctx, appName)
+				},
+			},
+		}
+	},
+}
+
+func traefikReloadStep() OperationStep {
+	return OperationStep{
+		Name:       "traefik_reload",
+		Do:         func(ctx context.Context) (string, error) { return "", ReloadTraefikContext(ctx) },
+		BestEffort: true,
+	}
+}
+
+// RunOperation records an operation and runs its steps. When a step fails, the steps done are
+// compensated in reverse order, or, past a step that can't be undone, the operation is left to
+// the reconciler to retry. The error is the one of the failed step.
+func RunOperation(ctx context.Context, kind, appName, target string, userID *int) (*api.Operation, error) {
+	build, ok := operationKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown operation kind %q", kind)
+	}
+	steps := build(appName, target)
+
+	op := &api.Operation{
+		Kind:    kind,
+		AppName: appName,
+		Target:  target,
+		Status:  api.OperationRunning,
+		UserID:  userID,
+	}
+	if id := CorrelationIDFromContext(ctx); id != "" {
+		op.RequestID = &id
+	}
+	for _, step := range steps {
+		op.Steps = append(op.Steps, api.OperationStepState{Name: step.Name, Status: api.StepPending})
+	}
+	// The steps still run without a record, as they did before operations were recorded
+	if err := api.Operations.CreateOperation(ctx, op); err != nil {
+		WarnLog("Failed to record %s operation on %s: %v", kind, appName, err)
+	}
+
+	return op, runOperationSteps(ctx, op, steps, 0)
+}
+
+// OperationStepOutput returns the output a step of an operation recorded
+func OperationStepOutput(op *api.Operation, name string) string {
+	for _, step := range op.Steps {
+		if step.Name == name {
+			return step.Output
+		}
+	}
+	return ""
+}
+
+// FailedOperationStep returns the step an operation failed at, or "" when none failed
+func FailedOperationStep(op *api.Operation) string {
+	for _, step := range op.Steps {
+		if step.Status == api.StepFailed {
+			return step.Name
+		}
+	}
+	return ""
+}
+
+// runOperationSteps runs the steps of an operation from the index from
+func runOperationSteps(ctx context.Context, op *api.Operation, steps []OperationStep, from int) error {
+	for i := from; i < len(steps); i++ {
+		state := &op.Steps[i]
+		output, err := steps[i].Do(ctx)
+		state.Output = truncateStepOutput(output)
+		if err == nil {
+			state.Status, state.Error = api.StepDone, ""
+			saveOperation(ctx, op)
+			continue
+		}
+
+		state.Error = err.Error()
+		if steps[i].BestEffort {
+			state.Status = api.StepSkipped
+			WarnLog("Best effort step %s of %s operation on %s failed: %v", state.Name, op.Kind, op.AppName, err)
+			saveOperation(ctx, op)
+			continue
+		}
+
+		state.Status = api.StepFailed
+		message := fmt.Sprintf("%s: %v", state.Name, err)
+		op.Error = &message
+		op.Attempts++
+		if !operationUndoable(op, steps) {
+			op.Status = api.OperationRetrying
+			if op.Attempts >= maxOperationAttempts {
+				op.Status = api.OperationFailed
+			}
+			WarnLog("%s operation %d on %s failed at %s, it can't be undone: %v", op.Kind, op.ID, op.AppName, state.Name, err)
+			saveOperation(ctx, op)
+			return err
+		}
+		compensateOperation(ctx, op, steps)
+		return err
+	}
+
+	op.Status = api.OperationCompleted
+	op.Error = nil
+	now := time.Now()
+	op.CompletedAt = &now
+	saveOperation(ctx, op)
+	return nil
+}
+
+// operationUndoable reports whether every step that ran can be compensated
+func operationUndoable(op *api.Operation, steps []OperationStep) bool {
+	for i, state := range op.Steps {
+		ran := state.Status == api.StepDone || state.Status == api.StepInterrupted
+		if ran && steps[i].Undo == nil && !steps[i].BestEffort {
+			return false
+		}
+	}
+	return true
+}
+
+// compensateOperation undoes the steps that ran, last first. An operation whose compensation
+// fails is marked failed for an admin to look at.
+func compensateOperation(ctx context.Context, op *api.Operation, steps []OperationStep) {
+	op.Status = api.OperationCompensating
+	saveOperation(ctx, op)
+
+	for i := len(op.Steps) - 1; i >= 0; i-- {
+		state := &op.Steps[i]
+		ran := state.Status == api.StepDone || state.Status == api.StepInterrupted
+		if !ran || steps[i].Undo == nil {
+			continue
+		}
+		if err := steps[i].Undo(ctx); err != nil {
+			state.Error = "compensation failed: " + err.Error()
+			op.Status = api.OperationFailed
+			WarnLog("Failed to compensate step %s of %s operation %d on %s: %v", state.Name, op.Kind, op.ID, op.AppName, err)
+			saveOperation(ctx, op)
+			return
+		}
+		state.Status = api.StepCompensated
+		saveOperation(ctx, op)
+	}
+
+	op.Status = api.OperationCompensated
+	now := time.Now()
+	op.CompletedAt = &now
+	saveOperation(ctx, op)
+}
+
+// ReconcileOperations picks up the operations left unfinished: abandoned ones are compensated or,
+// past a step that can't be undone, run forward like the retrying ones. It returns how many were
+// reconciled.
+func ReconcileOperations(ctx context.Context) (int, error) {
+	stuck, err := api.Operations.ListStuckOperations(ctx, time.Now().Add(-OperationRetryDelay))
+	if err != nil {
+		return 0, err
+	}
+
+	reconciled := 0
+	for i := range stuck {
+		op := &stuck[i]
+		switch {
+		case op.Status == api.OperationFailed:
+			continue // left for an admin
+		case op.Status != api.OperationRetrying && time.Since(op.UpdatedAt) < OperationStaleAfter:
+			continue // likely still running
+		}
+		if err := ReconcileOperation(ctx, op); err != nil {
+			WarnLog("Failed to reconcile %s operation %d on %s: %v", op.Kind, op.ID, op.AppName, err)
+			continue
+		}
+		reconciled++
+	}
+	return reconciled, nil
+}
+
+// ReconcileOperation resumes an unfinished or failed operation: steps interrupted by a stop of the
+// API are assumed to have run, then the operation is compensated when it can be undone, and
+// retried forward otherwise
+func ReconcileOperation(ctx context.Context, op *api.Operation) error {
+	build, ok := operationKinds[op.Kind]
+	if !ok {
+		return fmt.Errorf("unknown operation kind %q", op.Kind)
+	}
+	steps := build(op.AppName, op.Target)
+	if len(steps) != len(op.Steps) {
+		return fmt.Errorf("operation %d has %d steps recorded, its kind now has %d", op.ID, len(op.Steps), len(steps))
+	}
+
+	claimed, err := api.Operations.ClaimOperation(ctx, op)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return fmt.Errorf("operation %d is being updated", op.ID)
+	}
+
+	next := len(op.Steps)
+	for i, state := range op.Steps {
+		if state.Status == api.StepPending || state.Status == api.StepFailed {
+			next = i
+			break
+		}
+	}
+	if op.Status == api.OperationRunning && next < len(op.Steps) && op.Steps[next].Status == api.StepPending {
+		op.Steps[next].Status = api.StepInterrupted
+	}
+
+	if op.Status == api.OperationCompensating || (op.Status != api.OperationRetrying && operationUndoable(op, steps)) {
+		compensateOperation(ctx, op, steps)
+		if op.Status == api.OperationFailed {
+			return fmt.Errorf("compensation failed")
+		}
+		return nil
+	}
+
+	// Forward: the interrupted or failed step runs again
+	op.Status = api.OperationRetrying
+	if next < len(op.Steps) {
+		op.Steps[next].Status = api.StepPending
+	}
+	return runOperationSteps(ctx, op, steps, next)
+}
+
+// saveOperation stores the progress of a recorded operation
+func saveOperation(ctx context.Context, op *api.Operation) {
+	if op.ID == 0 {
+		return
+	}
+	// The record must be kept up to date even when the request that runs it is cancelled
+	if err := api.Operations.SaveOperation(context.WithoutCancel(ctx), op); err != nil {
+		WarnLog("Failed to save %s operation %d: %v", op.Kind, op.ID, err)
+	}
+}
+
+func truncateStepOutput(output string) string {
+	if len(output) > maxStepOutput {
+		return output[:maxStepOutput] + "..."
+	}
+	return output
+}
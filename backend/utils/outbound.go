@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+// isPrivateIP reports whether an address is loopback, private, link-local or unspecified, the
+// addresses connections to user-configured hosts must not reach
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// publicOnlyDialer returns a dialer that fails with refusal instead of connecting to a private
+// address. The check runs on the resolved address of every connection, so neither DNS rebinding
+// nor redirects get around it.
+func publicOnlyDialer(timeout time.Duration, refusal error) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+				return refusal
+			}
+			return nil
+		},
+	}
+}
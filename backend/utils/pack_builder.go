@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"backend/database/api"
+)
+
+// buildEnvKeyPattern matches the env keys buildpacks read at build time, like BP_NODE_VERSION or
+// BUILDPACK_XTRACE
+var buildEnvKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,127}$`)
+
+// PackBuildSettings is a change of the pack settings of an app. BuildEnv holds the values of the
+// build env keys, set in the app config where pack reads them during builds.
+type PackBuildSettings struct {
+	BuilderImage string            `json:"builder_image"`
+	RunImage     string            `json:"run_image"`
+	BuildEnv     map[string]string `json:"build_env"`
+}
+
+// Validate checks the image references and build env keys
+func (s *PackBuildSettings) Validate() error {
+	for name, image := range map[string]string{"builder_image": s.BuilderImage, "run_image": s.RunImage} {
+		if image == "" {
+			continue
+		}
+		if err := ValidateImageReference(imageWithoutDigest(image)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	for key := range s.BuildEnv {
+		if !buildEnvKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid build env key %q, use uppercase letters, digits and _", key)
+		}
+		if key == "PORT" {
+			return fmt.Errorf("PORT is set by Citizen and can't be a build env key")
+		}
+	}
+	return nil
+}
+
+// imageDigestPattern matches the digest pinning an image by content
+var imageDigestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// imageWithoutDigest strips a "@sha256:..." digest from an image reference
+func imageWithoutDigest(image string) string {
+	if name, digest, ok := strings.Cut(image, "@"); ok && imageDigestPattern.MatchString(digest) {
+		return name
+	}
+	return image
+}
+
+// ApplyPackSettings applies the pack settings of an app in dokku and returns them as stored. The
+// builder image is the "stack" property of the buildpacks plugin, the run image is passed to pack
+// through the build docker options, and the build env goes to the app config without a restart,
+// as only the next build reads it. Keys dropped from the build env are unset.
+func ApplyPackSettings(appName string, previous *api.PackSettings, next *PackBuildSettings) (*api.PackSettings, error) {
+	applied := &api.PackSettings{
+		AppName:      appName,
+		BuilderImage: next.BuilderImage,
+		RunImage:     next.RunImage,
+		BuildEnvKeys: []string{},
+	}
+
+	if next.BuilderImage != previous.BuilderImage {
+		args := []string{"buildpacks:set-property", appName, "stack"}
+		if next.BuilderImage != "" {
+			args = append(args, next.BuilderImage)
+		}
+		if _, err := CitizenCommand(args...); err != nil {
+			return nil, fmt.Errorf("failed to set the builder image: %w", err)
+		}
+	}
+
+	if next.RunImage != previous.RunImage {
+		if previous.RunImage != "" {
+			if _, err := CitizenCommand("docker-options:remove", appName, "build", "--run-image="+previous.RunImage); err != nil {
+				return nil, fmt.Errorf("failed to remove the previous run image: %w", err)
+			}
+		}
+		if next.RunImage != "" {
+			if _, err := CitizenCommand("docker-options:add", appName, "build", "--run-image="+next.RunImage); err != nil {
+				return nil, fmt.Errorf("failed to set the run image: %w", err)
+			}
+		}
+	}
+
+	if len(next.BuildEnv) > 0 {
+		result, err := SetEnvVerified(appName, next.BuildEnv, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set the build env: %w", err)
+		}
+		if result.Failed > 0 {
+			return nil, fmt.Errorf("failed to set %d build env keys", result.Failed)
+		}
+	}
+	for key := range next.BuildEnv {
+		applied.BuildEnvKeys = append(applied.BuildEnvKeys, key)
+	}
+	slices.Sort(applied.BuildEnvKeys)
+
+	for _, key := range previous.BuildEnvKeys {
+		if _, kept := next.BuildEnv[key]; kept {
+			continue
+		}
+		if _, err := CitizenCommand("config:unset", "--no-restart", appName, key); err != nil {
+			return nil, fmt.Errorf("failed to unset build env key %s: %w", key, err)
+		}
+	}
+	return applied, nil
+}
+
+// PackBuilderImage returns the CNB builder image the next build of an app uses, "" when the app
+// isn't built with pack
+func PackBuilderImage(appName string) (string, error) {
+	builder, err := dokkuReportValue("builder:report", appName, "--builder-computed-selected")
+	if err != nil || builder != "pack" {
+		return "", err
+	}
+	return dokkuReportValue("buildpacks:report", appName, "--buildpacks-computed-stack")
+}
@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/database/api"
+)
+
+const (
+	// DefaultPipelineTestTimeout bounds the test stage of pipelines saved without a timeout
+	DefaultPipelineTestTimeout = 10 * time.Minute
+	// MaxPipelineTestTimeout is the longest test stage a pipeline can ask for
+	MaxPipelineTestTimeout = time.Hour
+	// pipelineStageLogLimit caps the logs kept for a stage, larger logs keep their head and tail
+	pipelineStageLogLimit = 1 << 20
+	// unsafePipelineCommandChars can't go through the dokku command line of the test command
+	unsafePipelineCommandChars = "\r\n'\"\\$`;|&<>"
+)
+
+// Pipeline stages in the order a deployment goes through them
+const (
+	PipelineStageBuild  = "build"
+	PipelineStageTest   = "test"
+	PipelineStageDeploy = "deploy"
+)
+
+var pipelineStages = []string{PipelineStageBuild, PipelineStageTest, PipelineStageDeploy}
+
+// ErrPipelineTestFailed is returned when the test stage of a pipeline stops a deployment
+var ErrPipelineTestFailed = errors.New("the test stage failed, the new build was not deployed")
+
+// ValidatePipeline checks the test command and timeout of a pipeline, defaulting the timeout
+func ValidatePipeline(pipeline *api.Pipeline) error {
+	pipeline.TestCommand = strings.TrimSpace(pipeline.TestCommand)
+	if pipeline.TestCommand == "" || len(pipeline.TestCommand) > 1024 {
+		return fmt.Errorf("the test command must be between 1 and 1024 characters")
+	}
+	if strings.ContainsAny(pipeline.TestCommand, unsafePipelineCommandChars) {
+		return fmt.Errorf("the test command can't contain quotes, newlines or shell operators, run a script of the app instead")
+	}
+	if pipeline.TestTimeoutSeconds == 0 {
+		pipeline.TestTimeoutSeconds = int(DefaultPipelineTestTimeout / time.Second)
+	}
+	if pipeline.TestTimeoutSeconds < 10 || pipeline.TestTimeoutSeconds > int(MaxPipelineTestTimeout/time.Second) {
+		return fmt.Errorf("the test timeout must be between 10 and %d seconds", int(MaxPipelineTestTimeout/time.Second))
+	}
+	return nil
+}
+
+// stageRecorder records the stages of the deployment a context runs, it does nothing for
+// deployments that weren't recorded
+type stageRecorder struct {
+	deploymentID int
+	recorded     bool
+}
+
+func newStageRecorder(ctx context.Context) *stageRecorder {
+	id, ok := DeploymentIDFromContext(ctx)
+	return &stageRecorder{deploymentID: id, recorded: ok}
+}
+
+func (r *stageRecorder) start(name string) {
+	if !r.recorded {
+		return
+	}
+	if err := api.Deployments.StartDeploymentStage(context.Background(), r.deploymentID, name, stagePosition(name)); err != nil {
+		WarnLog("Failed to record the %s stage of deployment %d: %v", name, r.deploymentID, err)
+	}
+}
+
+func (r *stageRecorder) finish(name, status, logs string, stageErr error) {
+	if !r.recorded {
+		return
+	}
+	errorMessage := ""
+	if stageErr != nil {
+		errorMessage = stageErr.Error()
+	}
+	if err := api.Deployments.FinishDeploymentStage(context.Background(), r.deploymentID, name, stagePosition(name), status, logs, errorMessage); err != nil {
+		WarnLog("Failed to record the %s stage of deployment %d: %v", name, r.deploymentID, err)
+	}
+}
+
+// skipAfter records the stages after name as skipped
+func (r *stageRecorder) skipAfter(name string) {
+	for _, stage := range pipelineStages[stagePosition(name):] {
+		r.finish(stage, "skipped", "", nil)
+	}
+}
+
+// stagePosition returns the 1-based position of a stage in the pipeline
+func stagePosition(name string) int {
+	for i, stage := range pipelineStages {
+		if stage == name {
+			return i + 1
+		}
+	}
+	return len(pipelineStages) + 1
+}
+
+// deployThroughPipeline builds an app from git without deploying it, runs the test command of
+// its pipeline in a one-off container of the new build and only deploys the build when the
+// test passes. A failed test leaves the running release untouched and points the app image back
+// to the last deployed build, so restarts don't pick up the untested one.
+func deployThroughPipeline(ctx context.Context, pipeline *api.Pipeline, appName, gitURL, ref string) (string, error) {
+	diagnostics := DiagnosticsFromContext(ctx)
+	stages := newStageRecorder(ctx)
+	var output strings.Builder
+
+	// 🏗️ Build: dokku builds and releases the app but skips the deploy while it is held
+	stages.start(PipelineStageBuild)
+	diagnostics.Info("pipeline", "building %s without deploying it", appName)
+	if _, err := CitizenCommandContext(ctx, "config:set", "--no-restart", appName, "DOKKU_SKIP_DEPLOY=true"); err != nil {
+		err = fmt.Errorf("failed to hold the deploy of the new build: %w", err)
+		stages.finish(PipelineStageBuild, "failed", "", err)
+		stages.skipAfter(PipelineStageBuild)
+		return "", err
+	}
+	held := true
+	release := func(ctx context.Context) error {
+		if !held {
+			return nil
+		}
+		if _, err := CitizenCommandContext(ctx, "config:unset", "--no-restart", appName, "DOKKU_SKIP_DEPLOY"); err != nil {
+			return err
+		}
+		held = false
+		return nil
+	}
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := release(releaseCtx); err != nil {
+			diagnostics.Warn("pipeline", "failed to unset DOKKU_SKIP_DEPLOY, the next deploys won't start: %v", err)
+		}
+	}()
+
+	buildOutput, err := CitizenCommandContext(ctx, "git:sync", "--build", appName, gitURL, ref)
+	output.WriteString("=== Build ===\n" + buildOutput)
+	if err != nil {
+		err = pipelineStageError(ctx, diagnostics, appName, PipelineStageBuild, err)
+		stages.finish(PipelineStageBuild, stageFailureStatus(ctx), buildOutput, err)
+		stages.skipAfter(PipelineStageBuild)
+		return output.String(), err
+	}
+	stages.finish(PipelineStageBuild, "success", buildOutput, nil)
+	diagnostics.Info("pipeline", "build completed")
+
+	// 🧪 Test: the test command runs in a one-off container of the new build
+	stages.start(PipelineStageTest)
+	timeout := time.Duration(pipeline.TestTimeoutSeconds) * time.Second
+	diagnostics.Info("pipeline", "running the test command with a %s timeout", timeout)
+	testCtx, cancelTest := context.WithTimeout(ctx, timeout)
+	testOutput := newBoundedOutput(pipelineStageLogLimit, false)
+	err = StreamSSHCommand(testCtx, strings.Join([]string{"run", appName, pipeline.TestCommand}, " "), testOutput)
+	testTimedOut := errors.Is(testCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+	cancelTest()
+	testLogs := testOutput.String()
+	output.WriteString("\n\n=== Test ===\n" + testLogs)
+	if err != nil {
+		status := "failed"
+		switch {
+		case testTimedOut:
+			err = fmt.Errorf("%w: the test command exceeded %s", ErrPipelineTestFailed, timeout)
+		case ctx.Err() != nil:
+			status = stageFailureStatus(ctx)
+			err = pipelineStageError(ctx, diagnostics, appName, PipelineStageTest, err)
+		default:
+			err = fmt.Errorf("%w: %v", ErrPipelineTestFailed, err)
+		}
+		if status == "failed" {
+			diagnostics.Error("pipeline", "test stage failed: %v", err)
+		}
+		stages.finish(PipelineStageTest, status, testLogs, err)
+		stages.skipAfter(PipelineStageTest)
+		restorePreviousImage(diagnostics, appName)
+		return output.String(), err
+	}
+	stages.finish(PipelineStageTest, "success", testLogs, nil)
+	diagnostics.Info("pipeline", "test stage passed")
+
+	// 🚀 Deploy: the tested build gets the traffic
+	stages.start(PipelineStageDeploy)
+	if err := release(ctx); err != nil {
+		err = fmt.Errorf("failed to release the deploy of the new build: %w", err)
+		stages.finish(PipelineStageDeploy, "failed", "", err)
+		return output.String(), err
+	}
+	deployOutput, err := CitizenCommandContext(ctx, "deploy", appName)
+	output.WriteString("\n\n=== Deploy ===\n" + deployOutput)
+	if err != nil {
+		err = pipelineStageError(ctx, diagnostics, appName, PipelineStageDeploy, err)
+		stages.finish(PipelineStageDeploy, stageFailureStatus(ctx), deployOutput, err)
+		return output.String(), err
+	}
+	stages.finish(PipelineStageDeploy, "success", deployOutput, nil)
+	diagnostics.Info("pipeline", "deploy completed")
+
+	signalRouteUpdate(diagnostics, appName, gitURL)
+	return output.String(), nil
+}
+
+// pipelineStageError returns the error of a failed stage, like DeployFromGitContext does for
+// deployments cancelled or over the max build duration
+func pipelineStageError(ctx context.Context, diagnostics *DeployDiagnostics, appName, stage string, err error) error {
+	if ctx.Err() == nil {
+		diagnostics.Error("pipeline", "%s stage failed: %v", stage, err)
+		return err
+	}
+
+	reason := DeploymentErrorStatus(ctx)
+	diagnostics.Error("pipeline", "%s stage aborted (%s)", stage, reason)
+	if RequireCapability(FeatureAppLocking) == nil {
+		if _, unlockErr := UnlockApp(appName); unlockErr != nil {
+			diagnostics.Warn("deploy", "failed to release the deploy lock: %v", unlockErr)
+		}
+	}
+	if reason == "timeout" {
+		return fmt.Errorf("deployment exceeded the maximum build duration of %s", GetMaxBuildDuration())
+	}
+	return ErrDeploymentCancelled
+}
+
+// stageFailureStatus returns the status of a stage that ended with an error
+func stageFailureStatus(ctx context.Context) string {
+	if reason := DeploymentErrorStatus(ctx); reason != "" {
+		return reason
+	}
+	return "failed"
+}
+
+// restorePreviousImage points the app image back to the build of the last successful deployment
+func restorePreviousImage(diagnostics *DeployDiagnostics, appName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	previous, err := api.Deployments.GetLatestSuccessfulDeployment(ctx, appName)
+	if err != nil || previous.ImageID == "" {
+		diagnostics.Warn("pipeline", "no previous build to restore, the app image is the untested build")
+		return
+	}
+	if err := TagImage(ctx, previous.ImageID, AppImageRef(appName)); err != nil {
+		diagnostics.Warn("pipeline", "failed to restore the image of deployment %d: %v", previous.ID, err)
+		return
+	}
+	diagnostics.Info("pipeline", "app image restored to the build of deployment %d", previous.ID)
+}
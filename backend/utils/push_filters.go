@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"backend/database/api"
+)
+
+// maxPushFilterEntries bounds each user and team list of a push filter
+const maxPushFilterEntries = 100
+
+var (
+	gitHubLoginPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,38})$`)
+	gitHubTeamPattern  = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,38})/[a-z0-9_-]{1,100}$`)
+)
+
+// PushFilterResult tells whether a push may auto-deploy and why
+type PushFilterResult struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+// NormalizePushFilter lowercases, trims and deduplicates the lists of a push filter and checks
+// they hold GitHub logins and org/team-slug names
+func NormalizePushFilter(filter *api.PushFilter) error {
+	lists := []struct {
+		name    string
+		entries *[]string
+		pattern *regexp.Regexp
+	}{
+		{"allowed_users", &filter.AllowedUsers, gitHubLoginPattern},
+		{"allowed_teams", &filter.AllowedTeams, gitHubTeamPattern},
+		{"denied_users", &filter.DeniedUsers, gitHubLoginPattern},
+		{"denied_teams", &filter.DeniedTeams, gitHubTeamPattern},
+	}
+	for _, list := range lists {
+		normalized := []string{}
+		for _, entry := range *list.entries {
+			entry = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(entry), "@"))
+			if entry == "" || slices.Contains(normalized, entry) {
+				continue
+			}
+			if !list.pattern.MatchString(entry) {
+				return fmt.Errorf("invalid entry %q in %s", entry, list.name)
+			}
+			normalized = append(normalized, entry)
+		}
+		if len(normalized) > maxPushFilterEntries {
+			return fmt.Errorf("%s may hold at most %d entries", list.name, maxPushFilterEntries)
+		}
+		*list.entries = normalized
+	}
+	return nil
+}
+
+// CheckPushFilter decides whether a push auto-deploys. Denied users and teams block a push when
+// they match the pusher or the author of the head commit, allow lists let it through when one of
+// them matches. Team memberships are read from GitHub with accessToken, which needs the read:org
+// scope; a membership that can't be checked blocks the push.
+func CheckPushFilter(filter *api.PushFilter, accessToken, pusher, author string) PushFilterResult {
+	if filter == nil || filter.IsEmpty() {
+		return PushFilterResult{Allowed: true, Reason: "No push filter"}
+	}
+
+	logins := []string{}
+	for _, login := range []string{pusher, author} {
+		login = strings.ToLower(login)
+		if login != "" && !slices.Contains(logins, login) {
+			logins = append(logins, login)
+		}
+	}
+	if len(logins) == 0 {
+		return PushFilterResult{Reason: "The push has no GitHub pusher or author to check"}
+	}
+
+	for _, login := range logins {
+		if slices.Contains(filter.DeniedUsers, login) {
+			return PushFilterResult{Reason: fmt.Sprintf("%s is denied", login)}
+		}
+		for _, team := range filter.DeniedTeams {
+			member, err := IsGitHubTeamMember(accessToken, team, login)
+			if err != nil {
+				return PushFilterResult{Reason: fmt.Sprintf("Failed to check whether %s is in denied team %s: %v", login, team, err)}
+			}
+			if member {
+				return PushFilterResult{Reason: fmt.Sprintf("%s is in denied team %s", login, team)}
+			}
+		}
+	}
+
+	if len(filter.AllowedUsers) == 0 && len(filter.AllowedTeams) == 0 {
+		return PushFilterResult{Allowed: true, Reason: fmt.Sprintf("%s is not denied", strings.Join(logins, " and "))}
+	}
+	var checkErr error
+	for _, login := range logins {
+		if slices.Contains(filter.AllowedUsers, login) {
+			return PushFilterResult{Allowed: true, Reason: fmt.Sprintf("%s is allowed", login)}
+		}
+		for _, team := range filter.AllowedTeams {
+			member, err := IsGitHubTeamMember(accessToken, team, login)
+			if err != nil {
+				checkErr = err
+				continue
+			}
+			if member {
+				return PushFilterResult{Allowed: true, Reason: fmt.Sprintf("%s is in allowed team %s", login, team)}
+			}
+		}
+	}
+	if checkErr != nil {
+		return PushFilterResult{Reason: fmt.Sprintf("%s is not allowed, some team memberships could not be checked: %v",
+			strings.Join(logins, " and "), checkErr)}
+	}
+	return PushFilterResult{Reason: fmt.Sprintf("%s is not allowed", strings.Join(logins, " and "))}
+}
+
+// IsGitHubTeamMember reports whether a user is an active member of an org/team-slug team
+func IsGitHubTeamMember(accessToken, team, login string) (bool, error) {
+	org, slug, ok := strings.Cut(team, "/")
+	if !ok {
+		return false, fmt.Errorf("invalid team %q", team)
+	}
+	if accessToken == "" {
+		return false, fmt.Errorf("no GitHub token to read team memberships")
+	}
+
+	url := fmt.Sprintf("https://api.github.com/orgs/%s/teams/%s/memberships/%s", org, slug, login)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "token "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := doGitHubRequest(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("GitHub returned HTTP %d, the token may lack the read:org scope", resp.StatusCode)
+	}
+
+	var membership struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&membership); err != nil {
+		return false, err
+	}
+	return membership.State == "active", nil
+}
@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// maxRepoFileSize caps the size of a config file fetched from a repository
+const maxRepoFileSize = 1 << 20
+
+// parseGitHubRepoURL extracts owner and repository name from a GitHub clone URL
+func parseGitHubRepoURL(gitUrl string) (owner, repo string, ok bool) {
+	cleanUrl := strings.TrimSuffix(strings.TrimSpace(gitUrl), ".git")
+
+	var path string
+	switch {
+	case strings.HasPrefix(cleanUrl, "git@github.com:"):
+		path = strings.TrimPrefix(cleanUrl, "git@github.com:")
+	case strings.Contains(cleanUrl, "github.com/"):
+		path = cleanUrl[strings.Index(cleanUrl, "github.com/")+len("github.com/"):]
+	default:
+		return "", "", false
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// listGitHubRootFiles lists the files at the root of a repository ref with a single Git Trees API call
+func listGitHubRootFiles(ctx context.Context, owner, repo, ref, accessToken string) (map[string]bool, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/git/trees/%s", owner, repo, url.PathEscape(ref))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "token "+accessToken)
+	}
+
+	resp, err := doGitHubRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("repository or ref not found: %s/%s@%s", owner, repo, ref)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub trees API returned HTTP %d for %s/%s@%s", resp.StatusCode, owner, repo, ref)
+	}
+
+	var tree struct {
+		SHA  string `json:"sha"`
+		Tree []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		} `json:"tree"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tree); err != nil {
+		return nil, fmt.Errorf("failed to decode tree response: %w", err)
+	}
+
+	files := make(map[string]bool, len(tree.Tree))
+	for _, entry := range tree.Tree {
+		if entry.Type == "blob" {
+			files[entry.Path] = true
+		}
+	}
+	return files, nil
+}
+
+// fetchGitHubRawFile downloads a single file from raw.githubusercontent.com
+func fetchGitHubRawFile(ctx context.Context, owner, repo, ref, path, accessToken string) ([]byte, error) {
+	rawURL := fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/%s", owner, repo, ref, path)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "token "+accessToken)
+	}
+
+	resp, err := doGitHubRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("unauthorized access to %s - private repository requires authentication", path)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("file not found: %s", path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, path)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxRepoFileSize))
+}
+
+// fetchGitHubRootFiles lists the repository root once and fetches, in parallel, those of the
+// wanted files that actually exist. Missing files are simply absent from the result; a failed
+// download of an existing file is returned as an error so partial results are never cached.
+func fetchGitHubRootFiles(ctx context.Context, owner, repo, ref, accessToken string, wanted []string) (map[string][]byte, error) {
+	existing, err := listGitHubRootFiles(ctx, owner, repo, ref, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		results  = make(map[string][]byte)
+		fetchErr error
+	)
+	for _, name := range wanted {
+		if !existing[name] {
+			continue
+		}
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			data, err := fetchGitHubRawFile(ctx, owner, repo, ref, name, accessToken)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				fmt.Printf("[CONFIG] ❌ Failed to fetch %s: %v\n", name, err)
+				if fetchErr == nil {
+					fetchErr = err
+				}
+				return
+			}
+			results[name] = data
+		}(name)
+	}
+	wg.Wait()
+
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	return results, nil
+}
+
+// resolveGitHubCommitSHA resolves a branch or ref to its current commit SHA
+func resolveGitHubCommitSHA(ctx context.Context, owner, repo, ref, accessToken string) (string, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/commits/%s", owner, repo, url.PathEscape(ref))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return "", err
+	}
+	// The sha media type returns only the commit SHA as plain text
+	req.Header.Set("Accept", "application/vnd.github.sha")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "token "+accessToken)
+	}
+
+	resp, err := doGitHubRequest(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GitHub commits API returned HTTP %d for %s/%s@%s", resp.StatusCode, owner, repo, ref)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// githubFileExists checks whether a file exists at a path of a repository ref with the Contents API
+func githubFileExists(ctx context.Context, owner, repo, ref, path, accessToken string) (bool, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/contents/%s?ref=%s", owner, repo,
+		(&url.URL{Path: path}).EscapedPath(), url.QueryEscape(ref))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "token "+accessToken)
+	}
+
+	resp, err := doGitHubRequest(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var entry struct {
+			Type string `json:"type"`
+		}
+		// A directory answers with a list, which doesn't decode into an entry
+		if err := json.NewDecoder(io.LimitReader(resp.Body, maxRepoFileSize)).Decode(&entry); err != nil {
+			return false, nil
+		}
+		return entry.Type == "file", nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("GitHub contents API returned HTTP %d for %s/%s@%s", resp.StatusCode, owner, repo, ref)
+	}
+}
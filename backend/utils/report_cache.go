@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultReportCacheTTL is how long a report is served from cache when REPORT_CACHE_TTL is unset
+	defaultReportCacheTTL = time.Minute
+	// maxCachedReports bounds the cache against requests for made-up app names
+	maxCachedReports = 2000
+)
+
+// Kinds of cached reports
+const (
+	ReportBuildpacks     = "buildpacks:report"
+	ReportBuilder        = "builder:report"
+	ReportBuildpacksList = "buildpacks:list"
+)
+
+// reportChangingCommands change what the cached reports of the apps they name show
+var reportChangingCommands = map[string]bool{
+	"builder:set":            true,
+	"builder-dockerfile:set": true,
+	"builder-pack:set":       true,
+	"buildpacks:add":         true,
+	"buildpacks:set":         true,
+	"buildpacks:remove":      true,
+	"buildpacks:clear":       true,
+	"git:sync":               true,
+	"git:from-image":         true,
+	"ps:rebuild":             true,
+	"apps:destroy":           true,
+	"apps:rename":            true,
+}
+
+type cachedReport struct {
+	value    interface{}
+	storedAt time.Time
+}
+
+var (
+	reportCache   = make(map[string]cachedReport)
+	reportCacheMu sync.Mutex
+)
+
+// ReportCacheTTL returns how long reports are served from cache (REPORT_CACHE_TTL), 0 turns the
+// cache off
+func ReportCacheTTL() time.Duration {
+	value := os.Getenv("REPORT_CACHE_TTL")
+	if value == "" {
+		return defaultReportCacheTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return defaultReportCacheTTL
+	}
+	return ttl
+}
+
+// CachedReport returns a report of an app from cache, or loads and caches it when it is missing,
+// expired or refresh is set. It also returns the age of a cached report, -1 for a fresh one.
+// Failed loads are not cached.
+func CachedReport[T any](kind, appName string, refresh bool, load func() (T, error)) (T, time.Duration, error) {
+	key := appName + "\x00" + kind
+	ttl := ReportCacheTTL()
+
+	if !refresh && ttl > 0 {
+		reportCacheMu.Lock()
+		cached, ok := reportCache[key]
+		reportCacheMu.Unlock()
+		if value, typed := cached.value.(T); ok && typed {
+			if age := time.Since(cached.storedAt); age < ttl {
+				return value, age, nil
+			}
+		}
+	}
+
+	value, err := load()
+	if err != nil || ttl == 0 {
+		return value, -1, err
+	}
+
+	reportCacheMu.Lock()
+	if len(reportCache) >= maxCachedReports {
+		for k, stale := range reportCache {
+			if time.Since(stale.storedAt) >= ttl {
+				delete(reportCache, k)
+			}
+		}
+	}
+	if len(reportCache) < maxCachedReports {
+		reportCache[key] = cachedReport{value: value, storedAt: time.Now()}
+	}
+	reportCacheMu.Unlock()
+	return value, -1, nil
+}
+
+// InvalidateReports drops the cached reports of an app
+func InvalidateReports(appName string) {
+	prefix := appName + "\x00"
+	reportCacheMu.Lock()
+	for key := range reportCache {
+		if strings.HasPrefix(key, prefix) {
+			delete(reportCache, key)
+		}
+	}
+	reportCacheMu.Unlock()
+}
+
+// invalidateReportsAfter drops the cached reports of the apps a command changes. The app isn't
+// always the first argument, so every argument is tried.
+func invalidateReportsAfter(args []string) {
+	if len(args) == 0 || !reportChangingCommands[args[0]] {
+		return
+	}
+	for _, arg := range args[1:] {
+		if !strings.HasPrefix(arg, "-") {
+			InvalidateReports(arg)
+		}
+	}
+}
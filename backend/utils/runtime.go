@@ -0,0 +1,293 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RuntimeVersions are the runtimes an app can pin, with the release lines the builders provide
+var RuntimeVersions = map[string][]string{
+	"node":   {"18", "20", "22", "24"},
+	"python": {"3.9", "3.10", "3.11", "3.12", "3.13"},
+	"go":     {"1.21", "1.22", "1.23", "1.24"},
+}
+
+// runtimeEnvVars are the config vars each builder reads the runtime version from. The first one
+// (Cloud Native Buildpacks) is where the pin is read back from. Herokuish's Node and Python
+// buildpacks only read versions from the repository (package.json, runtime.txt), and Dockerfile
+// builds ignore these vars, which is why conflicts with the repository are reported.
+var runtimeEnvVars = map[string][]string{
+	"node":   {"BP_NODE_VERSION", "NIXPACKS_NODE_VERSION", "NODE_VERSION"},
+	"python": {"BP_CPYTHON_VERSION", "NIXPACKS_PYTHON_VERSION", "PYTHON_VERSION"},
+	"go":     {"BP_GO_VERSION", "NIXPACKS_GO_VERSION", "GOVERSION"},
+}
+
+// runtimeVersionRegex matches a version pin such as "20", "3.12" or "1.22.3"
+var runtimeVersionRegex = regexp.MustCompile(`^\d+(\.\d+){0,2}$`)
+
+// RuntimeDeclaration is a runtime version required by a file in the repository
+type RuntimeDeclaration struct {
+	Runtime    string `json:"runtime"`
+	Constraint string `json:"constraint"`
+	Source     string `json:"source"`
+}
+
+// RuntimeConflict is a pin that doesn't satisfy a version declared in the repository
+type RuntimeConflict struct {
+	Runtime    string `json:"runtime"`
+	Pinned     string `json:"pinned"`
+	Constraint string `json:"constraint"`
+	Source     string `json:"source"`
+	Message    string `json:"message"`
+}
+
+// ValidateRuntimePin checks the runtime can be pinned and the version is one the builders provide
+func ValidateRuntimePin(runtime, version string) error {
+	lines, ok := RuntimeVersions[runtime]
+	if !ok {
+		return fmt.Errorf("unknown runtime %q, expected one of %s", runtime, strings.Join(runtimeNames(), ", "))
+	}
+	if !runtimeVersionRegex.MatchString(version) {
+		return fmt.Errorf("invalid %s version %q", runtime, version)
+	}
+	for _, line := range lines {
+		if version == line || strings.HasPrefix(version, line+".") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %s is not available, available versions: %s", runtime, version, strings.Join(lines, ", "))
+}
+
+// runtimeNames lists the runtimes that can be pinned, sorted
+func runtimeNames() []string {
+	names := make([]string, 0, len(RuntimeVersions))
+	for name := range RuntimeVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RuntimePinEnv returns the config vars that pin runtime to version for every builder
+func RuntimePinEnv(runtime, version string) map[string]string {
+	env := make(map[string]string)
+	for _, key := range runtimeEnvVars[runtime] {
+		value := version
+		if key == "GOVERSION" {
+			// The Heroku Go buildpack expects the toolchain name
+			value = "go" + version
+		}
+		env[key] = value
+	}
+	return env
+}
+
+// RuntimePinEnvKeys returns the config vars used to pin runtime
+func RuntimePinEnvKeys(runtime string) []string {
+	return runtimeEnvVars[runtime]
+}
+
+// RuntimePinsFromEnv returns the pinned version of each runtime found in an app's config vars
+func RuntimePinsFromEnv(env map[string]string) map[string]string {
+	pins := make(map[string]string)
+	for runtime, keys := range runtimeEnvVars {
+		if version := env[keys[0]]; version != "" {
+			pins[runtime] = version
+		}
+	}
+	return pins
+}
+
+// runtimeFiles are the repository files that declare runtime versions
+var runtimeFiles = []string{"package.json", ".nvmrc", ".node-version", "runtime.txt", ".python-version", "go.mod", ".tool-versions"}
+
+// DetectRuntimeDeclarations reads the runtime versions declared by the files at the root of a repository
+func DetectRuntimeDeclarations(gitUrl, branch string, userID *int) ([]RuntimeDeclaration, error) {
+	owner, repo, ok := parseGitHubRepoURL(gitUrl)
+	if !ok {
+		return nil, fmt.Errorf("runtime detection is only supported for GitHub repositories")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), portDetectionTimeout)
+	defer cancel()
+
+	files, err := fetchGitHubRootFiles(ctx, owner, repo, branch, getGitHubAccessTokenForRepo(gitUrl, userID), runtimeFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	declarations := []RuntimeDeclaration{}
+	for _, name := range runtimeFiles {
+		if data, exists := files[name]; exists {
+			declarations = append(declarations, parseRuntimeFile(name, data)...)
+		}
+	}
+	return declarations, nil
+}
+
+var goModDirectiveRegex = regexp.MustCompile(`(?m)^go\s+(\d+\.\d+(?:\.\d+)?)\s*$`)
+
+// parseRuntimeFile reads the runtime versions a single file declares
+func parseRuntimeFile(name string, data []byte) []RuntimeDeclaration {
+	declare := func(runtime, constraint string) []RuntimeDeclaration {
+		constraint = strings.TrimSpace(constraint)
+		if constraint == "" {
+			return nil
+		}
+		return []RuntimeDeclaration{{Runtime: runtime, Constraint: constraint, Source: name}}
+	}
+	firstLine := strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0])
+
+	switch name {
+	case "package.json":
+		var pkg struct {
+			Engines map[string]string `json:"engines"`
+		}
+		if json.Unmarshal(data, &pkg) != nil {
+			return nil
+		}
+		return declare("node", pkg.Engines["node"])
+	case ".nvmrc", ".node-version":
+		return declare("node", strings.TrimPrefix(firstLine, "v"))
+	case "runtime.txt":
+		return declare("python", strings.TrimPrefix(firstLine, "python-"))
+	case ".python-version":
+		return declare("python", firstLine)
+	case "go.mod":
+		// The go directive is the minimum version the module needs
+		if match := goModDirectiveRegex.FindSubmatch(data); match != nil {
+			return declare("go", ">="+string(match[1]))
+		}
+	case ".tool-versions":
+		var declarations []RuntimeDeclaration
+		tools := map[string]string{"nodejs": "node", "python": "python", "golang": "go"}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && tools[fields[0]] != "" {
+				declarations = append(declarations, declare(tools[fields[0]], fields[1])...)
+			}
+		}
+		return declarations
+	}
+	return nil
+}
+
+// RuntimeConflicts returns the pins that don't satisfy the versions declared in the repository
+func RuntimeConflicts(pins map[string]string, declarations []RuntimeDeclaration) []RuntimeConflict {
+	conflicts := []RuntimeConflict{}
+	for _, declaration := range declarations {
+		pinned, exists := pins[declaration.Runtime]
+		if !exists || RuntimeSatisfies(pinned, declaration.Constraint) {
+			continue
+		}
+		conflicts = append(conflicts, RuntimeConflict{
+			Runtime:    declaration.Runtime,
+			Pinned:     pinned,
+			Constraint: declaration.Constraint,
+			Source:     declaration.Source,
+			Message: fmt.Sprintf("%s is pinned to %s but %s requires %s", declaration.Runtime, pinned,
+				declaration.Source, declaration.Constraint),
+		})
+	}
+	return conflicts
+}
+
+// RuntimeSatisfies reports whether a pinned version can satisfy a version constraint such as
+// "20", "20.x", "^20.1", "~3.12", ">=18 <21" or "18 || 20". A pin like "20" stands for the whole
+// release line, so it is compared only as precisely as it is written. Unparsable constraints
+// (e.g. "lts/*") are treated as satisfied.
+func RuntimeSatisfies(pinned, constraint string) bool {
+	pin := parseRuntimeVersion(pinned)
+	if pin == nil {
+		return true
+	}
+
+	for _, alternative := range strings.Split(constraint, "||") {
+		satisfied := true
+		for _, part := range strings.Fields(alternative) {
+			if !versionMatches(pin, part) {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+// versionMatches checks a pin against a single comparator
+func versionMatches(pin []int, comparator string) bool {
+	operators := []string{">=", "<=", ">", "<", "=", "^", "~"}
+	operator := ""
+	for _, candidate := range operators {
+		if strings.HasPrefix(comparator, candidate) {
+			operator = candidate
+			break
+		}
+	}
+
+	raw := strings.TrimPrefix(strings.TrimPrefix(comparator, operator), "v")
+	raw = strings.TrimSuffix(strings.TrimSuffix(raw, ".x"), ".*")
+	if raw == "*" || raw == "x" || raw == "" {
+		return true
+	}
+	bound := parseRuntimeVersion(raw)
+	if bound == nil {
+		return true
+	}
+
+	cmp := compareRuntimeVersions(pin, bound)
+	switch operator {
+	case ">=":
+		return cmp >= 0
+	case ">":
+		return cmp > 0 || (cmp == 0 && len(pin) < len(bound))
+	case "<=":
+		return cmp <= 0
+	case "<":
+		return cmp < 0
+	case "^":
+		return cmp >= 0 && pin[0] == bound[0]
+	case "~":
+		return cmp >= 0 && compareRuntimeVersions(pin, bound[:min(2, len(bound))]) == 0
+	default:
+		return cmp == 0
+	}
+}
+
+// parseRuntimeVersion splits a dotted version into its numbers, nil when it isn't numeric
+func parseRuntimeVersion(version string) []int {
+	parts := strings.Split(version, ".")
+	numbers := make([]int, 0, len(parts))
+	for _, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
+
+// compareRuntimeVersions compares two versions on the numbers both of them specify
+func compareRuntimeVersions(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	// defaultSampleAppRepo is a small app dokku builds with its default builder, used when
+	// SAMPLE_APP_REPO is unset
+	defaultSampleAppRepo   = "https://github.com/heroku/node-js-getting-started"
+	defaultSampleAppBranch = "main"
+	// DefaultSampleAppName is the name onboarding gives the sample app when none is requested
+	DefaultSampleAppName = "hello-citizen"
+)
+
+// SampleAppSource returns the repository and branch of the sample app deployed during onboarding,
+// from SAMPLE_APP_REPO and SAMPLE_APP_BRANCH
+func SampleAppSource() (string, string) {
+	repo := strings.TrimSpace(os.Getenv("SAMPLE_APP_REPO"))
+	if repo == "" {
+		repo = defaultSampleAppRepo
+	}
+	branch := strings.TrimSpace(os.Getenv("SAMPLE_APP_BRANCH"))
+	if branch == "" {
+		branch = defaultSampleAppBranch
+	}
+	return repo, branch
+}
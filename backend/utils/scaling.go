@@ -0,0 +1,369 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/database/api"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// UsageSampleInterval is how often the resource usage of app containers is sampled
+const UsageSampleInterval = 5 * time.Minute
+
+// Kinds of scaling recommendations
+const (
+	RecommendationProcesses = "processes" // run more processes of a type
+	RecommendationMemory    = "memory"    // raise the memory limit of a process type, in MB
+)
+
+const (
+	// usageWindow is how many samples are kept per process type, an hour at the sample interval
+	usageWindow = 12
+	// minUsageSamples is how many samples a recommendation needs, so a spike doesn't trigger one
+	minUsageSamples = 3
+	// memoryPressurePercent is the peak memory use, relative to the limit, that calls for more memory
+	memoryPressurePercent = 85
+	// cpuPressurePercent is the average CPU use that calls for more processes
+	cpuPressurePercent = 80
+	// cpuTargetPercent is the average CPU use recommended process counts aim for
+	cpuTargetPercent = 60
+	// latencyPressureMs is the p95 latency that calls for more web processes when CPU is busy too
+	latencyPressureMs = 1000
+	// latencyMinRequests is how many requests the latency of the last hour needs to count
+	latencyMinRequests = 100
+	// usageSampleWorkers bounds the containers whose stats are read concurrently
+	usageSampleWorkers = 8
+)
+
+// ProcessUsage is the resource usage of the containers of one process type of an app
+type ProcessUsage struct {
+	ProcessType string `json:"process_type"`
+	Containers  int    `json:"containers"`
+	// CPUPercent averages the containers, relative to their CPU limit or to one core without one
+	CPUPercent float64 `json:"cpu_percent"`
+	// MemoryMB is the usage of the busiest container, page cache excluded
+	MemoryMB uint64 `json:"memory_mb"`
+	// MemoryLimitMB is 0 when the containers have no memory limit
+	MemoryLimitMB uint64    `json:"memory_limit_mb"`
+	SampledAt     time.Time `json:"sampled_at"`
+}
+
+// ScalingRecommendation is a scaling change suggested by the recent usage of an app
+type ScalingRecommendation struct {
+	ID          string `json:"id"`
+	Kind        string `json:"kind"`
+	ProcessType string `json:"process_type"`
+	Current     int64  `json:"current"`
+	Recommended int64  `json:"recommended"`
+	Reason      string `json:"reason"`
+	// RequiresRestart is set for changes applied by restarting the app
+	RequiresRestart bool `json:"requires_restart"`
+}
+
+// UsageCollector keeps the recent usage samples of the running app containers in memory
+type UsageCollector struct {
+	mu       sync.Mutex
+	samples  map[string]map[string][]ProcessUsage // app -> process type -> samples, oldest first
+	hostCPUs int
+}
+
+// Usage is the collector fed by the usage sampling task
+var Usage = &UsageCollector{samples: make(map[string]map[string][]ProcessUsage)}
+
+// containerUsage is the usage of a single container
+type containerUsage struct {
+	app, processType string
+	cpuPercent       float64
+	memoryMB         uint64
+	memoryLimitMB    uint64
+}
+
+// Sample reads the stats of every container Dokku runs for app processes and adds a sample per
+// app and process type. Apps without running containers are forgotten.
+func (u *UsageCollector) Sample(ctx context.Context) error {
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	hostCPUs := 0
+	if info, err := cli.Info(ctx); err == nil {
+		hostCPUs = info.NCPU
+	}
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", "com.dokku.app-name"),
+			filters.Arg("label", "com.dokku.container-type=deploy"),
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list app containers: %w", err)
+	}
+
+	usages := make([]*containerUsage, len(containers))
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for w := 0; w < min(usageSampleWorkers, len(containers)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				usage, err := readContainerUsage(ctx, cli, containers[i])
+				if err != nil {
+					DebugLog("Failed to read stats of container %s: %v", containers[i].ID, err)
+					continue
+				}
+				usages[i] = usage
+			}
+		}()
+	}
+	for i := range containers {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Containers of a process type are summed up: CPU averaged, memory at the busiest
+	now := time.Now()
+	current := make(map[string]map[string]*ProcessUsage)
+	cpuSums := make(map[*ProcessUsage]float64)
+	for _, usage := range usages {
+		if usage == nil {
+			continue
+		}
+		if current[usage.app] == nil {
+			current[usage.app] = make(map[string]*ProcessUsage)
+		}
+		process := current[usage.app][usage.processType]
+		if process == nil {
+			process = &ProcessUsage{ProcessType: usage.processType, SampledAt: now}
+			current[usage.app][usage.processType] = process
+		}
+		process.Containers++
+		cpuSums[process] += usage.cpuPercent
+		process.MemoryMB = max(process.MemoryMB, usage.memoryMB)
+		process.MemoryLimitMB = max(process.MemoryLimitMB, usage.memoryLimitMB)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.hostCPUs = hostCPUs
+	samples := make(map[string]map[string][]ProcessUsage, len(current))
+	for app, processes := range current {
+		samples[app] = make(map[string][]ProcessUsage, len(processes))
+		for processType, process := range processes {
+			process.CPUPercent = float64(int(cpuSums[process]/float64(process.Containers)*10)) / 10
+			history := append(u.samples[app][processType], *process)
+			if len(history) > usageWindow {
+				history = history[len(history)-usageWindow:]
+			}
+			samples[app][processType] = history
+		}
+	}
+	u.samples = samples
+	return nil
+}
+
+// readContainerUsage reads the CPU and memory use of a container against its limits
+func readContainerUsage(ctx context.Context, cli *client.Client, c types.Container) (*containerUsage, error) {
+	usage := &containerUsage{
+		app:         c.Labels["com.dokku.app-name"],
+		processType: c.Labels["com.dokku.process-type"],
+	}
+	if usage.processType == "" {
+		usage.processType = "web"
+	}
+
+	inspect, err := cli.ContainerInspect(ctx, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	var limitCPUs float64
+	if inspect.HostConfig != nil {
+		usage.memoryLimitMB = uint64(inspect.HostConfig.Memory) / (1024 * 1024)
+		limitCPUs = float64(inspect.HostConfig.NanoCPUs) / 1e9
+		if limitCPUs == 0 && inspect.HostConfig.CPUQuota > 0 && inspect.HostConfig.CPUPeriod > 0 {
+			limitCPUs = float64(inspect.HostConfig.CPUQuota) / float64(inspect.HostConfig.CPUPeriod)
+		}
+	}
+	if limitCPUs == 0 {
+		limitCPUs = 1
+	}
+
+	// Without streaming, the daemon waits for a second reading so the CPU delta is known
+	response, err := cli.ContainerStats(ctx, c.ID, false)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var stats types.StatsJSON
+	if err := json.NewDecoder(response.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("failed to decode stats: %w", err)
+	}
+
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		usage.cpuPercent = cpuDelta / systemDelta * onlineCPUs / limitCPUs * 100
+	}
+
+	// Like docker stats, page cache the kernel can reclaim doesn't count
+	memory := stats.MemoryStats.Usage
+	cache, ok := stats.MemoryStats.Stats["inactive_file"] // cgroup v2
+	if !ok {
+		cache = stats.MemoryStats.Stats["total_inactive_file"] // cgroup v1
+	}
+	if cache < memory {
+		memory -= cache
+	}
+	usage.memoryMB = memory / (1024 * 1024)
+	return usage, nil
+}
+
+// Forget drops the samples of an app, after a change that makes them stale
+func (u *UsageCollector) Forget(appName string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.samples, appName)
+}
+
+// AppUsage returns the samples of each process type of an app, oldest first
+func (u *UsageCollector) AppUsage(appName string) map[string][]ProcessUsage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	usage := make(map[string][]ProcessUsage, len(u.samples[appName]))
+	for processType, samples := range u.samples[appName] {
+		usage[processType] = append([]ProcessUsage(nil), samples...)
+	}
+	return usage
+}
+
+// GetScalingRecommendations suggests scaling changes from the usage samples of an app and the
+// latency of its traffic during the last hour: more memory for process types close to their
+// limit, and more web processes when they are CPU bound, or slow while busy.
+func GetScalingRecommendations(ctx context.Context, appName string) ([]ScalingRecommendation, error) {
+	usage := Usage.AppUsage(appName)
+	Usage.mu.Lock()
+	hostCPUs := Usage.hostCPUs
+	Usage.mu.Unlock()
+
+	var p95LatencyMs, requests int64
+	rollups, err := api.Traffic.ListTrafficRollups(ctx, appName, time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if _, total := SummarizeTraffic(rollups, "hour"); total.Requests >= latencyMinRequests {
+		p95LatencyMs, requests = total.P95LatencyMs, total.Requests
+	}
+
+	recommendations := []ScalingRecommendation{}
+	for processType, samples := range usage {
+		if len(samples) < minUsageSamples {
+			continue
+		}
+		latest := samples[len(samples)-1]
+
+		var peakMemoryMB uint64
+		var cpuSum float64
+		for _, sample := range samples {
+			peakMemoryMB = max(peakMemoryMB, sample.MemoryMB)
+			cpuSum += sample.CPUPercent
+		}
+		avgCPU := cpuSum / float64(len(samples))
+
+		if limit := latest.MemoryLimitMB; limit > 0 && peakMemoryMB*100 >= limit*memoryPressurePercent {
+			recommendations = append(recommendations, ScalingRecommendation{
+				ID:          RecommendationMemory + ":" + processType,
+				Kind:        RecommendationMemory,
+				ProcessType: processType,
+				Current:     int64(limit),
+				Recommended: int64(roundUpMB(max(limit, peakMemoryMB)*3/2, 128)),
+				Reason: fmt.Sprintf("%s processes peaked at %d MB of their %d MB memory limit in the last hour",
+					processType, peakMemoryMB, limit),
+				RequiresRestart: true,
+			})
+		}
+
+		if processType != "web" {
+			continue
+		}
+		cpuBound := avgCPU >= cpuPressurePercent
+		slowWhileBusy := p95LatencyMs >= latencyPressureMs && avgCPU >= cpuTargetPercent
+		if !cpuBound && !slowWhileBusy {
+			continue
+		}
+		current := int64(latest.Containers)
+		recommended := max(current+1, int64(float64(current)*avgCPU/cpuTargetPercent+0.999))
+		if hostCPUs > 0 {
+			recommended = min(recommended, int64(hostCPUs))
+		}
+		if recommended <= current {
+			continue
+		}
+		reason := fmt.Sprintf("web processes averaged %.0f%% CPU in the last hour", avgCPU)
+		if slowWhileBusy {
+			reason += fmt.Sprintf(" with a p95 latency of %d ms over %d requests", p95LatencyMs, requests)
+		}
+		recommendations = append(recommendations, ScalingRecommendation{
+			ID:          RecommendationProcesses + ":" + processType,
+			Kind:        RecommendationProcesses,
+			ProcessType: processType,
+			Current:     current,
+			Recommended: recommended,
+			Reason:      reason,
+		})
+	}
+
+	sort.Slice(recommendations, func(i, j int) bool { return recommendations[i].ID < recommendations[j].ID })
+	return recommendations, nil
+}
+
+// ApplyScalingRecommendation makes the change a recommendation suggests. Memory limits only
+// apply to new containers, so the app is restarted.
+func ApplyScalingRecommendation(ctx context.Context, appName string, recommendation ScalingRecommendation) (string, error) {
+	var output string
+	var err error
+	switch recommendation.Kind {
+	case RecommendationProcesses:
+		output, err = CitizenCommandContext(ctx, "ps:scale", appName,
+			recommendation.ProcessType+"="+strconv.FormatInt(recommendation.Recommended, 10))
+	case RecommendationMemory:
+		output, err = CitizenCommandContext(ctx, "resource:limit", "--memory", strconv.FormatInt(recommendation.Recommended, 10)+"m",
+			"--process-type", recommendation.ProcessType, appName)
+		if err == nil {
+			var restartOutput string
+			restartOutput, err = CitizenCommandContext(ctx, "ps:restart", appName)
+			output += "\n" + restartOutput
+		}
+	default:
+		return "", fmt.Errorf("unknown recommendation kind %q", recommendation.Kind)
+	}
+	if err != nil {
+		return output, err
+	}
+
+	// The samples were taken before the change
+	Usage.Forget(appName)
+	return output, nil
+}
+
+// roundUpMB rounds a size up to a multiple of step
+func roundUpMB(value, step uint64) uint64 {
+	return (value + step - 1) / step * step
+}
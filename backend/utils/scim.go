@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"backend/database/api"
+)
+
+// SCIMSettingKey is the system setting holding the SCIM provisioning config as JSON
+const SCIMSettingKey = "scim.provisioning"
+
+// SCIMConfig configures provisioning by an identity provider over SCIM, and how the groups it
+// pushes map to Citizen roles
+type SCIMConfig struct {
+	TokenHash   string            `json:"token_hash,omitempty"`   // SHA-256 of the bearer token, SCIM is off without one
+	AdminGroups []string          `json:"admin_groups,omitempty"` // members of these groups are admins, others aren't
+	TeamGroups  map[string]string `json:"team_groups,omitempty"`  // group name to team, the first group by name wins
+}
+
+// Enabled reports whether the identity provider has a token to provision with
+func (c *SCIMConfig) Enabled() bool {
+	return c.TokenHash != ""
+}
+
+// CheckToken reports whether a bearer token is the SCIM token
+func (c *SCIMConfig) CheckToken(token string) bool {
+	if !c.Enabled() || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(HashSCIMToken(token)), []byte(c.TokenHash)) == 1
+}
+
+// Validate checks group names and teams are set, team names are checked by the caller
+func (c *SCIMConfig) Validate() error {
+	for _, group := range c.AdminGroups {
+		if strings.TrimSpace(group) == "" {
+			return fmt.Errorf("admin group names can't be empty")
+		}
+	}
+	for group, team := range c.TeamGroups {
+		if strings.TrimSpace(group) == "" {
+			return fmt.Errorf("team group names can't be empty")
+		}
+		if team == "" {
+			return fmt.Errorf("group %q maps to no team", group)
+		}
+	}
+	return nil
+}
+
+// Roles returns the admin flag and team a user gets from the names of its groups. nil leaves the
+// flag or team as it is, when the config maps no group to it.
+func (c *SCIMConfig) Roles(groups []string) (isAdmin *bool, team *string) {
+	if len(c.AdminGroups) > 0 {
+		admin := false
+		for _, group := range groups {
+			for _, adminGroup := range c.AdminGroups {
+				if strings.EqualFold(group, adminGroup) {
+					admin = true
+				}
+			}
+		}
+		isAdmin = &admin
+	}
+
+	if len(c.TeamGroups) > 0 {
+		none := ""
+		team = &none
+		// Groups are sorted by name so a user in several mapped groups always gets the same team
+		for _, group := range groups {
+			for mapped, mappedTeam := range c.TeamGroups {
+				if strings.EqualFold(group, mapped) {
+					return isAdmin, &mappedTeam
+				}
+			}
+		}
+	}
+	return isAdmin, team
+}
+
+// HashSCIMToken returns the hash a SCIM token is stored as
+func HashSCIMToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetSCIMConfig returns the SCIM config, disabled when none is stored
+func GetSCIMConfig(ctx context.Context) *SCIMConfig {
+	config := &SCIMConfig{}
+
+	value, err := api.Settings.GetSystemSetting(ctx, SCIMSettingKey)
+	if err != nil {
+		if !errors.Is(err, api.ErrSettingNotFound) {
+			WarnLog("Failed to load SCIM config, provisioning is disabled: %v", err)
+		}
+		return config
+	}
+
+	if err := json.Unmarshal([]byte(value), config); err != nil {
+		WarnLog("Invalid SCIM config stored, provisioning is disabled: %v", err)
+		return &SCIMConfig{}
+	}
+	return config
+}
+
+// SaveSCIMConfig validates and stores the SCIM config
+func SaveSCIMConfig(ctx context.Context, config *SCIMConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return api.Settings.SetSystemSetting(ctx, SCIMSettingKey, string(value))
+}
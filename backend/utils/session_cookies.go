@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidSessionCookie is returned for cookies that aren't signed by this server
+var ErrInvalidSessionCookie = errors.New("invalid session cookie signature")
+
+var (
+	sessionKey     []byte
+	sessionKeyOnce sync.Once
+)
+
+// getSessionKey returns the key session cookies are signed with: SSO_SESSION_SECRET when set, so
+// sessions can be invalidated on their own, and otherwise a key derived from the encryption key
+func getSessionKey() ([]byte, error) {
+	sessionKeyOnce.Do(func() {
+		if secret := os.Getenv("SSO_SESSION_SECRET"); secret != "" {
+			sum := sha256.Sum256([]byte(secret))
+			sessionKey = sum[:]
+			return
+		}
+		if key, err := getEncryptionKey(); err == nil {
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte("citizen sso session cookie"))
+			sessionKey = mac.Sum(nil)
+		}
+	})
+	if sessionKey == nil {
+		return nil, ErrMissingEncryptionKey
+	}
+	return sessionKey, nil
+}
+
+// SignSessionID returns the cookie value of a session: its ID and an HMAC of it
+func SignSessionID(sessionID string) (string, error) {
+	return SignCookie("sso_session", sessionID)
+}
+
+// VerifySessionCookie checks the signature of a session cookie and returns the session ID
+func VerifySessionCookie(value string) (string, error) {
+	return VerifyCookie("sso_session", value)
+}
+
+// SignCookie returns a cookie value holding value and an HMAC of it for purpose, so a cookie
+// signed for one purpose isn't accepted for another. value must not contain dots.
+func SignCookie(purpose, value string) (string, error) {
+	key, err := getSessionKey()
+	if err != nil {
+		return "", err
+	}
+	return value + "." + cookieSignature(key, purpose, value), nil
+}
+
+// VerifyCookie checks the signature of a cookie signed for purpose and returns its value
+func VerifyCookie(purpose, signed string) (string, error) {
+	key, err := getSessionKey()
+	if err != nil {
+		return "", err
+	}
+	value, signature, ok := strings.Cut(signed, ".")
+	if !ok || value == "" {
+		return "", ErrInvalidSessionCookie
+	}
+	if !hmac.Equal([]byte(signature), []byte(cookieSignature(key, purpose, value))) {
+		return "", ErrInvalidSessionCookie
+	}
+	return value, nil
+}
+
+func cookieSignature(key []byte, purpose, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose + "\x00" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SessionDeviceBinding reports whether sessions are bound to the device they were created on,
+// set with SSO_DEVICE_BINDING=true
+func SessionDeviceBinding() bool {
+	return os.Getenv("SSO_DEVICE_BINDING") == "true"
+}
+
+// DeviceFingerprint hashes the request headers that identify a browser. It is stable across the
+// hosts a session is used on, but not across browsers.
+func DeviceFingerprint(userAgent, acceptLanguage string) string {
+	sum := sha256.Sum256([]byte(userAgent + "\n" + acceptLanguage))
+	return hex.EncodeToString(sum[:])
+}
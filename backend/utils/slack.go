@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// slackRequestTimeout bounds a single Slack HTTP request
+	slackRequestTimeout = 10 * time.Second
+	// slackMaxRequestAge rejects signed requests older than this to prevent replays
+	slackMaxRequestAge = 5 * time.Minute
+	// slackBotScopes are the bot scopes requested when installing the app
+	slackBotScopes = "commands,chat:write"
+)
+
+// slackHTTPClient is shared by all Slack API calls
+var slackHTTPClient = &http.Client{Timeout: slackRequestTimeout}
+
+// Slack app configuration - stored in memory after setup
+var (
+	slackClientID      string
+	slackClientSecret  string
+	slackSigningSecret string
+	slackRedirectURI   string
+	slackConfigured    bool
+	slackConfigMutex   sync.RWMutex
+)
+
+// SlackOAuthResponse is the response of oauth.v2.access
+type SlackOAuthResponse struct {
+	OK          bool   `json:"ok"`
+	Error       string `json:"error,omitempty"`
+	AccessToken string `json:"access_token"`
+	BotUserID   string `json:"bot_user_id"`
+	Team        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"team"`
+	AuthedUser struct {
+		ID string `json:"id"`
+	} `json:"authed_user"`
+}
+
+// SlackMessage is a message sent as a slash command or interaction response
+type SlackMessage struct {
+	ResponseType    string        `json:"response_type,omitempty"` // ephemeral or in_channel
+	Text            string        `json:"text"`
+	Blocks          []interface{} `json:"blocks,omitempty"`
+	ReplaceOriginal bool          `json:"replace_original,omitempty"`
+}
+
+// SetupSlack sets up the Slack app configuration in memory
+func SetupSlack(clientID, clientSecret, signingSecret, redirectURI string) {
+	slackConfigMutex.Lock()
+	defer slackConfigMutex.Unlock()
+
+	slackClientID = clientID
+	slackClientSecret = clientSecret
+	slackSigningSecret = signingSecret
+	slackRedirectURI = redirectURI
+	slackConfigured = clientID != "" && signingSecret != ""
+}
+
+// ClearSlack removes the Slack app configuration from memory
+func ClearSlack() {
+	SetupSlack("", "", "", "")
+}
+
+// IsSlackConfigured checks if the Slack app is configured
+func IsSlackConfigured() bool {
+	slackConfigMutex.RLock()
+	defer slackConfigMutex.RUnlock()
+	return slackConfigured
+}
+
+// GetSlackInstallURL returns the URL that installs the app in a workspace
+func GetSlackInstallURL(state string) (string, error) {
+	slackConfigMutex.RLock()
+	clientID, redirectURI := slackClientID, slackRedirectURI
+	slackConfigMutex.RUnlock()
+
+	if clientID == "" || redirectURI == "" {
+		return "", fmt.Errorf("slack app not configured")
+	}
+
+	params := url.Values{}
+	params.Add("client_id", clientID)
+	params.Add("scope", slackBotScopes)
+	params.Add("redirect_uri", redirectURI)
+	params.Add("state", state)
+
+	return "https://slack.com/oauth/v2/authorize?" + params.Encode(), nil
+}
+
+// ExchangeSlackCode exchanges an install code for a workspace bot token
+func ExchangeSlackCode(code string) (*SlackOAuthResponse, error) {
+	slackConfigMutex.RLock()
+	clientID, clientSecret, redirectURI := slackClientID, slackClientSecret, slackRedirectURI
+	slackConfigMutex.RUnlock()
+
+	if clientID == "" || clientSecret == "" {
+		return nil, fmt.Errorf("slack app not configured")
+	}
+
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	data.Set("client_secret", clientSecret)
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+
+	resp, err := slackHTTPClient.PostForm("https://slack.com/api/oauth.v2.access", data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var oauthResp SlackOAuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&oauthResp); err != nil {
+		return nil, fmt.Errorf("failed to decode Slack OAuth response: %w", err)
+	}
+	if !oauthResp.OK {
+		return nil, fmt.Errorf("slack OAuth error: %s", oauthResp.Error)
+	}
+
+	return &oauthResp, nil
+}
+
+// ValidateSlackSignature validates the X-Slack-Signature of a request
+func ValidateSlackSignature(timestamp string, body []byte, signature string) bool {
+	slackConfigMutex.RLock()
+	signingSecret := slackSigningSecret
+	slackConfigMutex.RUnlock()
+
+	if signingSecret == "" || timestamp == "" || !strings.HasPrefix(signature, "v0=") {
+		return false
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := time.Since(time.Unix(seconds, 0))
+	if age > slackMaxRequestAge || age < -slackMaxRequestAge {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// PostSlackResponse sends a delayed response to a slash command or interaction response_url
+func PostSlackResponse(responseURL string, message *SlackMessage) error {
+	if !strings.HasPrefix(responseURL, "https://hooks.slack.com/") {
+		return fmt.Errorf("invalid Slack response URL")
+	}
+
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	resp, err := slackHTTPClient.Post(responseURL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack response failed (HTTP %d)", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -1,8 +1,9 @@
 package utils
 
 import (
-	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -156,14 +157,25 @@ func SSHDisconnect() {
 	}
 }
 
-// RunSSHCommand executes commands via SSH
-func RunSSHCommand(command string) (string, error) {
-	log.Printf("[SSH DEBUG] RunSSHCommand called: %s", command)
-	
+// openSSHSession opens a new SSH session, reconnecting once if the connection is broken. While
+// the SSH circuit breaker is open it fails fast, and failures to reach the host count towards
+// opening it.
+func openSSHSession(ctx context.Context) (*ssh.Session, error) {
+	if err := sshBreakerAllow(); err != nil {
+		recordSSHRefusal(ctx)
+		return nil, err
+	}
+	session, err := connectSSHSession()
+	recordSSHResult(err)
+	return session, err
+}
+
+// connectSSHSession opens a new SSH session, reconnecting once if the connection is broken
+func connectSSHSession() (*ssh.Session, error) {
 	// Check SSH connection and reconnect if necessary
 	if err := SSHConnect(); err != nil {
 		log.Printf("[SSH DEBUG] RunSSHCommand: SSH connection failed: %v", err)
-		return "", err
+		return nil, err
 	}
 
 	// Open a new SSH session
@@ -174,28 +186,181 @@ func RunSSHCommand(command string) (string, error) {
 		SSHDisconnect()
 		if err := SSHConnect(); err != nil {
 			log.Printf("[SSH DEBUG] RunSSHCommand: Reconnection failed: %v", err)
-			return "", fmt.Errorf("SSH reconnection failed: %v", err)
+			return nil, fmt.Errorf("SSH reconnection failed: %v", err)
 		}
 		
 		// Try creating session again
 		session, err = sshClient.NewSession()
 		if err != nil {
 			log.Printf("[SSH DEBUG] RunSSHCommand: Second session opening error: %v", err)
-			return "", fmt.Errorf("SSH session could not be opened: %v", err)
+			return nil, fmt.Errorf("SSH session could not be opened: %v", err)
 		}
 	}
+	return session, nil
+}
+
+// tagSSHSession passes the correlation ID of ctx to the remote command as CITIZEN_REQUEST_ID and
+// returns it for the API logs. Hosts whose sshd doesn't accept the variable only lose the tag.
+func tagSSHSession(ctx context.Context, session *ssh.Session) string {
+	id := CorrelationIDFromContext(ctx)
+	if id == "" {
+		return ""
+	}
+	if err := session.Setenv(CorrelationIDEnv, id); err != nil {
+		DebugLog("SSH server rejected %s for request %s: %v", CorrelationIDEnv, id, err)
+	}
+	return id
+}
+
+// StreamSSHCommand executes a command via SSH, writing its stdout to w as it is produced.
+// The remote command is terminated when ctx is done or a write to w fails.
+func StreamSSHCommand(ctx context.Context, command string, w io.Writer) error {
+	logCommand := SanitizeCommandLine(command)
+	log.Printf("[SSH DEBUG] StreamSSHCommand called: %s", logCommand)
+
+	session, err := openSSHSession(ctx)
+	if err != nil {
+		return err
+	}
 	defer session.Close()
+	if requestID := tagSSHSession(ctx, session); requestID != "" {
+		log.Printf("[SSH DEBUG] StreamSSHCommand request_id=%s", requestID)
+	}
 
-	var stdout, stderr bytes.Buffer
-	session.Stdout = &stdout
-	session.Stderr = &stderr
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 
-	log.Printf("[SSH DEBUG] Executing SSH command: %s", command)
+	stderr := newBoundedOutput(maxSSHStderr, false)
+	session.Stdout = &cancelOnErrorWriter{w: w, cancel: cancel}
+	session.Stderr = stderr
+
+	if err := session.Start(command); err != nil {
+		log.Printf("[SSH DEBUG] SSH command could not be started: %v", err)
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		log.Printf("[SSH DEBUG] SSH stream ended (%v), terminating remote process: %s", context.Cause(ctx), logCommand)
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+		return context.Cause(ctx)
+	}
+
+	if err != nil {
+		if errStr := stderr.String(); errStr != "" {
+			return fmt.Errorf("%s: %v", errStr, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// cancelOnErrorWriter cancels a stream when the destination stops accepting output
+type cancelOnErrorWriter struct {
+	w      io.Writer
+	cancel context.CancelCauseFunc
+}
+
+func (c *cancelOnErrorWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		c.cancel(err)
+	}
+	return n, err
+}
+
+// RunSSHCommand executes commands via SSH
+func RunSSHCommand(command string) (string, error) {
+	return RunSSHCommandContext(context.Background(), command)
+}
+
+// RunSSHCommandContext executes commands via SSH, terminating the remote command when ctx is done
+func RunSSHCommandContext(ctx context.Context, command string) (string, error) {
+	return runSSHCommand(ctx, command, nil)
+}
+
+// RunSSHCommandInput executes a command via SSH with stdin read from input, like the import of a
+// service dump
+func RunSSHCommandInput(ctx context.Context, command string, input io.Reader) (string, error) {
+	return runSSHCommand(ctx, command, input)
+}
+
+func runSSHCommand(ctx context.Context, command string, input io.Reader) (string, error) {
+	logCommand := SanitizeCommandLine(command)
+	hideOutput := hidesCommandOutput(strings.Fields(command))
+	log.Printf("[SSH DEBUG] RunSSHCommand called: %s", logCommand)
+	
+	session, err := openSSHSession(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	if requestID := tagSSHSession(ctx, session); requestID != "" {
+		logCommand += " [request_id=" + requestID + "]"
+	}
+
+	// Output is bounded so a runaway command can't exhaust memory, the full output of commands
+	// whose output isn't hidden goes to disk past the limit
+	stdout := newBoundedOutput(SSHMaxOutputBytes(), !hideOutput)
+	defer stdout.Close()
+	stderr := newBoundedOutput(maxSSHStderr, false)
+	session.Stdin = input
+	session.Stdout = stdout
+	session.Stderr = stderr
+	// Commands of a running deployment are followed live, except those printing env values
+	if !hideOutput {
+		var flushOutput func()
+		session.Stdout, session.Stderr, flushOutput = teeDeployOutput(ctx, stdout, stderr)
+		defer flushOutput()
+	}
+
+	log.Printf("[SSH DEBUG] Executing SSH command: %s", logCommand)
 	// Execute the command
-	err = session.Run(command)
+	if err := session.Start(command); err != nil {
+		log.Printf("[SSH DEBUG] SSH command could not be started: %v", err)
+		return "", err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Kill the remote process and close the channel so it can't keep running
+		log.Printf("[SSH DEBUG] SSH command cancelled (%v), terminating remote process: %s", ctx.Err(), logCommand)
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+
+		select {
+		case <-done:
+			return stdout.String(), fmt.Errorf("command cancelled: %w", ctx.Err())
+		case <-time.After(5 * time.Second):
+			return "", fmt.Errorf("command cancelled: %w", ctx.Err())
+		}
+	}
+
 	if err != nil {
 		errStr := stderr.String()
-		log.Printf("[SSH DEBUG] SSH command error - stdout: %s, stderr: %s, err: %v", stdout.String(), errStr, err)
+		if hideOutput {
+			log.Printf("[SSH DEBUG] SSH command error - stderr: %s, err: %v", errStr, err)
+		} else {
+			log.Printf("[SSH DEBUG] SSH command error - stdout: %s, stderr: %s, err: %v", stdout.String(), errStr, err)
+		}
 		if errStr != "" {
 			return "", fmt.Errorf("%s: %v", errStr, err)
 		}
@@ -203,6 +368,14 @@ func RunSSHCommand(command string) (string, error) {
 	}
 
 	result := stdout.String()
-	log.Printf("[SSH DEBUG] SSH command successful - output: %s", result)
+	if truncation := stdout.Truncation(); truncation != nil {
+		log.Printf("[SSH DEBUG] SSH command output truncated, %d of %d bytes omitted (full output: %q): %s",
+			truncation.OmittedBytes, truncation.TotalBytes, truncation.FullOutputPath, logCommand)
+	}
+	if hideOutput {
+		log.Printf("[SSH DEBUG] SSH command successful - output hidden (%d bytes)", len(result))
+	} else {
+		log.Printf("[SSH DEBUG] SSH command successful - output: %s", result)
+	}
 	return result, nil
 } 
@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSH circuit breaker states
+const (
+	SSHBreakerClosed  = "closed"    // commands run
+	SSHBreakerOpen    = "open"      // commands are refused until a probe reaches the host
+	SSHBreakerProbing = "half_open" // a probe is connecting to the host, commands are still refused
+)
+
+const (
+	defaultSSHBreakerThreshold     = 5
+	defaultSSHBreakerProbeInterval = 30 * time.Second
+)
+
+// SSHUnavailableError is returned instead of running a command while the SSH circuit breaker is
+// open, so requests fail fast rather than waiting for the dokku host to time out
+type SSHUnavailableError struct {
+	RetryAfter time.Duration
+	LastError  string
+}
+
+func (e *SSHUnavailableError) Error() string {
+	return fmt.Sprintf("the dokku host is unreachable (%s), SSH commands are refused until it recovers", e.LastError)
+}
+
+// SSHBreakerStatus is the state of the SSH circuit breaker as reported by the health endpoint
+type SSHBreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Threshold           int        `json:"threshold"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	NextProbeAt         *time.Time `json:"next_probe_at,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	Rejected            int64      `json:"rejected"`
+}
+
+var sshBreaker = struct {
+	sync.Mutex
+	failures  int
+	open      bool
+	probing   bool
+	openedAt  time.Time
+	nextProbe time.Time
+	lastError string
+	// rejected counts the refused commands since startup, for the health endpoint
+	rejected int64
+}{}
+
+// sshRefusals records, per correlation ID of a request being watched, whether the breaker refused
+// one of its commands
+var sshRefusals = struct {
+	sync.Mutex
+	requests map[string]bool
+}{requests: make(map[string]bool)}
+
+// sshBreakerThreshold is how many consecutive connection failures open the breaker, from
+// SSH_BREAKER_THRESHOLD
+func sshBreakerThreshold() int {
+	if value := os.Getenv("SSH_BREAKER_THRESHOLD"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			return parsed
+		}
+		WarnLog("Invalid SSH_BREAKER_THRESHOLD %q, using %d", value, defaultSSHBreakerThreshold)
+	}
+	return defaultSSHBreakerThreshold
+}
+
+// sshBreakerProbeInterval is how long the open breaker waits between probes of the host, from
+// SSH_BREAKER_PROBE_INTERVAL
+func sshBreakerProbeInterval() time.Duration {
+	if value := os.Getenv("SSH_BREAKER_PROBE_INTERVAL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			return parsed
+		}
+		WarnLog("Invalid SSH_BREAKER_PROBE_INTERVAL %q, using %s", value, defaultSSHBreakerProbeInterval)
+	}
+	return defaultSSHBreakerProbeInterval
+}
+
+// sshBreakerAllow refuses a command with an SSHUnavailableError while the breaker is open
+func sshBreakerAllow() error {
+	sshBreaker.Lock()
+	defer sshBreaker.Unlock()
+	if !sshBreaker.open {
+		return nil
+	}
+
+	sshBreaker.rejected++
+	retryAfter := time.Until(sshBreaker.nextProbe).Round(time.Second)
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	return &SSHUnavailableError{RetryAfter: retryAfter, LastError: sshBreaker.lastError}
+}
+
+// recordSSHResult counts a failure to reach the host, opening the breaker at the threshold, or
+// resets the count when the host was reached
+func recordSSHResult(err error) {
+	sshBreaker.Lock()
+	defer sshBreaker.Unlock()
+	if err == nil {
+		sshBreaker.failures = 0
+		return
+	}
+
+	sshBreaker.failures++
+	sshBreaker.lastError = err.Error()
+	if sshBreaker.open || sshBreaker.failures < sshBreakerThreshold() {
+		return
+	}
+	sshBreaker.open = true
+	sshBreaker.openedAt = time.Now()
+	sshBreaker.nextProbe = sshBreaker.openedAt.Add(sshBreakerProbeInterval())
+	WarnLog("SSH circuit breaker opened after %d consecutive failures: %v", sshBreaker.failures, err)
+	go probeSSHUntilRecovered()
+}
+
+// probeSSHUntilRecovered connects to the host at every probe interval while the breaker is open,
+// and closes it once a session can be opened
+func probeSSHUntilRecovered() {
+	for {
+		sshBreaker.Lock()
+		wait := time.Until(sshBreaker.nextProbe)
+		sshBreaker.Unlock()
+		time.Sleep(wait)
+
+		sshBreaker.Lock()
+		sshBreaker.probing = true
+		sshBreaker.Unlock()
+
+		err := SSHConnect()
+		if err == nil && !testSSHConnection() {
+			err = fmt.Errorf("SSH session could not be opened")
+		}
+
+		sshBreaker.Lock()
+		sshBreaker.probing = false
+		if err == nil {
+			InfoLog("SSH circuit breaker closed, the dokku host is reachable again after %s",
+				time.Since(sshBreaker.openedAt).Round(time.Second))
+			sshBreaker.open = false
+			sshBreaker.failures = 0
+			sshBreaker.lastError = ""
+			sshBreaker.Unlock()
+			return
+		}
+		sshBreaker.lastError = err.Error()
+		sshBreaker.nextProbe = time.Now().Add(sshBreakerProbeInterval())
+		sshBreaker.Unlock()
+		SSHDebugLog("SSH circuit breaker probe failed: %v", err)
+	}
+}
+
+// WatchSSHRefusals records whether the breaker refuses a command of the request with a
+// correlation ID until the returned function is called, which reports it. Commands belong to a
+// request by their context or, run without one, by the app they target.
+func WatchSSHRefusals(correlationID string) func() bool {
+	if correlationID == "" {
+		return func() bool { return false }
+	}
+	sshRefusals.Lock()
+	sshRefusals.requests[correlationID] = false
+	sshRefusals.Unlock()
+
+	return func() bool {
+		sshRefusals.Lock()
+		defer sshRefusals.Unlock()
+		refused := sshRefusals.requests[correlationID]
+		delete(sshRefusals.requests, correlationID)
+		return refused
+	}
+}
+
+// recordSSHRefusal marks the watched requests a refused command belongs to, the IDs of its
+// context being comma separated when requests on the same app overlap
+func recordSSHRefusal(ctx context.Context) {
+	ids := CorrelationIDFromContext(ctx)
+	if ids == "" {
+		return
+	}
+	sshRefusals.Lock()
+	defer sshRefusals.Unlock()
+	for _, id := range strings.Split(ids, ",") {
+		if _, watched := sshRefusals.requests[id]; watched {
+			sshRefusals.requests[id] = true
+		}
+	}
+}
+
+// GetSSHBreakerStatus returns the current state of the SSH circuit breaker
+func GetSSHBreakerStatus() SSHBreakerStatus {
+	sshBreaker.Lock()
+	defer sshBreaker.Unlock()
+
+	status := SSHBreakerStatus{
+		State:               SSHBreakerClosed,
+		ConsecutiveFailures: sshBreaker.failures,
+		Threshold:           sshBreakerThreshold(),
+		LastError:           sshBreaker.lastError,
+		Rejected:            sshBreaker.rejected,
+	}
+	if sshBreaker.open {
+		status.State = SSHBreakerOpen
+		if sshBreaker.probing {
+			status.State = SSHBreakerProbing
+		}
+		openedAt, nextProbe := sshBreaker.openedAt, sshBreaker.nextProbe
+		status.OpenedAt = &openedAt
+		status.NextProbeAt = &nextProbe
+	}
+	return status
+}
@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// defaultSSHMaxOutput is the output kept in memory for a command when SSH_MAX_OUTPUT_BYTES is unset
+	defaultSSHMaxOutput = 8 << 20
+	// minSSHMaxOutput keeps the limit large enough for the reports and listings Citizen parses
+	minSSHMaxOutput = 64 << 10
+	// maxSSHStderr caps the stderr kept for error messages
+	maxSSHStderr = 64 << 10
+	// spilledOutputAge is how long the full output of truncated commands is kept on disk
+	spilledOutputAge = 24 * time.Hour
+)
+
+// OutputTruncation describes a command output cut to the output limit: its head and tail are
+// kept around a marker, the full output is on disk when it could be spilled
+type OutputTruncation struct {
+	TotalBytes     int64  `json:"total_bytes"`
+	OmittedBytes   int64  `json:"omitted_bytes"`
+	FullOutputPath string `json:"full_output_path,omitempty"`
+}
+
+// outputTruncationPattern matches the marker left in place of the omitted part of an output
+var outputTruncationPattern = regexp.MustCompile(`\.\.\. \[citizen: output truncated, (\d+) of (\d+) bytes omitted(?:, full output at ([^\]]+))?\] \.\.\.`)
+
+// marker returns the line that replaces the omitted part of an output
+func (t *OutputTruncation) marker() string {
+	marker := fmt.Sprintf("... [citizen: output truncated, %d of %d bytes omitted", t.OmittedBytes, t.TotalBytes)
+	if t.FullOutputPath != "" {
+		marker += ", full output at " + t.FullOutputPath
+	}
+	return marker + "] ..."
+}
+
+// ParseOutputTruncation returns the truncation of an output, nil when it is complete
+func ParseOutputTruncation(output string) *OutputTruncation {
+	match := outputTruncationPattern.FindStringSubmatch(output)
+	if match == nil {
+		return nil
+	}
+	omitted, _ := strconv.ParseInt(match[1], 10, 64)
+	total, _ := strconv.ParseInt(match[2], 10, 64)
+	return &OutputTruncation{TotalBytes: total, OmittedBytes: omitted, FullOutputPath: match[3]}
+}
+
+// SSHMaxOutputBytes returns how much of the output of a command is kept in memory, from
+// SSH_MAX_OUTPUT_BYTES. Larger outputs keep their first and last halves.
+func SSHMaxOutputBytes() int {
+	limit := defaultSSHMaxOutput
+	if value := os.Getenv("SSH_MAX_OUTPUT_BYTES"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+	return max(limit, minSSHMaxOutput)
+}
+
+// spilledOutputDir returns the directory the full output of truncated commands is written to,
+// from SSH_OUTPUT_SPILL_DIR, "" when spilling is turned off with "none"
+func spilledOutputDir() string {
+	dir := os.Getenv("SSH_OUTPUT_SPILL_DIR")
+	switch dir {
+	case "":
+		return filepath.Join(os.TempDir(), "citizen-output")
+	case "none":
+		return ""
+	}
+	return dir
+}
+
+// boundedOutput collects the output of a command up to a limit. Past it, only the first and last
+// halves are kept in memory and, when spilling, everything is written to a file instead.
+type boundedOutput struct {
+	limit int
+	spill bool
+	total int64
+	buf   []byte // the whole output until the limit is reached, then its head
+	tail  []byte // the end of the output once truncated, trimmed to limit/2 on read
+	file  *os.File
+	path  string
+}
+
+func newBoundedOutput(limit int, spill bool) *boundedOutput {
+	return &boundedOutput{limit: limit, spill: spill}
+}
+
+func (o *boundedOutput) Write(p []byte) (int, error) {
+	o.total += int64(len(p))
+	if o.tail == nil && len(o.buf)+len(p) <= o.limit {
+		o.buf = append(o.buf, p...)
+		return len(p), nil
+	}
+
+	if o.tail == nil {
+		// First write past the limit: spill what was kept, then keep only the head
+		o.startSpill()
+		o.writeSpill(o.buf)
+		all := append(o.buf, p...)
+		head := o.limit / 2
+		o.buf = all[:head:head]
+		o.tail = append([]byte(nil), all[head:]...)
+	} else {
+		o.tail = append(o.tail, p...)
+	}
+	o.writeSpill(p)
+
+	// Trim the tail in batches so small writes don't copy it every time
+	if keep := o.limit / 2; len(o.tail) > 2*keep {
+		o.tail = append(o.tail[:0:0], o.tail[len(o.tail)-keep:]...)
+	}
+	return len(p), nil
+}
+
+// startSpill opens the file the full output goes to, output is only truncated when it can't
+func (o *boundedOutput) startSpill() {
+	dir := spilledOutputDir()
+	if !o.spill || dir == "" {
+		return
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		log.Printf("[SSH DEBUG] Failed to create the output spill directory %s: %v", dir, err)
+		return
+	}
+	removeSpilledOutputs(dir)
+	file, err := os.CreateTemp(dir, "output-*.log")
+	if err != nil {
+		log.Printf("[SSH DEBUG] Failed to spill command output to disk: %v", err)
+		return
+	}
+	o.file, o.path = file, file.Name()
+}
+
+func (o *boundedOutput) writeSpill(p []byte) {
+	if o.file == nil {
+		return
+	}
+	if _, err := o.file.Write(p); err != nil {
+		log.Printf("[SSH DEBUG] Failed to write spilled output %s: %v", o.path, err)
+		o.file.Close()
+		os.Remove(o.path)
+		o.file, o.path = nil, ""
+	}
+}
+
+// Close closes the spill file, the output stays readable from it
+func (o *boundedOutput) Close() error {
+	if o.file == nil {
+		return nil
+	}
+	return o.file.Close()
+}
+
+// Truncation describes how the output was cut, nil when it fit in the limit
+func (o *boundedOutput) Truncation() *OutputTruncation {
+	if o.tail == nil {
+		return nil
+	}
+	head, tail := o.parts()
+	return &OutputTruncation{
+		TotalBytes:     o.total,
+		OmittedBytes:   o.total - int64(len(head)+len(tail)),
+		FullOutputPath: o.path,
+	}
+}
+
+// parts returns the head and tail kept of a truncated output, cut on UTF-8 boundaries
+func (o *boundedOutput) parts() ([]byte, []byte) {
+	head := o.buf
+	for i := 0; i < utf8.UTFMax && len(head) > 0; i++ {
+		if r, size := utf8.DecodeLastRune(head); r != utf8.RuneError || size > 1 {
+			break
+		}
+		head = head[:len(head)-1]
+	}
+	tail := o.tail
+	if keep := o.limit / 2; len(tail) > keep {
+		tail = tail[len(tail)-keep:]
+	}
+	for i := 0; i < utf8.UTFMax && len(tail) > 0 && !utf8.RuneStart(tail[0]); i++ {
+		tail = tail[1:]
+	}
+	return head, tail
+}
+
+// String returns the output, with the truncation marker between its head and tail when cut
+func (o *boundedOutput) String() string {
+	truncation := o.Truncation()
+	if truncation == nil {
+		return string(o.buf)
+	}
+	head, tail := o.parts()
+	return string(head) + "\n\n" + truncation.marker() + "\n\n" + string(tail)
+}
+
+// removeSpilledOutputs deletes the spilled outputs older than spilledOutputAge
+func removeSpilledOutputs(dir string) {
+	files, err := filepath.Glob(filepath.Join(dir, "output-*.log"))
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) > spilledOutputAge {
+			os.Remove(file)
+		}
+	}
+}
+
+// responseTruncations returns the truncation of the string fields of a response data map, keyed
+// by field, so clients know an output they show is partial
+func responseTruncations(data interface{}) map[string]*OutputTruncation {
+	value := reflect.ValueOf(data)
+	if value.Kind() != reflect.Map || value.Type().Key().Kind() != reflect.String {
+		return nil
+	}
+	var truncations map[string]*OutputTruncation
+	iter := value.MapRange()
+	for iter.Next() {
+		field := iter.Value()
+		if field.Kind() == reflect.Interface {
+			field = field.Elem()
+		}
+		if field.Kind() != reflect.String {
+			continue
+		}
+		if truncation := ParseOutputTruncation(field.String()); truncation != nil {
+			if truncations == nil {
+				truncations = make(map[string]*OutputTruncation)
+			}
+			truncations[iter.Key().String()] = truncation
+		}
+	}
+	return truncations
+}
@@ -1,12 +1,19 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
 )
 
 func ReloadTraefik() error {
+	return ReloadTraefikContext(context.Background())
+}
+
+// ReloadTraefikContext signals the watcher to reload Traefik, writing the correlation ID of ctx
+// next to the timestamp so the watcher log names the request behind the reload
+func ReloadTraefikContext(ctx context.Context) error {
 	// Create a signal file that dokku-traefik-watcher will detect
 	signalPath := "/tmp/traefik-reload-signal"
 	
@@ -17,8 +24,12 @@ func ReloadTraefik() error {
 	}
 	defer file.Close()
 	
-	// Write timestamp to the file
-	_, err = file.WriteString(time.Now().Format(time.RFC3339))
+	// Write timestamp and request ID to the file
+	content := time.Now().Format(time.RFC3339)
+	if id := CorrelationIDFromContext(ctx); id != "" {
+		content += " request_id=" + id
+	}
+	_, err = file.WriteString(content)
 	if err != nil {
 		return fmt.Errorf("failed to write to signal file: %v", err)
 	}
@@ -0,0 +1,363 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database/api"
+)
+
+// TrafficLatencyBuckets are the upper bounds, in ms, of the latency histogram kept per hour.
+// The histogram has one more entry counting requests slower than the last bound.
+var TrafficLatencyBuckets = []int64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+const (
+	// maxAccessLogLine bounds a single access log line
+	maxAccessLogLine = 64 * 1024
+	// maxAccessLogRead bounds how much of the shared access log is read per ingestion run
+	maxAccessLogRead = 32 * 1024 * 1024
+)
+
+// AccessLogEntry is one request read from the Traefik access log
+type AccessLogEntry struct {
+	AppName  string
+	Status   int
+	Duration time.Duration
+	Time     time.Time
+}
+
+// traefikAccessLog holds the fields used from a Traefik JSON access log line
+type traefikAccessLog struct {
+	RouterName       string    `json:"RouterName"`
+	DownstreamStatus int       `json:"DownstreamStatus"`
+	Duration         int64     `json:"Duration"` // nanoseconds
+	StartUTC         time.Time `json:"StartUTC"`
+}
+
+// ParseAccessLogLine parses a Traefik JSON access log line. ok is false for lines that are not
+// requests served by an app router (redirects, the Citizen UI, unknown hosts).
+func ParseAccessLogLine(line []byte) (entry *AccessLogEntry, ok bool) {
+	var record traefikAccessLog
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, false
+	}
+
+	appName := appFromRouter(record.RouterName)
+	if appName == "" || record.DownstreamStatus == 0 {
+		return nil, false
+	}
+
+	timestamp := record.StartUTC
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	return &AccessLogEntry{
+		AppName:  appName,
+		Status:   record.DownstreamStatus,
+		Duration: time.Duration(record.Duration),
+		Time:     timestamp,
+	}, true
+}
+
+// appFromRouter returns the app served by a router generated by the Traefik watcher
+// ("<app>-router-https@file" or "<app>-router@file" in development)
+func appFromRouter(router string) string {
+	if idx := strings.IndexByte(router, '@'); idx >= 0 {
+		router = router[:idx]
+	}
+	for _, suffix := range []string{"-router-https", "-router"} {
+		if strings.HasSuffix(router, suffix) {
+			return strings.TrimSuffix(router, suffix)
+		}
+	}
+	return ""
+}
+
+// TrafficCollector aggregates access log entries into hourly rollups until they are flushed
+type TrafficCollector struct {
+	mu      sync.Mutex
+	rollups map[trafficKey]*api.TrafficRollup
+}
+
+type trafficKey struct {
+	app  string
+	hour time.Time
+}
+
+// Traffic is the collector fed by access log ingestion
+var Traffic = &TrafficCollector{rollups: make(map[trafficKey]*api.TrafficRollup)}
+
+// Record adds a request to the rollup of its app and hour
+func (t *TrafficCollector) Record(entry *AccessLogEntry) {
+	hour := entry.Time.UTC().Truncate(time.Hour)
+	latencyMs := entry.Duration.Milliseconds()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := trafficKey{entry.AppName, hour}
+	rollup, exists := t.rollups[key]
+	if !exists {
+		rollup = &api.TrafficRollup{
+			AppName:        entry.AppName,
+			HourStart:      hour,
+			LatencyBuckets: make([]int64, len(TrafficLatencyBuckets)+1),
+		}
+		t.rollups[key] = rollup
+	}
+
+	rollup.Requests++
+	switch entry.Status / 100 {
+	case 2:
+		rollup.Status2xx++
+	case 3:
+		rollup.Status3xx++
+	case 4:
+		rollup.Status4xx++
+	case 5:
+		rollup.Status5xx++
+	}
+	rollup.LatencySumMs += latencyMs
+	rollup.LatencyBuckets[latencyBucket(latencyMs)]++
+}
+
+// latencyBucket returns the histogram index of a latency
+func latencyBucket(latencyMs int64) int {
+	for i, bound := range TrafficLatencyBuckets {
+		if latencyMs <= bound {
+			return i
+		}
+	}
+	return len(TrafficLatencyBuckets)
+}
+
+// Flush stores the pending rollups. Rollups that fail to store are kept for the next flush.
+func (t *TrafficCollector) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	pending := t.rollups
+	t.rollups = make(map[trafficKey]*api.TrafficRollup)
+	t.mu.Unlock()
+
+	var failed int
+	var lastErr error
+	for key, rollup := range pending {
+		if err := api.Traffic.AddTrafficRollup(ctx, rollup); err != nil {
+			failed, lastErr = failed+1, err
+			t.restore(key, rollup)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to store %d traffic rollups: %w", failed, lastErr)
+	}
+	return nil
+}
+
+// restore merges a rollup that could not be stored back into the pending ones
+func (t *TrafficCollector) restore(key trafficKey, rollup *api.TrafficRollup) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current, exists := t.rollups[key]
+	if !exists {
+		t.rollups[key] = rollup
+		return
+	}
+	current.Requests += rollup.Requests
+	current.Status2xx += rollup.Status2xx
+	current.Status3xx += rollup.Status3xx
+	current.Status4xx += rollup.Status4xx
+	current.Status5xx += rollup.Status5xx
+	current.LatencySumMs += rollup.LatencySumMs
+	for i := range current.LatencyBuckets {
+		current.LatencyBuckets[i] += rollup.LatencyBuckets[i]
+	}
+}
+
+// IngestAccessLog records every app request of a newline-delimited Traefik JSON access log
+func IngestAccessLog(r io.Reader) (accepted, skipped int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxAccessLogLine)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if entry, ok := ParseAccessLogLine(line); ok {
+			Traffic.Record(entry)
+			accepted++
+		} else {
+			skipped++
+		}
+	}
+	return accepted, skipped, scanner.Err()
+}
+
+// accessLogFollower reads the lines appended to an access log file since the previous read
+type accessLogFollower struct {
+	path   string
+	offset int64
+	primed bool
+}
+
+// sharedAccessLog follows the file named by TRAEFIK_ACCESS_LOG
+var sharedAccessLog = &accessLogFollower{}
+
+// IngestAccessLogFile records the requests appended to the shared Traefik access log since the
+// previous call. It does nothing when TRAEFIK_ACCESS_LOG is not set.
+func IngestAccessLogFile() (int, error) {
+	path := os.Getenv("TRAEFIK_ACCESS_LOG")
+	if path == "" {
+		return 0, nil
+	}
+	if path != sharedAccessLog.path {
+		*sharedAccessLog = accessLogFollower{path: path}
+	}
+	return sharedAccessLog.ingest()
+}
+
+// ingest records the complete lines appended since the previous call. The first call starts at
+// the end of the file so a restart doesn't count old requests twice; a truncated or rotated file
+// is read from the start.
+func (f *accessLogFollower) ingest() (int, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if !f.primed {
+		f.offset, f.primed = info.Size(), true
+		return 0, nil
+	}
+	if info.Size() < f.offset {
+		f.offset = 0
+	}
+	if info.Size() == f.offset {
+		return 0, nil
+	}
+
+	if _, err := file.Seek(f.offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(io.LimitReader(file, min(info.Size()-f.offset, maxAccessLogRead)))
+	if err != nil {
+		return 0, err
+	}
+
+	// Leave a partially written last line for the next read
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	f.offset += int64(complete)
+
+	accepted, _, err := IngestAccessLog(bytes.NewReader(data[:complete]))
+	return accepted, err
+}
+
+// TrafficBucket is the traffic of an app during an hour or a day
+type TrafficBucket struct {
+	Start        time.Time        `json:"start"`
+	Requests     int64            `json:"requests"`
+	Status       map[string]int64 `json:"status"`
+	AvgLatencyMs int64            `json:"avg_latency_ms"`
+	P95LatencyMs int64            `json:"p95_latency_ms"` // upper bound of the histogram bucket holding the p95
+	latencySum   int64
+	latencies    []int64
+}
+
+// SummarizeTraffic groups hourly rollups into "hour" or "day" buckets (UTC) and computes the totals
+func SummarizeTraffic(rollups []api.TrafficRollup, granularity string) ([]TrafficBucket, TrafficBucket) {
+	buckets := []TrafficBucket{}
+	total := newTrafficBucket(time.Time{})
+
+	for _, rollup := range rollups {
+		start := rollup.HourStart.UTC()
+		if granularity == "day" {
+			start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+		}
+		if len(buckets) == 0 || !buckets[len(buckets)-1].Start.Equal(start) {
+			buckets = append(buckets, newTrafficBucket(start))
+		}
+		buckets[len(buckets)-1].add(rollup)
+		total.add(rollup)
+	}
+
+	for i := range buckets {
+		buckets[i].finish()
+	}
+	total.finish()
+	if len(rollups) > 0 {
+		total.Start = rollups[0].HourStart.UTC()
+	}
+	return buckets, total
+}
+
+func newTrafficBucket(start time.Time) TrafficBucket {
+	return TrafficBucket{
+		Start:     start,
+		Status:    map[string]int64{"2xx": 0, "3xx": 0, "4xx": 0, "5xx": 0},
+		latencies: make([]int64, len(TrafficLatencyBuckets)+1),
+	}
+}
+
+func (b *TrafficBucket) add(rollup api.TrafficRollup) {
+	b.Requests += rollup.Requests
+	b.Status["2xx"] += rollup.Status2xx
+	b.Status["3xx"] += rollup.Status3xx
+	b.Status["4xx"] += rollup.Status4xx
+	b.Status["5xx"] += rollup.Status5xx
+	b.latencySum += rollup.LatencySumMs
+	for i := 0; i < len(b.latencies) && i < len(rollup.LatencyBuckets); i++ {
+		b.latencies[i] += rollup.LatencyBuckets[i]
+	}
+}
+
+func (b *TrafficBucket) finish() {
+	if b.Requests == 0 {
+		return
+	}
+	b.AvgLatencyMs = b.latencySum / b.Requests
+	b.P95LatencyMs = latencyPercentile(b.latencies, 0.95)
+}
+
+// latencyPercentile returns the upper bound of the histogram bucket holding the p-th request.
+// Requests slower than the last bound are reported at the last bound.
+func latencyPercentile(histogram []int64, p float64) int64 {
+	var total int64
+	for _, count := range histogram {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := int64(float64(total)*p + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, count := range histogram {
+		seen += count
+		if seen >= rank {
+			if i < len(TrafficLatencyBuckets) {
+				return TrafficLatencyBuckets[i]
+			}
+			break
+		}
+	}
+	return TrafficLatencyBuckets[len(TrafficLatencyBuckets)-1]
+}
@@ -0,0 +1,393 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ErrWebAuthnVerification is wrapped by every failed WebAuthn ceremony check
+var ErrWebAuthnVerification = errors.New("passkey verification failed")
+
+// COSE algorithms accepted for passkeys, in order of preference
+const (
+	COSEAlgES256 = -7
+	COSEAlgEdDSA = -8
+	COSEAlgRS256 = -257
+)
+
+// WebAuthnAlgorithms lists the algorithms offered to authenticators at registration
+var WebAuthnAlgorithms = []int{COSEAlgES256, COSEAlgEdDSA, COSEAlgRS256}
+
+// Flags of the authenticator data
+const (
+	authDataUserPresent    = 0x01
+	authDataUserVerified   = 0x04
+	authDataBackupEligible = 0x08
+	authDataAttested       = 0x40
+)
+
+// WebAuthnRelyingParty is the Citizen dashboard as a WebAuthn relying party. Passkeys are bound to
+// its ID, a domain the dashboard is served from or under.
+type WebAuthnRelyingParty struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Origins []string `json:"origins,omitempty"`
+}
+
+// GetWebAuthnRelyingParty reads the relying party from WEBAUTHN_RP_ID (the login host by default),
+// WEBAUTHN_RP_NAME and WEBAUTHN_ORIGINS, a comma separated list of exact origins allowed on top of
+// the https origins of the relying party ID and its subdomains
+func GetWebAuthnRelyingParty() WebAuthnRelyingParty {
+	rp := WebAuthnRelyingParty{
+		ID:   os.Getenv("WEBAUTHN_RP_ID"),
+		Name: os.Getenv("WEBAUTHN_RP_NAME"),
+	}
+	if rp.ID == "" {
+		rp.ID = os.Getenv("LOGIN_HOST")
+	}
+	if host, _, err := net.SplitHostPort(rp.ID); err == nil {
+		rp.ID = host
+	}
+	if rp.ID == "" {
+		rp.ID = "localhost"
+	}
+	rp.ID = strings.ToLower(rp.ID)
+	if rp.Name == "" {
+		rp.Name = "Citizen"
+	}
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			rp.Origins = append(rp.Origins, origin)
+		}
+	}
+	return rp
+}
+
+// AllowsOrigin checks the origin a ceremony ran on: a configured origin, or an https origin on
+// the relying party ID or one of its subdomains. Browsers allow http on localhost only.
+func (rp WebAuthnRelyingParty) AllowsOrigin(origin string) bool {
+	for _, allowed := range rp.Origins {
+		if origin == allowed {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Path != "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host != rp.ID && !strings.HasSuffix(host, "."+rp.ID) {
+		return false
+	}
+	return u.Scheme == "https" || (u.Scheme == "http" && rp.ID == "localhost")
+}
+
+// NewWebAuthnChallenge returns a random challenge for a ceremony
+func NewWebAuthnChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// EncodeWebAuthnBytes encodes binary WebAuthn values the way browsers serialize them
+func EncodeWebAuthnBytes(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeWebAuthnBytes decodes base64url values, padded or not
+func DecodeWebAuthnBytes(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// WebAuthnCredential is the PublicKeyCredential a browser returns from navigator.credentials,
+// serialized with its binary fields in base64url as PublicKeyCredential.toJSON() does
+type WebAuthnCredential struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject,omitempty"`
+		Transports        []string `json:"transports,omitempty"`
+		AuthenticatorData string   `json:"authenticatorData,omitempty"`
+		Signature         string   `json:"signature,omitempty"`
+		UserHandle        string   `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// WebAuthnRegistration is a passkey verified at registration
+type WebAuthnRegistration struct {
+	CredentialID   []byte
+	PublicKey      []byte // COSE_Key as sent by the authenticator
+	Algorithm      int
+	SignCount      uint32
+	AAGUID         []byte
+	BackupEligible bool
+}
+
+// webauthnClientData is the part of the client data JSON the ceremonies check
+type webauthnClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// webauthnAuthData is the parsed authenticator data
+type webauthnAuthData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func webauthnFailure(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrWebAuthnVerification, fmt.Sprintf(format, args...))
+}
+
+// verifyClientData checks the client data of a ceremony of the given type against the challenge
+// issued for it, and returns its hash, signed by authenticators along with the authenticator data
+func (rp WebAuthnRelyingParty) verifyClientData(encoded, ceremony string, challenge []byte) ([]byte, error) {
+	raw, err := DecodeWebAuthnBytes(encoded)
+	if err != nil {
+		return nil, webauthnFailure("invalid client data encoding")
+	}
+	var clientData webauthnClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return nil, webauthnFailure("invalid client data")
+	}
+	if clientData.Type != ceremony {
+		return nil, webauthnFailure("client data is for %q, not %q", clientData.Type, ceremony)
+	}
+	received, err := DecodeWebAuthnBytes(clientData.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return nil, webauthnFailure("challenge mismatch")
+	}
+	if clientData.CrossOrigin || !rp.AllowsOrigin(clientData.Origin) {
+		return nil, webauthnFailure("origin %q is not allowed", clientData.Origin)
+	}
+	sum := sha256.Sum256(raw)
+	return sum[:], nil
+}
+
+// parseAuthData parses authenticator data and checks it was produced for the relying party with
+// the user present and verified
+func (rp WebAuthnRelyingParty) parseAuthData(data []byte) (*webauthnAuthData, error) {
+	if len(data) < 37 {
+		return nil, webauthnFailure("authenticator data is too short")
+	}
+	authData := &webauthnAuthData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return nil, webauthnFailure("passkey belongs to another relying party than %s", rp.ID)
+	}
+	if authData.Flags&authDataUserPresent == 0 {
+		return nil, webauthnFailure("user presence was not confirmed")
+	}
+	if authData.Flags&authDataUserVerified == 0 {
+		return nil, webauthnFailure("user verification was not performed")
+	}
+
+	if authData.Flags&authDataAttested != 0 {
+		rest := data[37:]
+		if len(rest) < 18 {
+			return nil, webauthnFailure("attested credential data is truncated")
+		}
+		authData.AAGUID = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return nil, webauthnFailure("invalid credential ID")
+		}
+		authData.CredentialID, rest = rest[:idLength], rest[idLength:]
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, webauthnFailure("invalid credential public key: %v", err)
+		}
+		authData.PublicKey = rest[:len(rest)-len(after)]
+	}
+	return authData, nil
+}
+
+// VerifyWebAuthnRegistration verifies a registration ceremony answered for challenge and returns
+// the passkey to store. Attestation is requested as "none": the authenticator model isn't
+// checked, only that the new key was created for this relying party by a verified user.
+func (rp WebAuthnRelyingParty) VerifyWebAuthnRegistration(credential *WebAuthnCredential, challenge []byte) (*WebAuthnRegistration, error) {
+	if credential.Type != "public-key" {
+		return nil, webauthnFailure("unsupported credential type %q", credential.Type)
+	}
+	if _, err := rp.verifyClientData(credential.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	rawAttestation, err := DecodeWebAuthnBytes(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, webauthnFailure("invalid attestation object encoding")
+	}
+	decoded, _, err := decodeCBOR(rawAttestation)
+	if err != nil {
+		return nil, webauthnFailure("invalid attestation object: %v", err)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, webauthnFailure("invalid attestation object")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, webauthnFailure("attestation object has no authenticator data")
+	}
+	authData, err := rp.parseAuthData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.CredentialID == nil {
+		return nil, webauthnFailure("authenticator data has no attested credential")
+	}
+	if rawID, err := DecodeWebAuthnBytes(credential.RawID); err != nil || !bytes.Equal(rawID, authData.CredentialID) {
+		return nil, webauthnFailure("credential ID mismatch")
+	}
+
+	_, algorithm, err := parseCOSEKey(authData.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnRegistration{
+		CredentialID:   authData.CredentialID,
+		PublicKey:      authData.PublicKey,
+		Algorithm:      algorithm,
+		SignCount:      authData.SignCount,
+		AAGUID:         authData.AAGUID,
+		BackupEligible: authData.Flags&authDataBackupEligible != 0,
+	}, nil
+}
+
+// VerifyWebAuthnAssertion verifies an authentication ceremony answered for challenge with the
+// stored public key of the passkey, and returns the new signature counter. A counter that doesn't
+// move forward, while the authenticator keeps one, points at a cloned authenticator.
+func (rp WebAuthnRelyingParty) VerifyWebAuthnAssertion(credential *WebAuthnCredential, challenge, publicKey []byte, storedSignCount uint32) (uint32, error) {
+	if credential.Type != "public-key" {
+		return 0, webauthnFailure("unsupported credential type %q", credential.Type)
+	}
+	clientDataHash, err := rp.verifyClientData(credential.Response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+	rawAuthData, err := DecodeWebAuthnBytes(credential.Response.AuthenticatorData)
+	if err != nil {
+		return 0, webauthnFailure("invalid authenticator data encoding")
+	}
+	authData, err := rp.parseAuthData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	signature, err := DecodeWebAuthnBytes(credential.Response.Signature)
+	if err != nil {
+		return 0, webauthnFailure("invalid signature encoding")
+	}
+
+	key, algorithm, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash...)
+	if err := verifyCOSESignature(key, algorithm, signed, signature); err != nil {
+		return 0, err
+	}
+
+	if (authData.SignCount != 0 || storedSignCount != 0) && authData.SignCount <= storedSignCount {
+		return 0, webauthnFailure("signature counter went back from %d to %d, the authenticator may be cloned", storedSignCount, authData.SignCount)
+	}
+	return authData.SignCount, nil
+}
+
+// parseCOSEKey decodes a COSE_Key of one of the accepted algorithms
+func parseCOSEKey(data []byte) (crypto.PublicKey, int, error) {
+	decoded, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, 0, webauthnFailure("invalid public key: %v", err)
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, webauthnFailure("invalid public key")
+	}
+	keyType, _ := key[int64(1)].(int64)
+	algorithm, _ := key[int64(3)].(int64)
+
+	switch {
+	case keyType == 2 && algorithm == COSEAlgES256:
+		curve, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if curve != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, webauthnFailure("invalid P-256 public key")
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, 0, webauthnFailure("P-256 public key is not on the curve")
+		}
+		return publicKey, COSEAlgES256, nil
+	case keyType == 1 && algorithm == COSEAlgEdDSA:
+		curve, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		if curve != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, webauthnFailure("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), COSEAlgEdDSA, nil
+	case keyType == 3 && algorithm == COSEAlgRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, webauthnFailure("invalid RSA public key")
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, COSEAlgRS256, nil
+	}
+	return nil, 0, webauthnFailure("unsupported public key type %d with algorithm %d", keyType, algorithm)
+}
+
+// verifyCOSESignature verifies a signature of an accepted algorithm
+func verifyCOSESignature(key crypto.PublicKey, algorithm int, signed, signature []byte) error {
+	valid := false
+	switch algorithm {
+	case COSEAlgES256:
+		digest := sha256.Sum256(signed)
+		valid = ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], signature)
+	case COSEAlgEdDSA:
+		valid = ed25519.Verify(key.(ed25519.PublicKey), signed, signature)
+	case COSEAlgRS256:
+		digest := sha256.Sum256(signed)
+		valid = rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	}
+	if !valid {
+		return webauthnFailure("invalid signature")
+	}
+	return nil
+}
@@ -321,7 +321,10 @@ check_reload_signals() {
     local deploy_signal_file="/tmp/dokku-deploy-signal"
     
     if [ -f "$env_signal_file" ] || [ -f "$generic_signal_file" ] || [ -f "$deploy_signal_file" ]; then
-        log "🔔 Reload signal detected"
+        # The API writes "<timestamp> request_id=<id>" so reloads can be traced back to a request
+        local request_id
+        request_id=$(cat "$env_signal_file" "$generic_signal_file" 2>/dev/null | grep -o 'request_id=[A-Za-z0-9._:,-]*' | head -n 1)
+        log "🔔 Reload signal detected${request_id:+ ($request_id)}"
         rm -f "$env_signal_file" "$generic_signal_file" "$deploy_signal_file" 2>/dev/null
         return 0
     fi
@@ -220,6 +220,22 @@ EOF
       tls:
         certResolver: letsencrypt
       priority: 100
+
+    # ❓ Hosts matching no other router get the "app not found" page - Priority 1
+    unknown-host-http:
+      rule: "HostRegexp(\`{host:.+}\`)"
+      service: api-service
+      entryPoints: ["web"]
+      middlewares: ["host-not-found", "no-cache", "security-headers"]
+      priority: 1
+
+    unknown-host-https:
+      rule: "HostRegexp(\`{host:.+}\`)"
+      service: api-service
+      entryPoints: ["websecure"]
+      middlewares: ["host-not-found", "no-cache", "security-headers"]
+      tls: {}
+      priority: 1
 EOF
     else
         # Development mode - HTTP only routes
@@ -255,6 +271,14 @@ EOF
       entryPoints: ["web"]
       middlewares: ["auth-api", "no-cache", "security-headers"]
       priority: 100
+
+    # ❓ Hosts matching no other router get the "app not found" page - Priority 1
+    unknown-host-http:
+      rule: "HostRegexp(\`{host:.+}\`)"
+      service: api-service
+      entryPoints: ["web"]
+      middlewares: ["host-not-found", "no-cache", "security-headers"]
+      priority: 1
 EOF
     fi
 }
@@ -462,6 +486,17 @@ generate_middlewares() {
         authResponseHeaders:
           - "X-User"
           - "X-User-ID"
+          - "X-Citizen-User-Id"
+          - "X-Citizen-Username"
+          - "X-Citizen-Email"
+          - "X-Citizen-Identity-Token"
+          - "X-Citizen-Service-Account"
+          - "X-Citizen-Service-Token"
+
+    # ❓ Serve the "app not found" page for unknown hosts
+    host-not-found:
+      replacePath:
+        path: "/host-not-found"
 
     # 🚫 Cache control
     no-cache:
@@ -785,6 +785,12 @@ http:
         authResponseHeaders:
           - "X-User"
           - "X-User-ID"
+          - "X-Citizen-User-Id"
+          - "X-Citizen-Username"
+          - "X-Citizen-Email"
+          - "X-Citizen-Identity-Token"
+          - "X-Citizen-Service-Account"
+          - "X-Citizen-Service-Token"
 
     # 🚫 Cache control
     no-cache:
@@ -869,6 +875,12 @@ http:
         authResponseHeaders:
           - "X-User"
           - "X-User-ID"
+          - "X-Citizen-User-Id"
+          - "X-Citizen-Username"
+          - "X-Citizen-Email"
+          - "X-Citizen-Identity-Token"
+          - "X-Citizen-Service-Account"
+          - "X-Citizen-Service-Token"
 
     # 🚫 Cache control
     no-cache: